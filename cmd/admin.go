@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"fmt"
+	netHTTP "net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/snmp"
+)
+
+// adminRouterGroups returns the router groups for administrative
+// endpoints: `/api/v0/admin` and `/api/v0/SERVICE/admin`. They are
+// only accessible to authenticated operators.
+func adminRouterGroups(service string, httpComponent *http.Component) []*gin.RouterGroup {
+	return []*gin.RouterGroup{
+		httpComponent.GinRouter.Group("/api/v0/admin", http.RequireOperator),
+		httpComponent.GinRouter.Group(fmt.Sprintf("/api/v0/%s/admin", service), http.RequireOperator),
+	}
+}
+
+// logLevels is the representation of the log levels for the
+// administrative API.
+type logLevels struct {
+	Level  *zerolog.Level           `json:"level" binding:"required"`
+	Levels map[string]zerolog.Level `json:"levels"`
+}
+
+// addAdminHTTPHandlers configures the administrative endpoints common
+// to all services.
+func addAdminHTTPHandlers(r *reporter.Reporter, service string, httpComponent *http.Component) {
+	getLogLevels := func(gc *gin.Context) {
+		level, levels := r.Levels()
+		gc.JSON(netHTTP.StatusOK, logLevels{Level: &level, Levels: levels})
+	}
+	for _, group := range adminRouterGroups(service, httpComponent) {
+		group.GET("/log-levels", getLogLevels)
+		group.PUT("/log-levels", func(gc *gin.Context) {
+			var input logLevels
+			if err := gc.ShouldBindJSON(&input); err != nil {
+				gc.JSON(netHTTP.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+				return
+			}
+			if *input.Level == zerolog.NoLevel {
+				gc.JSON(netHTTP.StatusBadRequest, gin.H{"message": "Invalid default log level."})
+				return
+			}
+			for module, level := range input.Levels {
+				if level == zerolog.NoLevel {
+					gc.JSON(netHTTP.StatusBadRequest,
+						gin.H{"message": fmt.Sprintf("Invalid log level for %q.", module)})
+					return
+				}
+			}
+			r.SetLevels(*input.Level, input.Levels)
+			r.Info().Msg("log levels changed")
+			getLogLevels(gc)
+		})
+	}
+}
+
+// addInletAdminHTTPHandlers configures the administrative endpoints
+// for the inlet service.
+func addInletAdminHTTPHandlers(httpComponent *http.Component, flowComponent *flow.Component, snmpComponent *snmp.Component) {
+	setPaused := func(paused bool) gin.HandlerFunc {
+		return func(gc *gin.Context) {
+			input, err := strconv.Atoi(gc.Param("input"))
+			if err == nil {
+				if paused {
+					err = flowComponent.Pause(input)
+				} else {
+					err = flowComponent.Resume(input)
+				}
+			}
+			if err != nil {
+				gc.JSON(netHTTP.StatusNotFound, gin.H{"message": "Unknown input."})
+				return
+			}
+			gc.JSON(netHTTP.StatusOK, gin.H{"input": input, "paused": paused})
+		}
+	}
+	for _, group := range adminRouterGroups("inlet", httpComponent) {
+		group.POST("/flow/inputs/:input/pause", setPaused(true))
+		group.POST("/flow/inputs/:input/resume", setPaused(false))
+		group.POST("/snmp/flush", func(gc *gin.Context) {
+			gc.JSON(netHTTP.StatusOK, gin.H{"flushed": snmpComponent.FlushCache()})
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"encoding/base64"
+	netHTTP "net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/snmp"
+)
+
+func basicAuth(login, password string) netHTTP.Header {
+	h := make(netHTTP.Header)
+	h.Set("Authorization",
+		"Basic "+base64.StdEncoding.EncodeToString([]byte(login+":"+password)))
+	return h
+}
+
+func newAdminMock(t *testing.T, r *reporter.Reporter) *http.Component {
+	t.Helper()
+	config := http.DefaultConfiguration()
+	config.Listen = "127.0.0.1:0"
+	config.Authentication.Users = []http.UserConfiguration{
+		{Login: "alfred", Password: "pennyworth"},
+		{Login: "bruce", Password: "batman", Operator: true},
+	}
+	h, err := http.New(r, config, http.Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, h)
+	return h
+}
+
+func TestAdminWithoutAuthentication(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := http.NewMock(t, r)
+	addCommonHTTPHandlers(r, "inlet", h)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:        "/api/v0/admin/log-levels",
+			StatusCode: 403,
+			JSONOutput: gin.H{"message": "Authentication as an operator is required."},
+		},
+	})
+}
+
+func TestAdminLogLevels(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := newAdminMock(t, r)
+	addCommonHTTPHandlers(r, "inlet", h)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "not an operator",
+			URL:         "/api/v0/admin/log-levels",
+			Header:      basicAuth("alfred", "pennyworth"),
+			StatusCode:  403,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Forbidden."},
+		}, {
+			Description: "get log levels",
+			URL:         "/api/v0/admin/log-levels",
+			Header:      basicAuth("bruce", "batman"),
+			JSONOutput:  gin.H{"level": "debug", "levels": gin.H{}},
+		}, {
+			Description: "set log levels",
+			Method:      "PUT",
+			URL:         "/api/v0/inlet/admin/log-levels",
+			Header:      basicAuth("bruce", "batman"),
+			JSONInput: gin.H{
+				"level":  "warn",
+				"levels": gin.H{"inlet/snmp": "debug"},
+			},
+			JSONOutput: gin.H{
+				"level":  "warn",
+				"levels": gin.H{"inlet/snmp": "debug"},
+			},
+		}, {
+			Description: "get updated log levels",
+			URL:         "/api/v0/admin/log-levels",
+			Header:      basicAuth("bruce", "batman"),
+			JSONOutput: gin.H{
+				"level":  "warn",
+				"levels": gin.H{"inlet/snmp": "debug"},
+			},
+		}, {
+			Description: "missing default level",
+			Method:      "PUT",
+			URL:         "/api/v0/admin/log-levels",
+			Header:      basicAuth("bruce", "batman"),
+			JSONInput:   gin.H{"levels": gin.H{}},
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Key: 'logLevels.Level' Error:Field validation for 'Level' failed on the 'required' tag",
+			},
+		}, {
+			Description: "invalid level",
+			Method:      "PUT",
+			URL:         "/api/v0/admin/log-levels",
+			Header:      basicAuth("bruce", "batman"),
+			JSONInput:   gin.H{"level": "info", "levels": gin.H{"inlet/snmp": ""}},
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": `Invalid log level for "inlet/snmp".`},
+		},
+	})
+}
+
+func TestInletAdmin(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := newAdminMock(t, r)
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	snmpComponent := snmp.NewMock(t, r, snmp.DefaultConfiguration(), snmp.Dependencies{Daemon: daemon.NewMock(t)})
+	addInletAdminHTTPHandlers(h, flowComponent, snmpComponent)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "pause input",
+			Method:      "POST",
+			URL:         "/api/v0/inlet/admin/flow/inputs/0/pause",
+			Header:      basicAuth("bruce", "batman"),
+			JSONOutput:  gin.H{"input": 0, "paused": true},
+		}, {
+			Description: "resume input",
+			Method:      "POST",
+			URL:         "/api/v0/admin/flow/inputs/0/resume",
+			Header:      basicAuth("bruce", "batman"),
+			JSONOutput:  gin.H{"input": 0, "paused": false},
+		}, {
+			Description: "unknown input",
+			Method:      "POST",
+			URL:         "/api/v0/inlet/admin/flow/inputs/10/pause",
+			Header:      basicAuth("bruce", "batman"),
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "Unknown input."},
+		}, {
+			Description: "flush SNMP cache",
+			Method:      "POST",
+			URL:         "/api/v0/inlet/admin/snmp/flush",
+			Header:      basicAuth("bruce", "batman"),
+			JSONOutput:  gin.H{"flushed": 0},
+		},
+	})
+}
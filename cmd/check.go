@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"akvorado/common/reporter"
+)
+
+type checkOptions struct {
+	Service string
+}
+
+// CheckOptions stores the command-line option values for the check
+// command.
+var CheckOptions checkOptions
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the configuration of a service",
+	Long: `Check the configuration of a service without starting it. The configuration is
+parsed and validated and each component is initialized. GeoIP databases are
+opened. When checking the configuration of the orchestrator, the configurations
+of the other services it contains are checked too. The command exits with a
+non-zero status if the configuration is invalid.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkConfiguration(CheckOptions.Service, args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().StringVarP(&CheckOptions.Service, "service", "s", "orchestrator",
+		"Service to check the configuration for (orchestrator, inlet, console or demo-exporter)")
+}
+
+// checkConfiguration checks the configuration of the provided service.
+// All the errors are reported, prefixed by the service they belong to.
+func checkConfiguration(service string, path string) error {
+	options := ConfigRelatedOptions{Path: path}
+	checker := configurationChecker{}
+	switch service {
+	case "orchestrator":
+		config := OrchestratorConfiguration{}
+		options.BeforeDump = config.propagate
+		if err := options.Parse(io.Discard, service, &config); err != nil {
+			return err
+		}
+		checker.check(service, config.Reporting, func(r *reporter.Reporter) error {
+			return orchestratorStart(r, config, true)
+		})
+		for idx := range config.Inlet {
+			config := config.Inlet[idx]
+			checker.check(fmt.Sprintf("inlet[%d]", idx), config.Reporting, func(r *reporter.Reporter) error {
+				return inletStart(r, config, true)
+			})
+		}
+		for idx := range config.Console {
+			config := config.Console[idx]
+			checker.check(fmt.Sprintf("console[%d]", idx), config.Reporting, func(r *reporter.Reporter) error {
+				return consoleStart(r, config, true)
+			})
+		}
+		for idx := range config.DemoExporter {
+			config := config.DemoExporter[idx]
+			checker.check(fmt.Sprintf("demo-exporter[%d]", idx), config.Reporting, func(r *reporter.Reporter) error {
+				return demoExporterStart(r, config, true)
+			})
+		}
+	case "inlet":
+		config := InletConfiguration{}
+		options.BeforeDump = config.propagate
+		if err := options.Parse(io.Discard, service, &config); err != nil {
+			return err
+		}
+		checker.check(service, config.Reporting, func(r *reporter.Reporter) error {
+			return inletStart(r, config, true)
+		})
+	case "console":
+		config := ConsoleConfiguration{}
+		if err := options.Parse(io.Discard, service, &config); err != nil {
+			return err
+		}
+		checker.check(service, config.Reporting, func(r *reporter.Reporter) error {
+			return consoleStart(r, config, true)
+		})
+	case "demo-exporter":
+		config := DemoExporterConfiguration{}
+		if err := options.Parse(io.Discard, service, &config); err != nil {
+			return err
+		}
+		checker.check(service, config.Reporting, func(r *reporter.Reporter) error {
+			return demoExporterStart(r, config, true)
+		})
+	default:
+		return fmt.Errorf("unknown service %q", service)
+	}
+	if len(checker.errors) > 0 {
+		return fmt.Errorf("invalid configuration:\n%s", strings.Join(checker.errors, "\n"))
+	}
+	return nil
+}
+
+// configurationChecker collects the errors when checking the
+// configuration of several services.
+type configurationChecker struct {
+	errors []string
+}
+
+// check runs the provided check function with a dedicated reporter and
+// records the error, if any.
+func (cc *configurationChecker) check(name string, config reporter.Configuration, fn func(*reporter.Reporter) error) {
+	r, err := newReporter(name, config)
+	if err == nil {
+		err = fn(r)
+	} else {
+		err = fmt.Errorf("unable to initialize reporter: %w", err)
+	}
+	if err != nil {
+		cc.errors = append(cc.errors, fmt.Sprintf("%s: %s", name, err))
+	}
+}
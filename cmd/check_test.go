@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile() error:\n%+v", err)
+		}
+		return path
+	}
+	missingDatabase := filepath.Join(dir, "missing.mmdb")
+	cases := []struct {
+		Description string
+		Service     string
+		Path        string
+		Error       string
+	}{
+		{
+			Description: "shipped configuration",
+			Service:     "orchestrator",
+			Path:        filepath.Join("testdata", "configurations", "shipped", "in.yaml"),
+		}, {
+			Description: "valid inlet configuration",
+			Service:     "inlet",
+			Path:        write("inlet-valid.yaml", "core:\n  drop-filter: DstPort = 443\n"),
+		}, {
+			Description: "inlet configuration with a missing GeoIP database",
+			Service:     "inlet",
+			Path:        write("inlet-geoip.yaml", "geoip:\n  geo-database: "+missingDatabase+"\n"),
+			Error:       "inlet: invalid GeoIP configuration: cannot open geo database",
+		}, {
+			Description: "inlet configuration with an invalid regular expression",
+			Service:     "inlet",
+			Path: write("inlet-regex.yaml",
+				"core:\n  exporter-classifiers:\n    - ClassifyRegex(Exporter.Name, \"^(edge\", \"$1\")\n"),
+			Error: "invalid regular expression",
+		}, {
+			Description: "inlet configuration with an invalid filter",
+			Service:     "inlet",
+			Path:        write("inlet-filter.yaml", "core:\n  drop-filter: DstPort = hello\n"),
+			Error:       "cannot parse filter",
+		}, {
+			Description: "orchestrator configuration with an invalid inlet configuration",
+			Service:     "orchestrator",
+			Path: write("orchestrator.yaml",
+				"inlet:\n  - {}\n  - geoip:\n      asn-database: "+missingDatabase+"\n"),
+			Error: "inlet[1]: invalid GeoIP configuration: cannot open asn database",
+		}, {
+			Description: "unknown service",
+			Service:     "outlet",
+			Path:        "/dev/null",
+			Error:       `unknown service "outlet"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			err := checkConfiguration(tc.Service, tc.Path)
+			if err != nil && tc.Error == "" {
+				t.Fatalf("checkConfiguration() error:\n%+v", err)
+			} else if err == nil && tc.Error != "" {
+				t.Fatalf("checkConfiguration() did not error")
+			} else if err != nil && !strings.Contains(err.Error(), tc.Error) {
+				t.Fatalf("checkConfiguration() error:\n%+v\nshould contain %q", err, tc.Error)
+			}
+		})
+	}
+}
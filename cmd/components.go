@@ -32,13 +32,37 @@ func StartStopComponents(r *reporter.Reporter, daemonComponent daemon.Component,
 		startedComponents = append([]interface{}{cmp}, startedComponents...)
 	}
 
+	daemonComponent.Ready()
 	r.Info().
 		Str("version", Version).Str("build-date", BuildDate).
 		Msg("akvorado has started")
 
-	<-daemonComponent.Terminated()
-	r.Info().Msg("stopping all components")
-	return nil
+	for {
+		select {
+		case <-daemonComponent.Terminated():
+			r.Info().Msg("stopping all components")
+			return nil
+		case <-daemonComponent.ReloadRequested():
+			reloadComponents(r, components)
+		}
+	}
+}
+
+// reloadComponents asks components able to do so to reload their
+// configuration.
+func reloadComponents(r *reporter.Reporter, components []interface{}) {
+	reloaded := false
+	for _, cmp := range components {
+		if reloaderC, ok := cmp.(reloader); ok {
+			reloaded = true
+			if err := reloaderC.Reload(); err != nil {
+				r.Err(err).Msg("unable to reload configuration")
+			}
+		}
+	}
+	if !reloaded {
+		r.Warn().Msg("configuration reload is not supported, restart to apply changes")
+	}
 }
 
 type starter interface {
@@ -47,3 +71,6 @@ type starter interface {
 type stopper interface {
 	Stop() error
 }
+type reloader interface {
+	Reload() error
+}
@@ -6,6 +6,7 @@ package cmd_test
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"akvorado/cmd"
 	"akvorado/common/daemon"
@@ -82,3 +83,39 @@ func TestStartStop(t *testing.T) {
 		t.Errorf("StartStopComponents() (-got, +want):\n%s", diff)
 	}
 }
+
+type ComponentReload struct {
+	Reloaded chan struct{}
+}
+
+func (c *ComponentReload) Reload() error {
+	c.Reloaded <- struct{}{}
+	return nil
+}
+
+func TestStartStopReload(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	component := &ComponentReload{Reloaded: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- cmd.StartStopComponents(r, daemonComponent, []interface{}{component})
+	}()
+
+	daemonComponent.Reload()
+	select {
+	case <-component.Reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("Reload() was not called")
+	}
+
+	daemonComponent.Terminate()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("StartStopComponents() error:\n%+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("StartStopComponents() did not stop")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strconv"
@@ -66,12 +67,10 @@ func (c ConfigRelatedOptions) Parse(out io.Writer, component string, config inte
 				return fmt.Errorf("unable to parse YAML configuration file: %w", err)
 			}
 		} else {
-			input, err := ioutil.ReadFile(cfgFile)
+			var err error
+			rawConfig, err = readConfigurationFile(cfgFile, nil)
 			if err != nil {
-				return fmt.Errorf("unable to read configuration file: %w", err)
-			}
-			if err := yaml.Unmarshal(input, &rawConfig); err != nil {
-				return fmt.Errorf("unable to parse YAML configuration file: %w", err)
+				return err
 			}
 		}
 	}
@@ -93,34 +92,47 @@ func (c ConfigRelatedOptions) Parse(out io.Writer, component string, config inte
 	disableDefaultHook()
 	disableZeroSliceHook()
 
-	// Override with environment variables
+	// Override with environment variables. Variables without the
+	// name of a service (AKVORADO_KAFKA_BROKERS) are applied first
+	// and ignored if the key does not exist for this service. Then,
+	// variables with the name of this service are applied
+	// (AKVORADO_INLET_KAFKA_BROKERS).
+	genericOverrides := [][]string{}
+	serviceOverrides := [][]string{}
 	for _, keyval := range os.Environ() {
 		kv := strings.SplitN(keyval, "=", 2)
 		if len(kv) != 2 {
 			continue
 		}
 		kk := strings.Split(kv[0], "_")
-		if len(kk) < 3 || kk[0] != "AKVORADO" || kk[1] != strings.ToUpper(component) {
+		if len(kk) < 2 || kk[0] != "AKVORADO" {
 			continue
 		}
-		// From AKVORADO_CMP_SQUID_PURPLE_QUIRK=47, we
-		// build a map "squid -> purple -> quirk ->
-		// 47". From AKVORADO_CMP_SQUID_3_PURPLE=47, we
-		// build "squid[3] -> purple -> 47"
-		var rawConfig interface{}
-		rawConfig = kv[1]
-		for i := len(kk) - 1; i > 1; i-- {
-			if index, err := strconv.Atoi(kk[i]); err == nil {
-				newRawConfig := make([]interface{}, index+1)
-				newRawConfig[index] = rawConfig
-				rawConfig = newRawConfig
-			} else {
-				rawConfig = gin.H{
-					kk[i]: rawConfig,
-				}
+		switch {
+		case kk[1] == envServiceName(component):
+			if len(kk) >= 3 {
+				serviceOverrides = append(serviceOverrides, kv)
 			}
+		case !envServiceNames[kk[1]]:
+			genericOverrides = append(genericOverrides, kv)
 		}
-		if err := decoder.Decode(rawConfig); err != nil {
+	}
+	sort.Slice(genericOverrides, func(i, j int) bool { return genericOverrides[i][0] < genericOverrides[j][0] })
+	sort.Slice(serviceOverrides, func(i, j int) bool { return serviceOverrides[i][0] < serviceOverrides[j][0] })
+	genericDecoderConfig := helpers.GetMapStructureDecoderConfig(&config)
+	genericDecoderConfig.ErrorUnused = false
+	genericDecoderConfig.Metadata = &mapstructure.Metadata{}
+	genericDecoder, err := mapstructure.NewDecoder(genericDecoderConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create configuration decoder: %w", err)
+	}
+	for _, kv := range genericOverrides {
+		if err := genericDecoder.Decode(envToRawConfig(strings.Split(kv[0], "_")[1:], kv[1])); err != nil {
+			return fmt.Errorf("unable to parse override %q: %w", kv[0], err)
+		}
+	}
+	for _, kv := range serviceOverrides {
+		if err := decoder.Decode(envToRawConfig(strings.Split(kv[0], "_")[2:], kv[1])); err != nil {
 			return fmt.Errorf("unable to parse override %q: %w", kv[0], err)
 		}
 	}
@@ -162,6 +174,165 @@ func (c ConfigRelatedOptions) Parse(out io.Writer, component string, config inte
 	return nil
 }
 
+// readConfigurationFile reads a configuration file and the files it
+// includes. Files listed under the top-level "include" key are merged
+// in order, then the content of the file itself is merged on top of
+// them. Maps are merged recursively, other values are replaced.
+// Relative paths are relative to the including file. A directory
+// includes all the YAML files it contains, in lexical order. Glob
+// patterns are also accepted. parents contains the files being read
+// and is used to detect loops.
+func readConfigurationFile(path string, parents []string) (gin.H, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration file: %w", err)
+	}
+	for _, parent := range parents {
+		if parent == absPath {
+			return nil, fmt.Errorf("configuration file %q includes itself", path)
+		}
+	}
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration file: %w", err)
+	}
+	var rawConfig gin.H
+	if err := yaml.Unmarshal(input, &rawConfig); err != nil {
+		return nil, fmt.Errorf("unable to parse YAML configuration file %q: %w", path, err)
+	}
+	rawIncludes, ok := rawConfig["include"]
+	if !ok {
+		return rawConfig, nil
+	}
+	delete(rawConfig, "include")
+	includes := []string{}
+	switch rawIncludes := rawIncludes.(type) {
+	case string:
+		includes = append(includes, rawIncludes)
+	case []interface{}:
+		for _, include := range rawIncludes {
+			include, ok := include.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid include in configuration file %q", path)
+			}
+			includes = append(includes, include)
+		}
+	default:
+		return nil, fmt.Errorf("invalid include in configuration file %q", path)
+	}
+
+	parents = append(parents, absPath)
+	merged := gin.H{}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		files, err := expandInclude(include)
+		if err != nil {
+			return nil, fmt.Errorf("unable to include %q from %q: %w", include, path, err)
+		}
+		for _, file := range files {
+			included, err := readConfigurationFile(file, parents)
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeRawConfig(merged, included).(gin.H)
+		}
+	}
+	return mergeRawConfig(merged, rawConfig).(gin.H), nil
+}
+
+// expandInclude returns the files matching an include. It can be a
+// file, a directory or a glob pattern.
+func expandInclude(include string) ([]string, error) {
+	if strings.ContainsAny(include, "*?[") {
+		files, err := filepath.Glob(include)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+	info, err := os.Stat(include)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{include}, nil
+	}
+	entries, err := os.ReadDir(include)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		files = append(files, filepath.Join(include, entry.Name()))
+	}
+	return files, nil
+}
+
+// mergeRawConfig merges src into dst. Maps are merged recursively.
+// Other values from src replace the ones in dst.
+func mergeRawConfig(dst, src interface{}) interface{} {
+	switch src := src.(type) {
+	case gin.H:
+		if dst, ok := dst.(gin.H); ok {
+			for k, v := range src {
+				dst[k] = mergeRawConfig(dst[k], v)
+			}
+			return dst
+		}
+	case map[interface{}]interface{}:
+		if dst, ok := dst.(map[interface{}]interface{}); ok {
+			for k, v := range src {
+				dst[k] = mergeRawConfig(dst[k], v)
+			}
+			return dst
+		}
+	}
+	return src
+}
+
+// envServiceNames are the names of the services, as used in
+// environment variables.
+var envServiceNames = map[string]bool{
+	"ORCHESTRATOR": true,
+	"INLET":        true,
+	"CONSOLE":      true,
+	"DEMOEXPORTER": true,
+}
+
+// envServiceName returns the name of a service, as used in
+// environment variables.
+func envServiceName(component string) string {
+	return strings.ToUpper(strings.ReplaceAll(component, "-", ""))
+}
+
+// envToRawConfig turns the keys of an environment variable into a
+// raw configuration. From SQUID_PURPLE_QUIRK=47, we build a map
+// "squid -> purple -> quirk -> 47". From SQUID_3_PURPLE=47, we build
+// "squid[3] -> purple -> 47".
+func envToRawConfig(keys []string, value string) interface{} {
+	var rawConfig interface{}
+	rawConfig = value
+	for i := len(keys) - 1; i >= 0; i-- {
+		if index, err := strconv.Atoi(keys[i]); err == nil {
+			newRawConfig := make([]interface{}, index+1)
+			newRawConfig[index] = rawConfig
+			rawConfig = newRawConfig
+		} else {
+			rawConfig = gin.H{
+				keys[i]: rawConfig,
+			}
+		}
+	}
+	return rawConfig
+}
+
 // DefaultHook will reset the destination value to its default using
 // the Reset() method if present.
 func DefaultHook() (mapstructure.DecodeHookFunc, func()) {
@@ -186,6 +186,123 @@ module2:
 	}
 }
 
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() error:\n%+v", err)
+		}
+		return path
+	}
+	configFile := write("config.yaml", `---
+include:
+ - module1.yaml
+ - module2
+module2:
+ details:
+  workers: 5
+`)
+	write("module1.yaml", `---
+module1:
+ topic: flows
+ workers: 10
+`)
+	write("module2/10-details.yaml", `---
+module2:
+ details:
+  workers: 2
+  interval-value: 20m
+`)
+	write("module2/20-elements.yml", `---
+include: ../module1-workers.yaml
+module2:
+ elements:
+  - name: first
+    gauge: 67
+`)
+	write("module2/30-ignored.txt", `---
+module2:
+ stuff: ignored
+`)
+	write("module1-workers.yaml", `---
+module1:
+ workers: 20
+module2:
+ elements:
+  - name: replaced
+`)
+
+	c := cmd.ConfigRelatedOptions{Path: configFile}
+	parsed := dummyConfiguration{}
+	if err := c.Parse(ioutil.Discard, "dummy", &parsed); err != nil {
+		t.Fatalf("Parse() error:\n%+v", err)
+	}
+	expected := dummyConfiguration{
+		Module1: dummyModule1Configuration{
+			Listen:  "127.0.0.1:8080",
+			Topic:   "flows",
+			Workers: 20,
+		},
+		Module2: dummyModule2Configuration{
+			MoreDetails: MoreDetails{
+				Stuff: "hello",
+			},
+			Details: dummyModule2DetailsConfiguration{
+				Workers:       5,
+				IntervalValue: 20 * time.Minute,
+			},
+			Elements: []dummyModule2ElementsConfiguration{
+				{"first", 67},
+			},
+		},
+	}
+	if diff := helpers.Diff(parsed, expected); diff != "" {
+		t.Errorf("Parse() (-got, +want):\n%s", diff)
+	}
+
+	t.Run("glob", func(t *testing.T) {
+		configFile := write("glob.yaml", `---
+include: module2/*.yaml
+`)
+		c := cmd.ConfigRelatedOptions{Path: configFile}
+		parsed := dummyConfiguration{}
+		if err := c.Parse(ioutil.Discard, "dummy", &parsed); err != nil {
+			t.Fatalf("Parse() error:\n%+v", err)
+		}
+		if parsed.Module2.Details.Workers != 2 {
+			t.Errorf("Parse() got %d workers, expected 2", parsed.Module2.Details.Workers)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			Description string
+			Config      string
+			Error       string
+		}{
+			{"missing file", "include: missing.yaml", "missing.yaml"},
+			{"invalid include", "include: {a: b}", "invalid include"},
+			{"loop", "include: loop.yaml", "includes itself"},
+		}
+		for _, tc := range cases {
+			t.Run(tc.Description, func(t *testing.T) {
+				configFile := write("loop.yaml", tc.Config)
+				c := cmd.ConfigRelatedOptions{Path: configFile}
+				parsed := dummyConfiguration{}
+				err := c.Parse(ioutil.Discard, "dummy", &parsed)
+				if err == nil {
+					t.Fatal("Parse() did not error")
+				}
+				if !strings.Contains(err.Error(), tc.Error) {
+					t.Fatalf("Parse() error %q does not contain %q", err, tc.Error)
+				}
+			})
+		}
+	})
+}
+
 func TestEnvOverride(t *testing.T) {
 	// Configuration file
 	config := `---
@@ -254,6 +371,73 @@ module2:
 	}
 }
 
+func TestGenericEnvOverride(t *testing.T) {
+	// Configuration file
+	config := `---
+module1:
+ topic: flows
+`
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	ioutil.WriteFile(configFile, []byte(config), 0644)
+
+	// Environment
+	clean := func() {
+		for _, env := range os.Environ() {
+			if strings.HasPrefix(env, "AKVORADO_") {
+				os.Unsetenv(strings.Split(env, "=")[0])
+			}
+		}
+	}
+	clean()
+	defer clean()
+	os.Setenv("AKVORADO_MODULE1_LISTEN", "127.0.0.1:9000")
+	os.Setenv("AKVORADO_MODULE1_TOPIC", "generic")
+	os.Setenv("AKVORADO_DUMMY_MODULE1_TOPIC", "specific")
+	os.Setenv("AKVORADO_MODULE2_DETAILS_WORKERS", "7")
+	os.Setenv("AKVORADO_MODULE3_UNKNOWN", "ignored")
+	os.Setenv("AKVORADO_INLET_MODULE1_WORKERS", "4")
+
+	c := cmd.ConfigRelatedOptions{
+		Path: configFile,
+	}
+
+	parsed := dummyConfiguration{}
+	out := bytes.NewBuffer([]byte{})
+	if err := c.Parse(out, "dummy", &parsed); err != nil {
+		t.Fatalf("Parse() error:\n%+v", err)
+	}
+	// Expected configuration
+	expected := dummyConfiguration{
+		Module1: dummyModule1Configuration{
+			Listen:  "127.0.0.1:9000",
+			Topic:   "specific",
+			Workers: 100,
+		},
+		Module2: dummyModule2Configuration{
+			MoreDetails: MoreDetails{
+				Stuff: "hello",
+			},
+			Details: dummyModule2DetailsConfiguration{
+				Workers:       7,
+				IntervalValue: time.Minute,
+			},
+			Elements: []dummyModule2ElementsConfiguration{
+				{"el1", 10},
+				{"el2", 11},
+			},
+		},
+	}
+	if diff := helpers.Diff(parsed, expected); diff != "" {
+		t.Errorf("Parse() (-got, +want):\n%s", diff)
+	}
+
+	// Unknown keys are not ignored for service-specific overrides
+	os.Setenv("AKVORADO_DUMMY_MODULE3_UNKNOWN", "error")
+	if err := c.Parse(out, "dummy", &dummyConfiguration{}); err == nil {
+		t.Fatal("Parse() did not error")
+	}
+}
+
 func TestHTTPConfiguration(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/x-yaml; charset=utf-8")
@@ -24,7 +24,7 @@ containers started with the label "akvorado.conntrack.fix=1".`,
 	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// This is a simplified service which is not configurable.
-		r, err := reporter.New(reporter.DefaultConfiguration())
+		r, err := newReporter("conntrack-fixer", reporter.DefaultConfiguration())
 		if err != nil {
 			return fmt.Errorf("unable to initialize reporter: %w", err)
 		}
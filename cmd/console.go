@@ -62,7 +62,7 @@ manage collected flows.`,
 		}
 		config.Console.Version = Version
 
-		r, err := reporter.New(config.Reporting)
+		r, err := newReporter("console", config.Reporting)
 		if err != nil {
 			return fmt.Errorf("unable to initialize reporter: %w", err)
 		}
@@ -0,0 +1,284 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/spf13/cobra"
+
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/decoder/netflow"
+	"akvorado/inlet/flow/decoder/sflow"
+)
+
+type debugDecodeOptions struct {
+	Decoder  string
+	Format   string
+	Exporter string
+}
+
+// DebugDecodeOptions stores the command-line option values for the
+// debug decode command.
+var DebugDecodeOptions debugDecodeOptions
+
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "Debugging helpers",
+}
+
+var debugDecodeCmd = &cobra.Command{
+	Use:   "decode FILE...",
+	Short: "Decode NetFlow, IPFIX or sFlow datagrams",
+	Long: `Decode NetFlow v9, IPFIX or sFlow datagrams from PCAP files or hex dumps
+and print the decoded flows. Files are decoded in order using the same decoder,
+so a file containing templates can be provided before a file containing data.
+The templates known by the decoder are displayed at the end. A hex dump may
+contain several datagrams separated by an empty line. Use "-" to read a hex
+dump from the standard input.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := newReporter("debug", reporter.DefaultConfiguration())
+		if err != nil {
+			return fmt.Errorf("unable to initialize reporter: %w", err)
+		}
+		return debugDecode(r, DebugDecodeOptions, args, cmd.InOrStdin(), cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(debugCmd)
+	debugCmd.AddCommand(debugDecodeCmd)
+	debugDecodeCmd.Flags().StringVar(&DebugDecodeOptions.Decoder, "decoder", "auto",
+		"Decoder to use (auto, netflow or sflow)")
+	debugDecodeCmd.Flags().StringVar(&DebugDecodeOptions.Format, "format", "auto",
+		"Format of the input files (auto, pcap or hex)")
+	debugDecodeCmd.Flags().StringVar(&DebugDecodeOptions.Exporter, "exporter", "127.0.0.1",
+		"Exporter IP address for datagrams from hex dumps")
+}
+
+// debugDatagram is a datagram to decode.
+type debugDatagram struct {
+	Source  net.IP
+	Payload []byte
+}
+
+// debugDecode decodes the datagrams from the provided files and
+// prints the result to the provided writer.
+func debugDecode(r *reporter.Reporter, options debugDecodeOptions, files []string, stdin io.Reader, out io.Writer) error {
+	exporter := net.ParseIP(options.Exporter)
+	if exporter == nil {
+		return fmt.Errorf("invalid exporter IP address %q", options.Exporter)
+	}
+	datagrams := []debugDatagram{}
+	for _, file := range files {
+		var (
+			d   []debugDatagram
+			err error
+		)
+		format := options.Format
+		if format == "auto" {
+			format = "hex"
+			if ext := filepath.Ext(file); ext == ".pcap" || ext == ".pcapng" {
+				format = "pcap"
+			}
+		}
+		switch format {
+		case "pcap":
+			d, err = readPcapDatagrams(file)
+		case "hex":
+			d, err = readHexDatagrams(file, stdin, exporter)
+		default:
+			return fmt.Errorf("unknown format %q", options.Format)
+		}
+		if err != nil {
+			return err
+		}
+		datagrams = append(datagrams, d...)
+	}
+
+	decoders := map[string]decoder.Decoder{}
+	failed := 0
+	for idx, datagram := range datagrams {
+		name := options.Decoder
+		if name == "auto" {
+			name = guessDecoder(datagram.Payload)
+		}
+		d, ok := decoders[name]
+		if !ok {
+			switch name {
+			case "netflow":
+				d = netflow.New(r)
+			case "sflow":
+				d = sflow.New(r)
+			default:
+				return fmt.Errorf("datagram %d: unknown decoder %q", idx+1, name)
+			}
+			decoders[name] = d
+		}
+		flows := d.Decode(decoder.RawFlow{
+			TimeReceived: time.Now(),
+			Payload:      datagram.Payload,
+			Source:       datagram.Source,
+		})
+		if flows == nil {
+			fmt.Fprintf(out, "# datagram %d from %s (%s): cannot decode\n", idx+1, datagram.Source, name)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "# datagram %d from %s (%s): %d flows\n", idx+1, datagram.Source, name, len(flows))
+		for _, flow := range flows {
+			encoded, err := json.MarshalIndent(flow, "", "  ")
+			if err != nil {
+				return fmt.Errorf("cannot encode flow: %w", err)
+			}
+			fmt.Fprintf(out, "%s\n", encoded)
+		}
+	}
+
+	if d, ok := decoders["netflow"]; ok {
+		templates := d.(*netflow.Decoder).Templates()
+		fmt.Fprintf(out, "# %d templates\n", len(templates))
+		for _, template := range templates {
+			encoded, err := json.MarshalIndent(template, "", "  ")
+			if err != nil {
+				return fmt.Errorf("cannot encode template: %w", err)
+			}
+			fmt.Fprintf(out, "%s\n", encoded)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d datagrams cannot be decoded", failed)
+	}
+	return nil
+}
+
+// guessDecoder returns the decoder to use for the provided payload.
+func guessDecoder(payload []byte) string {
+	switch {
+	case len(payload) >= 4 && bytes.Equal(payload[:4], []byte{0, 0, 0, 5}):
+		return "sflow"
+	case len(payload) >= 2 && payload[0] == 0 && (payload[1] == 9 || payload[1] == 10):
+		return "netflow"
+	}
+	return "unknown"
+}
+
+// readPcapDatagrams reads the UDP datagrams from a PCAP or PCAPNG file.
+func readPcapDatagrams(file string) ([]debugDatagram, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %q: %w", file, err)
+	}
+	defer f.Close()
+
+	var source gopacket.PacketDataSource
+	if reader, err := pcapgo.NewReader(f); err == nil {
+		source = reader
+	} else {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("unable to read %q: %w", file, err)
+		}
+		reader, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %q: not a PCAP file", file)
+		}
+		source = reader
+	}
+	linkType := layers.LinkTypeEthernet
+	if lt, ok := source.(interface{ LinkType() layers.LinkType }); ok {
+		linkType = lt.LinkType()
+	}
+
+	datagrams := []debugDatagram{}
+	packets := gopacket.NewPacketSource(source, linkType)
+	for packet := range packets.Packets() {
+		udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+		if !ok {
+			continue
+		}
+		var src net.IP
+		switch network := packet.NetworkLayer().(type) {
+		case *layers.IPv4:
+			src = network.SrcIP
+		case *layers.IPv6:
+			src = network.SrcIP
+		default:
+			continue
+		}
+		datagrams = append(datagrams, debugDatagram{
+			Source:  src,
+			Payload: udp.Payload,
+		})
+	}
+	return datagrams, nil
+}
+
+// readHexDatagrams reads datagrams from a hex dump. Datagrams are
+// separated by empty lines. Whitespaces, colons and "0x" prefixes are
+// ignored.
+func readHexDatagrams(file string, stdin io.Reader, source net.IP) ([]debugDatagram, error) {
+	in := stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %q: %w", file, err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	datagrams := []debugDatagram{}
+	current := strings.Builder{}
+	flush := func() error {
+		if current.Len() == 0 {
+			return nil
+		}
+		payload, err := hex.DecodeString(current.String())
+		if err != nil {
+			return fmt.Errorf("unable to decode hex dump in %q: %w", file, err)
+		}
+		datagrams = append(datagrams, debugDatagram{Source: source, Payload: payload})
+		current.Reset()
+		return nil
+	}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		line = strings.ReplaceAll(line, "0x", "")
+		line = strings.NewReplacer(" ", "", "\t", "", ":", "").Replace(line)
+		current.WriteString(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %q: %w", file, err)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(datagrams) == 0 {
+		return nil, fmt.Errorf("no datagram found in %q", file)
+	}
+	return datagrams, nil
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestDebugDecodePcap(t *testing.T) {
+	r := reporter.NewMock(t)
+	testdata := filepath.Join("..", "inlet", "flow", "decoder", "netflow", "testdata")
+	out := new(bytes.Buffer)
+	err := debugDecode(r, debugDecodeOptions{Decoder: "auto", Format: "auto", Exporter: "127.0.0.1"},
+		[]string{
+			filepath.Join(testdata, "template-260.pcap"),
+			filepath.Join(testdata, "data-260.pcap"),
+		}, nil, out)
+	if err != nil {
+		t.Fatalf("debugDecode() error:\n%+v", err)
+	}
+	got := []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "# ") {
+			got = append(got, line)
+		}
+	}
+	expected := []string{
+		"# datagram 1 from 192.0.2.100 (netflow): 0 flows",
+		"# datagram 2 from 192.0.2.100 (netflow): 4 flows",
+		"# 1 templates",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("debugDecode() (-got, +want):\n%s", diff)
+	}
+	if !strings.Contains(out.String(), `"template-id": 260`) {
+		t.Errorf("debugDecode() did not display template 260")
+	}
+}
+
+func TestDebugDecodeHex(t *testing.T) {
+	r := reporter.NewMock(t)
+	testdata := filepath.Join("..", "inlet", "flow", "decoder", "sflow", "testdata")
+	datagrams, err := readPcapDatagrams(filepath.Join(testdata, "data-1140.pcap"))
+	if err != nil {
+		t.Fatalf("readPcapDatagrams() error:\n%+v", err)
+	}
+	dump := hex.Dump(datagrams[0].Payload)
+	// Keep only the hex part of the dump
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(dump), "\n") {
+		lines = append(lines, strings.TrimSpace(line[8:58]))
+	}
+	input := strings.Join(lines, "\n") + "\n\n" + "00 0a 00 02\n"
+
+	out := new(bytes.Buffer)
+	err = debugDecode(r, debugDecodeOptions{Decoder: "auto", Format: "hex", Exporter: "192.0.2.1"},
+		[]string{"-"}, strings.NewReader(input), out)
+	if err == nil {
+		t.Fatal("debugDecode() did not error on invalid datagram")
+	}
+	got := []string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "# ") {
+			got = append(got, line)
+		}
+	}
+	expected := []string{
+		"# datagram 1 from 192.0.2.1 (sflow): 5 flows",
+		"# datagram 2 from 192.0.2.1 (netflow): cannot decode",
+		"# 0 templates",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("debugDecode() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDebugDecodeErrors(t *testing.T) {
+	r := reporter.NewMock(t)
+	empty := filepath.Join(t.TempDir(), "empty.hex")
+	if err := os.WriteFile(empty, []byte("\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	invalid := filepath.Join(t.TempDir(), "invalid.hex")
+	if err := os.WriteFile(invalid, []byte("zz\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	cases := []struct {
+		Description string
+		Options     debugDecodeOptions
+		Files       []string
+	}{
+		{"invalid exporter", debugDecodeOptions{"auto", "auto", "nope"}, []string{empty}},
+		{"unknown format", debugDecodeOptions{"auto", "nope", "127.0.0.1"}, []string{empty}},
+		{"empty file", debugDecodeOptions{"auto", "auto", "127.0.0.1"}, []string{empty}},
+		{"invalid hex", debugDecodeOptions{"auto", "auto", "127.0.0.1"}, []string{invalid}},
+		{"not a pcap", debugDecodeOptions{"auto", "pcap", "127.0.0.1"}, []string{empty}},
+		{"missing file", debugDecodeOptions{"auto", "auto", "127.0.0.1"}, []string{"/nonexistent"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			if err := debugDecode(r, tc.Options, tc.Files, nil, new(bytes.Buffer)); err == nil {
+				t.Fatal("debugDecode() did not error")
+			}
+		})
+	}
+}
@@ -61,7 +61,7 @@ and answers SNMP requests.`,
 			return err
 		}
 
-		r, err := reporter.New(config.Reporting)
+		r, err := newReporter("demo-exporter", config.Reporting)
 		if err != nil {
 			return fmt.Errorf("unable to initialize reporter: %w", err)
 		}
@@ -12,12 +12,18 @@ import (
 
 // addCommonHTTPHandlers configures various endpoints common to all
 // services. Each endpoint is registered under `/api/v0` and
-// `/api/v0/SERVICE` namespaces.
+// `/api/v0/SERVICE` namespaces. Liveness and readiness endpoints are
+// also registered as `/healthz` and `/readyz`.
 func addCommonHTTPHandlers(r *reporter.Reporter, service string, httpComponent *http.Component) {
+	httpComponent.GinRouter.GET("/healthz", r.HealthcheckHTTPHandler)
+	httpComponent.GinRouter.GET("/readyz", r.ReadinessHTTPHandler)
+	httpComponent.AddHandler("/healthz", httpComponent.GinRouter)
+	httpComponent.AddHandler("/readyz", httpComponent.GinRouter)
 	httpComponent.AddHandler(fmt.Sprintf("/api/v0/%s/metrics", service), r.MetricsHTTPHandler())
 	httpComponent.AddHandler("/api/v0/metrics", r.MetricsHTTPHandler())
 	httpComponent.GinRouter.GET(fmt.Sprintf("/api/v0/%s/healthcheck", service), r.HealthcheckHTTPHandler)
 	httpComponent.GinRouter.GET("/api/v0/healthcheck", r.HealthcheckHTTPHandler)
 	httpComponent.GinRouter.GET(fmt.Sprintf("/api/v0/%s/version", service), versionHandler)
 	httpComponent.GinRouter.GET("/api/v0/version", versionHandler)
+	addAdminHTTPHandlers(r, service, httpComponent)
 }
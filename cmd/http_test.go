@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := http.NewMock(t, r)
+	addCommonHTTPHandlers(r, "inlet", h)
+	r.RegisterHealthcheck("core", func(context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "worker 0 ok"}
+	})
+	r.RegisterReadinessCheck("kafka", func(context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{Status: reporter.HealthcheckError, Reason: "cannot reach Kafka"}
+	})
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/healthz",
+			JSONOutput: gin.H{
+				"status": "ok",
+				"details": gin.H{
+					"core": gin.H{"status": "ok", "reason": "worker 0 ok"},
+				},
+			},
+		}, {
+			URL:        "/readyz",
+			StatusCode: 503,
+			JSONOutput: gin.H{
+				"status": "error",
+				"details": gin.H{
+					"kafka": gin.H{"status": "error", "reason": "cannot reach Kafka"},
+				},
+			},
+		},
+	})
+}
+
+func TestVersionEndpoints(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := http.NewMock(t, r)
+	addCommonHTTPHandlers(r, "inlet", h)
+	versionMetrics(r)
+
+	expected := gin.H{
+		"version":    "dev",
+		"build-date": "unknown",
+		"compiler":   runtime.Version(),
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{URL: "/api/v0/version", JSONOutput: expected},
+		{URL: "/api/v0/inlet/version", JSONOutput: expected},
+	})
+
+	gotMetrics := r.GetMetrics("akvorado_cmd_")
+	expectedMetrics := map[string]string{
+		`info{build_date="unknown",compiler="` + runtime.Version() + `",version="dev"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -5,44 +5,134 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/spf13/cobra"
 
+	"akvorado/common/clickhousedb"
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/http"
 	"akvorado/common/reporter"
+	"akvorado/inlet/aggregate"
+	"akvorado/inlet/bandwidth"
 	"akvorado/inlet/bmp"
+	"akvorado/inlet/clickhouse"
 	"akvorado/inlet/core"
+	"akvorado/inlet/detection"
+	"akvorado/inlet/fanout"
+	"akvorado/inlet/file"
 	"akvorado/inlet/flow"
 	"akvorado/inlet/geoip"
+	"akvorado/inlet/grpc"
+	"akvorado/inlet/ipfix"
 	"akvorado/inlet/kafka"
+	"akvorado/inlet/nats"
+	"akvorado/inlet/s3"
+	"akvorado/inlet/sink"
 	"akvorado/inlet/snmp"
+	"akvorado/inlet/webhook"
 )
 
 // InletConfiguration represents the configuration file for the inlet command.
 type InletConfiguration struct {
-	Reporting reporter.Configuration
-	HTTP      http.Configuration
-	Flow      flow.Configuration
-	SNMP      snmp.Configuration
-	BMP       bmp.Configuration
-	GeoIP     geoip.Configuration
-	Kafka     kafka.Configuration
-	Core      core.Configuration
+	Reporting  reporter.Configuration
+	HTTP       http.Configuration
+	Flow       flow.Configuration
+	SNMP       snmp.Configuration
+	BMP        bmp.Configuration
+	GeoIP      geoip.Configuration
+	Kafka      kafka.Configuration
+	Sink       sink.Configuration
+	File       file.Configuration
+	Webhook    webhook.Configuration
+	NATS       nats.Configuration
+	S3         s3.Configuration
+	IPFIX      ipfix.Configuration
+	ClickHouse clickhouse.Configuration
+	Core       core.Configuration
+	GRPC       grpc.Configuration
+	Aggregate  aggregate.Configuration
+	Detection  detection.Configuration
+	Bandwidth  bandwidth.Configuration
+	// Output selects where flows are sent.
+	Output string `validate:"oneof=kafka sink file webhook nats s3 ipfix clickhouse"`
+	// Outputs selects several outputs to send flows to. When not
+	// empty, Output is ignored.
+	Outputs fanout.Configuration `validate:"dive"`
+	// ExporterGroups maps exporter subnets to groups with their own
+	// enrichment settings.
+	ExporterGroups *helpers.SubnetMap[InletExporterGroup] `validate:"omitempty,dive"`
+}
+
+// InletExporterGroup defines the settings specific to a group of
+// exporters. Empty settings are inherited from the global ones.
+type InletExporterGroup struct {
+	core.ExporterGroup `mapstructure:",squash" yaml:",inline"`
+	// SNMPCommunity is the SNMPv2 community to use with the exporters
+	SNMPCommunity string
+	// SNMPSecurityParameters are the SNMPv3 security parameters to
+	// use with the exporters
+	SNMPSecurityParameters *snmp.SecurityParameters
+	// Topic is the Kafka topic to send the flows of the exporters to
+	Topic string
 }
 
 // Reset resets the configuration for the inlet command to its default value.
 func (c *InletConfiguration) Reset() {
 	*c = InletConfiguration{
-		HTTP:      http.DefaultConfiguration(),
-		Reporting: reporter.DefaultConfiguration(),
-		Flow:      flow.DefaultConfiguration(),
-		SNMP:      snmp.DefaultConfiguration(),
-		BMP:       bmp.DefaultConfiguration(),
-		GeoIP:     geoip.DefaultConfiguration(),
-		Kafka:     kafka.DefaultConfiguration(),
-		Core:      core.DefaultConfiguration(),
+		HTTP:           http.DefaultConfiguration(),
+		Reporting:      reporter.DefaultConfiguration(),
+		Flow:           flow.DefaultConfiguration(),
+		SNMP:           snmp.DefaultConfiguration(),
+		BMP:            bmp.DefaultConfiguration(),
+		GeoIP:          geoip.DefaultConfiguration(),
+		Kafka:          kafka.DefaultConfiguration(),
+		Sink:           sink.DefaultConfiguration(),
+		File:           file.DefaultConfiguration(),
+		Webhook:        webhook.DefaultConfiguration(),
+		NATS:           nats.DefaultConfiguration(),
+		S3:             s3.DefaultConfiguration(),
+		IPFIX:          ipfix.DefaultConfiguration(),
+		ClickHouse:     clickhouse.DefaultConfiguration(),
+		Core:           core.DefaultConfiguration(),
+		GRPC:           grpc.DefaultConfiguration(),
+		Aggregate:      aggregate.DefaultConfiguration(),
+		Detection:      detection.DefaultConfiguration(),
+		Bandwidth:      bandwidth.DefaultConfiguration(),
+		Output:         "kafka",
+		ExporterGroups: helpers.MustNewSubnetMap(map[string]InletExporterGroup{}),
+	}
+}
+
+// propagate applies the exporter groups to the configuration of the
+// SNMP, core and Kafka components.
+func (c *InletConfiguration) propagate() {
+	groups := c.ExporterGroups.ToIPv6Map()
+	if len(groups) == 0 {
+		return
 	}
+	coreGroups := map[string]core.ExporterGroup{}
+	communities := c.SNMP.Communities.ToIPv6Map()
+	securityParameters := c.SNMP.SecurityParameters.ToIPv6Map()
+	topics := c.Kafka.ExporterTopics.ToIPv6Map()
+	for prefix, group := range groups {
+		coreGroups[prefix] = group.ExporterGroup
+		if group.SNMPCommunity != "" {
+			communities[prefix] = group.SNMPCommunity
+		}
+		if group.SNMPSecurityParameters != nil {
+			securityParameters[prefix] = *group.SNMPSecurityParameters
+		}
+		if group.Topic != "" {
+			topics[prefix] = group.Topic
+		}
+	}
+	// The prefixes come from valid subnet maps.
+	c.Core.ExporterGroups, _ = helpers.NewSubnetMap(coreGroups)
+	c.SNMP.Communities, _ = helpers.NewSubnetMap(communities)
+	c.SNMP.SecurityParameters, _ = helpers.NewSubnetMap(securityParameters)
+	c.Kafka.ExporterTopics, _ = helpers.NewSubnetMap(topics)
 }
 
 type inletOptions struct {
@@ -63,11 +153,12 @@ hydration and export to Kafka.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		config := InletConfiguration{}
 		InletOptions.Path = args[0]
+		InletOptions.BeforeDump = config.propagate
 		if err := InletOptions.Parse(cmd.OutOrStdout(), "inlet", &config); err != nil {
 			return err
 		}
 
-		r, err := reporter.New(config.Reporting)
+		r, err := newReporter("inlet", config.Reporting)
 		if err != nil {
 			return fmt.Errorf("unable to initialize reporter: %w", err)
 		}
@@ -76,6 +167,8 @@ hydration and export to Kafka.`,
 }
 
 func init() {
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[InletExporterGroup]())
+	helpers.RegisterSubnetMapValidation[InletExporterGroup]()
 	RootCmd.AddCommand(inletCmd)
 	inletCmd.Flags().BoolVarP(&InletOptions.ConfigRelatedOptions.Dump, "dump", "D", false,
 		"Dump configuration before starting")
@@ -120,11 +213,33 @@ func inletStart(r *reporter.Reporter, config InletConfiguration, checkOnly bool)
 	if err != nil {
 		return fmt.Errorf("unable to initialize GeoIP component: %w", err)
 	}
-	kafkaComponent, err := kafka.New(r, config.Kafka, kafka.Dependencies{
-		Daemon: daemonComponent,
-	})
-	if err != nil {
-		return fmt.Errorf("unable to initialize Kafka component: %w", err)
+	var outputComponent core.Output
+	var outputComponents []interface{}
+	var fanoutComponent *fanout.Component
+	if len(config.Outputs) == 0 {
+		outputComponent, outputComponents, err = newInletOutput(r, daemonComponent, flowComponent, config, config.Output)
+		if err != nil {
+			return err
+		}
+	} else {
+		outputs := []core.Output{}
+		for _, outputConfiguration := range config.Outputs {
+			output, components, err := newInletOutput(r, daemonComponent, flowComponent, config, outputConfiguration.Type)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, output)
+			outputComponents = append(outputComponents, components...)
+		}
+		fanoutComponent, err = fanout.New(r, config.Outputs, fanout.Dependencies{
+			Daemon:  daemonComponent,
+			Outputs: outputs,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to initialize fan-out component: %w", err)
+		}
+		outputComponent = fanoutComponent
+		outputComponents = append(outputComponents, outputComponent)
 	}
 	coreComponent, err := core.New(r, config.Core, core.Dependencies{
 		Daemon: daemonComponent,
@@ -132,19 +247,52 @@ func inletStart(r *reporter.Reporter, config InletConfiguration, checkOnly bool)
 		SNMP:   snmpComponent,
 		BMP:    bmpComponent,
 		GeoIP:  geoipComponent,
-		Kafka:  kafkaComponent,
+		Output: outputComponent,
 		HTTP:   httpComponent,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to initialize core component: %w", err)
 	}
+	grpcComponent, err := grpc.New(r, config.GRPC, grpc.Dependencies{
+		Daemon: daemonComponent,
+		HTTP:   httpComponent,
+		Flows:  coreComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize gRPC component: %w", err)
+	}
+	aggregateComponent, err := aggregate.New(r, config.Aggregate, aggregate.Dependencies{
+		Daemon: daemonComponent,
+		Flows:  coreComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize aggregate component: %w", err)
+	}
+	detectionComponent, err := detection.New(r, config.Detection, detection.Dependencies{
+		Daemon: daemonComponent,
+		Flows:  coreComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize detection component: %w", err)
+	}
+	bandwidthComponent, err := bandwidth.New(r, config.Bandwidth, bandwidth.Dependencies{
+		Daemon: daemonComponent,
+		Flows:  coreComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize bandwidth component: %w", err)
+	}
 
 	// Expose some informations and metrics
 	addCommonHTTPHandlers(r, "inlet", httpComponent)
+	addInletAdminHTTPHandlers(httpComponent, flowComponent, snmpComponent)
 	versionMetrics(r)
 
 	// If we only asked for a check, stop here.
 	if checkOnly {
+		if err := geoipComponent.Check(); err != nil {
+			return fmt.Errorf("invalid GeoIP configuration: %w", err)
+		}
 		return nil
 	}
 
@@ -154,9 +302,169 @@ func inletStart(r *reporter.Reporter, config InletConfiguration, checkOnly bool)
 		snmpComponent,
 		bmpComponent,
 		geoipComponent,
-		kafkaComponent,
+	}
+	components = append(components, outputComponents...)
+	components = append(components,
 		coreComponent,
+		grpcComponent,
+		aggregateComponent,
+		detectionComponent,
+		bandwidthComponent,
 		flowComponent,
-	}
+		&inletReloader{
+			r:      r,
+			config: config,
+			snmp:   snmpComponent,
+			geoip:  geoipComponent,
+			core:   coreComponent,
+			fanout: fanoutComponent,
+		},
+	)
 	return StartStopComponents(r, daemonComponent, components)
 }
+
+// newInletOutput creates the output with the provided name. It also
+// returns the components to start, including the output.
+func newInletOutput(r *reporter.Reporter, daemonComponent daemon.Component, flowComponent *flow.Component, config InletConfiguration, name string) (core.Output, []interface{}, error) {
+	var output core.Output
+	var components []interface{}
+	var err error
+	switch name {
+	case "kafka":
+		output, err = kafka.New(r, config.Kafka, kafka.Dependencies{
+			Daemon: daemonComponent,
+			Flow:   flowComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize Kafka component: %w", err)
+		}
+	case "sink":
+		output, err = sink.New(r, config.Sink, sink.Dependencies{
+			Daemon: daemonComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize sink component: %w", err)
+		}
+	case "file":
+		output, err = file.New(r, config.File, file.Dependencies{
+			Daemon: daemonComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize file component: %w", err)
+		}
+	case "webhook":
+		output, err = webhook.New(r, config.Webhook, webhook.Dependencies{
+			Daemon: daemonComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize webhook component: %w", err)
+		}
+	case "nats":
+		output, err = nats.New(r, config.NATS, nats.Dependencies{
+			Daemon: daemonComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize NATS component: %w", err)
+		}
+	case "s3":
+		output, err = s3.New(r, config.S3, s3.Dependencies{
+			Daemon: daemonComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize S3 component: %w", err)
+		}
+	case "ipfix":
+		output, err = ipfix.New(r, config.IPFIX, ipfix.Dependencies{
+			Daemon: daemonComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize IPFIX component: %w", err)
+		}
+	case "clickhouse":
+		clickhouseDBComponent, err := clickhousedb.New(r, config.ClickHouse.Configuration, clickhousedb.Dependencies{
+			Daemon: daemonComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize ClickHouse component: %w", err)
+		}
+		components = append(components, clickhouseDBComponent)
+		output, err = clickhouse.New(r, config.ClickHouse, clickhouse.Dependencies{
+			Daemon:     daemonComponent,
+			ClickHouse: clickhouseDBComponent,
+			Flow:       flowComponent,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to initialize ClickHouse output component: %w", err)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown output %q", name)
+	}
+	return output, append(components, output), nil
+}
+
+// inletReloader reloads the configuration of the inlet service. Only
+// some settings are applied while running. The other ones are
+// reported as requiring a restart.
+type inletReloader struct {
+	r      *reporter.Reporter
+	config InletConfiguration
+	snmp   *snmp.Component
+	geoip  *geoip.Component
+	core   *core.Component
+	fanout *fanout.Component
+}
+
+// Reload parses the configuration again and applies the changes.
+func (ir *inletReloader) Reload() error {
+	options := InletOptions
+	options.Dump = false
+	config := InletConfiguration{}
+	options.BeforeDump = config.propagate
+	if err := options.Parse(io.Discard, "inlet", &config); err != nil {
+		return err
+	}
+	restart, err := ir.apply(config)
+	if len(restart) > 0 {
+		ir.r.Warn().Strs("settings", restart).Msg("some settings require a restart to be applied")
+	}
+	if err != nil {
+		return err
+	}
+	ir.r.Info().Msg("configuration reloaded")
+	return nil
+}
+
+// apply applies the provided configuration to the components. It
+// returns the settings requiring a restart.
+func (ir *inletReloader) apply(config InletConfiguration) ([]string, error) {
+	type section struct {
+		name   string
+		reload func() ([]string, error)
+	}
+	sections := []section{
+		{"snmp", func() ([]string, error) { return ir.snmp.Reload(config.SNMP) }},
+		{"geoip", func() ([]string, error) { return ir.geoip.Reload(config.GeoIP) }},
+		{"core", func() ([]string, error) { return ir.core.Reload(config.Core) }},
+	}
+	ignored := []string{"SNMP", "GeoIP", "Core", "ExporterGroups"}
+	if ir.fanout != nil {
+		sections = append(sections,
+			section{"outputs", func() ([]string, error) { return ir.fanout.Reload(config.Outputs) }})
+		ignored = append(ignored, "Outputs")
+	}
+
+	restart := helpers.ChangedFields(ir.config, config, ignored...)
+	var err error
+	for _, section := range sections {
+		changed, sectionErr := section.reload()
+		if sectionErr != nil {
+			ir.r.Err(sectionErr).Str("section", section.name).Msg("unable to apply configuration")
+			err = fmt.Errorf("unable to apply %s configuration: %w", section.name, sectionErr)
+			continue
+		}
+		for _, name := range changed {
+			restart = append(restart, fmt.Sprintf("%s.%s", section.name, name))
+		}
+	}
+	return restart, err
+}
@@ -4,9 +4,18 @@
 package cmd
 
 import (
+	"net/netip"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+	"github.com/mitchellh/mapstructure"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/geoip"
+	"akvorado/inlet/snmp"
 )
 
 func TestInletStart(t *testing.T) {
@@ -17,3 +26,125 @@ func TestInletStart(t *testing.T) {
 		t.Fatalf("inletStart() error:\n%+v", err)
 	}
 }
+
+func TestInletReload(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := InletConfiguration{}
+	config.Reset()
+	daemonComponent := daemon.NewMock(t)
+	snmpComponent, err := snmp.New(r, config.SNMP, snmp.Dependencies{Daemon: daemonComponent})
+	if err != nil {
+		t.Fatalf("snmp.New() error:\n%+v", err)
+	}
+	geoipComponent, err := geoip.New(r, config.GeoIP, geoip.Dependencies{Daemon: daemonComponent})
+	if err != nil {
+		t.Fatalf("geoip.New() error:\n%+v", err)
+	}
+	coreComponent, err := core.New(r, config.Core, core.Dependencies{Daemon: daemonComponent})
+	if err != nil {
+		t.Fatalf("core.New() error:\n%+v", err)
+	}
+	ir := &inletReloader{
+		r:      r,
+		config: config,
+		snmp:   snmpComponent,
+		geoip:  geoipComponent,
+		core:   coreComponent,
+	}
+
+	newConfig := InletConfiguration{}
+	newConfig.Reset()
+	newConfig.HTTP.Listen = "127.0.0.1:8081"
+	newConfig.Output = "sink"
+	newConfig.SNMP.Workers = 2
+	newConfig.SNMP.Communities = helpers.MustNewSubnetMap(map[string]string{
+		"::/0": "private",
+	})
+	if err := newConfig.Core.DropFilter.UnmarshalText([]byte("DstPort = 443")); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	restart, err := ir.apply(newConfig)
+	if err != nil {
+		t.Fatalf("apply() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(restart, []string{"http", "output", "snmp.workers"}); diff != "" {
+		t.Errorf("apply() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestInletPropagate(t *testing.T) {
+	config := InletConfiguration{}
+	config.Reset()
+	decoder, err := mapstructure.NewDecoder(helpers.GetMapStructureDecoderConfig(&config))
+	if err != nil {
+		t.Fatalf("NewDecoder() error:\n%+v", err)
+	}
+	if err := decoder.Decode(gin.H{
+		"snmp": gin.H{
+			"communities": gin.H{
+				"::/0":            "private",
+				"198.51.100.0/24": "other",
+			},
+		},
+		"exporter-groups": gin.H{
+			"192.0.2.0/24": gin.H{
+				"name":                  "customer-a",
+				"interface-classifiers": []string{`ClassifyExternal()`},
+				"snmp-community":        "customer-a",
+				"topic":                 "flows-customer-a",
+			},
+			"203.0.113.0/24": gin.H{
+				"name": "customer-b",
+				"snmp-security-parameters": gin.H{
+					"user-name": "alfred",
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("Decode() error:\n%+v", err)
+	}
+	config.propagate()
+	if err := helpers.Validate.Struct(config); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+
+	exporterA := netip.MustParseAddr("::ffff:192.0.2.10")
+	exporterB := netip.MustParseAddr("::ffff:203.0.113.10")
+	exporterC := netip.MustParseAddr("::ffff:198.51.100.10")
+	if group, _ := config.Core.ExporterGroups.Lookup(exporterA); group.Name != "customer-a" ||
+		len(group.InterfaceClassifiers) != 1 {
+		t.Errorf("Core.ExporterGroups.Lookup(%s) == %+v", exporterA, group)
+	}
+	if group, _ := config.Core.ExporterGroups.Lookup(exporterB); group.Name != "customer-b" {
+		t.Errorf("Core.ExporterGroups.Lookup(%s) == %+v", exporterB, group)
+	}
+	if _, ok := config.Core.ExporterGroups.Lookup(exporterC); ok {
+		t.Errorf("Core.ExporterGroups.Lookup(%s) found a group", exporterC)
+	}
+	communities := map[netip.Addr]string{
+		exporterA: "customer-a",
+		exporterB: "private",
+		exporterC: "other",
+	}
+	for exporter, expected := range communities {
+		if got, _ := config.SNMP.Communities.Lookup(exporter); got != expected {
+			t.Errorf("SNMP.Communities.Lookup(%s) == %q, expected %q", exporter, got, expected)
+		}
+	}
+	if got, _ := config.SNMP.SecurityParameters.Lookup(exporterB); got.UserName != "alfred" {
+		t.Errorf("SNMP.SecurityParameters.Lookup(%s) == %+v", exporterB, got)
+	}
+	if got, _ := config.Kafka.ExporterTopics.Lookup(exporterA); got != "flows-customer-a" {
+		t.Errorf("Kafka.ExporterTopics.Lookup(%s) == %q", exporterA, got)
+	}
+	if _, ok := config.Kafka.ExporterTopics.Lookup(exporterB); ok {
+		t.Errorf("Kafka.ExporterTopics.Lookup(%s) found a topic", exporterB)
+	}
+
+	// Propagating again does not change anything
+	before := config.SNMP.Communities.ToMap()
+	config.propagate()
+	if diff := helpers.Diff(config.SNMP.Communities.ToMap(), before); diff != "" {
+		t.Errorf("propagate() (-got, +want):\n%s", diff)
+	}
+}
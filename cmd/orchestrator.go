@@ -10,6 +10,7 @@ import (
 
 	"akvorado/common/clickhousedb"
 	"akvorado/common/daemon"
+	"akvorado/common/election"
 	"akvorado/common/http"
 	"akvorado/common/reporter"
 	"akvorado/orchestrator"
@@ -24,6 +25,7 @@ type OrchestratorConfiguration struct {
 	ClickHouseDB clickhousedb.Configuration `yaml:"-"`
 	ClickHouse   clickhouse.Configuration
 	Kafka        kafka.Configuration
+	Election     election.Configuration
 	Orchestrator orchestrator.Configuration `mapstructure:",squash" yaml:",inline"`
 	// Other service configurations
 	Inlet        []InletConfiguration        `validate:"dive"`
@@ -43,6 +45,7 @@ func (c *OrchestratorConfiguration) Reset() {
 		ClickHouseDB: clickhousedb.DefaultConfiguration(),
 		ClickHouse:   clickhouse.DefaultConfiguration(),
 		Kafka:        kafka.DefaultConfiguration(),
+		Election:     election.DefaultConfiguration(),
 		Orchestrator: orchestrator.DefaultConfiguration(),
 		// Other service configurations
 		Inlet:        []InletConfiguration{inletConfiguration},
@@ -51,6 +54,25 @@ func (c *OrchestratorConfiguration) Reset() {
 	}
 }
 
+// propagate overrides some parts of the configuration of the
+// orchestrator and of the other services from the common sections.
+func (c *OrchestratorConfiguration) propagate() {
+	c.ClickHouseDB = c.ClickHouse.Configuration
+	c.ClickHouse.Kafka.Configuration = c.Kafka.Configuration
+	c.Election.Brokers = c.Kafka.Brokers
+	c.Election.Version = c.Kafka.Version
+	c.Election.ReplicationFactor = c.Kafka.TopicConfiguration.ReplicationFactor
+	for idx := range c.Inlet {
+		c.Inlet[idx].Kafka.Configuration = c.Kafka.Configuration
+		c.Inlet[idx].ClickHouse.Configuration = c.ClickHouse.Configuration
+		c.Inlet[idx].Flow.CustomFields = c.ClickHouse.CustomFields
+		c.Inlet[idx].propagate()
+	}
+	for idx := range c.Console {
+		c.Console[idx].ClickHouse = c.ClickHouse.Configuration
+	}
+}
+
 type orchestratorOptions struct {
 	ConfigRelatedOptions
 	CheckMode bool
@@ -69,22 +91,12 @@ components and centralizes configuration of the various other components.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		config := OrchestratorConfiguration{}
 		OrchestratorOptions.Path = args[0]
-		OrchestratorOptions.BeforeDump = func() {
-			// Override some parts of the configuration
-			config.ClickHouseDB = config.ClickHouse.Configuration
-			config.ClickHouse.Kafka.Configuration = config.Kafka.Configuration
-			for idx := range config.Inlet {
-				config.Inlet[idx].Kafka.Configuration = config.Kafka.Configuration
-			}
-			for idx := range config.Console {
-				config.Console[idx].ClickHouse = config.ClickHouse.Configuration
-			}
-		}
+		OrchestratorOptions.BeforeDump = config.propagate
 		if err := OrchestratorOptions.Parse(cmd.OutOrStdout(), "orchestrator", &config); err != nil {
 			return err
 		}
 
-		r, err := reporter.New(config.Reporting)
+		r, err := newReporter("orchestrator", config.Reporting)
 		if err != nil {
 			return fmt.Errorf("unable to initialize reporter: %w", err)
 		}
@@ -121,10 +133,17 @@ func orchestratorStart(r *reporter.Reporter, config OrchestratorConfiguration, c
 	if err != nil {
 		return fmt.Errorf("unable to initialize ClickHouse component: %w", err)
 	}
+	electionComponent, err := election.New(r, config.Election, election.Dependencies{
+		Daemon: daemonComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize election component: %w", err)
+	}
 	clickhouseComponent, err := clickhouse.New(r, config.ClickHouse, clickhouse.Dependencies{
 		Daemon:     daemonComponent,
 		HTTP:       httpComponent,
 		ClickHouse: clickhouseDBComponent,
+		Election:   electionComponent,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to initialize clickhouse component: %w", err)
@@ -157,6 +176,7 @@ func orchestratorStart(r *reporter.Reporter, config OrchestratorConfiguration, c
 	// Start all the components.
 	components := []interface{}{
 		httpComponent,
+		electionComponent,
 		clickhouseDBComponent,
 		clickhouseComponent,
 		kafkaComponent,
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"akvorado/inlet/flow"
+	kafkainput "akvorado/inlet/flow/input/kafka"
+	"akvorado/inlet/flow/input/replay"
+	"akvorado/inlet/kafka"
+)
+
+type replayOptions struct {
+	ConfigRelatedOptions
+	CheckMode bool
+	Speed     float64
+	Topic     string
+}
+
+// ReplayOptions stores the command-line option values for the replay
+// command.
+var ReplayOptions replayOptions
+
+var replayCmd = &cobra.Command{
+	Use:   "replay CONFIG [PATH...]",
+	Short: "Replay archived flows through Akvorado's inlet pipeline",
+	Long: `Replay flows previously written by the file output, or flows from a Kafka
+topic, through the enrichment pipeline of the inlet service. The inlet
+configuration is used, except for the flow inputs. This is useful to test new
+classification rules against historical traffic. The inlet stops once all
+files are replayed.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := InletConfiguration{}
+		ReplayOptions.Path = args[0]
+		var inputsErr error
+		ReplayOptions.BeforeDump = func() {
+			config.propagate()
+			config.Flow.Inputs, inputsErr = ReplayOptions.inputs(args[1:], config.Kafka)
+		}
+		if err := ReplayOptions.Parse(cmd.OutOrStdout(), "inlet", &config); err != nil {
+			return err
+		}
+		if inputsErr != nil {
+			return inputsErr
+		}
+
+		r, err := newReporter("inlet", config.Reporting)
+		if err != nil {
+			return fmt.Errorf("unable to initialize reporter: %w", err)
+		}
+		return inletStart(r, config, ReplayOptions.CheckMode)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().BoolVarP(&ReplayOptions.ConfigRelatedOptions.Dump, "dump", "D", false,
+		"Dump configuration before starting")
+	replayCmd.Flags().BoolVarP(&ReplayOptions.CheckMode, "check", "C", false,
+		"Check configuration, but does not start")
+	replayCmd.Flags().Float64Var(&ReplayOptions.Speed, "speed", 1,
+		"Replay speed relative to the original pace (0 for as fast as possible)")
+	replayCmd.Flags().StringVar(&ReplayOptions.Topic, "topic", "",
+		"Replay flows from the provided Kafka topic instead of files")
+}
+
+// inputs returns the flow inputs replacing the ones from the inlet
+// configuration: one replay input for the provided files or one Kafka
+// input for the topic, using the Kafka brokers of the inlet.
+func (o replayOptions) inputs(paths []string, kafkaConfig kafka.Configuration) ([]flow.InputConfiguration, error) {
+	if o.Speed < 0 {
+		return nil, errors.New("replay speed should be positive")
+	}
+	switch {
+	case o.Topic != "" && len(paths) > 0:
+		return nil, errors.New("cannot replay both files and a Kafka topic")
+	case o.Topic != "":
+		config := kafkainput.DefaultConfiguration().(*kafkainput.Configuration)
+		config.Brokers = kafkaConfig.Brokers
+		config.Version = kafkaConfig.Version
+		config.Topic = o.Topic
+		// Use a new consumer group to start from the oldest flows.
+		config.ConsumerGroup = fmt.Sprintf("akvorado-replay-%d", time.Now().Unix())
+		config.Speed = o.Speed
+		return []flow.InputConfiguration{{Decoder: "protobuf", Config: config}}, nil
+	case len(paths) > 0:
+		config := replay.DefaultConfiguration().(*replay.Configuration)
+		config.Paths = paths
+		config.Speed = o.Speed
+		return []flow.InputConfiguration{{Decoder: "protobuf", Config: config}}, nil
+	}
+	return nil, errors.New("no files or Kafka topic to replay")
+}
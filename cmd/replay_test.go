@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+	kafkainput "akvorado/inlet/flow/input/kafka"
+	"akvorado/inlet/flow/input/replay"
+	"akvorado/inlet/kafka"
+)
+
+func TestReplayInputs(t *testing.T) {
+	kafkaConfig := kafka.DefaultConfiguration()
+
+	// Files
+	options := replayOptions{Speed: 2}
+	got, err := options.inputs([]string{"flows-1.json.gz", "flows-2.pb"}, kafkaConfig)
+	if err != nil {
+		t.Fatalf("inputs() error:\n%+v", err)
+	}
+	expected := []flow.InputConfiguration{{
+		Decoder: "protobuf",
+		Config: &replay.Configuration{
+			Paths: []string{"flows-1.json.gz", "flows-2.pb"},
+			Speed: 2,
+		},
+	}}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("inputs() (-got, +want):\n%s", diff)
+	}
+
+	// Kafka topic
+	options = replayOptions{Speed: 0, Topic: "flows-archive"}
+	got, err = options.inputs(nil, kafkaConfig)
+	if err != nil {
+		t.Fatalf("inputs() error:\n%+v", err)
+	}
+	config := got[0].Config.(*kafkainput.Configuration)
+	if !strings.HasPrefix(config.ConsumerGroup, "akvorado-replay-") {
+		t.Errorf("inputs() consumer group == %q", config.ConsumerGroup)
+	}
+	config.ConsumerGroup = ""
+	expected = []flow.InputConfiguration{{
+		Decoder: "protobuf",
+		Config: &kafkainput.Configuration{
+			Brokers: kafkaConfig.Brokers,
+			Version: kafkaConfig.Version,
+			Topic:   "flows-archive",
+		},
+	}}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("inputs() (-got, +want):\n%s", diff)
+	}
+
+	// Errors
+	for _, options := range []replayOptions{
+		{Speed: 1},
+		{Speed: -1},
+	} {
+		if _, err := options.inputs(nil, kafkaConfig); err == nil {
+			t.Errorf("inputs(%+v) did not error", options)
+		}
+	}
+	options = replayOptions{Speed: 1, Topic: "flows-archive"}
+	if _, err := options.inputs([]string{"flows.json"}, kafkaConfig); err == nil {
+		t.Error("inputs() with files and topic did not error")
+	}
+}
+
+func TestReplayStart(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := InletConfiguration{}
+	config.Reset()
+	inputs, err := replayOptions{Speed: 1}.inputs([]string{"flows.json"}, config.Kafka)
+	if err != nil {
+		t.Fatalf("inputs() error:\n%+v", err)
+	}
+	config.Flow.Inputs = inputs
+	if err := inletStart(r, config, true); err != nil {
+		t.Fatalf("inletStart() error:\n%+v", err)
+	}
+}
@@ -5,12 +5,15 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+
+	"akvorado/common/reporter"
 )
 
 var debug bool
@@ -25,9 +28,11 @@ var RootCmd = &cobra.Command{
 		} else {
 			log.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
 		}
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		// Filtering is done by each logger, depending on its configuration.
+		zerolog.SetGlobalLevel(zerolog.TraceLevel)
+		log.Logger = log.Logger.Level(zerolog.InfoLevel)
 		if debug {
-			zerolog.SetGlobalLevel(zerolog.DebugLevel)
+			log.Logger = log.Logger.Level(zerolog.DebugLevel)
 		}
 	},
 	SilenceErrors: true,
@@ -38,3 +43,17 @@ func init() {
 	RootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false,
 		"Enable debug logs")
 }
+
+// newReporter creates a new reporter for the provided service. When
+// debug logs are requested on the command line, the default log level
+// is lowered to debug. Metrics are pushed using the name of the
+// service as a job, unless configured otherwise.
+func newReporter(service string, config reporter.Configuration) (*reporter.Reporter, error) {
+	if config.Metrics.Push.Job == "" {
+		config.Metrics.Push.Job = fmt.Sprintf("akvorado-%s", service)
+	}
+	if debug && config.Logging.Level > zerolog.DebugLevel {
+		config.Logging.Level = zerolog.DebugLevel
+	}
+	return reporter.New(config)
+}
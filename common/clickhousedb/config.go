@@ -15,7 +15,8 @@ type Configuration struct {
 	Database string `validate:"required"`
 	// Username defines the username to use for authentication
 	Username string `validate:"required"`
-	// Password defines the password to use for authentication
+	// Password defines the password to use for authentication. It
+	// can be a reference to a secret (see helpers.ResolveSecret).
 	Password string
 	// MaxOpenConns tells how many parallel connections to ClickHouse we want
 	MaxOpenConns int `validate:"min=1"`
@@ -6,12 +6,14 @@ package clickhousedb
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/reporter"
 )
 
@@ -33,12 +35,16 @@ type Dependencies struct {
 
 // New creates a new ClickHouse wrapper
 func New(r *reporter.Reporter, config Configuration, dependencies Dependencies) (*Component, error) {
+	password, err := helpers.ResolveSecret(config.Password)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve ClickHouse password: %w", err)
+	}
 	conn, err := clickhouse.Open(&clickhouse.Options{
 		Addr: config.Servers,
 		Auth: clickhouse.Auth{
 			Database: config.Database,
 			Username: config.Username,
-			Password: config.Password,
+			Password: password,
 		},
 		Compression:     &clickhouse.Compression{Method: clickhouse.CompressionLZ4},
 		DialTimeout:     config.DialTimeout,
@@ -11,6 +11,7 @@ import (
 type lifecycleComponent struct {
 	terminateChannel chan struct{}
 	terminateOnce    sync.Once
+	reloadChannel    chan struct{}
 }
 
 // Terminated will return a channel that will be closed when the daemon
@@ -23,3 +24,18 @@ func (c *lifecycleComponent) Terminated() <-chan struct{} {
 func (c *lifecycleComponent) Terminate() {
 	c.terminateOnce.Do(func() { close(c.terminateChannel) })
 }
+
+// ReloadRequested will return a channel receiving a value each time
+// the configuration should be reloaded.
+func (c *lifecycleComponent) ReloadRequested() <-chan struct{} {
+	return c.reloadChannel
+}
+
+// Reload should be called to request a reload of the configuration.
+// Requests are coalesced if the previous one was not handled yet.
+func (c *lifecycleComponent) Reload() {
+	select {
+	case c.reloadChannel <- struct{}{}:
+	default:
+	}
+}
@@ -2,8 +2,9 @@
 // SPDX-License-Identifier: AGPL-3.0-only
 
 // Package daemon will handle daemon-related operations: readiness,
-// watchdog, exit, reexec... Currently, only exit is implemented as
-// other operations do not mean much when running in Docker.
+// watchdog, exit, reexec... Currently, exit, reload, readiness and
+// watchdog are implemented. The last two are only useful when running
+// under systemd.
 package daemon
 
 import (
@@ -21,10 +22,13 @@ type Component interface {
 	Start() error
 	Stop() error
 	Track(t *tomb.Tomb, who string)
+	Ready()
 
 	// Lifecycle
 	Terminated() <-chan struct{}
 	Terminate()
+	ReloadRequested() <-chan struct{}
+	Reload()
 }
 
 // realComponent is a non-mock implementation of the Component
@@ -48,6 +52,7 @@ func New(r *reporter.Reporter) (Component, error) {
 		r: r,
 		lifecycleComponent: lifecycleComponent{
 			terminateChannel: make(chan struct{}),
+			reloadChannel:    make(chan struct{}, 1),
 		},
 	}, nil
 }
@@ -66,26 +71,33 @@ func (c *realComponent) Start() error {
 				c.r.Err(t.tomb.Err()).
 					Str("component", t.origin).
 					Msg("component error, quitting")
+				c.r.ReportCrash(t.origin, t.tomb.Err().Error(), nil)
 			}
 			c.Terminate()
 		}(t)
 	}
-	// On signal, terminate
+	// On signal, terminate or reload
 	go func() {
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals,
-			syscall.SIGINT, syscall.SIGTERM)
-		select {
-		case s := <-signals:
-			c.r.Debug().Stringer("signal", s).Msg("signal received")
-			switch s {
-			case syscall.SIGINT, syscall.SIGTERM:
-				c.r.Info().Msg("quitting")
-				c.Terminate()
-				signal.Stop(signals)
+			syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		defer signal.Stop(signals)
+		for {
+			select {
+			case s := <-signals:
+				c.r.Debug().Stringer("signal", s).Msg("signal received")
+				switch s {
+				case syscall.SIGINT, syscall.SIGTERM:
+					c.r.Info().Msg("quitting")
+					c.Terminate()
+					return
+				case syscall.SIGHUP:
+					c.r.Info().Msg("reloading configuration")
+					c.Reload()
+				}
+			case <-c.Terminated():
+				return
 			}
-		case <-c.Terminated():
-			// Do nothing.
 		}
 	}()
 	return nil
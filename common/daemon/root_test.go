@@ -114,3 +114,34 @@ func TestTombTracking(t *testing.T) {
 
 	c.Stop()
 }
+
+func TestReload(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, err := New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	select {
+	case <-c.ReloadRequested():
+		t.Fatalf("ReloadRequested() received a value while we didn't request a reload")
+	default:
+		// OK
+	}
+
+	c.Reload()
+	c.Reload() // Coalesced with the previous request
+	select {
+	case <-c.ReloadRequested():
+		// OK
+	default:
+		t.Fatalf("ReloadRequested() didn't receive a value while we requested a reload")
+	}
+	select {
+	case <-c.ReloadRequested():
+		t.Fatalf("ReloadRequested() received a second value")
+	default:
+		// OK
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"akvorado/common/reporter"
+)
+
+// sdNotify sends a notification to systemd. It does nothing when the
+// process was not started by systemd with a notification socket.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("cannot connect to systemd: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("cannot notify systemd: %w", err)
+	}
+	return nil
+}
+
+// sdWatchdogInterval returns the interval at which systemd expects to
+// be notified. It returns 0 when the watchdog is not enabled for this
+// process.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Ready notifies systemd the daemon is ready and starts answering the
+// watchdog, if enabled. It should be called once all the components
+// are started.
+func (c *realComponent) Ready() {
+	if err := sdNotify("READY=1"); err != nil {
+		c.r.Err(err).Msg("unable to notify readiness")
+		return
+	}
+	go func() {
+		<-c.Terminated()
+		if err := sdNotify("STOPPING=1"); err != nil {
+			c.r.Err(err).Msg("unable to notify termination")
+		}
+	}()
+
+	interval := sdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	c.r.Debug().Dur("interval", interval).Msg("answer systemd watchdog")
+	go func() {
+		errLogger := c.r.Sample(reporter.BurstSampler(time.Minute, 1))
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.Terminated():
+				return
+			case <-ticker.C:
+				// Only answer when components are healthy.
+				ctx, cancel := context.WithTimeout(context.Background(), interval/4)
+				results := c.r.RunHealthchecks(ctx)
+				cancel()
+				if results.Status == reporter.HealthcheckError {
+					errLogger.Warn().Msg("unhealthy, do not answer systemd watchdog")
+					continue
+				}
+				if err := sdNotify("WATCHDOG=1"); err != nil {
+					errLogger.Err(err).Msg("unable to answer systemd watchdog")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"akvorado/common/reporter"
+)
+
+func listenNotifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram() error:\n%+v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", socket)
+	return conn
+}
+
+func expectNotification(t *testing.T, conn *net.UnixConn, expected string) {
+	t.Helper()
+	buf := make([]byte, 100)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() error:\n%+v", err)
+	}
+	if got := string(buf[:n]); got != expected {
+		t.Fatalf("Read() got %q, expected %q", got, expected)
+	}
+}
+
+func TestReady(t *testing.T) {
+	conn := listenNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "")
+	r := reporter.NewMock(t)
+	c, err := New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	c.Ready()
+	expectNotification(t, conn, "READY=1")
+	c.Stop()
+	expectNotification(t, conn, "STOPPING=1")
+}
+
+func TestWatchdog(t *testing.T) {
+	conn := listenNotifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "40000")
+	t.Setenv("WATCHDOG_PID", "")
+	r := reporter.NewMock(t)
+	var unhealthy atomic.Bool
+	r.RegisterHealthcheck("test", func(context.Context) reporter.HealthcheckResult {
+		if unhealthy.Load() {
+			return reporter.HealthcheckResult{Status: reporter.HealthcheckError, Reason: "nope"}
+		}
+		return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "ok"}
+	})
+	c, err := New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer c.Stop()
+	c.Ready()
+	expectNotification(t, conn, "READY=1")
+	expectNotification(t, conn, "WATCHDOG=1")
+	expectNotification(t, conn, "WATCHDOG=1")
+
+	// When unhealthy, the watchdog is not answered.
+	unhealthy.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	conn.SetReadDeadline(time.Now().Add(30 * time.Millisecond))
+	buf := make([]byte, 100)
+	for {
+		// Drain notifications sent before the change.
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := conn.Read(buf); err == nil {
+		t.Fatalf("Read() got %q while unhealthy", string(buf[:n]))
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	cases := []struct {
+		usec     string
+		pid      string
+		expected time.Duration
+	}{
+		{"", "", 0},
+		{"hello", "", 0},
+		{"1000000", "", time.Second},
+		{"1000000", "1", 0},
+		{"1000000", "self", time.Second},
+	}
+	for _, tc := range cases {
+		pid := tc.pid
+		if pid == "self" {
+			pid = strconv.Itoa(os.Getpid())
+		}
+		t.Setenv("WATCHDOG_USEC", tc.usec)
+		t.Setenv("WATCHDOG_PID", pid)
+		if got := sdWatchdogInterval(); got != tc.expected {
+			t.Errorf("sdWatchdogInterval(%q, %q) == %s, expected %s", tc.usec, tc.pid, got, tc.expected)
+		}
+	}
+}
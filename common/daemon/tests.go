@@ -23,6 +23,7 @@ func NewMock(t *testing.T) Component {
 	return &MockComponent{
 		lifecycleComponent: lifecycleComponent{
 			terminateChannel: make(chan struct{}),
+			reloadChannel:    make(chan struct{}, 1),
 		},
 	}
 }
@@ -41,3 +42,7 @@ func (c *MockComponent) Stop() error {
 // Track does nothing
 func (c *MockComponent) Track(t *tomb.Tomb, who string) {
 }
+
+// Ready does nothing
+func (c *MockComponent) Ready() {
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package election
+
+import "akvorado/common/kafka"
+
+// Configuration describes the configuration for the leader election.
+type Configuration struct {
+	// Brokers is the list of Kafka brokers to connect to.
+	Brokers []string `yaml:"-"`
+	// Version is the version of Kafka we assume to work with.
+	Version kafka.Version `yaml:"-"`
+	// ReplicationFactor is the replication factor of the topic used
+	// for the election.
+	ReplicationFactor int16 `yaml:"-" validate:"min=1"`
+	// Enabled tells if leader election is enabled. When disabled,
+	// this instance is always the leader.
+	Enabled bool
+	// Name is the name of the election. It is used as the name of
+	// the Kafka consumer group and of the topic used to coordinate
+	// the instances.
+	Name string `validate:"required"`
+}
+
+// DefaultConfiguration represents the default configuration for the leader election.
+func DefaultConfiguration() Configuration {
+	kafkaConfiguration := kafka.DefaultConfiguration()
+	return Configuration{
+		Brokers:           kafkaConfiguration.Brokers,
+		Version:           kafkaConfiguration.Version,
+		ReplicationFactor: 1,
+		Enabled:           false,
+		Name:              "akvorado-election",
+	}
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package election elects a leader among several instances of a
+// service, so only one of them performs some shared duties.
+//
+// The election relies on a Kafka consumer group subscribed to a topic
+// with a single partition: the instance owning this partition is the
+// leader. When it disappears, Kafka assigns the partition to another
+// instance after the session timeout.
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/kafka"
+	"akvorado/common/reporter"
+)
+
+// Component represents the leader election component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	kafkaConfig *sarama.Config
+	metrics     struct {
+		leader reporter.Gauge
+	}
+
+	leader      atomic.Bool
+	leadingLock sync.Mutex
+	leading     chan struct{}
+	lost        chan struct{}
+}
+
+// Dependencies define the dependencies of the leader election component.
+type Dependencies struct {
+	Daemon daemon.Component
+}
+
+// New creates a new leader election component.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	kafkaConfig := sarama.NewConfig()
+	kafkaConfig.Version = sarama.KafkaVersion(configuration.Version)
+	kafkaConfig.Consumer.Offsets.Initial = sarama.OffsetNewest
+	kafkaConfig.Consumer.Return.Errors = true
+	if err := kafkaConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("cannot validate Kafka configuration: %w", err)
+	}
+
+	c := Component{
+		r:           r,
+		d:           &dependencies,
+		config:      configuration,
+		kafkaConfig: kafkaConfig,
+		leading:     make(chan struct{}),
+		lost:        make(chan struct{}),
+	}
+	close(c.lost)
+	c.metrics.leader = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "leader",
+			Help: "1 when this instance is the leader.",
+		},
+	)
+	c.d.Daemon.Track(&c.t, "common/election")
+	return &c, nil
+}
+
+// Start starts the leader election.
+func (c *Component) Start() error {
+	if !c.config.Enabled {
+		c.setLeader(true)
+		return nil
+	}
+	c.r.Info().Msg("starting leader election")
+	if err := c.createTopic(); err != nil {
+		return err
+	}
+	group, err := sarama.NewConsumerGroup(c.config.Brokers, c.config.Name, c.kafkaConfig)
+	if err != nil {
+		c.r.Err(err).
+			Str("brokers", strings.Join(c.config.Brokers, ",")).
+			Msg("unable to create consumer group")
+		return fmt.Errorf("unable to create consumer group: %w", err)
+	}
+	ctx := c.t.Context(context.Background())
+	c.t.Go(func() error {
+		defer group.Close()
+		errLogger := c.r.Sample(reporter.BurstSampler(time.Minute, 1))
+		handler := electionHandler{c}
+		for {
+			if err := group.Consume(ctx, []string{c.config.Name}, handler); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return nil
+				}
+				errLogger.Err(err).Msg("cannot take part to the election")
+			}
+			select {
+			case <-c.t.Dying():
+				return nil
+			case err := <-group.Errors():
+				if err != nil {
+					errLogger.Err(err).Msg("error while taking part to the election")
+				}
+			case <-time.After(time.Second):
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops the leader election.
+func (c *Component) Stop() error {
+	if !c.config.Enabled {
+		return nil
+	}
+	defer c.r.Info().Msg("leader election stopped")
+	c.r.Info().Msg("stopping leader election")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// createTopic creates the topic used for the election, if it does not
+// exist yet. It has a single partition.
+func (c *Component) createTopic() error {
+	kafka.GlobalKafkaLogger.Register(c.r)
+	defer kafka.GlobalKafkaLogger.Unregister()
+	admin, err := sarama.NewClusterAdmin(c.config.Brokers, c.kafkaConfig)
+	if err != nil {
+		c.r.Err(err).
+			Str("brokers", strings.Join(c.config.Brokers, ",")).
+			Msg("unable to get admin client for topic creation")
+		return fmt.Errorf("unable to get admin client for topic creation: %w", err)
+	}
+	defer admin.Close()
+	err = admin.CreateTopic(c.config.Name, &sarama.TopicDetail{
+		NumPartitions:     1,
+		ReplicationFactor: c.config.ReplicationFactor,
+	}, false)
+	if err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		c.r.Err(err).Str("topic", c.config.Name).Msg("unable to create topic")
+		return fmt.Errorf("unable to create topic %q: %w", c.config.Name, err)
+	}
+	return nil
+}
+
+// IsLeader tells if this instance is currently the leader.
+func (c *Component) IsLeader() bool {
+	return c.leader.Load()
+}
+
+// Leading returns a channel closed when this instance is the leader.
+// Once leadership is lost, a new channel has to be requested.
+func (c *Component) Leading() <-chan struct{} {
+	c.leadingLock.Lock()
+	defer c.leadingLock.Unlock()
+	return c.leading
+}
+
+// Lost returns a channel closed when this instance loses the
+// leadership. It is already closed when this instance is not the
+// leader.
+func (c *Component) Lost() <-chan struct{} {
+	c.leadingLock.Lock()
+	defer c.leadingLock.Unlock()
+	return c.lost
+}
+
+// setLeader updates the leadership status of this instance.
+func (c *Component) setLeader(leader bool) {
+	c.leadingLock.Lock()
+	defer c.leadingLock.Unlock()
+	if c.leader.Swap(leader) == leader {
+		return
+	}
+	if leader {
+		c.r.Info().Msg("this instance is now the leader")
+		c.metrics.leader.Set(1)
+		close(c.leading)
+		c.lost = make(chan struct{})
+	} else {
+		c.r.Info().Msg("this instance is not the leader anymore")
+		c.metrics.leader.Set(0)
+		c.leading = make(chan struct{})
+		close(c.lost)
+	}
+}
+
+// electionHandler handles the consumer group session for the election.
+type electionHandler struct {
+	c *Component
+}
+
+// Setup is called at the beginning of a new session. The instance
+// owning the partition of the topic is the leader.
+func (h electionHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.c.setLeader(len(session.Claims()[h.c.config.Name]) > 0)
+	return nil
+}
+
+// Cleanup is called at the end of a session.
+func (h electionHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	h.c.setLeader(false)
+	return nil
+}
+
+// ConsumeClaim waits for the end of the session. Messages are ignored.
+func (h electionHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case _, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package election
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/kafka"
+	"akvorado/common/reporter"
+)
+
+func TestDisabled(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r)
+	if !c.IsLeader() {
+		t.Fatal("IsLeader() == false, expected true")
+	}
+	select {
+	case <-c.Leading():
+	default:
+		t.Fatal("Leading() not closed")
+	}
+	select {
+	case <-c.Lost():
+		t.Fatal("Lost() closed while leader")
+	default:
+	}
+	gotMetrics := r.GetMetrics("akvorado_common_election_")
+	expectedMetrics := map[string]string{
+		`leader`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	claims map[string][]int32
+}
+
+func (fs fakeSession) Claims() map[string][]int32 { return fs.claims }
+
+func TestHandler(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Enabled = true
+	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	handler := electionHandler{c}
+
+	// Not owning the partition
+	handler.Setup(fakeSession{claims: map[string][]int32{}})
+	if c.IsLeader() {
+		t.Fatal("IsLeader() == true, expected false")
+	}
+	leading := c.Leading()
+	select {
+	case <-leading:
+		t.Fatal("Leading() closed while not leader")
+	default:
+	}
+	select {
+	case <-c.Lost():
+	default:
+		t.Fatal("Lost() not closed while not leader")
+	}
+
+	// Owning the partition
+	handler.Setup(fakeSession{claims: map[string][]int32{config.Name: {0}}})
+	if !c.IsLeader() {
+		t.Fatal("IsLeader() == false, expected true")
+	}
+	select {
+	case <-leading:
+	default:
+		t.Fatal("Leading() not closed while leader")
+	}
+	lost := c.Lost()
+	select {
+	case <-lost:
+		t.Fatal("Lost() closed while leader")
+	default:
+	}
+
+	// End of session
+	handler.Cleanup(fakeSession{})
+	if c.IsLeader() {
+		t.Fatal("IsLeader() == true, expected false")
+	}
+	select {
+	case <-c.Leading():
+		t.Fatal("Leading() closed after losing leadership")
+	default:
+	}
+	select {
+	case <-lost:
+	default:
+		t.Fatal("Lost() not closed after losing leadership")
+	}
+	gotMetrics := r.GetMetrics("akvorado_common_election_")
+	expectedMetrics := map[string]string{
+		`leader`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestRealKafkaElection(t *testing.T) {
+	client, brokers := kafka.SetupKafkaBroker(t)
+	client.Close()
+
+	config := DefaultConfiguration()
+	config.Enabled = true
+	config.Name = "election-test"
+	config.Brokers = brokers
+	components := []*Component{}
+	for i := 0; i < 2; i++ {
+		r := reporter.NewMock(t)
+		c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		if err := c.Start(); err != nil {
+			t.Fatalf("Start() error:\n%+v", err)
+		}
+		components = append(components, c)
+	}
+	defer func() {
+		for _, c := range components {
+			c.Stop()
+		}
+	}()
+
+	// Wait for a leader
+	var leader, follower *Component
+	select {
+	case <-components[0].Leading():
+		leader, follower = components[0], components[1]
+	case <-components[1].Leading():
+		leader, follower = components[1], components[0]
+	case <-time.After(30 * time.Second):
+		t.Fatal("no leader elected")
+	}
+	if follower.IsLeader() {
+		t.Fatal("both instances are leaders")
+	}
+
+	// Stop the leader, the other instance should take over.
+	leader.Stop()
+	components = []*Component{follower}
+	select {
+	case <-follower.Leading():
+	case <-time.After(30 * time.Second):
+		t.Fatal("no new leader elected")
+	}
+}
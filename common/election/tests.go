@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//go:build !release
+
+package election
+
+import (
+	"testing"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+// NewMock creates a new leader election component which is always the
+// leader. It is autostarted.
+func NewMock(t *testing.T, r *reporter.Reporter) *Component {
+	t.Helper()
+	c, err := New(r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+	return c
+}
+
+// SetLeader changes the leadership status of this instance.
+func (c *Component) SetLeader(leader bool) {
+	c.setLeader(leader)
+}
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package filter parses and transforms a user filter.
+package filter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Language is the output language of the parser.
+type Language int
+
+const (
+	// LanguageSQL outputs a ClickHouse SQL expression.
+	LanguageSQL Language = iota
+	// LanguageExpr outputs an expression for github.com/antonmedv/expr
+	// to be evaluated against a flow message. IP addresses are checked
+	// with an `IPIn(column, subnet)` function, large communities with a
+	// `HasLargeCommunity(column, asn, data1, data2)` function.
+	LanguageExpr
+)
+
+// Meta is used to inject/retrieve state from the parser.
+type Meta struct {
+	// ReverseDirection tells if we require the reverse direction for the provided filter (used as input)
+	ReverseDirection bool
+	// Language is the output language (used as input)
+	Language Language
+	// MainTableRequired tells if the main table is required to execute the expression (used as output)
+	MainTableRequired bool
+}
+
+// ReverseColumnDirection reverts the direction of a provided column name.
+func ReverseColumnDirection(name string) string {
+	if strings.HasPrefix(name, "Src") {
+		return "Dst" + name[3:]
+	}
+	if strings.HasPrefix(name, "Dst") {
+		return "Src" + name[3:]
+	}
+	if strings.HasPrefix(name, "In") {
+		return "Out" + name[2:]
+	}
+	if strings.HasPrefix(name, "Out") {
+		return "In" + name[3:]
+	}
+	return name
+}
+
+func (c *current) reverseColumnDirection(name string) string {
+	if c.globalStore["meta"].(*Meta).ReverseDirection {
+		return ReverseColumnDirection(name)
+	}
+	return name
+}
+
+func (c *current) language() Language {
+	return c.globalStore["meta"].(*Meta).Language
+}
+
+// notInFlows returns an error if the provided column cannot be used
+// when filtering flows.
+func (c *current) notInFlows(name string) error {
+	if c.language() == LanguageExpr {
+		return fmt.Errorf("%s cannot be used to filter flows", name)
+	}
+	return nil
+}
+
+// keyword translates a keyword (AND, OR, NOT) to the output language.
+func (c *current) keyword(kw string) string {
+	if c.language() == LanguageExpr {
+		return strings.ToLower(kw)
+	}
+	return strings.ToUpper(kw)
+}
+
+// quote quotes a string for the output language.
+func (c *current) quote(v interface{}) string {
+	if c.language() == LanguageExpr {
+		return strconv.Quote(toString(v))
+	}
+	return quote(v)
+}
+
+// condition builds a condition comparing a column to an already
+// quoted value. For IN operators, the value is a list of values
+// separated by commas. With expr, the condition is enclosed in
+// parentheses as NOT has a higher precedence than comparisons.
+func (c *current) condition(column, operator, value string) string {
+	if c.language() == LanguageSQL {
+		switch operator {
+		case "IN", "NOT IN":
+			return fmt.Sprintf("%s %s (%s)", column, operator, value)
+		default:
+			return fmt.Sprintf("%s %s %s", column, operator, value)
+		}
+	}
+	switch operator {
+	case "=":
+		return fmt.Sprintf("(%s == %s)", column, value)
+	case "LIKE", "ILIKE":
+		return fmt.Sprintf("(%s matches %s)", column, value)
+	case "NOT LIKE", "NOT ILIKE":
+		return fmt.Sprintf("(not (%s matches %s))", column, value)
+	case "IN":
+		return fmt.Sprintf("(%s in [%s])", column, value)
+	case "NOT IN":
+		return fmt.Sprintf("(%s not in [%s])", column, value)
+	default:
+		return fmt.Sprintf("(%s %s %s)", column, operator, value)
+	}
+}
+
+// ipCondition builds a condition checking if an IP column is in the
+// provided subnet (or equal to the provided IP) for expr.
+func (c *current) ipCondition(column string, negate bool, subnet string) string {
+	if !strings.Contains(subnet, "/") {
+		if strings.Contains(subnet, ":") {
+			subnet = fmt.Sprintf("%s/128", subnet)
+		} else {
+			subnet = fmt.Sprintf("%s/32", subnet)
+		}
+	}
+	cond := fmt.Sprintf("IPIn(%s, %s)", column, c.quote(subnet))
+	if negate {
+		return fmt.Sprintf("(not %s)", cond)
+	}
+	return fmt.Sprintf("(%s)", cond)
+}
+
+// has builds a condition checking if an array column contains the
+// provided value.
+func (c *current) has(column, value string) string {
+	if c.language() == LanguageSQL {
+		return fmt.Sprintf("has(%s, %s)", column, value)
+	}
+	if column == "DstLargeCommunities" {
+		return fmt.Sprintf("(HasLargeCommunity(%s, %s))", column, value)
+	}
+	return fmt.Sprintf("(%s in %s)", value, column)
+}
+
+// likeToRegexp turns a LIKE pattern into an anchored regular
+// expression. As in ClickHouse, a backslash escapes the next character.
+func likeToRegexp(pattern string, insensitive bool) string {
+	var b strings.Builder
+	if insensitive {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			b.WriteString("(?s:.*)")
+		case r == '_':
+			b.WriteString("(?s:.)")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func lastIP(subnet *net.IPNet) net.IP {
+	if subnet.IP.To4() != nil {
+		// IPv4 case
+		ip := make(net.IP, len(subnet.IP.To4()))
+		binary.BigEndian.PutUint32(ip,
+			binary.BigEndian.Uint32(subnet.IP.To4())|^binary.BigEndian.Uint32(net.IP(subnet.Mask).To4()))
+		return ip
+	}
+	// IPv6 case
+	ip := make(net.IP, len(subnet.IP))
+	copy(ip, subnet.IP)
+	for i := range subnet.Mask {
+		ip[i] = ip[i] | ^subnet.Mask[i]
+	}
+	return ip
+}
+
+func quote(v interface{}) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(toString(v)) + "'"
+}
+
+func toSlice(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.([]interface{})
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", s)
+	default:
+		panic("not a string")
+	}
+}
@@ -32,6 +32,7 @@ func TestValidFilter(t *testing.T) {
 		{Input: `ExporterName IUNLIKE "something%"`, Output: `ExporterName NOT ILIKE 'something%'`},
 		{Input: `ExporterName="something with spaces"`, Output: `ExporterName = 'something with spaces'`},
 		{Input: `ExporterName="something with 'quotes'"`, Output: `ExporterName = 'something with \'quotes\''`},
+		{Input: `ExporterCountry = "FR"`, Output: `ExporterCountry = 'FR'`},
 		{Input: `ExporterAddress=203.0.113.1`, Output: `ExporterAddress = toIPv6('203.0.113.1')`},
 		{Input: `ExporterAddress=2001:db8::1`, Output: `ExporterAddress = toIPv6('2001:db8::1')`},
 		{Input: `ExporterAddress=2001:db8:0::1`, Output: `ExporterAddress = toIPv6('2001:db8::1')`},
@@ -85,6 +86,10 @@ func TestValidFilter(t *testing.T) {
 		{Input: `SrcAS NOTIN(12322, 29447)`, Output: `SrcAS NOT IN (12322, 29447)`},
 		{Input: `SrcAS NOTIN (AS12322, 29447)`, Output: `SrcAS NOT IN (12322, 29447)`},
 		{Input: `DstAS=12322`, Output: `DstAS = 12322`},
+		{Input: `InIfPeerAS = AS174`, Output: `InIfPeerAS = 174`},
+		{Input: `InIfPeerAS = AS174`, Output: `OutIfPeerAS = 174`,
+			MetaIn: Meta{ReverseDirection: true}, MetaOut: Meta{ReverseDirection: true}},
+		{Input: `OutIfPeerAS IN (174, 1299)`, Output: `OutIfPeerAS IN (174, 1299)`},
 		{Input: `SrcCountry='FR'`, Output: `SrcCountry = 'FR'`},
 		{Input: `SrcCountry='FR'`, Output: `DstCountry = 'FR'`,
 			MetaIn: Meta{ReverseDirection: true}, MetaOut: Meta{ReverseDirection: true}},
@@ -123,6 +128,9 @@ func TestValidFilter(t *testing.T) {
 		{Input: `OutIfProvider = 'telia'`, Output: `OutIfProvider = 'telia'`},
 		{Input: `OutIfProvider = 'telia'`, Output: `InIfProvider = 'telia'`,
 			MetaIn: Meta{ReverseDirection: true}, MetaOut: Meta{ReverseDirection: true}},
+		{Input: `InIfBillingGroup = 'transit'`, Output: `InIfBillingGroup = 'transit'`},
+		{Input: `InIfBillingGroup = 'transit'`, Output: `OutIfBillingGroup = 'transit'`,
+			MetaIn: Meta{ReverseDirection: true}, MetaOut: Meta{ReverseDirection: true}},
 		{Input: `InIfBoundary = external`, Output: `InIfBoundary = 'external'`},
 		{Input: `InIfBoundary = external`, Output: `OutIfBoundary = 'external'`,
 			MetaIn: Meta{ReverseDirection: true}, MetaOut: Meta{ReverseDirection: true}},
@@ -202,6 +210,10 @@ output provider */ = 'telia'`,
 		{Input: `DstCommunities != 65000:100`, Output: `NOT has(DstCommunities, 4259840100)`, MetaOut: Meta{MainTableRequired: true}},
 		{Input: `DstCommunities = 65000:100:200`, Output: `has(DstLargeCommunities, bitShiftLeft(65000::UInt128, 64) + bitShiftLeft(100::UInt128, 32) + 200::UInt128)`, MetaOut: Meta{MainTableRequired: true}},
 		{Input: `DstCommunities != 65000:100:200`, Output: `NOT has(DstLargeCommunities, bitShiftLeft(65000::UInt128, 64) + bitShiftLeft(100::UInt128, 32) + 200::UInt128)`, MetaOut: Meta{MainTableRequired: true}},
+		{Input: `DstCommunityNames = "blackhole"`, Output: `has(DstCommunityNames, 'blackhole')`, MetaOut: Meta{MainTableRequired: true}},
+		{Input: `DstCommunityNames != "customer:acme"`, Output: `NOT has(DstCommunityNames, 'customer:acme')`, MetaOut: Meta{MainTableRequired: true}},
+		{Input: `ScanSuspect = true`, Output: `ScanSuspect = true`, MetaOut: Meta{MainTableRequired: true}},
+		{Input: `ScanSuspect != False`, Output: `ScanSuspect != false`, MetaOut: Meta{MainTableRequired: true}},
 	}
 	for _, tc := range cases {
 		got, err := Parse("", []byte(tc.Input), GlobalStore("meta", &tc.MetaIn))
@@ -255,3 +267,73 @@ func TestInvalidFilter(t *testing.T) {
 		}
 	}
 }
+
+func TestValidExprFilter(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		{Input: `ExporterName = 'something'`, Output: `(ExporterName == "something")`},
+		{Input: `ExporterName="something\"`, Output: `(ExporterName == "something\\")`},
+		{Input: `ExporterName != "something"`, Output: `(ExporterName != "something")`},
+		{Input: `ExporterName IN ("a", "b")`, Output: `(ExporterName in ["a", "b"])`},
+		{Input: `ExporterName NOTIN ("a", "b")`, Output: `(ExporterName not in ["a", "b"])`},
+		{Input: `ExporterName LIKE "edge_.%"`, Output: `(ExporterName matches "^edge(?s:.)\\.(?s:.*)$")`},
+		{Input: `ExporterName LIKE "100\%"`, Output: `(ExporterName matches "^100%$")`},
+		{Input: `ExporterName IUNLIKE "edge%"`, Output: `(not (ExporterName matches "(?i)^edge(?s:.*)$"))`},
+		{Input: `ExporterAddress = 203.0.113.1`, Output: `(IPIn(ExporterAddress, "203.0.113.1/32"))`},
+		{Input: `ExporterAddress != 2001:db8::1`, Output: `(not IPIn(ExporterAddress, "2001:db8::1/128"))`},
+		{Input: `SrcAddr << 192.168.0.1/24`, Output: `(IPIn(SrcAddr, "192.168.0.0/24"))`},
+		{Input: `DstAddr !<< 2001:db8::/64`, Output: `(not IPIn(DstAddr, "2001:db8::/64"))`},
+		{Input: `InIfBoundary = external`, Output: `(InIfBoundary.String() == "EXTERNAL")`},
+		{Input: `OutIfBoundary != INTERNAL`, Output: `(OutIfBoundary.String() != "INTERNAL")`},
+		{Input: `InIfSpeed >= 1000`, Output: `(InIfSpeed >= 1000)`},
+		{Input: `SrcPort = 443`, Output: `(SrcPort == 443)`},
+		{Input: `SrcAS = AS12322`, Output: `(SrcAS == 12322)`},
+		{Input: `SrcAS IN (AS12322, 29447)`, Output: `(SrcAS in [12322, 29447])`},
+		{Input: `EType = ipv6`, Output: `(Etype == 34525)`},
+		{Input: `Proto = 6`, Output: `(Proto == 6)`},
+		{Input: `PacketSize > 1500`, Output: `(Bytes/Packets > 1500)`},
+		{Input: `DstASPath != 65000`, Output: `not (65000 in DstASPath)`},
+		{Input: `DstCommunities = 65000:100`, Output: `(4259840100 in DstCommunities)`},
+		{Input: `DstCommunities = 65000:100:200`, Output: `(HasLargeCommunity(DstLargeCommunities, 65000, 100, 200))`},
+		{Input: `DstCommunityNames != "blackhole"`, Output: `not ("blackhole" in DstCommunityNames)`},
+		{Input: `ScanSuspect = true`, Output: `(ScanSuspect == true)`},
+		{Input: `OutIfPeerAS = AS174`, Output: `(OutIfPeerAS == 174)`},
+		{
+			Input:  `NOT DstPort > 1024 and SrcPort < 1024`,
+			Output: `not (DstPort > 1024) and (SrcPort < 1024)`,
+		}, {
+			Input:  `(SrcPort = 80 OR SrcPort = 443) AND NOT (DstAS = 12322)`,
+			Output: `((SrcPort == 80) or (SrcPort == 443)) and not ((DstAS == 12322))`,
+		},
+	}
+	for _, tc := range cases {
+		got, err := Parse("", []byte(tc.Input), GlobalStore("meta", &Meta{Language: LanguageExpr}))
+		if err != nil {
+			t.Errorf("Parse(%q) error:\n%+v", tc.Input, err)
+			continue
+		}
+		if diff := helpers.Diff(got.(string), tc.Output); diff != "" {
+			t.Errorf("Parse(%q) (-got, +want):\n%s", tc.Input, diff)
+		}
+	}
+}
+
+func TestInvalidExprFilter(t *testing.T) {
+	cases := []string{
+		`SrcNetName = "alpha"`,
+		`Dst1stAS = 12322`,
+		`Proto = "TCP"`,
+	}
+	for _, tc := range cases {
+		_, err := Parse("", []byte(tc), GlobalStore("meta", &Meta{Language: LanguageExpr}))
+		if err == nil {
+			t.Errorf("Parse(%q) didn't throw an error", tc)
+		}
+		_, err = Parse("", []byte(tc), GlobalStore("meta", &Meta{}))
+		if err != nil {
+			t.Errorf("Parse(%q) error:\n%+v", tc, err)
+		}
+	}
+}
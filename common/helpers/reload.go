@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ChangedFields returns the names of the fields which differ between
+// two configurations of the same type. Fields are compared using their
+// YAML representation and their names are lowercased, like when the
+// configuration is dumped. Fields listed in ignored (using the Go
+// names) are not compared.
+func ChangedFields(old, new interface{}, ignored ...string) []string {
+	oldValue := reflect.Indirect(reflect.ValueOf(old))
+	newValue := reflect.Indirect(reflect.ValueOf(new))
+	if oldValue.Kind() != reflect.Struct || oldValue.Type() != newValue.Type() {
+		panic("configurations should be structs of the same type")
+	}
+	changed := []string{}
+outer:
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		for _, name := range ignored {
+			if name == field.Name {
+				continue outer
+			}
+		}
+		if !sameYAML(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changed = append(changed, strings.ToLower(field.Name))
+		}
+	}
+	return changed
+}
+
+// sameYAML tells if two values have the same YAML representation. If
+// one of them cannot be serialized, they are considered different.
+func sameYAML(a, b interface{}) bool {
+	aa, err := yaml.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := yaml.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aa, bb)
+}
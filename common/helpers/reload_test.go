@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers_test
+
+import (
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+func TestChangedFields(t *testing.T) {
+	type configuration struct {
+		Name        string
+		Timeout     time.Duration
+		Communities *helpers.SubnetMap[string]
+		Workers     int
+	}
+	old := configuration{
+		Name:    "hello",
+		Timeout: time.Second,
+		Communities: helpers.MustNewSubnetMap(map[string]string{
+			"::/0": "public",
+		}),
+		Workers: 1,
+	}
+	new := configuration{
+		Name:    "hello",
+		Timeout: 2 * time.Second,
+		Communities: helpers.MustNewSubnetMap(map[string]string{
+			"::/0":                   "public",
+			"::ffff:203.0.113.0/120": "private",
+		}),
+		Workers: 2,
+	}
+
+	if diff := helpers.Diff(helpers.ChangedFields(old, old), []string{}); diff != "" {
+		t.Errorf("ChangedFields() (-got, +want):\n%s", diff)
+	}
+	got := helpers.ChangedFields(old, new)
+	if diff := helpers.Diff(got, []string{"timeout", "communities", "workers"}); diff != "" {
+		t.Errorf("ChangedFields() (-got, +want):\n%s", diff)
+	}
+	got = helpers.ChangedFields(&old, &new, "Communities", "Workers")
+	if diff := helpers.Diff(got, []string{"timeout"}); diff != "" {
+		t.Errorf("ChangedFields() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// secretRegex matches a reference to a secret, like ${env:NAME}.
+var secretRegex = regexp.MustCompile(`^\$\{(env|file|vault):([^}]+)\}$`)
+
+// secretHTTPClient is the HTTP client used to query Vault.
+var secretHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// ResolveSecret returns the value of a sensitive setting. The setting
+// can either be the value itself or a reference to it:
+//
+//   - ${env:NAME} is the content of the NAME environment variable,
+//   - ${file:PATH} is the content of the file at PATH, without the
+//     trailing newline,
+//   - ${vault:PATH#KEY} is the KEY field of the secret at PATH in
+//     HashiCorp Vault (KV version 1 or 2), using VAULT_ADDR and
+//     VAULT_TOKEN to connect to Vault.
+//
+// References are kept unresolved in the configuration, so they are not
+// displayed when the configuration is dumped.
+func ResolveSecret(value string) (string, error) {
+	matches := secretRegex.FindStringSubmatch(value)
+	if matches == nil {
+		return value, nil
+	}
+	switch matches[1] {
+	case "env":
+		secret, ok := os.LookupEnv(matches[2])
+		if !ok {
+			return "", fmt.Errorf("environment variable %q for secret is not set", matches[2])
+		}
+		return secret, nil
+	case "file":
+		secret, err := os.ReadFile(matches[2])
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret: %w", err)
+		}
+		return strings.TrimRight(string(secret), "\r\n"), nil
+	default:
+		return resolveVaultSecret(matches[2])
+	}
+}
+
+// ResolveSecrets returns a copy of the provided map with each value
+// resolved with ResolveSecret.
+func ResolveSecrets(values map[string]string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	resolved := make(map[string]string, len(values))
+	for key, value := range values {
+		secret, err := ResolveSecret(value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve %q: %w", key, err)
+		}
+		resolved[key] = secret
+	}
+	return resolved, nil
+}
+
+// resolveVaultSecret fetches a secret from HashiCorp Vault. The
+// reference is PATH#KEY.
+func resolveVaultSecret(reference string) (string, error) {
+	path, key, ok := strings.Cut(reference, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid Vault secret reference %q, expected PATH#KEY", reference)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequest("GET",
+		fmt.Sprintf("%s/v1/%s", strings.TrimRight(addr, "/"), strings.TrimLeft(path, "/")), nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to build Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := secretHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to query Vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to fetch Vault secret %q: %s", path, resp.Status)
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("unable to decode Vault secret %q: %w", path, err)
+	}
+	data := body.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			// KV version 2
+			data = inner
+		}
+	}
+	secret, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("no key %q in Vault secret %q", key, path)
+	}
+	return secret, nil
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/akvorado":
+			w.Write([]byte(`{"data": {"data": {"community": "from-kv2"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/akvorado":
+			w.Write([]byte(`{"data": {"community": "from-kv1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+	t.Setenv("AKVORADO_TEST_SECRET", "from-env")
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+
+	cases := []struct {
+		In    string
+		Out   string
+		Error bool
+	}{
+		{In: "", Out: ""},
+		{In: "public", Out: "public"},
+		{In: "env:AKVORADO_TEST_SECRET", Out: "env:AKVORADO_TEST_SECRET"},
+		{In: "${env:AKVORADO_TEST_SECRET}", Out: "from-env"},
+		{In: "${env:AKVORADO_TEST_MISSING}", Error: true},
+		{In: "${file:" + secretFile + "}", Out: "from-file"},
+		{In: "${file:/nonexistent/secret}", Error: true},
+		{In: "${vault:secret/data/akvorado#community}", Out: "from-kv2"},
+		{In: "${vault:kv/akvorado#community}", Out: "from-kv1"},
+		{In: "${vault:kv/akvorado#password}", Error: true},
+		{In: "${vault:kv/missing#community}", Error: true},
+		{In: "${vault:kv/akvorado}", Error: true},
+		{In: "${unknown:something}", Out: "${unknown:something}"},
+	}
+	for _, tc := range cases {
+		got, err := ResolveSecret(tc.In)
+		if err != nil && !tc.Error {
+			t.Errorf("ResolveSecret(%q) error:\n%+v", tc.In, err)
+			continue
+		} else if err == nil && tc.Error {
+			t.Errorf("ResolveSecret(%q) did not error", tc.In)
+			continue
+		}
+		if diff := Diff(got, tc.Out); diff != "" {
+			t.Errorf("ResolveSecret(%q) (-got, +want):\n%s", tc.In, diff)
+		}
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("AKVORADO_TEST_SECRET", "from-env")
+	got, err := ResolveSecrets(map[string]string{
+		"Authorization": "${env:AKVORADO_TEST_SECRET}",
+		"X-Custom":      "plain",
+	})
+	if err != nil {
+		t.Fatalf("ResolveSecrets() error:\n%+v", err)
+	}
+	expected := map[string]string{
+		"Authorization": "from-env",
+		"X-Custom":      "plain",
+	}
+	if diff := Diff(got, expected); diff != "" {
+		t.Fatalf("ResolveSecrets() (-got, +want):\n%s", diff)
+	}
+	if _, err := ResolveSecrets(map[string]string{
+		"Authorization": "${env:AKVORADO_TEST_MISSING}",
+	}); err == nil {
+		t.Fatal("ResolveSecrets() did not error")
+	}
+}
@@ -4,6 +4,7 @@
 package helpers
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
 	"net/netip"
@@ -57,6 +58,25 @@ func (sm *SubnetMap[V]) ToMap() map[string]V {
 	return output
 }
 
+// ToIPv6Map return a map of the tree using IPv6 subnets as keys.
+// Unlike ToMap, the result can be provided to NewSubnetMap.
+func (sm *SubnetMap[V]) ToIPv6Map() map[string]V {
+	output := map[string]V{}
+	if sm == nil || sm.tree == nil {
+		return output
+	}
+	iter := sm.tree.Iterate()
+	for iter.Next() {
+		address := iter.Address()
+		var ip [16]byte
+		binary.BigEndian.PutUint64(ip[:8], address.Left)
+		binary.BigEndian.PutUint64(ip[8:], address.Right)
+		prefix := netip.PrefixFrom(netip.AddrFrom16(ip), int(address.Length))
+		output[prefix.String()] = iter.Tags()[0]
+	}
+	return output
+}
+
 // NewSubnetMap creates a subnetmap from a map. Unlike user-provided
 // configuration, this function is stricter and require everything to
 // be IPv6 subnets.
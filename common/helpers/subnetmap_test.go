@@ -244,3 +244,21 @@ func TestToMap(t *testing.T) {
 		t.Fatalf("ToMap() (-got, +want):\n%s", diff)
 	}
 }
+
+func TestToIPv6Map(t *testing.T) {
+	input := helpers.MustNewSubnetMap(map[string]string{
+		"2001:db8::/64":        "hello",
+		"::ffff:192.0.2.0/120": "bye",
+	})
+	got := input.ToIPv6Map()
+	expected := map[string]string{
+		"2001:db8::/64":        "hello",
+		"::ffff:192.0.2.0/120": "bye",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ToIPv6Map() (-got, +want):\n%s", diff)
+	}
+	if _, err := helpers.NewSubnetMap(got); err != nil {
+		t.Fatalf("NewSubnetMap() error:\n%+v", err)
+	}
+}
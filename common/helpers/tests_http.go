@@ -110,10 +110,13 @@ func TestHTTPEndpoints(t *testing.T, serverAddr net.Addr, cases HTTPEndpointCase
 				}
 			} else {
 				decoder := json.NewDecoder(resp.Body)
-				var got gin.H
+				var got interface{}
 				if err := decoder.Decode(&got); err != nil {
 					t.Fatalf("%s %s:\n%+v", tc.Method, tc.URL, err)
 				}
+				if object, ok := got.(map[string]interface{}); ok {
+					got = gin.H(object)
+				}
 				if diff := Diff(got, tc.JSONOutput); diff != "" {
 					t.Fatalf("%s %s (-got, +want):\n%s", tc.Method, tc.URL, diff)
 				}
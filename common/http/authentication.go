@@ -0,0 +1,244 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"akvorado/common/helpers"
+)
+
+// User is an authenticated user.
+type User struct {
+	Login    string
+	Operator bool
+}
+
+type userContextKey struct{}
+
+// UserFromContext returns the authenticated user attached to the
+// provided context, if any.
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(userContextKey{}).(User)
+	return user, ok
+}
+
+// RequireOperator is a Gin middleware rejecting requests not
+// authenticated as an operator. Unlike operational paths, requests are
+// also rejected when authentication is not enabled.
+func RequireOperator(gc *gin.Context) {
+	if user, ok := UserFromContext(gc.Request.Context()); !ok || !user.Operator {
+		gc.AbortWithStatusJSON(http.StatusForbidden,
+			gin.H{"message": "Authentication as an operator is required."})
+		return
+	}
+	gc.Next()
+}
+
+// authenticator checks credentials attached to HTTP requests.
+type authenticator struct {
+	c               *Component
+	config          AuthenticationConfiguration
+	users           map[string]UserConfiguration
+	trustedNetworks []*net.IPNet
+	oidc            *oidcVerifier
+}
+
+// newAuthenticator creates a new authenticator. It returns nil when
+// authentication is not enabled.
+func (c *Component) newAuthenticator(config AuthenticationConfiguration) (*authenticator, error) {
+	if len(config.Users) == 0 && config.Headers.Login == "" && config.OIDC.Issuer == "" {
+		return nil, nil
+	}
+	a := authenticator{
+		c:      c,
+		config: config,
+		users:  map[string]UserConfiguration{},
+	}
+	for _, user := range config.Users {
+		if _, ok := a.users[user.Login]; ok {
+			return nil, fmt.Errorf("duplicate user %q", user.Login)
+		}
+		password, err := helpers.ResolveSecret(user.Password)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve password for user %q: %w", user.Login, err)
+		}
+		user.Password = password
+		a.users[user.Login] = user
+	}
+	if config.Headers.Login != "" && len(config.Headers.TrustedNetworks) == 0 {
+		return nil, errors.New("trusted networks are required for header authentication")
+	}
+	for _, network := range config.Headers.TrustedNetworks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted network %q: %w", network, err)
+		}
+		a.trustedNetworks = append(a.trustedNetworks, ipNet)
+	}
+	if config.OIDC.Issuer != "" {
+		var err error
+		if a.config.OIDC.Issuer, err = helpers.ResolveSecret(config.OIDC.Issuer); err != nil {
+			return nil, fmt.Errorf("unable to resolve OIDC issuer: %w", err)
+		}
+		if _, err := url.ParseRequestURI(a.config.OIDC.Issuer); err != nil {
+			return nil, fmt.Errorf("invalid OIDC issuer: %w", err)
+		}
+		if a.config.OIDC.ClientID, err = helpers.ResolveSecret(config.OIDC.ClientID); err != nil {
+			return nil, fmt.Errorf("unable to resolve OIDC client ID: %w", err)
+		}
+		a.oidc = newOIDCVerifier(a.config.OIDC)
+	}
+	return &a, nil
+}
+
+// Handler wraps the provided handler to check requests are
+// authenticated and authorized.
+func (a *authenticator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if matchPaths(a.config.PublicPaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, method, err := a.authenticate(r)
+		if err != nil {
+			a.c.metrics.authFailures.WithLabelValues(method).Inc()
+			a.c.authLogger.Info().Err(err).
+				Str("method", method).
+				Str("ip", r.RemoteAddr).
+				Msg("authentication failure")
+		}
+		if user == nil {
+			if len(a.users) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="Akvorado", charset="UTF-8"`)
+			}
+			http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+			return
+		}
+		if !user.Operator && matchPaths(a.config.OperationalPaths, r.URL.Path) {
+			http.Error(w, "Forbidden.", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, *user)))
+	})
+}
+
+// authenticate returns the user authenticated by the request, as
+// well as the method used. The user is nil if the request is not
+// authenticated.
+func (a *authenticator) authenticate(r *http.Request) (*User, string, error) {
+	if login, password, ok := r.BasicAuth(); ok && len(a.users) > 0 {
+		user, ok := a.users[login]
+		if !ok || !checkPassword(user.Password, password) {
+			return nil, "basic", fmt.Errorf("invalid credentials for user %q", login)
+		}
+		return &User{Login: login, Operator: user.Operator}, "basic", nil
+	}
+	if authorization := r.Header.Get("Authorization"); a.oidc != nil &&
+		strings.HasPrefix(authorization, "Bearer ") {
+		claims, err := a.oidc.Verify(r.Context(), strings.TrimPrefix(authorization, "Bearer "))
+		if err != nil {
+			return nil, "oidc", err
+		}
+		login, _ := claims[a.config.OIDC.LoginClaim].(string)
+		if login == "" {
+			login, _ = claims["sub"].(string)
+		}
+		var groups []string
+		switch claim := claims[a.config.OIDC.GroupsClaim].(type) {
+		case []interface{}:
+			for _, group := range claim {
+				if group, ok := group.(string); ok {
+					groups = append(groups, group)
+				}
+			}
+		case string:
+			groups = strings.Split(claim, ",")
+		}
+		return &User{Login: login, Operator: a.isOperator(groups)}, "oidc", nil
+	}
+	if a.config.Headers.Login != "" {
+		login := r.Header.Get(a.config.Headers.Login)
+		if login == "" {
+			return nil, "headers", nil
+		}
+		if !a.trustedSource(r) {
+			return nil, "headers", fmt.Errorf("untrusted source for user %q", login)
+		}
+		var groups []string
+		if a.config.Headers.Groups != "" {
+			groups = strings.Split(r.Header.Get(a.config.Headers.Groups), ",")
+		}
+		return &User{Login: login, Operator: a.isOperator(groups)}, "headers", nil
+	}
+	return nil, "none", nil
+}
+
+// isOperator tells if one of the provided groups grants access to
+// operational endpoints.
+func (a *authenticator) isOperator(groups []string) bool {
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		for _, operatorGroup := range a.config.OperatorGroups {
+			if group == operatorGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trustedSource tells if the request comes from a network allowed to
+// set authentication headers.
+func (a *authenticator) trustedSource(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, network := range a.trustedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPassword compares a password with the expected one, either in
+// clear text or as a bcrypt hash.
+func checkPassword(expected, password string) bool {
+	if strings.HasPrefix(expected, "$2a$") || strings.HasPrefix(expected, "$2b$") || strings.HasPrefix(expected, "$2y$") {
+		return bcrypt.CompareHashAndPassword([]byte(expected), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+// matchPaths tells if the provided path matches one of the patterns.
+// Patterns use the syntax of path.Match and also match any path
+// below them.
+func matchPaths(patterns []string, p string) bool {
+	p = path.Clean(p)
+	for _, pattern := range patterns {
+		for candidate := p; ; candidate = path.Dir(candidate) {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+			if candidate == "/" {
+				break
+			}
+		}
+	}
+	return false
+}
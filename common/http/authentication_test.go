@@ -0,0 +1,377 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package http
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+// newAuthenticatedMock creates an HTTP component with the provided
+// authentication configuration and a few test handlers.
+func newAuthenticatedMock(t *testing.T, config AuthenticationConfiguration) *Component {
+	t.Helper()
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Listen = "127.0.0.1:0"
+	defaults := configuration.Authentication
+	if config.PublicPaths == nil {
+		config.PublicPaths = defaults.PublicPaths
+	}
+	if config.OperationalPaths == nil {
+		config.OperationalPaths = defaults.OperationalPaths
+	}
+	if config.OIDC.LoginClaim == "" {
+		config.OIDC.LoginClaim = defaults.OIDC.LoginClaim
+		config.OIDC.GroupsClaim = defaults.OIDC.GroupsClaim
+	}
+	configuration.Authentication = config
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	c.GinRouter.GET("/api/v0/test", func(gc *gin.Context) {
+		user, _ := UserFromContext(gc.Request.Context())
+		gc.JSON(http.StatusOK, gin.H{"login": user.Login})
+	})
+	c.GinRouter.GET("/api/v0/healthcheck", func(gc *gin.Context) {
+		gc.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	c.AddHandler("/debug/test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "debug")
+	}))
+	helpers.StartStop(t, c)
+	return c
+}
+
+func headers(kv ...string) http.Header {
+	h := make(http.Header)
+	for i := 0; i < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+func basicAuth(login, password string) http.Header {
+	return headers("Authorization",
+		"Basic "+base64.StdEncoding.EncodeToString([]byte(login+":"+password)))
+}
+
+func TestNoAuthentication(t *testing.T) {
+	c := newAuthenticatedMock(t, AuthenticationConfiguration{})
+	helpers.TestHTTPEndpoints(t, c.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:        "/api/v0/test",
+			JSONOutput: gin.H{"login": ""},
+		}, {
+			URL:         "/debug/test",
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"debug"},
+		},
+	})
+}
+
+func TestBasicAuthentication(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("batman"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() error:\n%+v", err)
+	}
+	t.Setenv("AKVORADO_TEST_PASSWORD", "pennyworth")
+	c := newAuthenticatedMock(t, AuthenticationConfiguration{
+		Users: []UserConfiguration{
+			{Login: "alfred", Password: "${env:AKVORADO_TEST_PASSWORD}"},
+			{Login: "bruce", Password: string(hash), Operator: true},
+		},
+	})
+	helpers.TestHTTPEndpoints(t, c.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "no credentials",
+			URL:         "/api/v0/test",
+			StatusCode:  401,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Unauthorized."},
+		}, {
+			Description: "public path",
+			URL:         "/api/v0/healthcheck",
+			JSONOutput:  gin.H{"status": "ok"},
+		}, {
+			Description: "reader",
+			URL:         "/api/v0/test",
+			Header:      basicAuth("alfred", "pennyworth"),
+			JSONOutput:  gin.H{"login": "alfred"},
+		}, {
+			Description: "reader on operational path",
+			URL:         "/debug/test",
+			Header:      basicAuth("alfred", "pennyworth"),
+			StatusCode:  403,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Forbidden."},
+		}, {
+			Description: "wrong password",
+			URL:         "/api/v0/test",
+			Header:      basicAuth("alfred", "batman"),
+			StatusCode:  401,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Unauthorized."},
+		}, {
+			Description: "operator with bcrypt password",
+			URL:         "/debug/test",
+			Header:      basicAuth("bruce", "batman"),
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"debug"},
+		},
+	})
+
+	gotMetrics := c.r.GetMetrics("akvorado_common_http_", "authentication_")
+	expectedMetrics := map[string]string{
+		`authentication_failures_total{method="basic"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestHeadersAuthentication(t *testing.T) {
+	config := AuthenticationConfiguration{
+		Headers: HeadersAuthenticationConfiguration{
+			Login:  "Remote-User",
+			Groups: "Remote-Groups",
+		},
+		OperatorGroups: []string{"netops"},
+	}
+	t.Run("trusted", func(t *testing.T) {
+		config.Headers.TrustedNetworks = []string{"127.0.0.0/8"}
+		c := newAuthenticatedMock(t, config)
+		helpers.TestHTTPEndpoints(t, c.LocalAddr(), helpers.HTTPEndpointCases{
+			{
+				Description: "no user",
+				URL:         "/api/v0/test",
+				StatusCode:  401,
+				ContentType: "text/plain; charset=utf-8",
+				FirstLines:  []string{"Unauthorized."},
+			}, {
+				Description: "reader",
+				URL:         "/api/v0/test",
+				Header:      headers("Remote-User", "alfred", "Remote-Groups", "butlers"),
+				JSONOutput:  gin.H{"login": "alfred"},
+			}, {
+				Description: "reader on operational path",
+				URL:         "/debug/test",
+				Header:      headers("Remote-User", "alfred", "Remote-Groups", "butlers"),
+				StatusCode:  403,
+				ContentType: "text/plain; charset=utf-8",
+				FirstLines:  []string{"Forbidden."},
+			}, {
+				Description: "operator",
+				URL:         "/debug/test",
+				Header:      headers("Remote-User", "bruce", "Remote-Groups", "heroes, netops"),
+				ContentType: "text/plain; charset=utf-8",
+				FirstLines:  []string{"debug"},
+			},
+		})
+	})
+	t.Run("no trusted networks", func(t *testing.T) {
+		config.Headers.TrustedNetworks = nil
+		r := reporter.NewMock(t)
+		configuration := DefaultConfiguration()
+		configuration.Authentication = config
+		if _, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+			t.Fatal("New() did not error without trusted networks")
+		}
+	})
+	t.Run("untrusted", func(t *testing.T) {
+		config.Headers.TrustedNetworks = []string{"192.0.2.0/24"}
+		c := newAuthenticatedMock(t, config)
+		helpers.TestHTTPEndpoints(t, c.LocalAddr(), helpers.HTTPEndpointCases{
+			{
+				Description: "reader",
+				URL:         "/api/v0/test",
+				Header:      headers("Remote-User", "alfred"),
+				StatusCode:  401,
+				ContentType: "text/plain; charset=utf-8",
+				FirstLines:  []string{"Unauthorized."},
+			},
+		})
+	})
+}
+
+func TestUnresolvedSecrets(t *testing.T) {
+	cases := []struct {
+		Description string
+		Config      AuthenticationConfiguration
+	}{
+		{"password", AuthenticationConfiguration{
+			Users: []UserConfiguration{{Login: "alfred", Password: "${env:AKVORADO_TEST_MISSING}"}},
+		}},
+		{"OIDC issuer", AuthenticationConfiguration{
+			OIDC: OIDCAuthenticationConfiguration{Issuer: "${env:AKVORADO_TEST_MISSING}", ClientID: "akvorado"},
+		}},
+		{"OIDC client ID", AuthenticationConfiguration{
+			OIDC: OIDCAuthenticationConfiguration{Issuer: "https://sso.example.com", ClientID: "${env:AKVORADO_TEST_MISSING}"},
+		}},
+		{"invalid OIDC issuer", AuthenticationConfiguration{
+			OIDC: OIDCAuthenticationConfiguration{Issuer: "sso.example.com", ClientID: "akvorado"},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			configuration := DefaultConfiguration()
+			configuration.Listen = "127.0.0.1:0"
+			configuration.Authentication = tc.Config
+			if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+				t.Fatal("New() did not error")
+			}
+		})
+	}
+}
+
+func TestOIDCAuthentication(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error:\n%+v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error:\n%+v", err)
+	}
+	var provider *httptest.Server
+	var discoveries int32
+	provider = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			atomic.AddInt32(&discoveries, 1)
+			json.NewEncoder(w).Encode(gin.H{"issuer": provider.URL, "jwks_uri": provider.URL + "/keys"})
+		case "/keys":
+			json.NewEncoder(w).Encode(gin.H{"keys": []gin.H{{
+				"kid": "key1",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+
+	sign := func(key *rsa.PrivateKey, claims gin.H) http.Header {
+		header, _ := json.Marshal(gin.H{"alg": "RS256", "kid": "key1", "typ": "JWT"})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+			base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("SignPKCS1v15() error:\n%+v", err)
+		}
+		return headers("Authorization",
+			"Bearer "+signed+"."+base64.RawURLEncoding.EncodeToString(signature))
+	}
+	claims := func(login string, aud string, exp time.Duration, groups ...string) gin.H {
+		return gin.H{
+			"iss":                provider.URL,
+			"aud":                aud,
+			"sub":                "1234",
+			"preferred_username": login,
+			"groups":             groups,
+			"exp":                time.Now().Add(exp).Unix(),
+		}
+	}
+
+	t.Setenv("AKVORADO_TEST_ISSUER", provider.URL)
+	t.Setenv("AKVORADO_TEST_CLIENT_ID", "akvorado")
+	c := newAuthenticatedMock(t, AuthenticationConfiguration{
+		OIDC: OIDCAuthenticationConfiguration{
+			Issuer:   "${env:AKVORADO_TEST_ISSUER}",
+			ClientID: "${env:AKVORADO_TEST_CLIENT_ID}",
+		},
+		OperatorGroups: []string{"netops"},
+	})
+	helpers.TestHTTPEndpoints(t, c.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "reader",
+			URL:         "/api/v0/test",
+			Header:      sign(key, claims("alfred", "akvorado", time.Hour, "butlers")),
+			JSONOutput:  gin.H{"login": "alfred"},
+		}, {
+			Description: "reader on operational path",
+			URL:         "/debug/test",
+			Header:      sign(key, claims("alfred", "akvorado", time.Hour, "butlers")),
+			StatusCode:  403,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Forbidden."},
+		}, {
+			Description: "operator",
+			URL:         "/debug/test",
+			Header:      sign(key, claims("bruce", "akvorado", time.Hour, "netops")),
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"debug"},
+		}, {
+			Description: "expired token",
+			URL:         "/api/v0/test",
+			Header:      sign(key, claims("alfred", "akvorado", -time.Hour)),
+			StatusCode:  401,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Unauthorized."},
+		}, {
+			Description: "wrong audience",
+			URL:         "/api/v0/test",
+			Header:      sign(key, claims("alfred", "grafana", time.Hour)),
+			StatusCode:  401,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Unauthorized."},
+		}, {
+			Description: "wrong signature",
+			URL:         "/api/v0/test",
+			Header:      sign(otherKey, claims("alfred", "akvorado", time.Hour)),
+			StatusCode:  401,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Unauthorized."},
+		},
+	})
+	if got := atomic.LoadInt32(&discoveries); got != 1 {
+		t.Errorf("provider discovered %d times, expected once", got)
+	}
+}
+
+func TestMatchPaths(t *testing.T) {
+	patterns := []string{"/debug", "/api/v0/*/metrics"}
+	cases := []struct {
+		Path     string
+		Expected bool
+	}{
+		{"/debug", true},
+		{"/debug/pprof/profile", true},
+		{"/debugging", false},
+		{"/api/v0/inlet/metrics", true},
+		{"/api/v0/inlet/metrics/", true},
+		{"/api/v0/metrics", false},
+		{"/api/v0/inlet/../inlet/metrics", true},
+		{"/", false},
+	}
+	for _, tc := range cases {
+		if got := matchPaths(patterns, tc.Path); got != tc.Expected {
+			t.Errorf("matchPaths(%q) == %v but expected %v", tc.Path, got, tc.Expected)
+		}
+	}
+}
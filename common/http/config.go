@@ -7,13 +7,99 @@ package http
 type Configuration struct {
 	// Listen defines the listening string to listen to.
 	Listen string `validate:"required,listen"`
-	// Profiler enables Go profiler as /debug
+	// Profiler enables Go profiler and runtime variables as /debug
 	Profiler bool
+	// Authentication defines how HTTP requests are authenticated.
+	Authentication AuthenticationConfiguration
+}
+
+// AuthenticationConfiguration describes how HTTP requests are
+// authenticated. Authentication is enabled as soon as one method is
+// configured.
+type AuthenticationConfiguration struct {
+	// Users is a list of users allowed to authenticate with basic
+	// authentication.
+	Users []UserConfiguration `validate:"dive"`
+	// Headers defines headers set by a trusted reverse proxy to
+	// identify the user.
+	Headers HeadersAuthenticationConfiguration
+	// OIDC defines an OpenID Connect provider to validate bearer
+	// tokens.
+	OIDC OIDCAuthenticationConfiguration
+	// OperatorGroups is the list of groups, from headers or from
+	// OIDC tokens, granting access to operational endpoints.
+	OperatorGroups []string
+	// PublicPaths are paths accessible without authentication.
+	PublicPaths []string `validate:"dive,startswith=/"`
+	// OperationalPaths are paths only accessible to operators. Other
+	// paths are accessible to any authenticated user.
+	OperationalPaths []string `validate:"dive,startswith=/"`
+}
+
+// UserConfiguration describes a user allowed to authenticate with
+// basic authentication.
+type UserConfiguration struct {
+	// Login is the name of the user.
+	Login string `validate:"required"`
+	// Password is the password of the user, either in clear text or
+	// as a bcrypt hash. It can be a reference to a secret.
+	Password string `validate:"required"`
+	// Operator grants access to operational endpoints.
+	Operator bool
+}
+
+// HeadersAuthenticationConfiguration describes headers set by a
+// trusted reverse proxy to identify the user.
+type HeadersAuthenticationConfiguration struct {
+	// Login is the header containing the user login. Leave empty to
+	// disable header-based authentication.
+	Login string
+	// Groups is the header containing the comma-separated list of
+	// groups of the user.
+	Groups string
+	// TrustedNetworks are the sources allowed to set the headers.
+	// It is mandatory when header-based authentication is enabled.
+	TrustedNetworks []string `validate:"required_with=Login,dive,cidr"`
+}
+
+// OIDCAuthenticationConfiguration describes an OpenID Connect
+// provider used to validate bearer tokens.
+type OIDCAuthenticationConfiguration struct {
+	// Issuer is the URL of the provider. Leave empty to disable
+	// OIDC. It can be a reference to a secret.
+	Issuer string
+	// ClientID is the expected audience of the tokens. It can be a
+	// reference to a secret.
+	ClientID string `validate:"required_with=Issuer"`
+	// LoginClaim is the claim containing the user login.
+	LoginClaim string
+	// GroupsClaim is the claim containing the groups of the user.
+	GroupsClaim string
 }
 
 // DefaultConfiguration is the default configuration of the HTTP server.
 func DefaultConfiguration() Configuration {
 	return Configuration{
 		Listen: "0.0.0.0:8080",
+		Authentication: AuthenticationConfiguration{
+			OIDC: OIDCAuthenticationConfiguration{
+				LoginClaim:  "preferred_username",
+				GroupsClaim: "groups",
+			},
+			PublicPaths: []string{
+				"/api/v0/healthcheck",
+				"/api/v0/*/healthcheck",
+				"/healthz",
+				"/readyz",
+			},
+			OperationalPaths: []string{
+				"/debug",
+				"/api/v0/metrics",
+				"/api/v0/*/metrics",
+				"/api/v0/inlet/flows",
+				"/api/v0/admin",
+				"/api/v0/*/admin",
+			},
+		},
 	}
 }
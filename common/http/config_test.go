@@ -14,3 +14,15 @@ func TestDefaultConfiguration(t *testing.T) {
 		t.Fatalf("validate.Struct() error:\n%+v", err)
 	}
 }
+
+func TestHeadersRequireTrustedNetworks(t *testing.T) {
+	config := DefaultConfiguration()
+	config.Authentication.Headers.Login = "Remote-User"
+	if err := helpers.Validate.Struct(config); err == nil {
+		t.Fatal("validate.Struct() did not error without trusted networks")
+	}
+	config.Authentication.Headers.TrustedNetworks = []string{"127.0.0.0/8"}
+	if err := helpers.Validate.Struct(config); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
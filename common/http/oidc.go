@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/sync/singleflight"
+)
+
+// oidcTimeout is the timeout for requests to the provider.
+const oidcTimeout = 10 * time.Second
+
+// oidcVerifier validates tokens issued by an OpenID Connect provider.
+// The provider is discovered on first use.
+type oidcVerifier struct {
+	config OIDCAuthenticationConfiguration
+	client *http.Client
+	group  singleflight.Group
+
+	lock     sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+func newOIDCVerifier(config OIDCAuthenticationConfiguration) *oidcVerifier {
+	return &oidcVerifier{
+		config: config,
+		client: &http.Client{Timeout: oidcTimeout},
+	}
+}
+
+// Verify checks the signature and the claims of the provided token
+// and returns its claims.
+func (v *oidcVerifier) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	verifier, err := v.idTokenVerifier()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	return claims, nil
+}
+
+// idTokenVerifier returns the verifier for the tokens of the
+// provider. Concurrent discoveries of the provider are merged and the
+// lock is not held while querying it. On failure, the discovery is
+// attempted again on the next call.
+func (v *oidcVerifier) idTokenVerifier() (*oidc.IDTokenVerifier, error) {
+	if verifier := v.loadVerifier(); verifier != nil {
+		return verifier, nil
+	}
+	result, err, _ := v.group.Do("discovery", func() (interface{}, error) {
+		if verifier := v.loadVerifier(); verifier != nil {
+			return verifier, nil
+		}
+		// The context is kept by the provider to refresh the keys.
+		ctx := oidc.ClientContext(context.Background(), v.client)
+		provider, err := oidc.NewProvider(ctx, v.config.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("unable to discover OIDC provider: %w", err)
+		}
+		verifier := provider.Verifier(&oidc.Config{ClientID: v.config.ClientID})
+		v.lock.Lock()
+		v.verifier = verifier
+		v.lock.Unlock()
+		return verifier, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*oidc.IDTokenVerifier), nil
+}
+
+func (v *oidcVerifier) loadVerifier() *oidc.IDTokenVerifier {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.verifier
+}
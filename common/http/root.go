@@ -6,6 +6,7 @@ package http
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
@@ -29,12 +30,15 @@ type Component struct {
 	t      tomb.Tomb
 	config Configuration
 
-	mux     *http.ServeMux
-	metrics struct {
-		inflights reporter.Gauge
-		requests  *reporter.CounterVec
-		durations *reporter.HistogramVec
-		sizes     *reporter.HistogramVec
+	mux           *http.ServeMux
+	authenticator *authenticator
+	authLogger    reporter.Logger
+	metrics       struct {
+		inflights    reporter.Gauge
+		requests     *reporter.CounterVec
+		durations    *reporter.HistogramVec
+		sizes        *reporter.HistogramVec
+		authFailures *reporter.CounterVec
 	}
 	address net.Addr
 
@@ -54,9 +58,15 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		d:      &dependencies,
 		config: configuration,
 
-		mux:       http.NewServeMux(),
-		GinRouter: gin.New(),
+		mux:        http.NewServeMux(),
+		authLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+		GinRouter:  gin.New(),
 	}
+	authenticator, err := c.newAuthenticator(configuration.Authentication)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure authentication: %w", err)
+	}
+	c.authenticator = authenticator
 	c.d.Daemon.Track(&c.t, "common/http")
 
 	c.metrics.inflights = c.r.Gauge(
@@ -85,6 +95,12 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 			Buckets: []float64{200, 500, 1000, 1500, 5000},
 		}, []string{"handler", "method"},
 	)
+	c.metrics.authFailures = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "authentication_failures_total",
+			Help: "Number of requests with invalid credentials.",
+		}, []string{"method"},
+	)
 
 	c.GinRouter.Use(gin.Recovery())
 	c.AddHandler("/api/", c.GinRouter)
@@ -94,6 +110,7 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		c.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
 		c.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 		c.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		c.mux.Handle("/debug/vars", expvar.Handler())
 	}
 	return &c, nil
 }
@@ -102,8 +119,13 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 func (c *Component) AddHandler(location string, handler http.Handler) {
 	l := c.r.With().Str("handler", location).Logger()
 	handler = hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+		var login string
+		if user, ok := UserFromContext(r.Context()); ok {
+			login = user.Login
+		}
 		hlog.FromRequest(r).Info().
 			Str("method", r.Method).
+			Str("user", login).
 			Stringer("url", r.URL).
 			Str("ip", r.RemoteAddr).
 			Str("user-agent", r.Header.Get("User-Agent")).
@@ -129,9 +151,13 @@ func (c *Component) Start() error {
 	if c.config.Listen == "" {
 		return nil
 	}
+	var handler http.Handler = c.mux
+	if c.authenticator != nil {
+		handler = c.authenticator.Handler(handler)
+	}
 	server := &http.Server{
 		Addr:    c.config.Listen,
-		Handler: c.mux,
+		Handler: handler,
 	}
 
 	// Most of the time, if we have an error, it's here!
@@ -8,6 +8,7 @@ import (
 	netHTTP "net/http"
 	"testing"
 
+	"akvorado/common/daemon"
 	"akvorado/common/helpers"
 	"akvorado/common/http"
 	"akvorado/common/reporter"
@@ -90,3 +91,34 @@ func TestGinRouterPanic(t *testing.T) {
 		},
 	})
 }
+
+func TestProfiler(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("profiler=%v", enabled), func(t *testing.T) {
+			r := reporter.NewMock(t)
+			config := http.DefaultConfiguration()
+			config.Listen = "127.0.0.1:0"
+			config.Profiler = enabled
+			h, err := http.New(r, config, http.Dependencies{Daemon: daemon.NewMock(t)})
+			if err != nil {
+				t.Fatalf("New() error:\n%+v", err)
+			}
+			helpers.StartStop(t, h)
+
+			for _, url := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars"} {
+				resp, err := netHTTP.Get(fmt.Sprintf("http://%s%s", h.LocalAddr(), url))
+				if err != nil {
+					t.Fatalf("GET %s:\n%+v", url, err)
+				}
+				resp.Body.Close()
+				expected := netHTTP.StatusNotFound
+				if enabled {
+					expected = netHTTP.StatusOK
+				}
+				if resp.StatusCode != expected {
+					t.Errorf("GET %s: got status code %d, expected %d", url, resp.StatusCode, expected)
+				}
+			}
+		})
+	}
+}
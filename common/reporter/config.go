@@ -4,14 +4,18 @@
 package reporter
 
 import (
+	"akvorado/common/reporter/crash"
 	"akvorado/common/reporter/logger"
 	"akvorado/common/reporter/metrics"
+	"akvorado/common/reporter/tracing"
 )
 
 // Configuration contains the reporter configuration.
 type Configuration struct {
 	Logging logger.Configuration
 	Metrics metrics.Configuration
+	Tracing tracing.Configuration
+	Crash   crash.Configuration
 }
 
 // DefaultConfiguration is the default reporter configuration.
@@ -19,5 +23,7 @@ func DefaultConfiguration() Configuration {
 	return Configuration{
 		Logging: logger.DefaultConfiguration(),
 		Metrics: metrics.DefaultConfiguration(),
+		Tracing: tracing.DefaultConfiguration(),
+		Crash:   crash.DefaultConfiguration(),
 	}
 }
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Crash reporting façade for reporter.
+
+package reporter
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// ReportCrash sends a crash report for the provided component when
+// crash reporting is enabled. The stack trace is optional.
+func (r *Reporter) ReportCrash(component string, message string, stack []byte) {
+	r.crash.Send(component, message, stack, func(err error) {
+		r.Err(err).Str("component", component).Msg("unable to send crash report")
+	})
+}
+
+// ReportPanic logs and reports a panic. It should be called from a
+// deferred function with the value returned by recover().
+func (r *Reporter) ReportPanic(component string, recovered interface{}) {
+	stack := debug.Stack()
+	message := fmt.Sprintf("panic: %v", recovered)
+	r.Error().
+		Str("component", component).
+		Bytes("stack", stack).
+		Msg(message)
+	r.ReportCrash(component, message, stack)
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package crash
+
+import "time"
+
+// Configuration is the configuration for crash reports.
+type Configuration struct {
+	// URL is the webhook receiving crash reports. Crash reporting is
+	// disabled when empty.
+	URL string `validate:"omitempty,url"`
+	// Timeout is the maximum time to send a crash report.
+	Timeout time.Duration `validate:"min=100ms"`
+	// Interval is the minimum interval between two reports for the
+	// same component.
+	Interval time.Duration `validate:"min=0"`
+}
+
+// DefaultConfiguration is the default crash reporting configuration.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Timeout:  5 * time.Second,
+		Interval: time.Minute,
+	}
+}
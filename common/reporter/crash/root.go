@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package crash sends crash reports to a webhook.
+//
+// Crash reports are sent as JSON objects using a POST request. They
+// are sent when a component fails or when a panic is recovered.
+package crash
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Report is a crash report.
+type Report struct {
+	Time      time.Time `json:"time"`
+	Hostname  string    `json:"hostname"`
+	Component string    `json:"component"`
+	Message   string    `json:"message"`
+	Stack     string    `json:"stack,omitempty"`
+}
+
+// Crash represents the internal state of the crash reporter.
+type Crash struct {
+	config   Configuration
+	client   *http.Client
+	hostname string
+
+	wg       sync.WaitGroup
+	lock     sync.Mutex
+	reported map[string]time.Time
+}
+
+// New creates a new crash reporter.
+func New(config Configuration) (*Crash, error) {
+	hostname, _ := os.Hostname()
+	return &Crash{
+		config:   config,
+		client:   &http.Client{Timeout: config.Timeout},
+		hostname: hostname,
+		reported: make(map[string]time.Time),
+	}, nil
+}
+
+// Send sends a crash report in the background. It returns false when
+// crash reporting is disabled or when a report was sent recently for
+// the same component. Errors are passed to onError.
+func (c *Crash) Send(component, message string, stack []byte, onError func(error)) bool {
+	if c.config.URL == "" {
+		return false
+	}
+	now := time.Now()
+	c.lock.Lock()
+	if last, ok := c.reported[component]; ok && now.Sub(last) < c.config.Interval {
+		c.lock.Unlock()
+		return false
+	}
+	c.reported[component] = now
+	c.lock.Unlock()
+
+	report := Report{
+		Time:      now.UTC(),
+		Hostname:  c.hostname,
+		Component: component,
+		Message:   message,
+		Stack:     string(stack),
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		if err := c.post(report); err != nil && onError != nil {
+			onError(err)
+		}
+	}()
+	return true
+}
+
+func (c *Crash) post(report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("cannot encode crash report: %w", err)
+	}
+	resp, err := c.client.Post(c.config.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot send crash report: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("cannot send crash report: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Shutdown waits for the pending crash reports to be sent.
+func (c *Crash) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("cannot send pending crash reports: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package crash
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+func TestDisabled(t *testing.T) {
+	c, err := New(DefaultConfiguration())
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if c.Send("inlet/flow", "oops", nil, nil) {
+		t.Error("Send() returned true while disabled")
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error:\n%+v", err)
+	}
+}
+
+func TestSend(t *testing.T) {
+	reports := make(chan Report, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report Report
+		if r.Method != "POST" {
+			t.Errorf("Method got %s, expected POST", r.Method)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("Decode() error:\n%+v", err)
+		}
+		reports <- report
+	}))
+	defer server.Close()
+
+	config := DefaultConfiguration()
+	config.URL = server.URL
+	c, err := New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	onError := func(err error) { t.Errorf("Send() error:\n%+v", err) }
+	if !c.Send("inlet/flow", "oops", []byte("stack"), onError) {
+		t.Error("Send() returned false")
+	}
+	// Same component: rate-limited
+	if c.Send("inlet/flow", "oops again", nil, onError) {
+		t.Error("Send() returned true while rate-limited")
+	}
+	if !c.Send("inlet/snmp", "oops", nil, onError) {
+		t.Error("Send() returned false")
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error:\n%+v", err)
+	}
+	close(reports)
+
+	got := map[string]Report{}
+	for report := range reports {
+		if time.Since(report.Time) > time.Minute {
+			t.Errorf("Report time %s is too old", report.Time)
+		}
+		report.Time = time.Time{}
+		report.Hostname = ""
+		got[report.Component] = report
+	}
+	expected := map[string]Report{
+		"inlet/flow": {Component: "inlet/flow", Message: "oops", Stack: "stack"},
+		"inlet/snmp": {Component: "inlet/snmp", Message: "oops"},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Send() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestSendError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	config := DefaultConfiguration()
+	config.URL = server.URL
+	c, err := New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	errors := make(chan error, 1)
+	c.Send("inlet/flow", "oops", nil, func(err error) { errors <- err })
+	c.Shutdown(context.Background())
+	select {
+	case err := <-errors:
+		if err == nil {
+			t.Fatal("Send() did not return an error")
+		}
+	default:
+		t.Fatal("Send() did not report an error")
+	}
+}
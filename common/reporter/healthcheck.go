@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // HealthcheckStatus represents an healthcheck status.
@@ -65,19 +66,48 @@ func (r *Reporter) RegisterHealthcheck(name string, hf HealthcheckFunc) {
 	r.healthchecksLock.Unlock()
 }
 
+// RegisterReadinessCheck registers a new readiness check. A readiness
+// check tells if a component is ready to do its work, for example
+// because it can reach an external service or because it has loaded
+// its state. It uses the same functions as healthchecks.
+func (r *Reporter) RegisterReadinessCheck(name string, hf HealthcheckFunc) {
+	r.healthchecksLock.Lock()
+	r.readinessChecks[name] = hf
+	r.healthchecksLock.Unlock()
+}
+
 // RunHealthchecks execute all healthchecks in parallel and returns a
 // global status as well as a map from service names to returned
-// results.
+// results. The healthcheck metric is updated with the results.
 func (r *Reporter) RunHealthchecks(ctx context.Context) MultipleHealthcheckResults {
+	r.healthchecksLock.Lock()
+	defer r.healthchecksLock.Unlock()
+	results := runChecks(ctx, r.healthchecks)
+	for name, result := range results.Details {
+		r.healthcheckGauge.WithLabelValues(name).Set(float64(result.Status))
+	}
+	return results
+}
+
+// RunReadinessChecks execute all readiness checks in parallel and
+// returns a global status as well as a map from service names to
+// returned results.
+func (r *Reporter) RunReadinessChecks(ctx context.Context) MultipleHealthcheckResults {
+	r.healthchecksLock.Lock()
+	defer r.healthchecksLock.Unlock()
+	return runChecks(ctx, r.readinessChecks)
+}
+
+// runChecks execute the provided checks in parallel. The caller should
+// hold the lock.
+func runChecks(ctx context.Context, checks map[string]HealthcheckFunc) MultipleHealthcheckResults {
 	var wg sync.WaitGroup
 	results := MultipleHealthcheckResults{
 		Status:  HealthcheckOK,
 		Details: map[string]HealthcheckResult{},
 	}
 
-	r.healthchecksLock.Lock()
-	defer r.healthchecksLock.Unlock()
-	runningHealthchecks := len(r.healthchecks)
+	runningHealthchecks := len(checks)
 	if runningHealthchecks == 0 {
 		return results
 	}
@@ -106,7 +136,7 @@ func (r *Reporter) RunHealthchecks(ctx context.Context) MultipleHealthcheckResul
 	}()
 
 	// One goroutine for each healthcheck
-	for name, healthcheckFunc := range r.healthchecks {
+	for name, healthcheckFunc := range checks {
 		wg.Add(1)
 		go func(name string, healthcheckFunc HealthcheckFunc) {
 			defer wg.Done()
@@ -125,7 +155,7 @@ func (r *Reporter) RunHealthchecks(ctx context.Context) MultipleHealthcheckResul
 	wg.Wait() // keep lock, we don't want something to change
 
 	// Check what we have
-	for name := range r.healthchecks {
+	for name := range checks {
 		if result, ok := results.Details[name]; ok {
 			if result.Status > results.Status {
 				results.Status = result.Status
@@ -143,7 +173,18 @@ func (r *Reporter) RunHealthchecks(ctx context.Context) MultipleHealthcheckResul
 func (r *Reporter) HealthcheckHTTPHandler(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
-	results := r.RunHealthchecks(ctx)
+	checksHTTPResponse(c, r.RunHealthchecks(ctx))
+}
+
+// ReadinessHTTPHandler is an HTTP handler return readiness check
+// results as JSON.
+func (r *Reporter) ReadinessHTTPHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	checksHTTPResponse(c, r.RunReadinessChecks(ctx))
+}
+
+func checksHTTPResponse(c *gin.Context, results MultipleHealthcheckResults) {
 	httpStatus := http.StatusOK
 	if results.Status == HealthcheckError {
 		httpStatus = http.StatusServiceUnavailable
@@ -151,6 +192,37 @@ func (r *Reporter) HealthcheckHTTPHandler(c *gin.Context) {
 	c.JSON(httpStatus, results)
 }
 
+// healthcheckInterval is the interval between two runs of the
+// healthchecks to update the healthcheck metric.
+const healthcheckInterval = 30 * time.Second
+
+// newHealthcheckGauge creates the gauge exporting the status of each
+// healthcheck. It is not prefixed by the module name.
+func newHealthcheckGauge() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "akvorado_healthcheck_status",
+		Help: "Status of the healthcheck for each component (0: ok, 1: warning, 2: error).",
+	}, []string{"component"})
+}
+
+// runHealthchecksPeriodically runs the healthchecks to update the
+// healthcheck metric until the reporter is stopped. The metric is also
+// updated each time the healthchecks are run for another reason.
+func (r *Reporter) runHealthchecksPeriodically() error {
+	ticker := time.NewTicker(healthcheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.t.Dying():
+			return nil
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(r.t.Context(nil), 5*time.Second)
+			r.RunHealthchecks(ctx)
+			cancel()
+		}
+	}
+}
+
 // ChannelHealthcheckFunc is the function sent over a channel to signal liveness
 type ChannelHealthcheckFunc func(HealthcheckStatus, string)
 
@@ -165,7 +237,7 @@ func ChannelHealthcheck(ctx context.Context, contact chan<- ChannelHealthcheckFu
 		signalFunc := func(status HealthcheckStatus, reason string) {
 			// The answer chan may be closed, because this
 			// function was called too late.
-			defer recover()
+			defer func() { recover() }()
 			answerChan <- HealthcheckResult{status, reason}
 		}
 
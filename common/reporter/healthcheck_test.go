@@ -154,3 +154,63 @@ func TestHealthcheckHTTPHandler(t *testing.T) {
 		t.Fatalf("GET /api/v0/healthcheck (-got, +want):\n%s", diff)
 	}
 }
+
+func TestReadinessCheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	r.RegisterHealthcheck("hc1", func(ctx context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{reporter.HealthcheckError, "not so good"}
+	})
+	r.RegisterReadinessCheck("rc1", func(ctx context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{reporter.HealthcheckOK, "ready"}
+	})
+	r.RegisterReadinessCheck("rc2", func(ctx context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{reporter.HealthcheckWarning, "almost ready"}
+	})
+	got := r.RunReadinessChecks(context.Background())
+	expected := reporter.MultipleHealthcheckResults{
+		Status: reporter.HealthcheckWarning,
+		Details: map[string]reporter.HealthcheckResult{
+			"rc1": {reporter.HealthcheckOK, "ready"},
+			"rc2": {reporter.HealthcheckWarning, "almost ready"},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Errorf("RunReadinessChecks() (-got, +want):\n%s", diff)
+	}
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	ginRouter := gin.Default()
+	ginRouter.GET("/readyz", r.ReadinessHTTPHandler)
+	ginRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /readyz status code, got %d, expected %d",
+			w.Code, http.StatusOK)
+	}
+}
+
+func TestHealthcheckMetrics(t *testing.T) {
+	r := reporter.NewMock(t)
+	r.RegisterHealthcheck("hc1", func(ctx context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{reporter.HealthcheckOK, "all well"}
+	})
+	r.RegisterHealthcheck("hc2", func(ctx context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{reporter.HealthcheckWarning, "not so good"}
+	})
+	r.RegisterHealthcheck("hc3", func(ctx context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{reporter.HealthcheckError, "bad"}
+	})
+	if got := r.GetMetrics("akvorado_healthcheck_"); len(got) != 0 {
+		t.Fatalf("Metrics before running healthchecks: %v", got)
+	}
+	r.RunHealthchecks(context.Background())
+	gotMetrics := r.GetMetrics("akvorado_healthcheck_")
+	expectedMetrics := map[string]string{
+		`status{component="hc1"}`: "0",
+		`status{component="hc2"}`: "1",
+		`status{component="hc3"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
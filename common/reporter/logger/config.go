@@ -3,10 +3,47 @@
 
 package logger
 
-// Configuration if the configuration for logger. Currently, there is no configuration.
-type Configuration struct{}
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Configuration is the configuration for logger.
+type Configuration struct {
+	// Format is the output format for logs. "auto" selects a
+	// human-readable format when the output is a terminal and JSON
+	// otherwise.
+	Format string `validate:"oneof=auto console json"`
+	// Level is the default log level.
+	Level zerolog.Level
+	// Levels overrides the log level for some modules. Modules are
+	// named relative to akvorado (for example, "inlet/snmp") and the
+	// level also applies to their submodules.
+	Levels map[string]zerolog.Level
+	// Deduplication collapses identical log messages.
+	Deduplication DeduplicationConfiguration
+}
+
+// DeduplicationConfiguration is the configuration to collapse
+// identical log messages.
+type DeduplicationConfiguration struct {
+	// Interval is the period during which identical messages are
+	// collapsed. Deduplication is disabled when zero.
+	Interval time.Duration
+	// Burst is the number of identical messages logged during an
+	// interval before collapsing them.
+	Burst uint `validate:"min=1"`
+}
 
 // DefaultConfiguration is the default logging configuration.
 func DefaultConfiguration() Configuration {
-	return Configuration{}
+	return Configuration{
+		Format: "auto",
+		Level:  zerolog.InfoLevel,
+		Deduplication: DeduplicationConfiguration{
+			Interval: time.Minute,
+			Burst:    10,
+		},
+	}
 }
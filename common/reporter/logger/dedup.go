@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// deduplicator collapses identical log messages. Messages are
+// identical when they have the same level, module and message. Their
+// fields are not compared. During each interval, the first messages
+// are logged and the other ones are only counted. At the end of the
+// interval, a summary is logged with the number of dropped messages.
+type deduplicator struct {
+	interval time.Duration
+	burst    uint
+	output   zerolog.Logger
+
+	lock    sync.Mutex
+	entries map[deduplicatorKey]*deduplicatorEntry
+}
+
+type deduplicatorKey struct {
+	level   zerolog.Level
+	module  string
+	message string
+}
+
+type deduplicatorEntry struct {
+	count   uint
+	dropped uint
+}
+
+func newDeduplicator(config DeduplicationConfiguration, output zerolog.Logger) *deduplicator {
+	if config.Interval == 0 {
+		return nil
+	}
+	return &deduplicator{
+		interval: config.Interval,
+		burst:    config.Burst,
+		output:   output,
+		entries:  make(map[deduplicatorKey]*deduplicatorEntry),
+	}
+}
+
+// accept tells if a message should be logged.
+func (d *deduplicator) accept(level zerolog.Level, module string, message string) bool {
+	key := deduplicatorKey{level, module, message}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	entry, ok := d.entries[key]
+	if !ok {
+		entry = &deduplicatorEntry{}
+		d.entries[key] = entry
+		time.AfterFunc(d.interval, func() { d.flush(key) })
+	}
+	entry.count++
+	if entry.count <= d.burst {
+		return true
+	}
+	entry.dropped++
+	return false
+}
+
+// flush ends the interval for the provided message and logs a summary
+// if some messages were dropped.
+func (d *deduplicator) flush(key deduplicatorKey) {
+	d.lock.Lock()
+	entry := d.entries[key]
+	delete(d.entries, key)
+	d.lock.Unlock()
+	if entry == nil || entry.dropped == 0 {
+		return
+	}
+	e := d.output.WithLevel(key.level)
+	if key.module != "" {
+		e = e.Str("module", key.module)
+	}
+	e.Uint("repeated", entry.dropped).
+		Dur("interval", d.interval).
+		Msg(key.message)
+}
@@ -3,8 +3,8 @@
 
 // Package logger handles logging for akvorado.
 //
-// This is a thin wrapper around zerolog. It is currently not
-// configurable as we don't need anything fancy yet for configuration.
+// This is a thin wrapper around zerolog. The output format and the log
+// levels, globally or per module, can be configured.
 //
 // It also brings some conventions like the presence of "module" in
 // each context to be able to filter logs more easily. However, this
@@ -13,7 +13,9 @@
 package logger
 
 import (
+	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -25,30 +27,124 @@ import (
 // from zerolog by design.
 type Logger struct {
 	zerolog.Logger
+	levels *atomic.Pointer[levels]
+}
+
+// levels are the log levels currently in use.
+type levels struct {
+	level  zerolog.Level
+	levels map[string]zerolog.Level // full module names
+	min    zerolog.Level
+	max    zerolog.Level
 }
 
 // New creates a new logger
 func New(config Configuration) (Logger, error) {
 	// Initialize the logger
-	var logger = log.Logger.Hook(contextHook{})
-	return Logger{logger}, nil
+	var logger zerolog.Logger
+	switch config.Format {
+	case "json":
+		logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+	case "console":
+		logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+	default:
+		logger = log.Logger
+	}
+
+	// Events are filtered by the hook, once we know the module. As
+	// levels can be changed at runtime, the logger accepts everything.
+	l := Logger{levels: &atomic.Pointer[levels]{}}
+	l.SetLevels(config.Level, config.Levels)
+	logger = logger.Level(zerolog.TraceLevel)
+	l.Logger = logger.Hook(contextHook{
+		levels: l.levels,
+		dedup:  newDeduplicator(config.Deduplication, logger),
+	})
+	return l, nil
+}
+
+// SetLevels changes the default log level and the log levels for
+// each module. Modules are named relative to akvorado.
+func (l Logger) SetLevels(level zerolog.Level, moduleLevels map[string]zerolog.Level) {
+	current := levels{
+		level:  level,
+		levels: make(map[string]zerolog.Level, len(moduleLevels)),
+		min:    level,
+		max:    level,
+	}
+	for module, level := range moduleLevels {
+		current.levels[stack.ModuleName+"/"+strings.Trim(module, "/")] = level
+		if level < current.min {
+			current.min = level
+		}
+		if level > current.max {
+			current.max = level
+		}
+	}
+	l.levels.Store(&current)
+}
+
+// Levels returns the default log level and the log levels for each
+// module.
+func (l Logger) Levels() (zerolog.Level, map[string]zerolog.Level) {
+	current := l.levels.Load()
+	moduleLevels := make(map[string]zerolog.Level, len(current.levels))
+	for module, level := range current.levels {
+		moduleLevels[strings.TrimPrefix(module, stack.ModuleName+"/")] = level
+	}
+	return current.level, moduleLevels
 }
 
-type contextHook struct{}
+type contextHook struct {
+	levels *atomic.Pointer[levels]
+	dedup  *deduplicator
+}
 
 // Run adds more context to an event, including "module" and "caller".
+// The event is discarded if its level is lower than the one configured
+// for the module or if it is a duplicate of a previous event.
 func (h contextHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	current := h.levels.Load()
+	if level < current.min {
+		e.Discard()
+		return
+	}
 	callStack := stack.Callers()
 	callStack = callStack[3:] // Trial and error, there is a test to check it works
-	caller := callStack[0].SourceFile(true)
-	e.Str("caller", caller)
+	module := ""
 	for _, call := range callStack {
-		module := call.FunctionName()
+		module = call.FunctionName()
 		if !strings.HasPrefix(module, stack.ModuleName) {
+			module = ""
 			continue
 		}
 		module = strings.SplitN(module, ".", 2)[0]
-		e.Str("module", module)
 		break
 	}
+	if level < current.max && level < current.moduleLevel(module) {
+		e.Discard()
+		return
+	}
+	if h.dedup != nil && !h.dedup.accept(level, module, msg) {
+		e.Discard()
+		return
+	}
+	e.Str("caller", callStack[0].SourceFile(true))
+	if module != "" {
+		e.Str("module", module)
+	}
+}
+
+// moduleLevel returns the log level for the provided module. The most
+// specific configured module wins.
+func (current *levels) moduleLevel(module string) zerolog.Level {
+	level := current.level
+	matched := ""
+	for name, l := range current.levels {
+		if len(name) > len(matched) && (module == name || strings.HasPrefix(module, name+"/")) {
+			level = l
+			matched = name
+		}
+	}
+	return level
 }
@@ -4,7 +4,19 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"akvorado/common/helpers"
 )
 
 func TestNew(t *testing.T) {
@@ -14,3 +26,188 @@ func TestNew(t *testing.T) {
 	}
 	logger.Info().Int("integer", 15).Msg("log message")
 }
+
+func TestLevels(t *testing.T) {
+	previous := log.Logger
+	defer func() { log.Logger = previous }()
+
+	cases := []struct {
+		Description string
+		Level       zerolog.Level
+		Levels      map[string]zerolog.Level
+		Expected    []string
+	}{
+		{
+			Description: "default level",
+			Level:       zerolog.InfoLevel,
+			Expected:    []string{"info", "warn"},
+		}, {
+			Description: "module with a higher level",
+			Level:       zerolog.InfoLevel,
+			Levels:      map[string]zerolog.Level{"common/reporter/logger": zerolog.WarnLevel},
+			Expected:    []string{"warn"},
+		}, {
+			Description: "module with a lower level",
+			Level:       zerolog.WarnLevel,
+			Levels:      map[string]zerolog.Level{"common/reporter/logger": zerolog.DebugLevel},
+			Expected:    []string{"debug", "info", "warn"},
+		}, {
+			Description: "parent module",
+			Level:       zerolog.WarnLevel,
+			Levels:      map[string]zerolog.Level{"common": zerolog.InfoLevel},
+			Expected:    []string{"info", "warn"},
+		}, {
+			Description: "most specific module wins",
+			Level:       zerolog.InfoLevel,
+			Levels: map[string]zerolog.Level{
+				"common":                 zerolog.DebugLevel,
+				"common/reporter/logger": zerolog.WarnLevel,
+			},
+			Expected: []string{"warn"},
+		}, {
+			Description: "unrelated module",
+			Level:       zerolog.InfoLevel,
+			Levels:      map[string]zerolog.Level{"common/reporter/log": zerolog.DebugLevel},
+			Expected:    []string{"info", "warn"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.Logger = zerolog.New(&buf)
+			logger, err := New(Configuration{Level: tc.Level, Levels: tc.Levels})
+			if err != nil {
+				t.Fatalf("New() error:\n%+v", err)
+			}
+			logger.Debug().Msg("debug")
+			logger.Info().Msg("info")
+			logger.Warn().Msg("warn")
+			got := []string{}
+			decoder := json.NewDecoder(&buf)
+			for decoder.More() {
+				var event struct{ Message string }
+				if err := decoder.Decode(&event); err != nil {
+					t.Fatalf("Decode() error:\n%+v", err)
+				}
+				got = append(got, event.Message)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.Expected, ",") {
+				t.Fatalf("New() logged %v, expected %v", got, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestSetLevels(t *testing.T) {
+	previous := log.Logger
+	defer func() { log.Logger = previous }()
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+
+	logger, err := New(Configuration{Level: zerolog.InfoLevel})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	logger.Debug().Msg("debug 1")
+	logger.SetLevels(zerolog.WarnLevel, map[string]zerolog.Level{
+		"common/reporter/logger": zerolog.DebugLevel,
+	})
+	logger.Debug().Msg("debug 2")
+	sublogger := logger.With().Str("hello", "world").Logger()
+	sublogger.Debug().Msg("debug 3")
+
+	if got := strings.Count(buf.String(), `"message":"debug`); got != 2 {
+		t.Fatalf("SetLevels() logged %d debug messages, expected 2:\n%s", got, buf.String())
+	}
+	level, levels := logger.Levels()
+	if level != zerolog.WarnLevel {
+		t.Errorf("Levels() == %s, expected %s", level, zerolog.WarnLevel)
+	}
+	if len(levels) != 1 || levels["common/reporter/logger"] != zerolog.DebugLevel {
+		t.Errorf("Levels() == %v", levels)
+	}
+}
+
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	return lb.buf.Write(p)
+}
+
+func (lb *lockedBuffer) Lines() []map[string]interface{} {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+	lines := []map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(lb.buf.Bytes()))
+	for {
+		var line map[string]interface{}
+		if err := decoder.Decode(&line); err != nil {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestDeduplication(t *testing.T) {
+	previous := log.Logger
+	defer func() { log.Logger = previous }()
+	var buf lockedBuffer
+	log.Logger = zerolog.New(&buf)
+
+	logger, err := New(Configuration{
+		Level: zerolog.InfoLevel,
+		Deduplication: DeduplicationConfiguration{
+			Interval: 50 * time.Millisecond,
+			Burst:    2,
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Warn().Int("i", i).Msg("SNMP cache miss")
+		logger.Info().Msg("SNMP cache miss")
+	}
+	logger.Warn().Msg("something else")
+
+	got := []string{}
+	for _, line := range buf.Lines() {
+		got = append(got, fmt.Sprintf("%s %s %v", line["level"], line["message"], line["repeated"]))
+	}
+	expected := []string{
+		"warn SNMP cache miss <nil>",
+		"info SNMP cache miss <nil>",
+		"warn SNMP cache miss <nil>",
+		"info SNMP cache miss <nil>",
+		"warn something else <nil>",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Logs before summary (-got, +want):\n%s", diff)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	got = []string{}
+	for _, line := range buf.Lines()[len(expected):] {
+		got = append(got, fmt.Sprintf("%s %s %v %s", line["level"], line["message"], line["repeated"], line["module"]))
+	}
+	sort.Strings(got)
+	expected = []string{
+		"info SNMP cache miss 8 akvorado/common/reporter/logger",
+		"warn SNMP cache miss 8 akvorado/common/reporter/logger",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Logs after summary (-got, +want):\n%s", diff)
+	}
+
+	// A new interval starts
+	logger.Warn().Msg("SNMP cache miss")
+	if got := len(buf.Lines()); got != 8 {
+		t.Fatalf("Logs after new interval: got %d lines, expected 8", got)
+	}
+}
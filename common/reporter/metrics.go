@@ -106,6 +106,13 @@ func (r *Reporter) SummaryVec(opts SummaryOpts, labelNames []string) *SummaryVec
 	return r.metrics.Factory(1).NewSummaryVec(opts, labelNames)
 }
 
+// ExporterLabel returns the value to use for an exporter label. It
+// should be used for all metrics labeled by exporter to bound their
+// cardinality.
+func (r *Reporter) ExporterLabel(exporter string) string {
+	return r.metrics.ExporterLabel(exporter)
+}
+
 // MetricsHTTPHandler returns the HTTP handler to get metrics.
 func (r *Reporter) MetricsHTTPHandler() http.Handler {
 	return r.metrics.HTTPHandler()
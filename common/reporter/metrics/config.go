@@ -3,11 +3,40 @@
 
 package metrics
 
-// Configuration is currently empty as this sub-component is not
-// configurable yet.
-type Configuration struct{}
+import "time"
+
+// Configuration is the configuration for metrics.
+type Configuration struct {
+	// Push configures pushing metrics to a Pushgateway.
+	Push PushConfiguration
+	// MaxExporters is the maximum number of distinct exporters used
+	// as a label value. Additional exporters are aggregated under
+	// "other". There is no limit when zero.
+	MaxExporters uint
+}
+
+// PushConfiguration is the configuration to push metrics to a
+// Pushgateway.
+type PushConfiguration struct {
+	// URL is the URL of the Pushgateway. Metrics are not pushed when
+	// empty.
+	URL string `validate:"omitempty,url"`
+	// Job is the name of the job to use. When empty, it defaults to
+	// the name of the service.
+	Job string
+	// Interval is the interval between two pushes.
+	Interval time.Duration `validate:"min=1s"`
+	// Grouping are additional labels to group metrics. The
+	// "instance" label defaults to the hostname.
+	Grouping map[string]string
+}
 
 // DefaultConfiguration is the default metrics configuration.
 func DefaultConfiguration() Configuration {
-	return Configuration{}
+	return Configuration{
+		MaxExporters: 1000,
+		Push: PushConfiguration{
+			Interval: 30 * time.Second,
+		},
+	}
 }
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"akvorado/common/reporter/logger"
+)
+
+// OverflowLabel is the label value used once the maximum number of
+// distinct values for a label is reached.
+const OverflowLabel = "other"
+
+// labelLimiter limits the number of distinct values for a label. Once
+// the limit is reached, new values are replaced by OverflowLabel.
+// Values are never forgotten.
+type labelLimiter struct {
+	logger logger.Logger
+	name   string
+	max    uint
+
+	lock   sync.RWMutex
+	values map[string]struct{}
+	warned bool
+
+	valuesGauge prometheus.Gauge
+	overflows   prometheus.Counter
+}
+
+func newLabelLimiter(l logger.Logger, registry *prometheus.Registry, name string, max uint) *labelLimiter {
+	ll := &labelLimiter{
+		logger: l,
+		name:   name,
+		max:    max,
+		values: make(map[string]struct{}),
+		valuesGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "akvorado_common_reporter_metrics_label_values",
+			Help:        "Number of distinct values for a limited label.",
+			ConstLabels: prometheus.Labels{"label": name},
+		}),
+		overflows: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "akvorado_common_reporter_metrics_label_overflows",
+			Help:        "Number of label values replaced because the limit was reached.",
+			ConstLabels: prometheus.Labels{"label": name},
+		}),
+	}
+	registry.MustRegister(ll.valuesGauge, ll.overflows)
+	return ll
+}
+
+// value returns the label value to use for the provided value.
+func (ll *labelLimiter) value(value string) string {
+	if ll.max == 0 {
+		return value
+	}
+	ll.lock.RLock()
+	_, ok := ll.values[value]
+	ll.lock.RUnlock()
+	if ok {
+		return value
+	}
+
+	ll.lock.Lock()
+	defer ll.lock.Unlock()
+	if _, ok := ll.values[value]; ok {
+		return value
+	}
+	if uint(len(ll.values)) >= ll.max {
+		ll.overflows.Inc()
+		if !ll.warned {
+			ll.warned = true
+			ll.logger.Warn().
+				Str("label", ll.name).
+				Uint("max", ll.max).
+				Msgf("too many distinct values for label, use %q for new ones", OverflowLabel)
+		}
+		return OverflowLabel
+	}
+	ll.values[value] = struct{}{}
+	ll.valuesGauge.Set(float64(len(ll.values)))
+	return value
+}
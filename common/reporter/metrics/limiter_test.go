@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metrics_test
+
+import (
+	"fmt"
+	"testing"
+
+	"akvorado/common/reporter/logger"
+	"akvorado/common/reporter/metrics"
+)
+
+func TestExporterLabel(t *testing.T) {
+	l, err := logger.New(logger.DefaultConfiguration())
+	if err != nil {
+		t.Fatalf("logger.New() err:\n%+v", err)
+	}
+	config := metrics.DefaultConfiguration()
+	config.MaxExporters = 3
+	m, err := metrics.New(l, config)
+	if err != nil {
+		t.Fatalf("metrics.New() err:\n%+v", err)
+	}
+
+	cases := []struct {
+		exporter string
+		expected string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.2", "192.0.2.2"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.3", "192.0.2.3"},
+		{"192.0.2.4", metrics.OverflowLabel},
+		{"192.0.2.5", metrics.OverflowLabel},
+		{"192.0.2.2", "192.0.2.2"},
+	}
+	for _, tc := range cases {
+		if got := m.ExporterLabel(tc.exporter); got != tc.expected {
+			t.Errorf("ExporterLabel(%q) == %q, expected %q", tc.exporter, got, tc.expected)
+		}
+	}
+
+	// Without limit
+	config.MaxExporters = 0
+	m, err = metrics.New(l, config)
+	if err != nil {
+		t.Fatalf("metrics.New() err:\n%+v", err)
+	}
+	for i := 0; i < 100; i++ {
+		exporter := fmt.Sprintf("192.0.2.%d", i)
+		if got := m.ExporterLabel(exporter); got != exporter {
+			t.Fatalf("ExporterLabel(%q) == %q, expected %q", exporter, got, exporter)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Start starts pushing metrics to the Pushgateway, if configured.
+func (m *Metrics) Start() error {
+	config := m.config.Push
+	if config.URL == "" {
+		return nil
+	}
+	job := config.Job
+	if job == "" {
+		job = "akvorado"
+	}
+	pusher := push.New(config.URL, job).
+		Gatherer(m.registry).
+		Client(&http.Client{Timeout: config.Interval})
+	if _, ok := config.Grouping["instance"]; !ok {
+		if hostname, err := os.Hostname(); err == nil {
+			pusher = pusher.Grouping("instance", hostname)
+		}
+	}
+	for name, value := range config.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+
+	m.logger.Info().Str("url", config.URL).Str("job", job).Msg("push metrics to Pushgateway")
+	m.t.Go(func() error {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.t.Dying():
+				// Push one last time
+				ctx, cancel := context.WithTimeout(context.Background(), config.Interval)
+				defer cancel()
+				if err := pusher.PushContext(ctx); err != nil {
+					m.logger.Err(err).Msg("unable to push metrics")
+				}
+				return nil
+			case <-ticker.C:
+				if err := pusher.PushContext(m.t.Context(nil)); err != nil {
+					m.logger.Err(err).Msg("unable to push metrics")
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops pushing metrics. Metrics are pushed one last time.
+func (m *Metrics) Stop() error {
+	if m.config.Push.URL == "" {
+		return nil
+	}
+	m.t.Kill(nil)
+	return m.t.Wait()
+}
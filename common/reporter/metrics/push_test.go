@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"akvorado/common/reporter/logger"
+	"akvorado/common/reporter/metrics"
+)
+
+func TestPush(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		paths  []string
+		bodies []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		bodies = append(bodies, string(body))
+		lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	l, err := logger.New(logger.DefaultConfiguration())
+	if err != nil {
+		t.Fatalf("logger.New() err:\n%+v", err)
+	}
+	config := metrics.DefaultConfiguration()
+	config.Push.URL = server.URL
+	config.Push.Job = "akvorado-test"
+	config.Push.Interval = 20 * time.Millisecond
+	config.Push.Grouping = map[string]string{"instance": "test1"}
+	m, err := metrics.New(l, config)
+	if err != nil {
+		t.Fatalf("metrics.New() err:\n%+v", err)
+	}
+	m.Factory(0).NewCounter(prometheus.CounterOpts{
+		Name: "counter1",
+		Help: "Some counter",
+	}).Add(18)
+
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	time.Sleep(70 * time.Millisecond)
+	if err := m.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(paths) < 2 {
+		t.Fatalf("Pushgateway got %d requests, expected at least 2", len(paths))
+	}
+	for idx, path := range paths {
+		if path != "PUT /metrics/job/akvorado-test/instance/test1" {
+			t.Errorf("Pushgateway got request %q", path)
+		}
+		if !strings.Contains(bodies[idx], "akvorado_common_reporter_metrics_test_counter1") {
+			t.Errorf("Pushgateway did not get counter1")
+		}
+	}
+}
+
+func TestPushDisabled(t *testing.T) {
+	l, err := logger.New(logger.DefaultConfiguration())
+	if err != nil {
+		t.Fatalf("logger.New() err:\n%+v", err)
+	}
+	m, err := metrics.New(l, metrics.DefaultConfiguration())
+	if err != nil {
+		t.Fatalf("metrics.New() err:\n%+v", err)
+	}
+	if err := m.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	if err := m.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/tomb.v2"
 
 	"akvorado/common/reporter/logger"
 	"akvorado/common/reporter/stack"
@@ -27,10 +28,13 @@ type Metrics struct {
 	registry         *prometheus.Registry
 	factoryCache     map[string]*Factory
 	factoryCacheLock sync.RWMutex
+	exporters        *labelLimiter
+	t                tomb.Tomb
 }
 
 // New creates a new metric registry and setup the appropriate
 // exporters. The provided prefix is used for system-wide metrics.
+// Metrics are pushed to a Pushgateway only once started.
 func New(logger logger.Logger, configuration Configuration) (*Metrics, error) {
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
@@ -42,10 +46,18 @@ func New(logger logger.Logger, configuration Configuration) (*Metrics, error) {
 		registry:     reg,
 		factoryCache: make(map[string]*Factory, 0),
 	}
+	m.exporters = newLabelLimiter(logger, reg, "exporter", configuration.MaxExporters)
 
 	return &m, nil
 }
 
+// ExporterLabel returns the label value to use for the provided
+// exporter. Once the maximum number of exporters is reached, new
+// exporters are replaced by OverflowLabel.
+func (m *Metrics) ExporterLabel(exporter string) string {
+	return m.exporters.value(exporter)
+}
+
 // HTTPHandler returns an handler to server Prometheus metrics.
 func (m *Metrics) HTTPHandler() http.Handler {
 	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
@@ -72,6 +72,12 @@ func TestNew(t *testing.T) {
 		gotFiltered = append(gotFiltered, line)
 	}
 	expected := []string{
+		"# HELP akvorado_common_reporter_metrics_label_overflows Number of label values replaced because the limit was reached.",
+		"# TYPE akvorado_common_reporter_metrics_label_overflows counter",
+		`akvorado_common_reporter_metrics_label_overflows{label="exporter"} 0`,
+		"# HELP akvorado_common_reporter_metrics_label_values Number of distinct values for a limited label.",
+		"# TYPE akvorado_common_reporter_metrics_label_values gauge",
+		`akvorado_common_reporter_metrics_label_values{label="exporter"} 0`,
 		"# HELP akvorado_common_reporter_metrics_test_counter1 Some counter",
 		"# TYPE akvorado_common_reporter_metrics_test_counter1 counter",
 		"akvorado_common_reporter_metrics_test_counter1 18",
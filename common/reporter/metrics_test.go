@@ -195,3 +195,23 @@ func TestMetricCollector(t *testing.T) {
 		t.Fatalf("subsetted metrics (-got, +want):\n%s", diff)
 	}
 }
+
+func TestExporterLabelMetrics(t *testing.T) {
+	config := reporter.DefaultConfiguration()
+	config.Metrics.MaxExporters = 1
+	r, err := reporter.New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	r.ExporterLabel("192.0.2.1")
+	r.ExporterLabel("192.0.2.2")
+	r.ExporterLabel("192.0.2.3")
+	gotMetrics := r.GetMetrics("akvorado_common_reporter_metrics_label_")
+	expectedMetrics := map[string]string{
+		`overflows{label="exporter"}`: "2",
+		`values{label="exporter"}`:    "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
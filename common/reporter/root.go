@@ -3,14 +3,22 @@
 
 // Package reporter is a façade for reporting duties in akvorado.
 //
-// Such a façade currently includes logging and metrics.
+// Such a façade currently includes logging, metrics, tracing and
+// crash reporting.
 package reporter
 
 import (
+	"context"
 	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/reporter/crash"
 	"akvorado/common/reporter/logger"
 	"akvorado/common/reporter/metrics"
+	"akvorado/common/reporter/tracing"
 )
 
 // Reporter contains the state for a reporter. It also supports the
@@ -18,9 +26,16 @@ import (
 type Reporter struct {
 	logger.Logger
 	metrics *metrics.Metrics
+	tracing *tracing.Tracing
+	crash   *crash.Crash
 
 	healthchecks     map[string]HealthcheckFunc
+	readinessChecks  map[string]HealthcheckFunc
 	healthchecksLock sync.Mutex
+	healthcheckGauge *prometheus.GaugeVec
+
+	t       tomb.Tomb
+	started bool
 }
 
 // New creates a new reporter from a configuration.
@@ -36,9 +51,54 @@ func New(config Configuration) (*Reporter, error) {
 		return nil, err
 	}
 
-	return &Reporter{
-		Logger:       l,
-		metrics:      m,
-		healthchecks: make(map[string]HealthcheckFunc),
-	}, nil
+	t, err := tracing.New(config.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := crash.New(config.Crash)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Reporter{
+		Logger:           l,
+		metrics:          m,
+		tracing:          t,
+		crash:            c,
+		healthchecks:     make(map[string]HealthcheckFunc),
+		readinessChecks:  make(map[string]HealthcheckFunc),
+		healthcheckGauge: newHealthcheckGauge(),
+	}
+	m.Collector(r.healthcheckGauge)
+	return &r, nil
+}
+
+// Start starts the reporter. Healthchecks are run periodically to
+// update the healthcheck metric and metrics are pushed to the
+// Pushgateway, if configured.
+func (r *Reporter) Start() error {
+	r.started = true
+	r.t.Go(r.runHealthchecksPeriodically)
+	return r.metrics.Start()
+}
+
+// Stop stops the reporter. Metrics are pushed one last time and
+// pending traces and crash reports are flushed.
+func (r *Reporter) Stop() error {
+	if r.started {
+		r.t.Kill(nil)
+		if err := r.t.Wait(); err != nil {
+			return err
+		}
+		if err := r.metrics.Stop(); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.crash.Shutdown(ctx); err != nil {
+		return err
+	}
+	return r.tracing.Shutdown(ctx)
 }
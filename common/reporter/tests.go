@@ -9,10 +9,14 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"akvorado/common/reporter/tracing"
 )
 
 // NewMock creates a new reporter for tests. Currently, this is the same as a production reporter.
-func NewMock(t *testing.T) *Reporter {
+func NewMock(t testing.TB) *Reporter {
 	t.Helper()
 	r, err := New(Configuration{})
 	if err != nil {
@@ -21,6 +25,16 @@ func NewMock(t *testing.T) *Reporter {
 	return r
 }
 
+// NewMockWithTracing creates a new reporter for tests. All traces are
+// sampled and recorded in the returned span recorder.
+func NewMockWithTracing(t *testing.T) (*Reporter, *tracetest.SpanRecorder) {
+	t.Helper()
+	r := NewMock(t)
+	tr, recorder := tracing.NewMock()
+	r.tracing = tr
+	return r, recorder
+}
+
 // GetMetrics returns a map from metric name to its value (as a
 // string). It keeps only metrics matching the provided prefix.
 func (r *Reporter) GetMetrics(prefix string, subset ...string) map[string]string {
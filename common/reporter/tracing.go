@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Tracing façade for reporter.
+
+package reporter
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"akvorado/common/reporter/stack"
+)
+
+// Tracer returns a tracer for the current module. When tracing is not
+// enabled, the spans are not recorded.
+func (r *Reporter) Tracer() trace.Tracer {
+	callStack := stack.Callers()
+	module := strings.SplitN(callStack[1].FunctionName(), ".", 2)[0]
+	return r.tracing.Tracer(module)
+}
+
+// StartChildSpan starts a new span with the provided tracer only when
+// the context already contains a sampled span. Otherwise, the returned
+// span does nothing. This is useful to not start new traces for
+// unsampled flows.
+func StartChildSpan(ctx context.Context, tracer trace.Tracer, name string, opts ...trace.SpanStartOption) trace.Span {
+	if !trace.SpanContextFromContext(ctx).IsSampled() {
+		return trace.SpanFromContext(ctx)
+	}
+	_, span := tracer.Start(ctx, name, opts...)
+	return span
+}
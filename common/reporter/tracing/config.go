@@ -0,0 +1,22 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tracing
+
+// Configuration is the configuration for tracing.
+type Configuration struct {
+	// Endpoint is the address of the OTLP/gRPC collector to send
+	// traces to. Tracing is disabled when empty.
+	Endpoint string
+	// Insecure disables TLS when connecting to the collector.
+	Insecure bool
+	// SampleRatio is the ratio of traces to keep.
+	SampleRatio float64 `validate:"min=0,max=1"`
+}
+
+// DefaultConfiguration is the default tracing configuration.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		SampleRatio: 0.001,
+	}
+}
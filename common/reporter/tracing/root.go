@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package tracing handles traces for akvorado.
+//
+// This is a wrapper around OpenTelemetry. Traces are exported to an
+// OTLP collector using gRPC.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing represents the internal state of the tracing subsystem.
+type Tracing struct {
+	provider trace.TracerProvider
+	shutdown func(context.Context) error
+}
+
+// New creates a new tracer provider exporting traces to the
+// configured collector. When no collector is configured, the returned
+// tracers do nothing.
+func New(configuration Configuration) (*Tracing, error) {
+	if configuration.Endpoint == "" {
+		return &Tracing{
+			provider: trace.NewNoopTracerProvider(),
+			shutdown: func(context.Context) error { return nil },
+		}, nil
+	}
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(configuration.Endpoint)}
+	if configuration.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP exporter: %w", err)
+	}
+	return newTracing(
+		sdktrace.ParentBased(sdktrace.TraceIDRatioBased(configuration.SampleRatio)),
+		sdktrace.NewBatchSpanProcessor(exporter)), nil
+}
+
+// newTracing creates a new tracer provider using the provided sampler
+// and span processor.
+func newTracing(sampler sdktrace.Sampler, processor sdktrace.SpanProcessor) *Tracing {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String("akvorado"))),
+	)
+	return &Tracing{
+		provider: provider,
+		shutdown: provider.Shutdown,
+	}
+}
+
+// Tracer returns a tracer for the provided module.
+func (t *Tracing) Tracer(module string) trace.Tracer {
+	return t.provider.Tracer(module)
+}
+
+// Shutdown flushes the pending spans and stops the exporter.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
@@ -0,0 +1,18 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//go:build !release
+
+package tracing
+
+import (
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// NewMock creates a new tracer provider sampling all traces and
+// recording them in the returned span recorder.
+func NewMock() (*Tracing, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return newTracing(sdktrace.AlwaysSample(), recorder), recorder
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package reporter_test
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/reporter"
+)
+
+func TestTracer(t *testing.T) {
+	r, recorder := reporter.NewMockWithTracing(t)
+	_, span := r.Tracer().Start(context.Background(), "hello")
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Ended() got %d spans, expected 1", len(spans))
+	}
+	if got := spans[0].Name(); got != "hello" {
+		t.Errorf("Name() == %q, expected %q", got, "hello")
+	}
+	if got := spans[0].InstrumentationLibrary().Name; got != "akvorado/common/reporter_test" {
+		t.Errorf("InstrumentationLibrary().Name == %q, expected %q", got, "akvorado/common/reporter_test")
+	}
+	if err := r.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+}
+
+func TestTracerDisabled(t *testing.T) {
+	r := reporter.NewMock(t)
+	_, span := r.Tracer().Start(context.Background(), "hello")
+	defer span.End()
+	if span.SpanContext().IsSampled() {
+		t.Fatal("SpanContext().IsSampled() == true, expected false")
+	}
+	if err := r.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+}
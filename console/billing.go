@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+// billingInterval is the usual interval used for percentile-based
+// billing.
+const billingInterval = 5 * time.Minute
+
+// billingHandlerParameters describes the query string for the
+// /billing endpoint.
+type billingHandlerParameters struct {
+	Start      time.Time     `form:"start"`
+	End        time.Time     `form:"end"`
+	Period     time.Duration `form:"period" binding:"isdefault|min=1h"`
+	Percentile float64       `form:"percentile" binding:"isdefault|gt=0,lte=100"`
+	Filter     string        `form:"filter"`
+	Units      string        `form:"units" binding:"isdefault|oneof=l2bps l3bps"`
+}
+
+// billingHandlerInput describes the input for the /billing endpoint
+// once parsed.
+type billingHandlerInput struct {
+	Start      time.Time
+	End        time.Time
+	Percentile float64
+	Filter     queryFilter
+	Units      string
+}
+
+// billingResult is the percentile for a billing group.
+type billingResult struct {
+	Name     string  `json:"name" ch:"name"`
+	In       float64 `json:"in" ch:"inbound"`
+	Out      float64 `json:"out" ch:"outbound"`
+	Billable float64 `json:"billable" ch:"billable"`
+}
+
+// toInput converts the query string to an input for the /billing
+// endpoint. When not specified, the end is now and the start is one
+// period (30 days by default) before.
+func (params billingHandlerParameters) toInput(now time.Time) (billingHandlerInput, error) {
+	input := billingHandlerInput{
+		Start:      params.Start,
+		End:        params.End,
+		Percentile: params.Percentile,
+		Units:      params.Units,
+	}
+	if err := input.Filter.UnmarshalText([]byte(params.Filter)); err != nil {
+		return input, err
+	}
+	if input.Percentile == 0 {
+		input.Percentile = 95
+	}
+	if input.Units == "" {
+		input.Units = "l2bps"
+	}
+	if input.End.IsZero() {
+		input.End = now
+	}
+	if input.Start.IsZero() {
+		period := params.Period
+		if period == 0 {
+			period = 30 * 24 * time.Hour
+		}
+		input.Start = input.End.Add(-period)
+	}
+	if !input.End.After(input.Start) {
+		return input, errors.New("end should be after start")
+	}
+	return input, nil
+}
+
+// toSQL converts a billing query to an SQL request. The rate of each
+// billing group is computed for each interval, in both directions.
+// Intervals without traffic are accounted as 0 before computing the
+// percentile.
+func (input billingHandlerInput) toSQL() string {
+	points := uint(input.End.Sub(input.Start) / billingInterval)
+	if points == 0 {
+		points = 1
+	}
+	percentile := fmt.Sprintf("quantileExact(%g)", input.Percentile/100)
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+WITH
+ intDiv(dateDiff('second', {{ .TimefilterStart }}, {{ .TimefilterEnd }}), {{ .Interval }}) AS intervals,
+ groupArrayIf(xps, direction = 'in') AS xpsIn,
+ groupArrayIf(xps, direction = 'out') AS xpsOut
+SELECT
+ name,
+ arrayReduce('%s', arrayResize(xpsIn, greatest(intervals, length(xpsIn)), 0)) AS inbound,
+ arrayReduce('%s', arrayResize(xpsOut, greatest(intervals, length(xpsOut)), 0)) AS outbound,
+ greatest(inbound, outbound) AS billable
+FROM (
+ SELECT
+  {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+  arrayJoin([('in', InIfBillingGroup), ('out', OutIfBillingGroup)]) AS directedGroup,
+  directedGroup.1 AS direction,
+  directedGroup.2 AS name,
+  {{ .Units }}/{{ .Interval }} AS xps
+ FROM {{ .Table }}
+ WHERE %s
+ GROUP BY time, direction, name
+ HAVING name != ''
+)
+GROUP BY name
+ORDER BY name
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             input.Start,
+			End:               input.End,
+			MainTableRequired: input.Filter.MainTableRequired,
+			Points:            points,
+			Units:             input.Units,
+		}),
+		percentile, percentile,
+		templateWhere(input.Filter))
+	return strings.TrimSpace(sqlQuery)
+}
+
+func (c *Component) billingHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	var params billingHandlerParameters
+	if err := gc.ShouldBindQuery(&params); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	input, err := params.toInput(c.d.Clock.Now())
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+
+	sqlQuery := c.finalizeQuery(input.toSQL())
+	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
+
+	results := []billingResult{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+		c.r.Err(err).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{
+		"start":      input.Start,
+		"end":        input.End,
+		"percentile": input.Percentile,
+		"billing":    results,
+	})
+}
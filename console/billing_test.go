@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+
+	"akvorado/common/helpers"
+)
+
+func TestBillingInput(t *testing.T) {
+	now := time.Date(2022, 04, 11, 15, 45, 10, 0, time.UTC)
+	cases := []struct {
+		Description string
+		Params      billingHandlerParameters
+		Expected    billingHandlerInput
+		Error       bool
+	}{
+		{
+			Description: "defaults",
+			Params:      billingHandlerParameters{},
+			Expected: billingHandlerInput{
+				Start:      time.Date(2022, 03, 12, 15, 45, 10, 0, time.UTC),
+				End:        now,
+				Percentile: 95,
+				Units:      "l2bps",
+			},
+		}, {
+			Description: "custom period, percentile and filter",
+			Params: billingHandlerParameters{
+				Period:     7 * 24 * time.Hour,
+				Percentile: 99,
+				Filter:     "InIfBoundary = external",
+				Units:      "l3bps",
+			},
+			Expected: billingHandlerInput{
+				Start:      time.Date(2022, 04, 04, 15, 45, 10, 0, time.UTC),
+				End:        now,
+				Percentile: 99,
+				Filter: queryFilter{
+					Filter:        "InIfBoundary = 'external'",
+					ReverseFilter: "OutIfBoundary = 'external'",
+				},
+				Units: "l3bps",
+			},
+		}, {
+			Description: "invalid filter",
+			Params:      billingHandlerParameters{Filter: "SrcAS ="},
+			Error:       true,
+		}, {
+			Description: "end before start",
+			Params: billingHandlerParameters{
+				Start: now,
+				End:   now.Add(-time.Hour),
+			},
+			Error: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got, err := tc.Params.toInput(now)
+			if err != nil && !tc.Error {
+				t.Fatalf("toInput() error:\n%+v", err)
+			} else if err == nil && tc.Error {
+				t.Fatal("toInput() did not error")
+			} else if err != nil {
+				return
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("toInput() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBillingQuerySQL(t *testing.T) {
+	input := billingHandlerInput{
+		Start:      time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
+		End:        time.Date(2022, 04, 11, 15, 45, 10, 0, time.UTC),
+		Percentile: 95,
+		Filter:     queryFilter{Filter: "DstCountry = 'FR'"},
+		Units:      "l2bps",
+	}
+	expected := `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":288,"units":"l2bps"}@@ }}
+WITH
+ intDiv(dateDiff('second', {{ .TimefilterStart }}, {{ .TimefilterEnd }}), {{ .Interval }}) AS intervals,
+ groupArrayIf(xps, direction = 'in') AS xpsIn,
+ groupArrayIf(xps, direction = 'out') AS xpsOut
+SELECT
+ name,
+ arrayReduce('quantileExact(0.95)', arrayResize(xpsIn, greatest(intervals, length(xpsIn)), 0)) AS inbound,
+ arrayReduce('quantileExact(0.95)', arrayResize(xpsOut, greatest(intervals, length(xpsOut)), 0)) AS outbound,
+ greatest(inbound, outbound) AS billable
+FROM (
+ SELECT
+  {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+  arrayJoin([('in', InIfBillingGroup), ('out', OutIfBillingGroup)]) AS directedGroup,
+  directedGroup.1 AS direction,
+  directedGroup.2 AS name,
+  {{ .Units }}/{{ .Interval }} AS xps
+ FROM {{ .Table }}
+ WHERE {{ .Timefilter }} AND (DstCountry = 'FR')
+ GROUP BY time, direction, name
+ HAVING name != ''
+)
+GROUP BY name
+ORDER BY name
+{{ end }}`
+	expected = strings.TrimSpace(strings.ReplaceAll(expected, "@@", "`"))
+	if diff := helpers.Diff(input.toSQL(), expected); diff != "" {
+		t.Errorf("toSQL (-got, +want):\n%s", diff)
+	}
+}
+
+func TestBillingHandler(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	expected := []billingResult{
+		{"peering", 4000, 12000, 12000},
+		{"transit", 1500, 8000, 8000},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expected).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "billing for one day",
+			URL:         "/api/v0/console/billing?start=2022-04-10T15:45:10Z&end=2022-04-11T15:45:10Z",
+			JSONOutput: gin.H{
+				"start":      "2022-04-10T15:45:10Z",
+				"end":        "2022-04-11T15:45:10Z",
+				"percentile": 95,
+				"billing": []gin.H{
+					{"name": "peering", "in": 4000, "out": 12000, "billable": 12000},
+					{"name": "transit", "in": 1500, "out": 8000, "billable": 8000},
+				},
+			},
+		}, {
+			Description: "invalid percentile",
+			URL:         "/api/v0/console/billing?percentile=101",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Key: 'billingHandlerParameters.Percentile' Error:Field validation for 'Percentile' failed on the 'lte' tag",
+			},
+		}, {
+			Description: "invalid units",
+			URL:         "/api/v0/console/billing?units=pps",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Key: 'billingHandlerParameters.Units' Error:Field validation for 'Units' failed on the 'isdefault|oneof=l2bps l3bps' tag",
+			},
+		},
+	})
+}
@@ -18,6 +18,9 @@ type flowsTable struct {
 	Name       string
 	Resolution time.Duration
 	Oldest     time.Time
+	// Columns lists the columns usually only present in the main
+	// table that are also present in this consolidated table.
+	Columns []string
 }
 
 // refreshFlowsTables refreshes the information we have about flows
@@ -39,6 +42,26 @@ AND engine LIKE '%MergeTree'
 		return fmt.Errorf("cannot query flows table metadata: %w", err)
 	}
 
+	// Get additional dimensions of consolidated tables
+	var columns []struct {
+		Table string `ch:"table"`
+		Name  string `ch:"name"`
+	}
+	err = c.d.ClickHouseDB.Select(ctx, &columns, fmt.Sprintf(`
+SELECT table, name
+FROM system.columns
+WHERE database=currentDatabase()
+AND table LIKE 'flows_%%'
+AND name IN ('%s')
+`, strings.Join(queryColumnsRequiringMainTable.names(), "', '")))
+	if err != nil {
+		return fmt.Errorf("cannot query flows table columns: %w", err)
+	}
+	tableColumns := map[string][]string{}
+	for _, column := range columns {
+		tableColumns[column.Table] = append(tableColumns[column.Table], column.Name)
+	}
+
 	newFlowsTables := []flowsTable{}
 	for _, table := range tables {
 		// Parse resolution
@@ -65,6 +88,7 @@ AND engine LIKE '%MergeTree'
 			Name:       table.Name,
 			Resolution: resolution,
 			Oldest:     oldest[0].T,
+			Columns:    tableColumns[table.Name],
 		})
 	}
 	if len(newFlowsTables) == 0 {
@@ -100,6 +124,7 @@ type inputContext struct {
 	End               time.Time  `json:"end"`
 	StartForInterval  *time.Time `json:"start-for-interval,omitempty"`
 	MainTableRequired bool       `json:"main-table-required,omitempty"`
+	Columns           []string   `json:"columns,omitempty"`
 	Points            uint       `json:"points"`
 	Units             string     `json:"units,omitempty"`
 }
@@ -153,9 +178,9 @@ func (c *Component) contextFunc(inputStr string) context {
 	if input.MainTableRequired {
 		targetIntervalForTableSelection = time.Second
 	}
-	table, computedInterval := c.getBestTable(input.Start, targetIntervalForTableSelection)
+	table, computedInterval := c.getBestTable(input.Start, targetIntervalForTableSelection, input.Columns)
 	if input.StartForInterval != nil {
-		_, computedInterval = c.getBestTable(*input.StartForInterval, targetIntervalForTableSelection)
+		_, computedInterval = c.getBestTable(*input.StartForInterval, targetIntervalForTableSelection, input.Columns)
 	}
 
 	// Make start/end match the computed interval (currently equal to the table resolution)
@@ -209,19 +234,42 @@ func (c *Component) contextFunc(inputStr string) context {
 	}
 }
 
-// Get the best table starting at the specified time.
-func (c *Component) getBestTable(start time.Time, targetInterval time.Duration) (string, time.Duration) {
+// Get the best table starting at the specified time and containing
+// the provided columns.
+func (c *Component) getBestTable(start time.Time, targetInterval time.Duration, columns []string) (string, time.Duration) {
 	c.flowsTablesLock.RLock()
 	defer c.flowsTablesLock.RUnlock()
 
+	// Only keep tables with the requested columns. The main table
+	// has all of them.
+	flowsTables := []flowsTable{}
+outer:
+	for _, table := range c.flowsTables {
+		if table.Resolution != 0 {
+			for _, column := range columns {
+				found := false
+				for _, tableColumn := range table.Columns {
+					if tableColumn == column {
+						found = true
+						break
+					}
+				}
+				if !found {
+					continue outer
+				}
+			}
+		}
+		flowsTables = append(flowsTables, table)
+	}
+
 	table := "flows"
 	computedInterval := time.Second
-	if len(c.flowsTables) > 0 {
+	if len(flowsTables) > 0 {
 		// We can use the consolidated data. The first
 		// criteria is to find the tables matching the time
 		// criteria.
 		candidates := []int{}
-		for idx, table := range c.flowsTables {
+		for idx, table := range flowsTables {
 			if start.After(table.Oldest.Add(table.Resolution)) {
 				candidates = append(candidates, idx)
 			}
@@ -229,18 +277,18 @@ func (c *Component) getBestTable(start time.Time, targetInterval time.Duration)
 		if len(candidates) == 0 {
 			// No candidate, fallback to the one with oldest data
 			best := 0
-			for idx, table := range c.flowsTables {
-				if c.flowsTables[best].Oldest.After(table.Oldest.Add(table.Resolution)) {
+			for idx, table := range flowsTables {
+				if flowsTables[best].Oldest.After(table.Oldest.Add(table.Resolution)) {
 					best = idx
 				}
 			}
 			candidates = []int{best}
 			// Add other candidates that are not far off in term of oldest data
-			for idx, table := range c.flowsTables {
+			for idx, table := range flowsTables {
 				if idx == best {
 					continue
 				}
-				if c.flowsTables[best].Oldest.After(table.Oldest) {
+				if flowsTables[best].Oldest.After(table.Oldest) {
 					candidates = append(candidates, idx)
 				}
 			}
@@ -249,17 +297,17 @@ func (c *Component) getBestTable(start time.Time, targetInterval time.Duration)
 			// Use interval to find the best one
 			best := 0
 			for _, idx := range candidates {
-				if c.flowsTables[idx].Resolution > targetInterval {
+				if flowsTables[idx].Resolution > targetInterval {
 					continue
 				}
-				if c.flowsTables[idx].Resolution > c.flowsTables[best].Resolution {
+				if flowsTables[idx].Resolution > flowsTables[best].Resolution {
 					best = idx
 				}
 			}
 			candidates = []int{best}
 		}
-		table = c.flowsTables[candidates[0]].Name
-		computedInterval = c.flowsTables[candidates[0]].Resolution
+		table = flowsTables[candidates[0]].Name
+		computedInterval = flowsTables[candidates[0]].Resolution
 	}
 	if computedInterval < time.Second {
 		computedInterval = time.Second
@@ -32,6 +32,22 @@ AND engine LIKE '%MergeTree'
 			{"flows_1m0s"},
 			{"flows_5m0s"},
 		})
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), `
+SELECT table, name
+FROM system.columns
+WHERE database=currentDatabase()
+AND table LIKE 'flows_%'
+AND name IN ('DstASPath', 'DstAddr', 'DstCommunities', 'DstCommunityNames', 'DstPort', 'ScanSuspect', 'SrcAddr', 'SrcPort')
+`).
+		Return(nil).
+		SetArg(1, []struct {
+			Table string `ch:"table"`
+			Name  string `ch:"name"`
+		}{
+			{"flows_5m0s", "SrcPort"},
+			{"flows_5m0s", "DstPort"},
+		})
 	mockConn.EXPECT().
 		Select(gomock.Any(), gomock.Any(), `SELECT MIN(TimeReceived) AS t FROM flows`).
 		Return(nil).
@@ -61,10 +77,10 @@ AND engine LIKE '%MergeTree'
 	}
 
 	expected := []flowsTable{
-		{"flows", time.Duration(0), time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC)},
-		{"flows_1h0m0s", time.Hour, time.Date(2022, 01, 10, 15, 45, 10, 0, time.UTC)},
-		{"flows_1m0s", time.Minute, time.Date(2022, 04, 20, 15, 45, 10, 0, time.UTC)},
-		{"flows_5m0s", 5 * time.Minute, time.Date(2022, 02, 10, 15, 45, 10, 0, time.UTC)},
+		{"flows", time.Duration(0), time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC), nil},
+		{"flows_1h0m0s", time.Hour, time.Date(2022, 01, 10, 15, 45, 10, 0, time.UTC), nil},
+		{"flows_1m0s", time.Minute, time.Date(2022, 04, 20, 15, 45, 10, 0, time.UTC), nil},
+		{"flows_5m0s", 5 * time.Minute, time.Date(2022, 02, 10, 15, 45, 10, 0, time.UTC), []string{"SrcPort", "DstPort"}},
 	}
 	if diff := helpers.Diff(c.flowsTables, expected); diff != "" {
 		t.Fatalf("refreshFlowsTables() diff:\n%s", diff)
@@ -100,7 +116,7 @@ func TestFinalizeQuery(t *testing.T) {
 			Expected: "SELECT TimeReceived, SrcPort FROM flows WHERE TimeReceived BETWEEN toDateTime('2022-04-10 15:45:10', 'UTC') AND toDateTime('2022-04-11 15:45:10', 'UTC')",
 		}, {
 			Description: "only flows table available",
-			Tables:      []flowsTable{{"flows", 0, time.Date(2022, 03, 10, 15, 45, 10, 0, time.UTC)}},
+			Tables:      []flowsTable{{"flows", 0, time.Date(2022, 03, 10, 15, 45, 10, 0, time.UTC), nil}},
 			Query:       "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }}",
 			Context: inputContext{
 				Start:  time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
@@ -110,7 +126,7 @@ func TestFinalizeQuery(t *testing.T) {
 			Expected: "SELECT 1 FROM flows WHERE TimeReceived BETWEEN toDateTime('2022-04-10 15:45:10', 'UTC') AND toDateTime('2022-04-11 15:45:10', 'UTC')",
 		}, {
 			Description: "timefilter.Start and timefilter.Stop",
-			Tables:      []flowsTable{{"flows", 0, time.Date(2022, 03, 10, 15, 45, 10, 0, time.UTC)}},
+			Tables:      []flowsTable{{"flows", 0, time.Date(2022, 03, 10, 15, 45, 10, 0, time.UTC), nil}},
 			Query:       "SELECT {{ .TimefilterStart }}, {{ .TimefilterEnd }}",
 			Context: inputContext{
 				Start:  time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
@@ -120,7 +136,7 @@ func TestFinalizeQuery(t *testing.T) {
 			Expected: "SELECT toDateTime('2022-04-10 15:45:10', 'UTC'), toDateTime('2022-04-11 15:45:10', 'UTC')",
 		}, {
 			Description: "only flows table and out of range request",
-			Tables:      []flowsTable{{"flows", 0, time.Date(2022, 04, 10, 22, 45, 10, 0, time.UTC)}},
+			Tables:      []flowsTable{{"flows", 0, time.Date(2022, 04, 10, 22, 45, 10, 0, time.UTC), nil}},
 			Query:       "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }}",
 			Context: inputContext{
 				Start:  time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
@@ -131,8 +147,8 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "select consolidated table",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 03, 10, 22, 45, 10, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 03, 10, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }} // {{ .Interval }}",
 			Context: inputContext{
@@ -144,8 +160,8 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "select consolidated table out of range",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 04, 10, 22, 45, 10, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 04, 10, 17, 45, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 04, 10, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 04, 10, 17, 45, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }}",
 			Context: inputContext{
@@ -157,8 +173,8 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "select flows table out of range",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 04, 10, 16, 45, 10, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 04, 10, 17, 45, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 04, 10, 16, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 04, 10, 17, 45, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }}",
 			Context: inputContext{
@@ -170,8 +186,8 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "use flows table for resolution (control for next case)",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 04, 10, 10, 45, 10, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 03, 10, 10, 45, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 04, 10, 10, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 03, 10, 10, 45, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }} // {{ .Interval }}",
 			Context: inputContext{
@@ -183,8 +199,8 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "use flows table for resolution (but flows_1m0s for data)",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 04, 10, 10, 45, 10, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 03, 10, 10, 45, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 04, 10, 10, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 03, 10, 10, 45, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }} // {{ .Interval }}",
 			Context: inputContext{
@@ -200,8 +216,8 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "select flows table with better resolution",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 03, 10, 16, 45, 10, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 03, 10, 17, 45, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 03, 10, 16, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 03, 10, 17, 45, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }} // {{ .Interval }}",
 			Context: inputContext{
@@ -213,9 +229,9 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "select consolidated table with better resolution",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 03, 10, 22, 45, 10, 0, time.UTC)},
-				{"flows_5m0s", 5 * time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 03, 10, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_5m0s", 5 * time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }} // {{ .Interval }}",
 			Context: inputContext{
@@ -227,9 +243,9 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "select consolidated table with better range",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 04, 10, 22, 45, 10, 0, time.UTC)},
-				{"flows_5m0s", 5 * time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 04, 10, 22, 45, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 04, 10, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_5m0s", 5 * time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 04, 10, 22, 45, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }}",
 			Context: inputContext{
@@ -241,9 +257,9 @@ func TestFinalizeQuery(t *testing.T) {
 		}, {
 			Description: "select best resolution when equality for oldest data",
 			Tables: []flowsTable{
-				{"flows", 0, time.Date(2022, 04, 10, 22, 40, 55, 0, time.UTC)},
-				{"flows_1m0s", time.Minute, time.Date(2022, 04, 10, 22, 40, 00, 0, time.UTC)},
-				{"flows_1h0m0s", time.Hour, time.Date(2022, 04, 10, 22, 00, 10, 0, time.UTC)},
+				{"flows", 0, time.Date(2022, 04, 10, 22, 40, 55, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 04, 10, 22, 40, 00, 0, time.UTC), nil},
+				{"flows_1h0m0s", time.Hour, time.Date(2022, 04, 10, 22, 00, 10, 0, time.UTC), nil},
 			},
 			Query: "SELECT 1 FROM {{ .Table }} WHERE {{ .Timefilter }}",
 			Context: inputContext{
@@ -252,6 +268,36 @@ func TestFinalizeQuery(t *testing.T) {
 				Points: 720, // 2-minute resolution,
 			},
 			Expected: "SELECT 1 FROM flows_1m0s WHERE TimeReceived BETWEEN toDateTime('2022-04-10 15:46:00', 'UTC') AND toDateTime('2022-04-11 15:46:00', 'UTC')",
+		}, {
+			Description: "select consolidated table with requested columns",
+			Tables: []flowsTable{
+				{"flows", 0, time.Date(2022, 03, 10, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_5m0s", 5 * time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC), []string{"DstPort"}},
+			},
+			Query: "SELECT DstPort FROM {{ .Table }} WHERE {{ .Timefilter }}",
+			Context: inputContext{
+				Start:   time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
+				End:     time.Date(2022, 04, 11, 15, 45, 10, 0, time.UTC),
+				Points:  288, // 5-minute resolution
+				Columns: []string{"DstPort"},
+			},
+			Expected: "SELECT DstPort FROM flows_5m0s WHERE TimeReceived BETWEEN toDateTime('2022-04-10 15:45:00', 'UTC') AND toDateTime('2022-04-11 15:45:00', 'UTC')",
+		}, {
+			Description: "skip consolidated tables without requested columns",
+			Tables: []flowsTable{
+				{"flows", 0, time.Date(2022, 03, 10, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_1m0s", time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC), nil},
+				{"flows_5m0s", 5 * time.Minute, time.Date(2022, 04, 2, 22, 45, 10, 0, time.UTC), []string{"DstPort"}},
+			},
+			Query: "SELECT SrcPort FROM {{ .Table }} WHERE {{ .Timefilter }}",
+			Context: inputContext{
+				Start:   time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
+				End:     time.Date(2022, 04, 11, 15, 45, 10, 0, time.UTC),
+				Points:  288, // 5-minute resolution
+				Columns: []string{"SrcPort"},
+			},
+			Expected: "SELECT SrcPort FROM flows WHERE TimeReceived BETWEEN toDateTime('2022-04-10 15:45:10', 'UTC') AND toDateTime('2022-04-11 15:45:10', 'UTC')",
 		}, {
 			Description: "query with escaped template",
 			Query:       `SELECT TimeReceived, SrcPort WHERE InIfDescription = '{{"{{"}} hello }}'`,
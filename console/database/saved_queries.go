@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SavedQuery represents a saved query (the state of the visualize
+// page) in database.
+type SavedQuery struct {
+	ID          uint64          `json:"id"`
+	User        string          `gorm:"index" json:"user"`
+	Shared      bool            `json:"shared"`
+	Description string          `json:"description" binding:"required"`
+	Content     json.RawMessage `json:"content" binding:"required"`
+}
+
+// CreateSavedQuery creates a new saved query in database and returns
+// its ID.
+func (c *Component) CreateSavedQuery(ctx context.Context, q SavedQuery) (uint64, error) {
+	result := c.db.WithContext(ctx).Omit("ID").Create(&q)
+	if result.Error != nil {
+		return 0, fmt.Errorf("unable to create new saved query: %w", result.Error)
+	}
+	return q.ID, nil
+}
+
+// ListSavedQueries list all saved queries for the provided user
+func (c *Component) ListSavedQueries(ctx context.Context, user string) ([]SavedQuery, error) {
+	var results []SavedQuery
+	result := c.db.WithContext(ctx).
+		Where(&SavedQuery{User: user}).
+		Or(&SavedQuery{Shared: true}).
+		Find(&results)
+	if result.Error != nil {
+		return nil, fmt.Errorf("unable to retrieve saved queries: %w", result.Error)
+	}
+	return results, nil
+}
+
+// GetSavedQuery retrieves the saved query with the provided ID if it
+// belongs to the provided user or if it is shared.
+func (c *Component) GetSavedQuery(ctx context.Context, user string, id uint64) (SavedQuery, error) {
+	var results []SavedQuery
+	result := c.db.WithContext(ctx).
+		Where("id = ? AND (user = ? OR shared)", id, user).
+		Limit(1).
+		Find(&results)
+	if result.Error != nil {
+		return SavedQuery{}, fmt.Errorf("unable to retrieve saved query: %w", result.Error)
+	}
+	if len(results) == 0 {
+		return SavedQuery{}, errors.New("no matching saved query")
+	}
+	return results[0], nil
+}
+
+// DeleteSavedQuery deletes the provided saved query
+func (c *Component) DeleteSavedQuery(ctx context.Context, q SavedQuery) error {
+	result := c.db.WithContext(ctx).Where(&SavedQuery{User: q.User}).Delete(&q)
+	if result.Error != nil {
+		return fmt.Errorf("cannot delete saved query: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching saved query to delete")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestSavedQuery(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r)
+
+	// Create
+	id, err := c.CreateSavedQuery(context.Background(), SavedQuery{
+		ID:          17,
+		User:        "marty",
+		Shared:      false,
+		Description: "marty's query",
+		Content:     json.RawMessage(`{"dimensions":["SrcAS"]}`),
+	})
+	if err != nil {
+		t.Fatalf("CreateSavedQuery() error:\n%+v", err)
+	}
+	if id != 1 {
+		t.Fatalf("CreateSavedQuery() == %d, expected 1", id)
+	}
+	if _, err := c.CreateSavedQuery(context.Background(), SavedQuery{
+		User:        "judith",
+		Shared:      true,
+		Description: "judith's query",
+		Content:     json.RawMessage(`{"dimensions":["ExporterName"]}`),
+	}); err != nil {
+		t.Fatalf("CreateSavedQuery() error:\n%+v", err)
+	}
+	if _, err := c.CreateSavedQuery(context.Background(), SavedQuery{
+		User:        "judith",
+		Shared:      false,
+		Description: "judith's private query",
+		Content:     json.RawMessage(`{"dimensions":["DstAS"]}`),
+	}); err != nil {
+		t.Fatalf("CreateSavedQuery() error:\n%+v", err)
+	}
+
+	// List
+	got, err := c.ListSavedQueries(context.Background(), "marty")
+	if err != nil {
+		t.Fatalf("ListSavedQueries() error:\n%+v", err)
+	}
+	expected := []SavedQuery{
+		{
+			ID:          1,
+			User:        "marty",
+			Shared:      false,
+			Description: "marty's query",
+			Content:     json.RawMessage(`{"dimensions":["SrcAS"]}`),
+		}, {
+			ID:          2,
+			User:        "judith",
+			Shared:      true,
+			Description: "judith's query",
+			Content:     json.RawMessage(`{"dimensions":["ExporterName"]}`),
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListSavedQueries() (-got, +want):\n%s", diff)
+	}
+
+	// Get
+	query, err := c.GetSavedQuery(context.Background(), "marty", 2)
+	if err != nil {
+		t.Fatalf("GetSavedQuery() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(query, expected[1]); diff != "" {
+		t.Fatalf("GetSavedQuery() (-got, +want):\n%s", diff)
+	}
+	if _, err := c.GetSavedQuery(context.Background(), "marty", 3); err == nil {
+		t.Fatal("GetSavedQuery() no error for a private query of another user")
+	}
+	if _, err := c.GetSavedQuery(context.Background(), "judith", 3); err != nil {
+		t.Fatalf("GetSavedQuery() error:\n%+v", err)
+	}
+
+	// Delete
+	if err := c.DeleteSavedQuery(context.Background(), SavedQuery{ID: 2, User: "marty"}); err == nil {
+		t.Fatal("DeleteSavedQuery() no error for a query of another user")
+	}
+	if err := c.DeleteSavedQuery(context.Background(), SavedQuery{ID: 1, User: "marty"}); err != nil {
+		t.Fatalf("DeleteSavedQuery() error:\n%+v", err)
+	}
+	got, _ = c.ListSavedQueries(context.Background(), "marty")
+	if diff := helpers.Diff(got, expected[1:]); diff != "" {
+		t.Fatalf("ListSavedQueries() (-got, +want):\n%s", diff)
+	}
+}
@@ -11,10 +11,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"akvorado/common/filter"
 	"akvorado/common/helpers"
 	"akvorado/console/authentication"
 	"akvorado/console/database"
-	"akvorado/console/filter"
 )
 
 // filterValidateHandlerInput describes the input for the /filter/validate endpoint.
@@ -208,7 +208,31 @@ LIMIT 20`
 				})
 			}
 			input.Prefix = ""
-		case "srcas", "dstas", "dst1stas", "dst2ndas", "dst3rdas", "dstaspath":
+		case "dstcommunitynames":
+			results := []struct {
+				Label string `ch:"label"`
+			}{}
+			sqlQuery := `
+SELECT arrayJoin(DstCommunityNames) AS label
+FROM flows
+WHERE TimeReceived > date_sub(minute, 1, now())
+AND positionCaseInsensitive(label, $1) >= 1
+GROUP BY label
+ORDER BY COUNT(*) DESC
+LIMIT 20`
+			if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery, input.Prefix); err != nil {
+				c.r.Err(err).Msg("unable to query database")
+				break
+			}
+			for _, result := range results {
+				completions = append(completions, filterCompletion{
+					Label:  result.Label,
+					Detail: "community name",
+					Quoted: true,
+				})
+			}
+			input.Prefix = ""
+		case "srcas", "dstas", "dst1stas", "dst2ndas", "dst3rdas", "dstaspath", "inifpeeras", "outifpeeras":
 			results := []struct {
 				Label  string `ch:"label"`
 				Detail string `ch:"detail"`
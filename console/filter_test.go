@@ -163,6 +163,7 @@ LIMIT 20`, "6540").
 				{"label": "DstASPath", "detail": "column name", "quoted": false},
 				{"label": "DstAddr", "detail": "column name", "quoted": false},
 				{"label": "DstCommunities", "detail": "column name", "quoted": false},
+				{"label": "DstCommunityNames", "detail": "column name", "quoted": false},
 				{"label": "DstCountry", "detail": "column name", "quoted": false},
 				{"label": "DstNetName", "detail": "column name", "quoted": false},
 				{"label": "DstNetRegion", "detail": "column name", "quoted": false},
@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+// This file implements the API expected by the Grafana JSON datasource
+// (https://github.com/simPod/GrafanaJsonDatasource). The target is the
+// unit (pps, l2bps or l3bps) and the payload contains the dimensions,
+// the limit and the filter.
+
+var errGrafanaUnknownTarget = errors.New("unknown target")
+
+// grafanaQueryInput describes the input for the /grafana/query endpoint.
+type grafanaQueryInput struct {
+	Range struct {
+		From time.Time `json:"from" binding:"required"`
+		To   time.Time `json:"to" binding:"required,gtfield=From"`
+	} `json:"range" binding:"required"`
+	MaxDataPoints uint            `json:"maxDataPoints"`
+	Targets       []grafanaTarget `json:"targets" binding:"dive"`
+}
+
+// grafanaTarget is a target for the /grafana/query endpoint.
+type grafanaTarget struct {
+	RefID   string          `json:"refId"`
+	Target  string          `json:"target" binding:"omitempty,oneof=pps l2bps l3bps"`
+	Hide    bool            `json:"hide"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// grafanaTargetPayload is the payload of a target.
+type grafanaTargetPayload struct {
+	Dimensions []queryColumn `json:"dimensions"`
+	Limit      int           `json:"limit"`
+	Filter     queryFilter   `json:"filter"`
+}
+
+// grafanaTimeSerie is a time serie as expected by Grafana.
+type grafanaTimeSerie struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// grafanaSearchInput describes the input for the /grafana/search endpoint.
+type grafanaSearchInput struct {
+	Target string `json:"target"`
+}
+
+// grafanaVariableInput describes the input for the /grafana/variable endpoint.
+type grafanaVariableInput struct {
+	Payload struct {
+		Target string `json:"target"`
+	} `json:"payload"`
+}
+
+// parsePayload decodes the payload of a target. Older versions of the
+// datasource send the payload as a JSON string.
+func (target grafanaTarget) parsePayload() (grafanaTargetPayload, error) {
+	payload := grafanaTargetPayload{Limit: 10}
+	raw := target.Payload
+	if len(raw) == 0 || string(raw) == "null" {
+		return payload, nil
+	}
+	if raw[0] == '"' {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return payload, err
+		}
+		if strings.TrimSpace(encoded) == "" {
+			return payload, nil
+		}
+		raw = []byte(encoded)
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return payload, err
+	}
+	if payload.Limit <= 0 {
+		payload.Limit = 10
+	}
+	return payload, nil
+}
+
+func (c *Component) grafanaTestHandlerFunc(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+func (c *Component) grafanaQueryHandlerFunc(gc *gin.Context) {
+	var input grafanaQueryInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	points := input.MaxDataPoints
+	if points < 5 {
+		points = 5
+	} else if points > 2000 {
+		points = 2000
+	}
+
+	series := []grafanaTimeSerie{}
+	for _, target := range input.Targets {
+		if target.Hide {
+			continue
+		}
+		payload, err := target.parsePayload()
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("Invalid payload for target %s: %s", target.RefID, err),
+			})
+			return
+		}
+		if payload.Limit > c.config.DimensionsLimit {
+			gc.JSON(http.StatusBadRequest,
+				gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
+					c.config.DimensionsLimit)})
+			return
+		}
+		units := target.Target
+		if units == "" {
+			units = "l3bps"
+		}
+		output, _, err := c.graphQuery(gc, graphHandlerInput{
+			Start:      input.Range.From,
+			End:        input.Range.To,
+			Points:     points,
+			Dimensions: payload.Dimensions,
+			Limit:      payload.Limit,
+			Filter:     payload.Filter,
+			Units:      units,
+		})
+		if err != nil {
+			c.r.Err(err).Msg("unable to query database")
+			gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+			return
+		}
+		for idx, row := range output.Rows {
+			name := strings.Join(row, " / ")
+			if name == "" {
+				name = units
+			}
+			serie := grafanaTimeSerie{
+				Target:     name,
+				Datapoints: make([][2]float64, len(output.Time)),
+			}
+			for t, ts := range output.Time {
+				serie.Datapoints[t] = [2]float64{
+					float64(output.Points[idx][t]),
+					float64(ts.UnixMilli()),
+				}
+			}
+			series = append(series, serie)
+		}
+	}
+	gc.JSON(http.StatusOK, series)
+}
+
+// grafanaValues returns the values for the provided target. It is used
+// by /search and /variable. The target is either empty (list of
+// units), "dimensions", "exporters", "interfaces" or "interfaces:"
+// followed by an exporter name.
+func (c *Component) grafanaValues(gc *gin.Context, target string) ([]string, error) {
+	ctx := c.t.Context(gc.Request.Context())
+	target = strings.TrimSpace(target)
+	var sqlQuery string
+	var args []interface{}
+	switch {
+	case target == "" || target == "units":
+		return []string{"l3bps", "l2bps", "pps"}, nil
+	case target == "dimensions":
+		dimensions := queryColumnMap.Values()
+		sort.Strings(dimensions)
+		return dimensions, nil
+	case target == "exporters":
+		sqlQuery = `SELECT ExporterName AS value FROM exporters GROUP BY ExporterName ORDER BY ExporterName`
+	case target == "interfaces":
+		sqlQuery = `SELECT IfName AS value FROM exporters GROUP BY IfName ORDER BY IfName`
+	case strings.HasPrefix(target, "interfaces:"):
+		sqlQuery = `SELECT IfName AS value FROM exporters WHERE ExporterName = $1 GROUP BY IfName ORDER BY IfName`
+		args = append(args, strings.TrimSpace(strings.TrimPrefix(target, "interfaces:")))
+	default:
+		return nil, fmt.Errorf("%w %q", errGrafanaUnknownTarget, target)
+	}
+	results := []struct {
+		Value string `ch:"value"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery, args...); err != nil {
+		return nil, err
+	}
+	values := make([]string, len(results))
+	for idx, result := range results {
+		values[idx] = result.Value
+	}
+	return values, nil
+}
+
+// grafanaValuesError answers with the error returned by grafanaValues.
+func (c *Component) grafanaValuesError(gc *gin.Context, err error) {
+	if errors.Is(err, errGrafanaUnknownTarget) {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	c.r.Err(err).Msg("unable to query database")
+	gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+}
+
+func (c *Component) grafanaSearchHandlerFunc(gc *gin.Context) {
+	var input grafanaSearchInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	values, err := c.grafanaValues(gc, input.Target)
+	if err != nil {
+		c.grafanaValuesError(gc, err)
+		return
+	}
+	gc.JSON(http.StatusOK, values)
+}
+
+func (c *Component) grafanaVariableHandlerFunc(gc *gin.Context) {
+	var input grafanaVariableInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	values, err := c.grafanaValues(gc, input.Payload.Target)
+	if err != nil {
+		c.grafanaValuesError(gc, err)
+		return
+	}
+	variables := make([]gin.H, len(values))
+	for idx, value := range values {
+		variables[idx] = gin.H{"__text": value, "__value": value}
+	}
+	gc.JSON(http.StatusOK, variables)
+}
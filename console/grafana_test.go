@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+
+	"akvorado/common/helpers"
+)
+
+func TestGrafanaTargetPayload(t *testing.T) {
+	cases := []struct {
+		Description string
+		Payload     string
+		Expected    grafanaTargetPayload
+		Error       bool
+	}{
+		{
+			Description: "no payload",
+			Payload:     ``,
+			Expected:    grafanaTargetPayload{Limit: 10},
+		}, {
+			Description: "empty string",
+			Payload:     `""`,
+			Expected:    grafanaTargetPayload{Limit: 10},
+		}, {
+			Description: "object",
+			Payload:     `{"dimensions": ["SrcAS", "ExporterName"], "limit": 5, "filter": "InIfBoundary = external"}`,
+			Expected: grafanaTargetPayload{
+				Dimensions: []queryColumn{queryColumnSrcAS, queryColumnExporterName},
+				Limit:      5,
+				Filter: queryFilter{
+					Filter:        "InIfBoundary = 'external'",
+					ReverseFilter: "OutIfBoundary = 'external'",
+				},
+			},
+		}, {
+			Description: "string",
+			Payload:     `"{\"dimensions\": [\"SrcAS\"]}"`,
+			Expected: grafanaTargetPayload{
+				Dimensions: []queryColumn{queryColumnSrcAS},
+				Limit:      10,
+			},
+		}, {
+			Description: "unknown dimension",
+			Payload:     `{"dimensions": ["Nothing"]}`,
+			Error:       true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			target := grafanaTarget{Payload: json.RawMessage(tc.Payload)}
+			got, err := target.parsePayload()
+			if err != nil && !tc.Error {
+				t.Fatalf("parsePayload() error:\n%+v", err)
+			} else if err == nil && tc.Error {
+				t.Fatal("parsePayload() did not error")
+			} else if err != nil {
+				return
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("parsePayload() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGrafanaHandlers(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+	base := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(),
+			`SELECT ExporterName AS value FROM exporters GROUP BY ExporterName ORDER BY ExporterName`).
+		SetArg(1, []struct {
+			Value string `ch:"value"`
+		}{{"router1"}, {"router2"}}).
+		Return(nil)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(),
+			`SELECT IfName AS value FROM exporters WHERE ExporterName = $1 GROUP BY IfName ORDER BY IfName`,
+			"router1").
+		SetArg(1, []struct {
+			Value string `ch:"value"`
+		}{{"Gi0/0/0"}, {"Gi0/0/1"}}).
+		Return(nil)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, []struct {
+			Axis       uint8     `ch:"axis"`
+			Time       time.Time `ch:"time"`
+			Xps        float64   `ch:"xps"`
+			Dimensions []string  `ch:"dimensions"`
+		}{
+			{1, base, 1000, []string{"router1"}},
+			{1, base, 500, []string{"router2"}},
+			{1, base.Add(time.Minute), 2000, []string{"router1"}},
+			{1, base.Add(time.Minute), 100, []string{"router2"}},
+		}).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "test connection",
+			URL:         "/api/v0/console/grafana",
+			JSONOutput:  gin.H{"message": "ok"},
+		}, {
+			Description: "search units",
+			URL:         "/api/v0/console/grafana/search",
+			JSONInput:   gin.H{"target": ""},
+			JSONOutput:  []string{"l3bps", "l2bps", "pps"},
+		}, {
+			Description: "search exporters",
+			URL:         "/api/v0/console/grafana/search",
+			JSONInput:   gin.H{"target": "exporters"},
+			JSONOutput:  []string{"router1", "router2"},
+		}, {
+			Description: "variable for interfaces of an exporter",
+			URL:         "/api/v0/console/grafana/variable",
+			JSONInput:   gin.H{"payload": gin.H{"target": "interfaces:router1"}},
+			JSONOutput: []gin.H{
+				{"__text": "Gi0/0/0", "__value": "Gi0/0/0"},
+				{"__text": "Gi0/0/1", "__value": "Gi0/0/1"},
+			},
+		}, {
+			Description: "unknown target",
+			URL:         "/api/v0/console/grafana/search",
+			JSONInput:   gin.H{"target": "nothing"},
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": `Unknown target "nothing"`},
+		}, {
+			Description: "query",
+			URL:         "/api/v0/console/grafana/query",
+			JSONInput: gin.H{
+				"range": gin.H{
+					"from": base,
+					"to":   base.Add(2 * time.Minute),
+				},
+				"maxDataPoints": 100,
+				"targets": []gin.H{
+					{
+						"refId":   "A",
+						"target":  "l3bps",
+						"payload": gin.H{"dimensions": []string{"ExporterName"}, "limit": 5},
+					}, {
+						"refId":  "B",
+						"target": "pps",
+						"hide":   true,
+					},
+				},
+			},
+			JSONOutput: []gin.H{
+				{
+					"target": "router1",
+					"datapoints": [][]float64{
+						{1000, float64(base.UnixMilli())},
+						{2000, float64(base.Add(time.Minute).UnixMilli())},
+					},
+				}, {
+					"target": "router2",
+					"datapoints": [][]float64{
+						{500, float64(base.UnixMilli())},
+						{100, float64(base.Add(time.Minute).UnixMilli())},
+					},
+				},
+			},
+		}, {
+			Description: "query with invalid units",
+			URL:         "/api/v0/console/grafana/query",
+			JSONInput: gin.H{
+				"range": gin.H{
+					"from": base,
+					"to":   base.Add(2 * time.Minute),
+				},
+				"targets": []gin.H{{"refId": "A", "target": "bps"}},
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{
+				"message": "Key: 'grafanaQueryInput.Targets[0].Target' Error:Field validation for 'Target' failed on the 'oneof' tag",
+			},
+		},
+	})
+}
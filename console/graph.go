@@ -171,7 +171,8 @@ ORDER BY time WITH FILL
 			Start:             input.Start,
 			End:               input.End,
 			StartForInterval:  startForInterval,
-			MainTableRequired: requireMainTable(input.Dimensions, input.Filter),
+			MainTableRequired: input.Filter.MainTableRequired,
+			Columns:           mainTableColumns(input.Dimensions),
 			Points:            input.Points,
 			Units:             input.Units,
 		}),
@@ -205,7 +206,6 @@ func (input graphHandlerInput) toSQL() string {
 }
 
 func (c *Component) graphHandlerFunc(gc *gin.Context) {
-	ctx := c.t.Context(gc.Request.Context())
 	var input graphHandlerInput
 	if err := gc.ShouldBindJSON(&input); err != nil {
 		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
@@ -218,9 +218,22 @@ func (c *Component) graphHandlerFunc(gc *gin.Context) {
 		return
 	}
 
+	output, sqlQuery, err := c.graphQuery(gc, input)
+	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
+	if err != nil {
+		c.r.Err(err).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	gc.JSON(http.StatusOK, output)
+}
+
+// graphQuery executes the query for the provided input and builds the
+// output. It also returns the SQL query used.
+func (c *Component) graphQuery(gc *gin.Context, input graphHandlerInput) (graphHandlerOutput, string, error) {
+	ctx := c.t.Context(gc.Request.Context())
 	sqlQuery := input.toSQL()
 	sqlQuery = c.finalizeQuery(sqlQuery)
-	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
 
 	results := []struct {
 		Axis       uint8     `ch:"axis"`
@@ -229,9 +242,7 @@ func (c *Component) graphHandlerFunc(gc *gin.Context) {
 		Dimensions []string  `ch:"dimensions"`
 	}{}
 	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
-		c.r.Err(err).Msg("unable to query database")
-		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
-		return
+		return graphHandlerOutput{}, sqlQuery, err
 	}
 
 	// When filling 0 value, we may get an empty dimensions.
@@ -399,5 +410,5 @@ func (c *Component) graphHandlerFunc(gc *gin.Context) {
 			output.AxisNames[axis] = fmt.Sprintf("Previous %s", name)
 		}
 	}
-	gc.JSON(http.StatusOK, output)
+	return output, sqlQuery, nil
 }
@@ -6,10 +6,11 @@ package console
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
+	"akvorado/common/filter"
 	"akvorado/common/helpers"
-	"akvorado/console/filter"
 )
 
 type queryColumn int
@@ -35,26 +36,41 @@ func (qc *queryColumn) UnmarshalText(input []byte) error {
 }
 
 // queryColumnsRequiringMainTable lists query columns only present in
-// the main table. Also check filter/parser.peg.
-var queryColumnsRequiringMainTable = map[queryColumn]struct{}{
-	queryColumnSrcAddr:        {},
-	queryColumnDstAddr:        {},
-	queryColumnSrcPort:        {},
-	queryColumnDstPort:        {},
-	queryColumnDstASPath:      {},
-	queryColumnDstCommunities: {},
+// the main table, unless configured as an additional dimension for a
+// consolidated table. Also check filter/parser.peg.
+var queryColumnsRequiringMainTable = queryColumnSet{
+	queryColumnSrcAddr:           {},
+	queryColumnDstAddr:           {},
+	queryColumnSrcPort:           {},
+	queryColumnDstPort:           {},
+	queryColumnDstASPath:         {},
+	queryColumnDstCommunities:    {},
+	queryColumnDstCommunityNames: {},
+	queryColumnScanSuspect:       {},
 }
 
-func requireMainTable(qcs []queryColumn, qf queryFilter) bool {
-	if qf.MainTableRequired {
-		return true
+type queryColumnSet map[queryColumn]struct{}
+
+// names returns the sorted column names of a set of query columns.
+func (qcs queryColumnSet) names() []string {
+	names := []string{}
+	for qc := range qcs {
+		names = append(names, qc.String())
 	}
+	sort.Strings(names)
+	return names
+}
+
+// mainTableColumns returns the names of the provided query columns
+// usually only present in the main table.
+func mainTableColumns(qcs []queryColumn) []string {
+	columns := []string{}
 	for _, qc := range qcs {
 		if _, ok := queryColumnsRequiringMainTable[qc]; ok {
-			return true
+			columns = append(columns, qc.String())
 		}
 	}
-	return false
+	return columns
 }
 
 type queryFilter struct {
@@ -98,7 +114,7 @@ func (qc queryColumn) toSQLSelect() string {
 	switch qc {
 	case queryColumnExporterAddress, queryColumnSrcAddr, queryColumnDstAddr:
 		strValue = fmt.Sprintf("replaceRegexpOne(IPv6NumToString(%s), '^::ffff:', '')", qc)
-	case queryColumnSrcAS, queryColumnDstAS, queryColumnDst1stAS, queryColumnDst2ndAS, queryColumnDst3rdAS:
+	case queryColumnSrcAS, queryColumnDstAS, queryColumnDst1stAS, queryColumnDst2ndAS, queryColumnDst3rdAS, queryColumnInIfPeerAS, queryColumnOutIfPeerAS:
 		strValue = fmt.Sprintf(`concat(toString(%s), ': ', dictGetOrDefault('asns', 'name', %s, '???'))`,
 			qc, qc)
 	case queryColumnEType:
@@ -106,12 +122,14 @@ func (qc queryColumn) toSQLSelect() string {
 			helpers.ETypeIPv4, helpers.ETypeIPv6)
 	case queryColumnProto:
 		strValue = `dictGetOrDefault('protocols', 'name', Proto, '???')`
-	case queryColumnInIfSpeed, queryColumnOutIfSpeed, queryColumnSrcPort, queryColumnDstPort, queryColumnForwardingStatus, queryColumnInIfBoundary, queryColumnOutIfBoundary:
+	case queryColumnInIfSpeed, queryColumnOutIfSpeed, queryColumnSrcPort, queryColumnDstPort, queryColumnForwardingStatus, queryColumnInIfBoundary, queryColumnOutIfBoundary, queryColumnScanSuspect:
 		strValue = fmt.Sprintf("toString(%s)", qc)
 	case queryColumnDstASPath:
 		strValue = `arrayStringConcat(DstASPath, ' ')`
 	case queryColumnDstCommunities:
 		strValue = `arrayStringConcat(arrayConcat(arrayMap(c -> concat(toString(bitShiftRight(c, 16)), ':', toString(bitAnd(c, 0xffff))), DstCommunities), arrayMap(c -> concat(toString(bitAnd(bitShiftRight(c, 64), 0xffffffff)), ':', toString(bitAnd(bitShiftRight(c, 32), 0xffffffff)), ':', toString(bitAnd(c, 0xffffffff))), DstLargeCommunities)), ' ')`
+	case queryColumnDstCommunityNames:
+		strValue = `arrayStringConcat(DstCommunityNames, ' ')`
 	default:
 		strValue = qc.String()
 	}
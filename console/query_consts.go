@@ -13,6 +13,7 @@ const (
 	queryColumnExporterSite
 	queryColumnExporterRegion
 	queryColumnExporterTenant
+	queryColumnExporterCountry
 	queryColumnSrcAS
 	queryColumnSrcNetName
 	queryColumnSrcNetRole
@@ -25,6 +26,8 @@ const (
 	queryColumnInIfSpeed
 	queryColumnInIfConnectivity
 	queryColumnInIfProvider
+	queryColumnInIfPeerAS
+	queryColumnInIfBillingGroup
 	queryColumnInIfBoundary
 	queryColumnEType
 	queryColumnProto
@@ -36,6 +39,7 @@ const (
 	queryColumnDst2ndAS
 	queryColumnDst3rdAS
 	queryColumnDstCommunities
+	queryColumnDstCommunityNames
 	queryColumnDstNetName
 	queryColumnDstNetRole
 	queryColumnDstNetSite
@@ -47,10 +51,13 @@ const (
 	queryColumnOutIfSpeed
 	queryColumnOutIfConnectivity
 	queryColumnOutIfProvider
+	queryColumnOutIfPeerAS
+	queryColumnOutIfBillingGroup
 	queryColumnOutIfBoundary
 	queryColumnDstAddr
 	queryColumnDstPort
 	queryColumnForwardingStatus
+	queryColumnScanSuspect
 	queryColumnPacketSizeBucket
 )
 
@@ -62,6 +69,7 @@ var queryColumnMap = helpers.NewBimap(map[queryColumn]string{
 	queryColumnExporterSite:      "ExporterSite",
 	queryColumnExporterRegion:    "ExporterRegion",
 	queryColumnExporterTenant:    "ExporterTenant",
+	queryColumnExporterCountry:   "ExporterCountry",
 	queryColumnSrcAddr:           "SrcAddr",
 	queryColumnDstAddr:           "DstAddr",
 	queryColumnSrcAS:             "SrcAS",
@@ -71,6 +79,7 @@ var queryColumnMap = helpers.NewBimap(map[queryColumn]string{
 	queryColumnDst2ndAS:          "Dst2ndAS",
 	queryColumnDst3rdAS:          "Dst3rdAS",
 	queryColumnDstCommunities:    "DstCommunities",
+	queryColumnDstCommunityNames: "DstCommunityNames",
 	queryColumnSrcNetName:        "SrcNetName",
 	queryColumnDstNetName:        "DstNetName",
 	queryColumnSrcNetRole:        "SrcNetRole",
@@ -93,6 +102,10 @@ var queryColumnMap = helpers.NewBimap(map[queryColumn]string{
 	queryColumnOutIfConnectivity: "OutIfConnectivity",
 	queryColumnInIfProvider:      "InIfProvider",
 	queryColumnOutIfProvider:     "OutIfProvider",
+	queryColumnInIfPeerAS:        "InIfPeerAS",
+	queryColumnOutIfPeerAS:       "OutIfPeerAS",
+	queryColumnInIfBillingGroup:  "InIfBillingGroup",
+	queryColumnOutIfBillingGroup: "OutIfBillingGroup",
 	queryColumnInIfBoundary:      "InIfBoundary",
 	queryColumnOutIfBoundary:     "OutIfBoundary",
 	queryColumnEType:             "EType",
@@ -100,5 +113,6 @@ var queryColumnMap = helpers.NewBimap(map[queryColumn]string{
 	queryColumnSrcPort:           "SrcPort",
 	queryColumnDstPort:           "DstPort",
 	queryColumnForwardingStatus:  "ForwardingStatus",
+	queryColumnScanSuspect:       "ScanSuspect",
 	queryColumnPacketSizeBucket:  "PacketSizeBucket",
 })
@@ -9,27 +9,26 @@ import (
 	"akvorado/common/helpers"
 )
 
-func TestRequireMainTable(t *testing.T) {
+func TestMainTableColumns(t *testing.T) {
 	cases := []struct {
 		Columns  []queryColumn
-		Filter   queryFilter
-		Expected bool
+		Expected []string
 	}{
-		{[]queryColumn{}, queryFilter{}, false},
-		{[]queryColumn{queryColumnSrcAS}, queryFilter{}, false},
-		{[]queryColumn{queryColumnExporterAddress}, queryFilter{}, false},
-		{[]queryColumn{queryColumnSrcPort}, queryFilter{}, true},
-		{[]queryColumn{queryColumnSrcAddr}, queryFilter{}, true},
-		{[]queryColumn{queryColumnDstPort}, queryFilter{}, true},
-		{[]queryColumn{queryColumnDstAddr}, queryFilter{}, true},
-		{[]queryColumn{queryColumnSrcAS, queryColumnDstAddr}, queryFilter{}, true},
-		{[]queryColumn{queryColumnDstAddr, queryColumnSrcAS}, queryFilter{}, true},
-		{[]queryColumn{}, queryFilter{MainTableRequired: true}, true},
+		{[]queryColumn{}, []string{}},
+		{[]queryColumn{queryColumnSrcAS}, []string{}},
+		{[]queryColumn{queryColumnExporterAddress}, []string{}},
+		{[]queryColumn{queryColumnSrcPort}, []string{"SrcPort"}},
+		{[]queryColumn{queryColumnSrcAddr}, []string{"SrcAddr"}},
+		{[]queryColumn{queryColumnDstPort}, []string{"DstPort"}},
+		{[]queryColumn{queryColumnDstAddr}, []string{"DstAddr"}},
+		{[]queryColumn{queryColumnSrcAS, queryColumnDstAddr}, []string{"DstAddr"}},
+		{[]queryColumn{queryColumnDstAddr, queryColumnSrcAS}, []string{"DstAddr"}},
+		{[]queryColumn{queryColumnDstAddr, queryColumnDstPort}, []string{"DstAddr", "DstPort"}},
 	}
 	for idx, tc := range cases {
-		got := requireMainTable(tc.Columns, tc.Filter)
-		if got != tc.Expected {
-			t.Errorf("requireMainTable(%d) == %v but expected %v", idx, got, tc.Expected)
+		got := mainTableColumns(tc.Columns)
+		if diff := helpers.Diff(got, tc.Expected); diff != "" {
+			t.Errorf("mainTableColumns(%d) (-got, +want):\n%s", idx, diff)
 		}
 	}
 }
@@ -59,7 +59,7 @@ func New(r *reporter.Reporter, config Configuration, dependencies Dependencies)
 		r:           r,
 		d:           &dependencies,
 		config:      config,
-		flowsTables: []flowsTable{{"flows", 0, time.Time{}}},
+		flowsTables: []flowsTable{{"flows", 0, time.Time{}, nil}},
 	}
 
 	c.d.Daemon.Track(&c.t, "console")
@@ -88,11 +88,21 @@ func (c *Component) Start() error {
 	endpoint.GET("/widget/graph", c.widgetGraphHandlerFunc)
 	endpoint.POST("/graph", c.graphHandlerFunc)
 	endpoint.POST("/sankey", c.sankeyHandlerFunc)
+	endpoint.GET("/top", c.topHandlerFunc)
+	endpoint.GET("/billing", c.billingHandlerFunc)
+	endpoint.GET("/grafana", c.grafanaTestHandlerFunc)
+	endpoint.POST("/grafana/query", c.grafanaQueryHandlerFunc)
+	endpoint.POST("/grafana/search", c.grafanaSearchHandlerFunc)
+	endpoint.POST("/grafana/variable", c.grafanaVariableHandlerFunc)
 	endpoint.POST("/filter/validate", c.filterValidateHandlerFunc)
 	endpoint.POST("/filter/complete", c.filterCompleteHandlerFunc)
 	endpoint.GET("/filter/saved", c.filterSavedListHandlerFunc)
 	endpoint.DELETE("/filter/saved/:id", c.filterSavedDeleteHandlerFunc)
 	endpoint.POST("/filter/saved", c.filterSavedAddHandlerFunc)
+	endpoint.GET("/query/saved", c.querySavedListHandlerFunc)
+	endpoint.GET("/query/saved/:id", c.querySavedGetHandlerFunc)
+	endpoint.DELETE("/query/saved/:id", c.querySavedDeleteHandlerFunc)
+	endpoint.POST("/query/saved", c.querySavedAddHandlerFunc)
 	endpoint.GET("/user/info", c.d.Auth.UserInfoHandlerFunc)
 	endpoint.GET("/user/avatar", c.d.Auth.UserAvatarHandlerFunc)
 
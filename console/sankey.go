@@ -20,7 +20,8 @@ type sankeyHandlerInput struct {
 	Start      time.Time     `json:"start" binding:"required"`
 	End        time.Time     `json:"end" binding:"required,gtfield=Start"`
 	Dimensions []queryColumn `json:"dimensions" binding:"required,min=2"` // group by ...
-	Limit      int           `json:"limit" binding:"min=1,max=50"`        // limit product of dimensions
+	Limit      int           `json:"limit" binding:"min=1"`               // limit product of dimensions
+	NodeLimit  int           `json:"node-limit" binding:"min=0"`          // limit nodes for each dimension (0: no limit)
 	Filter     queryFilter   `json:"filter"`                              // where ...
 	Units      string        `json:"units" binding:"required,oneof=pps l3bps l2bps"`
 }
@@ -47,10 +48,14 @@ func (input sankeyHandlerInput) toSQL() (string, error) {
 	// Select
 	arrayFields := []string{}
 	dimensions := []string{}
-	for _, column := range input.Dimensions {
-		arrayFields = append(arrayFields, fmt.Sprintf(`if(%s IN (SELECT %s FROM rows), %s, 'Other')`,
-			column.String(),
-			column.String(),
+	for idx, column := range input.Dimensions {
+		condition := fmt.Sprintf(`%s IN (SELECT %s FROM rows)`, column.String(), column.String())
+		if input.NodeLimit > 0 {
+			condition = fmt.Sprintf(`%s AND %s IN (SELECT %s FROM nodes%d)`,
+				condition, column.String(), column.String(), idx)
+		}
+		arrayFields = append(arrayFields, fmt.Sprintf(`if(%s, %s, 'Other')`,
+			condition,
 			column.toSQLSelect()))
 		dimensions = append(dimensions, column.String())
 	}
@@ -69,6 +74,17 @@ func (input sankeyHandlerInput) toSQL() (string, error) {
 			strings.Join(dimensions, ", "),
 			input.Limit),
 	}
+	if input.NodeLimit > 0 {
+		for idx, column := range input.Dimensions {
+			with = append(with, fmt.Sprintf(
+				"nodes%d AS (SELECT %s FROM {{ .Table }} WHERE %s GROUP BY %s ORDER BY SUM(Bytes) DESC LIMIT %d)",
+				idx,
+				column.String(),
+				where,
+				column.String(),
+				input.NodeLimit))
+		}
+	}
 
 	sqlQuery := fmt.Sprintf(`
 {{ with %s }}
@@ -84,7 +100,8 @@ ORDER BY xps DESC
 		templateContext(inputContext{
 			Start:             input.Start,
 			End:               input.End,
-			MainTableRequired: requireMainTable(input.Dimensions, input.Filter),
+			MainTableRequired: input.Filter.MainTableRequired,
+			Columns:           mainTableColumns(input.Dimensions),
 			Points:            20,
 			Units:             input.Units,
 		}),
@@ -99,6 +116,12 @@ func (c *Component) sankeyHandlerFunc(gc *gin.Context) {
 		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
 		return
 	}
+	if input.Limit > c.config.DimensionsLimit {
+		gc.JSON(http.StatusBadRequest,
+			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
+				c.config.DimensionsLimit)})
+		return
+	}
 
 	sqlQuery, err := input.toSQL()
 	if err != nil {
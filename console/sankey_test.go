@@ -116,6 +116,33 @@ FROM {{ .Table }}
 WHERE {{ .Timefilter }} AND (DstCountry = 'FR')
 GROUP BY dimensions
 ORDER BY xps DESC
+{{ end }}`,
+		}, {
+			Description: "two dimensions, with node limit",
+			Input: sankeyHandlerInput{
+				Start:      time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
+				End:        time.Date(2022, 04, 11, 15, 45, 10, 0, time.UTC),
+				Dimensions: []queryColumn{queryColumnInIfProvider, queryColumnExporterName},
+				Limit:      10,
+				NodeLimit:  3,
+				Filter:     queryFilter{},
+				Units:      "l3bps",
+			},
+			Expected: `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":20,"units":"l3bps"}@@ }}
+WITH
+ (SELECT MAX(TimeReceived) - MIN(TimeReceived) FROM {{ .Table }} WHERE {{ .Timefilter }}) AS range,
+ rows AS (SELECT InIfProvider, ExporterName FROM {{ .Table }} WHERE {{ .Timefilter }} GROUP BY InIfProvider, ExporterName ORDER BY SUM(Bytes) DESC LIMIT 10),
+ nodes0 AS (SELECT InIfProvider FROM {{ .Table }} WHERE {{ .Timefilter }} GROUP BY InIfProvider ORDER BY SUM(Bytes) DESC LIMIT 3),
+ nodes1 AS (SELECT ExporterName FROM {{ .Table }} WHERE {{ .Timefilter }} GROUP BY ExporterName ORDER BY SUM(Bytes) DESC LIMIT 3)
+SELECT
+ {{ .Units }}/range AS xps,
+ [if(InIfProvider IN (SELECT InIfProvider FROM rows) AND InIfProvider IN (SELECT InIfProvider FROM nodes0), InIfProvider, 'Other'),
+  if(ExporterName IN (SELECT ExporterName FROM rows) AND ExporterName IN (SELECT ExporterName FROM nodes1), ExporterName, 'Other')] AS dimensions
+FROM {{ .Table }}
+WHERE {{ .Timefilter }}
+GROUP BY dimensions
+ORDER BY xps DESC
 {{ end }}`,
 		},
 	}
@@ -293,6 +320,18 @@ func TestSankeyHandler(t *testing.T) {
 						"xps": 975 + 621},
 				},
 			},
+		}, {
+			Description: "limit too high",
+			URL:         "/api/v0/console/sankey",
+			JSONInput: gin.H{
+				"start":      time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
+				"end":        time.Date(2022, 04, 11, 15, 45, 10, 0, time.UTC),
+				"dimensions": []string{"SrcAS", "InIfProvider"},
+				"limit":      100,
+				"units":      "l3bps",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Limit is set beyond maximum value (50)"},
 		},
 	})
 }
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/console/authentication"
+	"akvorado/console/database"
+)
+
+func (c *Component) querySavedListHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	queries, err := c.d.Database.ListSavedQueries(ctx, user)
+	if err != nil {
+		c.r.Err(err).Msg("unable to list queries")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "unable to list queries"})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"queries": queries})
+}
+
+func (c *Component) querySavedGetHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	query, err := c.d.Database.GetSavedQuery(ctx, user, id)
+	if err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "query not found"})
+		return
+	}
+	gc.JSON(http.StatusOK, query)
+}
+
+func (c *Component) querySavedDeleteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	if err := c.d.Database.DeleteSavedQuery(ctx, database.SavedQuery{
+		ID:   id,
+		User: user,
+	}); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "query not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) querySavedAddHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	var query database.SavedQuery
+	if err := gc.ShouldBindJSON(&query); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	query.User = user
+	id, err := c.d.Database.CreateSavedQuery(ctx, query)
+	if err != nil {
+		c.r.Err(err).Msg("cannot create saved query")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "cannot create new query"})
+		return
+	}
+	gc.JSON(http.StatusCreated, gin.H{"id": id})
+}
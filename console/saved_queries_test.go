@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	netHTTP "net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+func TestSavedQueryHandlers(t *testing.T) {
+	_, h, _, _ := NewMock(t, DefaultConfiguration())
+	alfred := func() netHTTP.Header {
+		headers := make(netHTTP.Header)
+		headers.Add("Remote-User", "alfred")
+		return headers
+	}()
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list, no queries",
+			URL:         "/api/v0/console/query/saved",
+			JSONOutput:  gin.H{"queries": []gin.H{}},
+		}, {
+			Description: "store one query",
+			URL:         "/api/v0/console/query/saved",
+			StatusCode:  201,
+			JSONInput: gin.H{
+				"description": "Peering",
+				"content":     gin.H{"dimensions": []string{"SrcAS"}},
+			},
+			JSONOutput: gin.H{"id": 1},
+		}, {
+			Description: "store one shared query",
+			URL:         "/api/v0/console/query/saved",
+			StatusCode:  201,
+			JSONInput: gin.H{
+				"description": "Capacity",
+				"shared":      true,
+				"content":     gin.H{"dimensions": []string{"ExporterName"}},
+			},
+			JSONOutput: gin.H{"id": 2},
+		}, {
+			Description: "store query without content",
+			URL:         "/api/v0/console/query/saved",
+			StatusCode:  400,
+			JSONInput:   gin.H{"description": "Nothing"},
+			JSONOutput: gin.H{
+				"message": "Key: 'SavedQuery.Content' Error:Field validation for 'Content' failed on the 'required' tag",
+			},
+		}, {
+			Description: "list stored queries",
+			URL:         "/api/v0/console/query/saved",
+			JSONOutput: gin.H{"queries": []gin.H{
+				{
+					"id":          1,
+					"shared":      false,
+					"user":        "__default",
+					"description": "Peering",
+					"content":     gin.H{"dimensions": []string{"SrcAS"}},
+				}, {
+					"id":          2,
+					"shared":      true,
+					"user":        "__default",
+					"description": "Capacity",
+					"content":     gin.H{"dimensions": []string{"ExporterName"}},
+				},
+			}},
+		}, {
+			Description: "get shared query as another user",
+			URL:         "/api/v0/console/query/saved/2",
+			Header:      alfred,
+			JSONOutput: gin.H{
+				"id":          2,
+				"shared":      true,
+				"user":        "__default",
+				"description": "Capacity",
+				"content":     gin.H{"dimensions": []string{"ExporterName"}},
+			},
+		}, {
+			Description: "get private query as another user",
+			URL:         "/api/v0/console/query/saved/1",
+			Header:      alfred,
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "query not found"},
+		}, {
+			Description: "delete stored query as another user",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/query/saved/2",
+			Header:      alfred,
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "query not found"},
+		}, {
+			Description: "delete stored query",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/query/saved/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "get query with invalid ID",
+			URL:         "/api/v0/console/query/saved/kjgdfhgh",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "bad ID format"},
+		}, {
+			Description: "list stored queries as another user",
+			URL:         "/api/v0/console/query/saved",
+			Header:      alfred,
+			JSONOutput: gin.H{"queries": []gin.H{
+				{
+					"id":          2,
+					"shared":      true,
+					"user":        "__default",
+					"description": "Capacity",
+					"content":     gin.H{"dimensions": []string{"ExporterName"}},
+				},
+			}},
+		},
+	})
+}
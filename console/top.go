@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+// topHandlerParameters describes the query string for the /top endpoint.
+type topHandlerParameters struct {
+	Dimension string        `form:"dimension" binding:"required"`
+	Start     time.Time     `form:"start"`
+	End       time.Time     `form:"end"`
+	Period    time.Duration `form:"period" binding:"isdefault|min=1m"`
+	Limit     int           `form:"limit" binding:"isdefault|min=1"`
+	Filter    string        `form:"filter"`
+	Units     string        `form:"units" binding:"isdefault|oneof=pps l2bps l3bps"`
+}
+
+// topHandlerInput describes the input for the /top endpoint once
+// parsed.
+type topHandlerInput struct {
+	Start     time.Time
+	End       time.Time
+	Dimension queryColumn
+	Limit     int
+	Filter    queryFilter
+	Units     string
+}
+
+// topResultWithRate is the top value for a dimension.
+type topResultWithRate struct {
+	Name    string  `json:"name" ch:"name"`
+	Xps     float64 `json:"xps" ch:"xps"`
+	Percent float64 `json:"percent" ch:"percent"`
+}
+
+// toInput converts the query string to an input for the /top
+// endpoint. When not specified, the end is now and the start is one
+// period (1 hour by default) before.
+func (params topHandlerParameters) toInput(now time.Time) (topHandlerInput, error) {
+	input := topHandlerInput{
+		Start: params.Start,
+		End:   params.End,
+		Limit: params.Limit,
+		Units: params.Units,
+	}
+	if err := input.Dimension.UnmarshalText([]byte(params.Dimension)); err != nil {
+		return input, fmt.Errorf("unknown dimension %q", params.Dimension)
+	}
+	if err := input.Filter.UnmarshalText([]byte(params.Filter)); err != nil {
+		return input, err
+	}
+	if input.Limit == 0 {
+		input.Limit = 10
+	}
+	if input.Units == "" {
+		input.Units = "l3bps"
+	}
+	if input.End.IsZero() {
+		input.End = now
+	}
+	if input.Start.IsZero() {
+		period := params.Period
+		if period == 0 {
+			period = time.Hour
+		}
+		input.Start = input.End.Add(-period)
+	}
+	if !input.End.After(input.Start) {
+		return input, errors.New("end should be after start")
+	}
+	return input, nil
+}
+
+// toSQL converts a top query to an SQL request
+func (input topHandlerInput) toSQL() string {
+	where := templateWhere(input.Filter)
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+WITH
+ (SELECT {{ .Units }} FROM {{ .Table }} WHERE %s) AS total
+SELECT
+ %s AS name,
+ {{ .Units }}/dateDiff('second', {{ .TimefilterStart }}, {{ .TimefilterEnd }}) AS xps,
+ {{ .Units }}/total*100 AS percent
+FROM {{ .Table }}
+WHERE %s
+GROUP BY name
+ORDER BY xps DESC
+LIMIT %d
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             input.Start,
+			End:               input.End,
+			MainTableRequired: input.Filter.MainTableRequired,
+			Columns:           mainTableColumns([]queryColumn{input.Dimension}),
+			Points:            5,
+			Units:             input.Units,
+		}),
+		where,
+		input.Dimension.toSQLSelect(),
+		where,
+		input.Limit)
+	return strings.TrimSpace(sqlQuery)
+}
+
+func (c *Component) topHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	var params topHandlerParameters
+	if err := gc.ShouldBindQuery(&params); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	input, err := params.toInput(c.d.Clock.Now())
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if input.Limit > c.config.DimensionsLimit {
+		gc.JSON(http.StatusBadRequest,
+			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
+				c.config.DimensionsLimit)})
+		return
+	}
+
+	sqlQuery := c.finalizeQuery(input.toSQL())
+	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
+
+	results := []topResultWithRate{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+		c.r.Err(err).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"top": results})
+}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+
+	"akvorado/common/helpers"
+)
+
+func TestTopInput(t *testing.T) {
+	now := time.Date(2022, 04, 11, 15, 45, 10, 0, time.UTC)
+	cases := []struct {
+		Description string
+		Params      topHandlerParameters
+		Expected    topHandlerInput
+		Error       bool
+	}{
+		{
+			Description: "defaults",
+			Params:      topHandlerParameters{Dimension: "SrcAS"},
+			Expected: topHandlerInput{
+				Start:     time.Date(2022, 04, 11, 14, 45, 10, 0, time.UTC),
+				End:       now,
+				Dimension: queryColumnSrcAS,
+				Limit:     10,
+				Units:     "l3bps",
+			},
+		}, {
+			Description: "custom period and filter",
+			Params: topHandlerParameters{
+				Dimension: "DstAddr",
+				Period:    24 * time.Hour,
+				Limit:     5,
+				Filter:    "InIfBoundary = external",
+				Units:     "pps",
+			},
+			Expected: topHandlerInput{
+				Start:     time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
+				End:       now,
+				Dimension: queryColumnDstAddr,
+				Limit:     5,
+				Filter: queryFilter{
+					Filter:        "InIfBoundary = 'external'",
+					ReverseFilter: "OutIfBoundary = 'external'",
+				},
+				Units: "pps",
+			},
+		}, {
+			Description: "unknown dimension",
+			Params:      topHandlerParameters{Dimension: "nope"},
+			Error:       true,
+		}, {
+			Description: "invalid filter",
+			Params:      topHandlerParameters{Dimension: "SrcAS", Filter: "SrcAS ="},
+			Error:       true,
+		}, {
+			Description: "end before start",
+			Params: topHandlerParameters{
+				Dimension: "SrcAS",
+				Start:     now,
+				End:       now.Add(-time.Hour),
+			},
+			Error: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got, err := tc.Params.toInput(now)
+			if err != nil && !tc.Error {
+				t.Fatalf("toInput() error:\n%+v", err)
+			} else if err == nil && tc.Error {
+				t.Fatal("toInput() did not error")
+			} else if err != nil {
+				return
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("toInput() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTopQuerySQL(t *testing.T) {
+	input := topHandlerInput{
+		Start:     time.Date(2022, 04, 10, 15, 45, 10, 0, time.UTC),
+		End:       time.Date(2022, 04, 11, 15, 45, 10, 0, time.UTC),
+		Dimension: queryColumnSrcAS,
+		Limit:     10,
+		Filter:    queryFilter{Filter: "DstCountry = 'FR'"},
+		Units:     "l3bps",
+	}
+	expected := `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":5,"units":"l3bps"}@@ }}
+WITH
+ (SELECT {{ .Units }} FROM {{ .Table }} WHERE {{ .Timefilter }} AND (DstCountry = 'FR')) AS total
+SELECT
+ concat(toString(SrcAS), ': ', dictGetOrDefault('asns', 'name', SrcAS, '???')) AS name,
+ {{ .Units }}/dateDiff('second', {{ .TimefilterStart }}, {{ .TimefilterEnd }}) AS xps,
+ {{ .Units }}/total*100 AS percent
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (DstCountry = 'FR')
+GROUP BY name
+ORDER BY xps DESC
+LIMIT 10
+{{ end }}`
+	expected = strings.TrimSpace(strings.ReplaceAll(expected, "@@", "`"))
+	if diff := helpers.Diff(input.toSQL(), expected); diff != "" {
+		t.Errorf("toSQL (-got, +want):\n%s", diff)
+	}
+}
+
+func TestTopHandler(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	expected := []topResultWithRate{
+		{"2906: Netflix", 1000, 50},
+		{"36040: Youtube", 600, 30},
+		{"20940: Akamai", 400, 20},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expected).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "top source AS",
+			URL:         "/api/v0/console/top?dimension=SrcAS&start=2022-04-10T15:45:10Z&end=2022-04-11T15:45:10Z&limit=3",
+			JSONOutput: gin.H{
+				"top": []gin.H{
+					{"name": "2906: Netflix", "xps": 1000, "percent": 50},
+					{"name": "36040: Youtube", "xps": 600, "percent": 30},
+					{"name": "20940: Akamai", "xps": 400, "percent": 20},
+				},
+			},
+		}, {
+			Description: "missing dimension",
+			URL:         "/api/v0/console/top",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Key: 'topHandlerParameters.Dimension' Error:Field validation for 'Dimension' failed on the 'required' tag",
+			},
+		}, {
+			Description: "unknown dimension",
+			URL:         "/api/v0/console/top?dimension=Nothing",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": `Unknown dimension "Nothing"`},
+		}, {
+			Description: "limit too high",
+			URL:         "/api/v0/console/top?dimension=SrcAS&limit=1000",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Limit is set beyond maximum value (50)"},
+		},
+	})
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package aggregate
+
+import "time"
+
+// Configuration describes the configuration for the aggregated metrics.
+type Configuration struct {
+	// Enabled tells to aggregate flows into metrics.
+	Enabled bool
+	// Interval is the period over which the rates are computed.
+	Interval time.Duration `validate:"min=1s"`
+	// TopN is the number of AS numbers and countries to expose
+	// for each direction.
+	TopN int `validate:"min=1"`
+	// QueueSize is the number of flows waiting to be aggregated.
+	// When the queue is full, flows are dropped.
+	QueueSize int `validate:"min=1"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// aggregated metrics.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Interval:  time.Minute,
+		TopN:      10,
+		QueueSize: 1000,
+	}
+}
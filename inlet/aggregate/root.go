@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package aggregate maintains in-memory aggregates of the enriched
+// flows and exposes them as Prometheus metrics. This allows basic
+// alerting without querying ClickHouse.
+package aggregate
+
+import (
+	"net/netip"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the aggregated metrics component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	current aggregates
+	metrics struct {
+		flows        reporter.Counter
+		flowsDropped reporter.Counter
+		exporterBPS  *reporter.GaugeVec
+		interfaceBPS *reporter.GaugeVec
+		countryBPS   *reporter.GaugeVec
+		asBPS        *reporter.GaugeVec
+	}
+}
+
+// Dependencies define the dependencies of the aggregated metrics
+// component.
+type Dependencies struct {
+	Daemon daemon.Component
+	Flows  core.Subscriber
+}
+
+// aggregates are the number of bits seen during the current interval.
+type aggregates struct {
+	exporters  map[string]float64
+	interfaces map[interfaceKey]float64
+	countries  map[directionKey[string]]float64
+	asns       map[directionKey[uint32]]float64
+}
+
+type interfaceKey struct {
+	exporter  string
+	name      string
+	direction string
+}
+
+type directionKey[T comparable] struct {
+	value     T
+	direction string
+}
+
+// New creates a new aggregated metrics component.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	c := Component{
+		r:      r,
+		d:      &dependencies,
+		config: configuration,
+	}
+	c.reset()
+	c.d.Daemon.Track(&c.t, "inlet/aggregate")
+	c.metrics.flows = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_total",
+			Help: "Number of flows aggregated.",
+		},
+	)
+	c.metrics.flowsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_dropped_total",
+			Help: "Number of flows dropped because the aggregation was too slow.",
+		},
+	)
+	c.metrics.exporterBPS = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "exporter_bps",
+			Help: "Traffic seen by each exporter in bits per second.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.interfaceBPS = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "interface_bps",
+			Help: "Traffic seen on each interface in bits per second.",
+		},
+		[]string{"exporter", "interface", "direction"},
+	)
+	c.metrics.countryBPS = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "country_bps",
+			Help: "Traffic for the top countries in bits per second.",
+		},
+		[]string{"country", "direction"},
+	)
+	c.metrics.asBPS = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "as_bps",
+			Help: "Traffic for the top AS numbers in bits per second.",
+		},
+		[]string{"asn", "direction"},
+	)
+	return &c, nil
+}
+
+// Start starts the aggregated metrics component.
+func (c *Component) Start() error {
+	if !c.config.Enabled {
+		return nil
+	}
+	c.r.Info().Msg("starting aggregated metrics component")
+	subscription := c.d.Flows.Subscribe(c.config.QueueSize)
+	c.t.Go(func() error {
+		defer subscription.Unsubscribe()
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		var dropped uint64
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-ticker.C:
+				c.publish(c.config.Interval)
+				newDropped := subscription.Dropped()
+				c.metrics.flowsDropped.Add(float64(newDropped - dropped))
+				dropped = newDropped
+			case fl := <-subscription.Flows():
+				c.add(fl)
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops the aggregated metrics component.
+func (c *Component) Stop() error {
+	if !c.config.Enabled {
+		return nil
+	}
+	c.r.Info().Msg("stopping aggregated metrics component")
+	defer c.r.Info().Msg("aggregated metrics component stopped")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// reset starts a new interval.
+func (c *Component) reset() {
+	c.current = aggregates{
+		exporters:  map[string]float64{},
+		interfaces: map[interfaceKey]float64{},
+		countries:  map[directionKey[string]]float64{},
+		asns:       map[directionKey[uint32]]float64{},
+	}
+}
+
+// add accounts for the provided flow in the current interval.
+func (c *Component) add(fl *flow.Message) {
+	c.metrics.flows.Inc()
+	bits := float64(fl.Bytes) * 8
+	if fl.SamplingRate > 0 {
+		bits *= float64(fl.SamplingRate)
+	}
+	exporterAddress, _ := netip.AddrFromSlice(fl.ExporterAddress)
+	exporter := c.r.ExporterLabel(exporterAddress.Unmap().String())
+	c.current.exporters[exporter] += bits
+	if fl.InIf != 0 {
+		c.current.interfaces[interfaceKey{exporter, interfaceName(fl.InIfName, fl.InIf), "in"}] += bits
+	}
+	if fl.OutIf != 0 {
+		c.current.interfaces[interfaceKey{exporter, interfaceName(fl.OutIfName, fl.OutIf), "out"}] += bits
+	}
+	if fl.SrcCountry != "" {
+		c.current.countries[directionKey[string]{fl.SrcCountry, "src"}] += bits
+	}
+	if fl.DstCountry != "" {
+		c.current.countries[directionKey[string]{fl.DstCountry, "dst"}] += bits
+	}
+	c.current.asns[directionKey[uint32]{fl.SrcAS, "src"}] += bits
+	c.current.asns[directionKey[uint32]{fl.DstAS, "dst"}] += bits
+}
+
+// interfaceName returns the name of an interface or its index when
+// the name is unknown.
+func interfaceName(name string, index uint32) string {
+	if name != "" {
+		return name
+	}
+	return strconv.FormatUint(uint64(index), 10)
+}
+
+// publish updates the metrics from the current interval, whose
+// duration is provided, and starts a new one.
+func (c *Component) publish(interval time.Duration) {
+	seconds := interval.Seconds()
+	c.metrics.exporterBPS.Reset()
+	for exporter, bits := range c.current.exporters {
+		c.metrics.exporterBPS.WithLabelValues(exporter).Set(bits / seconds)
+	}
+	c.metrics.interfaceBPS.Reset()
+	for key, bits := range c.current.interfaces {
+		c.metrics.interfaceBPS.WithLabelValues(key.exporter, key.name, key.direction).Set(bits / seconds)
+	}
+	c.metrics.countryBPS.Reset()
+	for _, key := range topN(c.current.countries, c.config.TopN) {
+		c.metrics.countryBPS.WithLabelValues(key.value, key.direction).
+			Set(c.current.countries[key] / seconds)
+	}
+	c.metrics.asBPS.Reset()
+	for _, key := range topN(c.current.asns, c.config.TopN) {
+		c.metrics.asBPS.WithLabelValues(strconv.FormatUint(uint64(key.value), 10), key.direction).
+			Set(c.current.asns[key] / seconds)
+	}
+	c.reset()
+}
+
+// topN returns the keys with the highest values, up to n for each
+// direction.
+func topN[T comparable](values map[directionKey[T]]float64, n int) []directionKey[T] {
+	keys := make([]directionKey[T], 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return values[keys[i]] > values[keys[j]]
+	})
+	result := make([]directionKey[T], 0, 2*n)
+	count := map[string]int{}
+	for _, key := range keys {
+		if count[key.direction] < n {
+			count[key.direction]++
+			result = append(result, key)
+		}
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package aggregate
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+)
+
+func TestAggregate(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.TopN = 1
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  core.NewBroadcaster(),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	c.add(&flow.Message{
+		ExporterAddress: net.ParseIP("192.0.2.142"),
+		SamplingRate:    1000,
+		Bytes:           1500,
+		InIf:            10,
+		InIfName:        "Gi0/0/10",
+		OutIf:           20,
+		SrcCountry:      "FR",
+		DstCountry:      "US",
+		SrcAS:           65201,
+		DstAS:           65202,
+	})
+	c.add(&flow.Message{
+		ExporterAddress: net.ParseIP("192.0.2.142"),
+		SamplingRate:    1000,
+		Bytes:           3000,
+		InIf:            10,
+		InIfName:        "Gi0/0/10",
+		SrcCountry:      "DE",
+		SrcAS:           65203,
+		DstAS:           65202,
+	})
+	c.publish(time.Minute)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_aggregate_", "flows_total", "exporter_", "interface_", "country_", "as_")
+	expectedMetrics := map[string]string{
+		`flows_total`:                          "2",
+		`exporter_bps{exporter="192.0.2.142"}`: "600000",
+		`interface_bps{direction="in",exporter="192.0.2.142",interface="Gi0/0/10"}`: "600000",
+		`interface_bps{direction="out",exporter="192.0.2.142",interface="20"}`:      "200000",
+		`country_bps{country="DE",direction="src"}`:                                 "400000",
+		`country_bps{country="US",direction="dst"}`:                                 "200000",
+		`as_bps{asn="65203",direction="src"}`:                                       "400000",
+		`as_bps{asn="65202",direction="dst"}`:                                       "600000",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Next interval is empty
+	c.publish(time.Minute)
+	gotMetrics = r.GetMetrics("akvorado_inlet_aggregate_", "exporter_", "interface_", "country_", "as_")
+	if diff := helpers.Diff(gotMetrics, map[string]string{}); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestAggregateStartStop(t *testing.T) {
+	r := reporter.NewMock(t)
+	b := core.NewBroadcaster()
+	configuration := DefaultConfiguration()
+	configuration.Enabled = true
+	configuration.Interval = 100 * time.Millisecond
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  b,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	for i := 0; i < 100 && b.Subscriptions() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.Publish(&flow.Message{
+		ExporterAddress: net.ParseIP("192.0.2.142"),
+		Bytes:           1000,
+	})
+	time.Sleep(300 * time.Millisecond)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_aggregate_", "flows_total")
+	expectedMetrics := map[string]string{
+		`flows_total`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
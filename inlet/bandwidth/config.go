@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bandwidth
+
+import "time"
+
+// Configuration describes the configuration for the interface
+// bandwidth gauges.
+type Configuration struct {
+	// Enabled tells to compute the bandwidth of each interface.
+	Enabled bool
+	// Interval is the period over which the rates are computed.
+	Interval time.Duration `validate:"min=1s"`
+	// Smoothing is the weight of the last interval when updating
+	// the rates. 1 means the rates are the ones of the last
+	// interval only.
+	Smoothing float64 `validate:"gt=0,lte=1"`
+	// QueueSize is the number of flows waiting to be processed. When
+	// the queue is full, flows are dropped.
+	QueueSize int `validate:"min=1"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// interface bandwidth gauges.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Interval:  time.Minute,
+		Smoothing: 1,
+		QueueSize: 10000,
+	}
+}
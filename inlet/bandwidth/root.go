@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package bandwidth computes the rate of each interface from the
+// enriched flows and exposes them as Prometheus gauges. This provides
+// utilization graphs without polling interface counters with SNMP.
+package bandwidth
+
+import (
+	"net/netip"
+	"strconv"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the interface bandwidth component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	current map[key]counters
+	rates   map[key]*counters
+	metrics struct {
+		flows        reporter.Counter
+		flowsDropped reporter.Counter
+		bps          *reporter.GaugeVec
+		pps          *reporter.GaugeVec
+	}
+}
+
+// Dependencies define the dependencies of the interface bandwidth
+// component.
+type Dependencies struct {
+	Daemon daemon.Component
+	Flows  core.Subscriber
+}
+
+// key identifies an interface and a direction.
+type key struct {
+	exporter  string
+	iface     string
+	direction string
+}
+
+// counters are bits and packets, either accumulated during an
+// interval or as a rate.
+type counters struct {
+	bits    float64
+	packets float64
+}
+
+// New creates a new interface bandwidth component.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	c := Component{
+		r:       r,
+		d:       &dependencies,
+		config:  configuration,
+		current: map[key]counters{},
+		rates:   map[key]*counters{},
+	}
+	c.d.Daemon.Track(&c.t, "inlet/bandwidth")
+	c.metrics.flows = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_total",
+			Help: "Number of flows processed.",
+		},
+	)
+	c.metrics.flowsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_dropped_total",
+			Help: "Number of flows dropped because the computation was too slow.",
+		},
+	)
+	c.metrics.bps = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "bps",
+			Help: "Bits per second of each interface, computed from flows.",
+		},
+		[]string{"exporter", "interface", "direction"},
+	)
+	c.metrics.pps = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "pps",
+			Help: "Packets per second of each interface, computed from flows.",
+		},
+		[]string{"exporter", "interface", "direction"},
+	)
+	return &c, nil
+}
+
+// Start starts the interface bandwidth component.
+func (c *Component) Start() error {
+	if !c.config.Enabled {
+		return nil
+	}
+	c.r.Info().Msg("starting interface bandwidth component")
+	subscription := c.d.Flows.Subscribe(c.config.QueueSize)
+	c.t.Go(func() error {
+		defer subscription.Unsubscribe()
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		var dropped uint64
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-ticker.C:
+				c.update(c.config.Interval)
+				newDropped := subscription.Dropped()
+				c.metrics.flowsDropped.Add(float64(newDropped - dropped))
+				dropped = newDropped
+			case fl := <-subscription.Flows():
+				c.add(fl)
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops the interface bandwidth component.
+func (c *Component) Stop() error {
+	if !c.config.Enabled {
+		return nil
+	}
+	c.r.Info().Msg("stopping interface bandwidth component")
+	defer c.r.Info().Msg("interface bandwidth component stopped")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// add accounts for the provided flow in the current interval, for
+// both its input and output interfaces.
+func (c *Component) add(fl *flow.Message) {
+	c.metrics.flows.Inc()
+	sampling := float64(fl.SamplingRate)
+	if sampling == 0 {
+		sampling = 1
+	}
+	flowCounters := counters{
+		bits:    float64(fl.Bytes) * 8 * sampling,
+		packets: float64(fl.Packets) * sampling,
+	}
+	exporterAddress, _ := netip.AddrFromSlice(fl.ExporterAddress)
+	exporter := c.r.ExporterLabel(exporterAddress.Unmap().String())
+	if fl.InIf != 0 {
+		c.accumulate(key{exporter, interfaceLabel(fl.InIfName, fl.InIf), "in"}, flowCounters)
+	}
+	if fl.OutIf != 0 {
+		c.accumulate(key{exporter, interfaceLabel(fl.OutIfName, fl.OutIf), "out"}, flowCounters)
+	}
+}
+
+func (c *Component) accumulate(k key, fc counters) {
+	current := c.current[k]
+	current.bits += fc.bits
+	current.packets += fc.packets
+	c.current[k] = current
+}
+
+// interfaceLabel returns the label for an interface: its name when
+// known, its index otherwise.
+func interfaceLabel(name string, ifIndex uint32) string {
+	if name != "" {
+		return name
+	}
+	return strconv.FormatUint(uint64(ifIndex), 10)
+}
+
+// update computes the rates of the current interval, whose duration
+// is provided, and updates the gauges. A new interval then starts.
+func (c *Component) update(interval time.Duration) {
+	for k, current := range c.current {
+		if _, ok := c.rates[k]; !ok {
+			// Start from the rates of the first interval.
+			c.rates[k] = &counters{
+				bits:    current.bits / interval.Seconds(),
+				packets: current.packets / interval.Seconds(),
+			}
+		}
+	}
+	for k, rate := range c.rates {
+		current, seen := c.current[k]
+		bps := current.bits / interval.Seconds()
+		pps := current.packets / interval.Seconds()
+		rate.bits = c.config.Smoothing*bps + (1-c.config.Smoothing)*rate.bits
+		rate.packets = c.config.Smoothing*pps + (1-c.config.Smoothing)*rate.packets
+		if !seen && rate.bits < 1 {
+			// Forget about inactive interfaces.
+			delete(c.rates, k)
+			c.metrics.bps.DeleteLabelValues(k.exporter, k.iface, k.direction)
+			c.metrics.pps.DeleteLabelValues(k.exporter, k.iface, k.direction)
+			continue
+		}
+		c.metrics.bps.WithLabelValues(k.exporter, k.iface, k.direction).Set(rate.bits)
+		c.metrics.pps.WithLabelValues(k.exporter, k.iface, k.direction).Set(rate.packets)
+	}
+	c.current = map[key]counters{}
+}
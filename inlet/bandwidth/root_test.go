@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bandwidth
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+)
+
+func TestUpdate(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Smoothing = 0.5
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  core.NewBroadcaster(),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	// First interval
+	c.add(&flow.Message{
+		ExporterAddress: net.ParseIP("::ffff:192.0.2.142"),
+		SamplingRate:    100,
+		Bytes:           1000,
+		Packets:         10,
+		InIf:            10,
+		InIfName:        "Gi0/0/10",
+		OutIf:           20,
+	})
+	c.add(&flow.Message{
+		ExporterAddress: net.ParseIP("::ffff:192.0.2.142"),
+		SamplingRate:    100,
+		Bytes:           500,
+		Packets:         5,
+		InIf:            10,
+		InIfName:        "Gi0/0/10",
+	})
+	c.update(10 * time.Second)
+	gotMetrics := r.GetMetrics("akvorado_inlet_bandwidth_", "bps", "pps")
+	expectedMetrics := map[string]string{
+		`bps{direction="in",exporter="192.0.2.142",interface="Gi0/0/10"}`: "120000",
+		`bps{direction="out",exporter="192.0.2.142",interface="20"}`:      "80000",
+		`pps{direction="in",exporter="192.0.2.142",interface="Gi0/0/10"}`: "150",
+		`pps{direction="out",exporter="192.0.2.142",interface="20"}`:      "100",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Second interval, only the input interface is seen
+	c.add(&flow.Message{
+		ExporterAddress: net.ParseIP("::ffff:192.0.2.142"),
+		SamplingRate:    100,
+		Bytes:           500,
+		Packets:         5,
+		InIf:            10,
+		InIfName:        "Gi0/0/10",
+	})
+	c.update(10 * time.Second)
+	gotMetrics = r.GetMetrics("akvorado_inlet_bandwidth_", "bps", "pps")
+	expectedMetrics = map[string]string{
+		`bps{direction="in",exporter="192.0.2.142",interface="Gi0/0/10"}`: "80000",
+		`bps{direction="out",exporter="192.0.2.142",interface="20"}`:      "40000",
+		`pps{direction="in",exporter="192.0.2.142",interface="Gi0/0/10"}`: "100",
+		`pps{direction="out",exporter="192.0.2.142",interface="20"}`:      "50",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Inactive interfaces are removed once their rate is negligible
+	for i := 0; i < 20; i++ {
+		c.update(10 * time.Second)
+	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_bandwidth_", "bps", "pps")
+	if diff := helpers.Diff(gotMetrics, map[string]string{}); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Enabled = true
+	configuration.Interval = 20 * time.Millisecond
+	broadcaster := core.NewBroadcaster()
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  broadcaster,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	broadcaster.Publish(&flow.Message{
+		ExporterAddress: net.ParseIP("::ffff:192.0.2.142"),
+		SamplingRate:    1,
+		Bytes:           1000,
+		Packets:         1,
+		InIf:            10,
+	})
+	time.Sleep(50 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_bandwidth_", "flows_total")
+	expectedMetrics := map[string]string{
+		`flows_total`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
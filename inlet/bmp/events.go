@@ -103,8 +103,8 @@ func (c *Component) removePeer(pkey peerKey, pinfo *peerInfo) {
 	peerStr := pkey.ip.Unmap().String()
 	c.r.Info().Msgf("remove peer %s for exporter %s", peerStr, exporterStr)
 	removed := c.rib.flushPeer(pinfo.reference)
-	c.metrics.routes.WithLabelValues(exporterStr).Sub(float64(removed))
-	c.metrics.peers.WithLabelValues(exporterStr).Dec()
+	c.metrics.routes.WithLabelValues(c.r.ExporterLabel(exporterStr)).Sub(float64(removed))
+	c.metrics.peers.WithLabelValues(c.r.ExporterLabel(exporterStr)).Dec()
 	delete(c.peers, pkey)
 }
 
@@ -147,8 +147,8 @@ func (c *Component) handleConnectionDown(exporter netip.AddrPort) {
 func (c *Component) handleConnectionUp(exporter netip.AddrPort) {
 	exporterStr := exporter.Addr().Unmap().String()
 	// Do not set to 0, exporterStr may cover several exporters.
-	c.metrics.peers.WithLabelValues(exporterStr).Add(0)
-	c.metrics.routes.WithLabelValues(exporterStr).Add(0)
+	c.metrics.peers.WithLabelValues(c.r.ExporterLabel(exporterStr)).Add(0)
+	c.metrics.routes.WithLabelValues(c.r.ExporterLabel(exporterStr)).Add(0)
 }
 
 // handlePeerUpNotification handles a new peer.
@@ -167,7 +167,7 @@ func (c *Component) handlePeerUpNotification(pkey peerKey, body *bmp.BMPPeerUpNo
 			exporterStr, peerStr)
 	} else {
 		// Peer does not exist at all
-		c.metrics.peers.WithLabelValues(exporterStr).Inc()
+		c.metrics.peers.WithLabelValues(c.r.ExporterLabel(exporterStr)).Inc()
 		pinfo = c.addPeer(pkey)
 	}
 
@@ -241,7 +241,7 @@ func (c *Component) handleRouteMonitoring(pkey peerKey, body *bmp.BMPRouteMonito
 		// We may have missed the peer down notification?
 		c.r.Info().Msgf("received route monitoring from exporter %s for peer %s, but no peer up",
 			exporterStr, peerStr)
-		c.metrics.peers.WithLabelValues(exporterStr).Inc()
+		c.metrics.peers.WithLabelValues(c.r.ExporterLabel(exporterStr)).Inc()
 		pinfo = c.addPeer(pkey)
 	}
 
@@ -376,7 +376,7 @@ func (c *Component) handleRouteMonitoring(pkey peerKey, body *bmp.BMPRouteMonito
 					rd = RDFromRouteDistinguisherInterface(route.RD)
 				}
 			default:
-				c.metrics.ignoredNlri.WithLabelValues(exporterStr,
+				c.metrics.ignoredNlri.WithLabelValues(c.r.ExporterLabel(exporterStr),
 					bgp.AfiSafiToRouteFamily(ipprefix.AFI(), ipprefix.SAFI()).String()).Inc()
 				continue
 			}
@@ -408,7 +408,7 @@ func (c *Component) handleRouteMonitoring(pkey peerKey, body *bmp.BMPRouteMonito
 		}
 	}
 
-	c.metrics.routes.WithLabelValues(exporterStr).Add(float64(added - removed))
+	c.metrics.routes.WithLabelValues(c.r.ExporterLabel(exporterStr)).Add(float64(added - removed))
 }
 
 func (c *Component) isAcceptedRD(rd RD) bool {
@@ -20,7 +20,8 @@ func (c *Component) serveConnection(conn *net.TCPConn) error {
 	exporterIP, _ := netip.AddrFromSlice(remote.IP)
 	exporter := netip.AddrPortFrom(exporterIP, uint16(remote.Port))
 	exporterStr := exporter.Addr().Unmap().String()
-	c.metrics.openedConnections.WithLabelValues(exporterStr).Inc()
+	exporterLabel := c.r.ExporterLabel(exporterStr)
+	c.metrics.openedConnections.WithLabelValues(exporterLabel).Inc()
 	logger := c.r.With().Str("exporter", exporterStr).Logger()
 	conn.SetLinger(0)
 
@@ -36,7 +37,7 @@ func (c *Component) serveConnection(conn *net.TCPConn) error {
 		}
 		conn.CloseWrite()
 		conn.CloseRead()
-		c.metrics.closedConnections.WithLabelValues(exporterStr).Inc()
+		c.metrics.closedConnections.WithLabelValues(exporterLabel).Inc()
 		return nil
 	})
 	defer close(stop)
@@ -55,7 +56,7 @@ func (c *Component) serveConnection(conn *net.TCPConn) error {
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Panic().Str("panic", fmt.Sprintf("%+v", r)).Msg("fatal error while processing BMP messages")
-			c.metrics.panics.WithLabelValues(exporterStr).Inc()
+			c.metrics.panics.WithLabelValues(exporterLabel).Inc()
 		}
 	}()
 
@@ -68,48 +69,48 @@ func (c *Component) serveConnection(conn *net.TCPConn) error {
 		if err != nil {
 			if c.t.Alive() && err != io.EOF {
 				logger.Err(err).Msg("cannot read BMP header")
-				c.metrics.errors.WithLabelValues(exporterStr, "cannot read BMP header").Inc()
+				c.metrics.errors.WithLabelValues(exporterLabel, "cannot read BMP header").Inc()
 			}
 			return nil
 		}
 		msg := bmp.BMPMessage{}
 		if err := msg.Header.DecodeFromBytes(header); err != nil {
 			logger.Err(err).Msg("cannot decode BMP header")
-			c.metrics.errors.WithLabelValues(exporterStr, "cannot decode BMP header").Inc()
+			c.metrics.errors.WithLabelValues(exporterLabel, "cannot decode BMP header").Inc()
 			return nil
 		}
 		switch msg.Header.Type {
 		case bmp.BMP_MSG_ROUTE_MONITORING:
 			msg.Body = &bmp.BMPRouteMonitoring{}
-			c.metrics.messages.WithLabelValues(exporterStr, "route-monitoring").Inc()
+			c.metrics.messages.WithLabelValues(exporterLabel, "route-monitoring").Inc()
 		case bmp.BMP_MSG_STATISTICS_REPORT:
 			// Ignore
-			c.metrics.messages.WithLabelValues(exporterStr, "statistics-report").Inc()
+			c.metrics.messages.WithLabelValues(exporterLabel, "statistics-report").Inc()
 		case bmp.BMP_MSG_PEER_DOWN_NOTIFICATION:
 			msg.Body = &bmp.BMPPeerDownNotification{}
-			c.metrics.messages.WithLabelValues(exporterStr, "peer-down-notification").Inc()
+			c.metrics.messages.WithLabelValues(exporterLabel, "peer-down-notification").Inc()
 		case bmp.BMP_MSG_PEER_UP_NOTIFICATION:
 			msg.Body = &bmp.BMPPeerUpNotification{}
-			c.metrics.messages.WithLabelValues(exporterStr, "peer-up-notification").Inc()
+			c.metrics.messages.WithLabelValues(exporterLabel, "peer-up-notification").Inc()
 		case bmp.BMP_MSG_INITIATION:
 			msg.Body = &bmp.BMPInitiation{}
-			c.metrics.messages.WithLabelValues(exporterStr, "initiation").Inc()
+			c.metrics.messages.WithLabelValues(exporterLabel, "initiation").Inc()
 			init = true
 		case bmp.BMP_MSG_TERMINATION:
 			msg.Body = &bmp.BMPTermination{}
-			c.metrics.messages.WithLabelValues(exporterStr, "termination").Inc()
+			c.metrics.messages.WithLabelValues(exporterLabel, "termination").Inc()
 		case bmp.BMP_MSG_ROUTE_MIRRORING:
 			// Ignore
-			c.metrics.messages.WithLabelValues(exporterStr, "route-mirroring").Inc()
+			c.metrics.messages.WithLabelValues(exporterLabel, "route-mirroring").Inc()
 		default:
 			logger.Info().Msgf("unknown BMP message type %d", msg.Header.Type)
-			c.metrics.messages.WithLabelValues(exporterStr, "unknown").Inc()
+			c.metrics.messages.WithLabelValues(exporterLabel, "unknown").Inc()
 		}
 
 		// First message should be BMP_MSG_INITIATION
 		if !init {
 			logger.Error().Msg("first message is not `initiation'")
-			c.metrics.errors.WithLabelValues(exporterStr, "first message not initiation").Inc()
+			c.metrics.errors.WithLabelValues(exporterLabel, "first message not initiation").Inc()
 			return nil
 		}
 
@@ -118,7 +119,7 @@ func (c *Component) serveConnection(conn *net.TCPConn) error {
 		if err != nil {
 			if c.t.Alive() {
 				logger.Error().Err(err).Msg("cannot read BMP body")
-				c.metrics.errors.WithLabelValues(exporterStr, "cannot read BMP body").Inc()
+				c.metrics.errors.WithLabelValues(exporterLabel, "cannot read BMP body").Inc()
 			}
 			return nil
 		}
@@ -131,7 +132,7 @@ func (c *Component) serveConnection(conn *net.TCPConn) error {
 		if msg.Header.Type != bmp.BMP_MSG_INITIATION && msg.Header.Type != bmp.BMP_MSG_TERMINATION {
 			if err := msg.PeerHeader.DecodeFromBytes(body); err != nil {
 				logger.Error().Err(err).Msg("cannot parse BMP peer header")
-				c.metrics.errors.WithLabelValues(exporterStr, "cannot parse BMP peer header").Inc()
+				c.metrics.errors.WithLabelValues(exporterLabel, "cannot parse BMP peer header").Inc()
 				return nil
 			}
 			body = body[bmp.BMP_PEER_HEADER_SIZE:]
@@ -145,7 +146,7 @@ func (c *Component) serveConnection(conn *net.TCPConn) error {
 
 		if err := msg.Body.ParseBody(&msg, body, marshallingOptions...); err != nil {
 			logger.Error().Err(err).Msg("cannot parse BMP body")
-			c.metrics.errors.WithLabelValues(exporterStr, "cannot parse BMP body").Inc()
+			c.metrics.errors.WithLabelValues(exporterLabel, "cannot parse BMP body").Inc()
 			return nil
 		}
 
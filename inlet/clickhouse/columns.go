@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"akvorado/inlet/flow"
+)
+
+// column maps a column of the direct flows table to a value from a flow.
+type column struct {
+	Name  string
+	Value func(*flow.Message) interface{}
+}
+
+// columns is the list of columns of the direct flows table. The table
+// is created by the orchestrator with the same schema as the raw
+// table used to consume flows from Kafka.
+var columns = []column{
+	{"TimeReceived", func(fl *flow.Message) interface{} { return time.Unix(int64(fl.TimeReceived), 0) }},
+	{"SamplingRate", func(fl *flow.Message) interface{} { return fl.SamplingRate }},
+	{"ExporterAddress", func(fl *flow.Message) interface{} { return ipv6(fl.ExporterAddress) }},
+	{"ExporterName", func(fl *flow.Message) interface{} { return fl.ExporterName }},
+	{"ExporterGroup", func(fl *flow.Message) interface{} { return fl.ExporterGroup }},
+	{"ExporterRole", func(fl *flow.Message) interface{} { return fl.ExporterRole }},
+	{"ExporterSite", func(fl *flow.Message) interface{} { return fl.ExporterSite }},
+	{"ExporterRegion", func(fl *flow.Message) interface{} { return fl.ExporterRegion }},
+	{"ExporterTenant", func(fl *flow.Message) interface{} { return fl.ExporterTenant }},
+	{"ExporterCountry", func(fl *flow.Message) interface{} { return country(fl.ExporterCountry) }},
+	{"SrcAddr", func(fl *flow.Message) interface{} { return ipv6(fl.SrcAddr) }},
+	{"DstAddr", func(fl *flow.Message) interface{} { return ipv6(fl.DstAddr) }},
+	{"SrcAS", func(fl *flow.Message) interface{} { return fl.SrcAS }},
+	{"DstAS", func(fl *flow.Message) interface{} { return fl.DstAS }},
+	{"SrcCountry", func(fl *flow.Message) interface{} { return country(fl.SrcCountry) }},
+	{"DstCountry", func(fl *flow.Message) interface{} { return country(fl.DstCountry) }},
+	{"DstASPath", func(fl *flow.Message) interface{} { return nonNil(fl.DstASPath) }},
+	{"DstCommunities", func(fl *flow.Message) interface{} { return nonNil(fl.DstCommunities) }},
+	{"DstCommunityNames", func(fl *flow.Message) interface{} { return nonNil(fl.DstCommunityNames) }},
+	{"InIfName", func(fl *flow.Message) interface{} { return fl.InIfName }},
+	{"OutIfName", func(fl *flow.Message) interface{} { return fl.OutIfName }},
+	{"InIfDescription", func(fl *flow.Message) interface{} { return fl.InIfDescription }},
+	{"OutIfDescription", func(fl *flow.Message) interface{} { return fl.OutIfDescription }},
+	{"InIfSpeed", func(fl *flow.Message) interface{} { return fl.InIfSpeed }},
+	{"OutIfSpeed", func(fl *flow.Message) interface{} { return fl.OutIfSpeed }},
+	{"InIfConnectivity", func(fl *flow.Message) interface{} { return fl.InIfConnectivity }},
+	{"OutIfConnectivity", func(fl *flow.Message) interface{} { return fl.OutIfConnectivity }},
+	{"InIfProvider", func(fl *flow.Message) interface{} { return fl.InIfProvider }},
+	{"OutIfProvider", func(fl *flow.Message) interface{} { return fl.OutIfProvider }},
+	{"InIfPeerAS", func(fl *flow.Message) interface{} { return fl.InIfPeerAS }},
+	{"OutIfPeerAS", func(fl *flow.Message) interface{} { return fl.OutIfPeerAS }},
+	{"InIfBillingGroup", func(fl *flow.Message) interface{} { return fl.InIfBillingGroup }},
+	{"OutIfBillingGroup", func(fl *flow.Message) interface{} { return fl.OutIfBillingGroup }},
+	{"InIfBoundary", func(fl *flow.Message) interface{} { return strings.ToLower(fl.InIfBoundary.String()) }},
+	{"OutIfBoundary", func(fl *flow.Message) interface{} { return strings.ToLower(fl.OutIfBoundary.String()) }},
+	{"EType", func(fl *flow.Message) interface{} { return fl.Etype }},
+	{"Proto", func(fl *flow.Message) interface{} { return fl.Proto }},
+	{"SrcPort", func(fl *flow.Message) interface{} { return fl.SrcPort }},
+	{"DstPort", func(fl *flow.Message) interface{} { return fl.DstPort }},
+	{"Bytes", func(fl *flow.Message) interface{} { return fl.Bytes }},
+	{"Packets", func(fl *flow.Message) interface{} { return fl.Packets }},
+	{"ForwardingStatus", func(fl *flow.Message) interface{} { return fl.ForwardingStatus }},
+	{"ScanSuspect", func(fl *flow.Message) interface{} { return fl.ScanSuspect }},
+	{"DstLargeCommunities.ASN", func(fl *flow.Message) interface{} {
+		return nonNil(fl.DstLargeCommunities.GetASN())
+	}},
+	{"DstLargeCommunities.LocalData1", func(fl *flow.Message) interface{} {
+		return nonNil(fl.DstLargeCommunities.GetLocalData1())
+	}},
+	{"DstLargeCommunities.LocalData2", func(fl *flow.Message) interface{} {
+		return nonNil(fl.DstLargeCommunities.GetLocalData2())
+	}},
+}
+
+// customColumns returns the columns for the provided custom fields.
+// They come after the other columns, in the order of the
+// configuration.
+func customColumns(fields []flow.CustomField) []column {
+	result := make([]column, 0, len(fields))
+	for _, field := range fields {
+		number := field.Number
+		if field.Type == flow.CustomFieldUint {
+			result = append(result, column{field.Name, func(fl *flow.Message) interface{} {
+				return fl.CustomUint(number)
+			}})
+			continue
+		}
+		result = append(result, column{field.Name, func(fl *flow.Message) interface{} {
+			return fl.CustomString(number)
+		}})
+	}
+	return result
+}
+
+// newInsertQuery returns the query used to insert flows with the
+// provided columns.
+func newInsertQuery(columns []column) string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = fmt.Sprintf("`%s`", column.Name)
+	}
+	return fmt.Sprintf("INSERT INTO flows_%d_direct (%s)",
+		flow.CurrentSchemaVersion, strings.Join(names, ", "))
+}
+
+// insertQuery is the query used to insert flows without custom fields.
+var insertQuery = newInsertQuery(columns)
+
+// values returns the values to insert for a flow.
+func values(columns []column, fl *flow.Message) []interface{} {
+	result := make([]interface{}, len(columns))
+	for i, column := range columns {
+		result[i] = column.Value(fl)
+	}
+	return result
+}
+
+// ipv6 turns an IP address into an IPv6 address.
+func ipv6(ip []byte) netip.Addr {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.IPv6Unspecified()
+	}
+	return netip.AddrFrom16(addr.As16())
+}
+
+// country returns a country code suitable for a FixedString(2) column.
+func country(code string) string {
+	if len(code) != 2 {
+		return ""
+	}
+	return code
+}
+
+// nonNil returns an empty slice instead of nil.
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"time"
+
+	"akvorado/common/clickhousedb"
+)
+
+// Configuration describes the configuration for the ClickHouse output.
+type Configuration struct {
+	clickhousedb.Configuration `mapstructure:",squash" yaml:"-,inline"`
+	// BatchSize is the maximum number of flows to insert at once.
+	BatchSize int `validate:"min=1"`
+	// FlushInterval is the maximum time to wait before inserting
+	// pending flows.
+	FlushInterval time.Duration `validate:"min=100ms"`
+	// QueueSize is the number of flows waiting to be batched.
+	QueueSize int `validate:"min=0"`
+	// AsyncInsert tells to use asynchronous inserts. ClickHouse
+	// buffers the data server-side before writing it.
+	AsyncInsert bool
+}
+
+// DefaultConfiguration represents the default configuration for the
+// ClickHouse output.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Configuration: clickhousedb.DefaultConfiguration(),
+		BatchSize:     10000,
+		FlushInterval: 5 * time.Second,
+		QueueSize:     1000,
+	}
+}
@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package clickhouse provides an output inserting flows directly into
+// ClickHouse, without Kafka.
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the ClickHouse output.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	columns     []column
+	insertQuery string
+
+	queue     chan *flow.Message
+	errLogger reporter.Logger
+	metrics   struct {
+		flowsReceived *reporter.CounterVec
+		flowsInserted reporter.Counter
+		batches       reporter.Counter
+		batchSize     reporter.Summary
+		errors        *reporter.CounterVec
+	}
+}
+
+// Dependencies define the dependencies of the ClickHouse output.
+type Dependencies struct {
+	Daemon     daemon.Component
+	ClickHouse *clickhousedb.Component
+	Flow       *flow.Component
+}
+
+// New creates a new ClickHouse output.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	c := Component{
+		r:         r,
+		d:         &dependencies,
+		config:    configuration,
+		queue:     make(chan *flow.Message, configuration.QueueSize),
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+	}
+	c.columns = columns
+	if dependencies.Flow != nil && len(dependencies.Flow.CustomFields()) > 0 {
+		c.columns = append(append([]column{}, columns...),
+			customColumns(dependencies.Flow.CustomFields())...)
+	}
+	c.insertQuery = newInsertQuery(c.columns)
+	c.d.Daemon.Track(&c.t, "inlet/clickhouse")
+	c.metrics.flowsReceived = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_received_total",
+			Help: "Number of flows received from a given exporter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.flowsInserted = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_inserted_total",
+			Help: "Number of flows inserted into ClickHouse.",
+		},
+	)
+	c.metrics.batches = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "batches_total",
+			Help: "Number of batches inserted into ClickHouse.",
+		},
+	)
+	c.metrics.batchSize = c.r.Summary(
+		reporter.SummaryOpts{
+			Name:       "batch_size_flows",
+			Help:       "Number of flows per batch.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+	)
+	c.metrics.errors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of errors when inserting flows.",
+		},
+		[]string{"error"},
+	)
+	return &c, nil
+}
+
+// Start starts the ClickHouse output.
+func (c *Component) Start() error {
+	c.r.Info().Msg("starting ClickHouse output")
+	c.t.Go(c.run)
+	return nil
+}
+
+// Stop stops the ClickHouse output. Pending flows are inserted.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("ClickHouse output stopped")
+	c.r.Info().Msg("stopping ClickHouse output")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// Send queues a flow to be inserted into ClickHouse.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.metrics.flowsReceived.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+	select {
+	case c.queue <- fl:
+	case <-c.t.Dying():
+	}
+}
+
+// run batches flows and inserts them. When stopping, the flows
+// still queued are inserted.
+func (c *Component) run() error {
+	flow.Batch(c.t.Dying(), c.queue, c.config.BatchSize, c.config.FlushInterval,
+		func(batch []*flow.Message) {
+			if err := c.insert(batch); err != nil {
+				c.errLogger.Err(err).Int("flows", len(batch)).Msg("unable to insert flows")
+			}
+		})
+	return nil
+}
+
+// insert inserts a batch of flows into ClickHouse.
+func (c *Component) insert(flows []*flow.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.FlushInterval+10*time.Second)
+	defer cancel()
+	if c.config.AsyncInsert {
+		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+			"async_insert":          1,
+			"wait_for_async_insert": 1,
+		}))
+	}
+	batch, err := c.d.ClickHouse.PrepareBatch(ctx, c.insertQuery)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("cannot prepare batch").Inc()
+		return fmt.Errorf("cannot prepare batch: %w", err)
+	}
+	for _, fl := range flows {
+		if err := batch.Append(values(c.columns, fl)...); err != nil {
+			c.metrics.errors.WithLabelValues("cannot append flow").Inc()
+			batch.Abort()
+			return fmt.Errorf("cannot append flow: %w", err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		c.metrics.errors.WithLabelValues("cannot send batch").Inc()
+		return fmt.Errorf("cannot send batch: %w", err)
+	}
+	c.metrics.batches.Inc()
+	c.metrics.batchSize.Observe(float64(len(flows)))
+	c.metrics.flowsInserted.Add(float64(len(flows)))
+	return nil
+}
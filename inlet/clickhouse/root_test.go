@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/clickhousedb/mocks"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestInsert(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	configuration := DefaultConfiguration()
+	configuration.BatchSize = 2
+	configuration.FlushInterval = time.Hour
+	c, err := New(r, configuration, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	ctrl := gomock.NewController(t)
+	mockBatch := mocks.NewMockBatch(ctrl)
+	sent := make(chan bool)
+	mockConn.EXPECT().
+		PrepareBatch(gomock.Any(), insertQuery).
+		Return(mockBatch, nil)
+	mockBatch.EXPECT().Append(gomock.Any()).Times(2).DoAndReturn(func(v ...interface{}) error {
+		if len(v) != len(columns) {
+			t.Errorf("Append() got %d values, expected %d", len(v), len(columns))
+		}
+		return nil
+	})
+	mockBatch.EXPECT().Send().DoAndReturn(func() error {
+		close(sent)
+		return nil
+	})
+	helpers.StartStop(t, c)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("batch not sent")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_clickhouse_", "flows_", "batches_")
+	expectedMetrics := map[string]string{
+		`flows_received_total{exporter="127.0.0.1"}`: "2",
+		`flows_inserted_total`:                       "2",
+		`batches_total`:                              "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestInsertError(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	configuration := DefaultConfiguration()
+	configuration.BatchSize = 1
+	c, err := New(r, configuration, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	done := make(chan bool)
+	mockConn.EXPECT().
+		PrepareBatch(gomock.Any(), insertQuery).
+		DoAndReturn(func(interface{}, string) (interface{}, error) {
+			close(done)
+			return nil, errors.New("unavailable")
+		})
+	helpers.StartStop(t, c)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("batch not prepared")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_clickhouse_", "errors_")
+	expectedMetrics := map[string]string{
+		`errors_total{error="cannot prepare batch"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestValues(t *testing.T) {
+	fl := &flow.Message{
+		TimeReceived:    1665000000,
+		ExporterAddress: net.ParseIP("192.0.2.1"),
+		SrcAddr:         net.ParseIP("2001:db8::1"),
+		SrcCountry:      "FR",
+		DstCountry:      "invalid",
+		InIfBoundary:    decoder.FlowMessage_EXTERNAL,
+		DstLargeCommunities: &decoder.FlowMessage_LargeCommunities{
+			ASN: []uint32{65000},
+		},
+	}
+	got := map[string]interface{}{}
+	for i, value := range values(columns, fl) {
+		got[columns[i].Name] = value
+	}
+	expected := map[string]interface{}{
+		"TimeReceived":                   time.Unix(1665000000, 0),
+		"ExporterAddress":                netip.MustParseAddr("::ffff:192.0.2.1"),
+		"SrcAddr":                        netip.MustParseAddr("2001:db8::1"),
+		"DstAddr":                        netip.IPv6Unspecified(),
+		"SrcCountry":                     "FR",
+		"DstCountry":                     "",
+		"InIfBoundary":                   "external",
+		"OutIfBoundary":                  "undefined",
+		"DstASPath":                      []uint32{},
+		"DstCommunityNames":              []string{},
+		"DstLargeCommunities.ASN":        []uint32{65000},
+		"DstLargeCommunities.LocalData1": []uint32{},
+	}
+	for key, value := range expected {
+		if diff := helpers.Diff(got[key], value); diff != "" {
+			t.Errorf("values()[%q] (-got, +want):\n%s", key, diff)
+		}
+	}
+	if !strings.HasPrefix(insertQuery, "INSERT INTO flows_3_direct (`TimeReceived`, ") {
+		t.Errorf("insertQuery == %q", insertQuery)
+	}
+}
+
+func TestCustomColumns(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, _ := clickhousedb.NewMock(t, r)
+	flowConfiguration := flow.DefaultConfiguration()
+	flowConfiguration.CustomFields = []flow.CustomField{
+		{Name: "Site", Number: 1002, Expression: `"paris"`},
+		{Name: "VRF", Number: 1000, Type: flow.CustomFieldUint, DecoderElement: 234},
+	}
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon:     daemon.NewMock(t),
+		ClickHouse: chComponent,
+		Flow:       flow.NewMock(t, r, flowConfiguration),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if !strings.HasSuffix(c.insertQuery, "`DstLargeCommunities.LocalData2`, `VRF`, `Site`)") {
+		t.Errorf("insertQuery == %q", c.insertQuery)
+	}
+
+	fl := &flow.Message{}
+	fl.AppendCustomUint(1000, 12)
+	fl.AppendCustomString(1002, "paris")
+	got := values(c.columns, fl)
+	if diff := helpers.Diff(got[len(got)-2:], []interface{}{uint64(12), "paris"}); diff != "" {
+		t.Errorf("values() (-got, +want):\n%s", diff)
+	}
+	if len(c.columns) != len(columns)+2 {
+		t.Error("New() did not add custom columns")
+	}
+}
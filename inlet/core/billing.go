@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+// BillingGroupRule assigns a billing group to interfaces matching
+// the provided connectivity types and providers. An empty list
+// matches any value.
+type BillingGroupRule struct {
+	// Name is the name of the billing group
+	Name string `validate:"required"`
+	// Connectivity is the list of connectivity types to match
+	Connectivity []string
+	// Provider is the list of providers to match
+	Provider []string
+}
+
+// normalizeBillingGroups normalizes the connectivity types and the
+// providers of the provided rules, like the classifiers do.
+func normalizeBillingGroups(rules []BillingGroupRule) []BillingGroupRule {
+	result := make([]BillingGroupRule, 0, len(rules))
+	for _, rule := range rules {
+		normalized := BillingGroupRule{Name: rule.Name}
+		for _, connectivity := range rule.Connectivity {
+			normalized.Connectivity = append(normalized.Connectivity, normalize(connectivity))
+		}
+		for _, provider := range rule.Provider {
+			normalized.Provider = append(normalized.Provider, normalize(provider))
+		}
+		result = append(result, normalized)
+	}
+	return result
+}
+
+// matchAny tells if the provided value is in the list. An empty list
+// matches anything.
+func matchAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// billingGroup returns the billing group of an interface from its
+// connectivity type and its provider, using rules normalized with
+// normalizeBillingGroups. The first matching rule wins.
+// An interface without connectivity type and provider does not belong
+// to any billing group.
+func billingGroup(rules []BillingGroupRule, connectivity, provider string) string {
+	if connectivity == "" && provider == "" {
+		return ""
+	}
+	for _, rule := range rules {
+		if matchAny(rule.Connectivity, connectivity) && matchAny(rule.Provider, provider) {
+			return rule.Name
+		}
+	}
+	return ""
+}
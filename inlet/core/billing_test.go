@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import "testing"
+
+func TestBillingGroup(t *testing.T) {
+	rules := normalizeBillingGroups([]BillingGroupRule{
+		{Name: "transit-cogent", Connectivity: []string{"transit"}, Provider: []string{"Cogent"}},
+		{Name: "transit", Connectivity: []string{"transit"}},
+		{Name: "peering", Connectivity: []string{"pni", "ix"}},
+		{Name: "customers", Provider: []string{"Customer 1", "customer2"}},
+	})
+	cases := []struct {
+		Connectivity string
+		Provider     string
+		Expected     string
+	}{
+		{"", "", ""},
+		{"transit", "cogent", "transit-cogent"},
+		{"transit", "telia", "transit"},
+		{"ix", "franceix", "peering"},
+		{"pni", "", "peering"},
+		{"", "customer1", "customers"},
+		{"", "customer2", "customers"},
+		{"core", "", ""},
+	}
+	for _, tc := range cases {
+		got := billingGroup(rules, tc.Connectivity, tc.Provider)
+		if got != tc.Expected {
+			t.Errorf("billingGroup(%q, %q) == %q, expected %q",
+				tc.Connectivity, tc.Provider, got, tc.Expected)
+		}
+	}
+}
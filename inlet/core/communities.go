@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+)
+
+// wellKnownCommunityNames are the names of the well-known BGP
+// communities. They can be overridden by the configuration.
+var wellKnownCommunityNames = map[uint32]string{
+	0xffff0000: "graceful-shutdown",   // RFC 8326
+	0xffff0001: "accept-own",          // RFC 7611
+	0xffff029a: "blackhole",           // RFC 7999
+	0xffffff01: "no-export",           // RFC 1997
+	0xffffff02: "no-advertise",        // RFC 1997
+	0xffffff03: "no-export-subconfed", // RFC 1997
+	0xffffff04: "no-peer",             // RFC 3765
+}
+
+// communityNames translates BGP communities and large communities to
+// names.
+type communityNames struct {
+	standard map[uint32]string
+	large    map[bgp.LargeCommunity]string
+}
+
+// newCommunityNames builds the translation tables from the provided
+// mapping. Keys are either standard communities (ASN:value) or large
+// communities (ASN:value1:value2).
+func newCommunityNames(mapping map[string]string) (*communityNames, error) {
+	cn := communityNames{
+		standard: make(map[uint32]string, len(wellKnownCommunityNames)+len(mapping)),
+		large:    map[bgp.LargeCommunity]string{},
+	}
+	for community, name := range wellKnownCommunityNames {
+		cn.standard[community] = name
+	}
+	for community, name := range mapping {
+		parts := strings.Split(community, ":")
+		switch len(parts) {
+		case 2:
+			asn, err1 := strconv.ParseUint(parts[0], 10, 16)
+			value, err2 := strconv.ParseUint(parts[1], 10, 16)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid BGP community %q", community)
+			}
+			cn.standard[uint32(asn<<16|value)] = name
+		case 3:
+			var values [3]uint32
+			for i, part := range parts {
+				value, err := strconv.ParseUint(part, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid BGP large community %q", community)
+				}
+				values[i] = uint32(value)
+			}
+			cn.large[bgp.LargeCommunity{
+				ASN:        values[0],
+				LocalData1: values[1],
+				LocalData2: values[2],
+			}] = name
+		default:
+			return nil, fmt.Errorf("invalid BGP community %q", community)
+		}
+	}
+	return &cn, nil
+}
+
+// lookup returns the names of the provided communities, in the order
+// of the communities and without duplicates. Communities without a
+// name are ignored.
+func (cn *communityNames) lookup(communities []uint32, largeCommunities []bgp.LargeCommunity) []string {
+	var names []string
+	add := func(name string) {
+		for _, existing := range names {
+			if existing == name {
+				return
+			}
+		}
+		names = append(names, name)
+	}
+	for _, community := range communities {
+		if name, ok := cn.standard[community]; ok {
+			add(name)
+		}
+	}
+	if len(cn.large) > 0 {
+		for _, community := range largeCommunities {
+			if name, ok := cn.large[community]; ok {
+				add(name)
+			}
+		}
+	}
+	return names
+}
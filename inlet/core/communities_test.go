@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"testing"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+
+	"akvorado/common/helpers"
+)
+
+func TestCommunityNames(t *testing.T) {
+	cn, err := newCommunityNames(map[string]string{
+		"65000:100":     "customer:acme",
+		"65000:200":     "customer:acme",
+		"65000:300":     "transit",
+		"65535:666":     "rtbh",
+		"64200:10:1000": "region:europe",
+	})
+	if err != nil {
+		t.Fatalf("newCommunityNames() error:\n%+v", err)
+	}
+	cases := []struct {
+		Communities      []uint32
+		LargeCommunities []bgp.LargeCommunity
+		Expected         []string
+	}{
+		{nil, nil, nil},
+		{[]uint32{65000<<16 | 100}, nil, []string{"customer:acme"}},
+		{[]uint32{65000<<16 | 100, 65000<<16 | 200, 65000<<16 | 300}, nil, []string{"customer:acme", "transit"}},
+		{[]uint32{65000<<16 | 400}, nil, nil},
+		{[]uint32{0xffffff01, 65535<<16 | 666}, nil, []string{"no-export", "rtbh"}},
+		{
+			[]uint32{65000<<16 | 300},
+			[]bgp.LargeCommunity{{ASN: 64200, LocalData1: 10, LocalData2: 1000}, {ASN: 64200, LocalData1: 10}},
+			[]string{"transit", "region:europe"},
+		},
+	}
+	for _, tc := range cases {
+		got := cn.lookup(tc.Communities, tc.LargeCommunities)
+		if diff := helpers.Diff(got, tc.Expected); diff != "" {
+			t.Errorf("lookup(%v, %v) (-got, +want):\n%s", tc.Communities, tc.LargeCommunities, diff)
+		}
+	}
+}
+
+func TestCommunityNamesErrors(t *testing.T) {
+	for _, community := range []string{"65000", "65536:100", "65000:100000", "65000:1:2:3", "blackhole", "1:2:-3"} {
+		if _, err := newCommunityNames(map[string]string{community: "name"}); err == nil {
+			t.Errorf("newCommunityNames(%q) did not error", community)
+		}
+	}
+}
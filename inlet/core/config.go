@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"akvorado/common/helpers"
+	"akvorado/inlet/flow"
 
 	"github.com/mitchellh/mapstructure"
 )
@@ -21,24 +23,96 @@ type Configuration struct {
 	ExporterClassifiers []ExporterClassifierRule
 	// InterfaceClassifiers defines rules for interface classification
 	InterfaceClassifiers []InterfaceClassifierRule
+	// InterfaceDescriptionParsers defines regular expressions to
+	// extract provider, connectivity and peer AS from interface
+	// descriptions
+	InterfaceDescriptionParsers []InterfaceDescriptionParser
+	// BillingGroups defines rules to assign billing groups to
+	// interfaces from their connectivity type and provider
+	BillingGroups []BillingGroupRule `validate:"dive"`
 	// ClassifierCacheSize defines the size of the classifier (in number of items)
 	ClassifierCacheSize uint
+	// SNMPWait defines how long a flow waits for its interfaces to be
+	// polled when they are not in the SNMP cache (0 means the flow is
+	// dropped immediately)
+	SNMPWait time.Duration `validate:"min=0"`
+	// SNMPWaitQueueSize defines the maximum number of flows waiting for
+	// their interfaces
+	SNMPWaitQueueSize int `validate:"min=1"`
 	// DefaultSamplingRate defines the default sampling rate to use when the information is missing
 	DefaultSamplingRate helpers.SubnetMap[uint]
 	// OverrideSamplingRate defines a sampling rate to use instead of the received on
 	OverrideSamplingRate helpers.SubnetMap[uint]
 	// ASNProviders defines the source used to get AS numbers
 	ASNProviders []ASNProvider `validate:"dive"`
+	// ExporterGeoIP tells if the exporter address should be looked up
+	// in the GeoIP database to set its country and, when not
+	// classified, its site
+	ExporterGeoIP bool
+	// CommunityNames maps BGP communities (ASN:value) and large
+	// communities (ASN:value1:value2) to names, in addition to the
+	// well-known communities
+	CommunityNames map[string]string
+	// ProtocolNames maps protocol numbers to names, overriding the
+	// names from the IANA table
+	ProtocolNames map[uint8]string
+	// TailMaxClients defines the maximum number of clients of the
+	// live flow tail (0 means no limit)
+	TailMaxClients int `validate:"min=0"`
+	// TailRateLimit defines the maximum number of flows per second
+	// sent to each client of the live flow tail
+	TailRateLimit int `validate:"min=1"`
+	// ScanWindow defines the sliding window used to count the
+	// distinct destination ports and hosts of each source
+	ScanWindow time.Duration `validate:"min=2s"`
+	// ScanMaxPorts defines the number of distinct destination ports
+	// over the window above which a source is flagged as a scan
+	// suspect (0 means disabled)
+	ScanMaxPorts int `validate:"min=0"`
+	// ScanMaxHosts defines the number of distinct destination hosts
+	// over the window above which a source is flagged as a scan
+	// suspect (0 means disabled)
+	ScanMaxHosts int `validate:"min=0"`
+	// ReverseDNS enables, per exporter subnet, the use of PTR
+	// records to name exporters when SNMP does not provide a name
+	ReverseDNS helpers.SubnetMap[bool]
+	// ReverseDNSCacheDuration defines how long a PTR answer is cached
+	ReverseDNSCacheDuration time.Duration `validate:"min=1m"`
+	// StaleExporterThreshold defines how long an exporter can stay
+	// silent before being listed as stale
+	StaleExporterThreshold time.Duration `validate:"min=1s"`
+	// DropFilter selects the flows to drop after hydration (none
+	// when empty)
+	DropFilter flow.Filter
+	// ExporterGroups maps exporter subnets to groups with their own
+	// enrichment settings. It is set from the exporter groups of
+	// the inlet configuration.
+	ExporterGroups *helpers.SubnetMap[ExporterGroup] `yaml:"-" validate:"omitempty,dive"`
+	// Passthrough forwards flows as decoded, without enriching
+	// them. Enrichment is then done by other inlet instances
+	// consuming the flows from Kafka.
+	Passthrough bool
 }
 
 // DefaultConfiguration represents the default configuration for the core component.
 func DefaultConfiguration() Configuration {
 	return Configuration{
-		Workers:              1,
-		ExporterClassifiers:  []ExporterClassifierRule{},
-		InterfaceClassifiers: []InterfaceClassifierRule{},
-		ClassifierCacheSize:  1000,
-		ASNProviders:         []ASNProvider{ProviderFlow, ProviderBMP, ProviderGeoIP},
+		Workers:                     1,
+		ExporterClassifiers:         []ExporterClassifierRule{},
+		InterfaceClassifiers:        []InterfaceClassifierRule{},
+		InterfaceDescriptionParsers: []InterfaceDescriptionParser{},
+		BillingGroups:               []BillingGroupRule{},
+		ClassifierCacheSize:         1000,
+		SNMPWait:                    time.Second,
+		SNMPWaitQueueSize:           10000,
+		ASNProviders:                []ASNProvider{ProviderFlow, ProviderBMP, ProviderGeoIP},
+		CommunityNames:              map[string]string{},
+		ProtocolNames:               map[uint8]string{},
+		TailMaxClients:              10,
+		TailRateLimit:               100,
+		ScanWindow:                  time.Minute,
+		ReverseDNSCacheDuration:     time.Hour,
+		StaleExporterThreshold:      5 * time.Minute,
 	}
 }
 
@@ -132,4 +206,7 @@ func ConfigurationUnmarshallerHook() mapstructure.DecodeHookFunc {
 func init() {
 	helpers.RegisterMapstructureUnmarshallerHook(ConfigurationUnmarshallerHook())
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[uint]())
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[bool]())
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[ExporterGroup]())
+	helpers.RegisterSubnetMapValidation[ExporterGroup]()
 }
@@ -70,6 +70,38 @@ func TestConfigurationUnmarshallerHook(t *testing.T) {
 			Expected: Configuration{
 				ASNProviders: []ASNProvider{ProviderFlowExceptPrivate, ProviderGeoIP, ProviderFlow},
 			},
+		}, {
+			Description: "reverse-dns for all exporters",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"reverse-dns": true,
+				}
+			},
+			Expected: Configuration{
+				ReverseDNS: *helpers.MustNewSubnetMap(map[string]bool{
+					"::/0": true,
+				}),
+			},
+		}, {
+			Description: "reverse-dns for some exporters",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"reverse-dns": gin.H{
+						"192.0.2.0/24":   true,
+						"192.0.2.128/25": false,
+						"2001:db8::/32":  true,
+					},
+				}
+			},
+			Expected: Configuration{
+				ReverseDNS: *helpers.MustNewSubnetMap(map[string]bool{
+					"::ffff:192.0.2.0/120":   true,
+					"::ffff:192.0.2.128/121": false,
+					"2001:db8::/32":          true,
+				}),
+			},
 		},
 	})
 }
@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"akvorado/inlet/flow"
+)
+
+// customField is a custom field computed from an expression or from
+// classifiers. Custom fields copied from a decoder element are handled
+// by the decoder.
+type customField struct {
+	name        string
+	number      protowire.Number
+	typ         flow.CustomFieldType
+	expression  *vm.Program
+	classifiers []*vm.Program
+}
+
+// customFieldEnvironment defines the environment used by custom field
+// expressions and classifiers.
+type customFieldEnvironment struct {
+	Flow          *flow.Message
+	Classify      classifyStringFunc
+	ClassifyRegex classifyStringRegexFunc
+}
+
+// newCustomFields compiles the expressions and the classifiers of the
+// provided custom fields.
+func newCustomFields(fields []flow.CustomField) ([]customField, error) {
+	result := []customField{}
+	for _, field := range fields {
+		cf := customField{
+			name:   field.Name,
+			number: field.Number,
+			typ:    field.Type,
+		}
+		if field.Expression != "" {
+			program, err := expr.Compile(field.Expression,
+				expr.Env(customFieldEnvironment{}))
+			if err != nil {
+				return nil, fmt.Errorf("cannot compile expression for custom field %q: %w",
+					field.Name, err)
+			}
+			cf.expression = program
+		}
+		for _, classifier := range field.Classifiers {
+			regexValidator := regexValidator{}
+			program, err := expr.Compile(classifier,
+				expr.Env(customFieldEnvironment{}),
+				expr.AsBool(),
+				expr.Patch(&regexValidator))
+			if err != nil {
+				return nil, fmt.Errorf("cannot compile classifier rule %q for custom field %q: %w",
+					classifier, field.Name, err)
+			}
+			if len(regexValidator.invalidRegexes) > 0 {
+				return nil, fmt.Errorf("invalid regular expression %q", regexValidator.invalidRegexes[0])
+			}
+			cf.classifiers = append(cf.classifiers, program)
+		}
+		if cf.expression != nil || len(cf.classifiers) > 0 {
+			result = append(result, cf)
+		}
+	}
+	return result, nil
+}
+
+// exec computes the value of the custom field for the provided flow
+// and stores it into the flow.
+func (cf *customField) exec(fl *flow.Message) error {
+	if cf.expression != nil {
+		value, err := expr.Run(cf.expression, customFieldEnvironment{Flow: fl})
+		if err != nil {
+			return fmt.Errorf("unable to execute expression for custom field %q: %w", cf.name, err)
+		}
+		if cf.typ == flow.CustomFieldString {
+			switch value := value.(type) {
+			case nil:
+			case string:
+				fl.AppendCustomString(cf.number, value)
+			default:
+				fl.AppendCustomString(cf.number, fmt.Sprint(value))
+			}
+			return nil
+		}
+		var result uint64
+		switch value := value.(type) {
+		case nil:
+		case int:
+			result = uint64(value)
+		case uint:
+			result = uint64(value)
+		case uint32:
+			result = uint64(value)
+		case uint64:
+			result = value
+		case float64:
+			result = uint64(value)
+		case string:
+			result, err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("unable to convert %q to an integer for custom field %q", value, cf.name)
+			}
+		default:
+			return fmt.Errorf("unable to convert %T to an integer for custom field %q", value, cf.name)
+		}
+		fl.AppendCustomUint(cf.number, result)
+		return nil
+	}
+
+	var result string
+	classify := classifyString(&result)
+	env := customFieldEnvironment{
+		Flow:          fl,
+		Classify:      classify,
+		ClassifyRegex: withRegex(classify),
+	}
+	for _, classifier := range cf.classifiers {
+		if _, err := expr.Run(classifier, env); err != nil {
+			return fmt.Errorf("unable to execute classifier %q for custom field %q: %w",
+				classifier.Source.Content(), cf.name, err)
+		}
+		if result != "" {
+			break
+		}
+	}
+	fl.AppendCustomString(cf.number, result)
+	return nil
+}
+
+// computeCustomFields computes the value of the custom fields for the
+// provided flow.
+func (c *Component) computeCustomFields(exporterLabel string, fl *flow.Message) {
+	for idx := range c.customFields {
+		if err := c.customFields[idx].exec(fl); err != nil {
+			c.classifierErrLogger.Err(err).Str("exporter", exporterLabel).Msg("cannot compute custom field")
+			c.metrics.flowsErrors.WithLabelValues(exporterLabel, "custom field error").Inc()
+		}
+	}
+}
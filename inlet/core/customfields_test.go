@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"testing"
+
+	"akvorado/inlet/flow"
+)
+
+func TestCustomFields(t *testing.T) {
+	fields, err := newCustomFields([]flow.CustomField{
+		{Name: "VRF", Number: 1000, Type: flow.CustomFieldUint, DecoderElement: 234},
+		{Name: "Site", Number: 1001, Expression: `Flow.ExporterName startsWith "par" ? "paris" : "other"`},
+		{Name: "Bytes", Number: 1002, Type: flow.CustomFieldUint, Expression: `Flow.Bytes * 8`},
+		{Name: "Application", Number: 1003, Classifiers: []string{
+			`Flow.DstPort == 443 && Classify("https")`,
+			`ClassifyRegex(Flow.InIfDescription, "^Transit: (\\S+)", "transit-$1")`,
+			`Classify("Other")`,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("newCustomFields() error:\n%+v", err)
+	}
+	if len(fields) != 3 {
+		t.Fatalf("newCustomFields() returned %d fields, expected 3", len(fields))
+	}
+
+	cases := []struct {
+		Flow        *flow.Message
+		Site        string
+		Bytes       uint64
+		Application string
+	}{
+		{&flow.Message{ExporterName: "par1", Bytes: 100, DstPort: 443}, "paris", 800, "https"},
+		{&flow.Message{ExporterName: "lon1", InIfDescription: "Transit: Cogent"}, "other", 0, "transit-cogent"},
+		{&flow.Message{ExporterName: "lon1", Bytes: 1}, "other", 8, "other"},
+	}
+	for _, tc := range cases {
+		fl := tc.Flow
+		for idx := range fields {
+			if err := fields[idx].exec(fl); err != nil {
+				t.Fatalf("exec() error:\n%+v", err)
+			}
+		}
+		if got := fl.CustomString(1001); got != tc.Site {
+			t.Errorf("Site == %q, expected %q", got, tc.Site)
+		}
+		if got := fl.CustomUint(1002); got != tc.Bytes {
+			t.Errorf("Bytes == %d, expected %d", got, tc.Bytes)
+		}
+		if got := fl.CustomString(1003); got != tc.Application {
+			t.Errorf("Application == %q, expected %q", got, tc.Application)
+		}
+	}
+}
+
+func TestCustomFieldsErrors(t *testing.T) {
+	for _, field := range []flow.CustomField{
+		{Name: "Site", Expression: `Flow.Unknown`},
+		{Name: "Site", Classifiers: []string{`Classify(`}},
+		{Name: "Site", Classifiers: []string{`ClassifyRegex(Flow.InIfName, "^(ebp+", "$1")`}},
+	} {
+		if _, err := newCustomFields([]flow.CustomField{field}); err == nil {
+			t.Errorf("newCustomFields(%+v) did not error", field)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// InterfaceDescriptionParser extracts attributes of an interface from
+// its description. Provider, Connectivity and PeerAS are templates
+// expanded with the submatches of the regular expression (for
+// example, "$1" or "${provider}").
+type InterfaceDescriptionParser struct {
+	// Regex is the regular expression matched against the description
+	Regex DescriptionRegex
+	// Provider is the template for the provider of the interface
+	Provider string
+	// Connectivity is the template for the connectivity type of the interface
+	Connectivity string
+	// PeerAS is the template for the AS number of the peer
+	PeerAS string
+}
+
+// DescriptionRegex is a compiled regular expression for an interface
+// description parser.
+type DescriptionRegex struct {
+	*regexp.Regexp
+}
+
+// UnmarshalText compiles a regular expression for an interface
+// description parser.
+func (dr *DescriptionRegex) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return errors.New("empty regular expression")
+	}
+	compiled, err := regexp.Compile(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid regular expression %q: %w", string(text), err)
+	}
+	dr.Regexp = compiled
+	return nil
+}
+
+// String turns a description regex into a string.
+func (dr DescriptionRegex) String() string {
+	if dr.Regexp == nil {
+		return ""
+	}
+	return dr.Regexp.String()
+}
+
+// MarshalText turns a description regex into a string.
+func (dr DescriptionRegex) MarshalText() ([]byte, error) {
+	return []byte(dr.String()), nil
+}
+
+// descriptionAttributes are the attributes extracted from an interface
+// description.
+type descriptionAttributes struct {
+	Connectivity string
+	Provider     string
+	PeerAS       uint32
+}
+
+// parseDescription applies the provided parsers to an interface
+// description. For each attribute, the first parser providing a value
+// wins.
+func parseDescription(parsers []InterfaceDescriptionParser, description string) descriptionAttributes {
+	var attributes descriptionAttributes
+	for _, parser := range parsers {
+		if parser.Regex.Regexp == nil {
+			continue
+		}
+		indexes := parser.Regex.FindStringSubmatchIndex(description)
+		if indexes == nil {
+			continue
+		}
+		expand := func(template string) string {
+			if template == "" {
+				return ""
+			}
+			return string(parser.Regex.ExpandString(nil, template, description, indexes))
+		}
+		if attributes.Provider == "" {
+			attributes.Provider = normalize(expand(parser.Provider))
+		}
+		if attributes.Connectivity == "" {
+			attributes.Connectivity = normalize(expand(parser.Connectivity))
+		}
+		if attributes.PeerAS == 0 {
+			attributes.PeerAS = parsePeerAS(expand(parser.PeerAS))
+		}
+		if attributes.Provider != "" && attributes.Connectivity != "" && attributes.PeerAS != 0 {
+			break
+		}
+	}
+	return attributes
+}
+
+// parsePeerAS turns a string like "AS174" or "174" into an AS number.
+// It returns 0 when the string is not an AS number.
+func parsePeerAS(str string) uint32 {
+	str = strings.TrimSpace(str)
+	if len(str) > 2 && strings.EqualFold(str[:2], "as") {
+		str = str[2:]
+	}
+	asn, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(asn)
+}
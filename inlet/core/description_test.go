@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestParseDescription(t *testing.T) {
+	parsers := []InterfaceDescriptionParser{}
+	for _, parser := range []struct {
+		Regex        string
+		Provider     string
+		Connectivity string
+		PeerAS       string
+	}{
+		{`^Transit: (?P<provider>[^\[]+?) \[(?P<asn>AS\d+)\]`, "${provider}", "transit", "${asn}"},
+		{`^(?i)(PNI|IX): ([^ ]+)`, "$2", "$1", ""},
+		{`\[AS(\d+)\]`, "", "", "$1"},
+		{`^Core:`, "", "core", ""},
+	} {
+		var regex DescriptionRegex
+		if err := regex.UnmarshalText([]byte(parser.Regex)); err != nil {
+			t.Fatalf("UnmarshalText(%q) error:\n%+v", parser.Regex, err)
+		}
+		parsers = append(parsers, InterfaceDescriptionParser{
+			Regex:        regex,
+			Provider:     parser.Provider,
+			Connectivity: parser.Connectivity,
+			PeerAS:       parser.PeerAS,
+		})
+	}
+	cases := []struct {
+		Description string
+		Expected    descriptionAttributes
+	}{
+		{"", descriptionAttributes{}},
+		{"Unused", descriptionAttributes{}},
+		{"Transit: Cogent [AS174]", descriptionAttributes{
+			Provider:     "cogent",
+			Connectivity: "transit",
+			PeerAS:       174,
+		}},
+		{"Transit: Cogent", descriptionAttributes{}},
+		{"PNI: Netflix [AS2906]", descriptionAttributes{
+			Provider:     "netflix",
+			Connectivity: "pni",
+			PeerAS:       2906,
+		}},
+		{"ix: FranceIX", descriptionAttributes{
+			Provider:     "franceix",
+			Connectivity: "ix",
+		}},
+		{"Core: to par2 [AS4294967296]", descriptionAttributes{
+			Connectivity: "core",
+		}},
+	}
+	for _, tc := range cases {
+		got := parseDescription(parsers, tc.Description)
+		if diff := helpers.Diff(got, tc.Expected); diff != "" {
+			t.Errorf("parseDescription(%q) (-got, +want):\n%s", tc.Description, diff)
+		}
+	}
+}
+
+func TestDescriptionRegexUnmarshal(t *testing.T) {
+	var regex DescriptionRegex
+	if err := regex.UnmarshalText([]byte("")); err == nil {
+		t.Error("UnmarshalText(\"\") did not error")
+	}
+	if err := regex.UnmarshalText([]byte("^Transit: (")); err == nil {
+		t.Error("UnmarshalText(\"^Transit: (\") did not error")
+	}
+	if err := regex.UnmarshalText([]byte("^Transit: (.*)")); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	if got, err := regex.MarshalText(); err != nil {
+		t.Fatalf("MarshalText() error:\n%+v", err)
+	} else if string(got) != "^Transit: (.*)" {
+		t.Errorf("MarshalText() == %q, expected %q", got, "^Transit: (.*)")
+	}
+}
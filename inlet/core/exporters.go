@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"akvorado/common/reporter"
+)
+
+// exporterRateInterval is the interval used to compute the flow rate
+// of each exporter.
+const exporterRateInterval = time.Minute
+
+// exporterStats contains statistics about an exporter.
+type exporterStats struct {
+	address  netip.Addr
+	flows    uint64 // atomic
+	lastSeen int64  // atomic, Unix time
+
+	rateLock  sync.Mutex
+	lastFlows uint64
+	rate      float64
+}
+
+// exporterSeen records a flow received from the provided exporter.
+func (c *Component) exporterSeen(exporter string, address netip.Addr) {
+	value, ok := c.exporters.Load(exporter)
+	if !ok {
+		value, _ = c.exporters.LoadOrStore(exporter, &exporterStats{address: address})
+	}
+	stats := value.(*exporterStats)
+	atomic.AddUint64(&stats.flows, 1)
+	atomic.StoreInt64(&stats.lastSeen, time.Now().Unix())
+}
+
+// updateExporterRates computes the flow rate of each exporter since
+// the last call.
+func (c *Component) updateExporterRates(elapsed time.Duration) {
+	c.exporters.Range(func(_, value interface{}) bool {
+		stats := value.(*exporterStats)
+		flows := atomic.LoadUint64(&stats.flows)
+		stats.rateLock.Lock()
+		stats.rate = float64(flows-stats.lastFlows) / elapsed.Seconds()
+		stats.lastFlows = flows
+		stats.rateLock.Unlock()
+		return true
+	})
+}
+
+// runExporterRates periodically updates the flow rate of each exporter.
+func (c *Component) runExporterRates() error {
+	ticker := time.NewTicker(exporterRateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case <-ticker.C:
+			c.updateExporterRates(exporterRateInterval)
+		}
+	}
+}
+
+// exporterCollector exports the time of the last flow received from
+// each exporter.
+type exporterCollector struct {
+	c        *Component
+	lastFlow *reporter.MetricDesc
+}
+
+// Describe describes the collected metrics.
+func (ec exporterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ec.lastFlow
+}
+
+// Collect collects the time of the last flow of each exporter.
+func (ec exporterCollector) Collect(ch chan<- prometheus.Metric) {
+	ec.c.exporters.Range(func(key, value interface{}) bool {
+		stats := value.(*exporterStats)
+		ch <- prometheus.MustNewConstMetric(ec.lastFlow, prometheus.GaugeValue,
+			float64(atomic.LoadInt64(&stats.lastSeen)),
+			ec.c.r.ExporterLabel(key.(string)))
+		return true
+	})
+}
+
+type exporterInterface struct {
+	Index       uint   `json:"index"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Speed       uint   `json:"speed"`
+}
+
+type exporterInformation struct {
+	Address    string              `json:"address"`
+	Name       string              `json:"name"`
+	Flows      uint64              `json:"flows"`
+	FlowRate   float64             `json:"flow-rate"`
+	LastSeen   *time.Time          `json:"last-seen,omitempty"`
+	Discovered bool                `json:"discovered,omitempty"`
+	Interfaces []exporterInterface `json:"interfaces"`
+}
+
+// ExportersHTTPHandler lists the exporters flows were received from,
+// with their flow rate, the last time a flow was received and the
+// interfaces known from the SNMP cache. Exporters found by SNMP
+// discovery are listed too, even if no flow was received from them.
+func (c *Component) ExportersHTTPHandler(gc *gin.Context) {
+	exporters := []exporterInformation{}
+	seen := map[netip.Addr]bool{}
+	c.exporters.Range(func(key, value interface{}) bool {
+		stats := value.(*exporterStats)
+		stats.rateLock.Lock()
+		rate := stats.rate
+		stats.rateLock.Unlock()
+		lastSeen := time.Unix(atomic.LoadInt64(&stats.lastSeen), 0).UTC()
+		info := exporterInformation{
+			Address:  key.(string),
+			Flows:    atomic.LoadUint64(&stats.flows),
+			FlowRate: rate,
+			LastSeen: &lastSeen,
+		}
+		c.addSNMPInformation(&info, stats.address)
+		exporters = append(exporters, info)
+		seen[stats.address] = true
+		return true
+	})
+	if c.d.SNMP != nil {
+		for _, address := range c.d.SNMP.DiscoveredExporters() {
+			if seen[address] {
+				continue
+			}
+			info := exporterInformation{
+				Address:    address.Unmap().String(),
+				Discovered: true,
+			}
+			c.addSNMPInformation(&info, address)
+			exporters = append(exporters, info)
+		}
+	}
+	sort.Slice(exporters, func(i, j int) bool {
+		return exporters[i].Address < exporters[j].Address
+	})
+	gc.IndentedJSON(http.StatusOK, gin.H{"exporters": exporters})
+}
+
+// addSNMPInformation adds the name and the interfaces of an exporter
+// known from the SNMP cache.
+func (c *Component) addSNMPInformation(info *exporterInformation, address netip.Addr) {
+	info.Interfaces = []exporterInterface{}
+	if c.d.SNMP == nil {
+		return
+	}
+	exporter, ok := c.d.SNMP.Exporter(address)
+	if !ok {
+		return
+	}
+	info.Name = exporter.Name
+	for ifIndex, iface := range exporter.Interfaces {
+		info.Interfaces = append(info.Interfaces, exporterInterface{
+			Index:       ifIndex,
+			Name:        iface.Name,
+			Description: iface.Description,
+			Speed:       iface.Speed,
+		})
+	}
+	sort.Slice(info.Interfaces, func(i, j int) bool {
+		return info.Interfaces[i].Index < info.Interfaces[j].Index
+	})
+}
+
+type staleExporterInformation struct {
+	Address  string    `json:"address"`
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"last-seen"`
+}
+
+// StaleExportersHTTPHandler lists the exporters which did not send any
+// flow for more than the configured threshold. The threshold can be
+// overridden with the "threshold" parameter.
+func (c *Component) StaleExportersHTTPHandler(gc *gin.Context) {
+	threshold := c.config.StaleExporterThreshold
+	if value := gc.Query("threshold"); value != "" {
+		var err error
+		threshold, err = time.ParseDuration(value)
+		if err != nil || threshold <= 0 {
+			gc.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("invalid threshold %q", value),
+			})
+			return
+		}
+	}
+	limit := time.Now().Add(-threshold)
+	exporters := []staleExporterInformation{}
+	c.exporters.Range(func(key, value interface{}) bool {
+		stats := value.(*exporterStats)
+		lastSeen := time.Unix(atomic.LoadInt64(&stats.lastSeen), 0).UTC()
+		if !lastSeen.Before(limit) {
+			return true
+		}
+		info := staleExporterInformation{
+			Address:  key.(string),
+			LastSeen: lastSeen,
+		}
+		if c.d.SNMP != nil {
+			if exporter, ok := c.d.SNMP.Exporter(stats.address); ok {
+				info.Name = exporter.Name
+			}
+		}
+		exporters = append(exporters, info)
+		return true
+	})
+	sort.Slice(exporters, func(i, j int) bool {
+		return exporters[i].LastSeen.Before(exporters[j].LastSeen)
+	})
+	gc.IndentedJSON(http.StatusOK, gin.H{
+		"threshold": threshold.String(),
+		"exporters": exporters,
+	})
+}
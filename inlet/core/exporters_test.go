@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/snmp"
+)
+
+func TestExportersHTTPHandler(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	httpComponent := http.NewMock(t, r)
+	snmpConfiguration := snmp.DefaultConfiguration()
+	snmpConfiguration.DiscoverySubnets = []netip.Prefix{netip.MustParsePrefix("192.0.2.144/32")}
+	snmpComponent := snmp.NewMock(t, r, snmpConfiguration,
+		snmp.Dependencies{Daemon: daemonComponent})
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon: daemonComponent,
+		HTTP:   httpComponent,
+		SNMP:   snmpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	httpComponent.GinRouter.GET("/api/v0/inlet/exporters", c.ExportersHTTPHandler)
+
+	exporter1 := netip.MustParseAddr("::ffff:192.0.2.142")
+	exporter2 := netip.MustParseAddr("::ffff:192.0.2.143")
+	exporter3 := netip.MustParseAddr("::ffff:192.0.2.144") // discovered
+	snmpComponent.Lookup(exporter1, 10)
+	snmpComponent.Lookup(exporter1, 11)
+	for {
+		e1, ok1 := snmpComponent.Exporter(exporter1)
+		e3, ok3 := snmpComponent.Exporter(exporter3)
+		if ok1 && len(e1.Interfaces) == 2 && ok3 && len(e3.Interfaces) == 3 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for i := 0; i < 120; i++ {
+		c.exporterSeen("192.0.2.142", exporter1)
+	}
+	for i := 0; i < 6; i++ {
+		c.exporterSeen("192.0.2.143", exporter2)
+	}
+	c.updateExporterRates(time.Minute)
+	c.exporterSeen("192.0.2.143", exporter2)
+	lastSeen := time.Date(2022, time.October, 10, 10, 0, 0, 0, time.UTC)
+	c.exporters.Range(func(_, value interface{}) bool {
+		atomic.StoreInt64(&value.(*exporterStats).lastSeen, lastSeen.Unix())
+		return true
+	})
+
+	helpers.TestHTTPEndpoints(t, httpComponent.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/inlet/exporters",
+			JSONOutput: gin.H{
+				"exporters": []gin.H{
+					{
+						"address":   "192.0.2.142",
+						"name":      "192_0_2_142",
+						"flows":     120,
+						"flow-rate": 2,
+						"last-seen": "2022-10-10T10:00:00Z",
+						"interfaces": []gin.H{
+							{"index": 10, "name": "Gi0/0/10", "description": "Interface 10", "speed": 1000},
+							{"index": 11, "name": "Gi0/0/11", "description": "Interface 11", "speed": 1000},
+						},
+					}, {
+						"address":    "192.0.2.143",
+						"name":       "",
+						"flows":      7,
+						"flow-rate":  0.1,
+						"last-seen":  "2022-10-10T10:00:00Z",
+						"interfaces": []gin.H{},
+					}, {
+						"address":    "192.0.2.144",
+						"name":       "192_0_2_144",
+						"flows":      0,
+						"flow-rate":  0,
+						"discovered": true,
+						"interfaces": []gin.H{
+							{"index": 1, "name": "Gi0/0/1", "description": "Interface 1", "speed": 1000},
+							{"index": 2, "name": "Gi0/0/2", "description": "Interface 2", "speed": 1000},
+							{"index": 3, "name": "Gi0/0/3", "description": "Interface 3", "speed": 1000},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestStaleExporters(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	httpComponent := http.NewMock(t, r)
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon: daemonComponent,
+		HTTP:   httpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	httpComponent.GinRouter.GET("/api/v0/inlet/exporters/stale", c.StaleExportersHTTPHandler)
+
+	c.exporterSeen("192.0.2.142", netip.MustParseAddr("::ffff:192.0.2.142"))
+	c.exporterSeen("192.0.2.143", netip.MustParseAddr("::ffff:192.0.2.143"))
+	c.exporterSeen("192.0.2.144", netip.MustParseAddr("::ffff:192.0.2.144"))
+	now := time.Now()
+	for exporter, lastSeen := range map[string]time.Time{
+		"192.0.2.142": time.Date(2022, time.October, 10, 10, 0, 0, 0, time.UTC),
+		"192.0.2.143": now.Add(-10 * time.Minute).Truncate(time.Second),
+	} {
+		value, _ := c.exporters.Load(exporter)
+		atomic.StoreInt64(&value.(*exporterStats).lastSeen, lastSeen.Unix())
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_exporter_")
+	if len(gotMetrics) != 3 {
+		t.Errorf("GetMetrics() returned %d metrics, expected 3", len(gotMetrics))
+	}
+	got := gotMetrics[`last_flow_seconds{exporter="192.0.2.142"}`]
+	if expected := "1.665396e+09"; got != expected {
+		t.Errorf("last_flow_seconds{exporter=\"192.0.2.142\"} == %s, expected %s", got, expected)
+	}
+
+	helpers.TestHTTPEndpoints(t, httpComponent.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/inlet/exporters/stale",
+			JSONOutput: gin.H{
+				"threshold": "5m0s",
+				"exporters": []gin.H{
+					{
+						"address":   "192.0.2.142",
+						"name":      "",
+						"last-seen": "2022-10-10T10:00:00Z",
+					}, {
+						"address":   "192.0.2.143",
+						"name":      "",
+						"last-seen": now.Add(-10 * time.Minute).Truncate(time.Second).UTC().Format(time.RFC3339),
+					},
+				},
+			},
+		}, {
+			URL: "/api/v0/inlet/exporters/stale?threshold=1h",
+			JSONOutput: gin.H{
+				"threshold": "1h0m0s",
+				"exporters": []gin.H{
+					{
+						"address":   "192.0.2.142",
+						"name":      "",
+						"last-seen": "2022-10-10T10:00:00Z",
+					},
+				},
+			},
+		}, {
+			URL:        "/api/v0/inlet/exporters/stale?threshold=never",
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": `invalid threshold "never"`},
+		},
+	})
+}
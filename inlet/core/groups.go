@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/flow"
+)
+
+// ExporterGroup defines the enrichment settings of a group of
+// exporters. Empty settings are inherited from the global
+// configuration.
+type ExporterGroup struct {
+	// Name is the name of the group. It is used as the exporter
+	// group of the flows when the exporter classifiers do not set it.
+	Name string `validate:"required"`
+	// ExporterClassifiers replaces the global exporter classifiers
+	ExporterClassifiers []ExporterClassifierRule
+	// InterfaceClassifiers replaces the global interface classifiers
+	InterfaceClassifiers []InterfaceClassifierRule
+	// InterfaceDescriptionParsers replaces the global interface
+	// description parsers
+	InterfaceDescriptionParsers []InterfaceDescriptionParser
+	// DropFilter replaces the global drop filter
+	DropFilter flow.Filter
+}
+
+// ruleSet is the set of rules applied to an exporter, either the
+// global one or the one of its group.
+type ruleSet struct {
+	generation           uint64 // used to invalidate the classifier cache
+	group                string
+	exporterClassifiers  []ExporterClassifierRule
+	interfaceClassifiers []InterfaceClassifierRule
+	descriptionParsers   []InterfaceDescriptionParser
+	dropFilter           *flow.Filter
+}
+
+// newGroupRuleSets builds the rule sets of the exporter groups,
+// inheriting the empty settings from the global rule set.
+func newGroupRuleSets(global *ruleSet, groups *helpers.SubnetMap[ExporterGroup]) *helpers.SubnetMap[*ruleSet] {
+	ruleSets := map[string]*ruleSet{}
+	for prefix, group := range groups.ToIPv6Map() {
+		group := group
+		rs := *global
+		rs.group = group.Name
+		if len(group.ExporterClassifiers) > 0 {
+			rs.exporterClassifiers = group.ExporterClassifiers
+		}
+		if len(group.InterfaceClassifiers) > 0 {
+			rs.interfaceClassifiers = group.InterfaceClassifiers
+		}
+		if len(group.InterfaceDescriptionParsers) > 0 {
+			rs.descriptionParsers = group.InterfaceDescriptionParsers
+		}
+		if group.DropFilter.String() != "" {
+			rs.dropFilter = &group.DropFilter
+		}
+		ruleSets[prefix] = &rs
+	}
+	// The prefixes come from a valid subnet map.
+	result, _ := helpers.NewSubnetMap(ruleSets)
+	return result
+}
+
+// forExporter returns the rule set to apply to the provided exporter.
+func (r *rules) forExporter(exporterIP netip.Addr) *ruleSet {
+	if rs, ok := r.groups.Lookup(exporterIP); ok {
+		return rs
+	}
+	return &r.global
+}
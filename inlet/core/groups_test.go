@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/flow"
+)
+
+func TestExporterGroupRules(t *testing.T) {
+	globalFilter, err := flow.NewFilter("InIfBoundary = external")
+	if err != nil {
+		t.Fatalf("NewFilter() error:\n%+v", err)
+	}
+	groupFilter, err := flow.NewFilter("DstPort = 443")
+	if err != nil {
+		t.Fatalf("NewFilter() error:\n%+v", err)
+	}
+	configuration := DefaultConfiguration()
+	configuration.DropFilter = *globalFilter
+	configuration.InterfaceDescriptionParsers = []InterfaceDescriptionParser{{Provider: "global"}}
+	configuration.ExporterGroups = helpers.MustNewSubnetMap(map[string]ExporterGroup{
+		"::ffff:192.0.2.0/120": {
+			Name:       "customer-a",
+			DropFilter: *groupFilter,
+		},
+		"::ffff:198.51.100.0/120": {
+			Name:                        "customer-b",
+			InterfaceDescriptionParsers: []InterfaceDescriptionParser{{Provider: "customer-b"}},
+		},
+	})
+	rules := newRules(3, configuration)
+
+	cases := []struct {
+		Exporter   string
+		Group      string
+		DropFilter string
+		Provider   string
+	}{
+		{"::ffff:192.0.2.10", "customer-a", "DstPort = 443", "global"},
+		{"::ffff:198.51.100.10", "customer-b", "InIfBoundary = external", "customer-b"},
+		{"::ffff:203.0.113.10", "", "InIfBoundary = external", "global"},
+	}
+	for _, tc := range cases {
+		rs := rules.forExporter(netip.MustParseAddr(tc.Exporter))
+		if rs.group != tc.Group {
+			t.Errorf("forExporter(%q).group == %q, expected %q", tc.Exporter, rs.group, tc.Group)
+		}
+		if rs.generation != 3 {
+			t.Errorf("forExporter(%q).generation == %d, expected 3", tc.Exporter, rs.generation)
+		}
+		if got := rs.dropFilter.String(); got != tc.DropFilter {
+			t.Errorf("forExporter(%q).dropFilter == %q, expected %q", tc.Exporter, got, tc.DropFilter)
+		}
+		if got := rs.descriptionParsers[0].Provider; got != tc.Provider {
+			t.Errorf("forExporter(%q).descriptionParsers == %q, expected %q", tc.Exporter, got, tc.Provider)
+		}
+	}
+}
@@ -4,29 +4,47 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/netip"
 	"strconv"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"akvorado/common/reporter"
 	"akvorado/inlet/flow"
 	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/snmp"
 )
 
-// hydrateFlow adds more data to a flow.
-func (c *Component) hydrateFlow(exporterIP netip.Addr, exporterStr string, flow *flow.Message) (skip bool) {
+// hydrateFlow adds more data to a flow. When wait is true and the
+// interfaces are not in the SNMP cache yet, it stops early and returns
+// missing as true. The flow should then be hydrated again later. When
+// poll is false, missing interfaces are not polled.
+func (c *Component) hydrateFlow(ctx context.Context, exporterIP netip.Addr, exporterStr string, flow *flow.Message, wait, poll bool) (skip bool, missing bool) {
 	errLogger := c.r.Sample(reporter.BurstSampler(time.Minute, 10))
+	lookup := c.d.SNMP.Lookup
+	if !poll {
+		lookup = c.d.SNMP.LookupCached
+	}
 
-	if flow.InIf != 0 {
-		exporterName, iface, err := c.d.SNMP.Lookup(exporterIP, uint(flow.InIf))
-		if err != nil {
+	// Interfaces already named come from replayed flows and are not
+	// looked up again.
+	span := reporter.StartChildSpan(ctx, c.tracer, "snmp lookup",
+		trace.WithAttributes(attribute.String("exporter", exporterStr)))
+	if flow.InIf != 0 && flow.InIfName == "" {
+		exporterName, iface, err := lookup(exporterIP, uint(flow.InIf))
+		if err == snmp.ErrCacheMiss && wait {
+			missing = true
+		} else if err != nil {
 			if err != snmp.ErrCacheMiss {
 				errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to query SNMP cache")
 			}
-			c.metrics.flowsErrors.WithLabelValues(exporterStr, err.Error()).Inc()
+			c.metrics.flowsErrors.WithLabelValues(c.r.ExporterLabel(exporterStr), err.Error()).Inc()
 			skip = true
 		} else {
 			flow.ExporterName = exporterName
@@ -36,16 +54,18 @@ func (c *Component) hydrateFlow(exporterIP netip.Addr, exporterStr string, flow
 		}
 	}
 
-	if flow.OutIf != 0 {
-		exporterName, iface, err := c.d.SNMP.Lookup(exporterIP, uint(flow.OutIf))
-		if err != nil {
+	if flow.OutIf != 0 && flow.OutIfName == "" {
+		exporterName, iface, err := lookup(exporterIP, uint(flow.OutIf))
+		if err == snmp.ErrCacheMiss && wait {
+			missing = true
+		} else if err != nil {
 			// Only register a cache miss if we don't have one.
 			// TODO: maybe we could do one SNMP query for both interfaces.
 			if !skip {
 				if err != snmp.ErrCacheMiss {
 					errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to query SNMP cache")
 				}
-				c.metrics.flowsErrors.WithLabelValues(exporterStr, err.Error()).Inc()
+				c.metrics.flowsErrors.WithLabelValues(c.r.ExporterLabel(exporterStr), err.Error()).Inc()
 				skip = true
 			}
 		} else {
@@ -55,10 +75,20 @@ func (c *Component) hydrateFlow(exporterIP netip.Addr, exporterStr string, flow
 			flow.OutIfSpeed = uint32(iface.Speed)
 		}
 	}
+	if skip {
+		span.SetStatus(codes.Error, "cannot retrieve interfaces")
+	}
+	span.End()
+	if missing {
+		return false, true
+	}
+	if flow.ExporterName == "" {
+		flow.ExporterName = c.exporterNameFromDNS(exporterIP)
+	}
 
 	// We need at least one of them.
 	if flow.OutIf == 0 && flow.InIf == 0 {
-		c.metrics.flowsErrors.WithLabelValues(exporterStr, "input and output interfaces missing").Inc()
+		c.metrics.flowsErrors.WithLabelValues(c.r.ExporterLabel(exporterStr), "input and output interfaces missing").Inc()
 		skip = true
 	}
 
@@ -69,7 +99,7 @@ func (c *Component) hydrateFlow(exporterIP netip.Addr, exporterStr string, flow
 		if samplingRate, ok := c.config.DefaultSamplingRate.Lookup(exporterIP); ok && samplingRate > 0 {
 			flow.SamplingRate = uint64(samplingRate)
 		} else {
-			c.metrics.flowsErrors.WithLabelValues(exporterStr, "sampling rate missing").Inc()
+			c.metrics.flowsErrors.WithLabelValues(c.r.ExporterLabel(exporterStr), "sampling rate missing").Inc()
 			skip = true
 		}
 	}
@@ -78,21 +108,48 @@ func (c *Component) hydrateFlow(exporterIP netip.Addr, exporterStr string, flow
 		return
 	}
 
+	if flow.Proto != 0 {
+		// 0 is HOPOPT, but this is also what we get when missing
+		flow.ProtoName = c.protocolNames[flow.Proto]
+	}
+
 	// Classification
-	c.classifyExporter(exporterStr, flow)
-	c.classifyInterface(exporterStr, flow,
+	rules := c.rules.Load()
+	rs := rules.forExporter(exporterIP)
+	c.classifyExporter(rs, exporterStr, flow)
+	if flow.ExporterGroup == "" {
+		flow.ExporterGroup = rs.group
+	}
+	if c.config.ExporterGeoIP {
+		country, city := c.d.GeoIP.LookupLocation(net.IP(flow.ExporterAddress))
+		flow.ExporterCountry = country
+		if flow.ExporterSite == "" {
+			flow.ExporterSite = city
+		}
+	}
+	c.classifyInterface(rs, exporterStr, flow,
 		flow.OutIfName, flow.OutIfDescription, flow.OutIfSpeed,
 		&flow.OutIfConnectivity, &flow.OutIfProvider, &flow.OutIfBoundary)
-	c.classifyInterface(exporterStr, flow,
+	c.classifyInterface(rs, exporterStr, flow,
 		flow.InIfName, flow.InIfDescription, flow.InIfSpeed,
 		&flow.InIfConnectivity, &flow.InIfProvider, &flow.InIfBoundary)
+	c.parseInterfaceDescription(rs, flow.OutIfDescription,
+		&flow.OutIfConnectivity, &flow.OutIfProvider, &flow.OutIfPeerAS)
+	c.parseInterfaceDescription(rs, flow.InIfDescription,
+		&flow.InIfConnectivity, &flow.InIfProvider, &flow.InIfPeerAS)
+	if billingGroups := rules.billingGroups; len(billingGroups) > 0 {
+		flow.InIfBillingGroup = billingGroup(billingGroups, flow.InIfConnectivity, flow.InIfProvider)
+		flow.OutIfBillingGroup = billingGroup(billingGroups, flow.OutIfConnectivity, flow.OutIfProvider)
+	}
 
 	sourceBMP := c.d.BMP.Lookup(net.IP(flow.SrcAddr), nil)
 	destBMP := c.d.BMP.Lookup(net.IP(flow.DstAddr), net.IP(flow.NextHop))
+	span = reporter.StartChildSpan(ctx, c.tracer, "geoip lookup")
 	flow.SrcAS = c.getASNumber(net.IP(flow.SrcAddr), flow.SrcAS, sourceBMP.ASN)
 	flow.DstAS = c.getASNumber(net.IP(flow.DstAddr), flow.DstAS, destBMP.ASN)
 	flow.SrcCountry = c.d.GeoIP.LookupCountry(net.IP(flow.SrcAddr))
 	flow.DstCountry = c.d.GeoIP.LookupCountry(net.IP(flow.DstAddr))
+	span.End()
 
 	flow.DstCommunities = destBMP.Communities
 	flow.DstASPath = destBMP.ASPath
@@ -108,6 +165,7 @@ func (c *Component) hydrateFlow(exporterIP netip.Addr, exporterStr string, flow
 			flow.DstLargeCommunities.LocalData2[i] = destBMP.LargeCommunities[i].LocalData2
 		}
 	}
+	flow.DstCommunityNames = c.communityNames.lookup(destBMP.Communities, destBMP.LargeCommunities)
 
 	return
 }
@@ -140,12 +198,13 @@ func (c *Component) getASNumber(flowAddr net.IP, flowAS, bmpAS uint32) (asn uint
 	return asn
 }
 
-func (c *Component) classifyExporter(ip string, flow *flow.Message) {
-	if len(c.config.ExporterClassifiers) == 0 {
+func (c *Component) classifyExporter(rs *ruleSet, ip string, flow *flow.Message) {
+	classifiers := rs.exporterClassifiers
+	if len(classifiers) == 0 {
 		return
 	}
 	name := flow.ExporterName
-	key := fmt.Sprintf("S-%s-%s", ip, name)
+	key := fmt.Sprintf("S%d-%s-%s", rs.generation, ip, name)
 	if classification, ok := c.classifierCache.Get(key); ok {
 		flow.ExporterGroup = classification.(exporterClassification).Group
 		flow.ExporterRole = classification.(exporterClassification).Role
@@ -157,7 +216,7 @@ func (c *Component) classifyExporter(ip string, flow *flow.Message) {
 
 	si := exporterInfo{IP: ip, Name: name}
 	var classification exporterClassification
-	for idx, rule := range c.config.ExporterClassifiers {
+	for idx, rule := range classifiers {
 		if err := rule.exec(si, &classification); err != nil {
 			c.classifierErrLogger.Err(err).
 				Str("type", "exporter").
@@ -181,13 +240,14 @@ func (c *Component) classifyExporter(ip string, flow *flow.Message) {
 	flow.ExporterTenant = classification.Tenant
 }
 
-func (c *Component) classifyInterface(ip string, fl *flow.Message,
+func (c *Component) classifyInterface(rs *ruleSet, ip string, fl *flow.Message,
 	ifName, ifDescription string, ifSpeed uint32,
 	connectivity, provider *string, boundary *decoder.FlowMessage_Boundary) {
-	if len(c.config.InterfaceClassifiers) == 0 {
+	classifiers := rs.interfaceClassifiers
+	if len(classifiers) == 0 {
 		return
 	}
-	key := fmt.Sprintf("I-%s-%s-%s-%s-%d", ip, fl.ExporterName, ifName, ifDescription, ifSpeed)
+	key := fmt.Sprintf("I%d-%s-%s-%s-%s-%d", rs.generation, ip, fl.ExporterName, ifName, ifDescription, ifSpeed)
 	if classification, ok := c.classifierCache.Get(key); ok {
 		*connectivity = classification.(interfaceClassification).Connectivity
 		*provider = classification.(interfaceClassification).Provider
@@ -198,7 +258,7 @@ func (c *Component) classifyInterface(ip string, fl *flow.Message,
 	si := exporterInfo{IP: ip, Name: fl.ExporterName}
 	ii := interfaceInfo{Name: ifName, Description: ifDescription, Speed: ifSpeed}
 	var classification interfaceClassification
-	for idx, rule := range c.config.InterfaceClassifiers {
+	for idx, rule := range classifiers {
 		err := rule.exec(si, ii, &classification)
 		if err != nil {
 			c.classifierErrLogger.Err(err).
@@ -225,6 +285,32 @@ func (c *Component) classifyInterface(ip string, fl *flow.Message,
 	*boundary = convertBoundaryToProto(classification.Boundary)
 }
 
+// parseInterfaceDescription extracts the attributes of an interface
+// from its description. Connectivity and provider are only set when
+// the classifiers did not already provide them.
+func (c *Component) parseInterfaceDescription(rs *ruleSet, ifDescription string,
+	connectivity, provider *string, peerAS *uint32) {
+	parsers := rs.descriptionParsers
+	if len(parsers) == 0 || ifDescription == "" {
+		return
+	}
+	var attributes descriptionAttributes
+	key := fmt.Sprintf("D%d-%s-%s", rs.generation, rs.group, ifDescription)
+	if cached, ok := c.classifierCache.Get(key); ok {
+		attributes = cached.(descriptionAttributes)
+	} else {
+		attributes = parseDescription(parsers, ifDescription)
+		c.classifierCache.Set(key, attributes, 1)
+	}
+	if *connectivity == "" {
+		*connectivity = attributes.Connectivity
+	}
+	if *provider == "" {
+		*provider = attributes.Provider
+	}
+	*peerAS = attributes.PeerAS
+}
+
 func convertBoundaryToProto(from interfaceBoundary) decoder.FlowMessage_Boundary {
 	switch from {
 	case externalBoundary:
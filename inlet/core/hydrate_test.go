@@ -168,6 +168,33 @@ func TestHydrate(t *testing.T) {
 				InIfSpeed:        1000,
 				OutIfSpeed:       1000,
 			},
+		}, {
+			Name: "exporter GeoIP",
+			Configuration: gin.H{
+				"exportergeoip": true,
+			},
+			InputFlow: func() *flow.Message {
+				return &flow.Message{
+					SamplingRate:    1000,
+					ExporterAddress: net.ParseIP("2.125.160.216"),
+					InIf:            100,
+					OutIf:           200,
+				}
+			},
+			OutputFlow: &flow.Message{
+				SamplingRate:     1000,
+				ExporterAddress:  net.ParseIP("2.125.160.216"),
+				ExporterName:     "2_125_160_216",
+				ExporterCountry:  "GB",
+				InIf:             100,
+				OutIf:            200,
+				InIfName:         "Gi0/0/100",
+				OutIfName:        "Gi0/0/200",
+				InIfDescription:  "Interface 100",
+				OutIfDescription: "Interface 200",
+				InIfSpeed:        1000,
+				OutIfSpeed:       1000,
+			},
 		}, {
 			Name: "interface rule",
 			Configuration: gin.H{
@@ -203,6 +230,87 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 				InIfBoundary:     2, // Internal
 				OutIfBoundary:    2,
 			},
+		}, {
+			Name: "parse interface descriptions",
+			Configuration: gin.H{
+				"interfaceclassifiers": []string{
+					`Interface.Name endsWith "/200" && ClassifyProvider("Telia")`,
+				},
+				"interfacedescriptionparsers": []gin.H{
+					{
+						"regex":        `^Interface (\d)(\d+)$`,
+						"provider":     "provider$1",
+						"connectivity": "transit",
+						"peeras":       "AS6450$2",
+					},
+				},
+			},
+			InputFlow: func() *flow.Message {
+				return &flow.Message{
+					SamplingRate:    1000,
+					ExporterAddress: net.ParseIP("192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+				}
+			},
+			OutputFlow: &flow.Message{
+				SamplingRate:      1000,
+				ExporterAddress:   net.ParseIP("192.0.2.142"),
+				ExporterName:      "192_0_2_142",
+				InIf:              100,
+				OutIf:             200,
+				InIfName:          "Gi0/0/100",
+				OutIfName:         "Gi0/0/200",
+				InIfDescription:   "Interface 100",
+				OutIfDescription:  "Interface 200",
+				InIfSpeed:         1000,
+				OutIfSpeed:        1000,
+				InIfProvider:      "provider1",
+				OutIfProvider:     "telia",
+				InIfConnectivity:  "transit",
+				OutIfConnectivity: "transit",
+				InIfPeerAS:        645000,
+				OutIfPeerAS:       645000,
+			},
+		}, {
+			Name: "billing groups",
+			Configuration: gin.H{
+				"interfaceclassifiers": []string{
+					`Interface.Name endsWith "/100" && ClassifyConnectivity("transit") && ClassifyProvider("Cogent")`,
+					`Interface.Name endsWith "/200" && ClassifyConnectivity("PNI") && ClassifyProvider("Netflix")`,
+				},
+				"billinggroups": []gin.H{
+					{"name": "transit", "connectivity": []string{"Transit"}},
+					{"name": "peering", "connectivity": []string{"pni", "ix"}},
+				},
+			},
+			InputFlow: func() *flow.Message {
+				return &flow.Message{
+					SamplingRate:    1000,
+					ExporterAddress: net.ParseIP("192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+				}
+			},
+			OutputFlow: &flow.Message{
+				SamplingRate:      1000,
+				ExporterAddress:   net.ParseIP("192.0.2.142"),
+				ExporterName:      "192_0_2_142",
+				InIf:              100,
+				OutIf:             200,
+				InIfName:          "Gi0/0/100",
+				OutIfName:         "Gi0/0/200",
+				InIfDescription:   "Interface 100",
+				OutIfDescription:  "Interface 200",
+				InIfSpeed:         1000,
+				OutIfSpeed:        1000,
+				InIfProvider:      "cogent",
+				OutIfProvider:     "netflix",
+				InIfConnectivity:  "transit",
+				OutIfConnectivity: "pni",
+				InIfBillingGroup:  "transit",
+				OutIfBillingGroup: "peering",
+			},
 		}, {
 			Name: "configure twice boundary",
 			Configuration: gin.H{
@@ -336,6 +444,169 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 					ASN: []uint32{64200}, LocalData1: []uint32{2}, LocalData2: []uint32{3},
 				},
 			},
+		}, {
+			Name: "name BGP communities",
+			Configuration: gin.H{
+				"communitynames": gin.H{
+					"0:200":       "customer:acme",
+					"0:300":       "transit",
+					"64200:2:3":   "region:europe",
+					"65535:65535": "unused",
+				},
+			},
+			InputFlow: func() *flow.Message {
+				return &flow.Message{
+					SamplingRate:    1000,
+					ExporterAddress: net.ParseIP("192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+					SrcAddr:         net.ParseIP("192.0.2.142"),
+					DstAddr:         net.ParseIP("192.0.2.10"),
+				}
+			},
+			OutputFlow: &flow.Message{
+				SamplingRate:     1000,
+				ExporterAddress:  net.ParseIP("192.0.2.142"),
+				ExporterName:     "192_0_2_142",
+				InIf:             100,
+				OutIf:            200,
+				InIfName:         "Gi0/0/100",
+				OutIfName:        "Gi0/0/200",
+				InIfDescription:  "Interface 100",
+				OutIfDescription: "Interface 200",
+				InIfSpeed:        1000,
+				OutIfSpeed:       1000,
+				SrcAddr:          net.ParseIP("192.0.2.142").To16(),
+				DstAddr:          net.ParseIP("192.0.2.10").To16(),
+				SrcAS:            1299,
+				DstAS:            174,
+				DstASPath:        []uint32{64200, 1299, 174},
+				DstCommunities:   []uint32{100, 200, 400},
+				DstLargeCommunities: &decoder.FlowMessage_LargeCommunities{
+					ASN: []uint32{64200}, LocalData1: []uint32{2}, LocalData2: []uint32{3},
+				},
+				DstCommunityNames: []string{"customer:acme", "region:europe"},
+			},
+		}, {
+			Name: "protocol names",
+			Configuration: gin.H{
+				"protocol-names": gin.H{
+					"17": "udp",
+					"47": "gre",
+				},
+			},
+			InputFlow: func() *flow.Message {
+				return &flow.Message{
+					SamplingRate:    1000,
+					ExporterAddress: net.ParseIP("192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+					Proto:           17,
+				}
+			},
+			OutputFlow: &flow.Message{
+				SamplingRate:     1000,
+				ExporterAddress:  net.ParseIP("192.0.2.142"),
+				ExporterName:     "192_0_2_142",
+				InIf:             100,
+				OutIf:            200,
+				InIfName:         "Gi0/0/100",
+				OutIfName:        "Gi0/0/200",
+				InIfDescription:  "Interface 100",
+				OutIfDescription: "Interface 200",
+				InIfSpeed:        1000,
+				OutIfSpeed:       1000,
+				Proto:            17,
+				ProtoName:        "udp",
+			},
+		}, {
+			Name: "exporter group",
+			Configuration: gin.H{
+				"interfaceclassifiers": []string{
+					`ClassifyInternal()`,
+				},
+				"exportergroups": gin.H{
+					"192.0.2.128/25": gin.H{
+						"name": "customer-a",
+						"interfaceclassifiers": []string{
+							`Interface.Name endsWith "/100" && ClassifyExternal()`,
+							`ClassifyProvider("customer-a")`,
+						},
+					},
+					"198.51.100.0/24": gin.H{
+						"name":       "customer-b",
+						"dropfilter": "InIfBoundary = internal",
+					},
+				},
+			},
+			InputFlow: func() *flow.Message {
+				return &flow.Message{
+					SamplingRate:    1000,
+					ExporterAddress: net.ParseIP("192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+				}
+			},
+			OutputFlow: &flow.Message{
+				SamplingRate:     1000,
+				ExporterAddress:  net.ParseIP("192.0.2.142"),
+				ExporterName:     "192_0_2_142",
+				ExporterGroup:    "customer-a",
+				InIf:             100,
+				OutIf:            200,
+				InIfName:         "Gi0/0/100",
+				OutIfName:        "Gi0/0/200",
+				InIfDescription:  "Interface 100",
+				OutIfDescription: "Interface 200",
+				InIfSpeed:        1000,
+				OutIfSpeed:       1000,
+				InIfBoundary:     1, // External
+				InIfProvider:     "customer-a",
+				OutIfProvider:    "customer-a",
+			},
+		}, {
+			Name: "replayed flow with interface already named",
+			Configuration: gin.H{
+				"interfaceclassifiers": []string{
+					`
+Interface.Description startsWith "Transit:" &&
+ClassifyConnectivity("transit") &&
+ClassifyExternal() &&
+ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
+					`ClassifyInternal()`,
+				},
+			},
+			InputFlow: func() *flow.Message {
+				return &flow.Message{
+					SamplingRate:     1000,
+					ExporterAddress:  net.ParseIP("192.0.2.142"),
+					ExporterName:     "192_0_2_142",
+					InIf:             100,
+					OutIf:            200,
+					InIfName:         "Gi0/0/10",
+					InIfDescription:  "Transit: Cogent",
+					InIfSpeed:        10000,
+					InIfConnectivity: "unknown",
+					InIfBoundary:     2,
+				}
+			},
+			OutputFlow: &flow.Message{
+				SamplingRate:     1000,
+				ExporterAddress:  net.ParseIP("192.0.2.142"),
+				ExporterName:     "192_0_2_142",
+				InIf:             100,
+				OutIf:            200,
+				InIfName:         "Gi0/0/10",
+				OutIfName:        "Gi0/0/200",
+				InIfDescription:  "Transit: Cogent",
+				OutIfDescription: "Interface 200",
+				InIfSpeed:        10000,
+				OutIfSpeed:       1000,
+				InIfConnectivity: "transit",
+				InIfProvider:     "cogent",
+				InIfBoundary:     1, // External
+				OutIfBoundary:    2,
+			},
 		},
 	}
 	for _, tc := range cases {
@@ -355,6 +626,7 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 
 			// Prepare a configuration
 			configuration := DefaultConfiguration()
+			configuration.SNMPWait = 0
 			decoder, err := mapstructure.NewDecoder(helpers.GetMapStructureDecoderConfig(&configuration))
 			if err != nil {
 				t.Fatalf("NewDecoder() error:\n%+v", err)
@@ -369,7 +641,7 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 				Flow:   flowComponent,
 				SNMP:   snmpComponent,
 				GeoIP:  geoipComponent,
-				Kafka:  kafkaComponent,
+				Output: kafkaComponent,
 				HTTP:   httpComponent,
 				BMP:    bmpComponent,
 			})
@@ -408,12 +680,16 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 			case <-time.After(1 * time.Second):
 				t.Fatal("Kafka message not received")
 			}
+			exporter := net.IP(tc.InputFlow().ExporterAddress).String()
 			gotMetrics := r.GetMetrics("akvorado_inlet_core_flows_")
 			expectedMetrics := map[string]string{
-				`errors{error="SNMP cache miss",exporter="192.0.2.142"}`: "1",
-				`http_clients`:                      "0",
-				`received{exporter="192.0.2.142"}`:  "2",
-				`forwarded{exporter="192.0.2.142"}`: "1",
+				fmt.Sprintf(`errors{error="SNMP cache miss",exporter="%s"}`, exporter): "1",
+				`http_clients`: "0",
+				`tail_clients`: "0",
+				`tail_dropped`: "0",
+				`waiting`:      "0",
+				fmt.Sprintf(`received{exporter="%s"}`, exporter):  "2",
+				fmt.Sprintf(`forwarded{exporter="%s"}`, exporter): "1",
 			}
 			if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 				t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -13,11 +13,19 @@ type metrics struct {
 	flowsReceived    *reporter.CounterVec
 	flowsForwarded   *reporter.CounterVec
 	flowsErrors      *reporter.CounterVec
+	flowsFiltered    *reporter.CounterVec
+	flowsScanSuspect *reporter.CounterVec
+	exportDelay      *reporter.HistogramVec
+	flowsWaiting     reporter.GaugeFunc
 	flowsHTTPClients reporter.GaugeFunc
+	flowsTailClients reporter.GaugeFunc
+	flowsTailDropped reporter.Counter
 
 	classifierCacheHits   reporter.CounterFunc
 	classifierCacheMisses reporter.CounterFunc
 	classifierErrors      *reporter.CounterVec
+
+	reverseDNSRequests *reporter.CounterVec
 }
 
 func (c *Component) initMetrics() {
@@ -42,6 +50,39 @@ func (c *Component) initMetrics() {
 		},
 		[]string{"exporter", "error"},
 	)
+	c.metrics.flowsFiltered = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_filtered",
+			Help: "Number of flows dropped by the drop filter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.flowsScanSuspect = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_scan_suspect",
+			Help: "Number of flows flagged as a port scan or a host sweep.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.exportDelay = c.r.HistogramVec(
+		reporter.HistogramOpts{
+			Name:    "export_delay_seconds",
+			Help:    "Delay between the end of a flow and its reception.",
+			Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.flowsWaiting = c.r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "flows_waiting",
+			Help: "Number of flows waiting for their interfaces to be polled.",
+		},
+		func() float64 {
+			c.waiting.lock.Lock()
+			defer c.waiting.lock.Unlock()
+			return float64(c.waiting.count)
+		},
+	)
 	c.metrics.flowsHTTPClients = c.r.GaugeFunc(
 		reporter.GaugeOpts{
 			Name: "flows_http_clients",
@@ -51,6 +92,21 @@ func (c *Component) initMetrics() {
 			return float64(atomic.LoadUint32(&c.httpFlowClients))
 		},
 	)
+	c.metrics.flowsTailClients = c.r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "flows_tail_clients",
+			Help: "Number of WebSocket clients following flows.",
+		},
+		func() float64 {
+			return float64(atomic.LoadInt32(&c.tailClients))
+		},
+	)
+	c.metrics.flowsTailDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_tail_dropped",
+			Help: "Number of flows not sent to WebSocket clients because of rate limiting or slow clients.",
+		},
+	)
 
 	c.metrics.classifierCacheHits = c.r.CounterFunc(
 		reporter.CounterOpts{
@@ -76,4 +132,19 @@ func (c *Component) initMetrics() {
 			Help: "Number of errors when evaluating a classifer",
 		},
 		[]string{"type", "index"})
+
+	c.metrics.reverseDNSRequests = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "reverse_dns_requests",
+			Help: "Number of reverse DNS requests to name exporters.",
+		},
+		[]string{"result"})
+
+	c.r.MetricCollector(exporterCollector{
+		c: c,
+		lastFlow: c.r.MetricDesc(
+			"exporter_last_flow_seconds",
+			"Unix time of the last flow received from an exporter.",
+			[]string{"exporter"}),
+	})
 }
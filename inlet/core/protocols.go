@@ -0,0 +1,19 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import "akvorado/inlet/flow"
+
+// newProtocolNames builds the translation table from protocol numbers
+// to names, using the IANA table and the provided overrides.
+func newProtocolNames(overrides map[uint8]string) map[uint32]string {
+	names := make(map[uint32]string, len(flow.ProtocolNames)+len(overrides))
+	for proto, name := range flow.ProtocolNames {
+		names[proto] = name
+	}
+	for proto, name := range overrides {
+		names[uint32(proto)] = name
+	}
+	return names
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// reverseDNSTimeout is the maximum time to wait for a PTR answer.
+	reverseDNSTimeout = 2 * time.Second
+	// reverseDNSNegativeTTL is how long a failed resolution is cached.
+	reverseDNSNegativeTTL = time.Minute
+)
+
+// reverseDNS resolves exporter addresses to names using PTR records.
+// Lookups never block: a missing or expired entry is queued for
+// resolution and the cached name (if any) is returned meanwhile.
+type reverseDNS struct {
+	lock     sync.Mutex
+	ttl      time.Duration
+	entries  map[netip.Addr]*reverseDNSEntry
+	requests chan netip.Addr
+	resolve  func(ctx context.Context, addr string) ([]string, error)
+}
+
+// reverseDNSEntry is a cached answer for an exporter address.
+type reverseDNSEntry struct {
+	name    string
+	expires time.Time
+	pending bool
+}
+
+// newReverseDNS creates a new reverse DNS resolver caching answers
+// for the provided TTL.
+func newReverseDNS(ttl time.Duration, resolve func(ctx context.Context, addr string) ([]string, error)) *reverseDNS {
+	return &reverseDNS{
+		ttl:      ttl,
+		entries:  map[netip.Addr]*reverseDNSEntry{},
+		requests: make(chan netip.Addr, 100),
+		resolve:  resolve,
+	}
+}
+
+// Lookup returns the cached name for the provided address. It returns
+// an empty string when the name is not known yet. In this case, or
+// when the entry is expired, a resolution is requested.
+func (rd *reverseDNS) Lookup(now time.Time, addr netip.Addr) string {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+	entry, ok := rd.entries[addr]
+	if ok && (entry.pending || now.Before(entry.expires)) {
+		return entry.name
+	}
+	if !ok {
+		entry = &reverseDNSEntry{}
+		rd.entries[addr] = entry
+	}
+	select {
+	case rd.requests <- addr:
+		entry.pending = true
+	default:
+		// Queue is full, we will try again on the next flow.
+		if !ok {
+			delete(rd.entries, addr)
+		}
+	}
+	return entry.name
+}
+
+// resolveOne resolves the provided address and updates the cache. It
+// returns true if a name was found.
+func (rd *reverseDNS) resolveOne(ctx context.Context, now time.Time, addr netip.Addr) bool {
+	ctx, cancel := context.WithTimeout(ctx, reverseDNSTimeout)
+	defer cancel()
+	names, err := rd.resolve(ctx, addr.Unmap().String())
+	var name string
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+	entry, ok := rd.entries[addr]
+	if !ok {
+		entry = &reverseDNSEntry{}
+		rd.entries[addr] = entry
+	}
+	entry.pending = false
+	if name == "" {
+		// Keep the previous name, if any, but retry sooner.
+		entry.expires = now.Add(reverseDNSNegativeTTL)
+		return false
+	}
+	entry.name = name
+	entry.expires = now.Add(rd.ttl)
+	return true
+}
+
+// runReverseDNS resolves the exporter addresses requested by the
+// workers.
+func (c *Component) runReverseDNS() error {
+	ctx := c.t.Context(context.Background())
+	for {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case addr := <-c.reverseDNS.requests:
+			if c.reverseDNS.resolveOne(ctx, time.Now(), addr) {
+				c.metrics.reverseDNSRequests.WithLabelValues("success").Inc()
+			} else {
+				c.metrics.reverseDNSRequests.WithLabelValues("failure").Inc()
+			}
+		}
+	}
+}
+
+// exporterNameFromDNS returns the name of the provided exporter from
+// reverse DNS, if enabled for this exporter.
+func (c *Component) exporterNameFromDNS(exporterIP netip.Addr) string {
+	if enabled, ok := c.config.ReverseDNS.Lookup(exporterIP); !ok || !enabled {
+		return ""
+	}
+	return c.reverseDNS.Lookup(time.Now(), exporterIP)
+}
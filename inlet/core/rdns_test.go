@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestReverseDNS(t *testing.T) {
+	answers := map[string][]string{
+		"192.0.2.142": {"edge1.example.net."},
+	}
+	rd := newReverseDNS(time.Hour, func(_ context.Context, addr string) ([]string, error) {
+		if names, ok := answers[addr]; ok {
+			return names, nil
+		}
+		return nil, errors.New("no such host")
+	})
+	now := time.Date(2022, time.October, 10, 10, 0, 0, 0, time.UTC)
+	exporter1 := netip.MustParseAddr("::ffff:192.0.2.142")
+	exporter2 := netip.MustParseAddr("::ffff:192.0.2.143")
+
+	// Not resolved yet: a request is queued once.
+	if got := rd.Lookup(now, exporter1); got != "" {
+		t.Errorf("Lookup() == %q, expected empty name", got)
+	}
+	if got := rd.Lookup(now, exporter1); got != "" {
+		t.Errorf("Lookup() == %q, expected empty name", got)
+	}
+	if got := len(rd.requests); got != 1 {
+		t.Fatalf("len(requests) == %d, expected 1", got)
+	}
+	if !rd.resolveOne(context.Background(), now, <-rd.requests) {
+		t.Error("resolveOne() == false, expected true")
+	}
+	if got := rd.Lookup(now, exporter1); got != "edge1.example.net" {
+		t.Errorf("Lookup() == %q, expected %q", got, "edge1.example.net")
+	}
+
+	// Failed resolution is retried after a minute.
+	rd.Lookup(now, exporter2)
+	if rd.resolveOne(context.Background(), now, <-rd.requests) {
+		t.Error("resolveOne() == true, expected false")
+	}
+	rd.Lookup(now.Add(30*time.Second), exporter2)
+	if got := len(rd.requests); got != 0 {
+		t.Fatalf("len(requests) == %d, expected 0", got)
+	}
+	rd.Lookup(now.Add(2*time.Minute), exporter2)
+	if got := len(rd.requests); got != 1 {
+		t.Fatalf("len(requests) == %d, expected 1", got)
+	}
+	<-rd.requests
+
+	// Once expired, the name is still returned while refreshing.
+	answers["192.0.2.142"] = []string{"edge2.example.net."}
+	later := now.Add(2 * time.Hour)
+	if got := rd.Lookup(later, exporter1); got != "edge1.example.net" {
+		t.Errorf("Lookup() == %q, expected %q", got, "edge1.example.net")
+	}
+	rd.resolveOne(context.Background(), later, <-rd.requests)
+	if got := rd.Lookup(later, exporter1); got != "edge2.example.net" {
+		t.Errorf("Lookup() == %q, expected %q", got, "edge2.example.net")
+	}
+
+	// A failed refresh keeps the previous name.
+	delete(answers, "192.0.2.142")
+	later = later.Add(2 * time.Hour)
+	rd.Lookup(later, exporter1)
+	rd.resolveOne(context.Background(), later, <-rd.requests)
+	if got := rd.Lookup(later, exporter1); got != "edge2.example.net" {
+		t.Errorf("Lookup() == %q, expected %q", got, "edge2.example.net")
+	}
+}
+
+func TestReverseDNSQueueFull(t *testing.T) {
+	rd := newReverseDNS(time.Hour, func(_ context.Context, _ string) ([]string, error) {
+		return []string{"edge.example.net."}, nil
+	})
+	now := time.Now()
+	for i := 0; i < cap(rd.requests)+10; i++ {
+		rd.Lookup(now, netip.AddrFrom4([4]byte{192, 0, 2, byte(i)}))
+	}
+	if got := len(rd.entries); got != cap(rd.requests) {
+		t.Errorf("len(entries) == %d, expected %d", got, cap(rd.requests))
+	}
+}
@@ -5,23 +5,25 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/netip"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
-	"github.com/golang/protobuf/proto"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/http"
 	"akvorado/common/reporter"
 	"akvorado/inlet/bmp"
 	"akvorado/inlet/flow"
 	"akvorado/inlet/geoip"
-	"akvorado/inlet/kafka"
 	"akvorado/inlet/snmp"
 )
 
@@ -31,6 +33,7 @@ type Component struct {
 	d      *Dependencies
 	t      tomb.Tomb
 	config Configuration
+	tracer trace.Tracer
 
 	metrics metrics
 
@@ -38,6 +41,19 @@ type Component struct {
 	httpFlowClients    uint32 // for dumping flows
 	httpFlowChannel    chan *flow.Message
 	httpFlowFlushDelay time.Duration
+	broadcaster        *Broadcaster
+	recycleFlows       bool
+	tailClients        int32 // for WebSocket clients
+	exporters          sync.Map
+	rules              atomic.Pointer[rules]
+	waiting            waitLists
+	polled             chan netip.Addr
+	retries            chan waitingFlow
+	communityNames     *communityNames
+	protocolNames      map[uint32]string
+	customFields       []customField
+	scans              *scanDetector
+	reverseDNS         *reverseDNS
 
 	classifierCache     *ristretto.Cache
 	classifierErrLogger reporter.Logger
@@ -50,10 +66,39 @@ type Dependencies struct {
 	SNMP   *snmp.Component
 	BMP    *bmp.Component
 	GeoIP  *geoip.Component
-	Kafka  *kafka.Component
+	Output Output
 	HTTP   *http.Component
 }
 
+// Output is the interface of a component sending hydrated flows to
+// their destination (Kafka, for example).
+type Output interface {
+	Send(exporter string, fl *flow.Message)
+}
+
+// ContextOutput is implemented by outputs able to trace the sending of
+// a flow using the span found in the provided context.
+type ContextOutput interface {
+	SendContext(ctx context.Context, exporter string, fl *flow.Message)
+}
+
+// SynchronousOutput is implemented by outputs which do not keep a
+// reference to a flow once Send() returns. When no one else needs
+// them, flows sent to such an output are recycled.
+type SynchronousOutput interface {
+	Synchronous() bool
+}
+
+// SendContext sends a flow to the provided output, with the provided
+// context if the output accepts one.
+func SendContext(ctx context.Context, output Output, exporter string, fl *flow.Message) {
+	if output, ok := output.(ContextOutput); ok {
+		output.SendContext(ctx, exporter, fl)
+		return
+	}
+	output.Send(exporter, fl)
+}
+
 // New creates a new core component.
 func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
 	cache, err := ristretto.NewCache(&ristretto.Config{
@@ -65,8 +110,22 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 	if err != nil {
 		return nil, fmt.Errorf("cannot initialize classifier cache: %w", err)
 	}
+	communityNames, err := newCommunityNames(configuration.CommunityNames)
+	if err != nil {
+		return nil, err
+	}
+	var customFields []customField
+	if dependencies.Flow != nil {
+		customFields, err = newCustomFields(dependencies.Flow.CustomFields())
+		if err != nil {
+			return nil, err
+		}
+	}
+	scans := newScanDetector(configuration.ScanWindow,
+		configuration.ScanMaxPorts, configuration.ScanMaxHosts)
 	c := Component{
 		r:      r,
+		tracer: r.Tracer(),
 		d:      &dependencies,
 		config: configuration,
 
@@ -74,15 +133,56 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		httpFlowClients:    0,
 		httpFlowChannel:    make(chan *flow.Message, 10),
 		httpFlowFlushDelay: time.Second,
+		broadcaster:        NewBroadcaster(),
+		waiting:            waitLists{flows: make(map[netip.Addr][]waitingFlow)},
+		polled:             make(chan netip.Addr, 100),
+		retries:            make(chan waitingFlow, configuration.Workers),
+		communityNames:     communityNames,
+		protocolNames:      newProtocolNames(configuration.ProtocolNames),
+		customFields:       customFields,
+		scans:              scans,
+		reverseDNS:         newReverseDNS(configuration.ReverseDNSCacheDuration, net.DefaultResolver.LookupAddr),
 
 		classifierCache:     cache,
 		classifierErrLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
 	}
+	if output, ok := dependencies.Output.(SynchronousOutput); ok {
+		c.recycleFlows = output.Synchronous()
+	}
+	c.rules.Store(newRules(0, configuration))
 	c.d.Daemon.Track(&c.t, "inlet/core")
 	c.initMetrics()
 	return &c, nil
 }
 
+// rules are the settings of the core component which can be changed
+// while running.
+type rules struct {
+	generation    uint64 // used to invalidate the classifier cache
+	global        ruleSet
+	groups        *helpers.SubnetMap[*ruleSet]
+	billingGroups []BillingGroupRule
+}
+
+// newRules extracts the rules from the provided configuration.
+func newRules(generation uint64, configuration Configuration) *rules {
+	r := rules{
+		generation: generation,
+		global: ruleSet{
+			generation:           generation,
+			exporterClassifiers:  configuration.ExporterClassifiers,
+			interfaceClassifiers: configuration.InterfaceClassifiers,
+			descriptionParsers:   configuration.InterfaceDescriptionParsers,
+		},
+		billingGroups: normalizeBillingGroups(configuration.BillingGroups),
+	}
+	if configuration.DropFilter.String() != "" {
+		r.global.dropFilter = &configuration.DropFilter
+	}
+	r.groups = newGroupRuleSets(&r.global, configuration.ExporterGroups)
+	return &r
+}
+
 // Start starts the core component.
 func (c *Component) Start() error {
 	c.r.Info().Msg("starting core component")
@@ -95,14 +195,39 @@ func (c *Component) Start() error {
 
 	c.r.RegisterHealthcheck("core", c.channelHealthcheck())
 	c.d.HTTP.GinRouter.GET("/api/v0/inlet/flows", c.FlowsHTTPHandler)
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/flows/tail", c.FlowsTailHandler)
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/exporters", c.ExportersHTTPHandler)
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/exporters/stale", c.StaleExportersHTTPHandler)
+	c.t.Go(c.runExporterRates)
+	c.t.Go(c.runReverseDNS)
+	if c.config.SNMPWait > 0 {
+		c.d.SNMP.NotifyPolled(c.polled)
+		c.t.Go(c.runWaiter)
+	}
 	return nil
 }
 
+// Reload applies the changes to the classifiers, to the interface
+// description parsers, to the billing groups, to the drop filter and
+// to the exporter groups from the provided configuration. It returns the other settings which
+// were modified and need a restart.
+func (c *Component) Reload(configuration Configuration) ([]string, error) {
+	restart := helpers.ChangedFields(c.config, configuration,
+		"ExporterClassifiers", "InterfaceClassifiers", "InterfaceDescriptionParsers", "BillingGroups", "DropFilter", "ExporterGroups")
+	c.rules.Store(newRules(c.rules.Load().generation+1, configuration))
+	c.config.ExporterClassifiers = configuration.ExporterClassifiers
+	c.config.InterfaceClassifiers = configuration.InterfaceClassifiers
+	c.config.InterfaceDescriptionParsers = configuration.InterfaceDescriptionParsers
+	c.config.BillingGroups = configuration.BillingGroups
+	c.config.DropFilter = configuration.DropFilter
+	c.config.ExporterGroups = configuration.ExporterGroups
+	return restart, nil
+}
+
 // runWorker starts a worker.
 func (c *Component) runWorker(workerID int) error {
 	c.r.Debug().Int("worker", workerID).Msg("starting core worker")
 
-	errLogger := c.r.Sample(reporter.BurstSampler(time.Minute, 10))
 	for {
 		select {
 		case <-c.t.Dying():
@@ -119,39 +244,98 @@ func (c *Component) runWorker(workerID int) error {
 			}
 
 			exporter := net.IP(flow.ExporterAddress).String()
-			c.metrics.flowsReceived.WithLabelValues(exporter).Inc()
-
-			// Hydratation
-			ip, _ := netip.AddrFromSlice(flow.ExporterAddress)
-			if skip := c.hydrateFlow(ip, exporter, flow); skip {
-				continue
+			c.metrics.flowsReceived.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+			if flow.TimeFlowEnd > 0 && flow.TimeFlowEnd <= flow.TimeReceived {
+				c.metrics.exportDelay.WithLabelValues(c.r.ExporterLabel(exporter)).
+					Observe(float64(flow.TimeReceived - flow.TimeFlowEnd))
 			}
+			ip, _ := netip.AddrFromSlice(flow.ExporterAddress)
+			c.exporterSeen(exporter, ip)
+			c.processFlow(waitingFlow{
+				ctx:      c.d.Flow.TraceContext(flow),
+				flow:     flow,
+				exporter: exporter,
+				ip:       ip,
+			})
+		case wf := <-c.retries:
+			c.processFlow(wf)
+		}
+	}
+}
 
-			// Serialize flow (use length-prefixed protobuf)
-			buf := proto.NewBuffer([]byte{})
-			err := buf.EncodeMessage(flow)
-			if err != nil {
-				errLogger.Err(err).Str("exporter", exporter).Msg("unable to serialize flow")
-				c.metrics.flowsErrors.WithLabelValues(exporter, err.Error()).Inc()
-				continue
-			}
+// processFlow enriches a flow and forwards it to the output. In
+// passthrough mode, the flow is forwarded as is.
+func (c *Component) processFlow(wf waitingFlow) {
+	fl := wf.flow
+	exporterLabel := c.r.ExporterLabel(wf.exporter)
 
-			// Forward to Kafka (this could block)
-			c.metrics.flowsForwarded.WithLabelValues(exporter).Inc()
-			c.d.Kafka.Send(exporter, buf.Bytes())
+	if !c.config.Passthrough && !c.enrichFlow(wf, exporterLabel) {
+		return
+	}
 
-			// If we have HTTP clients, send to them too
-			if atomic.LoadUint32(&c.httpFlowClients) > 0 {
-				select {
-				case c.httpFlowChannel <- flow: // OK
-				default: // Overflow, best effort and ignore
-				}
-			}
+	// Forward to output (this could block)
+	c.metrics.flowsForwarded.WithLabelValues(exporterLabel).Inc()
+	SendContext(wf.ctx, c.d.Output, wf.exporter, fl)
+	if c.broadcaster.Subscriptions() == 0 && atomic.LoadUint32(&c.httpFlowClients) == 0 {
+		// Nobody else needs this flow
+		if c.recycleFlows {
+			releaseFlow(fl)
+		}
+		return
+	}
+	c.broadcaster.Publish(fl)
 
+	// If we have HTTP clients, send to them too
+	if atomic.LoadUint32(&c.httpFlowClients) > 0 {
+		select {
+		case c.httpFlowChannel <- fl: // OK
+		default: // Overflow, best effort and ignore
 		}
 	}
 }
 
+// enrichFlow hydrates a flow, applies the drop filter and computes
+// the custom fields. If its interfaces are not in the SNMP cache, the
+// flow is parked until they are polled or until the deadline is past.
+// Only the first attempt triggers a poll. It returns false when the
+// flow should not be forwarded.
+func (c *Component) enrichFlow(wf waitingFlow, exporterLabel string) bool {
+	fl := wf.flow
+
+	// Hydratation
+	firstAttempt := wf.deadline.IsZero()
+	wait := c.config.SNMPWait > 0 && (firstAttempt || time.Now().Before(wf.deadline))
+	skip, missing := c.hydrateFlow(wf.ctx, wf.ip, wf.exporter, fl, wait, firstAttempt)
+	if missing {
+		if !c.parkFlow(wf) {
+			c.metrics.flowsErrors.WithLabelValues(exporterLabel, "SNMP wait queue full").Inc()
+			releaseFlow(fl)
+		}
+		return false
+	}
+	if skip {
+		releaseFlow(fl)
+		return false
+	}
+	if dropFilter := c.rules.Load().forExporter(wf.ip).dropFilter; dropFilter != nil && dropFilter.Match(fl) {
+		c.metrics.flowsFiltered.WithLabelValues(exporterLabel).Inc()
+		releaseFlow(fl)
+		return false
+	}
+	if c.scans != nil && c.scans.observe(time.Now(), fl) {
+		fl.ScanSuspect = true
+		c.metrics.flowsScanSuspect.WithLabelValues(exporterLabel).Inc()
+	}
+	c.computeCustomFields(exporterLabel, fl)
+	return true
+}
+
+// releaseFlow recycles a flow. It should not be referenced anywhere
+// else.
+func releaseFlow(fl *flow.Message) {
+	flow.ReleaseMessage(fl)
+}
+
 // Stop stops the core component.
 func (c *Component) Stop() error {
 	defer func() {
@@ -161,7 +345,18 @@ func (c *Component) Stop() error {
 	}()
 	c.r.Info().Msg("stopping core component")
 	c.t.Kill(nil)
-	return c.t.Wait()
+	err := c.t.Wait()
+
+	// Drop the flows still waiting for their interfaces
+	c.abortWaiting(c.unparkAll())
+	for {
+		select {
+		case wf := <-c.retries:
+			c.abortWaiting([]waitingFlow{wf})
+		default:
+			return err
+		}
+	}
 }
 
 func (c *Component) channelHealthcheck() reporter.HealthcheckFunc {
@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"net"
 	netHTTP "net/http"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -45,12 +46,14 @@ func TestCore(t *testing.T) {
 	bmpComponent.PopulateRIB(t)
 
 	// Instantiate and start core
-	c, err := New(r, DefaultConfiguration(), Dependencies{
+	configuration := DefaultConfiguration()
+	configuration.SNMPWait = 0
+	c, err := New(r, configuration, Dependencies{
 		Daemon: daemonComponent,
 		Flow:   flowComponent,
 		SNMP:   snmpComponent,
 		GeoIP:  geoipComponent,
-		Kafka:  kafkaComponent,
+		Output: kafkaComponent,
 		HTTP:   httpComponent,
 		BMP:    bmpComponent,
 	})
@@ -90,7 +93,7 @@ func TestCore(t *testing.T) {
 		flowComponent.Inject(t, flowMessage("192.0.2.143", 434, 679))
 
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_core_")
+		gotMetrics := r.GetMetrics("akvorado_inlet_core_", "classifier_", "flows_")
 		expectedMetrics := map[string]string{
 			`classifier_cache_hits`:   "0",
 			`classifier_cache_misses`: "0",
@@ -99,6 +102,9 @@ func TestCore(t *testing.T) {
 			`flows_received{exporter="192.0.2.142"}`:                       "1",
 			`flows_received{exporter="192.0.2.143"}`:                       "3",
 			`flows_http_clients`:                                           "0",
+			`flows_tail_clients`:                                           "0",
+			`flows_tail_dropped`:                                           "0",
+			`flows_waiting`:                                                "0",
 		}
 		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 			t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -122,6 +128,9 @@ func TestCore(t *testing.T) {
 			`flows_forwarded{exporter="192.0.2.142"}`:                      "1",
 			`flows_forwarded{exporter="192.0.2.143"}`:                      "1",
 			`flows_http_clients`:                                           "0",
+			`flows_tail_clients`:                                           "0",
+			`flows_tail_dropped`:                                           "0",
+			`flows_waiting`:                                                "0",
 		}
 		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 			t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -159,6 +168,7 @@ func TestCore(t *testing.T) {
 			expected.InIfSpeed = 1000
 			expected.OutIfSpeed = 1000
 			expected.ExporterName = "192_0_2_142"
+			expected.ProtoName = "TCP"
 			if diff := helpers.Diff(&got, expected); diff != "" {
 				t.Errorf("Kafka message (-got, +want):\n%s", diff)
 			}
@@ -188,7 +198,10 @@ func TestCore(t *testing.T) {
 			`flows_received{exporter="192.0.2.143"}`:                             "4",
 			`flows_forwarded{exporter="192.0.2.142"}`:                            "2",
 			`flows_forwarded{exporter="192.0.2.143"}`:                            "1",
-			`flows_http_clients`:                                                 "0",
+			`flows_http_clients`: "0",
+			`flows_tail_clients`: "0",
+			`flows_tail_dropped`: "0",
+			`flows_waiting`:      "0",
 		}
 		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 			t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -273,6 +286,7 @@ func TestCore(t *testing.T) {
 				"SrcCountry":       "BT",
 				"SrcAS":            35908,
 				"ExporterName":     "192_0_2_142",
+				"ProtoName":        "TCP",
 			}
 			if diff := helpers.Diff(got, expected); diff != "" {
 				t.Fatalf("GET /api/v0/inlet/flows (-got, +want):\n%s", diff)
@@ -280,8 +294,14 @@ func TestCore(t *testing.T) {
 		}
 	})
 
-	// Test HTTP flow clients with a limit
-	time.Sleep(10 * time.Millisecond)
+	// Test HTTP flow clients with a limit. Wait for the previous
+	// client to be gone first.
+	for i := 0; atomic.LoadUint32(&c.httpFlowClients) != 0; i++ {
+		if i == 100 {
+			t.Fatal("previous HTTP flow client still connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 	t.Run("http flows with limit", func(t *testing.T) {
 		resp, err := netHTTP.Get(fmt.Sprintf("http://%s/api/v0/inlet/flows?limit=4", c.d.HTTP.LocalAddr()))
 		if err != nil {
@@ -365,3 +385,330 @@ func TestCore(t *testing.T) {
 	})
 
 }
+
+func TestDropFilter(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	snmpComponent := snmp.NewMock(t, r, snmp.DefaultConfiguration(), snmp.Dependencies{Daemon: daemonComponent})
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	geoipComponent := geoip.NewMock(t, r)
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := http.NewMock(t, r)
+	bmpComponent, _ := bmp.NewMock(t, r, bmp.DefaultConfiguration())
+
+	configuration := DefaultConfiguration()
+	configuration.SNMPWait = 0
+	filter, err := flow.NewFilter(`InIfName = "Gi0/0/434" AND DstPort = 443`)
+	if err != nil {
+		t.Fatalf("NewFilter() error:\n%+v", err)
+	}
+	configuration.DropFilter = *filter
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flowComponent,
+		SNMP:   snmpComponent,
+		GeoIP:  geoipComponent,
+		Output: kafkaComponent,
+		HTTP:   httpComponent,
+		BMP:    bmpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	flowMessage := func(port uint32) *flow.Message {
+		return &flow.Message{
+			SamplingRate:    1000,
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			InIf:            434,
+			OutIf:           677,
+			DstPort:         port,
+		}
+	}
+	// First one is a cache miss
+	flowComponent.Inject(t, flowMessage(443))
+	time.Sleep(20 * time.Millisecond)
+
+	kafkaProducer.ExpectInputAndSucceed()
+	flowComponent.Inject(t, flowMessage(443))
+	flowComponent.Inject(t, flowMessage(80))
+	time.Sleep(20 * time.Millisecond)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "flows_filtered", "flows_forwarded")
+	expectedMetrics := map[string]string{
+		`flows_filtered{exporter="192.0.2.142"}`:  "1",
+		`flows_forwarded{exporter="192.0.2.142"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestExportDelay(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	snmpComponent := snmp.NewMock(t, r, snmp.DefaultConfiguration(), snmp.Dependencies{Daemon: daemonComponent})
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	geoipComponent := geoip.NewMock(t, r)
+	kafkaComponent, _ := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := http.NewMock(t, r)
+	bmpComponent, _ := bmp.NewMock(t, r, bmp.DefaultConfiguration())
+
+	configuration := DefaultConfiguration()
+	configuration.SNMPWait = 0
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flowComponent,
+		SNMP:   snmpComponent,
+		GeoIP:  geoipComponent,
+		Output: kafkaComponent,
+		HTTP:   httpComponent,
+		BMP:    bmpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	flowMessage := func(end uint64) *flow.Message {
+		return &flow.Message{
+			TimeReceived:    1000,
+			TimeFlowEnd:     end,
+			SamplingRate:    1000,
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			InIf:            uint32(end) + 1,
+			OutIf:           677,
+		}
+	}
+	// All flows are SNMP cache misses and are not forwarded.
+	flowComponent.Inject(t, flowMessage(1000))
+	flowComponent.Inject(t, flowMessage(955))
+	flowComponent.Inject(t, flowMessage(300))
+	// Ignored: no end time, end time in the future
+	flowComponent.Inject(t, flowMessage(0))
+	flowComponent.Inject(t, flowMessage(1010))
+	time.Sleep(20 * time.Millisecond)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "export_delay_seconds")
+	expectedMetrics := map[string]string{
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="1"}`:    "1",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="5"}`:    "1",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="10"}`:   "1",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="30"}`:   "1",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="60"}`:   "2",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="120"}`:  "2",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="300"}`:  "2",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="600"}`:  "2",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="1800"}`: "3",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="3600"}`: "3",
+		`export_delay_seconds_bucket{exporter="192.0.2.142",le="+Inf"}`: "3",
+		`export_delay_seconds_count{exporter="192.0.2.142"}`:            "3",
+		`export_delay_seconds_sum{exporter="192.0.2.142"}`:              "745",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	snmpComponent := snmp.NewMock(t, r, snmp.DefaultConfiguration(), snmp.Dependencies{Daemon: daemonComponent})
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	geoipComponent := geoip.NewMock(t, r)
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := http.NewMock(t, r)
+	bmpComponent, _ := bmp.NewMock(t, r, bmp.DefaultConfiguration())
+
+	configuration := DefaultConfiguration()
+	configuration.Passthrough = true
+	filter, err := flow.NewFilter(`DstPort = 443`)
+	if err != nil {
+		t.Fatalf("NewFilter() error:\n%+v", err)
+	}
+	configuration.DropFilter = *filter
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flowComponent,
+		SNMP:   snmpComponent,
+		GeoIP:  geoipComponent,
+		Output: kafkaComponent,
+		HTTP:   httpComponent,
+		BMP:    bmpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	// Flows are neither hydrated nor filtered: no SNMP wait, no drop.
+	kafkaProducer.ExpectInputAndSucceed()
+	kafkaProducer.ExpectInputAndSucceed()
+	for _, port := range []uint32{443, 80} {
+		flowComponent.Inject(t, &flow.Message{
+			SamplingRate:    1000,
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			InIf:            434,
+			OutIf:           677,
+			DstPort:         port,
+		})
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "flows_filtered", "flows_forwarded", "flows_errors")
+	expectedMetrics := map[string]string{
+		`flows_forwarded{exporter="192.0.2.142"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestReload(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	snmpComponent := snmp.NewMock(t, r, snmp.DefaultConfiguration(), snmp.Dependencies{Daemon: daemonComponent})
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	geoipComponent := geoip.NewMock(t, r)
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := http.NewMock(t, r)
+	bmpComponent, _ := bmp.NewMock(t, r, bmp.DefaultConfiguration())
+
+	configuration := DefaultConfiguration()
+	configuration.SNMPWait = 0
+	filter, err := flow.NewFilter(`DstPort = 443`)
+	if err != nil {
+		t.Fatalf("NewFilter() error:\n%+v", err)
+	}
+	configuration.DropFilter = *filter
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flowComponent,
+		SNMP:   snmpComponent,
+		GeoIP:  geoipComponent,
+		Output: kafkaComponent,
+		HTTP:   httpComponent,
+		BMP:    bmpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	// Flows are recycled once handled, inject a new one each time
+	flowMessage := func() *flow.Message {
+		return &flow.Message{
+			SamplingRate:    1000,
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			InIf:            434,
+			OutIf:           677,
+			DstPort:         443,
+		}
+	}
+	// First one is a cache miss
+	flowComponent.Inject(t, flowMessage())
+	time.Sleep(20 * time.Millisecond)
+	flowComponent.Inject(t, flowMessage())
+	time.Sleep(20 * time.Millisecond)
+
+	// Remove the drop filter, add a classifier and change the number of workers
+	configuration = DefaultConfiguration()
+	configuration.SNMPWait = 0
+	configuration.Workers = 2
+	var rule ExporterClassifierRule
+	if err := rule.UnmarshalText([]byte(`ClassifyGroup("europe")`)); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	configuration.ExporterClassifiers = []ExporterClassifierRule{rule}
+	restart, err := c.Reload(configuration)
+	if err != nil {
+		t.Fatalf("Reload() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(restart, []string{"workers"}); diff != "" {
+		t.Errorf("Reload() (-got, +want):\n%s", diff)
+	}
+
+	subscription := c.Subscribe(1)
+	defer subscription.Unsubscribe()
+	kafkaProducer.ExpectInputAndSucceed()
+	flowComponent.Inject(t, flowMessage())
+	select {
+	case got := <-subscription.Flows():
+		if got.ExporterGroup != "europe" {
+			t.Errorf("Reload() did not update classifiers (got %q)", got.ExporterGroup)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe() did not receive the flow")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "flows_filtered", "flows_forwarded")
+	expectedMetrics := map[string]string{
+		`flows_filtered{exporter="192.0.2.142"}`:  "1",
+		`flows_forwarded{exporter="192.0.2.142"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	r, recorder := reporter.NewMockWithTracing(t)
+	daemonComponent := daemon.NewMock(t)
+	snmpComponent := snmp.NewMock(t, r, snmp.DefaultConfiguration(), snmp.Dependencies{Daemon: daemonComponent})
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	geoipComponent := geoip.NewMock(t, r)
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := http.NewMock(t, r)
+	bmpComponent, _ := bmp.NewMock(t, r, bmp.DefaultConfiguration())
+
+	configuration := DefaultConfiguration()
+	configuration.SNMPWait = 0
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flowComponent,
+		SNMP:   snmpComponent,
+		GeoIP:  geoipComponent,
+		Output: kafkaComponent,
+		HTTP:   httpComponent,
+		BMP:    bmpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	flowMessage := func() *flow.Message {
+		return &flow.Message{
+			SamplingRate:    1000,
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			InIf:            434,
+			OutIf:           677,
+			SrcAddr:         net.ParseIP("67.43.156.77"),
+			DstAddr:         net.ParseIP("2.125.160.216"),
+		}
+	}
+	// First one is a cache miss and is not traced
+	flowComponent.Inject(t, flowMessage())
+	time.Sleep(20 * time.Millisecond)
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Fatalf("Ended() got %d spans, expected 0", len(spans))
+	}
+
+	_, root := r.Tracer().Start(context.Background(), "decode")
+	root.End()
+	kafkaProducer.ExpectInputAndSucceed()
+	flowComponent.InjectTraced(t, flowMessage(), root.SpanContext())
+	time.Sleep(20 * time.Millisecond)
+
+	got := []string{}
+	for _, span := range recorder.Ended()[1:] {
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("Parent() of %q is not the root span", span.Name())
+		}
+		got = append(got, span.Name())
+	}
+	if diff := helpers.Diff(got, []string{"snmp lookup", "geoip lookup", "kafka produce"}); diff != "" {
+		t.Fatalf("Ended() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"akvorado/inlet/flow"
+)
+
+// scanDetector tracks the distinct destination ports and hosts
+// contacted by each source address to detect port scans and host
+// sweeps. The sliding window is approximated with two halves: values
+// are counted over the current half and the previous one.
+type scanDetector struct {
+	mu       sync.Mutex
+	half     time.Duration
+	maxPorts int
+	maxHosts int
+	start    time.Time
+	previous map[netip.Addr]*scanState
+	current  map[netip.Addr]*scanState
+}
+
+// scanState contains the destinations of a source for one half of the
+// window. Counts include the destinations of the previous half.
+type scanState struct {
+	ports     map[uint16]struct{}
+	hosts     map[netip.Addr]struct{}
+	portCount int
+	hostCount int
+}
+
+// newScanDetector creates a new scan detector. It returns nil if
+// both thresholds are disabled.
+func newScanDetector(window time.Duration, maxPorts, maxHosts int) *scanDetector {
+	if maxPorts == 0 && maxHosts == 0 {
+		return nil
+	}
+	return &scanDetector{
+		half:     window / 2,
+		maxPorts: maxPorts,
+		maxHosts: maxHosts,
+		previous: map[netip.Addr]*scanState{},
+		current:  map[netip.Addr]*scanState{},
+	}
+}
+
+// observe accounts for the provided flow and tells if its source
+// exceeds one of the thresholds.
+func (sd *scanDetector) observe(now time.Time, fl *flow.Message) bool {
+	src, ok := netip.AddrFromSlice(fl.SrcAddr)
+	if !ok {
+		return false
+	}
+	dst, _ := netip.AddrFromSlice(fl.DstAddr)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	switch elapsed := now.Sub(sd.start); {
+	case elapsed >= 2*sd.half:
+		sd.previous = map[netip.Addr]*scanState{}
+		sd.current = map[netip.Addr]*scanState{}
+		sd.start = now
+	case elapsed >= sd.half:
+		sd.previous = sd.current
+		sd.current = map[netip.Addr]*scanState{}
+		sd.start = sd.start.Add(sd.half)
+	}
+
+	previous := sd.previous[src]
+	current := sd.current[src]
+	if current == nil {
+		current = &scanState{
+			ports: map[uint16]struct{}{},
+			hosts: map[netip.Addr]struct{}{},
+		}
+		if previous != nil {
+			current.portCount = len(previous.ports)
+			current.hostCount = len(previous.hosts)
+		}
+		sd.current[src] = current
+	}
+	// Once a threshold is exceeded, stop recording destinations.
+	if sd.maxPorts > 0 && current.portCount <= sd.maxPorts {
+		port := uint16(fl.DstPort)
+		if _, ok := current.ports[port]; !ok {
+			current.ports[port] = struct{}{}
+			if !previous.hasPort(port) {
+				current.portCount++
+			}
+		}
+	}
+	if sd.maxHosts > 0 && current.hostCount <= sd.maxHosts {
+		if _, ok := current.hosts[dst]; !ok {
+			current.hosts[dst] = struct{}{}
+			if !previous.hasHost(dst) {
+				current.hostCount++
+			}
+		}
+	}
+	return (sd.maxPorts > 0 && current.portCount > sd.maxPorts) ||
+		(sd.maxHosts > 0 && current.hostCount > sd.maxHosts)
+}
+
+// hasPort tells if the provided port has been seen. The state may be
+// nil.
+func (ss *scanState) hasPort(port uint16) bool {
+	if ss == nil {
+		return false
+	}
+	_, ok := ss.ports[port]
+	return ok
+}
+
+// hasHost tells if the provided host has been seen. The state may be
+// nil.
+func (ss *scanState) hasHost(host netip.Addr) bool {
+	if ss == nil {
+		return false
+	}
+	_, ok := ss.hosts[host]
+	return ok
+}
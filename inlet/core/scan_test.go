@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"akvorado/inlet/flow"
+)
+
+func TestScanDetector(t *testing.T) {
+	if sd := newScanDetector(time.Minute, 0, 0); sd != nil {
+		t.Fatal("newScanDetector() should be nil when disabled")
+	}
+	sd := newScanDetector(time.Minute, 3, 2)
+	now := time.Date(2022, 10, 15, 10, 0, 0, 0, time.UTC)
+	observe := func(offset time.Duration, src, dst string, port uint32) bool {
+		return sd.observe(now.Add(offset), &flow.Message{
+			SrcAddr: net.ParseIP(src).To16(),
+			DstAddr: net.ParseIP(dst).To16(),
+			DstPort: port,
+		})
+	}
+	cases := []struct {
+		Offset   time.Duration
+		Src      string
+		Dst      string
+		Port     uint32
+		Expected bool
+	}{
+		// Port scan
+		{0, "192.0.2.1", "198.51.100.1", 22, false},
+		{time.Second, "192.0.2.1", "198.51.100.1", 22, false},
+		{2 * time.Second, "192.0.2.1", "198.51.100.1", 23, false},
+		{3 * time.Second, "192.0.2.1", "198.51.100.1", 80, false},
+		{4 * time.Second, "192.0.2.1", "198.51.100.1", 443, true},
+		// Ports from the previous half still count
+		{35 * time.Second, "192.0.2.1", "198.51.100.1", 22, true},
+		// Another source is not affected
+		{36 * time.Second, "192.0.2.2", "198.51.100.1", 22, false},
+		// Host sweep
+		{37 * time.Second, "192.0.2.2", "198.51.100.2", 22, false},
+		{38 * time.Second, "192.0.2.2", "198.51.100.3", 22, true},
+		// Once the window is over, the first source is not a suspect anymore
+		{65 * time.Second, "192.0.2.1", "198.51.100.1", 22, false},
+		// After a long time, everything is forgotten
+		{300 * time.Second, "192.0.2.2", "198.51.100.4", 22, false},
+	}
+	for _, tc := range cases {
+		if got := observe(tc.Offset, tc.Src, tc.Dst, tc.Port); got != tc.Expected {
+			t.Errorf("observe(%s, %s, %s, %d) == %v, expected %v",
+				tc.Offset, tc.Src, tc.Dst, tc.Port, got, tc.Expected)
+		}
+	}
+}
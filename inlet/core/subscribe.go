@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"akvorado/inlet/flow"
+)
+
+// Broadcaster sends a copy of flows to subscriptions.
+type Broadcaster struct {
+	lock          sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	count         int32
+}
+
+// Subscriber is the interface of the components providing flows
+// through a broadcaster.
+type Subscriber interface {
+	Subscribe(size int) *Subscription
+}
+
+// Subscription receives a copy of flows from a broadcaster. When the
+// subscriber is too slow, flows are dropped.
+type Subscription struct {
+	b       *Broadcaster
+	flows   chan *flow.Message
+	dropped uint64
+}
+
+// NewBroadcaster creates a new broadcaster.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscriptions: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe registers a new subscription with a queue of the
+// provided size. Unsubscribe should be called once done.
+func (b *Broadcaster) Subscribe(size int) *Subscription {
+	s := &Subscription{
+		b:     b,
+		flows: make(chan *flow.Message, size),
+	}
+	b.lock.Lock()
+	b.subscriptions[s] = struct{}{}
+	atomic.AddInt32(&b.count, 1)
+	b.lock.Unlock()
+	return s
+}
+
+// Publish sends a flow to all subscriptions without blocking.
+func (b *Broadcaster) Publish(fl *flow.Message) {
+	if atomic.LoadInt32(&b.count) == 0 {
+		return
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for s := range b.subscriptions {
+		select {
+		case s.flows <- fl:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Subscriptions returns the number of active subscriptions.
+func (b *Broadcaster) Subscriptions() int {
+	return int(atomic.LoadInt32(&b.count))
+}
+
+// Flows returns the channel receiving flows. Flows should not be
+// modified.
+func (s *Subscription) Flows() <-chan *flow.Message {
+	return s.flows
+}
+
+// Dropped returns the number of flows dropped because the queue was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe stops the subscription.
+func (s *Subscription) Unsubscribe() {
+	s.b.lock.Lock()
+	if _, ok := s.b.subscriptions[s]; ok {
+		delete(s.b.subscriptions, s)
+		atomic.AddInt32(&s.b.count, -1)
+	}
+	s.b.lock.Unlock()
+}
+
+// Subscribe registers a new subscription to the flows sent to the
+// output. Unsubscribe should be called once done.
+func (c *Component) Subscribe(size int) *Subscription {
+	return c.broadcaster.Subscribe(size)
+}
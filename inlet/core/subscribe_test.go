@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"testing"
+
+	"akvorado/inlet/flow"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster()
+	b.Publish(&flow.Message{SequenceNum: 1})
+
+	s1 := b.Subscribe(1)
+	s2 := b.Subscribe(2)
+	if got := b.Subscriptions(); got != 2 {
+		t.Fatalf("Subscriptions() == %d, expected 2", got)
+	}
+	b.Publish(&flow.Message{SequenceNum: 2})
+	b.Publish(&flow.Message{SequenceNum: 3})
+
+	if got := (<-s1.Flows()).SequenceNum; got != 2 {
+		t.Errorf("first subscription got flow %d, expected 2", got)
+	}
+	if got := s1.Dropped(); got != 1 {
+		t.Errorf("first subscription dropped %d flows, expected 1", got)
+	}
+	for _, expected := range []uint32{2, 3} {
+		if got := (<-s2.Flows()).SequenceNum; got != expected {
+			t.Errorf("second subscription got flow %d, expected %d", got, expected)
+		}
+	}
+	if got := s2.Dropped(); got != 0 {
+		t.Errorf("second subscription dropped %d flows, expected 0", got)
+	}
+
+	s1.Unsubscribe()
+	s1.Unsubscribe()
+	b.Publish(&flow.Message{SequenceNum: 4})
+	if got := b.Subscriptions(); got != 1 {
+		t.Fatalf("Subscriptions() == %d, expected 1", got)
+	}
+	if got := len(s1.Flows()); got != 0 {
+		t.Errorf("first subscription got %d flows after unsubscribing", got)
+	}
+	if got := (<-s2.Flows()).SequenceNum; got != 4 {
+		t.Errorf("second subscription got flow %d, expected 4", got)
+	}
+}
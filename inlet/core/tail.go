@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+	"golang.org/x/time/rate"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/flow"
+)
+
+// tailQueueSize is the size of the queue of flows for each WebSocket
+// client.
+const tailQueueSize = 100
+
+type tailParameters struct {
+	Filter string `form:"filter"`
+	Limit  uint64 `form:"limit"`
+}
+
+// FlowsTailHandler streams a JSON copy of the flows matching the
+// provided filter over a WebSocket. Flows are rate-limited for each
+// client and flows are dropped when the client is too slow. This is
+// intended for troubleshooting.
+func (c *Component) FlowsTailHandler(gc *gin.Context) {
+	var params tailParameters
+	if err := gc.ShouldBindQuery(&params); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	filter, err := flow.NewFilter(params.Filter)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if count := atomic.AddInt32(&c.tailClients, 1); c.config.TailMaxClients > 0 && int(count) > c.config.TailMaxClients {
+		atomic.AddInt32(&c.tailClients, -1)
+		gc.JSON(http.StatusServiceUnavailable, gin.H{"message": "Too many clients."})
+		return
+	}
+	defer atomic.AddInt32(&c.tailClients, -1)
+
+	server := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			c.tail(ws, filter, params.Limit)
+		},
+	}
+	server.ServeHTTP(gc.Writer, gc.Request)
+}
+
+// tail sends matching flows to the provided WebSocket until the
+// client goes away, the limit is reached or the component stops.
+func (c *Component) tail(ws *websocket.Conn, filter *flow.Filter, limit uint64) {
+	defer ws.Close()
+	subscription := c.broadcaster.Subscribe(tailQueueSize)
+	defer subscription.Unsubscribe()
+	limiter := rate.NewLimiter(rate.Limit(c.config.TailRateLimit), c.config.TailRateLimit)
+
+	// Detect when the client goes away. Incoming messages are ignored.
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(closed)
+	}()
+
+	var count, dropped uint64
+	for {
+		select {
+		case <-c.t.Dying():
+			return
+		case <-closed:
+			return
+		case fl := <-subscription.Flows():
+			if !filter.Match(fl) {
+				continue
+			}
+			if !limiter.Allow() {
+				c.metrics.flowsTailDropped.Inc()
+				continue
+			}
+			if newDropped := subscription.Dropped(); newDropped != dropped {
+				c.metrics.flowsTailDropped.Add(float64(newDropped - dropped))
+				dropped = newDropped
+			}
+			if err := websocket.JSON.Send(ws, fl); err != nil {
+				return
+			}
+			count++
+			if limit > 0 && count == limit {
+				return
+			}
+		}
+	}
+}
+
+// checkSameOrigin rejects WebSocket connections initiated by a
+// browser from another origin. Clients without an origin are accepted.
+func checkSameOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	var err error
+	config.Origin, err = websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if config.Origin == nil || config.Origin.Host != req.Host {
+		return errors.New("cross-origin WebSocket request")
+	}
+	return nil
+}
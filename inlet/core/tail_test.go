@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+func TestFlowsTail(t *testing.T) {
+	r := reporter.NewMock(t)
+	httpComponent := http.NewMock(t, r)
+	configuration := DefaultConfiguration()
+	configuration.TailMaxClients = 1
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   httpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	httpComponent.GinRouter.GET("/api/v0/inlet/flows/tail", c.FlowsTailHandler)
+	addr := httpComponent.LocalAddr()
+	url := fmt.Sprintf("ws://%s/api/v0/inlet/flows/tail", addr)
+	origin := fmt.Sprintf("http://%s/", addr)
+
+	helpers.TestHTTPEndpoints(t, addr, helpers.HTTPEndpointCases{
+		{
+			Description: "invalid filter",
+			URL:         "/api/v0/inlet/flows/tail?filter=SrcPort%20%3D",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Cannot parse filter \"SrcPort =\": at line 1, position 10: no match found, expected: \"--\", \"/*\", [ \\n\\r\\t] or [0-9]",
+			},
+		},
+	})
+
+	if _, err := websocket.Dial(url, "", "http://example.com/"); err == nil {
+		t.Fatal("Dial() from another origin did not error")
+	}
+
+	ws, err := websocket.Dial(url+"?filter=SrcPort%20%3D%20443&limit=2", "", origin)
+	if err != nil {
+		t.Fatalf("Dial() error:\n%+v", err)
+	}
+	defer ws.Close()
+	for c.broadcaster.Subscriptions() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Only one client is allowed
+	if _, err := websocket.Dial(url, "", origin); err == nil {
+		t.Fatal("Dial() for a second client did not error")
+	}
+
+	c.broadcaster.Publish(&flow.Message{SrcPort: 443, DstPort: 1000})
+	c.broadcaster.Publish(&flow.Message{SrcPort: 80, DstPort: 1001})
+	c.broadcaster.Publish(&flow.Message{SrcPort: 443, DstPort: 1002})
+	c.broadcaster.Publish(&flow.Message{SrcPort: 443, DstPort: 1003})
+
+	got := []uint32{}
+	for {
+		var fl struct {
+			DstPort uint32
+		}
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		if err := websocket.JSON.Receive(ws, &fl); err != nil {
+			break
+		}
+		got = append(got, fl.DstPort)
+	}
+	if diff := helpers.Diff(got, []uint32{1000, 1002}); diff != "" {
+		t.Fatalf("Received flows (-got, +want):\n%s", diff)
+	}
+}
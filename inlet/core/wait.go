@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+
+	"akvorado/inlet/flow"
+)
+
+// waitingFlow is a flow going through the workers. When its
+// interfaces are not in the SNMP cache, it waits for the SNMP
+// component to poll them until the deadline.
+type waitingFlow struct {
+	ctx      context.Context
+	flow     *flow.Message
+	exporter string
+	ip       netip.Addr
+	deadline time.Time
+}
+
+// waitLists are the flows waiting for their interfaces, indexed by
+// exporter.
+type waitLists struct {
+	lock  sync.Mutex
+	flows map[netip.Addr][]waitingFlow
+	count int
+}
+
+// parkFlow puts a flow on the wait list of its exporter. It returns
+// false when there are already too many waiting flows.
+func (c *Component) parkFlow(wf waitingFlow) bool {
+	c.waiting.lock.Lock()
+	defer c.waiting.lock.Unlock()
+	if c.waiting.count >= c.config.SNMPWaitQueueSize {
+		return false
+	}
+	if wf.deadline.IsZero() {
+		wf.deadline = time.Now().Add(c.config.SNMPWait)
+	}
+	c.waiting.flows[wf.ip] = append(c.waiting.flows[wf.ip], wf)
+	c.waiting.count++
+	return true
+}
+
+// unparkExporter removes the flows waiting for the provided exporter
+// from the wait lists.
+func (c *Component) unparkExporter(ip netip.Addr) []waitingFlow {
+	c.waiting.lock.Lock()
+	defer c.waiting.lock.Unlock()
+	flows := c.waiting.flows[ip]
+	delete(c.waiting.flows, ip)
+	c.waiting.count -= len(flows)
+	return flows
+}
+
+// unparkExpired removes the flows whose deadline is past from the wait
+// lists.
+func (c *Component) unparkExpired(now time.Time) []waitingFlow {
+	c.waiting.lock.Lock()
+	defer c.waiting.lock.Unlock()
+	expired := []waitingFlow{}
+	for ip, flows := range c.waiting.flows {
+		kept := flows[:0]
+		for _, wf := range flows {
+			if now.Before(wf.deadline) {
+				kept = append(kept, wf)
+			} else {
+				expired = append(expired, wf)
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.waiting.flows, ip)
+		} else {
+			c.waiting.flows[ip] = kept
+		}
+	}
+	c.waiting.count -= len(expired)
+	return expired
+}
+
+// unparkAll removes all the flows from the wait lists.
+func (c *Component) unparkAll() []waitingFlow {
+	c.waiting.lock.Lock()
+	defer c.waiting.lock.Unlock()
+	all := []waitingFlow{}
+	for _, flows := range c.waiting.flows {
+		all = append(all, flows...)
+	}
+	c.waiting.flows = map[netip.Addr][]waitingFlow{}
+	c.waiting.count = 0
+	return all
+}
+
+// abortWaiting drops the provided waiting flows when the component
+// is stopping. They are counted as errors.
+func (c *Component) abortWaiting(flows []waitingFlow) {
+	for _, wf := range flows {
+		c.metrics.flowsErrors.WithLabelValues(c.r.ExporterLabel(wf.exporter), "SNMP wait aborted").Inc()
+		releaseFlow(wf.flow)
+	}
+}
+
+// runWaiter hands back the waiting flows to the workers once the SNMP
+// component has polled their exporter or once their deadline is past.
+// In the latter case, they are dropped by the workers unless the
+// interfaces were polled in the meantime. When stopping, the flows
+// not handed back yet are dropped.
+func (c *Component) runWaiter() error {
+	interval := c.config.SNMPWait / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var flows []waitingFlow
+		select {
+		case <-c.t.Dying():
+			return nil
+		case ip := <-c.polled:
+			flows = c.unparkExporter(ip)
+		case now := <-ticker.C:
+			flows = c.unparkExpired(now)
+		}
+		for i, wf := range flows {
+			select {
+			case <-c.t.Dying():
+				c.abortWaiting(flows[i:])
+				return nil
+			case c.retries <- wf:
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/bmp"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/geoip"
+	"akvorado/inlet/kafka"
+	"akvorado/inlet/snmp"
+)
+
+func TestSNMPWait(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	snmpConfiguration := snmp.DefaultConfiguration()
+	snmpConfiguration.Communities, _ = helpers.NewSubnetMap(map[string]string{
+		"::/0":                   "public",
+		"::ffff:192.0.2.143/128": "private",
+	})
+	snmpComponent := snmp.NewMock(t, r, snmpConfiguration, snmp.Dependencies{Daemon: daemonComponent})
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	geoipComponent := geoip.NewMock(t, r)
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := http.NewMock(t, r)
+	bmpComponent, _ := bmp.NewMock(t, r, bmp.DefaultConfiguration())
+
+	configuration := DefaultConfiguration()
+	configuration.SNMPWait = 100 * time.Millisecond
+	configuration.SNMPWaitQueueSize = 2
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flowComponent,
+		SNMP:   snmpComponent,
+		GeoIP:  geoipComponent,
+		Output: kafkaComponent,
+		HTTP:   httpComponent,
+		BMP:    bmpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	flowMessage := func(exporter string) *flow.Message {
+		return &flow.Message{
+			SamplingRate:    1000,
+			ExporterAddress: net.ParseIP(exporter),
+			InIf:            434,
+			OutIf:           677,
+		}
+	}
+
+	// This exporter does not answer: its flows are dropped after the
+	// deadline. The wait list is full for the last flow.
+	flowComponent.Inject(t, flowMessage("192.0.2.143"))
+	flowComponent.Inject(t, flowMessage("192.0.2.143"))
+	flowComponent.Inject(t, flowMessage("192.0.2.143"))
+	time.Sleep(20 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_flows_", "errors", "forwarded", "waiting")
+	expectedMetrics := map[string]string{
+		`errors{error="SNMP wait queue full",exporter="192.0.2.143"}`: "1",
+		`waiting`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+	time.Sleep(200 * time.Millisecond)
+	gotMetrics = r.GetMetrics("akvorado_inlet_core_flows_", "errors", "forwarded", "waiting")
+	expectedMetrics = map[string]string{
+		`errors{error="SNMP cache miss",exporter="192.0.2.143"}`:      "2",
+		`errors{error="SNMP wait queue full",exporter="192.0.2.143"}`: "1",
+		`waiting`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// The interfaces of this exporter are polled while the flow waits.
+	received := make(chan bool)
+	kafkaProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(*sarama.ProducerMessage) error {
+		close(received)
+		return nil
+	})
+	flowComponent.Inject(t, flowMessage("192.0.2.142"))
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("Kafka message not received")
+	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_core_flows_", "errors", "forwarded", "waiting")
+	expectedMetrics = map[string]string{
+		`errors{error="SNMP cache miss",exporter="192.0.2.143"}`:      "2",
+		`errors{error="SNMP wait queue full",exporter="192.0.2.143"}`: "1",
+		`forwarded{exporter="192.0.2.142"}`:                           "1",
+		`waiting`:                                                     "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestSNMPWaitStop(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	snmpConfiguration := snmp.DefaultConfiguration()
+	snmpConfiguration.Communities, _ = helpers.NewSubnetMap(map[string]string{
+		"::/0":                   "public",
+		"::ffff:192.0.2.143/128": "private",
+	})
+	snmpComponent := snmp.NewMock(t, r, snmpConfiguration, snmp.Dependencies{Daemon: daemonComponent})
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	geoipComponent := geoip.NewMock(t, r)
+	kafkaComponent, _ := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := http.NewMock(t, r)
+	bmpComponent, _ := bmp.NewMock(t, r, bmp.DefaultConfiguration())
+
+	configuration := DefaultConfiguration()
+	configuration.SNMPWait = time.Minute
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flowComponent,
+		SNMP:   snmpComponent,
+		GeoIP:  geoipComponent,
+		Output: kafkaComponent,
+		HTTP:   httpComponent,
+		BMP:    bmpComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+
+	// This exporter does not answer: its flow stays parked until the
+	// component is stopped.
+	flowComponent.Inject(t, &flow.Message{
+		SamplingRate:    1000,
+		ExporterAddress: net.ParseIP("192.0.2.143"),
+		InIf:            434,
+		OutIf:           677,
+	})
+	time.Sleep(20 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_flows_", "errors", "waiting")
+	expectedMetrics := map[string]string{
+		`waiting`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_core_flows_", "errors", "waiting")
+	expectedMetrics = map[string]string{
+		`errors{error="SNMP wait aborted",exporter="192.0.2.143"}`: "1",
+		`waiting`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
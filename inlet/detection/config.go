@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package detection
+
+import (
+	"errors"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+// Configuration describes the configuration for the anomaly detection.
+type Configuration struct {
+	// Enabled tells to detect traffic anomalies.
+	Enabled bool
+	// Interval is the period over which the rates are computed.
+	Interval time.Duration `validate:"min=1s"`
+	// LearningIntervals is the number of intervals needed to learn a
+	// baseline before raising alerts.
+	LearningIntervals int `validate:"min=1"`
+	// Smoothing is the weight of the last interval when updating
+	// the baseline.
+	Smoothing float64 `validate:"gt=0,lte=1"`
+	// Threshold is the ratio between the current rate and the
+	// baseline to raise an alert.
+	Threshold float64 `validate:"gt=1"`
+	// MinimumBPS is the minimum rate in bits per second to raise an
+	// alert.
+	MinimumBPS uint64
+	// Holdoff is the minimum time between two alerts for the same
+	// exporter, direction and protocol.
+	Holdoff time.Duration `validate:"min=0"`
+	// QueueSize is the number of flows waiting to be processed. When
+	// the queue is full, flows are dropped.
+	QueueSize int `validate:"min=1"`
+	// WebhookURL is the endpoint receiving alerts. When empty,
+	// alerts are only logged and counted.
+	WebhookURL string `validate:"omitempty,url"`
+	// WebhookHeaders are additional HTTP headers to send with each
+	// alert.
+	WebhookHeaders map[string]string
+	// WebhookTimeout is the timeout for each request to the webhook.
+	WebhookTimeout time.Duration `validate:"min=100ms"`
+	// Mitigation describes the mitigation action to take on alerts.
+	Mitigation MitigationConfiguration
+}
+
+// MitigationConfiguration describes how to mitigate an anomaly.
+type MitigationConfiguration struct {
+	// Type tells where to send mitigation rules.
+	Type MitigationType
+	// URL is the endpoint of the ExaBGP HTTP API or of the webhook.
+	URL string `validate:"omitempty,url"`
+	// Headers are additional HTTP headers to send with each request.
+	Headers map[string]string
+	// Action is the action of the FlowSpec rule.
+	Action MitigationAction
+	// RateLimit is the rate in bytes per second when the action is
+	// rate-limit.
+	RateLimit uint64
+	// Duration is the time before withdrawing a rule. When 0,
+	// rules are only withdrawn when the component stops.
+	Duration time.Duration `validate:"min=0"`
+	// Timeout is the timeout for each request.
+	Timeout time.Duration `validate:"min=100ms"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// anomaly detection.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Interval:          10 * time.Second,
+		LearningIntervals: 30,
+		Smoothing:         0.1,
+		Threshold:         3,
+		MinimumBPS:        10_000_000,
+		Holdoff:           5 * time.Minute,
+		QueueSize:         1000,
+		WebhookTimeout:    5 * time.Second,
+		Mitigation: MitigationConfiguration{
+			Type:     MitigationNone,
+			Action:   MitigationDiscard,
+			Duration: 30 * time.Minute,
+			Timeout:  5 * time.Second,
+		},
+	}
+}
+
+// MitigationType is where mitigation rules are sent.
+type MitigationType int
+
+const (
+	// MitigationNone disables mitigation.
+	MitigationNone MitigationType = iota
+	// MitigationExaBGP sends FlowSpec rules to the HTTP API of ExaBGP.
+	MitigationExaBGP
+	// MitigationWebhook sends FlowSpec rules to a webhook as JSON.
+	MitigationWebhook
+)
+
+var mitigationTypeMap = helpers.NewBimap(map[MitigationType]string{
+	MitigationNone:    "none",
+	MitigationExaBGP:  "exabgp",
+	MitigationWebhook: "webhook",
+})
+
+// MarshalText turns a mitigation type to text.
+func (mt MitigationType) MarshalText() ([]byte, error) {
+	got, ok := mitigationTypeMap.LoadValue(mt)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown mitigation type")
+}
+
+// String turns a mitigation type to string.
+func (mt MitigationType) String() string {
+	got, _ := mitigationTypeMap.LoadValue(mt)
+	return got
+}
+
+// UnmarshalText provides a mitigation type from a string.
+func (mt *MitigationType) UnmarshalText(input []byte) error {
+	got, ok := mitigationTypeMap.LoadKey(string(input))
+	if ok {
+		*mt = got
+		return nil
+	}
+	return errors.New("unknown mitigation type")
+}
+
+// MitigationAction is the action of a FlowSpec rule.
+type MitigationAction int
+
+const (
+	// MitigationDiscard drops the matching traffic.
+	MitigationDiscard MitigationAction = iota
+	// MitigationRateLimit limits the rate of the matching traffic.
+	MitigationRateLimit
+)
+
+var mitigationActionMap = helpers.NewBimap(map[MitigationAction]string{
+	MitigationDiscard:   "discard",
+	MitigationRateLimit: "rate-limit",
+})
+
+// MarshalText turns a mitigation action to text.
+func (ma MitigationAction) MarshalText() ([]byte, error) {
+	got, ok := mitigationActionMap.LoadValue(ma)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown mitigation action")
+}
+
+// String turns a mitigation action to string.
+func (ma MitigationAction) String() string {
+	got, _ := mitigationActionMap.LoadValue(ma)
+	return got
+}
+
+// UnmarshalText provides a mitigation action from a string.
+func (ma *MitigationAction) UnmarshalText(input []byte) error {
+	got, ok := mitigationActionMap.LoadKey(string(input))
+	if ok {
+		*ma = got
+		return nil
+	}
+	return errors.New("unknown mitigation action")
+}
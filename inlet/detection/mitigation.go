@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package detection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"time"
+)
+
+// rule is a FlowSpec rule mitigating an anomaly.
+type rule struct {
+	Destination netip.Prefix     `json:"destination"`
+	Protocol    uint32           `json:"protocol"`
+	Action      MitigationAction `json:"action"`
+	RateLimit   uint64           `json:"rate-limit,omitempty"`
+}
+
+// mitigation is a rule to announce or to withdraw.
+type mitigation struct {
+	Action string `json:"action"`
+	Rule   rule   `json:"rule"`
+	Alert  *Alert `json:"alert,omitempty"`
+	// expiration is the time to withdraw an announced rule
+	expiration time.Time
+}
+
+// exabgp formats the rule for the API of ExaBGP.
+func (r rule) exabgp() string {
+	then := "discard;"
+	if r.Action == MitigationRateLimit {
+		then = fmt.Sprintf("rate-limit %d;", r.RateLimit)
+	}
+	return fmt.Sprintf("flow route { match { destination %s; protocol =%d; } then { %s } }",
+		r.Destination, r.Protocol, then)
+}
+
+// mitigate queues the announce of a rule to mitigate the provided
+// alert.
+func (c *Component) mitigate(alert Alert) {
+	if c.config.Mitigation.Type == MitigationNone || !alert.Target.IsValid() {
+		return
+	}
+	r := rule{
+		Destination: netip.PrefixFrom(alert.Target, alert.Target.BitLen()),
+		Protocol:    alert.Protocol,
+		Action:      c.config.Mitigation.Action,
+	}
+	if r.Action == MitigationRateLimit {
+		r.RateLimit = c.config.Mitigation.RateLimit
+	}
+	var expiration time.Time
+	if c.config.Mitigation.Duration > 0 {
+		expiration = alert.Time.Add(c.config.Mitigation.Duration)
+	}
+	select {
+	case c.mitigations <- mitigation{Action: "announce", Rule: r, Alert: &alert, expiration: expiration}:
+	default:
+		c.metrics.mitigationsDropped.Inc()
+		c.r.Error().
+			Str("rule", r.exabgp()).
+			Msg("mitigation queue full, announce dropped")
+	}
+}
+
+// announce announces a rule. The rule becomes active only once
+// successfully announced. On failure, it is dropped and a later alert
+// will trigger a new attempt. When the rule is already active, its
+// expiration is pushed back.
+func (c *Component) announce(m mitigation) {
+	if _, ok := c.active[m.Rule]; ok {
+		c.active[m.Rule] = m.expiration
+		return
+	}
+	if err := c.apply(m); err == nil {
+		c.active[m.Rule] = m.expiration
+		c.metrics.mitigationsActive.Set(float64(len(c.active)))
+	}
+}
+
+// expire withdraws the expired rules. A rule which cannot be withdrawn
+// stays active and its withdrawal is retried on the next call.
+func (c *Component) expire(now time.Time) {
+	for r, expiration := range c.active {
+		if !expiration.IsZero() && !now.Before(expiration) {
+			if err := c.apply(mitigation{Action: "withdraw", Rule: r}); err == nil {
+				delete(c.active, r)
+			}
+		}
+	}
+	c.metrics.mitigationsActive.Set(float64(len(c.active)))
+}
+
+// withdrawAll withdraws all the active rules, including the ones
+// without expiration. It is called when the component stops.
+func (c *Component) withdrawAll() {
+	for r := range c.active {
+		c.apply(mitigation{Action: "withdraw", Rule: r})
+		delete(c.active, r)
+	}
+	c.metrics.mitigationsActive.Set(0)
+}
+
+// apply sends a mitigation action to ExaBGP or to the webhook. All
+// actions are logged for auditing purpose.
+func (c *Component) apply(m mitigation) error {
+	var (
+		contentType string
+		payload     []byte
+		err         error
+	)
+	switch c.config.Mitigation.Type {
+	case MitigationExaBGP:
+		contentType = "application/x-www-form-urlencoded"
+		payload = []byte(url.Values{
+			"command": []string{fmt.Sprintf("%s %s", m.Action, m.Rule.exabgp())},
+		}.Encode())
+	case MitigationWebhook:
+		contentType = "application/json"
+		payload, err = json.Marshal(m)
+	}
+	if err == nil {
+		err = post(c.mitigationClient, c.config.Mitigation.URL, c.config.Mitigation.Headers,
+			contentType, payload)
+	}
+	l := c.r.Info()
+	result := "success"
+	if err != nil {
+		l = c.r.Err(err)
+		result = "error"
+	}
+	if m.Alert != nil {
+		l = l.Str("exporter", m.Alert.Exporter).
+			Str("direction", m.Alert.Direction).
+			Float64("bps", m.Alert.BPS)
+	}
+	l.Str("action", m.Action).
+		Str("mitigation", c.config.Mitigation.Type.String()).
+		Str("rule", m.Rule.exabgp()).
+		Str("result", result).
+		Msg("mitigation rule")
+	c.metrics.mitigations.WithLabelValues(m.Action, result).Inc()
+	return err
+}
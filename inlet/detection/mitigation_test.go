@@ -0,0 +1,340 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package detection
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/flow/decoder"
+)
+
+func setupMitigation(t *testing.T, mitigation MitigationConfiguration) (*reporter.Reporter, *Component) {
+	t.Helper()
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Mitigation = mitigation
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  core.NewBroadcaster(),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	return r, c
+}
+
+func TestMitigationWithoutURL(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.Mitigation.Type = MitigationExaBGP
+	_, err := New(reporter.NewMock(t), configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  core.NewBroadcaster(),
+	})
+	if err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+// mitigationServer is a webhook receiving mitigation actions. It
+// answers with the provided status code.
+func mitigationServer(t *testing.T, status *int32) (string, <-chan string) {
+	t.Helper()
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var got mitigation
+		body, _ := io.ReadAll(req.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("Unmarshal() error:\n%+v", err)
+		}
+		received <- fmt.Sprintf("%s %s", got.Action, got.Rule.Destination)
+		w.WriteHeader(int(atomic.LoadInt32(status)))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, received
+}
+
+func expectMitigation(t *testing.T, received <-chan string, expected string) {
+	t.Helper()
+	select {
+	case got := <-received:
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("mitigation (-got, +want):\n%s", diff)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("mitigation %q not received", expected)
+	}
+}
+
+func expectNoMitigation(t *testing.T, received <-chan string) {
+	t.Helper()
+	select {
+	case got := <-received:
+		t.Fatalf("unexpected mitigation %q", got)
+	default:
+	}
+}
+
+func TestMitigate(t *testing.T) {
+	status := int32(http.StatusOK)
+	url, received := mitigationServer(t, &status)
+	mitigationConfiguration := DefaultConfiguration().Mitigation
+	mitigationConfiguration.Type = MitigationWebhook
+	mitigationConfiguration.URL = url
+	mitigationConfiguration.Action = MitigationRateLimit
+	mitigationConfiguration.RateLimit = 1000
+	mitigationConfiguration.Duration = time.Minute
+	r, c := setupMitigation(t, mitigationConfiguration)
+
+	// The target is the destination with the most traffic
+	for _, dst := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.2"} {
+		c.add(&flow.Message{
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			DstAddr:         net.ParseIP(dst),
+			Bytes:           1000,
+			Proto:           17,
+			InIfBoundary:    decoder.FlowMessage_EXTERNAL,
+		})
+	}
+	k := key{exporter: "192.0.2.142", direction: "in", protocol: 17}
+	if diff := helpers.Diff(c.topTarget(k), netip.MustParseAddr("198.51.100.2")); diff != "" {
+		t.Fatalf("topTarget() (-got, +want):\n%s", diff)
+	}
+
+	now := time.Date(2022, 10, 15, 10, 0, 0, 0, time.UTC)
+	alert := Alert{
+		Time:      now,
+		Exporter:  "192.0.2.142",
+		Direction: "in",
+		Protocol:  17,
+		Target:    netip.MustParseAddr("198.51.100.2"),
+	}
+	expectedRule := rule{
+		Destination: netip.MustParsePrefix("198.51.100.2/32"),
+		Protocol:    17,
+		Action:      MitigationRateLimit,
+		RateLimit:   1000,
+	}
+	announce := func() {
+		t.Helper()
+		select {
+		case got := <-c.mitigations:
+			if diff := helpers.Diff(got, mitigation{Action: "announce", Rule: expectedRule, Alert: &alert}); diff != "" {
+				t.Fatalf("mitigate() (-got, +want):\n%s", diff)
+			}
+			c.announce(got)
+		default:
+			t.Fatal("mitigate() did not queue an action")
+		}
+	}
+
+	// A failed announce does not make the rule active
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	c.mitigate(alert)
+	announce()
+	expectMitigation(t, received, "announce 198.51.100.2/32")
+	c.expire(now.Add(time.Hour))
+	expectNoMitigation(t, received)
+
+	// A successful one does
+	atomic.StoreInt32(&status, http.StatusOK)
+	c.mitigate(alert)
+	announce()
+	expectMitigation(t, received, "announce 198.51.100.2/32")
+
+	// A second alert only pushes back the expiration
+	alert.Time = now.Add(30 * time.Second)
+	c.mitigate(alert)
+	announce()
+	c.expire(now.Add(time.Minute))
+	expectNoMitigation(t, received)
+
+	// A failed withdraw is retried
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	c.expire(now.Add(90 * time.Second))
+	expectMitigation(t, received, "withdraw 198.51.100.2/32")
+	atomic.StoreInt32(&status, http.StatusOK)
+	c.expire(now.Add(100 * time.Second))
+	expectMitigation(t, received, "withdraw 198.51.100.2/32")
+	c.expire(now.Add(110 * time.Second))
+	expectNoMitigation(t, received)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_detection_", "mitigations_")
+	expectedMetrics := map[string]string{
+		`mitigations_active`:                                    "0",
+		`mitigations_dropped_total`:                             "0",
+		`mitigations_total{action="announce",result="error"}`:   "1",
+		`mitigations_total{action="announce",result="success"}`: "1",
+		`mitigations_total{action="withdraw",result="error"}`:   "1",
+		`mitigations_total{action="withdraw",result="success"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestMitigationQueueFull(t *testing.T) {
+	mitigationConfiguration := DefaultConfiguration().Mitigation
+	mitigationConfiguration.Type = MitigationWebhook
+	mitigationConfiguration.URL = "http://127.0.0.1:1"
+	r, c := setupMitigation(t, mitigationConfiguration)
+
+	alert := Alert{
+		Time:     time.Date(2022, 10, 15, 10, 0, 0, 0, time.UTC),
+		Protocol: 17,
+		Target:   netip.MustParseAddr("198.51.100.2"),
+	}
+	for i := 0; i <= cap(c.mitigations); i++ {
+		c.mitigate(alert)
+	}
+	if len(c.active) != 0 {
+		t.Fatalf("mitigate() made %d rules active", len(c.active))
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_detection_", "mitigations_dropped_total")
+	expectedMetrics := map[string]string{
+		`mitigations_dropped_total`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestMitigationWithdrawOnStop(t *testing.T) {
+	status := int32(http.StatusOK)
+	url, received := mitigationServer(t, &status)
+	mitigationConfiguration := DefaultConfiguration().Mitigation
+	mitigationConfiguration.Type = MitigationWebhook
+	mitigationConfiguration.URL = url
+	mitigationConfiguration.Duration = 0
+	r, c := setupMitigation(t, mitigationConfiguration)
+	c.config.Enabled = true
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+
+	c.mitigate(Alert{
+		Time:     time.Now(),
+		Protocol: 17,
+		Target:   netip.MustParseAddr("198.51.100.2"),
+	})
+	expectMitigation(t, received, "announce 198.51.100.2/32")
+	time.Sleep(20 * time.Millisecond)
+
+	// Rules without expiration are withdrawn too
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+	expectMitigation(t, received, "withdraw 198.51.100.2/32")
+	gotMetrics := r.GetMetrics("akvorado_inlet_detection_", "mitigations_active")
+	expectedMetrics := map[string]string{
+		`mitigations_active`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestApplyExaBGP(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("X-Token"); got != "secret" {
+			t.Errorf("X-Token header == %q, expected %q", got, "secret")
+		}
+		if err := req.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error:\n%+v", err)
+		}
+		received <- req.PostForm.Get("command")
+	}))
+	defer server.Close()
+	t.Setenv("AKVORADO_TEST_MITIGATION_TOKEN", "secret")
+	mitigationConfiguration := DefaultConfiguration().Mitigation
+	mitigationConfiguration.Type = MitigationExaBGP
+	mitigationConfiguration.URL = server.URL
+	mitigationConfiguration.Headers = map[string]string{"X-Token": "${env:AKVORADO_TEST_MITIGATION_TOKEN}"}
+	r, c := setupMitigation(t, mitigationConfiguration)
+
+	c.apply(mitigation{
+		Action: "announce",
+		Rule: rule{
+			Destination: netip.MustParsePrefix("2001:db8::1/128"),
+			Protocol:    17,
+			Action:      MitigationDiscard,
+		},
+	})
+	got := <-received
+	expected := "announce flow route { match { destination 2001:db8::1/128; protocol =17; } then { discard; } }"
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ExaBGP command (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_detection_", "mitigations_total")
+	expectedMetrics := map[string]string{
+		`mitigations_total{action="announce",result="success"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestApplyWebhook(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		var got map[string]interface{}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("Unmarshal() error:\n%+v", err)
+		}
+		received <- got
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	mitigationConfiguration := DefaultConfiguration().Mitigation
+	mitigationConfiguration.Type = MitigationWebhook
+	mitigationConfiguration.URL = server.URL
+	r, c := setupMitigation(t, mitigationConfiguration)
+
+	c.apply(mitigation{
+		Action: "withdraw",
+		Rule: rule{
+			Destination: netip.MustParsePrefix("198.51.100.2/32"),
+			Protocol:    6,
+			Action:      MitigationRateLimit,
+			RateLimit:   1000,
+		},
+	})
+	got := <-received
+	expected := map[string]interface{}{
+		"action": "withdraw",
+		"rule": map[string]interface{}{
+			"destination": "198.51.100.2/32",
+			"protocol":    6.,
+			"action":      "rate-limit",
+			"rate-limit":  1000.,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("webhook payload (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_detection_", "mitigations_total")
+	expectedMetrics := map[string]string{
+		`mitigations_total{action="withdraw",result="error"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
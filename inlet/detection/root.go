@@ -0,0 +1,401 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package detection learns the usual traffic rates from the enriched
+// flows and raises alerts on sudden deviations, like a volumetric DDoS.
+package detection
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/flow/decoder"
+)
+
+// Component represents the anomaly detection component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	client           *http.Client
+	mitigationClient *http.Client
+	alerts           chan Alert
+	mitigations      chan mitigation
+	errLogger        reporter.Logger
+	current          map[key]float64
+	targets          map[key]map[netip.Addr]float64
+	baselines        map[key]*baseline
+	active           map[rule]time.Time
+	metrics          struct {
+		flows              reporter.Counter
+		flowsDropped       reporter.Counter
+		alerts             *reporter.CounterVec
+		alertsDropped      reporter.Counter
+		anomalies          reporter.Gauge
+		webhookErrors      *reporter.CounterVec
+		mitigations        *reporter.CounterVec
+		mitigationsDropped reporter.Counter
+		mitigationsActive  reporter.Gauge
+	}
+}
+
+// Dependencies define the dependencies of the anomaly detection
+// component.
+type Dependencies struct {
+	Daemon daemon.Component
+	Flows  core.Subscriber
+}
+
+// Alert describes a traffic anomaly.
+type Alert struct {
+	Time        time.Time  `json:"time"`
+	Exporter    string     `json:"exporter"`
+	Direction   string     `json:"direction"`
+	Protocol    uint32     `json:"protocol"`
+	Target      netip.Addr `json:"target"`
+	BPS         float64    `json:"bps"`
+	BaselineBPS float64    `json:"baseline-bps"`
+}
+
+// key identifies a baseline.
+type key struct {
+	exporter  string
+	direction string
+	protocol  uint32
+}
+
+// baseline is the usual rate for a key.
+type baseline struct {
+	bps       float64
+	intervals int
+	anomalous bool
+	lastAlert time.Time
+}
+
+// New creates a new anomaly detection component.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if configuration.Mitigation.Type != MitigationNone && configuration.Mitigation.URL == "" {
+		return nil, errors.New("an URL is required for mitigation")
+	}
+	var err error
+	if configuration.WebhookHeaders, err = helpers.ResolveSecrets(configuration.WebhookHeaders); err != nil {
+		return nil, fmt.Errorf("unable to resolve webhook headers: %w", err)
+	}
+	if configuration.Mitigation.Headers, err = helpers.ResolveSecrets(configuration.Mitigation.Headers); err != nil {
+		return nil, fmt.Errorf("unable to resolve mitigation headers: %w", err)
+	}
+	c := Component{
+		r:                r,
+		d:                &dependencies,
+		config:           configuration,
+		client:           &http.Client{Timeout: configuration.WebhookTimeout},
+		mitigationClient: &http.Client{Timeout: configuration.Mitigation.Timeout},
+		alerts:           make(chan Alert, 100),
+		mitigations:      make(chan mitigation, 100),
+		errLogger:        r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+		current:          map[key]float64{},
+		targets:          map[key]map[netip.Addr]float64{},
+		baselines:        map[key]*baseline{},
+		active:           map[rule]time.Time{},
+	}
+	c.d.Daemon.Track(&c.t, "inlet/detection")
+	c.metrics.flows = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_total",
+			Help: "Number of flows processed.",
+		},
+	)
+	c.metrics.flowsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_dropped_total",
+			Help: "Number of flows dropped because the detection was too slow.",
+		},
+	)
+	c.metrics.alerts = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "alerts_total",
+			Help: "Number of alerts raised.",
+		},
+		[]string{"exporter", "direction", "protocol"},
+	)
+	c.metrics.alertsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "alerts_dropped_total",
+			Help: "Number of alerts not sent to the webhook because the queue was full.",
+		},
+	)
+	c.metrics.anomalies = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "anomalies",
+			Help: "Number of ongoing anomalies.",
+		},
+	)
+	c.metrics.webhookErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "webhook_errors_total",
+			Help: "Number of errors when sending alerts to the webhook.",
+		},
+		[]string{"error"},
+	)
+	c.metrics.mitigations = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "mitigations_total",
+			Help: "Number of mitigation rules announced or withdrawn.",
+		},
+		[]string{"action", "result"},
+	)
+	c.metrics.mitigationsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "mitigations_dropped_total",
+			Help: "Number of mitigation actions not sent because the queue was full.",
+		},
+	)
+	c.metrics.mitigationsActive = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "mitigations_active",
+			Help: "Number of active mitigation rules.",
+		},
+	)
+	return &c, nil
+}
+
+// Start starts the anomaly detection component.
+func (c *Component) Start() error {
+	if !c.config.Enabled {
+		return nil
+	}
+	c.r.Info().Msg("starting anomaly detection component")
+	subscription := c.d.Flows.Subscribe(c.config.QueueSize)
+	c.t.Go(func() error {
+		defer subscription.Unsubscribe()
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		var dropped uint64
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case now := <-ticker.C:
+				for _, alert := range c.detect(now, c.config.Interval) {
+					c.raise(alert)
+					c.mitigate(alert)
+				}
+				newDropped := subscription.Dropped()
+				c.metrics.flowsDropped.Add(float64(newDropped - dropped))
+				dropped = newDropped
+			case fl := <-subscription.Flows():
+				c.add(fl)
+			}
+		}
+	})
+	if c.config.WebhookURL != "" {
+		c.t.Go(func() error {
+			for {
+				select {
+				case <-c.t.Dying():
+					return nil
+				case alert := <-c.alerts:
+					if err := c.send(alert); err != nil {
+						c.errLogger.Err(err).Msg("unable to send alert")
+					}
+				}
+			}
+		})
+	}
+	if c.config.Mitigation.Type != MitigationNone {
+		c.t.Go(func() error {
+			ticker := time.NewTicker(c.config.Interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-c.t.Dying():
+					c.withdrawAll()
+					return nil
+				case now := <-ticker.C:
+					c.expire(now)
+				case m := <-c.mitigations:
+					c.announce(m)
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// Stop stops the anomaly detection component.
+func (c *Component) Stop() error {
+	if !c.config.Enabled {
+		return nil
+	}
+	c.r.Info().Msg("stopping anomaly detection component")
+	defer c.r.Info().Msg("anomaly detection component stopped")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// add accounts for the provided flow in the current interval.
+func (c *Component) add(fl *flow.Message) {
+	c.metrics.flows.Inc()
+	bits := float64(fl.Bytes) * 8
+	if fl.SamplingRate > 0 {
+		bits *= float64(fl.SamplingRate)
+	}
+	exporterAddress, _ := netip.AddrFromSlice(fl.ExporterAddress)
+	direction := "internal"
+	if fl.InIfBoundary == decoder.FlowMessage_EXTERNAL {
+		direction = "in"
+	} else if fl.OutIfBoundary == decoder.FlowMessage_EXTERNAL {
+		direction = "out"
+	}
+	k := key{
+		exporter:  c.r.ExporterLabel(exporterAddress.Unmap().String()),
+		direction: direction,
+		protocol:  fl.Proto,
+	}
+	c.current[k] += bits
+	if c.config.Mitigation.Type != MitigationNone {
+		if target, ok := netip.AddrFromSlice(fl.DstAddr); ok {
+			if _, ok := c.targets[k]; !ok {
+				c.targets[k] = map[netip.Addr]float64{}
+			}
+			c.targets[k][target.Unmap()] += bits
+		}
+	}
+}
+
+// detect compares the rates of the current interval, whose duration
+// is provided, with the baselines and returns the alerts to raise. The
+// baselines are then updated and a new interval starts.
+func (c *Component) detect(now time.Time, interval time.Duration) []Alert {
+	alerts := []Alert{}
+	for k := range c.current {
+		if _, ok := c.baselines[k]; !ok {
+			c.baselines[k] = &baseline{}
+		}
+	}
+	anomalies := 0
+	for k, b := range c.baselines {
+		bps := c.current[k] / interval.Seconds()
+		b.anomalous = b.intervals >= c.config.LearningIntervals &&
+			bps >= float64(c.config.MinimumBPS) &&
+			bps > b.bps*c.config.Threshold
+		if b.anomalous {
+			// Do not learn the anomaly.
+			anomalies++
+			if b.lastAlert.IsZero() || now.Sub(b.lastAlert) >= c.config.Holdoff {
+				b.lastAlert = now
+				alerts = append(alerts, Alert{
+					Time:        now,
+					Exporter:    k.exporter,
+					Direction:   k.direction,
+					Protocol:    k.protocol,
+					Target:      c.topTarget(k),
+					BPS:         bps,
+					BaselineBPS: b.bps,
+				})
+			}
+			continue
+		}
+		if b.intervals == 0 {
+			b.bps = bps
+		} else {
+			b.bps = c.config.Smoothing*bps + (1-c.config.Smoothing)*b.bps
+		}
+		b.intervals++
+		if bps == 0 && b.bps < 1 {
+			// Forget about inactive keys.
+			delete(c.baselines, k)
+		}
+	}
+	c.metrics.anomalies.Set(float64(anomalies))
+	c.current = map[key]float64{}
+	c.targets = map[key]map[netip.Addr]float64{}
+	return alerts
+}
+
+// topTarget returns the destination receiving the most traffic for the
+// provided key during the current interval.
+func (c *Component) topTarget(k key) netip.Addr {
+	var top netip.Addr
+	var topBits float64
+	for target, bits := range c.targets[k] {
+		if bits > topBits {
+			top, topBits = target, bits
+		}
+	}
+	return top
+}
+
+// raise logs, counts and queues the provided alert.
+func (c *Component) raise(alert Alert) {
+	c.r.Warn().
+		Str("exporter", alert.Exporter).
+		Str("direction", alert.Direction).
+		Uint32("protocol", alert.Protocol).
+		Float64("bps", alert.BPS).
+		Float64("baseline-bps", alert.BaselineBPS).
+		Msg("traffic anomaly detected")
+	c.metrics.alerts.WithLabelValues(alert.Exporter, alert.Direction,
+		strconv.FormatUint(uint64(alert.Protocol), 10)).Inc()
+	if c.config.WebhookURL == "" {
+		return
+	}
+	select {
+	case c.alerts <- alert:
+	default:
+		c.metrics.alertsDropped.Inc()
+	}
+}
+
+// send sends an alert to the webhook.
+func (c *Component) send(alert Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		c.metrics.webhookErrors.WithLabelValues("cannot encode alert").Inc()
+		return fmt.Errorf("unable to encode alert: %w", err)
+	}
+	if err := post(c.client, c.config.WebhookURL, c.config.WebhookHeaders,
+		"application/json", payload); err != nil {
+		c.metrics.webhookErrors.WithLabelValues("cannot send alert").Inc()
+		return err
+	}
+	return nil
+}
+
+// post sends a POST request with the provided payload.
+func post(client *http.Client, url string, headers map[string]string, contentType string, payload []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("unable to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package detection
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestDetect(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.LearningIntervals = 3
+	configuration.MinimumBPS = 1000
+	configuration.Holdoff = time.Minute
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  core.NewBroadcaster(),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	// Send 1000 bytes per second, then 5000 bytes per second.
+	now := time.Date(2022, 10, 15, 10, 0, 0, 0, time.UTC)
+	var got []Alert
+	for i := 0; i < 8; i++ {
+		bytes := uint64(1000)
+		if i >= 5 {
+			bytes = 5000
+		}
+		c.add(&flow.Message{
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			Bytes:           bytes * 10,
+			Proto:           17,
+			InIfBoundary:    decoder.FlowMessage_EXTERNAL,
+		})
+		got = append(got, c.detect(now, 10*time.Second)...)
+		now = now.Add(10 * time.Second)
+	}
+
+	// Only one alert is raised due to the holdoff.
+	expected := []Alert{
+		{
+			Time:        time.Date(2022, 10, 15, 10, 0, 50, 0, time.UTC),
+			Exporter:    "192.0.2.142",
+			Direction:   "in",
+			Protocol:    17,
+			BPS:         40000,
+			BaselineBPS: 8000,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("detect() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_detection_", "anomalies")
+	expectedMetrics := map[string]string{
+		`anomalies`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Traffic goes back to normal
+	c.add(&flow.Message{
+		ExporterAddress: net.ParseIP("192.0.2.142"),
+		Bytes:           10000,
+		Proto:           17,
+		InIfBoundary:    decoder.FlowMessage_EXTERNAL,
+	})
+	if got := c.detect(now, 10*time.Second); len(got) != 0 {
+		t.Fatalf("detect() == %v, expected no alert", got)
+	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_detection_", "anomalies")
+	expectedMetrics = map[string]string{
+		`anomalies`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestUnresolvedHeaders(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.WebhookHeaders = map[string]string{"X-Token": "${env:AKVORADO_TEST_MISSING}"}
+	if _, err := New(reporter.NewMock(t), configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  core.NewBroadcaster(),
+	}); err == nil {
+		t.Fatal("New() did not error with unresolved webhook headers")
+	}
+	configuration = DefaultConfiguration()
+	configuration.Mitigation.Type = MitigationExaBGP
+	configuration.Mitigation.URL = "http://127.0.0.1:1"
+	configuration.Mitigation.Headers = map[string]string{"X-Token": "${env:AKVORADO_TEST_MISSING}"}
+	if _, err := New(reporter.NewMock(t), configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  core.NewBroadcaster(),
+	}); err == nil {
+		t.Fatal("New() did not error with unresolved mitigation headers")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan Alert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("X-Token"); got != "secret" {
+			t.Errorf("X-Token header == %q, expected %q", got, "secret")
+		}
+		var alert Alert
+		if err := json.NewDecoder(req.Body).Decode(&alert); err != nil {
+			t.Errorf("Decode() error:\n%+v", err)
+		}
+		received <- alert
+	}))
+	defer server.Close()
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Enabled = true
+	configuration.WebhookURL = server.URL
+	t.Setenv("AKVORADO_TEST_WEBHOOK_TOKEN", "secret")
+	configuration.WebhookHeaders = map[string]string{"X-Token": "${env:AKVORADO_TEST_WEBHOOK_TOKEN}"}
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Flows:  core.NewBroadcaster(),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	alert := Alert{
+		Time:        time.Date(2022, 10, 15, 10, 0, 50, 0, time.UTC),
+		Exporter:    "192.0.2.142",
+		Direction:   "in",
+		Protocol:    17,
+		BPS:         40000,
+		BaselineBPS: 8000,
+	}
+	c.raise(alert)
+	select {
+	case got := <-received:
+		if diff := helpers.Diff(got, alert); diff != "" {
+			t.Fatalf("webhook alert (-got, +want):\n%s", diff)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("webhook not called")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_detection_", "alerts_total")
+	expectedMetrics := map[string]string{
+		`alerts_total{direction="in",exporter="192.0.2.142",protocol="17"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package fanout
+
+import "akvorado/inlet/flow"
+
+// Configuration describes the outputs flows are sent to.
+type Configuration []OutputConfiguration
+
+// OutputConfiguration describes one of the outputs.
+type OutputConfiguration struct {
+	// Type is the type of output (kafka, file, ...). The output is
+	// configured with the section of the same name.
+	Type string `validate:"required"`
+	// Filter selects the flows sent to this output. When empty, all
+	// flows are sent.
+	Filter flow.Filter
+	// QueueSize is the number of flows waiting to be sent to this
+	// output. When the queue is full, flows are dropped. When 0,
+	// DefaultQueueSize is used.
+	QueueSize int `validate:"min=0"`
+}
+
+// DefaultQueueSize is the queue size used when not specified.
+const DefaultQueueSize = 10000
@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package fanout provides an output sending flows to several outputs.
+// Each output has its own filter and queue, so a slow output does not
+// slow down the other ones.
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the fan-out output.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	outputs []*output
+	metrics struct {
+		flows    *reporter.CounterVec
+		filtered *reporter.CounterVec
+		dropped  *reporter.CounterVec
+	}
+}
+
+// Dependencies define the dependencies of the fan-out output.
+type Dependencies struct {
+	Daemon daemon.Component
+	// Outputs are the outputs, in the same order as the configuration.
+	Outputs []core.Output
+}
+
+// output is one of the outputs with its queue.
+type output struct {
+	name     string
+	filter   atomic.Pointer[flow.Filter]
+	output   core.Output
+	queue    chan queuedFlow
+	flows    reporter.Counter
+	filtered reporter.Counter
+	dropped  reporter.Counter
+}
+
+// queuedFlow is a flow waiting to be sent to an output.
+type queuedFlow struct {
+	ctx      context.Context
+	exporter string
+	flow     *flow.Message
+}
+
+// New creates a new fan-out output.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if len(configuration) == 0 {
+		return nil, errors.New("at least one output is required")
+	}
+	if len(configuration) != len(dependencies.Outputs) {
+		return nil, errors.New("each output should be provided")
+	}
+	seen := map[string]bool{}
+	for _, oc := range configuration {
+		if seen[oc.Type] {
+			return nil, fmt.Errorf("output %q specified twice", oc.Type)
+		}
+		seen[oc.Type] = true
+	}
+	c := Component{
+		r:      r,
+		d:      &dependencies,
+		config: configuration,
+	}
+	c.d.Daemon.Track(&c.t, "inlet/fanout")
+	c.metrics.flows = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_total",
+			Help: "Number of flows queued for an output.",
+		},
+		[]string{"output"},
+	)
+	c.metrics.filtered = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_filtered_total",
+			Help: "Number of flows not selected by the filter of an output.",
+		},
+		[]string{"output"},
+	)
+	c.metrics.dropped = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_dropped_total",
+			Help: "Number of flows dropped because the queue of an output was full.",
+		},
+		[]string{"output"},
+	)
+	for idx, oc := range configuration {
+		queueSize := oc.QueueSize
+		if queueSize == 0 {
+			queueSize = DefaultQueueSize
+		}
+		filter := oc.Filter
+		o := &output{
+			name:     oc.Type,
+			output:   dependencies.Outputs[idx],
+			queue:    make(chan queuedFlow, queueSize),
+			flows:    c.metrics.flows.WithLabelValues(oc.Type),
+			filtered: c.metrics.filtered.WithLabelValues(oc.Type),
+			dropped:  c.metrics.dropped.WithLabelValues(oc.Type),
+		}
+		o.filter.Store(&filter)
+		c.outputs = append(c.outputs, o)
+	}
+	return &c, nil
+}
+
+// Start starts the fan-out output.
+func (c *Component) Start() error {
+	c.r.Info().Int("outputs", len(c.outputs)).Msg("starting fan-out output")
+	for _, o := range c.outputs {
+		o := o
+		c.t.Go(func() error {
+			return c.run(o)
+		})
+	}
+	return nil
+}
+
+// Stop stops the fan-out output. Queued flows are sent to their
+// output before stopping.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("fan-out output stopped")
+	c.r.Info().Msg("stopping fan-out output")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// Send queues a flow for each output whose filter selects it. If the
+// queue of an output is full, the flow is dropped for this output.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.SendContext(context.Background(), exporter, fl)
+}
+
+// SendContext is like Send but the provided context is handed to the
+// outputs accepting one.
+func (c *Component) SendContext(ctx context.Context, exporter string, fl *flow.Message) {
+	for _, o := range c.outputs {
+		if !o.filter.Load().Match(fl) {
+			o.filtered.Inc()
+			continue
+		}
+		select {
+		case o.queue <- queuedFlow{ctx, exporter, fl}:
+			o.flows.Inc()
+		default:
+			o.dropped.Inc()
+		}
+	}
+}
+
+// Reload applies the changes to the filters of the outputs from the
+// provided configuration. It returns the other settings which were
+// modified and need a restart, prefixed by the index of the output.
+// Outputs cannot be added or removed.
+func (c *Component) Reload(configuration Configuration) ([]string, error) {
+	if len(configuration) != len(c.outputs) {
+		return nil, errors.New("outputs cannot be added or removed without a restart")
+	}
+	restart := []string{}
+	for idx, oc := range configuration {
+		changed := helpers.ChangedFields(c.config[idx], oc, "Filter")
+		for _, name := range changed {
+			restart = append(restart, fmt.Sprintf("%d.%s", idx, name))
+		}
+		if oc.Type != c.config[idx].Type {
+			continue
+		}
+		filter := oc.Filter
+		c.outputs[idx].filter.Store(&filter)
+		c.config[idx].Filter = oc.Filter
+	}
+	return restart, nil
+}
+
+// run sends queued flows to an output.
+func (c *Component) run(o *output) error {
+	for {
+		select {
+		case <-c.t.Dying():
+			for {
+				select {
+				case qf := <-o.queue:
+					core.SendContext(qf.ctx, o.output, qf.exporter, qf.flow)
+				default:
+					return nil
+				}
+			}
+		case qf := <-o.queue:
+			core.SendContext(qf.ctx, o.output, qf.exporter, qf.flow)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package fanout
+
+import (
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+)
+
+// testOutput records the sequence numbers of the flows it receives.
+// When blocked, it does not accept flows until unblocked.
+type testOutput struct {
+	received chan uint32
+	blocked  chan struct{}
+}
+
+func newTestOutput(blocked bool) *testOutput {
+	o := &testOutput{
+		received: make(chan uint32, 100),
+		blocked:  make(chan struct{}),
+	}
+	if !blocked {
+		close(o.blocked)
+	}
+	return o
+}
+
+func (o *testOutput) Send(_ string, fl *flow.Message) {
+	<-o.blocked
+	o.received <- fl.SequenceNum
+}
+
+func (o *testOutput) wait(t *testing.T, n int) []uint32 {
+	t.Helper()
+	got := []uint32{}
+	for i := 0; i < n; i++ {
+		select {
+		case seq := <-o.received:
+			got = append(got, seq)
+		case <-time.After(time.Second):
+			t.Fatalf("flow %d not received", i+1)
+		}
+	}
+	return got
+}
+
+func mustFilter(t *testing.T, expression string) flow.Filter {
+	t.Helper()
+	f, err := flow.NewFilter(expression)
+	if err != nil {
+		t.Fatalf("NewFilter() error:\n%+v", err)
+	}
+	return *f
+}
+
+func TestFanout(t *testing.T) {
+	r := reporter.NewMock(t)
+	kafka := newTestOutput(false)
+	file := newTestOutput(false)
+	webhook := newTestOutput(true)
+	c, err := New(r, Configuration{
+		{Type: "kafka"},
+		{Type: "file", Filter: mustFilter(t, "DstPort = 443")},
+		{Type: "webhook", QueueSize: 1},
+	}, Dependencies{
+		Daemon:  daemon.NewMock(t),
+		Outputs: []core.Output{kafka, file, webhook},
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1, DstPort: 80})
+	// The webhook output is blocked on the first flow. Wait for the
+	// queue to be empty before sending more flows: the second one is
+	// queued, the other ones are dropped.
+	time.Sleep(20 * time.Millisecond)
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2, DstPort: 443})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 3, DstPort: 443})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 4, DstPort: 443})
+
+	if diff := helpers.Diff(kafka.wait(t, 4), []uint32{1, 2, 3, 4}); diff != "" {
+		t.Errorf("kafka output (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(file.wait(t, 3), []uint32{2, 3, 4}); diff != "" {
+		t.Errorf("file output (-got, +want):\n%s", diff)
+	}
+	close(webhook.blocked)
+	if diff := helpers.Diff(webhook.wait(t, 2), []uint32{1, 2}); diff != "" {
+		t.Errorf("webhook output (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_fanout_")
+	expectedMetrics := map[string]string{
+		`flows_total{output="kafka"}`:            "4",
+		`flows_total{output="file"}`:             "3",
+		`flows_total{output="webhook"}`:          "2",
+		`flows_filtered_total{output="file"}`:    "1",
+		`flows_dropped_total{output="webhook"}`:  "2",
+		`flows_dropped_total{output="file"}`:     "0",
+		`flows_dropped_total{output="kafka"}`:    "0",
+		`flows_filtered_total{output="kafka"}`:   "0",
+		`flows_filtered_total{output="webhook"}`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestFanoutErrors(t *testing.T) {
+	cases := []struct {
+		Description   string
+		Configuration Configuration
+		Outputs       []core.Output
+	}{
+		{"no output", Configuration{}, []core.Output{}},
+		{"missing output", Configuration{{Type: "kafka"}}, []core.Output{}},
+		{"duplicate output", Configuration{{Type: "kafka"}, {Type: "kafka"}},
+			[]core.Output{newTestOutput(false), newTestOutput(false)}},
+	}
+	for _, tc := range cases {
+		_, err := New(reporter.NewMock(t), tc.Configuration, Dependencies{
+			Daemon:  daemon.NewMock(t),
+			Outputs: tc.Outputs,
+		})
+		if err == nil {
+			t.Errorf("New(%s) did not error", tc.Description)
+		}
+	}
+}
+
+func TestFanoutReload(t *testing.T) {
+	r := reporter.NewMock(t)
+	kafka := newTestOutput(false)
+	file := newTestOutput(false)
+	c, err := New(r, Configuration{
+		{Type: "kafka"},
+		{Type: "file", Filter: mustFilter(t, "DstPort = 443")},
+	}, Dependencies{
+		Daemon:  daemon.NewMock(t),
+		Outputs: []core.Output{kafka, file},
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	restart, err := c.Reload(Configuration{
+		{Type: "kafka", Filter: mustFilter(t, "DstPort = 80"), QueueSize: 10},
+		{Type: "file"},
+	})
+	if err != nil {
+		t.Fatalf("Reload() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(restart, []string{"0.queuesize"}); diff != "" {
+		t.Errorf("Reload() (-got, +want):\n%s", diff)
+	}
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1, DstPort: 80})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2, DstPort: 443})
+	if diff := helpers.Diff(kafka.wait(t, 1), []uint32{1}); diff != "" {
+		t.Errorf("kafka output (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(file.wait(t, 2), []uint32{1, 2}); diff != "" {
+		t.Errorf("file output (-got, +want):\n%s", diff)
+	}
+
+	if _, err := c.Reload(Configuration{{Type: "kafka"}}); err == nil {
+		t.Error("Reload() did not error when removing an output")
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package file
+
+import (
+	"errors"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+// Configuration describes the configuration for the file component.
+type Configuration struct {
+	// Directory is where files are written.
+	Directory string
+	// Prefix is the prefix used for file names.
+	Prefix string `validate:"required"`
+	// Format is the format used to write flows.
+	Format Format
+	// Compress tells if files should be compressed with gzip.
+	Compress bool
+	// RotateInterval defines the maximum duration covered by a file.
+	RotateInterval time.Duration `validate:"min=1s"`
+	// RotateSize defines the maximum size of a file. 0 means no limit.
+	RotateSize uint64
+	// MaxFiles defines how many files to keep. 0 means no limit.
+	MaxFiles int `validate:"min=0"`
+	// RowGroupSize defines the number of flows in each Parquet row group.
+	RowGroupSize int `validate:"min=1"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// file component.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Prefix:         "flows",
+		Format:         FormatJSON,
+		RotateInterval: time.Hour,
+		RowGroupSize:   10000,
+	}
+}
+
+// Format is the format used to write flows to files.
+type Format int
+
+const (
+	// FormatJSON writes flows as JSON lines.
+	FormatJSON Format = iota
+	// FormatProtobuf writes flows as length-delimited protocol buffers.
+	FormatProtobuf
+	// FormatParquet writes flows as Parquet.
+	FormatParquet
+)
+
+var formatMap = helpers.NewBimap(map[Format]string{
+	FormatJSON:     "json",
+	FormatProtobuf: "protobuf",
+	FormatParquet:  "parquet",
+})
+
+// MarshalText turns a format to text.
+func (f Format) MarshalText() ([]byte, error) {
+	got, ok := formatMap.LoadValue(f)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown format")
+}
+
+// String turns a format to string.
+func (f Format) String() string {
+	got, _ := formatMap.LoadValue(f)
+	return got
+}
+
+// UnmarshalText provides a format from a string.
+func (f *Format) UnmarshalText(input []byte) error {
+	got, ok := formatMap.LoadKey(string(input))
+	if ok {
+		*f = got
+		return nil
+	}
+	return errors.New("unknown format")
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package file
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+
+	"akvorado/inlet/flow"
+	"akvorado/inlet/parquet"
+)
+
+// flowWriter writes flows to a file using a given format.
+type flowWriter interface {
+	Write(fl *flow.Message) error
+	// Close flushes pending flows but does not close the underlying writer.
+	Close() error
+}
+
+// extension returns the file extension for the format.
+func (f Format) extension() string {
+	switch f {
+	case FormatProtobuf:
+		return "pb"
+	case FormatParquet:
+		return "parquet"
+	}
+	return "json"
+}
+
+// newFlowWriter creates a writer for the configured format.
+func newFlowWriter(w io.Writer, configuration Configuration) (flowWriter, error) {
+	switch configuration.Format {
+	case FormatProtobuf:
+		return &protobufWriter{w: w}, nil
+	case FormatParquet:
+		return parquet.NewWriter(w, configuration.Compress, configuration.RowGroupSize)
+	}
+	return &jsonWriter{encoder: json.NewEncoder(w)}, nil
+}
+
+// jsonWriter writes flows as JSON lines.
+type jsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (jw *jsonWriter) Write(fl *flow.Message) error {
+	return jw.encoder.Encode(fl)
+}
+
+func (jw *jsonWriter) Close() error {
+	return nil
+}
+
+// protobufWriter writes flows as length-delimited protocol buffers.
+type protobufWriter struct {
+	w io.Writer
+}
+
+func (pw *protobufWriter) Write(fl *flow.Message) error {
+	buf := proto.NewBuffer([]byte{})
+	if err := buf.EncodeMessage(fl); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(buf.Bytes())
+	return err
+}
+
+func (pw *protobufWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,285 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package file provides an output writing flows to rotating files,
+// as JSON lines, length-delimited protocol buffers or Parquet. Files
+// are written with a temporary name and renamed once complete.
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the file component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	lock    sync.Mutex
+	current *outputFile
+	now     func() time.Time
+
+	errLogger reporter.Logger
+	metrics   struct {
+		flows   *reporter.CounterVec
+		bytes   reporter.Counter
+		files   reporter.Counter
+		removed reporter.Counter
+		errors  *reporter.CounterVec
+	}
+}
+
+// Dependencies define the dependencies of the file component.
+type Dependencies struct {
+	Daemon daemon.Component
+}
+
+// outputFile is a file being written.
+type outputFile struct {
+	name    string
+	file    *os.File
+	counter *countingWriter
+	buffer  *bufio.Writer
+	gzip    *gzip.Writer
+	writer  flowWriter
+	opened  time.Time
+	flows   int
+}
+
+// New creates a new file component.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if configuration.Directory == "" {
+		return nil, errors.New("a directory is required for the file output")
+	}
+	c := Component{
+		r:         r,
+		d:         &dependencies,
+		config:    configuration,
+		now:       time.Now,
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+	}
+	c.d.Daemon.Track(&c.t, "inlet/file")
+	c.metrics.flows = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_total",
+			Help: "Number of flows received from a given exporter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.bytes = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "written_bytes_total",
+			Help: "Number of bytes written to files.",
+		},
+	)
+	c.metrics.files = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "files_total",
+			Help: "Number of completed files.",
+		},
+	)
+	c.metrics.removed = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "removed_files_total",
+			Help: "Number of files removed to keep the maximum number of files.",
+		},
+	)
+	c.metrics.errors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of errors when writing flows.",
+		},
+		[]string{"error"},
+	)
+	return &c, nil
+}
+
+// Start starts the file component.
+func (c *Component) Start() error {
+	c.r.Info().Str("directory", c.config.Directory).Msg("starting file component")
+	if err := os.MkdirAll(c.config.Directory, 0o755); err != nil {
+		return fmt.Errorf("unable to create %q: %w", c.config.Directory, err)
+	}
+
+	// Rotate files regularly
+	c.t.Go(func() error {
+		ticker := time.NewTicker(c.config.RotateInterval / 10)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-ticker.C:
+				c.lock.Lock()
+				if c.current != nil && c.now().Sub(c.current.opened) >= c.config.RotateInterval {
+					c.rotate()
+				}
+				c.lock.Unlock()
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops the file component.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("file component stopped")
+	c.r.Info().Msg("stopping file component")
+	c.t.Kill(nil)
+	err := c.t.Wait()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.current != nil {
+		c.rotate()
+	}
+	return err
+}
+
+// Send writes a flow to the current file.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.metrics.flows.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.current == nil {
+		current, err := c.open()
+		if err != nil {
+			c.metrics.errors.WithLabelValues("cannot open file").Inc()
+			c.errLogger.Err(err).Msg("unable to open file")
+			return
+		}
+		c.current = current
+	}
+	if err := c.current.writer.Write(fl); err != nil {
+		c.metrics.errors.WithLabelValues("cannot write flow").Inc()
+		c.errLogger.Err(err).Str("exporter", exporter).Msg("unable to write flow")
+		return
+	}
+	c.current.flows++
+	if c.config.RotateSize > 0 && c.current.size() >= c.config.RotateSize {
+		c.rotate()
+	}
+}
+
+// open opens a new file. The file is written with a temporary name
+// until rotated.
+func (c *Component) open() (*outputFile, error) {
+	now := c.now()
+	name := fmt.Sprintf("%s-%s.%s",
+		c.config.Prefix,
+		now.UTC().Format("20060102T150405.000000000Z"),
+		c.config.Format.extension())
+	if c.config.Compress && c.config.Format != FormatParquet {
+		name += ".gz"
+	}
+	name = filepath.Join(c.config.Directory, name)
+	f, err := os.OpenFile(fmt.Sprintf("%s.tmp", name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	of := outputFile{
+		name:    name,
+		file:    f,
+		counter: &countingWriter{w: f, counter: c.metrics.bytes},
+		opened:  now,
+	}
+	of.buffer = bufio.NewWriter(of.counter)
+	var w io.Writer = of.buffer
+	if c.config.Compress && c.config.Format != FormatParquet {
+		of.gzip = gzip.NewWriter(w)
+		w = of.gzip
+	}
+	of.writer, err = newFlowWriter(w, c.config)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &of, nil
+}
+
+// rotate completes the current file and removes the oldest files
+// if needed. The lock should be held.
+func (c *Component) rotate() {
+	of := c.current
+	c.current = nil
+	err := of.writer.Close()
+	if err == nil && of.gzip != nil {
+		err = of.gzip.Close()
+	}
+	if err == nil {
+		err = of.buffer.Flush()
+	}
+	if cerr := of.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(of.file.Name(), of.name)
+	}
+	if err != nil {
+		c.metrics.errors.WithLabelValues("cannot complete file").Inc()
+		c.errLogger.Err(err).Str("file", of.name).Msg("unable to complete file")
+		return
+	}
+	c.metrics.files.Inc()
+	c.r.Debug().Str("file", of.name).Int("flows", of.flows).Msg("file completed")
+
+	if c.config.MaxFiles == 0 {
+		return
+	}
+	pattern := fmt.Sprintf("%s-*.%s", c.config.Prefix, c.config.Format.extension())
+	if c.config.Compress && c.config.Format != FormatParquet {
+		pattern += ".gz"
+	}
+	files, err := filepath.Glob(filepath.Join(c.config.Directory, pattern))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for len(files) > c.config.MaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			c.metrics.errors.WithLabelValues("cannot remove file").Inc()
+			c.errLogger.Err(err).Str("file", files[0]).Msg("unable to remove file")
+		} else {
+			c.metrics.removed.Inc()
+		}
+		files = files[1:]
+	}
+}
+
+// size returns the current size of the file, including buffered
+// data. Data buffered by gzip or by the Parquet writer is not
+// accounted.
+func (of *outputFile) size() uint64 {
+	return of.counter.written + uint64(of.buffer.Buffered())
+}
+
+// countingWriter counts the number of bytes written.
+type countingWriter struct {
+	w       io.Writer
+	written uint64
+	counter reporter.Counter
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.written += uint64(n)
+	cw.counter.Add(float64(n))
+	return n, err
+}
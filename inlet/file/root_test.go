@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package file
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/parquet"
+)
+
+func newTestComponent(t *testing.T, configuration Configuration) (*reporter.Reporter, *Component) {
+	t.Helper()
+	r := reporter.NewMock(t)
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	current := time.Date(2022, 10, 15, 10, 0, 0, 0, time.UTC)
+	c.now = func() time.Time {
+		current = current.Add(time.Second)
+		return current
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	return r, c
+}
+
+func listFiles(t *testing.T, directory string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatalf("ReadDir() error:\n%+v", err)
+	}
+	files := []string{}
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestMissingDirectory(t *testing.T) {
+	r := reporter.NewMock(t)
+	if _, err := New(r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestJSONWithRotation(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.Directory = t.TempDir()
+	configuration.RotateSize = 1
+	configuration.MaxFiles = 2
+	r, c := newTestComponent(t, configuration)
+
+	for i := 1; i <= 3; i++ {
+		c.Send("127.0.0.1", &flow.Message{SequenceNum: uint32(i)})
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+
+	files := listFiles(t, configuration.Directory)
+	expectedFiles := []string{
+		"flows-20221015T100002.000000000Z.json",
+		"flows-20221015T100003.000000000Z.json",
+	}
+	if diff := helpers.Diff(files, expectedFiles); diff != "" {
+		t.Fatalf("Files (-got, +want):\n%s", diff)
+	}
+	for i, file := range files {
+		content, err := os.ReadFile(filepath.Join(configuration.Directory, file))
+		if err != nil {
+			t.Fatalf("ReadFile() error:\n%+v", err)
+		}
+		var got struct{ SequenceNum int }
+		if err := json.Unmarshal(content, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error:\n%+v", err)
+		}
+		if got.SequenceNum != i+2 {
+			t.Errorf("SequenceNum: %d instead of %d", got.SequenceNum, i+2)
+		}
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_file_", "flows_", "files_", "removed_")
+	expectedMetrics := map[string]string{
+		`flows_total{exporter="127.0.0.1"}`: "3",
+		`files_total`:                       "3",
+		`removed_files_total`:               "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestRotateInterval(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.Directory = t.TempDir()
+	configuration.RotateInterval = 100 * time.Millisecond
+	_, c := newTestComponent(t, configuration)
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+
+	// The clock moves one second each time it is read.
+	time.Sleep(50 * time.Millisecond)
+	c.lock.Lock()
+	current := c.current
+	c.lock.Unlock()
+	if current != nil {
+		t.Fatal("file not rotated")
+	}
+	if files := listFiles(t, configuration.Directory); len(files) != 1 {
+		t.Fatalf("Files: %v, expected one file", files)
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+}
+
+func TestCompressedProtobuf(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.Directory = t.TempDir()
+	configuration.Format = FormatProtobuf
+	configuration.Compress = true
+	_, c := newTestComponent(t, configuration)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1, ExporterName: "exporter1"})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2, ExporterName: "exporter1"})
+	if files := listFiles(t, configuration.Directory); len(files) != 1 || filepath.Ext(files[0]) != ".tmp" {
+		t.Fatalf("Files: %v, expected one temporary file", files)
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+
+	files := listFiles(t, configuration.Directory)
+	if diff := helpers.Diff(files, []string{"flows-20221015T100001.000000000Z.pb.gz"}); diff != "" {
+		t.Fatalf("Files (-got, +want):\n%s", diff)
+	}
+	f, err := os.Open(filepath.Join(configuration.Directory, files[0]))
+	if err != nil {
+		t.Fatalf("Open() error:\n%+v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error:\n%+v", err)
+	}
+	content, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("ReadAll() error:\n%+v", err)
+	}
+	decoder := proto.NewBuffer(content)
+	for i := 1; i <= 2; i++ {
+		var got flow.Message
+		if err := decoder.DecodeMessage(&got); err != nil {
+			t.Fatalf("DecodeMessage() error:\n%+v", err)
+		}
+		expected := flow.Message{SequenceNum: uint32(i), ExporterName: "exporter1"}
+		if diff := helpers.Diff(&got, &expected); diff != "" {
+			t.Fatalf("DecodeMessage() (-got, +want):\n%s", diff)
+		}
+	}
+}
+
+func TestParquetFile(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.Directory = t.TempDir()
+	configuration.Format = FormatParquet
+	_, c := newTestComponent(t, configuration)
+
+	for i := 1; i <= 5; i++ {
+		c.Send("127.0.0.1", &flow.Message{SequenceNum: uint32(i)})
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+	files := listFiles(t, configuration.Directory)
+	if diff := helpers.Diff(files, []string{"flows-20221015T100001.000000000Z.parquet"}); diff != "" {
+		t.Fatalf("Files (-got, +want):\n%s", diff)
+	}
+	content, err := os.ReadFile(filepath.Join(configuration.Directory, files[0]))
+	if err != nil {
+		t.Fatalf("ReadFile() error:\n%+v", err)
+	}
+	got := parquet.ReadColumn(t, content, "SequenceNum")
+	if diff := helpers.Diff(got, [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"5"}}); diff != "" {
+		t.Errorf("SequenceNum (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import "time"
+
+// Batch reads flows from the provided queue and hands them to send
+// in batches of at most size flows. A batch is sent once full or,
+// if not empty, every interval. When dying is closed, the flows
+// still in the queue are sent before returning. The slice given to
+// send is reused once it returns.
+func Batch(dying <-chan struct{}, queue <-chan *Message, size int, interval time.Duration, send func([]*Message)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	batch := make([]*Message, 0, size)
+	add := func(fl *Message) {
+		batch = append(batch, fl)
+		if len(batch) >= size {
+			send(batch)
+			batch = batch[:0]
+		}
+	}
+	flush := func() {
+		if len(batch) > 0 {
+			send(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case <-dying:
+			for {
+				select {
+				case fl := <-queue:
+					add(fl)
+					continue
+				default:
+				}
+				break
+			}
+			flush()
+			return
+		case fl := <-queue:
+			add(fl)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+func TestBatch(t *testing.T) {
+	dying := make(chan struct{})
+	queue := make(chan *Message, 10)
+	batches := make(chan []uint32, 10)
+	done := make(chan struct{})
+	go func() {
+		Batch(dying, queue, 3, 50*time.Millisecond, func(flows []*Message) {
+			batch := []uint32{}
+			for _, fl := range flows {
+				batch = append(batch, fl.SequenceNum)
+			}
+			batches <- batch
+		})
+		close(done)
+	}()
+	expectBatch := func(expected []uint32) {
+		t.Helper()
+		select {
+		case got := <-batches:
+			if diff := helpers.Diff(got, expected); diff != "" {
+				t.Fatalf("Batch() (-got, +want):\n%s", diff)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Batch() did not send %v", expected)
+		}
+	}
+
+	// Full batch
+	for i := uint32(1); i <= 4; i++ {
+		queue <- &Message{SequenceNum: i}
+	}
+	expectBatch([]uint32{1, 2, 3})
+
+	// Incomplete batch sent on tick
+	expectBatch([]uint32{4})
+
+	// Queued flows are sent when dying
+	queue <- &Message{SequenceNum: 5}
+	close(dying)
+	<-done
+	expectBatch([]uint32{5})
+	select {
+	case got := <-batches:
+		t.Fatalf("Batch() sent unexpected %v", got)
+	default:
+	}
+}
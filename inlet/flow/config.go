@@ -9,14 +9,18 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mitchellh/mapstructure"
 	"golang.org/x/time/rate"
 
 	"akvorado/common/helpers"
+	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/input"
 	"akvorado/inlet/flow/input/file"
+	"akvorado/inlet/flow/input/kafka"
+	"akvorado/inlet/flow/input/replay"
 	"akvorado/inlet/flow/input/udp"
 )
 
@@ -27,6 +31,16 @@ type Configuration struct {
 	// RateLimit defines a rate limit on the number of flows per
 	// second. The limit is per-exporter.
 	RateLimit rate.Limit `validate:"isdefault|min=100"`
+	// DrainTimeout is the maximum time to spend forwarding the
+	// flows still queued by the inputs when stopping.
+	DrainTimeout time.Duration `validate:"min=0"`
+	// CustomFields are site-specific fields appended to the flow
+	// messages. This is usually set from the orchestrator
+	// configuration.
+	CustomFields []CustomField `validate:"dive"`
+	// TimestampSource defines, per exporter, which clock to use for
+	// the timestamps of the flows
+	TimestampSource helpers.SubnetMap[decoder.TimestampSource]
 }
 
 // DefaultConfiguration represents the default configuration for the flow component
@@ -39,6 +53,7 @@ func DefaultConfiguration() Configuration {
 			Decoder: "sflow",
 			Config:  udp.DefaultConfiguration(),
 		}},
+		DrainTimeout: 5 * time.Second,
 	}
 }
 
@@ -165,10 +180,13 @@ func (ic InputConfiguration) MarshalJSON() ([]byte, error) {
 }
 
 var inputs = map[string](func() input.Configuration){
-	"udp":  udp.DefaultConfiguration,
-	"file": file.DefaultConfiguration,
+	"udp":    udp.DefaultConfiguration,
+	"file":   file.DefaultConfiguration,
+	"kafka":  kafka.DefaultConfiguration,
+	"replay": replay.DefaultConfiguration,
 }
 
 func init() {
 	helpers.RegisterMapstructureUnmarshallerHook(ConfigurationUnmarshallerHook())
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[decoder.TimestampSource]())
 }
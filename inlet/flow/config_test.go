@@ -11,6 +11,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"akvorado/common/helpers"
+	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/input/file"
 	"akvorado/inlet/flow/input/udp"
 )
@@ -185,6 +186,34 @@ func TestDecodeConfiguration(t *testing.T) {
 				}
 			},
 			Error: true,
+		}, {
+			Description: "timestamp source",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"timestamp-source": gin.H{
+						"192.0.2.0/24":    "exporter",
+						"2001:db8::/64":   "collector",
+						"198.51.100.1/32": "default",
+					},
+				}
+			},
+			Expected: Configuration{
+				TimestampSource: *helpers.MustNewSubnetMap(map[string]decoder.TimestampSource{
+					"::ffff:192.0.2.0/120":    decoder.TimestampSourceExporter,
+					"2001:db8::/64":           decoder.TimestampSourceCollector,
+					"::ffff:198.51.100.1/128": decoder.TimestampSourceDefault,
+				}),
+			},
+		}, {
+			Description: "invalid timestamp source",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"timestamp-source": "sundial",
+				}
+			},
+			Error: true,
 		},
 	})
 }
@@ -216,17 +245,24 @@ func TestMarshalYAML(t *testing.T) {
 	expected := `inputs:
 - decoder: netflow
   listen: 192.0.2.11:2055
+  proxyprotocol: false
   queuesize: 1000
   receivebuffer: 0
+  trustedrelays: []
   type: udp
   workers: 3
 - decoder: sflow
   listen: 192.0.2.11:6343
+  proxyprotocol: false
   queuesize: 1000
   receivebuffer: 0
+  trustedrelays: []
   type: udp
   workers: 3
 ratelimit: 0
+draintimeout: 0s
+customfields: []
+timestampsource: {}
 `
 	if diff := helpers.Diff(strings.Split(string(got), "\n"), strings.Split(expected, "\n")); diff != "" {
 		t.Fatalf("Marshal() (-got, +want):\n%s", diff)
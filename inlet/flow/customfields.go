@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/flow/decoder"
+)
+
+const (
+	// CustomFieldsFirstNumber is the lowest protobuf field number
+	// allowed for a custom field.
+	CustomFieldsFirstNumber = 1000
+	// CustomFieldsLastNumber is the highest protobuf field number
+	// allowed for a custom field. Above are the numbers reserved by
+	// protobuf.
+	CustomFieldsLastNumber = 18999
+)
+
+// CustomField describes a site-specific field appended to the flow
+// messages. Exactly one source should be set: an element from the
+// decoder, a list of classifiers or an expression.
+type CustomField struct {
+	// Name is the name of the field, both in protobuf and in ClickHouse
+	Name string `validate:"required,alphanum"`
+	// Number is the protobuf field number. It should not change
+	// once the field is in use.
+	Number protowire.Number
+	// Type is the type of the field
+	Type CustomFieldType
+	// DecoderElement is the NetFlow/IPFIX element type to copy
+	DecoderElement uint16
+	// Classifiers is a list of rules to classify the flow. The
+	// first rule returning a value wins.
+	Classifiers []string
+	// Expression is an expression returning the value of the field
+	Expression string
+}
+
+// CustomFieldType is the type of a custom field.
+type CustomFieldType int
+
+const (
+	// CustomFieldString is a string
+	CustomFieldString CustomFieldType = iota
+	// CustomFieldUint is an unsigned 64-bit integer
+	CustomFieldUint
+)
+
+var customFieldTypeMap = helpers.NewBimap(map[CustomFieldType]string{
+	CustomFieldString: "string",
+	CustomFieldUint:   "uint",
+})
+
+// MarshalText turns a custom field type to text.
+func (cft CustomFieldType) MarshalText() ([]byte, error) {
+	got, ok := customFieldTypeMap.LoadValue(cft)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown field type")
+}
+
+// String turns a custom field type to string.
+func (cft CustomFieldType) String() string {
+	got, _ := customFieldTypeMap.LoadValue(cft)
+	return got
+}
+
+// UnmarshalText provides a custom field type from a string.
+func (cft *CustomFieldType) UnmarshalText(input []byte) error {
+	got, ok := customFieldTypeMap.LoadKey(string(input))
+	if ok {
+		*cft = got
+		return nil
+	}
+	return errors.New("unknown field type")
+}
+
+// ProtobufType returns the protobuf type of a custom field.
+func (cft CustomFieldType) ProtobufType() string {
+	if cft == CustomFieldUint {
+		return "uint64"
+	}
+	return "string"
+}
+
+// ClickHouseType returns the ClickHouse type of a custom field.
+func (cft CustomFieldType) ClickHouseType() string {
+	if cft == CustomFieldUint {
+		return "UInt64"
+	}
+	return "LowCardinality(String)"
+}
+
+// ValidateCustomFields checks the provided custom fields do not clash
+// with each other or with the fields of the flow messages.
+func ValidateCustomFields(fields []CustomField) error {
+	existing := map[string]bool{}
+	numbers := map[protowire.Number]string{}
+	elements := map[uint16]string{}
+	descFields := (&Message{}).ProtoReflect().Descriptor().Fields()
+	for i := 0; i < descFields.Len(); i++ {
+		existing[strings.ToLower(string(descFields.Get(i).Name()))] = true
+	}
+	for _, field := range fields {
+		name := strings.ToLower(field.Name)
+		if existing[name] {
+			return fmt.Errorf("custom field %q already exists", field.Name)
+		}
+		existing[name] = true
+		if field.Number < CustomFieldsFirstNumber || field.Number > CustomFieldsLastNumber {
+			return fmt.Errorf("custom field %q should have a number between %d and %d",
+				field.Name, CustomFieldsFirstNumber, CustomFieldsLastNumber)
+		}
+		if other, ok := numbers[field.Number]; ok {
+			return fmt.Errorf("custom field %q uses the same number as %q", field.Name, other)
+		}
+		numbers[field.Number] = field.Name
+		sources := 0
+		if field.DecoderElement != 0 {
+			if other, ok := elements[field.DecoderElement]; ok {
+				return fmt.Errorf("custom field %q uses the same decoder element as %q", field.Name, other)
+			}
+			elements[field.DecoderElement] = field.Name
+			sources++
+		}
+		if len(field.Classifiers) > 0 {
+			if field.Type != CustomFieldString {
+				return fmt.Errorf("custom field %q should be a string to use classifiers", field.Name)
+			}
+			sources++
+		}
+		if field.Expression != "" {
+			sources++
+		}
+		if sources != 1 {
+			return fmt.Errorf("custom field %q should have exactly one source", field.Name)
+		}
+	}
+	return nil
+}
+
+// SortCustomFields returns a copy of the provided custom fields,
+// ordered by their protobuf field numbers. This way, the derived
+// schemas and columns do not depend on the order of the
+// configuration.
+func SortCustomFields(fields []CustomField) []CustomField {
+	if fields == nil {
+		return nil
+	}
+	result := make([]CustomField, len(fields))
+	copy(result, fields)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Number < result[j].Number
+	})
+	return result
+}
+
+// SchemasWithCustomFields returns the versioned protobuf definitions
+// with the provided custom fields appended to the current one.
+func SchemasWithCustomFields(fields []CustomField) map[int]string {
+	result := make(map[int]string, len(VersionedSchemas))
+	for version, schema := range VersionedSchemas {
+		result[version] = schema
+	}
+	if len(fields) == 0 {
+		return result
+	}
+	schema := result[CurrentSchemaVersion]
+	end := strings.LastIndex(schema, "}")
+	var custom strings.Builder
+	custom.WriteString("\n  // Custom fields\n")
+	for _, field := range SortCustomFields(fields) {
+		fmt.Fprintf(&custom, "  %s %s = %d;\n",
+			field.Type.ProtobufType(), field.Name, field.Number)
+	}
+	result[CurrentSchemaVersion] = schema[:end] + custom.String() + schema[end:]
+	return result
+}
+
+// customElements returns the decoder elements to copy into custom
+// fields.
+func customElements(fields []CustomField) map[uint16]decoder.CustomElement {
+	result := map[uint16]decoder.CustomElement{}
+	for _, field := range fields {
+		if field.DecoderElement == 0 {
+			continue
+		}
+		result[field.DecoderElement] = decoder.CustomElement{
+			Number: field.Number,
+			String: field.Type == CustomFieldString,
+		}
+	}
+	return result
+}
+
+// customFieldDescriptors returns the protobuf descriptors of the
+// provided custom fields.
+func customFieldDescriptors(fields []CustomField) []*descriptorpb.FieldDescriptorProto {
+	result := make([]*descriptorpb.FieldDescriptorProto, 0, len(fields))
+	for _, field := range fields {
+		typ := descriptorpb.FieldDescriptorProto_TYPE_STRING
+		if field.Type == CustomFieldUint {
+			typ = descriptorpb.FieldDescriptorProto_TYPE_UINT64
+		}
+		result = append(result, &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(field.Name),
+			JsonName: proto.String(field.Name),
+			Number:   proto.Int32(int32(field.Number)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		})
+	}
+	return result
+}
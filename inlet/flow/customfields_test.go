@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"fmt"
+	"io/ioutil"
+	netHTTP "net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestValidateCustomFields(t *testing.T) {
+	cases := []struct {
+		Description string
+		Fields      []CustomField
+		Error       bool
+	}{
+		{"empty", nil, false},
+		{"valid", []CustomField{
+			{Name: "VRF", Number: 1000, DecoderElement: 234, Type: CustomFieldUint},
+			{Name: "Application", Number: 1002, Classifiers: []string{`Classify("web")`}},
+			{Name: "Site", Number: 1001, Expression: `"paris"`},
+		}, false},
+		{"duplicate", []CustomField{
+			{Name: "VRF", Number: 1000, DecoderElement: 234},
+			{Name: "vrf", Number: 1001, Expression: `"paris"`},
+		}, true},
+		{"duplicate number", []CustomField{
+			{Name: "VRF", Number: 1000, DecoderElement: 234},
+			{Name: "Site", Number: 1000, Expression: `"paris"`},
+		}, true},
+		{"duplicate decoder element", []CustomField{
+			{Name: "VRF", Number: 1000, DecoderElement: 234},
+			{Name: "InputVRF", Number: 1001, DecoderElement: 234},
+		}, true},
+		{"no number", []CustomField{{Name: "VRF", DecoderElement: 234}}, true},
+		{"number too low", []CustomField{{Name: "VRF", Number: 999, DecoderElement: 234}}, true},
+		{"reserved number", []CustomField{{Name: "VRF", Number: 19000, DecoderElement: 234}}, true},
+		{"existing field", []CustomField{{Name: "srcAddr", Number: 1000, Expression: `"paris"`}}, true},
+		{"classifiers with uint", []CustomField{
+			{Name: "VRF", Number: 1000, Type: CustomFieldUint, Classifiers: []string{`Classify("web")`}},
+		}, true},
+		{"no source", []CustomField{{Name: "VRF", Number: 1000}}, true},
+		{"two sources", []CustomField{{Name: "VRF", Number: 1000, DecoderElement: 234, Expression: `1`}}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			err := ValidateCustomFields(tc.Fields)
+			if err == nil && tc.Error {
+				t.Fatal("ValidateCustomFields() did not error")
+			} else if err != nil && !tc.Error {
+				t.Fatalf("ValidateCustomFields() error:\n%+v", err)
+			}
+		})
+	}
+}
+
+func TestCustomFieldsConfiguration(t *testing.T) {
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description: "custom fields",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"customfields": []gin.H{
+						{"name": "VRF", "number": 1000, "type": "uint", "decoderelement": 234},
+						{"name": "Site", "number": 1001, "expression": `"paris"`},
+					},
+				}
+			},
+			Expected: Configuration{
+				CustomFields: []CustomField{
+					{Name: "VRF", Number: 1000, Type: CustomFieldUint, DecoderElement: 234},
+					{Name: "Site", Number: 1001, Type: CustomFieldString, Expression: `"paris"`},
+				},
+			},
+		},
+	})
+}
+
+func TestSchemasWithCustomFields(t *testing.T) {
+	schemas := SchemasWithCustomFields([]CustomField{
+		{Name: "Site", Number: 1005},
+		{Name: "VRF", Number: 1000, Type: CustomFieldUint},
+	})
+	schema := schemas[CurrentSchemaVersion]
+	if !strings.HasSuffix(schema, "  uint64 VRF = 1000;\n  string Site = 1005;\n}\n") {
+		t.Fatalf("SchemasWithCustomFields() did not append custom fields:\n%s", schema)
+	}
+	if schemas[CurrentSchemaVersion-1] != VersionedSchemas[CurrentSchemaVersion-1] {
+		t.Fatal("SchemasWithCustomFields() modified previous schema")
+	}
+	if VersionedSchemas[CurrentSchemaVersion] == schema {
+		t.Fatal("SchemasWithCustomFields() did not copy current schema")
+	}
+}
+
+func TestCustomFieldsHTTP(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = nil
+	config.CustomFields = []CustomField{
+		{Name: "Site", Number: 1005, Expression: `"paris"`},
+		{Name: "VRF", Number: 1000, Type: CustomFieldUint, DecoderElement: 234},
+	}
+	c := NewMock(t, r, config)
+
+	fields := currentSchemaFields(c.CustomFields())
+	if diff := helpers.Diff(fields[len(fields)-2:], []schemaField{
+		{Name: "VRF", Number: 1000, Type: "uint64"},
+		{Name: "Site", Number: 1005, Type: "string"},
+	}); diff != "" {
+		t.Fatalf("currentSchemaFields() (-got, +want):\n%s", diff)
+	}
+
+	resp, err := netHTTP.Get(fmt.Sprintf("http://%s/api/v0/inlet/flow/schema.pb", c.d.HTTP.LocalAddr()))
+	if err != nil {
+		t.Fatalf("GET /api/v0/inlet/flow/schema.pb:\n%+v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET /api/v0/inlet/flow/schema.pb:\n%+v", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(body, &set); err != nil {
+		t.Fatalf("proto.Unmarshal() error:\n%+v", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		t.Fatalf("protodesc.NewFiles() error:\n%+v", err)
+	}
+	got, err := files.FindDescriptorByName((&Message{}).ProtoReflect().Descriptor().FullName())
+	if err != nil {
+		t.Fatalf("FindDescriptorByName() error:\n%+v", err)
+	}
+	field := got.(protoreflect.MessageDescriptor).Fields().ByNumber(1000)
+	if field == nil || field.Name() != "VRF" || field.Kind() != protoreflect.Uint64Kind {
+		t.Fatalf("FindDescriptorByName(): field 1000 is %v", field)
+	}
+}
@@ -4,32 +4,63 @@
 package flow
 
 import (
+	"context"
+	"fmt"
+	"net/netip"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/decoder/netflow"
+	"akvorado/inlet/flow/decoder/protobuf"
 	"akvorado/inlet/flow/decoder/sflow"
 )
 
 // Message describes a decoded flow message.
 type Message = decoder.FlowMessage
 
+// ReleaseMessage gives back a flow message to the pool used by the
+// decoders. The flow message should not be used afterwards.
+func ReleaseMessage(fmsg *Message) {
+	decoder.ReleaseFlowMessage(fmsg)
+}
+
 type wrappedDecoder struct {
 	c    *Component
 	orig decoder.Decoder
 }
 
-// Decode decodes a flow while keeping some stats.
+// Decode decodes a flow while keeping some stats. A panic in the
+// decoder is reported and the flow is handled as undecodable.
 func (wd *wrappedDecoder) Decode(in decoder.RawFlow) []*Message {
+	if exporter, ok := netip.AddrFromSlice(in.Source.To16()); ok {
+		in.TimestampSource, _ = wd.c.config.TimestampSource.Lookup(exporter)
+	}
 	timeTrackStart := time.Now()
-	decoded := wd.orig.Decode(in)
+	decoded := wd.decode(in)
 	timeTrackStop := time.Now()
 
+	_, span := wd.c.tracer.Start(context.Background(), "decode",
+		trace.WithTimestamp(timeTrackStart),
+		trace.WithAttributes(
+			attribute.String("decoder", wd.orig.Name()),
+			attribute.String("exporter", in.Source.String()),
+			attribute.Int("flows", len(decoded)),
+		))
+	defer span.End(trace.WithTimestamp(timeTrackStop))
+
 	if decoded == nil {
+		span.SetStatus(codes.Error, "cannot decode flow")
 		wd.c.metrics.decoderErrors.WithLabelValues(wd.orig.Name()).
 			Inc()
 		return nil
 	}
+	if span.SpanContext().IsSampled() {
+		wd.c.traced.add(span.SpanContext(), decoded)
+	}
 	wd.c.metrics.decoderTime.WithLabelValues(wd.orig.Name()).
 		Observe(float64((timeTrackStop.Sub(timeTrackStart)).Nanoseconds()) / 1000 / 1000 / 1000)
 	wd.c.metrics.decoderStats.WithLabelValues(wd.orig.Name()).
@@ -37,6 +68,19 @@ func (wd *wrappedDecoder) Decode(in decoder.RawFlow) []*Message {
 	return decoded
 }
 
+// decode decodes a flow with the original decoder, recovering from
+// panics.
+func (wd *wrappedDecoder) decode(in decoder.RawFlow) (decoded []*Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			wd.c.metrics.decoderPanics.WithLabelValues(wd.orig.Name()).Inc()
+			wd.c.r.ReportPanic(fmt.Sprintf("inlet/flow/decoder/%s", wd.orig.Name()), r)
+			decoded = nil
+		}
+	}()
+	return wd.orig.Decode(in)
+}
+
 // Name returns the name of the original decoder.
 func (wd *wrappedDecoder) Name() string {
 	return wd.orig.Name()
@@ -51,6 +95,7 @@ func (c *Component) wrapDecoder(d decoder.Decoder) decoder.Decoder {
 }
 
 var decoders = map[string]decoder.NewDecoderFunc{
-	"netflow": netflow.New,
-	"sflow":   sflow.New,
+	"netflow":  netflow.New,
+	"sflow":    sflow.New,
+	"protobuf": protobuf.New,
 }
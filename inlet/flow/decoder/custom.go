@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Custom fields are not part of the generated code. They are kept
+// encoded with the unknown fields of the flow message and they are
+// therefore sent along the other fields when the message is
+// serialized.
+
+// CustomElement is a decoder element to copy into a custom field.
+type CustomElement struct {
+	// Number is the protobuf field number of the custom field
+	Number protowire.Number
+	// String tells if the custom field is a string (an unsigned
+	// integer otherwise)
+	String bool
+}
+
+// CustomElementsSetter is implemented by decoders able to copy some
+// of the decoded elements into custom fields. The provided map is
+// indexed by the element type.
+type CustomElementsSetter interface {
+	SetCustomElements(map[uint16]CustomElement)
+}
+
+// AppendCustomUint sets the value of a custom field of type unsigned
+// integer.
+func (m *FlowMessage) AppendCustomUint(num protowire.Number, v uint64) {
+	if v == 0 {
+		return
+	}
+	m.unknownFields = protowire.AppendTag(m.unknownFields, num, protowire.VarintType)
+	m.unknownFields = protowire.AppendVarint(m.unknownFields, v)
+}
+
+// AppendCustomString sets the value of a custom field of type string.
+func (m *FlowMessage) AppendCustomString(num protowire.Number, v string) {
+	if v == "" {
+		return
+	}
+	m.unknownFields = protowire.AppendTag(m.unknownFields, num, protowire.BytesType)
+	m.unknownFields = protowire.AppendString(m.unknownFields, v)
+}
+
+// CustomUint returns the value of a custom field of type unsigned
+// integer (0 if not set).
+func (m *FlowMessage) CustomUint(num protowire.Number) (result uint64) {
+	m.walkCustomFields(func(n protowire.Number, t protowire.Type, b []byte) {
+		if n == num && t == protowire.VarintType {
+			result, _ = protowire.ConsumeVarint(b)
+		}
+	})
+	return
+}
+
+// CustomString returns the value of a custom field of type string
+// (empty if not set).
+func (m *FlowMessage) CustomString(num protowire.Number) (result string) {
+	m.walkCustomFields(func(n protowire.Number, t protowire.Type, b []byte) {
+		if n == num && t == protowire.BytesType {
+			result, _ = protowire.ConsumeString(b)
+		}
+	})
+	return
+}
+
+// walkCustomFields calls the provided function for each custom field
+// with its number, its type and its encoded value. When a field is
+// set several times, the last value wins, as with protobuf.
+func (m *FlowMessage) walkCustomFields(fn func(protowire.Number, protowire.Type, []byte)) {
+	b := m.unknownFields
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return
+		}
+		fn(num, typ, b[:n])
+		b = b[n:]
+	}
+}
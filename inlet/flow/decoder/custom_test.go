@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"akvorado/common/helpers"
+)
+
+func TestCustomFields(t *testing.T) {
+	msg := &FlowMessage{SrcAS: 65000}
+	msg.AppendCustomUint(1000, 1500)
+	msg.AppendCustomString(1001, "customer")
+	msg.AppendCustomUint(1002, 0)
+	msg.AppendCustomString(1003, "")
+
+	if got := msg.CustomUint(1000); got != 1500 {
+		t.Errorf("CustomUint(1000) == %d, expected 1500", got)
+	}
+	if got := msg.CustomString(1001); got != "customer" {
+		t.Errorf("CustomString(1001) == %q, expected %q", got, "customer")
+	}
+	if got := msg.CustomUint(1002); got != 0 {
+		t.Errorf("CustomUint(1002) == %d, expected 0", got)
+	}
+	if got := msg.CustomString(1000); got != "" {
+		t.Errorf("CustomString(1000) == %q, expected empty string", got)
+	}
+
+	// Custom fields survive a serialization round-trip
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("proto.Marshal() error:\n%+v", err)
+	}
+	got := &FlowMessage{}
+	if err := proto.Unmarshal(b, got); err != nil {
+		t.Fatalf("proto.Unmarshal() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got.CustomString(1001), "customer"); diff != "" {
+		t.Errorf("CustomString(1001) (-got, +want):\n%s", diff)
+	}
+
+	// Released messages do not keep them
+	ReleaseFlowMessage(msg)
+	if got := msg.CustomUint(1000); got != 0 {
+		t.Errorf("CustomUint(1000) == %d after release, expected 0", got)
+	}
+}
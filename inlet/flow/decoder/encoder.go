@@ -41,3 +41,29 @@ func (fm FlowMessage) MarshalJSON() ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
+
+// prettierFlowMessageDecoder is like prettierFlowMessage but decodes
+// directly into an existing flow message.
+type prettierFlowMessageDecoder struct {
+	*rawFlowMessage
+	PrettierSrcAddr         string `json:"SrcAddr,omitempty"`
+	PrettierDstAddr         string `json:"DstAddr,omitempty"`
+	PrettierExporterAddress string `json:"ExporterAddress,omitempty"`
+	PrettierInIfBoundary    string `json:"InIfBoundary,omitempty"`
+	PrettierOutIfBoundary   string `json:"OutIfBoundary,omitempty"`
+}
+
+// UnmarshalJSON unmarshals a flow message from the JSON format
+// produced by MarshalJSON.
+func (fm *FlowMessage) UnmarshalJSON(data []byte) error {
+	prettier := prettierFlowMessageDecoder{rawFlowMessage: (*rawFlowMessage)(fm)}
+	if err := json.Unmarshal(data, &prettier); err != nil {
+		return err
+	}
+	fm.SrcAddr = net.ParseIP(prettier.PrettierSrcAddr)
+	fm.DstAddr = net.ParseIP(prettier.PrettierDstAddr)
+	fm.ExporterAddress = net.ParseIP(prettier.PrettierExporterAddress)
+	fm.InIfBoundary = FlowMessage_Boundary(FlowMessage_Boundary_value[prettier.PrettierInIfBoundary])
+	fm.OutIfBoundary = FlowMessage_Boundary(FlowMessage_Boundary_value[prettier.PrettierOutIfBoundary])
+	return nil
+}
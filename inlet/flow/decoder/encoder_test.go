@@ -69,4 +69,13 @@ func TestJSONEncoding(t *testing.T) {
 	if diff := helpers.Diff(got, expected); diff != "" {
 		t.Errorf("Encode() (-got, +want):\n%s", diff)
 	}
+
+	// And decode it back
+	var decoded FlowMessage
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unmarshal() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(&decoded, flow); diff != "" {
+		t.Errorf("Unmarshal() (-got, +want):\n%s", diff)
+	}
 }
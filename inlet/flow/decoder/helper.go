@@ -4,26 +4,35 @@
 package decoder
 
 import (
+	"bytes"
 	"net"
 
 	goflowmessage "github.com/netsampler/goflow2/pb"
+
+	"akvorado/common/helpers"
 )
 
 // ConvertGoflowToFlowMessage a flow message from goflow2 to our own
-// format.
+// format. The returned flow message comes from a pool and can be
+// released with ReleaseFlowMessage().
 func ConvertGoflowToFlowMessage(input *goflowmessage.FlowMessage) *FlowMessage {
-	result := FlowMessage{
+	nextHop := input.NextHop
+	if !net.IP(input.BgpNextHop).IsUnspecified() {
+		nextHop = input.BgpNextHop
+	}
+	result := NewFlowMessage()
+	*result = FlowMessage{
 		TimeReceived:     input.TimeReceived,
 		SequenceNum:      input.SequenceNum,
 		SamplingRate:     input.SamplingRate,
 		FlowDirection:    input.FlowDirection,
-		ExporterAddress:  ipCopy(input.SamplerAddress),
+		ExporterAddress:  ipCopy(result.ExporterAddress, input.SamplerAddress),
 		TimeFlowStart:    input.TimeFlowStart,
 		TimeFlowEnd:      input.TimeFlowEnd,
 		Bytes:            input.Bytes,
 		Packets:          input.Packets,
-		SrcAddr:          ipCopy(input.SrcAddr),
-		DstAddr:          ipCopy(input.DstAddr),
+		SrcAddr:          ipCopy(result.SrcAddr, input.SrcAddr),
+		DstAddr:          ipCopy(result.DstAddr, input.DstAddr),
 		Etype:            input.Etype,
 		Proto:            input.Proto,
 		SrcPort:          input.SrcPort,
@@ -45,25 +54,61 @@ func ConvertGoflowToFlowMessage(input *goflowmessage.FlowMessage) *FlowMessage {
 		SrcNet:           input.SrcNet,
 		DstNet:           input.DstNet,
 		NextHopAS:        input.NextHopAS,
+		NextHop:          ipCopy(result.NextHop, nextHop),
 	}
-	if !net.IP(input.BgpNextHop).IsUnspecified() {
-		result.NextHop = ipCopy(input.BgpNextHop)
-	} else {
-		result.NextHop = ipCopy(input.NextHop)
+	result.NormalizeAddresses()
+	return result
+}
+
+// NormalizeAddresses ensures all IP addresses of the flow message are
+// encoded using 16 bytes (IPv4 addresses are mapped to IPv6) and that
+// Etype matches the family of the source and destination addresses.
+// A flow whose addresses are all IPv4-mapped IPv6 addresses is an
+// IPv4 flow.
+func (m *FlowMessage) NormalizeAddresses() {
+	m.ExporterAddress = ipTo16(m.ExporterAddress)
+	m.SrcAddr = ipTo16(m.SrcAddr)
+	m.DstAddr = ipTo16(m.DstAddr)
+	m.NextHop = ipTo16(m.NextHop)
+
+	ipv4, ipv6 := false, false
+	for _, addr := range [][]byte{m.SrcAddr, m.DstAddr} {
+		switch {
+		case len(addr) == 0:
+		case bytes.HasPrefix(addr, v4InV6Prefix):
+			ipv4 = true
+		default:
+			ipv6 = true
+		}
+	}
+	switch {
+	case ipv6:
+		m.Etype = helpers.ETypeIPv6
+	case ipv4:
+		m.Etype = helpers.ETypeIPv4
 	}
-	return &result
 }
 
-// Ensure we copy the IP address. This is similar to To16(), except
-// that when we get an IPv6, we return a copy.
-func ipCopy(src net.IP) net.IP {
-	if len(src) == 4 {
-		return net.IPv4(src[0], src[1], src[2], src[3])
+var v4InV6Prefix = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}
+
+// ipTo16 converts an IPv4 address to an IPv4-mapped IPv6 address.
+// Other addresses are returned unmodified.
+func ipTo16(ip []byte) []byte {
+	if len(ip) == 4 {
+		return ipCopy(make([]byte, 0, 16), ip)
 	}
-	if len(src) == 16 {
-		dst := make(net.IP, len(src))
-		copy(dst, src)
-		return dst
+	return ip
+}
+
+// Ensure we copy the IP address into dst, reusing its storage. This is
+// similar to To16(), except that when we get an IPv6, we return a
+// copy.
+func ipCopy(dst []byte, src net.IP) []byte {
+	switch len(src) {
+	case 4:
+		return append(append(dst[:0], v4InV6Prefix...), src...)
+	case 16:
+		return append(dst[:0], src...)
 	}
-	return nil
+	return dst[:0]
 }
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"net"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestNormalizeAddresses(t *testing.T) {
+	cases := []struct {
+		Description string
+		Input       *FlowMessage
+		Expected    *FlowMessage
+	}{
+		{
+			Description: "no address",
+			Input:       &FlowMessage{Etype: 0x8847},
+			Expected:    &FlowMessage{Etype: 0x8847},
+		}, {
+			Description: "IPv4 addresses",
+			Input: &FlowMessage{
+				ExporterAddress: net.ParseIP("192.0.2.142").To4(),
+				SrcAddr:         net.ParseIP("192.0.2.1").To4(),
+				DstAddr:         net.ParseIP("198.51.100.1").To4(),
+				NextHop:         net.ParseIP("203.0.113.1").To4(),
+			},
+			Expected: &FlowMessage{
+				ExporterAddress: net.ParseIP("192.0.2.142"),
+				SrcAddr:         net.ParseIP("192.0.2.1"),
+				DstAddr:         net.ParseIP("198.51.100.1"),
+				NextHop:         net.ParseIP("203.0.113.1"),
+				Etype:           helpers.ETypeIPv4,
+			},
+		}, {
+			Description: "IPv4-mapped addresses with IPv6 ether type",
+			Input: &FlowMessage{
+				SrcAddr: net.ParseIP("::ffff:192.0.2.1"),
+				DstAddr: net.ParseIP("::ffff:198.51.100.1"),
+				Etype:   helpers.ETypeIPv6,
+			},
+			Expected: &FlowMessage{
+				SrcAddr: net.ParseIP("192.0.2.1"),
+				DstAddr: net.ParseIP("198.51.100.1"),
+				Etype:   helpers.ETypeIPv4,
+			},
+		}, {
+			Description: "IPv6 addresses without ether type",
+			Input: &FlowMessage{
+				SrcAddr: net.ParseIP("2001:db8::1"),
+				DstAddr: net.ParseIP("2001:db8::2"),
+			},
+			Expected: &FlowMessage{
+				SrcAddr: net.ParseIP("2001:db8::1"),
+				DstAddr: net.ParseIP("2001:db8::2"),
+				Etype:   helpers.ETypeIPv6,
+			},
+		}, {
+			Description: "only a source address",
+			Input: &FlowMessage{
+				SrcAddr: net.ParseIP("192.0.2.1").To4(),
+			},
+			Expected: &FlowMessage{
+				SrcAddr: net.ParseIP("192.0.2.1"),
+				Etype:   helpers.ETypeIPv4,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			tc.Input.NormalizeAddresses()
+			if diff := helpers.Diff(tc.Input, tc.Expected); diff != "" {
+				t.Fatalf("NormalizeAddresses() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxLengthPrefix is the space reserved for the length of an
+// embedded message before knowing its size. A varint of this size
+// can encode up to 32 GB.
+const maxLengthPrefix = 5
+
+// AppendDelimited appends the flow message encoded as a
+// length-delimited protocol buffer to b. The output is the same as
+// with proto.Buffer.EncodeMessage(), without using reflection. It
+// should be kept in sync with the protobuf schema.
+func (m *FlowMessage) AppendDelimited(b []byte) []byte {
+	start := len(b)
+	b = append(b, make([]byte, maxLengthPrefix)...)
+	b = m.appendFields(b)
+	return fixLengthPrefix(b, start)
+}
+
+// appendFields appends the fields of the flow message, in the order
+// of their numbers. Custom fields come last.
+func (m *FlowMessage) appendFields(b []byte) []byte {
+	b = appendVarintField(b, 2, m.TimeReceived)
+	b = appendVarintField(b, 3, uint64(m.SequenceNum))
+	b = appendVarintField(b, 4, m.SamplingRate)
+	b = appendVarintField(b, 5, uint64(m.FlowDirection))
+	b = appendBytesField(b, 6, m.ExporterAddress)
+	b = appendVarintField(b, 7, m.TimeFlowStart)
+	b = appendVarintField(b, 8, m.TimeFlowEnd)
+	b = appendVarintField(b, 9, m.Bytes)
+	b = appendVarintField(b, 10, m.Packets)
+	b = appendBytesField(b, 11, m.SrcAddr)
+	b = appendBytesField(b, 12, m.DstAddr)
+	b = appendVarintField(b, 13, uint64(m.Etype))
+	b = appendVarintField(b, 14, uint64(m.Proto))
+	b = appendVarintField(b, 15, uint64(m.SrcPort))
+	b = appendVarintField(b, 16, uint64(m.DstPort))
+	b = appendVarintField(b, 17, uint64(m.InIf))
+	b = appendVarintField(b, 18, uint64(m.OutIf))
+	b = appendVarintField(b, 19, uint64(m.IPTos))
+	b = appendVarintField(b, 20, uint64(m.ForwardingStatus))
+	b = appendVarintField(b, 21, uint64(m.IPTTL))
+	b = appendVarintField(b, 22, uint64(m.TCPFlags))
+	b = appendVarintField(b, 23, uint64(m.IcmpType))
+	b = appendVarintField(b, 24, uint64(m.IcmpCode))
+	b = appendVarintField(b, 25, uint64(m.IPv6FlowLabel))
+	b = appendVarintField(b, 26, uint64(m.FragmentId))
+	b = appendVarintField(b, 27, uint64(m.FragmentOffset))
+	b = appendVarintField(b, 28, uint64(m.BiFlowDirection))
+	b = appendVarintField(b, 29, uint64(m.SrcAS))
+	b = appendVarintField(b, 30, uint64(m.DstAS))
+	b = appendVarintField(b, 31, uint64(m.SrcNet))
+	b = appendVarintField(b, 32, uint64(m.DstNet))
+	b = appendBytesField(b, 33, m.NextHop)
+	b = appendVarintField(b, 34, uint64(m.NextHopAS))
+	b = appendPackedField(b, 35, m.DstASPath)
+	b = appendPackedField(b, 36, m.DstCommunities)
+	if lc := m.DstLargeCommunities; lc != nil {
+		b = protowire.AppendTag(b, 37, protowire.BytesType)
+		start := len(b)
+		b = append(b, make([]byte, maxLengthPrefix)...)
+		b = appendPackedField(b, 1, lc.ASN)
+		b = appendPackedField(b, 2, lc.LocalData1)
+		b = appendPackedField(b, 3, lc.LocalData2)
+		b = fixLengthPrefix(b, start)
+	}
+	for _, name := range m.DstCommunityNames {
+		b = protowire.AppendTag(b, 38, protowire.BytesType)
+		b = protowire.AppendString(b, name)
+	}
+	b = appendStringField(b, 94, m.ExporterTenant)
+	b = appendStringField(b, 95, m.ExporterRegion)
+	b = appendStringField(b, 96, m.ExporterSite)
+	b = appendStringField(b, 97, m.ExporterRole)
+	b = appendStringField(b, 98, m.ExporterGroup)
+	b = appendStringField(b, 99, m.ExporterName)
+	b = appendStringField(b, 100, m.SrcCountry)
+	b = appendStringField(b, 101, m.DstCountry)
+	b = appendStringField(b, 102, m.InIfName)
+	b = appendStringField(b, 103, m.OutIfName)
+	b = appendStringField(b, 104, m.InIfDescription)
+	b = appendStringField(b, 105, m.OutIfDescription)
+	b = appendVarintField(b, 106, uint64(m.InIfSpeed))
+	b = appendVarintField(b, 107, uint64(m.OutIfSpeed))
+	b = appendStringField(b, 108, m.InIfConnectivity)
+	b = appendStringField(b, 109, m.OutIfConnectivity)
+	b = appendStringField(b, 110, m.InIfProvider)
+	b = appendStringField(b, 111, m.OutIfProvider)
+	b = appendVarintField(b, 112, uint64(m.InIfBoundary))
+	b = appendVarintField(b, 113, uint64(m.OutIfBoundary))
+	if m.ScanSuspect {
+		b = appendVarintField(b, 114, 1)
+	}
+	b = appendVarintField(b, 115, uint64(m.InIfPeerAS))
+	b = appendVarintField(b, 116, uint64(m.OutIfPeerAS))
+	b = appendStringField(b, 117, m.ProtoName)
+	b = appendStringField(b, 118, m.InIfBillingGroup)
+	b = appendStringField(b, 119, m.OutIfBillingGroup)
+	b = appendStringField(b, 120, m.ExporterCountry)
+	// Custom fields
+	b = append(b, m.unknownFields...)
+	return b
+}
+
+// fixLengthPrefix writes the length of the data following the space
+// reserved at start and removes the unused part of this space.
+func fixLengthPrefix(b []byte, start int) []byte {
+	length := len(b) - start - maxLengthPrefix
+	prefix := protowire.AppendVarint(b[start:start], uint64(length))
+	n := copy(b[start+len(prefix):], b[start+maxLengthPrefix:])
+	return b[:start+len(prefix)+n]
+}
+
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendBytesField(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendStringField(b []byte, num protowire.Number, v string) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendPackedField(b []byte, num protowire.Number, v []uint32) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	length := 0
+	for _, x := range v {
+		length += protowire.SizeVarint(uint64(x))
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	b = protowire.AppendVarint(b, uint64(length))
+	for _, x := range v {
+		b = protowire.AppendVarint(b, uint64(x))
+	}
+	return b
+}
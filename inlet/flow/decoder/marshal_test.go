@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"akvorado/common/helpers"
+)
+
+// populateMessage sets all fields of a message to a non-default
+// value.
+func populateMessage(t *testing.T, msg protoreflect.Message, seed int) {
+	t.Helper()
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		value := uint64(seed)*1000 + uint64(field.Number())*1000003
+		switch {
+		case field.IsList() && field.Kind() == protoreflect.StringKind:
+			list := msg.Mutable(field).List()
+			for j := uint64(0); j < 3; j++ {
+				list.Append(protoreflect.ValueOfString(fmt.Sprint(value + j)))
+			}
+		case field.IsList():
+			list := msg.Mutable(field).List()
+			for j := uint64(0); j < 3; j++ {
+				list.Append(protoreflect.ValueOfUint32(uint32(value + j)))
+			}
+		case field.Kind() == protoreflect.MessageKind:
+			populateMessage(t, msg.Mutable(field).Message(), seed+int(field.Number()))
+		case field.Kind() == protoreflect.Uint64Kind:
+			msg.Set(field, protoreflect.ValueOfUint64(value<<20))
+		case field.Kind() == protoreflect.Uint32Kind:
+			msg.Set(field, protoreflect.ValueOfUint32(uint32(value)))
+		case field.Kind() == protoreflect.BoolKind:
+			msg.Set(field, protoreflect.ValueOfBool(true))
+		case field.Kind() == protoreflect.EnumKind:
+			msg.Set(field, protoreflect.ValueOfEnum(2))
+		case field.Kind() == protoreflect.BytesKind:
+			msg.Set(field, protoreflect.ValueOfBytes([]byte(fmt.Sprint(value))))
+		case field.Kind() == protoreflect.StringKind:
+			msg.Set(field, protoreflect.ValueOfString(strings.Repeat(field.TextName(), 3)))
+		default:
+			t.Fatalf("populateMessage(): unhandled field %s of kind %s", field.Name(), field.Kind())
+		}
+	}
+}
+
+func TestAppendDelimited(t *testing.T) {
+	full := &FlowMessage{}
+	populateMessage(t, full.ProtoReflect(), 1)
+	custom := &FlowMessage{SequenceNum: 10, OutIfBoundary: FlowMessage_INTERNAL}
+	custom.AppendCustomUint(1000, 100)
+	custom.AppendCustomString(1001, "hello")
+	cases := []struct {
+		Description string
+		Message     *FlowMessage
+	}{
+		{"empty", &FlowMessage{}},
+		{"small", &FlowMessage{SequenceNum: 10, ExporterName: "exporter1"}},
+		{"empty large communities", &FlowMessage{DstLargeCommunities: &FlowMessage_LargeCommunities{}}},
+		{"all fields", full},
+		{"custom fields", custom},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			buf := proto.NewBuffer([]byte{})
+			if err := buf.EncodeMessage(tc.Message); err != nil {
+				t.Fatalf("EncodeMessage() error:\n%+v", err)
+			}
+			expected := buf.Bytes()
+			if diff := helpers.Diff(tc.Message.AppendDelimited(nil), expected); diff != "" {
+				t.Errorf("AppendDelimited() (-got, +want):\n%s", diff)
+			}
+			// Append to an existing buffer
+			got := tc.Message.AppendDelimited([]byte("hello"))
+			if diff := helpers.Diff(got, append([]byte("hello"), expected...)); diff != "" {
+				t.Errorf("AppendDelimited() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func BenchmarkAppendDelimited(b *testing.B) {
+	fm := &FlowMessage{
+		TimeReceived:    1647285928,
+		SequenceNum:     1000,
+		SamplingRate:    30000,
+		ExporterAddress: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 255, 255, 192, 0, 2, 1},
+		ExporterName:    "exporter1",
+		Bytes:           1500,
+		Packets:         1,
+		SrcPort:         443,
+		DstPort:         33199,
+		Proto:           6,
+		InIfName:        "Gi0/0/0",
+		OutIfName:       "Gi0/0/1",
+	}
+	buf := []byte{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = fm.AppendDelimited(buf[:0])
+	}
+}
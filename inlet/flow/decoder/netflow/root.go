@@ -26,6 +26,9 @@ type Decoder struct {
 	samplingLock  sync.RWMutex
 	sampling      map[string]producer.SamplingRateSystem
 
+	// Elements to copy into custom fields
+	customElements map[uint16]decoder.CustomElement
+
 	metrics struct {
 		errors             *reporter.CounterVec
 		stats              *reporter.CounterVec
@@ -33,6 +36,7 @@ type Decoder struct {
 		setStatsSum        *reporter.CounterVec
 		timeStatsSum       *reporter.SummaryVec
 		templatesStats     *reporter.CounterVec
+		clockSkew          *reporter.GaugeVec
 	}
 }
 
@@ -87,6 +91,13 @@ func New(r *reporter.Reporter) decoder.Decoder {
 		},
 		[]string{"exporter", "version", "obs_domain_id", "template_id", "type"},
 	)
+	nd.metrics.clockSkew = nd.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "clock_skew_seconds",
+			Help: "Difference between the clock of the collector and the export time of the last packet.",
+		},
+		[]string{"exporter"},
+	)
 
 	return nd
 }
@@ -132,6 +143,7 @@ func (s *templateSystem) GetTemplate(version uint16, obsDomainID uint32, templat
 // Decode decodes a Netflow payload.
 func (nd *Decoder) Decode(in decoder.RawFlow) []*decoder.FlowMessage {
 	key := in.Source.String()
+	label := nd.r.ExporterLabel(key)
 	nd.templatesLock.RLock()
 	templates, ok := nd.templates[key]
 	nd.templatesLock.RUnlock()
@@ -139,7 +151,7 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*decoder.FlowMessage {
 		templates = &templateSystem{
 			nd:        nd,
 			templates: netflow.CreateTemplateSystem(),
-			key:       key,
+			key:       label,
 		}
 		nd.templatesLock.Lock()
 		nd.templates[key] = templates
@@ -162,16 +174,17 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*decoder.FlowMessage {
 	if err != nil {
 		switch err.(type) {
 		case *netflow.ErrorTemplateNotFound:
-			nd.metrics.errors.WithLabelValues(key, "template not found").Inc()
+			nd.metrics.errors.WithLabelValues(label, "template not found").Inc()
 		default:
-			nd.metrics.errors.WithLabelValues(key, "error decoding").Inc()
+			nd.metrics.errors.WithLabelValues(label, "error decoding").Inc()
 		}
 		return nil
 	}
 
 	var (
-		version  string
-		flowSets []interface{}
+		version    string
+		flowSets   []interface{}
+		exportTime uint64
 	)
 
 	// Update some stats
@@ -179,51 +192,73 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*decoder.FlowMessage {
 	case netflow.IPFIXPacket:
 		version = "10"
 		flowSets = msgDecConv.FlowSets
+		exportTime = uint64(msgDecConv.ExportTime)
 	case netflow.NFv9Packet:
 		version = "9"
 		flowSets = msgDecConv.FlowSets
+		exportTime = uint64(msgDecConv.UnixSeconds)
 	default:
-		nd.metrics.stats.WithLabelValues(key, "unknown").
+		nd.metrics.stats.WithLabelValues(label, "unknown").
 			Inc()
 		return nil
 	}
-	nd.metrics.stats.WithLabelValues(key, version).Inc()
+	nd.metrics.stats.WithLabelValues(label, version).Inc()
 	for _, fs := range flowSets {
 		switch fsConv := fs.(type) {
 		case netflow.TemplateFlowSet:
-			nd.metrics.setStatsSum.WithLabelValues(key, version, "TemplateFlowSet").
+			nd.metrics.setStatsSum.WithLabelValues(label, version, "TemplateFlowSet").
 				Inc()
-			nd.metrics.setRecordsStatsSum.WithLabelValues(key, version, "TemplateFlowSet").
+			nd.metrics.setRecordsStatsSum.WithLabelValues(label, version, "TemplateFlowSet").
 				Add(float64(len(fsConv.Records)))
 		case netflow.IPFIXOptionsTemplateFlowSet:
-			nd.metrics.setStatsSum.WithLabelValues(key, version, "OptionsTemplateFlowSet").
+			nd.metrics.setStatsSum.WithLabelValues(label, version, "OptionsTemplateFlowSet").
 				Inc()
-			nd.metrics.setRecordsStatsSum.WithLabelValues(key, version, "OptionsTemplateFlowSet").
+			nd.metrics.setRecordsStatsSum.WithLabelValues(label, version, "OptionsTemplateFlowSet").
 				Add(float64(len(fsConv.Records)))
 		case netflow.NFv9OptionsTemplateFlowSet:
-			nd.metrics.setStatsSum.WithLabelValues(key, version, "OptionsTemplateFlowSet").
+			nd.metrics.setStatsSum.WithLabelValues(label, version, "OptionsTemplateFlowSet").
 				Inc()
-			nd.metrics.setRecordsStatsSum.WithLabelValues(key, version, "OptionsTemplateFlowSet").
+			nd.metrics.setRecordsStatsSum.WithLabelValues(label, version, "OptionsTemplateFlowSet").
 				Add(float64(len(fsConv.Records)))
 		case netflow.OptionsDataFlowSet:
-			nd.metrics.setStatsSum.WithLabelValues(key, version, "OptionsDataFlowSet").
+			nd.metrics.setStatsSum.WithLabelValues(label, version, "OptionsDataFlowSet").
 				Inc()
-			nd.metrics.setRecordsStatsSum.WithLabelValues(key, version, "OptionsDataFlowSet").
+			nd.metrics.setRecordsStatsSum.WithLabelValues(label, version, "OptionsDataFlowSet").
 				Add(float64(len(fsConv.Records)))
 		case netflow.DataFlowSet:
-			nd.metrics.setStatsSum.WithLabelValues(key, version, "DataFlowSet").
+			nd.metrics.setStatsSum.WithLabelValues(label, version, "DataFlowSet").
 				Inc()
-			nd.metrics.setRecordsStatsSum.WithLabelValues(key, version, "DataFlowSet").
+			nd.metrics.setRecordsStatsSum.WithLabelValues(label, version, "DataFlowSet").
 				Add(float64(len(fsConv.Records)))
 		}
 	}
 
+	// Compare the clock of the exporter with ours
+	var skew int64
+	if !in.TimeReceived.IsZero() && exportTime != 0 {
+		skew = int64(ts) - int64(exportTime)
+		nd.metrics.clockSkew.WithLabelValues(label).Set(float64(skew))
+	}
+
 	flowMessageSet, _ := producer.ProcessMessageNetFlow(msgDec, sampling)
 	for _, fmsg := range flowMessageSet {
 		fmsg.TimeReceived = ts
 		fmsg.SamplerAddress = in.Source
+		switch in.TimestampSource {
+		case decoder.TimestampSourceExporter:
+			if exportTime != 0 {
+				fmsg.TimeReceived = exportTime
+			}
+		case decoder.TimestampSourceCollector:
+			if fmsg.TimeFlowStart != 0 {
+				fmsg.TimeFlowStart = uint64(int64(fmsg.TimeFlowStart) + skew)
+			}
+			if fmsg.TimeFlowEnd != 0 {
+				fmsg.TimeFlowEnd = uint64(int64(fmsg.TimeFlowEnd) + skew)
+			}
+		}
 		timeDiff := fmsg.TimeReceived - fmsg.TimeFlowEnd
-		nd.metrics.timeStatsSum.WithLabelValues(key, version).
+		nd.metrics.timeStatsSum.WithLabelValues(label, version).
 			Observe(float64(timeDiff))
 	}
 
@@ -231,10 +266,57 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*decoder.FlowMessage {
 	for idx, fmsg := range flowMessageSet {
 		results[idx] = decoder.ConvertGoflowToFlowMessage(fmsg)
 	}
+	if len(nd.customElements) > 0 {
+		nd.decodeCustomElements(flowSets, results)
+	}
 
 	return results
 }
 
+// SetCustomElements sets the elements to copy into custom fields. It
+// should be called before decoding any flow.
+func (nd *Decoder) SetCustomElements(elements map[uint16]decoder.CustomElement) {
+	nd.customElements = elements
+}
+
+// decodeCustomElements copies the elements of the data records into
+// the custom fields of the matching flow messages. The producer
+// returns one flow message for each data record, in order.
+func (nd *Decoder) decodeCustomElements(flowSets []interface{}, results []*decoder.FlowMessage) {
+	idx := 0
+	for _, fs := range flowSets {
+		dfs, ok := fs.(netflow.DataFlowSet)
+		if !ok {
+			continue
+		}
+		for _, record := range dfs.Records {
+			if idx >= len(results) {
+				return
+			}
+			for _, field := range record.Values {
+				element, ok := nd.customElements[field.Type]
+				if !ok || field.PenProvided {
+					continue
+				}
+				value, ok := field.Value.([]byte)
+				if !ok {
+					continue
+				}
+				if element.String {
+					results[idx].AppendCustomString(element.Number, string(bytes.TrimRight(value, "\x00")))
+				} else if len(value) <= 8 {
+					var v uint64
+					for _, b := range value {
+						v = v<<8 | uint64(b)
+					}
+					results[idx].AppendCustomUint(element.Number, v)
+				}
+			}
+			idx++
+		}
+	}
+}
+
 // Name returns the name of the decoder.
 func (nd *Decoder) Name() string {
 	return "netflow"
@@ -7,6 +7,7 @@ import (
 	"net"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"akvorado/common/helpers"
 	"akvorado/common/reporter"
@@ -213,3 +214,132 @@ func TestDecode(t *testing.T) {
 		t.Fatalf("Metrics after data (-got, +want):\n%s", diff)
 	}
 }
+
+func TestTemplates(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r).(*Decoder)
+
+	template := helpers.ReadPcapPayload(t, filepath.Join("testdata", "options-template-257.pcap"))
+	nfdecoder.Decode(decoder.RawFlow{Payload: template, Source: net.ParseIP("127.0.0.1")})
+
+	got := nfdecoder.Templates()
+	if len(got) != 1 {
+		t.Fatalf("Templates() got %d templates, expected 1", len(got))
+	}
+	got[0].Scopes = nil
+	got[0].Fields = nil
+	expected := Template{
+		Exporter:   "127.0.0.1",
+		Version:    9,
+		TemplateID: 257,
+		Type:       "options_template",
+	}
+	if diff := helpers.Diff(got[0], expected); diff != "" {
+		t.Fatalf("Templates() (-got, +want):\n%s", diff)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	r := reporter.NewMock(b)
+	nfdecoder := New(r)
+	source := net.ParseIP("127.0.0.1")
+	template := helpers.ReadPcapPayload(b, filepath.Join("testdata", "template-260.pcap"))
+	data := helpers.ReadPcapPayload(b, filepath.Join("testdata", "data-260.pcap"))
+	nfdecoder.Decode(decoder.RawFlow{Payload: template, Source: source})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: source})
+		for _, fmsg := range got {
+			decoder.ReleaseFlowMessage(fmsg)
+		}
+	}
+}
+
+func TestDecodeCustomElements(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r)
+	nfdecoder.(decoder.CustomElementsSetter).SetCustomElements(map[uint16]decoder.CustomElement{
+		10: {Number: 1000},               // INPUT_SNMP
+		14: {Number: 1001},               // OUTPUT_SNMP
+		61: {Number: 1002},               // DIRECTION (not in template)
+		7:  {Number: 1003, String: true}, // L4_SRC_PORT
+	})
+
+	for _, pcap := range []string{"options-template-257.pcap", "options-data-257.pcap", "template-260.pcap"} {
+		payload := helpers.ReadPcapPayload(t, filepath.Join("testdata", pcap))
+		nfdecoder.Decode(decoder.RawFlow{Payload: payload, Source: net.ParseIP("127.0.0.1")})
+	}
+	data := helpers.ReadPcapPayload(t, filepath.Join("testdata", "data-260.pcap"))
+	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
+	if len(got) == 0 {
+		t.Fatalf("Decode() did not return any flow")
+	}
+	for _, fl := range got {
+		if fl.CustomUint(1000) != uint64(fl.InIf) {
+			t.Errorf("CustomUint(1000) == %d, expected %d", fl.CustomUint(1000), fl.InIf)
+		}
+		if fl.CustomUint(1001) != uint64(fl.OutIf) {
+			t.Errorf("CustomUint(1001) == %d, expected %d", fl.CustomUint(1001), fl.OutIf)
+		}
+		if fl.CustomUint(1002) != 0 {
+			t.Errorf("CustomUint(1002) == %d, expected 0", fl.CustomUint(1002))
+		}
+	}
+	if diff := helpers.Diff(got[0].CustomString(1003), "\x01\xbb"); diff != "" {
+		t.Errorf("CustomString(1003) (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDecodeTimestampSource(t *testing.T) {
+	// The export time of the data packet is 1647285928 and the flows
+	// start and end at 1647285926. The collector is 72 seconds ahead.
+	received := time.Unix(1647286000, 0)
+	cases := []struct {
+		Source                decoder.TimestampSource
+		ExpectedTimeReceived  uint64
+		ExpectedTimeFlowStart uint64
+	}{
+		{decoder.TimestampSourceDefault, 1647286000, 1647285926},
+		{decoder.TimestampSourceCollector, 1647286000, 1647285998},
+		{decoder.TimestampSourceExporter, 1647285928, 1647285926},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Source.String(), func(t *testing.T) {
+			r := reporter.NewMock(t)
+			nfdecoder := New(r)
+			template := helpers.ReadPcapPayload(t, filepath.Join("testdata", "template-260.pcap"))
+			nfdecoder.Decode(decoder.RawFlow{Payload: template, Source: net.ParseIP("127.0.0.1")})
+			data := helpers.ReadPcapPayload(t, filepath.Join("testdata", "data-260.pcap"))
+			got := nfdecoder.Decode(decoder.RawFlow{
+				TimeReceived:    received,
+				Payload:         data,
+				Source:          net.ParseIP("127.0.0.1"),
+				TimestampSource: tc.Source,
+			})
+			if len(got) == 0 {
+				t.Fatal("Decode() returned no flow")
+			}
+			for _, fl := range got {
+				if fl.TimeReceived != tc.ExpectedTimeReceived {
+					t.Errorf("TimeReceived == %d, expected %d", fl.TimeReceived, tc.ExpectedTimeReceived)
+				}
+				if fl.TimeFlowStart != tc.ExpectedTimeFlowStart {
+					t.Errorf("TimeFlowStart == %d, expected %d", fl.TimeFlowStart, tc.ExpectedTimeFlowStart)
+				}
+				if fl.TimeFlowEnd != tc.ExpectedTimeFlowStart {
+					t.Errorf("TimeFlowEnd == %d, expected %d", fl.TimeFlowEnd, tc.ExpectedTimeFlowStart)
+				}
+			}
+
+			gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_netflow_", "clock_skew_")
+			expectedMetrics := map[string]string{
+				`clock_skew_seconds{exporter="127.0.0.1"}`: "72",
+			}
+			if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+				t.Fatalf("Metrics (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
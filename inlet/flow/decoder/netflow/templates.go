@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package netflow
+
+import (
+	"sort"
+
+	"github.com/netsampler/goflow2/decoders/netflow"
+)
+
+// Template describes a template received from an exporter.
+type Template struct {
+	Exporter            string          `json:"exporter"`
+	Version             uint16          `json:"version"`
+	ObservationDomainID uint32          `json:"observation-domain-id"`
+	TemplateID          uint16          `json:"template-id"`
+	Type                string          `json:"type"`
+	Scopes              []TemplateField `json:"scopes,omitempty"`
+	Fields              []TemplateField `json:"fields"`
+}
+
+// TemplateField describes a field of a template.
+type TemplateField struct {
+	Type   uint16 `json:"type"`
+	Name   string `json:"name"`
+	Length uint16 `json:"length"`
+	Pen    uint32 `json:"pen,omitempty"`
+}
+
+// Templates returns the templates currently known by the decoder,
+// sorted by exporter, version, observation domain and template ID.
+func (nd *Decoder) Templates() []Template {
+	results := []Template{}
+	nd.templatesLock.RLock()
+	defer nd.templatesLock.RUnlock()
+	for exporter, ts := range nd.templates {
+		for version, domains := range ts.templates.GetTemplates() {
+			for domain, templates := range domains {
+				for templateID, template := range templates {
+					t := Template{
+						Exporter:            exporter,
+						Version:             version,
+						ObservationDomainID: domain,
+						TemplateID:          templateID,
+					}
+					switch template := template.(type) {
+					case netflow.TemplateRecord:
+						t.Type = "template"
+						t.Fields = convertTemplateFields(version, template.Fields)
+					case netflow.NFv9OptionsTemplateRecord:
+						t.Type = "options_template"
+						t.Scopes = convertTemplateFields(version, template.Scopes)
+						t.Fields = convertTemplateFields(version, template.Options)
+					case netflow.IPFIXOptionsTemplateRecord:
+						t.Type = "options_template"
+						t.Scopes = convertTemplateFields(version, template.Scopes)
+						t.Fields = convertTemplateFields(version, template.Options)
+					}
+					results = append(results, t)
+				}
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Exporter != b.Exporter {
+			return a.Exporter < b.Exporter
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		if a.ObservationDomainID != b.ObservationDomainID {
+			return a.ObservationDomainID < b.ObservationDomainID
+		}
+		return a.TemplateID < b.TemplateID
+	})
+	return results
+}
+
+func convertTemplateFields(version uint16, fields []netflow.Field) []TemplateField {
+	results := make([]TemplateField, len(fields))
+	for idx, field := range fields {
+		name := netflow.NFv9TypeToString(field.Type)
+		if version == 10 {
+			name = netflow.IPFIXTypeToString(field.Type)
+		}
+		if field.PenProvided {
+			name = ""
+		}
+		results[idx] = TemplateField{
+			Type:   field.Type,
+			Name:   name,
+			Length: field.Length,
+			Pen:    field.Pen,
+		}
+	}
+	return results
+}
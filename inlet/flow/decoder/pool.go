@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import "sync"
+
+var flowMessagePool = sync.Pool{
+	New: func() interface{} {
+		return new(FlowMessage)
+	},
+}
+
+// NewFlowMessage returns an empty flow message, reusing a released
+// one when possible. The byte slices for IP addresses of a reused
+// message keep their capacity.
+func NewFlowMessage() *FlowMessage {
+	return flowMessagePool.Get().(*FlowMessage)
+}
+
+// ReleaseFlowMessage resets a flow message and gives it back to the
+// pool. The caller should own the flow message: it should not be
+// referenced anywhere else as it will be reused by NewFlowMessage().
+func ReleaseFlowMessage(fm *FlowMessage) {
+	// AS paths and communities are shared with the BMP RIB, do not
+	// keep them.
+	*fm = FlowMessage{
+		ExporterAddress: fm.ExporterAddress[:0],
+		SrcAddr:         fm.SrcAddr[:0],
+		DstAddr:         fm.DstAddr[:0],
+		NextHop:         fm.NextHop[:0],
+		unknownFields:   fm.unknownFields[:0],
+	}
+	flowMessagePool.Put(fm)
+}
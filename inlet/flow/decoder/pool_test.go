@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"net"
+	"testing"
+
+	"akvorado/common/helpers"
+
+	goflowmessage "github.com/netsampler/goflow2/pb"
+)
+
+func TestReleaseFlowMessage(t *testing.T) {
+	fm := ConvertGoflowToFlowMessage(&goflowmessage.FlowMessage{
+		SamplerAddress: net.ParseIP("192.0.2.1").To4(),
+		SrcAddr:        net.ParseIP("2001:db8::1"),
+		DstAddr:        net.ParseIP("2001:db8::2"),
+		BgpNextHop:     net.IPv4zero.To4(),
+		NextHop:        net.ParseIP("192.0.2.254").To4(),
+		Bytes:          1500,
+	})
+	if diff := helpers.Diff(net.IP(fm.ExporterAddress).String(), "192.0.2.1"); diff != "" {
+		t.Errorf("ConvertGoflowToFlowMessage() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(net.IP(fm.NextHop).String(), "192.0.2.254"); diff != "" {
+		t.Errorf("ConvertGoflowToFlowMessage() (-got, +want):\n%s", diff)
+	}
+	fm.DstASPath = []uint32{65000, 65001}
+	srcAddr := fm.SrcAddr
+
+	ReleaseFlowMessage(fm)
+	if fm.Bytes != 0 || fm.DstASPath != nil {
+		t.Errorf("ReleaseFlowMessage() did not reset the flow message")
+	}
+	if len(fm.SrcAddr) != 0 || cap(fm.SrcAddr) != cap(srcAddr) {
+		t.Errorf("ReleaseFlowMessage() did not keep the storage for SrcAddr")
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package protobuf decodes flows already decoded by another inlet
+// instance and encoded as length-delimited protocol buffers.
+package protobuf
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+)
+
+// Decoder contains the state for the protobuf decoder.
+type Decoder struct {
+	r *reporter.Reporter
+
+	metrics struct {
+		errors *reporter.CounterVec
+		stats  *reporter.CounterVec
+	}
+}
+
+// New instantiates a new protobuf decoder.
+func New(r *reporter.Reporter) decoder.Decoder {
+	pd := &Decoder{
+		r: r,
+	}
+
+	pd.metrics.errors = pd.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_count",
+			Help: "Protobuf messages processed errors.",
+		},
+		[]string{"exporter", "error"},
+	)
+	pd.metrics.stats = pd.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "count",
+			Help: "Protobuf flows processed.",
+		},
+		[]string{"exporter"},
+	)
+
+	return pd
+}
+
+// Decode decodes one or several length-delimited flow messages. The
+// exporter address and the time received are the ones of the
+// original flows.
+func (pd *Decoder) Decode(in decoder.RawFlow) []*decoder.FlowMessage {
+	exporter := pd.r.ExporterLabel(in.Source.String())
+	flowMessageSet := []*decoder.FlowMessage{}
+	payload := in.Payload
+	for len(payload) > 0 {
+		msg, n := protowire.ConsumeBytes(payload)
+		if n < 0 {
+			pd.metrics.errors.WithLabelValues(exporter, "length error").Inc()
+			return releaseAll(flowMessageSet)
+		}
+		payload = payload[n:]
+		fmsg := decoder.NewFlowMessage()
+		if err := proto.Unmarshal(msg, fmsg); err != nil {
+			decoder.ReleaseFlowMessage(fmsg)
+			pd.metrics.errors.WithLabelValues(exporter, "protobuf error").Inc()
+			return releaseAll(flowMessageSet)
+		}
+		fmsg.NormalizeAddresses()
+		if fmsg.TimeReceived == 0 {
+			fmsg.TimeReceived = uint64(in.TimeReceived.UTC().Unix())
+		}
+		flowMessageSet = append(flowMessageSet, fmsg)
+	}
+	pd.metrics.stats.WithLabelValues(exporter).Add(float64(len(flowMessageSet)))
+	return flowMessageSet
+}
+
+// releaseAll gives back the provided flow messages to the pool and
+// returns nil.
+func releaseAll(flowMessageSet []*decoder.FlowMessage) []*decoder.FlowMessage {
+	for _, fmsg := range flowMessageSet {
+		decoder.ReleaseFlowMessage(fmsg)
+	}
+	return nil
+}
+
+// Name returns the name of the decoder.
+func (pd *Decoder) Name() string {
+	return "protobuf"
+}
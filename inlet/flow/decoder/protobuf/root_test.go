@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package protobuf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestDecode(t *testing.T) {
+	r := reporter.NewMock(t)
+	pd := New(r)
+
+	flows := []*decoder.FlowMessage{
+		{
+			TimeReceived:    1665396000,
+			SequenceNum:     10,
+			SamplingRate:    1000,
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			SrcAddr:         net.ParseIP("2001:db8::1"),
+			DstAddr:         net.ParseIP("2001:db8::2"),
+			InIf:            10,
+			OutIf:           20,
+			Bytes:           1500,
+			Packets:         1,
+			Etype:           helpers.ETypeIPv6,
+			Proto:           6,
+			SrcPort:         443,
+			DstPort:         34974,
+		}, {
+			SequenceNum:     11,
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			InIf:            11,
+			Bytes:           100,
+			Packets:         1,
+		},
+	}
+	flows[1].AppendCustomUint(1000, 42)
+	payload := []byte{}
+	for _, fl := range flows {
+		payload = fl.AppendDelimited(payload)
+	}
+
+	received := time.Date(2022, time.October, 10, 10, 0, 10, 0, time.UTC)
+	got := pd.Decode(decoder.RawFlow{
+		TimeReceived: received,
+		Payload:      payload,
+		Source:       net.ParseIP("192.0.2.200"),
+	})
+	if len(got) != 2 {
+		t.Fatalf("Decode() returned %d flows, expected 2", len(got))
+	}
+	flows[1].TimeReceived = uint64(received.Unix())
+	if diff := helpers.Diff(got, flows); diff != "" {
+		t.Fatalf("Decode() (-got, +want):\n%s", diff)
+	}
+	if got := got[1].CustomUint(1000); got != 42 {
+		t.Errorf("CustomUint(1000) == %d, expected 42", got)
+	}
+
+	// Truncated payload
+	got = pd.Decode(decoder.RawFlow{
+		TimeReceived: received,
+		Payload:      payload[:len(payload)-3],
+		Source:       net.ParseIP("192.0.2.200"),
+	})
+	if got != nil {
+		t.Errorf("Decode() returned %d flows, expected none", len(got))
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_protobuf_")
+	expectedMetrics := map[string]string{
+		`count{exporter="192.0.2.200"}`:                             "2",
+		`errors_count{error="length error",exporter="192.0.2.200"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -28,6 +28,10 @@ type RawFlow struct {
 	TimeReceived time.Time
 	Payload      []byte
 	Source       net.IP
+
+	// TimestampSource tells which clock to use for the timestamps
+	// of the decoded flows
+	TimestampSource TimestampSource
 }
 
 // NewDecoderFunc is the signature of a function to instantiate a decoder.
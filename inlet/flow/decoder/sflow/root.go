@@ -80,7 +80,7 @@ func New(r *reporter.Reporter) decoder.Decoder {
 // Decode decodes an sFlow payload.
 func (nd *Decoder) Decode(in decoder.RawFlow) []*decoder.FlowMessage {
 	buf := bytes.NewBuffer(in.Payload)
-	key := in.Source.String()
+	key := nd.r.ExporterLabel(in.Source.String())
 
 	ts := uint64(in.TimeReceived.UTC().Unix())
 	msgDec, err := sflow.DecodeMessage(buf)
@@ -105,7 +105,7 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*decoder.FlowMessage {
 		nd.metrics.stats.WithLabelValues(key, "unknown", "unknwon").Inc()
 		return nil
 	}
-	agent := net.IP(msgDecConv.AgentIP).String()
+	agent := nd.r.ExporterLabel(net.IP(msgDecConv.AgentIP).String())
 	version := "5"
 	samples := msgDecConv.Samples
 	nd.metrics.stats.WithLabelValues(key, agent, version).Inc()
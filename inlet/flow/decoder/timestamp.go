@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"errors"
+
+	"akvorado/common/helpers"
+)
+
+// TimestampSource tells which clock should be trusted for the
+// timestamps of the flows of an exporter.
+type TimestampSource int
+
+const (
+	// TimestampSourceDefault stamps TimeReceived with the clock of the
+	// collector and keeps the flow start and end times as sent by the
+	// exporter.
+	TimestampSourceDefault TimestampSource = iota
+	// TimestampSourceCollector uses the clock of the collector for all
+	// timestamps. Flow start and end times are shifted by the skew
+	// between the exporter and the collector.
+	TimestampSourceCollector
+	// TimestampSourceExporter uses the clock of the exporter for all
+	// timestamps. TimeReceived is the export time from the header.
+	TimestampSourceExporter
+)
+
+var timestampSourceMap = helpers.NewBimap(map[TimestampSource]string{
+	TimestampSourceDefault:   "default",
+	TimestampSourceCollector: "collector",
+	TimestampSourceExporter:  "exporter",
+})
+
+// MarshalText turns a timestamp source to text.
+func (ts TimestampSource) MarshalText() ([]byte, error) {
+	got, ok := timestampSourceMap.LoadValue(ts)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown timestamp source")
+}
+
+// String turns a timestamp source to string.
+func (ts TimestampSource) String() string {
+	got, _ := timestampSourceMap.LoadValue(ts)
+	return got
+}
+
+// UnmarshalText provides a timestamp source from a string.
+func (ts *TimestampSource) UnmarshalText(input []byte) error {
+	got, ok := timestampSourceMap.LoadKey(string(input))
+	if ok {
+		*ts = got
+		return nil
+	}
+	return errors.New("unknown timestamp source")
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"net"
+	"testing"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+)
+
+type panicDecoder struct{}
+
+func (pd *panicDecoder) Decode(_ decoder.RawFlow) []*Message { panic("unexpected data") }
+func (pd *panicDecoder) Name() string                        { return "panic" }
+
+func TestDecodePanic(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   http.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	wd := c.wrapDecoder(&panicDecoder{})
+	if got := wd.Decode(decoder.RawFlow{Source: net.ParseIP("192.0.2.1")}); got != nil {
+		t.Fatalf("Decode() got %v, expected nil", got)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_", "error_count", "panic_count")
+	expectedMetrics := map[string]string{
+		`error_count{name="panic"}`: "1",
+		`panic_count{name="panic"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
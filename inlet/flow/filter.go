@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+
+	"akvorado/common/filter"
+	"akvorado/inlet/flow/decoder"
+)
+
+// Filter is an expression selecting flows. It uses the same syntax as
+// the filters in the console, for example `ExporterName = "edge1" AND
+// DstPort = 443`. An empty filter selects all flows.
+type Filter struct {
+	source  string
+	program *vm.Program
+}
+
+// NewFilter compiles a new filter.
+func NewFilter(expression string) (*Filter, error) {
+	var f Filter
+	if err := f.UnmarshalText([]byte(expression)); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// UnmarshalText compiles a filter.
+func (f *Filter) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		f.source = ""
+		f.program = nil
+		return nil
+	}
+	got, err := filter.Parse("", text,
+		filter.GlobalStore("meta", &filter.Meta{Language: filter.LanguageExpr}))
+	if err != nil {
+		return fmt.Errorf("cannot parse filter %q: %s", string(text), filter.HumanError(err))
+	}
+	program, err := expr.Compile(got.(string),
+		expr.Env(&filterEnv{}),
+		expr.AsBool())
+	if err != nil {
+		return fmt.Errorf("cannot compile filter %q: %w", string(text), err)
+	}
+	f.source = string(text)
+	f.program = program
+	return nil
+}
+
+// String turns a filter into a string.
+func (f Filter) String() string {
+	return f.source
+}
+
+// MarshalText turns a filter into a string.
+func (f Filter) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// Match tells if a flow is selected by the filter. A flow is not
+// selected if the filter cannot be evaluated.
+func (f *Filter) Match(fl *Message) bool {
+	if f == nil || f.program == nil {
+		return true
+	}
+	result, err := expr.Run(f.program, &filterEnv{Message: fl})
+	if err != nil {
+		return false
+	}
+	return result.(bool)
+}
+
+// filterEnv is the environment used to evaluate filters. It exposes
+// the fields of the flow and the functions used by the expressions
+// produced by the filter parser.
+type filterEnv struct {
+	*Message
+}
+
+// filterSubnets caches the subnets used by filters.
+var filterSubnets sync.Map
+
+// IPIn tells if the provided IP address is in the provided subnet.
+func (filterEnv) IPIn(ip []byte, subnet string) bool {
+	prefix, ok := filterSubnets.Load(subnet)
+	if !ok {
+		parsed, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			return false
+		}
+		prefix, _ = filterSubnets.LoadOrStore(subnet, parsed)
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	return prefix.(netip.Prefix).Contains(addr.Unmap())
+}
+
+// HasLargeCommunity tells if the provided large community is present.
+func (filterEnv) HasLargeCommunity(communities *decoder.FlowMessage_LargeCommunities, asn, data1, data2 int) bool {
+	if communities == nil {
+		return false
+	}
+	for idx := range communities.ASN {
+		if idx >= len(communities.LocalData1) || idx >= len(communities.LocalData2) {
+			break
+		}
+		if int(communities.ASN[idx]) == asn &&
+			int(communities.LocalData1[idx]) == data1 &&
+			int(communities.LocalData2[idx]) == data2 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"net"
+	"testing"
+
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestFilter(t *testing.T) {
+	cases := []struct {
+		Filter   string
+		Flow     *Message
+		Expected bool
+	}{
+		{"", &Message{}, true},
+		{`ExporterName = "edge1"`, &Message{ExporterName: "edge1"}, true},
+		{`ExporterName = "edge1"`, &Message{ExporterName: "edge2"}, false},
+		{`DstPort = 443 AND Proto = 6`, &Message{DstPort: 443, Proto: 6}, true},
+		{`DstPort = 443 AND Proto = 6`, &Message{DstPort: 443, Proto: 17}, false},
+		{`NOT DstPort = 443 AND Proto = 6`, &Message{DstPort: 80, Proto: 6}, true},
+		{`SrcAS IN (AS65000, AS65001)`, &Message{SrcAS: 65001}, true},
+		{`ExporterName LIKE "edge%"`, &Message{ExporterName: "core1"}, false},
+		{`ExporterName ILIKE "EDGE%"`, &Message{ExporterName: "edge1"}, true},
+		{`ExporterCountry = "FR"`, &Message{ExporterCountry: "FR"}, true},
+		{`ExporterCountry = "FR"`, &Message{SrcCountry: "FR"}, false},
+		{`InIfBoundary = external`, &Message{InIfBoundary: decoder.FlowMessage_EXTERNAL}, true},
+		{`InIfBoundary = external`, &Message{InIfBoundary: decoder.FlowMessage_INTERNAL}, false},
+		{`SrcAddr << 192.0.2.0/24`, &Message{SrcAddr: net.ParseIP("192.0.2.10")}, true},
+		{`SrcAddr << 192.0.2.0/24`, &Message{SrcAddr: net.ParseIP("198.51.100.10")}, false},
+		{`DstAddr = 2001:db8::1`, &Message{DstAddr: net.ParseIP("2001:db8::1")}, true},
+		{`DstAddr != 2001:db8::1`, &Message{DstAddr: net.ParseIP("2001:db8::1")}, false},
+		{`EType = IPv6`, &Message{Etype: 0x86dd}, true},
+		{`PacketSize > 1000`, &Message{Bytes: 15000, Packets: 10}, true},
+		{`DstASPath = 65001`, &Message{DstASPath: []uint32{65000, 65001}}, true},
+		{`DstCommunities = 65000:100`, &Message{DstCommunities: []uint32{65000<<16 + 100}}, true},
+		{
+			`DstCommunities = 65000:100:200`,
+			&Message{DstLargeCommunities: &decoder.FlowMessage_LargeCommunities{
+				ASN:        []uint32{65000, 65000},
+				LocalData1: []uint32{100, 100},
+				LocalData2: []uint32{100, 200},
+			}},
+			true,
+		},
+		{`DstCommunities = 65000:100:200`, &Message{}, false},
+		{`DstCommunityNames = "blackhole"`, &Message{DstCommunityNames: []string{"no-export", "blackhole"}}, true},
+		{`DstCommunityNames = "blackhole"`, &Message{}, false},
+		{`ScanSuspect = true`, &Message{ScanSuspect: true}, true},
+		{`ScanSuspect = true`, &Message{}, false},
+		{`InIfPeerAS = AS174`, &Message{InIfPeerAS: 174}, true},
+		{`InIfPeerAS = AS174`, &Message{OutIfPeerAS: 174}, false},
+		{`OutIfBillingGroup = "transit"`, &Message{OutIfBillingGroup: "transit"}, true},
+		{`OutIfBillingGroup = "transit"`, &Message{InIfBillingGroup: "transit"}, false},
+	}
+	for _, tc := range cases {
+		filter, err := NewFilter(tc.Filter)
+		if err != nil {
+			t.Fatalf("NewFilter(%q) error:\n%+v", tc.Filter, err)
+		}
+		if got := filter.Match(tc.Flow); got != tc.Expected {
+			t.Errorf("NewFilter(%q).Match() == %v but expected %v", tc.Filter, got, tc.Expected)
+		}
+		if got := filter.String(); got != tc.Filter {
+			t.Errorf("NewFilter(%q).String() == %q", tc.Filter, got)
+		}
+	}
+
+	var nilFilter *Filter
+	if !nilFilter.Match(&Message{}) {
+		t.Error("nil filter does not match")
+	}
+}
+
+func TestInvalidFilter(t *testing.T) {
+	for _, filter := range []string{
+		`ExporterName =`,
+		`UnknownField = 1`,
+		`DstPort`,
+		`SrcNetName = "alpha"`,
+	} {
+		if _, err := NewFilter(filter); err == nil {
+			t.Errorf("NewFilter(%q) did not error", filter)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"akvorado/common/kafka"
+	"akvorado/inlet/flow/input"
+)
+
+// Configuration describes Kafka input configuration.
+type Configuration struct {
+	// Brokers is the list of brokers to connect to.
+	Brokers []string `validate:"min=1,dive,required"`
+	// Version is the version of Kafka we assume to work with.
+	Version kafka.Version
+	// Topic is the topic to consume flows from. This is the full
+	// name of the topic, including the schema version suffix added by
+	// the Kafka component of the instances producing the flows.
+	Topic string `validate:"required"`
+	// ConsumerGroup is the name of the consumer group shared by the
+	// instances consuming the topic.
+	ConsumerGroup string `validate:"required"`
+	// Speed, when not 0, paces the flows relative to the time they
+	// were received. This is used to replay a topic. 1 replays flows
+	// in real time.
+	Speed float64 `validate:"min=0"`
+}
+
+// DefaultConfiguration descrives the default configuration for Kafka input.
+func DefaultConfiguration() input.Configuration {
+	kafkaConfiguration := kafka.DefaultConfiguration()
+	return &Configuration{
+		Brokers:       kafkaConfiguration.Brokers,
+		Version:       kafkaConfiguration.Version,
+		ConsumerGroup: "akvorado-inlet",
+	}
+}
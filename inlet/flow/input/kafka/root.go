@@ -0,0 +1,198 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package kafka handles flows consumed from a Kafka topic. This is
+// used to enrich flows received and decoded by other inlet instances.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/kafka"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/input"
+)
+
+// headerExporter is the header containing the address of the
+// exporter, when set by the producing instance.
+const headerExporter = "akvorado-exporter"
+
+// Input represents the state of a Kafka input.
+type Input struct {
+	r           *reporter.Reporter
+	t           tomb.Tomb
+	config      *Configuration
+	kafkaConfig *sarama.Config
+	pacer       *input.Pacer
+
+	metrics struct {
+		messages *reporter.CounterVec
+		errors   *reporter.CounterVec
+	}
+
+	ch      chan []*decoder.FlowMessage // channel to send flows to
+	decoder decoder.Decoder
+}
+
+// New instantiate a new Kafka consumer from the provided configuration.
+func (configuration *Configuration) New(r *reporter.Reporter, daemon daemon.Component, dec decoder.Decoder) (input.Input, error) {
+	if configuration.Topic == "" {
+		return nil, errors.New("no topic provided for Kafka input")
+	}
+	kafkaConfig := sarama.NewConfig()
+	kafkaConfig.Version = sarama.KafkaVersion(configuration.Version)
+	kafkaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	kafkaConfig.Consumer.Return.Errors = true
+	if err := kafkaConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("cannot validate Kafka configuration: %w", err)
+	}
+
+	input := &Input{
+		r:           r,
+		config:      configuration,
+		kafkaConfig: kafkaConfig,
+		pacer:       input.NewPacer(configuration.Speed),
+		ch:          make(chan []*decoder.FlowMessage),
+		decoder:     dec,
+	}
+	input.metrics.messages = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "messages_total",
+			Help: "Messages consumed from Kafka.",
+		},
+		[]string{"topic", "partition"},
+	)
+	input.metrics.errors = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Errors while consuming from Kafka.",
+		},
+		[]string{"error"},
+	)
+	daemon.Track(&input.t, "inlet/flow/input/kafka")
+	return input, nil
+}
+
+// Start starts consuming the topic and producing flows.
+func (in *Input) Start() (<-chan []*decoder.FlowMessage, error) {
+	in.r.Info().Str("topic", in.config.Topic).Msg("Kafka input starting")
+	kafka.GlobalKafkaLogger.Register(in.r)
+	group, err := sarama.NewConsumerGroup(in.config.Brokers, in.config.ConsumerGroup, in.kafkaConfig)
+	if err != nil {
+		kafka.GlobalKafkaLogger.Unregister()
+		in.r.Err(err).
+			Str("brokers", strings.Join(in.config.Brokers, ",")).
+			Msg("unable to create consumer group")
+		return nil, fmt.Errorf("unable to create consumer group: %w", err)
+	}
+	ctx := in.t.Context(context.Background())
+	in.t.Go(func() error {
+		defer kafka.GlobalKafkaLogger.Unregister()
+		defer group.Close()
+		errLogger := in.r.Sample(reporter.BurstSampler(time.Minute, 1))
+		handler := consumerHandler{in}
+		for {
+			if err := group.Consume(ctx, []string{in.config.Topic}, handler); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return nil
+				}
+				in.metrics.errors.WithLabelValues("consume error").Inc()
+				errLogger.Err(err).Msg("cannot consume from Kafka")
+			}
+			select {
+			case <-in.t.Dying():
+				return nil
+			case err := <-group.Errors():
+				if err != nil {
+					in.metrics.errors.WithLabelValues("consumer group error").Inc()
+					errLogger.Err(err).Msg("error while consuming from Kafka")
+				}
+			case <-time.After(time.Second):
+			}
+		}
+	})
+	return in.ch, nil
+}
+
+// Stop stops the Kafka consumer.
+func (in *Input) Stop() error {
+	defer func() {
+		close(in.ch)
+		in.r.Info().Msg("Kafka input stopped")
+	}()
+	in.t.Kill(nil)
+	return in.t.Wait()
+}
+
+// consumerHandler handles the consumer group sessions.
+type consumerHandler struct {
+	in *Input
+}
+
+// Setup is called at the beginning of a new session.
+func (h consumerHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is called at the end of a session.
+func (h consumerHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim decodes the messages of a claim. A message is marked
+// as consumed once its flows have been handed over, so flows are not
+// lost when an instance stops.
+func (h consumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	in := h.in
+	partition := fmt.Sprintf("%d", claim.Partition())
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			in.metrics.messages.WithLabelValues(msg.Topic, partition).Inc()
+			flows := in.decoder.Decode(decoder.RawFlow{
+				TimeReceived: msg.Timestamp,
+				Payload:      msg.Value,
+				Source:       messageSource(msg),
+			})
+			if len(flows) > 0 {
+				if !in.pacer.Wait(session.Context().Done(), flows[0].TimeReceived) {
+					return nil
+				}
+				select {
+				case <-session.Context().Done():
+					return nil
+				case in.ch <- flows:
+				}
+			}
+			session.MarkMessage(msg, "")
+		}
+	}
+}
+
+// messageSource returns the address of the exporter of a message,
+// using its headers.
+func messageSource(msg *sarama.ConsumerMessage) net.IP {
+	for _, header := range msg.Headers {
+		if header != nil && string(header.Key) == headerExporter {
+			if ip := net.ParseIP(string(header.Value)); ip != nil {
+				return ip
+			}
+		}
+	}
+	return net.IPv6zero
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+)
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (fs *fakeSession) Context() context.Context { return fs.ctx }
+func (fs *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	fs.marked = append(fs.marked, msg.Offset)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (fc fakeClaim) Partition() int32                         { return 2 }
+func (fc fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return fc.messages }
+
+func TestConsumeClaim(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Topic = "flows-raw-v3"
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	ki := in.(*Input)
+
+	now := time.Date(2022, time.October, 10, 10, 0, 0, 0, time.UTC)
+	claim := fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{
+		Topic:     "flows-raw-v3",
+		Offset:    10,
+		Timestamp: now,
+		Value:     []byte("hello world!"),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("akvorado-exporter"), Value: []byte("192.0.2.142")},
+		},
+	}
+	claim.messages <- &sarama.ConsumerMessage{
+		Topic:     "flows-raw-v3",
+		Offset:    11,
+		Timestamp: now,
+		Value:     []byte("bye bye"),
+	}
+	close(claim.messages)
+	session := &fakeSession{ctx: context.Background()}
+
+	done := make(chan error)
+	go func() {
+		done <- consumerHandler{ki}.ConsumeClaim(session, claim)
+	}()
+	got := []*decoder.FlowMessage{}
+	for i := 0; i < 2; i++ {
+		select {
+		case flows := <-ki.ch:
+			got = append(got, flows...)
+		case <-time.After(time.Second):
+			t.Fatal("no flows received")
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("ConsumeClaim() error:\n%+v", err)
+	}
+
+	expected := []*decoder.FlowMessage{
+		{
+			TimeReceived:    uint64(now.Unix()),
+			ExporterAddress: net.ParseIP("192.0.2.142"),
+			Bytes:           12,
+			Packets:         1,
+			InIfDescription: "hello world!",
+		}, {
+			TimeReceived:    uint64(now.Unix()),
+			ExporterAddress: net.IPv6zero,
+			Bytes:           7,
+			Packets:         1,
+			InIfDescription: "bye bye",
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Input data (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(session.marked, []int64{10, 11}); diff != "" {
+		t.Fatalf("MarkMessage() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_input_kafka_")
+	expectedMetrics := map[string]string{
+		`messages_total{partition="2",topic="flows-raw-v3"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
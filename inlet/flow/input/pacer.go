@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package input
+
+import (
+	"sync"
+	"time"
+)
+
+// Pacer delays flows to send them at a pace relative to the time they
+// were initially received. It is used to replay flows.
+type Pacer struct {
+	speed float64
+	now   func() time.Time
+
+	lock  sync.Mutex
+	first uint64    // reception time of the first flow
+	start time.Time // when the first flow was sent
+}
+
+// NewPacer creates a new pacer. A speed of 1 replays flows in real
+// time, a speed of 2 replays them twice as fast. A speed of 0 does
+// not delay flows.
+func NewPacer(speed float64) *Pacer {
+	return &Pacer{
+		speed: speed,
+		now:   time.Now,
+	}
+}
+
+// Delay returns how long to wait before sending a flow received at
+// the provided time (in seconds since epoch).
+func (p *Pacer) Delay(timeReceived uint64) time.Duration {
+	if p == nil || p.speed == 0 || timeReceived == 0 {
+		return 0
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := p.now()
+	if p.start.IsZero() || timeReceived < p.first {
+		p.first = timeReceived
+		p.start = now
+		return 0
+	}
+	elapsed := time.Duration(float64(time.Duration(timeReceived-p.first)*time.Second) / p.speed)
+	if delay := p.start.Add(elapsed).Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Wait waits until a flow received at the provided time should be
+// sent. It returns false if dying is closed while waiting.
+func (p *Pacer) Wait(dying <-chan struct{}, timeReceived uint64) bool {
+	delay := p.Delay(timeReceived)
+	if delay == 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-dying:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
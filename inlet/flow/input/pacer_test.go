@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package input
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacer(t *testing.T) {
+	now := time.Date(2022, time.October, 10, 10, 0, 0, 0, time.UTC)
+	p := NewPacer(2)
+	p.now = func() time.Time { return now }
+
+	cases := []struct {
+		Elapsed      time.Duration
+		TimeReceived uint64
+		Expected     time.Duration
+	}{
+		{0, 1665396000, 0},
+		{0, 1665396000, 0},
+		{0, 1665396010, 5 * time.Second},
+		{3 * time.Second, 1665396010, 2 * time.Second},
+		{10 * time.Second, 1665396010, 0},
+		{10 * time.Second, 1665396030, 5 * time.Second},
+		// Flows without timestamp are not delayed
+		{10 * time.Second, 0, 0},
+	}
+	start := now
+	for _, tc := range cases {
+		now = start.Add(tc.Elapsed)
+		if got := p.Delay(tc.TimeReceived); got != tc.Expected {
+			t.Errorf("Delay(%d) after %s == %s, expected %s",
+				tc.TimeReceived, tc.Elapsed, got, tc.Expected)
+		}
+	}
+
+	// No pacing
+	p = NewPacer(0)
+	p.Delay(1665396000)
+	if got := p.Delay(1665396100); got != 0 {
+		t.Errorf("Delay() == %s, expected 0", got)
+	}
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package replay
+
+import "akvorado/inlet/flow/input"
+
+// Configuration describes replay input configuration.
+type Configuration struct {
+	// Paths are the files written by the file output to replay, in
+	// order. Files ending with ".gz" are decompressed. Files ending
+	// with ".pb" (before ".gz") are read as length-delimited
+	// protocol buffers and handed to the decoder, other files are
+	// read as JSON lines.
+	Paths []string `validate:"min=1,dive,required"`
+	// Speed is the speed at which flows are replayed, relative to
+	// the time they were received. 0 means as fast as possible.
+	Speed float64 `validate:"min=0"`
+}
+
+// DefaultConfiguration descrives the default configuration for replay input.
+func DefaultConfiguration() input.Configuration {
+	return &Configuration{
+		Speed: 1,
+	}
+}
@@ -0,0 +1,21 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package replay
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestDefaultConfiguration(t *testing.T) {
+	config := DefaultConfiguration().(*Configuration)
+	if err := helpers.Validate.Struct(config); err == nil {
+		t.Fatal("validate.Struct() did not error without paths")
+	}
+	config.Paths = []string{"/path/1", "/path/2"}
+	if err := helpers.Validate.Struct(config); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
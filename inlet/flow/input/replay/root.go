@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package replay reads flows previously written by the file output
+// and sends them again to the pipeline, at a configurable pace. This
+// is used to test new enrichment rules against historical traffic.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/input"
+)
+
+// batchSize is the maximum number of flows sent at once.
+const batchSize = 100
+
+// Input represents the state of a replay input.
+type Input struct {
+	r      *reporter.Reporter
+	t      tomb.Tomb
+	config *Configuration
+	pacer  *input.Pacer
+
+	metrics struct {
+		flows  *reporter.CounterVec
+		errors *reporter.CounterVec
+	}
+
+	ch      chan []*decoder.FlowMessage // channel to send flows to
+	decoder decoder.Decoder
+}
+
+// New instantiate a new replay input from the provided configuration.
+func (configuration *Configuration) New(r *reporter.Reporter, daemon daemon.Component, dec decoder.Decoder) (input.Input, error) {
+	if len(configuration.Paths) == 0 {
+		return nil, errors.New("no paths provided for replay input")
+	}
+	input := &Input{
+		r:       r,
+		config:  configuration,
+		pacer:   input.NewPacer(configuration.Speed),
+		ch:      make(chan []*decoder.FlowMessage),
+		decoder: dec,
+	}
+	input.metrics.flows = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_total",
+			Help: "Flows replayed.",
+		},
+		[]string{"path"},
+	)
+	input.metrics.errors = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Errors while replaying flows.",
+		},
+		[]string{"path", "error"},
+	)
+	daemon.Track(&input.t, "inlet/flow/input/replay")
+	return input, nil
+}
+
+// Start starts reading the files and producing flows. Once all the
+// files have been replayed, the input stops, terminating the inlet.
+func (in *Input) Start() (<-chan []*decoder.FlowMessage, error) {
+	in.r.Info().Float64("speed", in.config.Speed).Msg("replay input starting")
+	in.t.Go(func() error {
+		for _, path := range in.config.Paths {
+			if err := in.replayFile(path); err != nil {
+				if errors.Is(err, tomb.ErrDying) {
+					return nil
+				}
+				in.r.Err(err).Str("path", path).Msg("unable to replay file")
+				return err
+			}
+		}
+		in.r.Info().Msg("all flows replayed")
+		return nil
+	})
+	return in.ch, nil
+}
+
+// replayFile replays the flows contained in the provided file.
+func (in *Input) replayFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open file: %w", err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	name := path
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("unable to decompress file: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	br := bufio.NewReader(r)
+	next := in.nextJSON
+	switch {
+	case strings.HasSuffix(name, ".pb"):
+		next = in.nextProtobuf
+	case strings.HasSuffix(name, ".parquet"):
+		return errors.New("Parquet files cannot be replayed")
+	}
+
+	in.r.Info().Str("path", path).Msg("replaying file")
+	batch := []*decoder.FlowMessage{}
+	send := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		in.metrics.flows.WithLabelValues(path).Add(float64(len(batch)))
+		select {
+		case <-in.t.Dying():
+			return tomb.ErrDying
+		case in.ch <- batch:
+		}
+		batch = []*decoder.FlowMessage{}
+		return nil
+	}
+	for {
+		flows, err := next(br)
+		if err == io.EOF {
+			return send()
+		} else if err != nil {
+			in.metrics.errors.WithLabelValues(path, "decoding error").Inc()
+			for _, fl := range batch {
+				decoder.ReleaseFlowMessage(fl)
+			}
+			return err
+		}
+		for _, fl := range flows {
+			if in.pacer.Delay(fl.TimeReceived) > 0 {
+				if err := send(); err != nil {
+					return err
+				}
+				if !in.pacer.Wait(in.t.Dying(), fl.TimeReceived) {
+					return tomb.ErrDying
+				}
+			}
+			batch = append(batch, fl)
+			if len(batch) >= batchSize {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// nextJSON decodes the next flow from a file containing JSON lines.
+func (in *Input) nextJSON(br *bufio.Reader) ([]*decoder.FlowMessage, error) {
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		fl := decoder.NewFlowMessage()
+		if err := json.Unmarshal(line, fl); err != nil {
+			decoder.ReleaseFlowMessage(fl)
+			return nil, fmt.Errorf("unable to decode JSON flow: %w", err)
+		}
+		fl.NormalizeAddresses()
+		return []*decoder.FlowMessage{fl}, nil
+	}
+}
+
+// nextProtobuf reads the next length-delimited protocol buffer and
+// hands it to the decoder.
+func (in *Input) nextProtobuf(br *bufio.Reader) ([]*decoder.FlowMessage, error) {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(br, msg); err != nil {
+		return nil, fmt.Errorf("truncated protobuf flow: %w", err)
+	}
+	flows := in.decoder.Decode(decoder.RawFlow{
+		TimeReceived: time.Now(),
+		Payload:      protowire.AppendBytes(nil, msg),
+		Source:       net.IPv6zero,
+	})
+	if len(flows) == 0 {
+		return nil, errors.New("unable to decode protobuf flow")
+	}
+	return flows, nil
+}
+
+// Stop stops the replay input.
+func (in *Input) Stop() error {
+	defer func() {
+		close(in.ch)
+		in.r.Info().Msg("replay input stopped")
+	}()
+	in.t.Kill(nil)
+	return in.t.Wait()
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package replay
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/decoder/protobuf"
+)
+
+func testFlows() []*decoder.FlowMessage {
+	return []*decoder.FlowMessage{
+		{
+			TimeReceived:    1665396000,
+			ExporterAddress: net.ParseIP("::ffff:192.0.2.1"),
+			SrcAddr:         net.ParseIP("::ffff:203.0.113.1"),
+			DstAddr:         net.ParseIP("2001:db8::1"),
+			InIf:            10,
+			InIfName:        "Gi0/0/10",
+			InIfBoundary:    decoder.FlowMessage_EXTERNAL,
+			Bytes:           1500,
+		}, {
+			TimeReceived:    1665396001,
+			ExporterAddress: net.ParseIP("::ffff:192.0.2.1"),
+			SrcAddr:         net.ParseIP("2001:db8::2"),
+			DstAddr:         net.ParseIP("::ffff:198.51.100.1"),
+			OutIf:           20,
+			OutIfBoundary:   decoder.FlowMessage_INTERNAL,
+			Bytes:           200,
+		},
+	}
+}
+
+func writeJSON(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create() error:\n%+v", err)
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	for _, fl := range testFlows() {
+		if err := encoder.Encode(fl); err != nil {
+			t.Fatalf("Encode() error:\n%+v", err)
+		}
+	}
+}
+
+func writeProtobuf(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create() error:\n%+v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	for _, fl := range testFlows() {
+		buf := proto.NewBuffer([]byte{})
+		if err := buf.EncodeMessage(fl); err != nil {
+			t.Fatalf("EncodeMessage() error:\n%+v", err)
+		}
+		if _, err := gz.Write(buf.Bytes()); err != nil {
+			t.Fatalf("Write() error:\n%+v", err)
+		}
+	}
+}
+
+func TestReplayInput(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "flows.json")
+	pbPath := filepath.Join(dir, "flows.pb.gz")
+	writeJSON(t, jsonPath)
+	writeProtobuf(t, pbPath)
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Paths = []string{jsonPath, pbPath}
+	configuration.Speed = 10
+	in, err := configuration.New(r, daemon.NewMock(t), protobuf.New(r))
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	ch, err := in.Start()
+	if err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer func() {
+		if err := in.Stop(); err != nil {
+			t.Fatalf("Stop() error:\n%+v", err)
+		}
+	}()
+
+	got := []*decoder.FlowMessage{}
+	start := time.Now()
+out:
+	for len(got) < 4 {
+		select {
+		case flows := <-ch:
+			got = append(got, flows...)
+		case <-time.After(time.Second):
+			break out
+		}
+	}
+	// The second flow of each file is one second after the first
+	// one, replayed at 10x: 100 ms. The pace is reset with the second
+	// file as it goes back in time.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("flows replayed in %s, expected at least 100ms", elapsed)
+	}
+	expected := append(testFlows(), testFlows()...)
+	for _, fl := range expected {
+		fl.NormalizeAddresses()
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Replayed flows (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_input_replay_", "flows_total")
+	expectedMetrics := map[string]string{
+		`flows_total{path="` + jsonPath + `"}`: "2",
+		`flows_total{path="` + pbPath + `"}`:   "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestReplayInputMissingFile(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Paths = []string{filepath.Join(t.TempDir(), "missing.json")}
+	in, err := configuration.New(r, daemon.NewMock(t), protobuf.New(r))
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if _, err := in.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	if err := in.Stop(); err == nil {
+		t.Fatal("Stop() did not error")
+	}
+}
@@ -3,7 +3,11 @@
 
 package udp
 
-import "akvorado/inlet/flow/input"
+import (
+	"net/netip"
+
+	"akvorado/inlet/flow/input"
+)
 
 // Configuration describes UDP input configuration.
 type Configuration struct {
@@ -21,6 +25,14 @@ type Configuration struct {
 	// The value cannot exceed the kernel max value
 	// (net.core.wmem_max).
 	ReceiveBuffer uint
+	// ProxyProtocol tells if datagrams sent by trusted relays are
+	// prefixed by a PROXY protocol v2 header carrying the address
+	// of the original exporter.
+	ProxyProtocol bool
+	// TrustedRelays is the list of subnets of the relays allowed to
+	// send a PROXY protocol header. It is mandatory when the PROXY
+	// protocol is enabled.
+	TrustedRelays []netip.Prefix `validate:"required_if=ProxyProtocol true"`
 }
 
 // DefaultConfiguration is the default configuration for this input
@@ -4,6 +4,7 @@
 package udp
 
 import (
+	"net/netip"
 	"testing"
 
 	"akvorado/common/helpers"
@@ -14,3 +15,15 @@ func TestDefaultConfiguration(t *testing.T) {
 		t.Fatalf("validate.Struct() error:\n%+v", err)
 	}
 }
+
+func TestProxyProtocolRequiresTrustedRelays(t *testing.T) {
+	config := DefaultConfiguration().(*Configuration)
+	config.ProxyProtocol = true
+	if err := helpers.Validate.Struct(config); err == nil {
+		t.Fatal("validate.Struct() did not error without trusted relays")
+	}
+	config.TrustedRelays = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/29")}
+	if err := helpers.Validate.Struct(config); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
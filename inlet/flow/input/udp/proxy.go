@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package udp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+)
+
+// proxySignature is the signature starting a PROXY protocol v2 header.
+var proxySignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var (
+	errProxyMissing  = errors.New("missing PROXY protocol header")
+	errProxyVersion  = errors.New("unsupported PROXY protocol version")
+	errProxyTooShort = errors.New("truncated PROXY protocol header")
+	errProxyFamily   = errors.New("unsupported PROXY protocol address family")
+	errProxyCommand  = errors.New("unsupported PROXY protocol command")
+	errProxyProtocol = errors.New("unsupported PROXY protocol transport protocol")
+)
+
+// parseProxyHeader parses the PROXY protocol v2 header at the start
+// of the provided payload. It returns the original source address and
+// the remaining payload. For LOCAL commands and unspecified address
+// families, the returned source is nil and the sender should be used.
+func parseProxyHeader(payload []byte) (net.IP, []byte, error) {
+	if len(payload) < 16 || !bytes.Equal(payload[:12], proxySignature) {
+		return nil, nil, errProxyMissing
+	}
+	if payload[12]>>4 != 2 {
+		return nil, nil, errProxyVersion
+	}
+	length := int(binary.BigEndian.Uint16(payload[14:16]))
+	if len(payload) < 16+length {
+		return nil, nil, errProxyTooShort
+	}
+	header, rest := payload[16:16+length], payload[16+length:]
+	switch payload[12] & 0xf {
+	case 0:
+		// LOCAL command: addresses should be ignored
+		return nil, rest, nil
+	case 1:
+		// PROXY command
+	default:
+		return nil, nil, errProxyCommand
+	}
+	family := payload[13] >> 4
+	if family == 0 {
+		return nil, rest, nil
+	}
+	if payload[13]&0xf != 2 {
+		// Only datagrams are expected
+		return nil, nil, errProxyProtocol
+	}
+	switch family {
+	case 1:
+		if len(header) < 12 {
+			return nil, nil, errProxyTooShort
+		}
+		return net.IP(header[:4]).To16(), rest, nil
+	case 2:
+		if len(header) < 36 {
+			return nil, nil, errProxyTooShort
+		}
+		return append(net.IP{}, header[:16]...), rest, nil
+	default:
+		return nil, nil, errProxyFamily
+	}
+}
+
+// isTrustedRelay tells if the provided source is allowed to send a
+// PROXY protocol header.
+func (in *Input) isTrustedRelay(source net.IP) bool {
+	addr, ok := netip.AddrFromSlice(source)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range in.config.TrustedRelays {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
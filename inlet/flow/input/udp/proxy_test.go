@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package udp
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+// proxyHeader builds a PROXY protocol v2 header.
+func proxyHeader(command byte, family byte, addresses []byte) []byte {
+	header := append([]byte{}, proxySignature...)
+	header = append(header, 0x20|command, family<<4|2)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)))
+	return append(header, addresses...)
+}
+
+func TestParseProxyHeader(t *testing.T) {
+	cases := []struct {
+		Description string
+		Payload     []byte
+		Source      net.IP
+		Rest        []byte
+		Error       error
+	}{
+		{
+			Description: "IPv4",
+			Payload: append(proxyHeader(1, 1, []byte{
+				192, 0, 2, 10, 203, 0, 113, 1, 0x1f, 0x90, 0x08, 0x35,
+			}), []byte("hello")...),
+			Source: net.ParseIP("192.0.2.10"),
+			Rest:   []byte("hello"),
+		}, {
+			Description: "IPv6",
+			Payload: append(proxyHeader(1, 2, append(append(
+				net.ParseIP("2001:db8::10"), net.ParseIP("2001:db8::1")...),
+				0x1f, 0x90, 0x08, 0x35)), []byte("hello")...),
+			Source: net.ParseIP("2001:db8::10"),
+			Rest:   []byte("hello"),
+		}, {
+			Description: "IPv4 with TLV",
+			Payload: append(proxyHeader(1, 1, []byte{
+				192, 0, 2, 10, 203, 0, 113, 1, 0x1f, 0x90, 0x08, 0x35, 0x04, 0x00, 0x00,
+			}), []byte("hello")...),
+			Source: net.ParseIP("192.0.2.10"),
+			Rest:   []byte("hello"),
+		}, {
+			Description: "LOCAL command",
+			Payload:     append(proxyHeader(0, 0, nil), []byte("hello")...),
+			Rest:        []byte("hello"),
+		}, {
+			Description: "no header",
+			Payload:     []byte("hello world, this is a flow"),
+			Error:       errProxyMissing,
+		}, {
+			Description: "version 1",
+			Payload:     append(append([]byte{}, proxySignature...), 0x11, 0x12, 0, 0),
+			Error:       errProxyVersion,
+		}, {
+			Description: "truncated",
+			Payload:     proxyHeader(1, 1, []byte{192, 0, 2, 10})[:18],
+			Error:       errProxyTooShort,
+		}, {
+			Description: "IPv4 addresses too short",
+			Payload:     proxyHeader(1, 1, []byte{192, 0, 2, 10}),
+			Error:       errProxyTooShort,
+		}, {
+			Description: "UNIX family",
+			Payload:     proxyHeader(1, 3, make([]byte, 216)),
+			Error:       errProxyFamily,
+		}, {
+			Description: "unknown command",
+			Payload: proxyHeader(2, 1, []byte{
+				192, 0, 2, 10, 203, 0, 113, 1, 0x1f, 0x90, 0x08, 0x35,
+			}),
+			Error: errProxyCommand,
+		}, {
+			Description: "TCP transport",
+			Payload: func() []byte {
+				header := proxyHeader(1, 1, []byte{
+					192, 0, 2, 10, 203, 0, 113, 1, 0x1f, 0x90, 0x08, 0x35,
+				})
+				header[13] = 0x11
+				return header
+			}(),
+			Error: errProxyProtocol,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			source, rest, err := parseProxyHeader(tc.Payload)
+			if err != tc.Error {
+				t.Fatalf("parseProxyHeader() error:\n%+v", err)
+			}
+			if diff := helpers.Diff(source, tc.Source); diff != "" {
+				t.Errorf("parseProxyHeader() source (-got, +want):\n%s", diff)
+			}
+			if diff := helpers.Diff(rest, tc.Rest); diff != "" {
+				t.Errorf("parseProxyHeader() rest (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsTrustedRelay(t *testing.T) {
+	in := &Input{config: &Configuration{}}
+	if in.isTrustedRelay(net.ParseIP("198.51.100.1")) {
+		t.Error("isTrustedRelay() == true with no trusted relays")
+	}
+	in.config.TrustedRelays = []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("2001:db8::/64"),
+	}
+	cases := map[string]bool{
+		"192.0.2.10":    true,
+		"198.51.100.1":  false,
+		"2001:db8::1":   true,
+		"2001:db8:1::1": false,
+	}
+	for ip, expected := range cases {
+		if got := in.isTrustedRelay(net.ParseIP(ip)); got != expected {
+			t.Errorf("isTrustedRelay(%s) == %v, expected %v", ip, got, expected)
+		}
+	}
+}
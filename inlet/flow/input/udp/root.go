@@ -173,7 +173,21 @@ func (in *Input) Start() (<-chan []*decoder.FlowMessage, error) {
 					oobMsg.Received = time.Now()
 				}
 
-				srcIP := source.IP.String()
+				data, exporter := payload[:n], source.IP
+				if in.config.ProxyProtocol && in.isTrustedRelay(source.IP) {
+					original, rest, err := parseProxyHeader(data)
+					if err != nil {
+						errLogger.Err(err).Str("relay", source.IP.String()).Msg("unable to parse PROXY protocol header")
+						in.metrics.errors.WithLabelValues(listen, worker).Inc()
+						continue
+					}
+					if original != nil {
+						exporter = original
+					}
+					data = rest
+				}
+
+				srcIP := in.r.ExporterLabel(exporter.String())
 				in.metrics.bytes.WithLabelValues(listen, worker, srcIP).
 					Add(float64(n))
 				in.metrics.packets.WithLabelValues(listen, worker, srcIP).
@@ -182,8 +196,8 @@ func (in *Input) Start() (<-chan []*decoder.FlowMessage, error) {
 					Observe(float64(n))
 				flows := in.decoder.Decode(decoder.RawFlow{
 					TimeReceived: oobMsg.Received,
-					Payload:      payload[:n],
-					Source:       source.IP,
+					Payload:      data,
+					Source:       exporter,
 				})
 				if len(flows) == 0 {
 					continue
@@ -5,6 +5,7 @@ package udp
 
 import (
 	"net"
+	"net/netip"
 	"testing"
 	"time"
 
@@ -138,3 +139,72 @@ func TestOverflow(t *testing.T) {
 		t.Fatalf("Input metrics (-got, +want):\n%s", diff)
 	}
 }
+
+func TestUDPInputProxyProtocol(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Listen = "127.0.0.1:0"
+	configuration.ProxyProtocol = true
+	configuration.TrustedRelays = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	ch, err := in.Start()
+	if err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer func() {
+		if err := in.Stop(); err != nil {
+			t.Fatalf("Stop() error:\n%+v", err)
+		}
+	}()
+
+	conn, err := net.Dial("udp", in.(*Input).address.String())
+	if err != nil {
+		t.Fatalf("Dial() error:\n%+v", err)
+	}
+
+	// Without header, the datagram is rejected
+	if _, err := conn.Write([]byte("hello world!")); err != nil {
+		t.Fatalf("Write() error:\n%+v", err)
+	}
+	// With header, the original exporter is used
+	payload := append(proxyHeader(1, 1, []byte{
+		192, 0, 2, 10, 127, 0, 0, 1, 0x1f, 0x90, 0x08, 0x35,
+	}), []byte("hello world!")...)
+	if _, err := conn.Write(payload); err != nil {
+		t.Fatalf("Write() error:\n%+v", err)
+	}
+
+	var got []*decoder.FlowMessage
+	select {
+	case got = <-ch:
+		if len(got) == 0 {
+			t.Fatalf("empty decoded flows received")
+		}
+	case <-time.After(20 * time.Millisecond):
+		t.Fatal("no decoded flows received")
+	}
+	expected := []*decoder.FlowMessage{
+		{
+			TimeReceived:    got[0].TimeReceived,
+			ExporterAddress: net.ParseIP("192.0.2.10"),
+			Bytes:           12,
+			Packets:         1,
+			InIfDescription: "hello world!",
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Input data (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_input_udp_", "errors", "packets")
+	expectedMetrics := map[string]string{
+		`errors{listener="127.0.0.1:0",worker="0"}`:                        "1",
+		`packets{exporter="192.0.2.10",listener="127.0.0.1:0",worker="0"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Input metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"bytes"
+	_ "embed" // for protocols.csv
+	"encoding/csv"
+	"strconv"
+)
+
+var (
+	// ProtocolsCSV is the IANA table of protocol numbers as a CSV
+	// file, with the number, the name and the description of each
+	// protocol.
+	//go:embed data/protocols.csv
+	ProtocolsCSV []byte
+	// ProtocolNames maps IANA protocol numbers to their names
+	ProtocolNames map[uint32]string
+)
+
+func init() {
+	records, err := csv.NewReader(bytes.NewReader(ProtocolsCSV)).ReadAll()
+	if err != nil {
+		panic(err)
+	}
+	ProtocolNames = make(map[uint32]string, len(records))
+	for _, record := range records[1:] {
+		proto, err := strconv.ParseUint(record[0], 10, 8)
+		if err != nil {
+			panic(err)
+		}
+		ProtocolNames[uint32(proto)] = record[1]
+	}
+}
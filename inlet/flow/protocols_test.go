@@ -0,0 +1,19 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import "testing"
+
+func TestProtocolNames(t *testing.T) {
+	for proto, expected := range map[uint32]string{
+		1:  "ICMP",
+		6:  "TCP",
+		17: "UDP",
+		58: "IPv6-ICMP",
+	} {
+		if got := ProtocolNames[proto]; got != expected {
+			t.Errorf("ProtocolNames[%d] == %q, expected %q", proto, got, expected)
+		}
+	}
+}
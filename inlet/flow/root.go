@@ -5,11 +5,15 @@
 package flow
 
 import (
+	"context"
 	_ "embed" // for flow.proto
 	"errors"
 	"fmt"
 	"net/netip"
+	"sync/atomic"
+	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
@@ -25,11 +29,14 @@ type Component struct {
 	d      *Dependencies
 	t      tomb.Tomb
 	config Configuration
+	tracer trace.Tracer
 
 	metrics struct {
 		decoderStats  *reporter.CounterVec
 		decoderErrors *reporter.CounterVec
+		decoderPanics *reporter.CounterVec
 		decoderTime   *reporter.SummaryVec
+		pausedFlows   reporter.Counter
 	}
 
 	// Channel for sending flows out of the package.
@@ -40,6 +47,13 @@ type Component struct {
 
 	// Inputs
 	inputs []input.Input
+	paused []atomic.Bool
+
+	// Last time a flow was received (as an Unix timestamp)
+	lastReceived atomic.Int64
+
+	// Span contexts of sampled flows
+	traced tracedFlows
 }
 
 // Dependencies are the dependencies of the flow component.
@@ -53,14 +67,20 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 	if len(configuration.Inputs) == 0 {
 		return nil, errors.New("no input configured")
 	}
+	if err := ValidateCustomFields(configuration.CustomFields); err != nil {
+		return nil, err
+	}
+	configuration.CustomFields = SortCustomFields(configuration.CustomFields)
 
 	c := Component{
 		r:             r,
 		d:             &dependencies,
 		config:        configuration,
+		tracer:        r.Tracer(),
 		outgoingFlows: make(chan *Message),
 		limiters:      make(map[netip.Addr]*limiter),
 		inputs:        make([]input.Input, len(configuration.Inputs)),
+		paused:        make([]atomic.Bool, len(configuration.Inputs)),
 	}
 
 	// Initialize decoders (at most once each)
@@ -77,8 +97,11 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 			return nil, fmt.Errorf("unknown decoder %q", input.Decoder)
 		}
 		dec = decoderfunc(r)
-		alreadyInitialized[input.Decoder] = dec
+		if setter, ok := dec.(decoder.CustomElementsSetter); ok && len(c.config.CustomFields) > 0 {
+			setter.SetCustomElements(customElements(c.config.CustomFields))
+		}
 		decs[idx] = c.wrapDecoder(dec)
+		alreadyInitialized[input.Decoder] = decs[idx]
 	}
 
 	// Initialize inputs
@@ -105,6 +128,13 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		},
 		[]string{"name"},
 	)
+	c.metrics.decoderPanics = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "decoder_panic_count",
+			Help: "Decoder panic count.",
+		},
+		[]string{"name"},
+	)
 	c.metrics.decoderTime = c.r.SummaryVec(
 		reporter.SummaryOpts{
 			Name:       "summary_decoding_time_seconds",
@@ -113,6 +143,12 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		},
 		[]string{"name"},
 	)
+	c.metrics.pausedFlows = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "paused_flows",
+			Help: "Number of flows dropped because their input was paused.",
+		},
+	)
 
 	c.d.Daemon.Track(&c.t, "inlet/flow")
 	c.initHTTP()
@@ -124,26 +160,37 @@ func (c *Component) Flows() <-chan *Message {
 	return c.outgoingFlows
 }
 
+// CustomFields returns the custom fields appended to the flow
+// messages, ordered by their protobuf field numbers.
+func (c *Component) CustomFields() []CustomField {
+	return c.config.CustomFields
+}
+
 // Start starts the flow component.
 func (c *Component) Start() error {
-	for _, input := range c.inputs {
+	for idx, input := range c.inputs {
 		ch, err := input.Start()
 		stopper := input.Stop
+		paused := &c.paused[idx]
 		if err != nil {
 			return err
 		}
 		c.t.Go(func() error {
-			defer stopper()
 			for {
 				select {
 				case <-c.t.Dying():
-					return nil
+					return c.drain(stopper, ch, nil)
 				case fmsgs := <-ch:
+					c.lastReceived.Store(time.Now().Unix())
+					if paused.Load() {
+						c.metrics.pausedFlows.Add(float64(len(fmsgs)))
+						continue
+					}
 					if c.allowMessages(fmsgs) {
-						for _, fmsg := range fmsgs {
+						for idx, fmsg := range fmsgs {
 							select {
 							case <-c.t.Dying():
-								return nil
+								return c.drain(stopper, ch, fmsgs[idx:])
 							case c.outgoingFlows <- fmsg:
 							}
 						}
@@ -152,9 +199,81 @@ func (c *Component) Start() error {
 			}
 		})
 	}
+	c.r.RegisterHealthcheck("flow", c.healthcheck)
+	return nil
+}
+
+// Pause pauses the input with the provided index, in the order of the
+// configuration. Flows received by this input are dropped until it is
+// resumed.
+func (c *Component) Pause(input int) error {
+	return c.setPaused(input, true)
+}
+
+// Resume resumes the input with the provided index.
+func (c *Component) Resume(input int) error {
+	return c.setPaused(input, false)
+}
+
+func (c *Component) setPaused(input int, paused bool) error {
+	if input < 0 || input >= len(c.paused) {
+		return fmt.Errorf("no input %d", input)
+	}
+	if c.paused[input].Swap(paused) != paused {
+		c.r.Info().Int("input", input).Bool("paused", paused).Msg("input state changed")
+	}
 	return nil
 }
 
+// healthcheck reports a warning when no flow was received recently.
+func (c *Component) healthcheck(_ context.Context) reporter.HealthcheckResult {
+	last := c.lastReceived.Load()
+	if last == 0 {
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckWarning,
+			Reason: "no flow received yet",
+		}
+	}
+	if since := time.Since(time.Unix(last, 0)); since > time.Minute {
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckWarning,
+			Reason: fmt.Sprintf("no flow received for %s", since.Truncate(time.Second)),
+		}
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "ok"}
+}
+
+// drain stops the provided input and forwards the pending flows, as
+// well as the ones still queued by the input, until there are none
+// left or the drain timeout is reached.
+func (c *Component) drain(stop func() error, ch <-chan []*Message, pending []*Message) error {
+	stop()
+	if c.config.DrainTimeout == 0 {
+		return nil
+	}
+	timer := time.NewTimer(c.config.DrainTimeout)
+	defer timer.Stop()
+	for {
+		for idx, fmsg := range pending {
+			select {
+			case <-timer.C:
+				c.r.Warn().Msgf("drain timeout reached, dropping at least %d flows",
+					len(pending)-idx)
+				return nil
+			case c.outgoingFlows <- fmsg:
+			}
+		}
+		fmsgs, ok := <-ch
+		if !ok {
+			return nil
+		}
+		pending = nil
+		if c.allowMessages(fmsgs) {
+			pending = fmsgs
+		}
+	}
+}
+
 // Stop stops the flow component
 func (c *Component) Stop() error {
 	defer func() {
@@ -4,6 +4,7 @@
 package flow
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
@@ -11,8 +12,12 @@ import (
 	"testing"
 	"time"
 
+	"akvorado/common/daemon"
 	"akvorado/common/helpers"
+	"akvorado/common/http"
 	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/input"
 	"akvorado/inlet/flow/input/file"
 )
 
@@ -54,6 +59,7 @@ func TestFlow(t *testing.T) {
 			r := reporter.NewMock(t)
 			config := DefaultConfiguration()
 			config.Inputs = inputs
+			config.DrainTimeout = 0
 			c := NewMock(t, r, config)
 
 			// Receive flows
@@ -76,6 +82,7 @@ func TestFlow(t *testing.T) {
 			config := DefaultConfiguration()
 			config.RateLimit = 1000
 			config.Inputs = inputs
+			config.DrainTimeout = 0
 			c := NewMock(t, r, config)
 
 			// Receive flows
@@ -123,3 +130,191 @@ func TestFlow(t *testing.T) {
 		}
 	}
 }
+
+// queuedInputConfiguration is the configuration for an input with
+// flows already queued when it starts.
+type queuedInputConfiguration struct {
+	Flows int
+}
+
+type queuedInput struct {
+	ch chan []*Message
+}
+
+func (configuration *queuedInputConfiguration) New(_ *reporter.Reporter, _ daemon.Component, _ decoder.Decoder) (input.Input, error) {
+	in := &queuedInput{ch: make(chan []*Message, configuration.Flows)}
+	for i := 0; i < configuration.Flows; i++ {
+		in.ch <- []*Message{{SequenceNum: uint32(i)}}
+	}
+	return in, nil
+}
+
+func (in *queuedInput) Start() (<-chan []*decoder.FlowMessage, error) {
+	return in.ch, nil
+}
+
+func (in *queuedInput) Stop() error {
+	close(in.ch)
+	return nil
+}
+
+func TestFlowHealthcheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = []InputConfiguration{{
+		Decoder: "netflow",
+		Config:  &queuedInputConfiguration{Flows: 0},
+	}}
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   http.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer c.Stop()
+	got := r.RunHealthchecks(context.Background())
+	if diff := helpers.Diff(got.Details["flow"], reporter.HealthcheckResult{
+		Status: reporter.HealthcheckWarning,
+		Reason: "no flow received yet",
+	}); diff != "" {
+		t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+	}
+
+	c.inputs[0].(*queuedInput).ch <- []*Message{{}}
+	<-c.Flows()
+	got = r.RunHealthchecks(context.Background())
+	if diff := helpers.Diff(got.Details["flow"], reporter.HealthcheckResult{
+		Status: reporter.HealthcheckOK,
+		Reason: "ok",
+	}); diff != "" {
+		t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+	}
+
+	c.lastReceived.Store(time.Now().Add(-2 * time.Minute).Unix())
+	got = r.RunHealthchecks(context.Background())
+	if diff := helpers.Diff(got.Details["flow"], reporter.HealthcheckResult{
+		Status: reporter.HealthcheckWarning,
+		Reason: "no flow received for 2m0s",
+	}); diff != "" {
+		t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestFlowDrain(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = []InputConfiguration{{
+		Decoder: "netflow",
+		Config:  &queuedInputConfiguration{Flows: 100},
+	}}
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   http.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+
+	// All the queued flows should be received after stopping.
+	errCh := make(chan error)
+	go func() {
+		errCh <- c.Stop()
+	}()
+	count := 0
+	for range c.Flows() {
+		count++
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+	if count != 100 {
+		t.Fatalf("Flows() got %d flows, expected 100", count)
+	}
+}
+
+func TestFlowDrainTimeout(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.DrainTimeout = 20 * time.Millisecond
+	config.Inputs = []InputConfiguration{{
+		Decoder: "netflow",
+		Config:  &queuedInputConfiguration{Flows: 100},
+	}}
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   http.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+
+	// Nobody reads the flows, the drain should be interrupted.
+	start := time.Now()
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Stop() took %s, expected less than a second", elapsed)
+	}
+}
+
+func TestFlowPause(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = []InputConfiguration{{
+		Decoder: "netflow",
+		Config:  &queuedInputConfiguration{Flows: 0},
+	}}
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   http.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer c.Stop()
+
+	if err := c.Pause(1); err == nil {
+		t.Fatal("Pause(1) did not error")
+	}
+	if err := c.Pause(0); err != nil {
+		t.Fatalf("Pause(0) error:\n%+v", err)
+	}
+	dropped, forwarded := &Message{}, &Message{}
+	c.inputs[0].(*queuedInput).ch <- []*Message{dropped}
+	for i := 0; i < 100; i++ {
+		// Wait for the flow to be dropped before resuming
+		if r.GetMetrics("akvorado_inlet_flow_", "paused_flows")["paused_flows"] == "1" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Resume(0); err != nil {
+		t.Fatalf("Resume(0) error:\n%+v", err)
+	}
+	c.inputs[0].(*queuedInput).ch <- []*Message{forwarded}
+	if got := <-c.Flows(); got != forwarded {
+		t.Fatal("Flows() returned a flow received while paused")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_", "paused_flows")
+	expectedMetrics := map[string]string{
+		`paused_flows`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
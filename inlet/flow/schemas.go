@@ -8,10 +8,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 // CurrentSchemaVersion is the version of the protobuf definition
@@ -50,8 +55,62 @@ func init() {
 	}
 }
 
+// schemaField describes a field of the current protobuf definition.
+type schemaField struct {
+	Name     string `json:"name"`
+	Number   int    `json:"number"`
+	Type     string `json:"type"`
+	Repeated bool   `json:"repeated,omitempty"`
+}
+
+// currentSchemaFields returns the list of fields of the current
+// protobuf definition, in the order of their field numbers. Custom
+// fields come last.
+func currentSchemaFields(customFields []CustomField) []schemaField {
+	fields := (&Message{}).ProtoReflect().Descriptor().Fields()
+	result := make([]schemaField, 0, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		result = append(result, schemaField{
+			Name:     string(field.Name()),
+			Number:   int(field.Number()),
+			Type:     field.Kind().String(),
+			Repeated: field.Cardinality() == protoreflect.Repeated,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Number < result[j].Number
+	})
+	for _, field := range customFields {
+		result = append(result, schemaField{
+			Name:   field.Name,
+			Number: int(field.Number),
+			Type:   field.Type.ProtobufType(),
+		})
+	}
+	return result
+}
+
+// currentSchemaDescriptor returns the compiled protobuf descriptor of
+// the current definition, as a serialized FileDescriptorSet (like
+// protoc --descriptor_set_out). Custom fields are appended to the
+// flow message.
+func currentSchemaDescriptor(customFields []CustomField) ([]byte, error) {
+	message := (&Message{}).ProtoReflect().Descriptor()
+	file := protodesc.ToFileDescriptorProto(message.ParentFile())
+	for _, messageType := range file.MessageType {
+		if messageType.GetName() == string(message.Name()) {
+			messageType.Field = append(messageType.Field, customFieldDescriptors(customFields)...)
+		}
+	}
+	return proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{file},
+	})
+}
+
 func (c *Component) initHTTP() {
-	for version, schema := range VersionedSchemas {
+	schemas := SchemasWithCustomFields(c.config.CustomFields)
+	for version, schema := range schemas {
 		c.d.HTTP.AddHandler(fmt.Sprintf("/api/v0/inlet/flow/schema-%d.proto", version),
 			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.Header().Set("Content-Type", "text/plain")
@@ -67,9 +126,29 @@ func (c *Component) initHTTP() {
 				CurrentVersion: CurrentSchemaVersion,
 				Versions:       map[int]string{},
 			}
-			for version := range VersionedSchemas {
+			for version := range schemas {
 				answer.Versions[version] = fmt.Sprintf("/api/v0/inlet/flow/schema-%d.proto", version)
 			}
 			gc.IndentedJSON(http.StatusOK, answer)
 		})
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/flow/schema.json",
+		func(gc *gin.Context) {
+			gc.IndentedJSON(http.StatusOK, gin.H{
+				"version":    CurrentSchemaVersion,
+				"message":    string((&Message{}).ProtoReflect().Descriptor().FullName()),
+				"proto":      fmt.Sprintf("/api/v0/inlet/flow/schema-%d.proto", CurrentSchemaVersion),
+				"descriptor": "/api/v0/inlet/flow/schema.pb",
+				"framing":    "length-delimited",
+				"fields":     currentSchemaFields(c.config.CustomFields),
+			})
+		})
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/flow/schema.pb",
+		func(gc *gin.Context) {
+			descriptor, err := currentSchemaDescriptor(c.config.CustomFields)
+			if err != nil {
+				gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to serialize schema."})
+				return
+			}
+			gc.Data(http.StatusOK, "application/x-protobuf", descriptor)
+		})
 }
@@ -5,6 +5,8 @@ package flow
 
 import (
 	"fmt"
+	"io/ioutil"
+	netHTTP "net/http"
 	"strconv"
 	"testing"
 
@@ -12,6 +14,10 @@ import (
 	"akvorado/common/reporter"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 func TestHTTPEndpoints(t *testing.T) {
@@ -41,3 +47,57 @@ func TestHTTPEndpoints(t *testing.T) {
 
 	helpers.TestHTTPEndpoints(t, c.d.HTTP.LocalAddr(), cases)
 }
+
+func TestSchemaFields(t *testing.T) {
+	fields := currentSchemaFields(nil)
+	if len(fields) < 2 {
+		t.Fatalf("currentSchemaFields() returned %d fields", len(fields))
+	}
+	expected := []schemaField{
+		{Name: "TimeReceived", Number: 2, Type: "uint64"},
+		{Name: "SequenceNum", Number: 3, Type: "uint32"},
+	}
+	if diff := helpers.Diff(fields[:2], expected); diff != "" {
+		t.Fatalf("currentSchemaFields() (-got, +want):\n%s", diff)
+	}
+	for _, field := range fields {
+		if field.Name == "DstASPath" && !field.Repeated {
+			t.Fatal("currentSchemaFields(): DstASPath is not repeated")
+		}
+	}
+}
+
+func TestSchemaDescriptor(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	resp, err := netHTTP.Get(fmt.Sprintf("http://%s/api/v0/inlet/flow/schema.pb", c.d.HTTP.LocalAddr()))
+	if err != nil {
+		t.Fatalf("GET /api/v0/inlet/flow/schema.pb:\n%+v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET /api/v0/inlet/flow/schema.pb: got status code %d, not 200", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET /api/v0/inlet/flow/schema.pb:\n%+v", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(body, &set); err != nil {
+		t.Fatalf("proto.Unmarshal() error:\n%+v", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		t.Fatalf("protodesc.NewFiles() error:\n%+v", err)
+	}
+	expected := (&Message{}).ProtoReflect().Descriptor()
+	got, err := files.FindDescriptorByName(expected.FullName())
+	if err != nil {
+		t.Fatalf("FindDescriptorByName(%q) error:\n%+v", expected.FullName(), err)
+	}
+	if diff := helpers.Diff(got.(protoreflect.MessageDescriptor).Fields().Len(),
+		expected.Fields().Len()); diff != "" {
+		t.Fatalf("Number of fields (-got, +want):\n%s", diff)
+	}
+}
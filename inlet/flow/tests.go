@@ -8,6 +8,8 @@ package flow
 import (
 	"testing"
 
+	"go.opentelemetry.io/otel/trace"
+
 	"akvorado/common/daemon"
 	"akvorado/common/helpers"
 	"akvorado/common/http"
@@ -45,3 +47,10 @@ func NewMock(t *testing.T, r *reporter.Reporter, config Configuration) *Componen
 func (c *Component) Inject(t *testing.T, fmsg *Message) {
 	c.outgoingFlows <- fmsg
 }
+
+// InjectTraced injects the provided flow message, as if it was received
+// and sampled as part of the provided span.
+func (c *Component) InjectTraced(t *testing.T, fmsg *Message, spanContext trace.SpanContext) {
+	c.traced.add(spanContext, []*Message{fmsg})
+	c.outgoingFlows <- fmsg
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// maxTracedFlows is the maximum number of flows waiting for
+	// their trace context to be retrieved.
+	maxTracedFlows = 1000
+	// tracedFlowExpiration is the duration after which a traced flow
+	// which was never retrieved (for example, because it was dropped
+	// by the rate limiter) is forgotten.
+	tracedFlowExpiration = time.Minute
+)
+
+// tracedFlows keeps the span context of sampled flows until they are
+// processed by another component. The flow message is generated from
+// the protobuf definition and cannot carry it.
+type tracedFlows struct {
+	lock    sync.Mutex
+	entries map[*Message]tracedFlow
+}
+
+type tracedFlow struct {
+	spanContext trace.SpanContext
+	added       time.Time
+}
+
+// add records the span context for the provided flows. When there are
+// too many flows waiting, they are not recorded.
+func (tf *tracedFlows) add(spanContext trace.SpanContext, fmsgs []*Message) {
+	now := time.Now()
+	tf.lock.Lock()
+	defer tf.lock.Unlock()
+	if tf.entries == nil {
+		tf.entries = make(map[*Message]tracedFlow)
+	}
+	if len(tf.entries)+len(fmsgs) > maxTracedFlows {
+		for fmsg, entry := range tf.entries {
+			if now.Sub(entry.added) > tracedFlowExpiration {
+				delete(tf.entries, fmsg)
+			}
+		}
+		if len(tf.entries)+len(fmsgs) > maxTracedFlows {
+			return
+		}
+	}
+	for _, fmsg := range fmsgs {
+		tf.entries[fmsg] = tracedFlow{
+			spanContext: spanContext,
+			added:       now,
+		}
+	}
+}
+
+// get retrieves and forgets the span context for the provided flow.
+func (tf *tracedFlows) get(fmsg *Message) (trace.SpanContext, bool) {
+	tf.lock.Lock()
+	defer tf.lock.Unlock()
+	entry, ok := tf.entries[fmsg]
+	if ok {
+		delete(tf.entries, fmsg)
+	}
+	return entry.spanContext, ok
+}
+
+// TraceContext returns a context to be used to trace the processing of
+// the provided flow. If the flow is not sampled, the context does not
+// contain any span. This function should be called only once per flow.
+func (c *Component) TraceContext(fmsg *Message) context.Context {
+	ctx := context.Background()
+	if spanContext, ok := c.traced.get(fmsg); ok {
+		ctx = trace.ContextWithSpanContext(ctx, spanContext)
+	}
+	return ctx
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow/decoder"
+)
+
+type fakeDecoder struct {
+	flows []*Message
+}
+
+func (fd *fakeDecoder) Decode(_ decoder.RawFlow) []*Message { return fd.flows }
+func (fd *fakeDecoder) Name() string                        { return "fake" }
+
+func TestDecodeTracing(t *testing.T) {
+	r, recorder := reporter.NewMockWithTracing(t)
+	config := DefaultConfiguration()
+	config.Inputs = []InputConfiguration{{
+		Decoder: "netflow",
+		Config:  &queuedInputConfiguration{Flows: 0},
+	}}
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   http.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	flows := []*Message{{}, {}}
+	fd := &fakeDecoder{flows: flows}
+	wd := c.wrapDecoder(fd)
+	wd.Decode(decoder.RawFlow{Source: net.ParseIP("192.0.2.1")})
+	fd.flows = nil
+	wd.Decode(decoder.RawFlow{Source: net.ParseIP("192.0.2.1")})
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Ended() got %d spans, expected 2", len(spans))
+	}
+	if diff := helpers.Diff(spans[0].Attributes(), []attribute.KeyValue{
+		attribute.String("decoder", "fake"),
+		attribute.String("exporter", "192.0.2.1"),
+		attribute.Int("flows", 2),
+	}); diff != "" {
+		t.Errorf("Attributes() (-got, +want):\n%s", diff)
+	}
+	if spans[0].Status().Code != codes.Unset {
+		t.Errorf("Status() == %v, expected unset", spans[0].Status())
+	}
+	if spans[1].Status().Code != codes.Error {
+		t.Errorf("Status() == %v, expected error", spans[1].Status())
+	}
+
+	// Each flow is attached to the decoding span, only once.
+	for _, fmsg := range flows {
+		got := trace.SpanContextFromContext(c.TraceContext(fmsg))
+		if !got.Equal(spans[0].SpanContext()) {
+			t.Errorf("TraceContext() == %v, expected %v", got, spans[0].SpanContext())
+		}
+		got = trace.SpanContextFromContext(c.TraceContext(fmsg))
+		if got.IsValid() {
+			t.Errorf("TraceContext() == %v, expected nothing", got)
+		}
+	}
+}
+
+func TestTracedFlowsLimit(t *testing.T) {
+	var tf tracedFlows
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	flows := make([]*Message, maxTracedFlows)
+	for idx := range flows {
+		flows[idx] = &Message{}
+	}
+	tf.add(spanContext, flows)
+	extra := &Message{}
+	tf.add(spanContext, []*Message{extra})
+	if _, ok := tf.get(extra); ok {
+		t.Error("get() found a flow added over the limit")
+	}
+
+	// Expire old entries
+	for fmsg, entry := range tf.entries {
+		entry.added = entry.added.Add(-2 * tracedFlowExpiration)
+		tf.entries[fmsg] = entry
+	}
+	tf.add(spanContext, []*Message{extra})
+	if _, ok := tf.get(extra); !ok {
+		t.Error("get() did not find a flow after expiration")
+	}
+	if len(tf.entries) != 0 {
+		t.Errorf("len(entries) == %d, expected 0", len(tf.entries))
+	}
+}
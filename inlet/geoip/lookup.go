@@ -17,6 +17,15 @@ type country struct {
 	} `maxminddb:"country"`
 }
 
+type location struct {
+	country
+	City struct {
+		Names struct {
+			English string `maxminddb:"en"`
+		} `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
 // LookupASN returns the result of a lookup for an AS number.
 func (c *Component) LookupASN(ip net.IP) uint32 {
 	asnDB := c.db.asn.Load()
@@ -46,3 +55,19 @@ func (c *Component) LookupCountry(ip net.IP) string {
 	}
 	return ""
 }
+
+// LookupLocation returns the result of a lookup for country and
+// city. The city is only available with a city database.
+func (c *Component) LookupLocation(ip net.IP) (string, string) {
+	geoDB := c.db.geo.Load()
+	if geoDB != nil {
+		var location location
+		err := geoDB.Lookup(ip, &location)
+		if err == nil && (location.Country.IsoCode != "" || location.City.Names.English != "") {
+			c.metrics.databaseHit.WithLabelValues("geo").Inc()
+			return location.Country.IsoCode, location.City.Names.English
+		}
+		c.metrics.databaseMiss.WithLabelValues("geo").Inc()
+	}
+	return "", ""
+}
@@ -58,3 +58,33 @@ func TestLookup(t *testing.T) {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
 	}
 }
+
+func TestLookupLocation(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r)
+
+	cases := []struct {
+		IP              string
+		ExpectedCountry string
+		ExpectedCity    string
+	}{
+		{IP: "1.0.0.0"},
+		{IP: "2.125.160.216", ExpectedCountry: "GB"},
+		{IP: "2a02:ff00::1:1", ExpectedCountry: "IT"},
+	}
+	for _, tc := range cases {
+		gotCountry, gotCity := c.LookupLocation(net.ParseIP(tc.IP))
+		if diff := helpers.Diff([]string{gotCountry, gotCity},
+			[]string{tc.ExpectedCountry, tc.ExpectedCity}); diff != "" {
+			t.Errorf("LookupLocation(%q) (-got, +want):\n%s", tc.IP, diff)
+		}
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_geoip_", "db_hits", "db_misses")
+	expectedMetrics := map[string]string{
+		`db_hits_total{database="geo"}`:   "2",
+		`db_misses_total{database="geo"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -5,9 +5,13 @@
 package geoip
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"path/filepath"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,6 +20,7 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/reporter"
 )
 
@@ -26,7 +31,9 @@ type Component struct {
 	t      tomb.Tomb
 	config Configuration
 
-	db struct {
+	configLock sync.Mutex
+	watcher    *fsnotify.Watcher
+	db         struct {
 		geo atomic.Pointer[maxminddb.Reader]
 		asn atomic.Pointer[maxminddb.Reader]
 	}
@@ -49,12 +56,7 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		d:      &dependencies,
 		config: configuration,
 	}
-	if c.config.GeoDatabase != "" {
-		c.config.GeoDatabase = filepath.Clean(c.config.GeoDatabase)
-	}
-	if c.config.ASNDatabase != "" {
-		c.config.ASNDatabase = filepath.Clean(c.config.ASNDatabase)
-	}
+	cleanPaths(&c.config)
 	c.d.Daemon.Track(&c.t, "inlet/geoip")
 	c.metrics.databaseRefresh = c.r.CounterVec(
 		reporter.CounterOpts{
@@ -77,9 +79,20 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		},
 		[]string{"database"},
 	)
+	c.r.RegisterReadinessCheck("geoip", c.databasesCheck)
 	return &c, nil
 }
 
+// cleanPaths cleans the paths to the databases.
+func cleanPaths(configuration *Configuration) {
+	if configuration.GeoDatabase != "" {
+		configuration.GeoDatabase = filepath.Clean(configuration.GeoDatabase)
+	}
+	if configuration.ASNDatabase != "" {
+		configuration.ASNDatabase = filepath.Clean(configuration.ASNDatabase)
+	}
+}
+
 // openDatabase opens the provided database and closes the current
 // one. Do nothing if the path is empty.
 func (c *Component) openDatabase(which string, path string, container *atomic.Pointer[maxminddb.Reader]) error {
@@ -105,6 +118,70 @@ func (c *Component) openDatabase(which string, path string, container *atomic.Po
 	return nil
 }
 
+// Check checks the databases can be opened. It does not load them. A
+// missing database is not an error when the databases are optional.
+func (c *Component) Check() error {
+	databases := []struct {
+		which string
+		path  string
+	}{
+		{"geo", c.config.GeoDatabase},
+		{"asn", c.config.ASNDatabase},
+	}
+	for _, db := range databases {
+		if db.path == "" {
+			continue
+		}
+		reader, err := maxminddb.Open(db.path)
+		if err != nil {
+			if c.config.Optional && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("cannot open %s database: %w", db.which, err)
+		}
+		if err := reader.Verify(); err != nil {
+			reader.Close()
+			return fmt.Errorf("invalid %s database: %w", db.which, err)
+		}
+		reader.Close()
+	}
+	return nil
+}
+
+// databasesCheck reports if the configured databases are loaded. A
+// missing database is only a warning when the databases are optional.
+func (c *Component) databasesCheck(_ context.Context) reporter.HealthcheckResult {
+	c.configLock.Lock()
+	databases := []struct {
+		which  string
+		path   string
+		loaded bool
+	}{
+		{"geo", c.config.GeoDatabase, c.db.geo.Load() != nil},
+		{"asn", c.config.ASNDatabase, c.db.asn.Load() != nil},
+	}
+	optional := c.config.Optional
+	c.configLock.Unlock()
+
+	missing := []string{}
+	for _, db := range databases {
+		if db.path != "" && !db.loaded {
+			missing = append(missing, db.which)
+		}
+	}
+	if len(missing) == 0 {
+		return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "ok"}
+	}
+	status := reporter.HealthcheckError
+	if optional {
+		status = reporter.HealthcheckWarning
+	}
+	return reporter.HealthcheckResult{
+		Status: status,
+		Reason: fmt.Sprintf("%s database not loaded", strings.Join(missing, " and ")),
+	}
+}
+
 // Start starts the GeoIP component.
 func (c *Component) Start() error {
 	if err := c.openDatabase("geo", c.config.GeoDatabase, &c.db.geo); err != nil && !c.config.Optional {
@@ -119,6 +196,7 @@ func (c *Component) Start() error {
 	}
 
 	c.r.Info().Msg("starting GeoIP component")
+	c.r.RegisterHealthcheck("geoip", c.databasesCheck)
 
 	// Watch for modifications
 	watcher, err := fsnotify.NewWatcher()
@@ -139,6 +217,7 @@ func (c *Component) Start() error {
 			return fmt.Errorf("cannot watch database directory: %w", err)
 		}
 	}
+	c.watcher = watcher
 	c.t.Go(func() error {
 		errLogger := c.r.Sample(reporter.BurstSampler(10*time.Second, 1))
 		defer watcher.Close()
@@ -162,21 +241,69 @@ func (c *Component) Start() error {
 				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
 					continue
 				}
+				c.configLock.Lock()
 				if filepath.Clean(event.Name) == c.config.GeoDatabase {
 					c.openDatabase("geo", c.config.GeoDatabase, &c.db.geo)
 				}
 				if filepath.Clean(event.Name) == c.config.ASNDatabase {
 					c.openDatabase("asn", c.config.ASNDatabase, &c.db.asn)
 				}
+				c.configLock.Unlock()
 			}
 		}
 	})
 	return nil
 }
 
+// Reload applies the changes to the paths of the databases from the
+// provided configuration. It returns the other settings which were
+// modified and need a restart.
+func (c *Component) Reload(configuration Configuration) ([]string, error) {
+	cleanPaths(&configuration)
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	if c.watcher == nil {
+		// The component was not started as there was no
+		// database. Everything needs a restart.
+		return helpers.ChangedFields(c.config, configuration), nil
+	}
+	restart := helpers.ChangedFields(c.config, configuration,
+		"GeoDatabase", "ASNDatabase")
+	databases := []struct {
+		which     string
+		current   *string
+		path      string
+		container *atomic.Pointer[maxminddb.Reader]
+	}{
+		{"geo", &c.config.GeoDatabase, configuration.GeoDatabase, &c.db.geo},
+		{"asn", &c.config.ASNDatabase, configuration.ASNDatabase, &c.db.asn},
+	}
+	for _, db := range databases {
+		if *db.current == db.path {
+			continue
+		}
+		if db.path == "" {
+			c.r.Info().Msgf("closing %s database", db.which)
+			if old := db.container.Swap(nil); old != nil {
+				old.Close()
+			}
+		} else {
+			if err := c.openDatabase(db.which, db.path, db.container); err != nil {
+				return restart, err
+			}
+			if err := c.watcher.Add(filepath.Dir(db.path)); err != nil {
+				c.r.Err(err).Msg("cannot watch database directory")
+				return restart, fmt.Errorf("cannot watch database directory: %w", err)
+			}
+		}
+		*db.current = db.path
+	}
+	return restart, nil
+}
+
 // Stop stops the GeoIP component.
 func (c *Component) Stop() error {
-	if c.db.geo.Load() == nil && c.db.asn.Load() == nil {
+	if c.watcher == nil {
 		return nil
 	}
 	c.r.Info().Msg("stopping GeoIP component")
@@ -4,6 +4,7 @@
 package geoip
 
 import (
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -76,6 +77,58 @@ func TestDatabaseRefresh(t *testing.T) {
 	}
 }
 
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultConfiguration()
+	config.GeoDatabase = filepath.Join(dir, "country.mmdb")
+	copyFile(filepath.Join("testdata", "GeoLite2-Country-Test.mmdb"),
+		config.GeoDatabase)
+	copyFile(filepath.Join("testdata", "GeoLite2-ASN-Test.mmdb"),
+		filepath.Join(dir, "asn.mmdb"))
+
+	r := reporter.NewMock(t)
+	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	// Switch from the geo database to the ASN database
+	config = DefaultConfiguration()
+	config.ASNDatabase = filepath.Join(dir, "subdir", "..", "asn.mmdb")
+	config.Optional = true
+	restart, err := c.Reload(config)
+	if err != nil {
+		t.Fatalf("Reload() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(restart, []string{"optional"}); diff != "" {
+		t.Errorf("Reload() (-got, +want):\n%s", diff)
+	}
+	if c.db.geo.Load() != nil {
+		t.Error("Reload() did not close geo database")
+	}
+	if c.db.asn.Load() == nil {
+		t.Error("Reload() did not open ASN database")
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_geoip_db_")
+	expectedMetrics := map[string]string{
+		`refresh_total{database="asn"}`: "1",
+		`refresh_total{database="geo"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Reload with a missing database
+	config.ASNDatabase = filepath.Join(dir, "missing.mmdb")
+	if _, err := c.Reload(config); err == nil {
+		t.Fatal("Reload() did not error")
+	}
+	if c.db.asn.Load() == nil {
+		t.Error("Reload() closed ASN database on error")
+	}
+}
+
 func TestStartWithoutDatabase(t *testing.T) {
 	r := reporter.NewMock(t)
 	c, err := New(r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
@@ -110,3 +163,93 @@ func TestStartWithMissingDatabase(t *testing.T) {
 		})
 	}
 }
+
+func TestDatabasesCheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r)
+	got := r.RunReadinessChecks(context.Background())
+	if diff := helpers.Diff(got.Details["geoip"], reporter.HealthcheckResult{
+		Status: reporter.HealthcheckOK,
+		Reason: "ok",
+	}); diff != "" {
+		t.Fatalf("RunReadinessChecks() (-got, +want):\n%s", diff)
+	}
+
+	r = reporter.NewMock(t)
+	config := c.config
+	config.ASNDatabase = filepath.Join(t.TempDir(), "GeoLite2-ASN.mmdb")
+	config.Optional = true
+	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	got = r.RunReadinessChecks(context.Background())
+	if diff := helpers.Diff(got.Details["geoip"], reporter.HealthcheckResult{
+		Status: reporter.HealthcheckWarning,
+		Reason: "geo and asn database not loaded",
+	}); diff != "" {
+		t.Fatalf("RunReadinessChecks() (-got, +want):\n%s", diff)
+	}
+	helpers.StartStop(t, c)
+	got = r.RunHealthchecks(context.Background())
+	if diff := helpers.Diff(got.Details["geoip"], reporter.HealthcheckResult{
+		Status: reporter.HealthcheckWarning,
+		Reason: "asn database not loaded",
+	}); diff != "" {
+		t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+	}
+
+	r = reporter.NewMock(t)
+	config.Optional = false
+	if _, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)}); err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	got = r.RunReadinessChecks(context.Background())
+	if got.Details["geoip"].Status != reporter.HealthcheckError {
+		t.Fatalf("RunReadinessChecks() == %+v, expected error for geoip", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.mmdb")
+	if err := os.WriteFile(invalid, []byte("hello"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	cases := []struct {
+		Description   string
+		Configuration Configuration
+		Error         bool
+	}{
+		{"no database", Configuration{}, false},
+		{"valid databases", Configuration{
+			GeoDatabase: filepath.Join("testdata", "GeoLite2-Country-Test.mmdb"),
+			ASNDatabase: filepath.Join("testdata", "GeoLite2-ASN-Test.mmdb"),
+		}, false},
+		{"missing database", Configuration{
+			GeoDatabase: filepath.Join(dir, "missing.mmdb"),
+		}, true},
+		{"missing optional database", Configuration{
+			GeoDatabase: filepath.Join(dir, "missing.mmdb"),
+			Optional:    true,
+		}, false},
+		{"invalid database", Configuration{
+			ASNDatabase: invalid,
+			Optional:    true,
+		}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			c, err := New(reporter.NewMock(t), tc.Configuration, Dependencies{Daemon: daemon.NewMock(t)})
+			if err != nil {
+				t.Fatalf("New() error:\n%+v", err)
+			}
+			err = c.Check()
+			if err != nil && !tc.Error {
+				t.Fatalf("Check() error:\n%+v", err)
+			} else if err == nil && tc.Error {
+				t.Fatal("Check() did not error")
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package grpc
+
+// Configuration describes the configuration for the gRPC server.
+type Configuration struct {
+	// Listen defines the listening string to listen to. The server
+	// is disabled when empty.
+	Listen string `validate:"omitempty,listen"`
+	// QueueSize is the number of flows waiting to be sent to each
+	// subscriber. When the queue is full, flows are dropped.
+	QueueSize int `validate:"min=1"`
+	// MaxSubscribers is the maximum number of concurrent
+	// subscribers. 0 means no limit.
+	MaxSubscribers int `validate:"min=0"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// gRPC server.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		QueueSize:      1000,
+		MaxSubscribers: 10,
+	}
+}
@@ -0,0 +1,213 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package grpc exposes a server-streaming gRPC API to subscribe to
+// enriched flows. The service is defined in data/flows.proto.
+package grpc
+
+import (
+	_ "embed" // for flows.proto
+	"fmt"
+	"net"
+	netHTTP "net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+)
+
+//go:embed data/flows.proto
+var flowsProto []byte
+
+// Component represents the gRPC server.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	server      *grpc.Server
+	address     net.Addr
+	subscribers int32
+	metrics     struct {
+		subscribers  reporter.GaugeFunc
+		subscribes   *reporter.CounterVec
+		flowsSent    reporter.Counter
+		flowsDropped reporter.Counter
+	}
+}
+
+// Dependencies define the dependencies of the gRPC server.
+type Dependencies struct {
+	Daemon daemon.Component
+	HTTP   *http.Component
+	Flows  core.Subscriber
+}
+
+// New creates a new gRPC server.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	c := Component{
+		r:      r,
+		d:      &dependencies,
+		config: configuration,
+	}
+	c.d.Daemon.Track(&c.t, "inlet/grpc")
+	c.metrics.subscribers = c.r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "subscribers",
+			Help: "Number of active subscribers.",
+		},
+		func() float64 {
+			return float64(atomic.LoadInt32(&c.subscribers))
+		},
+	)
+	c.metrics.subscribes = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "subscribe_requests_total",
+			Help: "Number of subscribe requests by gRPC status code.",
+		},
+		[]string{"code"},
+	)
+	c.metrics.flowsSent = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_sent_total",
+			Help: "Number of flows sent to subscribers.",
+		},
+	)
+	c.metrics.flowsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_dropped_total",
+			Help: "Number of flows dropped because a subscriber was too slow.",
+		},
+	)
+	c.d.HTTP.AddHandler("/api/v0/inlet/grpc/flows.proto",
+		netHTTP.HandlerFunc(func(w netHTTP.ResponseWriter, r *netHTTP.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(flowsProto)
+		}))
+	return &c, nil
+}
+
+// Start starts the gRPC server.
+func (c *Component) Start() error {
+	if c.config.Listen == "" {
+		return nil
+	}
+	c.r.Info().Str("listen", c.config.Listen).Msg("starting gRPC server")
+	listener, err := net.Listen("tcp", c.config.Listen)
+	if err != nil {
+		return fmt.Errorf("unable to listen to %v: %w", c.config.Listen, err)
+	}
+	c.address = listener.Addr()
+	c.server = grpc.NewServer()
+	RegisterFlowsServer(c.server, &flowsServer{c: c})
+
+	c.t.Go(func() error {
+		if err := c.server.Serve(listener); err != nil {
+			c.r.Err(err).Str("listen", c.config.Listen).Msg("unable to start gRPC server")
+			return fmt.Errorf("unable to start gRPC server: %w", err)
+		}
+		return nil
+	})
+	c.t.Go(func() error {
+		<-c.t.Dying()
+		// Streams are ended by the handlers when the tomb is dying.
+		stopped := make(chan struct{})
+		go func() {
+			c.server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			c.server.Stop()
+		}
+		return nil
+	})
+	return nil
+}
+
+// Stop stops the gRPC server.
+func (c *Component) Stop() error {
+	if c.config.Listen == "" {
+		return nil
+	}
+	c.r.Info().Msg("stopping gRPC server")
+	defer c.r.Info().Msg("gRPC server stopped")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// LocalAddr returns the address the gRPC server is listening to.
+func (c *Component) LocalAddr() net.Addr {
+	return c.address
+}
+
+// flowsServer implements the Flows service.
+type flowsServer struct {
+	UnimplementedFlowsServer
+	c *Component
+}
+
+// Subscribe streams the flows matching the filter of the request.
+func (s *flowsServer) Subscribe(request *SubscribeRequest, stream Flows_SubscribeServer) error {
+	c := s.c
+	filter, err := flow.NewFilter(request.GetFilter())
+	if err != nil {
+		return c.endStream(codes.InvalidArgument, err.Error())
+	}
+	if count := atomic.AddInt32(&c.subscribers, 1); c.config.MaxSubscribers > 0 && int(count) > c.config.MaxSubscribers {
+		atomic.AddInt32(&c.subscribers, -1)
+		return c.endStream(codes.ResourceExhausted, "too many subscribers")
+	}
+	subscription := c.d.Flows.Subscribe(c.config.QueueSize)
+	defer func() {
+		atomic.AddInt32(&c.subscribers, -1)
+		subscription.Unsubscribe()
+	}()
+
+	var reported uint64
+	reportDropped := func() {
+		dropped := subscription.Dropped()
+		c.metrics.flowsDropped.Add(float64(dropped - reported))
+		reported = dropped
+	}
+	defer reportDropped()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.t.Dying():
+			return c.endStream(codes.Unavailable, "server is shutting down")
+		case <-stream.Context().Done():
+			return c.endStream(codes.Canceled, "subscriber is gone")
+		case <-ticker.C:
+			reportDropped()
+		case fl := <-subscription.Flows():
+			if !filter.Match(fl) {
+				continue
+			}
+			if err := stream.Send(fl); err != nil {
+				return err
+			}
+			c.metrics.flowsSent.Inc()
+		}
+	}
+}
+
+// endStream returns the error ending a stream with the provided gRPC
+// status code.
+func (c *Component) endStream(code codes.Code, message string) error {
+	c.metrics.subscribes.WithLabelValues(strconv.Itoa(int(code))).Inc()
+	return status.Error(code, message)
+}
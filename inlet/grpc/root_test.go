@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	netHTTP "net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/http"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/flow"
+)
+
+func setup(t *testing.T, configuration Configuration) (*reporter.Reporter, *http.Component, *core.Broadcaster, *Component) {
+	t.Helper()
+	r := reporter.NewMock(t)
+	h := http.NewMock(t, r)
+	b := core.NewBroadcaster()
+	configuration.Listen = "127.0.0.1:0"
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   h,
+		Flows:  b,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+	return r, h, b, c
+}
+
+// subscribe sends a subscribe request with the provided filter. The
+// stream is closed when the returned function is called.
+func subscribe(t *testing.T, c *Component, filter string) (Flows_SubscribeClient, func()) {
+	t.Helper()
+	conn, err := grpc.Dial(c.LocalAddr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Dial() error:\n%+v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := NewFlowsClient(conn).Subscribe(ctx, &SubscribeRequest{Filter: filter})
+	if err != nil {
+		t.Fatalf("Subscribe() error:\n%+v", err)
+	}
+	stop := func() {
+		cancel()
+		conn.Close()
+	}
+	t.Cleanup(stop)
+	return stream, stop
+}
+
+func waitSubscriptions(t *testing.T, b *core.Broadcaster, expected int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if b.Subscriptions() == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Subscriptions() == %d, expected %d", b.Subscriptions(), expected)
+}
+
+func TestSubscribe(t *testing.T) {
+	r, _, b, c := setup(t, DefaultConfiguration())
+	stream, stop := subscribe(t, c, "DstPort = 443")
+	waitSubscriptions(t, b, 1)
+
+	b.Publish(&flow.Message{SequenceNum: 1, DstPort: 80})
+	b.Publish(&flow.Message{SequenceNum: 2, DstPort: 443, ExporterName: "exporter1"})
+	got, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv() error:\n%+v", err)
+	}
+	expected := flow.Message{SequenceNum: 2, DstPort: 443, ExporterName: "exporter1"}
+	if diff := helpers.Diff(got, &expected); diff != "" {
+		t.Fatalf("Subscribe() (-got, +want):\n%s", diff)
+	}
+
+	stop()
+	waitSubscriptions(t, b, 0)
+	gotMetrics := r.GetMetrics("akvorado_inlet_grpc_", "flows_sent", "subscribe")
+	expectedMetrics := map[string]string{
+		`flows_sent_total`:                   "1",
+		`subscribe_requests_total{code="1"}`: "1",
+		`subscribers`:                        "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.MaxSubscribers = 1
+	_, _, b, c := setup(t, configuration)
+
+	cases := []struct {
+		Filter string
+		Code   codes.Code
+	}{
+		{"DstPort =", codes.InvalidArgument},
+		{"", codes.OK},
+		{"", codes.ResourceExhausted},
+	}
+	for _, tc := range cases {
+		stream, _ := subscribe(t, c, tc.Filter)
+		if tc.Code == codes.OK {
+			// This one is kept open to exhaust subscribers
+			waitSubscriptions(t, b, 1)
+			continue
+		}
+		_, err := stream.Recv()
+		if err == io.EOF || status.Code(err) != tc.Code {
+			t.Errorf("Subscribe(%q) error %v instead of code %s", tc.Filter, err, tc.Code)
+		}
+	}
+}
+
+func TestStopWithSubscriber(t *testing.T) {
+	r := reporter.NewMock(t)
+	b := core.NewBroadcaster()
+	configuration := DefaultConfiguration()
+	configuration.Listen = "127.0.0.1:0"
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   http.NewMock(t, r),
+		Flows:  b,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	stream, _ := subscribe(t, c, "")
+	waitSubscriptions(t, b, 1)
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Recv() error %v instead of code %s", err, codes.Unavailable)
+	}
+}
+
+func TestFlowsProto(t *testing.T) {
+	_, h, _, _ := setup(t, DefaultConfiguration())
+	resp, err := netHTTP.Get(fmt.Sprintf("http://%s/api/v0/inlet/grpc/flows.proto", h.LocalAddr()))
+	if err != nil {
+		t.Fatalf("GET /api/v0/inlet/grpc/flows.proto:\n%+v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "service Flows") {
+		t.Fatalf("GET /api/v0/inlet/grpc/flows.proto:\n%s", body)
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ipfix
+
+import "time"
+
+// Configuration describes the configuration for the IPFIX exporter.
+type Configuration struct {
+	// Destinations is the list of collectors (host:port) to send
+	// IPFIX messages to.
+	Destinations []string `validate:"dive,hostname_port"`
+	// ObservationDomainID is the observation domain ID used in
+	// IPFIX messages.
+	ObservationDomainID uint32
+	// MaxPacketSize is the maximum size of an IPFIX message.
+	MaxPacketSize int `validate:"min=512,max=65507"`
+	// FlushInterval is the maximum time to wait before sending
+	// pending flows.
+	FlushInterval time.Duration `validate:"min=10ms"`
+	// TemplateRefresh is the interval between two transmissions of
+	// the templates.
+	TemplateRefresh time.Duration `validate:"min=1s"`
+	// QueueSize is the number of flows waiting to be encoded. When
+	// the queue is full, the inlet stops processing flows.
+	QueueSize int `validate:"min=0"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// IPFIX exporter.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		MaxPacketSize:   1400,
+		FlushInterval:   time.Second,
+		TemplateRefresh: time.Minute,
+		QueueSize:       10000,
+	}
+}
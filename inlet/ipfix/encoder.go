@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"akvorado/inlet/flow"
+)
+
+const (
+	ipfixVersion      = 10
+	messageHeaderSize = 16
+	setHeaderSize     = 4
+	templateSetID     = 2
+)
+
+// field is an information element exported for each flow.
+type field struct {
+	id     uint16
+	length uint16
+	append func(b []byte, fl *flow.Message) []byte
+}
+
+// template is a set of fields. There is one template for each
+// combination of address families for the flow and the exporter.
+type template struct {
+	id     uint16
+	fields []field
+	length int
+}
+
+func uintField(id uint16, length uint16, value func(fl *flow.Message) uint64) field {
+	return field{id, length, func(b []byte, fl *flow.Message) []byte {
+		v := value(fl)
+		for i := int(length) - 1; i >= 0; i-- {
+			b = append(b, byte(v>>(8*i)))
+		}
+		return b
+	}}
+}
+
+func ipv4Field(id uint16, value func(fl *flow.Message) []byte) field {
+	return field{id, 4, func(b []byte, fl *flow.Message) []byte {
+		if ip := net.IP(value(fl)).To4(); ip != nil {
+			return append(b, ip...)
+		}
+		return append(b, 0, 0, 0, 0)
+	}}
+}
+
+func ipv6Field(id uint16, value func(fl *flow.Message) []byte) field {
+	return field{id, 16, func(b []byte, fl *flow.Message) []byte {
+		if ip := net.IP(value(fl)).To16(); ip != nil {
+			return append(b, ip...)
+		}
+		return append(b, net.IPv6zero...)
+	}}
+}
+
+var (
+	commonFields = []field{
+		uintField(1, 8, func(fl *flow.Message) uint64 { return fl.Bytes }),                     // octetDeltaCount
+		uintField(2, 8, func(fl *flow.Message) uint64 { return fl.Packets }),                   // packetDeltaCount
+		uintField(4, 1, func(fl *flow.Message) uint64 { return uint64(fl.Proto) }),             // protocolIdentifier
+		uintField(5, 1, func(fl *flow.Message) uint64 { return uint64(fl.IPTos) }),             // ipClassOfService
+		uintField(6, 2, func(fl *flow.Message) uint64 { return uint64(fl.TCPFlags) }),          // tcpControlBits
+		uintField(7, 2, func(fl *flow.Message) uint64 { return uint64(fl.SrcPort) }),           // sourceTransportPort
+		uintField(11, 2, func(fl *flow.Message) uint64 { return uint64(fl.DstPort) }),          // destinationTransportPort
+		uintField(10, 4, func(fl *flow.Message) uint64 { return uint64(fl.InIf) }),             // ingressInterface
+		uintField(14, 4, func(fl *flow.Message) uint64 { return uint64(fl.OutIf) }),            // egressInterface
+		uintField(16, 4, func(fl *flow.Message) uint64 { return uint64(fl.SrcAS) }),            // bgpSourceAsNumber
+		uintField(17, 4, func(fl *flow.Message) uint64 { return uint64(fl.DstAS) }),            // bgpDestinationAsNumber
+		uintField(61, 1, func(fl *flow.Message) uint64 { return uint64(fl.FlowDirection) }),    // flowDirection
+		uintField(34, 4, func(fl *flow.Message) uint64 { return fl.SamplingRate }),             // samplingInterval
+		uintField(150, 4, func(fl *flow.Message) uint64 { return fl.TimeFlowStart }),           // flowStartSeconds
+		uintField(151, 4, func(fl *flow.Message) uint64 { return fl.TimeFlowEnd }),             // flowEndSeconds
+		uintField(89, 1, func(fl *flow.Message) uint64 { return uint64(fl.ForwardingStatus) }), // forwardingStatus
+	}
+	ipv4Fields = []field{
+		ipv4Field(8, func(fl *flow.Message) []byte { return fl.SrcAddr }),            // sourceIPv4Address
+		ipv4Field(12, func(fl *flow.Message) []byte { return fl.DstAddr }),           // destinationIPv4Address
+		ipv4Field(18, func(fl *flow.Message) []byte { return fl.NextHop }),           // bgpNextHopIPv4Address
+		uintField(9, 1, func(fl *flow.Message) uint64 { return uint64(fl.SrcNet) }),  // sourceIPv4PrefixLength
+		uintField(13, 1, func(fl *flow.Message) uint64 { return uint64(fl.DstNet) }), // destinationIPv4PrefixLength
+	}
+	ipv6Fields = []field{
+		ipv6Field(27, func(fl *flow.Message) []byte { return fl.SrcAddr }),           // sourceIPv6Address
+		ipv6Field(28, func(fl *flow.Message) []byte { return fl.DstAddr }),           // destinationIPv6Address
+		ipv6Field(63, func(fl *flow.Message) []byte { return fl.NextHop }),           // bgpNextHopIPv6Address
+		uintField(29, 1, func(fl *flow.Message) uint64 { return uint64(fl.SrcNet) }), // sourceIPv6PrefixLength
+		uintField(30, 1, func(fl *flow.Message) uint64 { return uint64(fl.DstNet) }), // destinationIPv6PrefixLength
+	}
+	exporterIPv4Fields = []field{
+		ipv4Field(130, func(fl *flow.Message) []byte { return fl.ExporterAddress }), // exporterIPv4Address
+	}
+	exporterIPv6Fields = []field{
+		ipv6Field(131, func(fl *flow.Message) []byte { return fl.ExporterAddress }), // exporterIPv6Address
+	}
+)
+
+// templates are the templates used to export flows, indexed by
+// templateIndex().
+var templates = func() []template {
+	result := []template{}
+	for _, exporterFields := range [][]field{exporterIPv4Fields, exporterIPv6Fields} {
+		for _, addressFields := range [][]field{ipv4Fields, ipv6Fields} {
+			t := template{id: uint16(256 + len(result))}
+			t.fields = append(t.fields, commonFields...)
+			t.fields = append(t.fields, addressFields...)
+			t.fields = append(t.fields, exporterFields...)
+			for _, f := range t.fields {
+				t.length += int(f.length)
+			}
+			result = append(result, t)
+		}
+	}
+	return result
+}()
+
+// templateIndex returns the index of the template to use for a flow.
+func templateIndex(fl *flow.Message) int {
+	index := 0
+	if isIPv6(fl.SrcAddr) {
+		index++
+	}
+	if isIPv6(fl.ExporterAddress) {
+		index += 2
+	}
+	return index
+}
+
+func isIPv6(ip []byte) bool {
+	return len(ip) == net.IPv6len && net.IP(ip).To4() == nil
+}
+
+// encoder encodes flows into IPFIX messages.
+type encoder struct {
+	domainID uint32
+	maxSize  int
+	sequence uint32
+
+	current  []byte
+	records  uint32
+	setStart int
+	setIndex int
+	messages [][]byte
+}
+
+// newEncoder creates a new IPFIX encoder.
+func newEncoder(domainID uint32, maxSize int) *encoder {
+	return &encoder{
+		domainID: domainID,
+		maxSize:  maxSize,
+		setIndex: -1,
+	}
+}
+
+// Add encodes a flow. Once full, messages are available with
+// Messages().
+func (e *encoder) Add(fl *flow.Message, now time.Time) {
+	index := templateIndex(fl)
+	t := templates[index]
+	needed := t.length
+	if index != e.setIndex {
+		needed += setHeaderSize
+	}
+	if e.current != nil && len(e.current)+needed > e.maxSize {
+		e.finish(now)
+	}
+	if e.current == nil {
+		e.current = make([]byte, messageHeaderSize, e.maxSize)
+	}
+	if index != e.setIndex {
+		e.closeSet()
+		e.setStart = len(e.current)
+		e.setIndex = index
+		e.current = binary.BigEndian.AppendUint16(e.current, t.id)
+		e.current = append(e.current, 0, 0)
+	}
+	for _, f := range t.fields {
+		e.current = f.append(e.current, fl)
+	}
+	e.records++
+}
+
+// Flush completes the current message.
+func (e *encoder) Flush(now time.Time) {
+	if e.current != nil {
+		e.finish(now)
+	}
+}
+
+// Messages returns the completed messages and forget about them.
+func (e *encoder) Messages() [][]byte {
+	messages := e.messages
+	e.messages = nil
+	return messages
+}
+
+// Templates returns a message with all the templates.
+func (e *encoder) Templates(now time.Time) []byte {
+	message := make([]byte, messageHeaderSize, e.maxSize)
+	message = binary.BigEndian.AppendUint16(message, templateSetID)
+	message = append(message, 0, 0)
+	for _, t := range templates {
+		message = binary.BigEndian.AppendUint16(message, t.id)
+		message = binary.BigEndian.AppendUint16(message, uint16(len(t.fields)))
+		for _, f := range t.fields {
+			message = binary.BigEndian.AppendUint16(message, f.id)
+			message = binary.BigEndian.AppendUint16(message, f.length)
+		}
+	}
+	binary.BigEndian.PutUint16(message[messageHeaderSize+2:], uint16(len(message)-messageHeaderSize))
+	e.header(message, now)
+	return message
+}
+
+// closeSet writes the length of the current set.
+func (e *encoder) closeSet() {
+	if e.setIndex == -1 {
+		return
+	}
+	binary.BigEndian.PutUint16(e.current[e.setStart+2:], uint16(len(e.current)-e.setStart))
+	e.setIndex = -1
+}
+
+// finish completes the current message.
+func (e *encoder) finish(now time.Time) {
+	e.closeSet()
+	e.header(e.current, now)
+	e.sequence += e.records
+	e.records = 0
+	e.messages = append(e.messages, e.current)
+	e.current = nil
+}
+
+// header writes the message header. The sequence number is the
+// number of data records sent before this message.
+func (e *encoder) header(message []byte, now time.Time) {
+	binary.BigEndian.PutUint16(message[0:], ipfixVersion)
+	binary.BigEndian.PutUint16(message[2:], uint16(len(message)))
+	binary.BigEndian.PutUint32(message[4:], uint32(now.Unix()))
+	binary.BigEndian.PutUint32(message[8:], e.sequence)
+	binary.BigEndian.PutUint32(message[12:], e.domainID)
+}
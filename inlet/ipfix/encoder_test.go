@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/decoder/netflow"
+)
+
+func TestEncoderRoundTrip(t *testing.T) {
+	now := time.Date(2022, 10, 15, 10, 0, 0, 0, time.UTC)
+	e := newEncoder(10, 1400)
+	flows := []*flow.Message{
+		{
+			ExporterAddress: net.ParseIP("::ffff:192.0.2.1"),
+			TimeFlowStart:   1665827990,
+			TimeFlowEnd:     1665827995,
+			Bytes:           1500,
+			Packets:         1,
+			SrcAddr:         net.ParseIP("::ffff:198.51.100.10"),
+			DstAddr:         net.ParseIP("::ffff:203.0.113.20"),
+			NextHop:         net.ParseIP("::ffff:192.0.2.254"),
+			SrcNet:          24,
+			DstNet:          23,
+			Etype:           0x800,
+			Proto:           6,
+			SrcPort:         443,
+			DstPort:         34974,
+			InIf:            10,
+			OutIf:           20,
+			SrcAS:           65000,
+			DstAS:           65001,
+			TCPFlags:        0x18,
+			IPTos:           8,
+		},
+		{
+			ExporterAddress: net.ParseIP("2001:db8::1"),
+			Bytes:           1000,
+			Packets:         2,
+			SrcAddr:         net.ParseIP("2001:db8:1::10"),
+			DstAddr:         net.ParseIP("2001:db8:2::20"),
+			NextHop:         net.ParseIP("2001:db8::fe"),
+			SrcNet:          48,
+			DstNet:          56,
+			Etype:           0x86dd,
+			Proto:           17,
+			SrcPort:         53,
+			DstPort:         53000,
+		},
+	}
+	for _, fl := range flows {
+		e.Add(fl, now)
+	}
+	e.Flush(now)
+	messages := e.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Messages() returned %d messages instead of 1", len(messages))
+	}
+
+	r := reporter.NewMock(t)
+	nfdecoder := netflow.New(r)
+	source := net.ParseIP("127.0.0.1")
+	if got := nfdecoder.Decode(decoder.RawFlow{Payload: e.Templates(now), Source: source}); len(got) != 0 {
+		t.Fatalf("Decode() on templates returned flows")
+	}
+	got := nfdecoder.Decode(decoder.RawFlow{Payload: messages[0], Source: source})
+	// The exporter address is not decoded, the source is used instead.
+	for _, fl := range got {
+		fl.ExporterAddress = nil
+		fl.TimeReceived = 0
+	}
+	expected := []*flow.Message{
+		{
+			TimeFlowStart: 1665827990,
+			TimeFlowEnd:   1665827995,
+			Bytes:         1500,
+			Packets:       1,
+			SrcAddr:       net.ParseIP("198.51.100.10").To16(),
+			DstAddr:       net.ParseIP("203.0.113.20").To16(),
+			NextHop:       net.ParseIP("192.0.2.254").To16(),
+			SrcNet:        24,
+			DstNet:        23,
+			Etype:         0x800,
+			Proto:         6,
+			SrcPort:       443,
+			DstPort:       34974,
+			InIf:          10,
+			OutIf:         20,
+			SrcAS:         65000,
+			DstAS:         65001,
+			TCPFlags:      0x18,
+			IPTos:         8,
+		}, {
+			Bytes:   1000,
+			Packets: 2,
+			SrcAddr: net.ParseIP("2001:db8:1::10"),
+			DstAddr: net.ParseIP("2001:db8:2::20"),
+			NextHop: net.ParseIP("2001:db8::fe"),
+			SrcNet:  48,
+			DstNet:  56,
+			Etype:   0x86dd,
+			Proto:   17,
+			SrcPort: 53,
+			DstPort: 53000,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Decode() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestEncoderSplit(t *testing.T) {
+	now := time.Date(2022, 10, 15, 10, 0, 0, 0, time.UTC)
+	e := newEncoder(10, 512)
+	for i := 0; i < 20; i++ {
+		e.Add(&flow.Message{SrcAddr: net.ParseIP("::ffff:192.0.2.1")}, now)
+	}
+	e.Flush(now)
+	got := []uint32{}
+	for _, message := range e.Messages() {
+		if len(message) > 512 {
+			t.Errorf("message length %d > 512", len(message))
+		}
+		if binary.BigEndian.Uint16(message[2:]) != uint16(len(message)) {
+			t.Errorf("message length %d != %d", binary.BigEndian.Uint16(message[2:]), len(message))
+		}
+		// Sequence numbers
+		got = append(got, binary.BigEndian.Uint32(message[8:]))
+	}
+	// Each record is 72 bytes, 6 records per message
+	if diff := helpers.Diff(got, []uint32{0, 6, 12, 18}); diff != "" {
+		t.Fatalf("Sequence numbers (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package ipfix provides an output encoding flows as IPFIX and
+// forwarding them over UDP to other collectors.
+package ipfix
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the IPFIX exporter.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	queue         chan *flow.Message
+	encoder       *encoder
+	conns         []net.Conn
+	lastTemplates time.Time
+	errLogger     reporter.Logger
+	metrics       struct {
+		flowsReceived *reporter.CounterVec
+		records       reporter.Counter
+		messages      *reporter.CounterVec
+		errors        *reporter.CounterVec
+	}
+}
+
+// Dependencies define the dependencies of the IPFIX exporter.
+type Dependencies struct {
+	Daemon daemon.Component
+}
+
+// New creates a new IPFIX exporter.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if len(configuration.Destinations) == 0 {
+		return nil, errors.New("at least one destination is required for the IPFIX output")
+	}
+	c := Component{
+		r:         r,
+		d:         &dependencies,
+		config:    configuration,
+		queue:     make(chan *flow.Message, configuration.QueueSize),
+		encoder:   newEncoder(configuration.ObservationDomainID, configuration.MaxPacketSize),
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+	}
+	c.d.Daemon.Track(&c.t, "inlet/ipfix")
+	c.metrics.flowsReceived = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_received_total",
+			Help: "Number of flows received from a given exporter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.records = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "records_total",
+			Help: "Number of data records encoded.",
+		},
+	)
+	c.metrics.messages = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "messages_sent_total",
+			Help: "Number of IPFIX messages sent to a destination.",
+		},
+		[]string{"destination"},
+	)
+	c.metrics.errors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of errors when sending IPFIX messages to a destination.",
+		},
+		[]string{"destination"},
+	)
+	return &c, nil
+}
+
+// Start starts the IPFIX exporter.
+func (c *Component) Start() error {
+	c.r.Info().Strs("destinations", c.config.Destinations).Msg("starting IPFIX exporter")
+	for _, destination := range c.config.Destinations {
+		conn, err := net.Dial("udp", destination)
+		if err != nil {
+			for _, conn := range c.conns {
+				conn.Close()
+			}
+			return fmt.Errorf("unable to connect to %s: %w", destination, err)
+		}
+		c.conns = append(c.conns, conn)
+	}
+	c.t.Go(c.run)
+	return nil
+}
+
+// Stop stops the IPFIX exporter. Pending flows are sent before
+// stopping.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("IPFIX exporter stopped")
+	c.r.Info().Msg("stopping IPFIX exporter")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// Send queues a flow to be exported. It blocks when the queue is full.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.metrics.flowsReceived.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+	select {
+	case c.queue <- fl:
+	case <-c.t.Dying():
+	}
+}
+
+// run encodes queued flows and sends IPFIX messages.
+func (c *Component) run() error {
+	defer func() {
+		for _, conn := range c.conns {
+			conn.Close()
+		}
+	}()
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.t.Dying():
+			for {
+				select {
+				case fl := <-c.queue:
+					c.add(fl)
+					continue
+				default:
+				}
+				break
+			}
+			c.encoder.Flush(time.Now())
+			c.send()
+			return nil
+		case fl := <-c.queue:
+			c.add(fl)
+		case <-ticker.C:
+			c.encoder.Flush(time.Now())
+			c.send()
+		}
+	}
+}
+
+// add encodes a flow and sends completed messages.
+func (c *Component) add(fl *flow.Message) {
+	c.encoder.Add(fl, time.Now())
+	c.metrics.records.Inc()
+	c.send()
+}
+
+// send sends completed messages to all destinations. Templates are
+// sent first when they have not been sent recently.
+func (c *Component) send() {
+	messages := c.encoder.Messages()
+	if len(messages) == 0 {
+		return
+	}
+	now := time.Now()
+	if now.Sub(c.lastTemplates) >= c.config.TemplateRefresh {
+		messages = append([][]byte{c.encoder.Templates(now)}, messages...)
+		c.lastTemplates = now
+	}
+	for idx, conn := range c.conns {
+		destination := c.config.Destinations[idx]
+		for _, message := range messages {
+			if _, err := conn.Write(message); err != nil {
+				c.metrics.errors.WithLabelValues(destination).Inc()
+				c.errLogger.Err(err).Str("destination", destination).Msg("unable to send IPFIX message")
+				continue
+			}
+			c.metrics.messages.WithLabelValues(destination).Inc()
+		}
+	}
+}
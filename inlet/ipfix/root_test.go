@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+func TestExport(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error:\n%+v", err)
+	}
+	defer collector.Close()
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Destinations = []string{collector.LocalAddr().String()}
+	configuration.FlushInterval = 10 * time.Millisecond
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	c.Send("127.0.0.1", &flow.Message{SrcAddr: net.ParseIP("::ffff:192.0.2.1"), Bytes: 1000})
+	c.Send("127.0.0.1", &flow.Message{SrcAddr: net.ParseIP("2001:db8::1"), Bytes: 1000})
+
+	// First message contains templates, second one data
+	sets := [][]uint16{}
+	buf := make([]byte, 65535)
+	for i := 0; i < 2; i++ {
+		collector.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := collector.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom() error:\n%+v", err)
+		}
+		message := buf[:n]
+		if version := binary.BigEndian.Uint16(message); version != 10 {
+			t.Fatalf("version %d instead of 10", version)
+		}
+		ids := []uint16{}
+		for offset := messageHeaderSize; offset < n; {
+			ids = append(ids, binary.BigEndian.Uint16(message[offset:]))
+			offset += int(binary.BigEndian.Uint16(message[offset+2:]))
+		}
+		sets = append(sets, ids)
+	}
+	if diff := helpers.Diff(sets, [][]uint16{{2}, {256, 257}}); diff != "" {
+		t.Fatalf("Sets (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_ipfix_", "records", "messages")
+	expectedMetrics := map[string]string{
+		`records_total`: "2",
+		`messages_sent_total{destination="` + collector.LocalAddr().String() + `"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestMissingDestinations(t *testing.T) {
+	r := reporter.NewMock(t)
+	if _, err := New(r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
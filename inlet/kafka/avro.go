@@ -0,0 +1,242 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"akvorado/inlet/flow"
+)
+
+// avroEncoder encodes flows using Avro. The schema is derived from
+// the protobuf definition and the Confluent wire format is used: a
+// zero byte, the schema ID as a 32-bit big-endian integer and the
+// Avro binary payload.
+type avroEncoder struct {
+	registry *schemaRegistry
+	schema   string
+	id       uint32 // atomic, set by register()
+}
+
+func newAvroEncoder(registry *schemaRegistry) (*avroEncoder, error) {
+	schema, err := avroSchema((&flow.Message{}).ProtoReflect().Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	return &avroEncoder{
+		registry: registry,
+		schema:   schema,
+	}, nil
+}
+
+// register registers the schema with the subjects matching the
+// provided topics. It should be called before encoding flows. The
+// registry gives the same ID to the same schema, whatever the
+// subject, so the first ID is used for all topics.
+func (e *avroEncoder) register(topics []string) error {
+	for _, topic := range topics {
+		id, err := e.registry.Register(fmt.Sprintf("%s-value", topic), "", e.schema)
+		if err != nil {
+			return err
+		}
+		atomic.CompareAndSwapUint32(&e.id, 0, id)
+	}
+	return nil
+}
+
+// Encode encodes a flow with Avro, using the ID of the schema
+// registered at startup.
+func (e *avroEncoder) Encode(_ string, fl *flow.Message) ([]byte, error) {
+	id := atomic.LoadUint32(&e.id)
+	if id == 0 {
+		return nil, errors.New("Avro schema not registered")
+	}
+	out := make([]byte, 5, 256)
+	binary.BigEndian.PutUint32(out[1:], id)
+	return avroAppendMessage(out, fl.ProtoReflect()), nil
+}
+
+type avroRecord struct {
+	Type      string      `json:"type"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace,omitempty"`
+	Fields    []avroField `json:"fields"`
+}
+
+type avroField struct {
+	Name    string      `json:"name"`
+	Type    interface{} `json:"type"`
+	Default interface{} `json:"default"`
+}
+
+type avroEnum struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Symbols []string `json:"symbols"`
+}
+
+type avroArray struct {
+	Type  string      `json:"type"`
+	Items interface{} `json:"items"`
+}
+
+// avroSchema builds an Avro schema from a protobuf message descriptor.
+func avroSchema(md protoreflect.MessageDescriptor) (string, error) {
+	defined := map[protoreflect.FullName]bool{}
+	record := avroMessageSchema(md, defined)
+	record.Namespace = "akvorado"
+	out, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("cannot generate Avro schema: %w", err)
+	}
+	return string(out), nil
+}
+
+func avroMessageSchema(md protoreflect.MessageDescriptor, defined map[protoreflect.FullName]bool) avroRecord {
+	defined[md.FullName()] = true
+	record := avroRecord{
+		Type:   "record",
+		Name:   string(md.Name()),
+		Fields: []avroField{},
+	}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		var (
+			fieldType    interface{}
+			fieldDefault interface{}
+		)
+		switch fd.Kind() {
+		case protoreflect.MessageKind:
+			if defined[fd.Message().FullName()] {
+				fieldType = string(fd.Message().Name())
+			} else {
+				fieldType = avroMessageSchema(fd.Message(), defined)
+			}
+			if !fd.IsList() {
+				fieldType = []interface{}{"null", fieldType}
+			}
+		case protoreflect.EnumKind:
+			ed := fd.Enum()
+			if defined[ed.FullName()] {
+				fieldType = string(ed.Name())
+			} else {
+				defined[ed.FullName()] = true
+				symbols := []string{}
+				for j := 0; j < ed.Values().Len(); j++ {
+					symbols = append(symbols, string(ed.Values().Get(j).Name()))
+				}
+				fieldType = avroEnum{Type: "enum", Name: string(ed.Name()), Symbols: symbols}
+			}
+			fieldDefault = string(ed.Values().Get(0).Name())
+		default:
+			fieldType, fieldDefault = avroScalarSchema(fd.Kind())
+		}
+		if fd.IsList() {
+			fieldType = avroArray{Type: "array", Items: fieldType}
+			fieldDefault = []interface{}{}
+		}
+		record.Fields = append(record.Fields, avroField{
+			Name:    string(fd.Name()),
+			Type:    fieldType,
+			Default: fieldDefault,
+		})
+	}
+	return record
+}
+
+// avroScalarSchema returns the Avro type and its default value for a
+// protobuf scalar. Unsigned integers are mapped to long.
+func avroScalarSchema(kind protoreflect.Kind) (string, interface{}) {
+	switch kind {
+	case protoreflect.BoolKind:
+		return "boolean", false
+	case protoreflect.FloatKind:
+		return "float", 0
+	case protoreflect.DoubleKind:
+		return "double", 0
+	case protoreflect.StringKind:
+		return "string", ""
+	case protoreflect.BytesKind:
+		return "bytes", ""
+	default:
+		return "long", 0
+	}
+}
+
+// avroAppendMessage appends the Avro binary encoding of a message.
+func avroAppendMessage(out []byte, msg protoreflect.Message) []byte {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		value := msg.Get(fd)
+		switch {
+		case fd.IsList():
+			list := value.List()
+			if list.Len() > 0 {
+				out = avroAppendLong(out, int64(list.Len()))
+				for j := 0; j < list.Len(); j++ {
+					out = avroAppendValue(out, fd, list.Get(j))
+				}
+			}
+			out = avroAppendLong(out, 0)
+		case fd.Kind() == protoreflect.MessageKind:
+			if !msg.Has(fd) {
+				out = avroAppendLong(out, 0)
+				continue
+			}
+			out = avroAppendLong(out, 1)
+			out = avroAppendMessage(out, value.Message())
+		default:
+			out = avroAppendValue(out, fd, value)
+		}
+	}
+	return out
+}
+
+// avroAppendValue appends the Avro binary encoding of a single value.
+func avroAppendValue(out []byte, fd protoreflect.FieldDescriptor, value protoreflect.Value) []byte {
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		return avroAppendMessage(out, value.Message())
+	case protoreflect.EnumKind:
+		index := 0
+		if ev := fd.Enum().Values().ByNumber(value.Enum()); ev != nil {
+			index = ev.Index()
+		}
+		return avroAppendLong(out, int64(index))
+	case protoreflect.BoolKind:
+		if value.Bool() {
+			return append(out, 1)
+		}
+		return append(out, 0)
+	case protoreflect.FloatKind:
+		return binary.LittleEndian.AppendUint32(out, math.Float32bits(float32(value.Float())))
+	case protoreflect.DoubleKind:
+		return binary.LittleEndian.AppendUint64(out, math.Float64bits(value.Float()))
+	case protoreflect.StringKind:
+		out = avroAppendLong(out, int64(len(value.String())))
+		return append(out, value.String()...)
+	case protoreflect.BytesKind:
+		out = avroAppendLong(out, int64(len(value.Bytes())))
+		return append(out, value.Bytes()...)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return avroAppendLong(out, value.Int())
+	default:
+		return avroAppendLong(out, int64(value.Uint()))
+	}
+}
+
+// avroAppendLong appends a zigzag-encoded variable-length integer.
+func avroAppendLong(out []byte, v int64) []byte {
+	return binary.AppendUvarint(out, uint64((v<<1)^(v>>63)))
+}
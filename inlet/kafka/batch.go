@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/inlet/flow"
+)
+
+// batchOverhead is the number of bytes kept for the key, the headers
+// and the record overhead when checking if an encoded flow fits into
+// a batch.
+const batchOverhead = 1024
+
+// batchKey identifies flows which can be packed in the same message:
+// they go to the same topic, they come from the same exporter and
+// they use the same partition key.
+type batchKey struct {
+	topic    string
+	exporter string
+	key      string
+}
+
+// batch is a set of encoded flows waiting to be sent as a single
+// message.
+type batch struct {
+	payload []byte
+	flows   int
+	key     sarama.Encoder
+	headers []sarama.RecordHeader
+}
+
+// batches are the batches currently filled.
+type batches struct {
+	lock    sync.Mutex
+	pending map[batchKey]*batch
+}
+
+// addToBatch adds an encoded flow to the batch it belongs to. The
+// batch is sent once full.
+func (c *Component) addToBatch(topic, exporter string, fl *flow.Message, payload []byte) {
+	bk := batchKey{topic: topic, exporter: exporter}
+	key := c.keyer.Key(exporter, fl)
+	if c.keyer.Keyed() {
+		if encoded, err := key.Encode(); err == nil {
+			bk.key = string(encoded)
+		}
+	}
+
+	ready := []*sarama.ProducerMessage{}
+	c.batches.lock.Lock()
+	b := c.batches.pending[bk]
+	if b != nil && len(b.payload)+len(payload)+1 > c.config.MaxMessageBytes-batchOverhead {
+		delete(c.batches.pending, bk)
+		ready = append(ready, c.batchMessage(bk, b))
+		b = nil
+	}
+	if b == nil {
+		b = &batch{key: key}
+		if c.config.Headers {
+			b.headers = c.headers(exporter, fl)
+		}
+		c.batches.pending[bk] = b
+	}
+	if b.flows > 0 && c.config.Encoding == EncodingJSON {
+		b.payload = append(b.payload, '\n')
+	}
+	b.payload = append(b.payload, payload...)
+	b.flows++
+	if b.flows >= c.config.BatchSize {
+		delete(c.batches.pending, bk)
+		ready = append(ready, c.batchMessage(bk, b))
+	}
+	c.batches.lock.Unlock()
+
+	for _, msg := range ready {
+		c.produce(msg)
+	}
+}
+
+// batchMessage turns a batch into a message for Kafka.
+func (c *Component) batchMessage(bk batchKey, b *batch) *sarama.ProducerMessage {
+	c.metrics.batchSize.Observe(float64(b.flows))
+	msg := &sarama.ProducerMessage{
+		Topic: bk.topic,
+		Key:   b.key,
+		Value: sarama.ByteEncoder(b.payload),
+	}
+	if c.config.Headers {
+		msg.Headers = append(b.headers, sarama.RecordHeader{
+			Key:   []byte(HeaderFlows),
+			Value: strconv.AppendInt(nil, int64(b.flows), 10),
+		})
+	}
+	return msg
+}
+
+// flushBatches sends all the pending batches, even if they are not
+// full.
+func (c *Component) flushBatches() {
+	c.batches.lock.Lock()
+	ready := make([]*sarama.ProducerMessage, 0, len(c.batches.pending))
+	for bk, b := range c.batches.pending {
+		ready = append(ready, c.batchMessage(bk, b))
+		delete(c.batches.pending, bk)
+	}
+	c.batches.lock.Unlock()
+
+	for _, msg := range ready {
+		c.produce(msg)
+	}
+}
+
+// runBatchFlusher sends the pending batches at regular interval to
+// bound the time a flow waits in an incomplete batch.
+func (c *Component) runBatchFlusher() error {
+	ticker := time.NewTicker(c.config.BatchTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case <-ticker.C:
+			c.flushBatches()
+		}
+	}
+}
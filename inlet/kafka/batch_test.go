@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+func TestKafkaBatch(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.BatchSize = 2
+	configuration.BatchTimeout = time.Hour
+	c, mockProducer := NewMock(t, r, configuration)
+
+	flow1 := &flow.Message{SequenceNum: 1, TimeReceived: 1665000000}
+	flow2 := &flow.Message{SequenceNum: 2, TimeReceived: 1665000001}
+	flow3 := &flow.Message{SequenceNum: 3, TimeReceived: 1665000002}
+	payload1, _ := protobufEncoder{}.Encode("", flow1)
+	payload3, _ := protobufEncoder{}.Encode("", flow3)
+
+	received := make(chan bool)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+		defer close(received)
+		value, _ := got.Value.Encode()
+		if diff := helpers.Diff(value, append(append([]byte{}, payload1...), payload3...)); diff != "" {
+			t.Errorf("Send() value (-got, +want):\n%s", diff)
+		}
+		headers := map[string]string{}
+		for _, header := range got.Headers {
+			headers[string(header.Key)] = string(header.Value)
+		}
+		if diff := helpers.Diff(headers[HeaderExporter], "127.0.0.1"); diff != "" {
+			t.Errorf("Send() exporter header (-got, +want):\n%s", diff)
+		}
+		if diff := helpers.Diff(headers[HeaderTimeReceived], "1665000000"); diff != "" {
+			t.Errorf("Send() time received header (-got, +want):\n%s", diff)
+		}
+		if diff := helpers.Diff(headers[HeaderFlows], "2"); diff != "" {
+			t.Errorf("Send() flows header (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	c.Send("127.0.0.1", flow1)
+	c.Send("127.0.0.2", flow2)
+	c.Send("127.0.0.1", flow3)
+	select {
+	case <-received:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Kafka message not received")
+	}
+
+	// The incomplete batch is sent when stopping
+	mockProducer.ExpectInputAndSucceed()
+}
+
+func TestKafkaBatchPartitionKey(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.BatchSize = 2
+	configuration.BatchTimeout = time.Hour
+	configuration.PartitionKey = PartitionKeyFiveTuple
+	c, mockProducer := NewMock(t, r, configuration)
+
+	flow1 := &flow.Message{SequenceNum: 1, SrcPort: 1000, DstPort: 80}
+	flow2 := &flow.Message{SequenceNum: 2, SrcPort: 1001, DstPort: 80}
+	flow3 := &flow.Message{SequenceNum: 3, SrcPort: 1000, DstPort: 80}
+	payload1, _ := protobufEncoder{}.Encode("", flow1)
+	payload3, _ := protobufEncoder{}.Encode("", flow3)
+	key1, _ := c.keyer.Key("127.0.0.1", flow1).Encode()
+
+	received := make(chan bool)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+		defer close(received)
+		value, _ := got.Value.Encode()
+		if diff := helpers.Diff(value, append(append([]byte{}, payload1...), payload3...)); diff != "" {
+			t.Errorf("Send() value (-got, +want):\n%s", diff)
+		}
+		key, _ := got.Key.Encode()
+		if diff := helpers.Diff(key, key1); diff != "" {
+			t.Errorf("Send() key (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	// All flows come from the same exporter, but the second one
+	// has a different partition key.
+	c.Send("127.0.0.1", flow1)
+	c.Send("127.0.0.1", flow2)
+	c.Send("127.0.0.1", flow3)
+	select {
+	case <-received:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Kafka message not received")
+	}
+
+	// The incomplete batch is sent when stopping
+	mockProducer.ExpectInputAndSucceed()
+}
+
+func TestKafkaBatchTimeout(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.BatchSize = 10
+	configuration.BatchTimeout = 20 * time.Millisecond
+	configuration.Encoding = EncodingJSON
+	c, mockProducer := NewMock(t, r, configuration)
+
+	received := make(chan bool)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+		defer close(received)
+		value, _ := got.Value.Encode()
+		if diff := helpers.Diff(bytes.Count(value, []byte("\n")), 1); diff != "" {
+			t.Errorf("Send() newlines (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+	select {
+	case <-received:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Kafka message not received")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "batch_size_flows_count")
+	expectedMetrics := map[string]string{
+		`batch_size_flows_count`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaBatchAvro(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.BatchSize = 10
+	configuration.Encoding = EncodingAvro
+	configuration.SchemaRegistry.URL = "http://127.0.0.1:8081"
+	if _, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
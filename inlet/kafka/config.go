@@ -4,11 +4,13 @@
 package kafka
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Shopify/sarama"
 
+	"akvorado/common/helpers"
 	"akvorado/common/kafka"
 )
 
@@ -19,6 +21,9 @@ type Configuration struct {
 	FlushInterval time.Duration `validate:"min=1s"`
 	// FlushBytes tells to flush when there are many bytes to write
 	FlushBytes int `validate:"min=1000"`
+	// FlushMessages tells to flush when there are many messages
+	// to write. 0 means no limit.
+	FlushMessages int `validate:"min=0"`
 	// MaxMessageBytes is the maximum permitted size of a message.
 	// Should be set equal or smaller than broker's
 	// `message.max.bytes`.
@@ -27,6 +32,64 @@ type Configuration struct {
 	CompressionCodec CompressionCodec
 	// QueueSize defines the size of the channel used to send to Kafka.
 	QueueSize int `validate:"min=0"`
+	// RequiredAcks defines the level of acknowledgement required
+	// from brokers before considering a message as sent.
+	RequiredAcks RequiredAcks
+	// MaxRetries is the number of times to retry sending a message.
+	MaxRetries int `validate:"min=0"`
+	// RetryBackoff is the time to wait before retrying.
+	RetryBackoff time.Duration `validate:"min=0"`
+	// Timeout is the maximum time the broker waits for the
+	// required acknowledgements.
+	Timeout time.Duration `validate:"min=1ms"`
+	// MaxResends is the number of times a message is sent again
+	// after the producer gave up on it.
+	MaxResends int `validate:"min=0"`
+	// ResendBackoff is the initial time to wait before sending a
+	// message again. It is doubled on each attempt.
+	ResendBackoff time.Duration `validate:"min=0"`
+	// MaxResendBackoff is the maximum time to wait before sending
+	// a message again.
+	MaxResendBackoff time.Duration `validate:"gtefield=ResendBackoff"`
+	// CircuitBreaker defines when to stop sending messages after
+	// repeated failures.
+	CircuitBreaker CircuitBreakerConfiguration
+	// Headers tells to attach metadata headers to each message.
+	Headers bool
+	// Idempotent enables the idempotent producer to ensure retries
+	// do not duplicate messages. It requires acknowledgements from
+	// all replicas and only one in-flight request per broker.
+	Idempotent bool
+	// TopicTemplate is a Go template over flow fields to compute
+	// the topic to send a flow to. When empty, the configured
+	// topic is used.
+	TopicTemplate string
+	// ExporterTopics maps exporter subnets to the topic to send
+	// their flows to, instead of the configured topic and template.
+	// It is set from the exporter groups of the inlet configuration.
+	ExporterTopics *helpers.SubnetMap[string] `yaml:"-"`
+	// PartitionKey defines how the partition key is computed.
+	PartitionKey PartitionKey
+	// PartitionKeyFields is the list of fields to hash when
+	// PartitionKey is "fields".
+	PartitionKeyFields []string
+	// Encoding defines how flows are encoded.
+	Encoding Encoding
+	// SchemaRegistry defines the schema registry to use with Avro.
+	// With protobuf, the schema is published at startup.
+	SchemaRegistry SchemaRegistryConfiguration
+	// Mirror defines a secondary Kafka cluster to send a copy of
+	// flows to.
+	Mirror MirrorConfiguration
+	// FlushTimeout is the maximum time to wait for the pending
+	// messages to be sent when stopping.
+	FlushTimeout time.Duration `validate:"min=0"`
+	// BatchSize is the number of flows to pack into a single
+	// message. 1 means each flow is sent in its own message.
+	BatchSize int `validate:"min=1"`
+	// BatchTimeout is the maximum time a flow waits for its batch
+	// to be complete.
+	BatchTimeout time.Duration `validate:"min=1ms"`
 }
 
 // DefaultConfiguration represents the default configuration for the Kafka exporter.
@@ -38,6 +101,24 @@ func DefaultConfiguration() Configuration {
 		MaxMessageBytes:  1000000,
 		CompressionCodec: CompressionCodec(sarama.CompressionNone),
 		QueueSize:        32,
+		RequiredAcks:     RequiredAcks(sarama.WaitForLocal),
+		MaxRetries:       3,
+		RetryBackoff:     100 * time.Millisecond,
+		Timeout:          10 * time.Second,
+		PartitionKey:     PartitionKeyRandom,
+		MaxResends:       3,
+		ResendBackoff:    time.Second,
+		MaxResendBackoff: 30 * time.Second,
+		CircuitBreaker: CircuitBreakerConfiguration{
+			Threshold: 100,
+			Cooldown:  30 * time.Second,
+		},
+		Headers:      true,
+		Encoding:     EncodingProtobuf,
+		Mirror:       DefaultMirrorConfiguration(),
+		FlushTimeout: 10 * time.Second,
+		BatchSize:    1,
+		BatchTimeout: 100 * time.Millisecond,
 	}
 }
 
@@ -70,3 +151,86 @@ func (cc CompressionCodec) String() string {
 func (cc CompressionCodec) MarshalText() ([]byte, error) {
 	return []byte(cc.String()), nil
 }
+
+// RequiredAcks represents the level of acknowledgement required from
+// brokers.
+type RequiredAcks sarama.RequiredAcks
+
+var requiredAcksMap = helpers.NewBimap(map[RequiredAcks]string{
+	RequiredAcks(sarama.NoResponse):   "none",
+	RequiredAcks(sarama.WaitForLocal): "leader",
+	RequiredAcks(sarama.WaitForAll):   "all",
+})
+
+// UnmarshalText produces a required acks level
+func (ra *RequiredAcks) UnmarshalText(text []byte) error {
+	got, ok := requiredAcksMap.LoadKey(string(text))
+	if !ok {
+		return fmt.Errorf("cannot parse %q as a required acks level", string(text))
+	}
+	*ra = got
+	return nil
+}
+
+// String turns a required acks level into a string
+func (ra RequiredAcks) String() string {
+	got, _ := requiredAcksMap.LoadValue(ra)
+	return got
+}
+
+// MarshalText turns a required acks level into a string
+func (ra RequiredAcks) MarshalText() ([]byte, error) {
+	return []byte(ra.String()), nil
+}
+
+// PartitionKey describes how to compute the key used to select a
+// partition.
+type PartitionKey int
+
+const (
+	// PartitionKeyRandom uses a random key.
+	PartitionKeyRandom PartitionKey = iota
+	// PartitionKeyRoundRobin does not use a key and selects
+	// partitions in a round-robin fashion.
+	PartitionKeyRoundRobin
+	// PartitionKeyExporter uses the exporter address as a key.
+	PartitionKeyExporter
+	// PartitionKeyFiveTuple uses the addresses, the ports and
+	// the protocol as a key.
+	PartitionKeyFiveTuple
+	// PartitionKeyFields uses the fields from PartitionKeyFields as a key.
+	PartitionKeyFields
+)
+
+var partitionKeyMap = helpers.NewBimap(map[PartitionKey]string{
+	PartitionKeyRandom:     "random",
+	PartitionKeyRoundRobin: "round-robin",
+	PartitionKeyExporter:   "exporter",
+	PartitionKeyFiveTuple:  "five-tuple",
+	PartitionKeyFields:     "fields",
+})
+
+// MarshalText turns a partition key strategy to text.
+func (pk PartitionKey) MarshalText() ([]byte, error) {
+	got, ok := partitionKeyMap.LoadValue(pk)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown partition key")
+}
+
+// String turns a partition key strategy to string.
+func (pk PartitionKey) String() string {
+	got, _ := partitionKeyMap.LoadValue(pk)
+	return got
+}
+
+// UnmarshalText provides a partition key strategy from a string.
+func (pk *PartitionKey) UnmarshalText(input []byte) error {
+	got, ok := partitionKeyMap.LoadKey(string(input))
+	if ok {
+		*pk = got
+		return nil
+	}
+	return errors.New("unknown partition key")
+}
@@ -40,6 +40,35 @@ func TestCompressionCodecUnmarshal(t *testing.T) {
 	}
 }
 
+func TestRequiredAcksUnmarshal(t *testing.T) {
+	cases := []struct {
+		Input         string
+		Expected      sarama.RequiredAcks
+		ExpectedError bool
+	}{
+		{"none", sarama.NoResponse, false},
+		{"leader", sarama.WaitForLocal, false},
+		{"all", sarama.WaitForAll, false},
+		{"unknown", sarama.NoResponse, true},
+	}
+	for _, tc := range cases {
+		var ra RequiredAcks
+		err := ra.UnmarshalText([]byte(tc.Input))
+		if err != nil && !tc.ExpectedError {
+			t.Errorf("UnmarshalText(%q) error:\n%+v", tc.Input, err)
+			continue
+		}
+		if err == nil && tc.ExpectedError {
+			t.Errorf("UnmarshalText(%q) got %v but expected error", tc.Input, ra)
+			continue
+		}
+		if ra != RequiredAcks(tc.Expected) {
+			t.Errorf("UnmarshalText(%q) got %v but expected %v", tc.Input, ra, tc.Expected)
+			continue
+		}
+	}
+}
+
 func TestDefaultConfiguration(t *testing.T) {
 	if err := helpers.Validate.Struct(DefaultConfiguration()); err != nil {
 		t.Fatalf("validate.Struct() error:\n%+v", err)
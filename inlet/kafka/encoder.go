@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/flow"
+)
+
+// Encoding defines how flows are encoded before being sent to Kafka.
+type Encoding int
+
+const (
+	// EncodingProtobuf encodes flows using length-delimited protocol buffers.
+	EncodingProtobuf Encoding = iota
+	// EncodingJSON encodes flows as JSON.
+	EncodingJSON
+	// EncodingAvro encodes flows using Avro and the Confluent wire format.
+	EncodingAvro
+)
+
+var encodingMap = helpers.NewBimap(map[Encoding]string{
+	EncodingProtobuf: "protobuf",
+	EncodingJSON:     "json",
+	EncodingAvro:     "avro",
+})
+
+// MarshalText turns an encoding to text.
+func (e Encoding) MarshalText() ([]byte, error) {
+	got, ok := encodingMap.LoadValue(e)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown encoding")
+}
+
+// String turns an encoding to string.
+func (e Encoding) String() string {
+	got, _ := encodingMap.LoadValue(e)
+	return got
+}
+
+// UnmarshalText provides an encoding from a string.
+func (e *Encoding) UnmarshalText(input []byte) error {
+	got, ok := encodingMap.LoadKey(string(input))
+	if ok {
+		*e = got
+		return nil
+	}
+	return errors.New("unknown encoding")
+}
+
+// encoder encodes a flow to be sent to the provided topic.
+type encoder interface {
+	Encode(topic string, fl *flow.Message) ([]byte, error)
+}
+
+// newEncoder creates the encoder matching the configuration.
+func newEncoder(configuration Configuration) (encoder, error) {
+	switch configuration.Encoding {
+	case EncodingProtobuf:
+		return protobufEncoder{}, nil
+	case EncodingJSON:
+		return jsonEncoder{}, nil
+	case EncodingAvro:
+		if configuration.SchemaRegistry.URL == "" {
+			return nil, errors.New("a schema registry is required for Avro encoding")
+		}
+		return newAvroEncoder(newSchemaRegistry(configuration.SchemaRegistry))
+	}
+	return nil, fmt.Errorf("unknown encoding %d", configuration.Encoding)
+}
+
+// protobufEncoder encodes flows using length-delimited protocol buffers.
+type protobufEncoder struct{}
+
+var protobufBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 500)
+		return &buf
+	},
+}
+
+// Encode encodes a flow using length-delimited protocol buffers.
+func (protobufEncoder) Encode(_ string, fl *flow.Message) ([]byte, error) {
+	buf := protobufBufferPool.Get().(*[]byte)
+	defer protobufBufferPool.Put(buf)
+	*buf = fl.AppendDelimited((*buf)[:0])
+	// The producer owns the payload until it is sent, copy it with
+	// its exact size.
+	return append([]byte(nil), *buf...), nil
+}
+
+// jsonEncoder encodes flows as JSON.
+type jsonEncoder struct{}
+
+// Encode encodes a flow as JSON.
+func (jsonEncoder) Encode(_ string, fl *flow.Message) ([]byte, error) {
+	out, err := json.Marshal(fl)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(out, "\n"), nil
+}
@@ -0,0 +1,294 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+func TestEncodingUnmarshal(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected Encoding
+		Error    bool
+	}{
+		{"protobuf", EncodingProtobuf, false},
+		{"json", EncodingJSON, false},
+		{"avro", EncodingAvro, false},
+		{"xml", 0, true},
+	}
+	for _, tc := range cases {
+		var got Encoding
+		err := got.UnmarshalText([]byte(tc.Input))
+		if err != nil && !tc.Error {
+			t.Errorf("UnmarshalText(%q) error:\n%+v", tc.Input, err)
+		} else if err == nil && tc.Error {
+			t.Errorf("UnmarshalText(%q) did not error", tc.Input)
+		} else if got != tc.Expected {
+			t.Errorf("UnmarshalText(%q) == %s, expected %s", tc.Input, got, tc.Expected)
+		}
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	got, err := jsonEncoder{}.Encode("flows", &flow.Message{
+		SequenceNum:  1000,
+		ExporterName: "exporter1",
+	})
+	if err != nil {
+		t.Fatalf("Encode() error:\n%+v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(decoded["ExporterName"], "exporter1"); diff != "" {
+		t.Fatalf("Encode() (-got, +want):\n%s", diff)
+	}
+	if got[len(got)-1] == '\n' {
+		t.Fatal("Encode() should not end with a newline")
+	}
+}
+
+func TestAvroEncoder(t *testing.T) {
+	var registered []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+			return
+		}
+		if user, password, _ := r.BasicAuth(); user != "akvorado" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error_code": 40101, "message": "unauthorized"}`))
+			return
+		}
+		var request struct {
+			Schema string `json:"schema"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var schema interface{}
+		if err := json.Unmarshal([]byte(request.Schema), &schema); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		registered = append(registered, r.URL.Path)
+		w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+		w.Write([]byte(fmt.Sprintf(`{"id": %d}`, 1000+len(registered))))
+	}))
+	defer ts.Close()
+
+	configuration := DefaultConfiguration()
+	configuration.Encoding = EncodingAvro
+	configuration.SchemaRegistry.URL = ts.URL
+	configuration.SchemaRegistry.Username = "akvorado"
+	configuration.SchemaRegistry.Password = "secret"
+	e, err := newEncoder(configuration)
+	if err != nil {
+		t.Fatalf("newEncoder() error:\n%+v", err)
+	}
+
+	fl := &flow.Message{TimeReceived: 200, SequenceNum: 1000}
+	if _, err := e.Encode("flows-v3", fl); err == nil {
+		t.Fatal("Encode() did not error before registering the schema")
+	}
+	if err := e.(*avroEncoder).register([]string{"flows-v3", "other-v3"}); err != nil {
+		t.Fatalf("register() error:\n%+v", err)
+	}
+	got, err := e.Encode("flows-v3", fl)
+	if err != nil {
+		t.Fatalf("Encode() error:\n%+v", err)
+	}
+	// Encode to another topic to check the schema ID is reused
+	got, err = e.Encode("templated-v3", fl)
+	if err != nil {
+		t.Fatalf("Encode() error:\n%+v", err)
+	}
+	expected := []byte{0, 0, 0, 0x03, 0xe9, 0x90, 0x03, 0xd0, 0x0f}
+	fields := fl.ProtoReflect().Descriptor().Fields().Len()
+	for i := 2; i < fields; i++ {
+		expected = append(expected, 0)
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Encode() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(registered, []string{
+		"/subjects/flows-v3-value/versions",
+		"/subjects/other-v3-value/versions",
+	}); diff != "" {
+		t.Fatalf("Registered subjects (-got, +want):\n%s", diff)
+	}
+
+	// Bad credentials
+	configuration.SchemaRegistry.Password = "wrong"
+	e, err = newEncoder(configuration)
+	if err != nil {
+		t.Fatalf("newEncoder() error:\n%+v", err)
+	}
+	if err := e.(*avroEncoder).register([]string{"flows-v3"}); err == nil {
+		t.Fatal("register() did not error")
+	}
+}
+
+func TestAvroRegistryUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Encoding = EncodingAvro
+	configuration.SchemaRegistry.URL = ts.URL
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
+		t.Fatal("createKafkaProducer() should not be called")
+		return nil, nil
+	}
+	if err := c.Start(); err == nil {
+		c.Stop()
+		t.Fatal("Start() did not error")
+	}
+}
+
+func TestAvroEncoderWithoutRegistry(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.Encoding = EncodingAvro
+	if _, err := newEncoder(configuration); err == nil {
+		t.Fatal("newEncoder() did not error")
+	}
+}
+
+func TestAvroAppendLong(t *testing.T) {
+	cases := []struct {
+		Input    int64
+		Expected []byte
+	}{
+		{0, []byte{0}},
+		{-1, []byte{1}},
+		{1, []byte{2}},
+		{-64, []byte{0x7f}},
+		{64, []byte{0x80, 0x01}},
+	}
+	for _, tc := range cases {
+		got := avroAppendLong(nil, tc.Input)
+		if diff := helpers.Diff(got, tc.Expected); diff != "" {
+			t.Errorf("avroAppendLong(%d) (-got, +want):\n%s", tc.Input, diff)
+		}
+	}
+}
+
+func BenchmarkProtobufEncoder(b *testing.B) {
+	fl := &flow.Message{
+		TimeReceived:    1647285928,
+		SequenceNum:     1000,
+		SamplingRate:    30000,
+		ExporterAddress: net.ParseIP("192.0.2.1"),
+		ExporterName:    "exporter1",
+		SrcAddr:         net.ParseIP("2001:db8::1"),
+		DstAddr:         net.ParseIP("2001:db8::2"),
+		Bytes:           1500,
+		Packets:         1,
+		SrcPort:         443,
+		DstPort:         33199,
+		Proto:           6,
+		InIf:            10,
+		OutIf:           20,
+		InIfName:        "Gi0/0/0",
+		OutIfName:       "Gi0/0/1",
+	}
+	encoder := protobufEncoder{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encoder.Encode("flows", fl); err != nil {
+			b.Fatalf("Encode() error:\n%+v", err)
+		}
+	}
+}
+
+func TestPublishProtobufSchema(t *testing.T) {
+	var compatible bool
+	var registered []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Schema     string `json:"schema"`
+			SchemaType string `json:"schemaType"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.SchemaType != "PROTOBUF" || !strings.Contains(request.Schema, "message FlowMessage") {
+			http.Error(w, "unexpected schema", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+		switch r.URL.Path {
+		case "/compatibility/subjects/flows-v3-value/versions/latest":
+			w.Write([]byte(fmt.Sprintf(`{"is_compatible": %v}`, compatible)))
+		case "/compatibility/subjects/new-v3-value/versions/latest":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code": 40401, "message": "Subject not found."}`))
+		case "/subjects/flows-v3-value/versions", "/subjects/new-v3-value/versions":
+			registered = append(registered, r.URL.Path)
+			w.Write([]byte(`{"id": 1001}`))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.SchemaRegistry.URL = ts.URL
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	// Incompatible schema
+	if err := c.registerProtobufSchema(); err == nil {
+		t.Fatal("registerProtobufSchema() did not error")
+	}
+
+	// Compatible schema
+	compatible = true
+	if err := c.registerProtobufSchema(); err != nil {
+		t.Fatalf("registerProtobufSchema() error:\n%+v", err)
+	}
+
+	// New subject
+	configuration.Topic = "new"
+	c, err = New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.registerProtobufSchema(); err != nil {
+		t.Fatalf("registerProtobufSchema() error:\n%+v", err)
+	}
+
+	if diff := helpers.Diff(registered, []string{
+		"/subjects/flows-v3-value/versions",
+		"/subjects/new-v3-value/versions",
+	}); diff != "" {
+		t.Fatalf("Registered subjects (-got, +want):\n%s", diff)
+	}
+}
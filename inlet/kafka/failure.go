@@ -0,0 +1,247 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/common/reporter"
+)
+
+// CircuitBreakerConfiguration describes when to stop sending messages
+// to Kafka after repeated failures.
+type CircuitBreakerConfiguration struct {
+	// Threshold is the number of consecutive failures opening the
+	// circuit. 0 disables the circuit breaker.
+	Threshold int `validate:"min=0"`
+	// Cooldown is the duration the circuit stays open before
+	// letting messages through again.
+	Cooldown time.Duration `validate:"min=0"`
+}
+
+// circuitBreaker stops sending messages after too many consecutive
+// failures. Once the cooldown has elapsed, messages are sent again
+// and the circuit is closed on the first success or opened again on
+// the first failure.
+type circuitBreaker struct {
+	config   CircuitBreakerConfiguration
+	lock     sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	now      func() time.Time
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func newCircuitBreaker(config CircuitBreakerConfiguration) *circuitBreaker {
+	return &circuitBreaker{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Allow tells if a message can be sent.
+func (cb *circuitBreaker) Allow() bool {
+	if cb.config.Threshold == 0 {
+		return true
+	}
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	if cb.state == breakerOpen && cb.now().Sub(cb.openedAt) >= cb.config.Cooldown {
+		cb.state = breakerHalfOpen
+	}
+	return cb.state != breakerOpen
+}
+
+// Success records a successful send. It returns true if the circuit
+// was just closed.
+func (cb *circuitBreaker) Success() bool {
+	if cb.config.Threshold == 0 {
+		return false
+	}
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	cb.failures = 0
+	if cb.state != breakerClosed {
+		cb.state = breakerClosed
+		return true
+	}
+	return false
+}
+
+// Failure records a failed send. It returns true if the circuit was
+// just opened.
+func (cb *circuitBreaker) Failure() bool {
+	if cb.config.Threshold == 0 {
+		return false
+	}
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	cb.failures++
+	if cb.state == breakerHalfOpen || (cb.state == breakerClosed && cb.failures >= cb.config.Threshold) {
+		cb.state = breakerOpen
+		cb.openedAt = cb.now()
+		return true
+	}
+	return false
+}
+
+// Healthcheck reports a warning when the circuit is open.
+func (cb *circuitBreaker) Healthcheck(_ context.Context) reporter.HealthcheckResult {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	switch cb.state {
+	case breakerOpen:
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckWarning,
+			Reason: fmt.Sprintf("circuit open after %d consecutive failures", cb.failures),
+		}
+	case breakerHalfOpen:
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckWarning,
+			Reason: "circuit half-open",
+		}
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "ok"}
+}
+
+// resend is a message to be sent again after a failure.
+type resend struct {
+	msg      *sarama.ProducerMessage
+	notAfter time.Time
+}
+
+// resendAttempt is attached as metadata to messages to track how many
+// times they were sent.
+type resendAttempt int
+
+// handleFailure handles a message the producer was unable to send.
+// It is sent again with an exponential backoff until MaxResends is
+// reached.
+func (c *Component) handleFailure(msg *sarama.ProducerMessage) {
+	if c.breaker.Failure() {
+		c.metrics.breakerOpen.Set(1)
+		c.r.Warn().Msg("too many failures, opening circuit breaker")
+	}
+	attempt, _ := msg.Metadata.(resendAttempt)
+	if int(attempt) >= c.config.MaxResends {
+		c.metrics.failedMessages.Inc()
+		return
+	}
+	backoff := c.config.ResendBackoff << attempt
+	if backoff > c.config.MaxResendBackoff || backoff <= 0 {
+		backoff = c.config.MaxResendBackoff
+	}
+	select {
+	case c.resendQueue <- resend{
+		msg: &sarama.ProducerMessage{
+			Topic:    msg.Topic,
+			Key:      msg.Key,
+			Value:    msg.Value,
+			Headers:  msg.Headers,
+			Metadata: attempt + 1,
+		},
+		notAfter: time.Now().Add(backoff),
+	}:
+		c.metrics.retriedMessages.Inc()
+	default:
+		c.metrics.failedMessages.Inc()
+	}
+}
+
+// handleSuccess handles a message successfully sent.
+func (c *Component) handleSuccess() {
+	if c.breaker.Success() {
+		c.metrics.breakerOpen.Set(0)
+		c.r.Info().Msg("circuit breaker closed")
+	}
+}
+
+// resendHeap orders the messages to be sent again by deadline.
+type resendHeap []resend
+
+func (h resendHeap) Len() int           { return len(h) }
+func (h resendHeap) Less(i, j int) bool { return h[i].notAfter.Before(h[j].notAfter) }
+func (h resendHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resendHeap) Push(x interface{}) {
+	*h = append(*h, x.(resend))
+}
+func (h *resendHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	r := old[n-1]
+	old[n-1] = resend{}
+	*h = old[:n-1]
+	return r
+}
+
+// runResender sends again the failed messages once their backoff has
+// elapsed. Messages are kept in a heap and a single timer is armed
+// for the earliest deadline, so a long backoff does not delay the
+// other messages. When dying, the pending messages are put back into
+// the resend queue to be sent when flushing.
+func (c *Component) runResender() error {
+	pending := &resendHeap{}
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		for _, r := range *pending {
+			c.requeue(r)
+		}
+	}()
+	for {
+		var next <-chan time.Time
+		if pending.Len() > 0 {
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(time.Until((*pending)[0].notAfter))
+			next = timer.C
+		}
+		select {
+		case <-c.t.Dying():
+			return nil
+		case r := <-c.resendQueue:
+			if pending.Len() >= c.config.QueueSize {
+				c.metrics.failedMessages.Inc()
+				continue
+			}
+			heap.Push(pending, r)
+		case <-next:
+			for pending.Len() > 0 && !(*pending)[0].notAfter.After(time.Now()) {
+				select {
+				case <-c.t.Dying():
+					return nil
+				case c.kafkaProducer.Input() <- (*pending)[0].msg:
+					heap.Pop(pending)
+				}
+			}
+		}
+	}
+}
+
+// requeue puts back a message in the resend queue to have it sent when
+// flushing the producer.
+func (c *Component) requeue(r resend) {
+	select {
+	case c.resendQueue <- r:
+	default:
+		c.metrics.failedMessages.Inc()
+	}
+}
@@ -0,0 +1,244 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker(CircuitBreakerConfiguration{
+		Threshold: 3,
+		Cooldown:  time.Minute,
+	})
+	cb.now = func() time.Time { return now }
+	expectStatus := func(expected reporter.HealthcheckStatus) {
+		t.Helper()
+		if got := cb.Healthcheck(context.Background()).Status; got != expected {
+			t.Errorf("Healthcheck() == %s, expected %s", got, expected)
+		}
+	}
+
+	// Failures below the threshold do not open the circuit
+	cb.Failure()
+	cb.Failure()
+	cb.Success()
+	cb.Failure()
+	cb.Failure()
+	if !cb.Allow() {
+		t.Fatal("Allow() == false, expected true")
+	}
+	expectStatus(reporter.HealthcheckOK)
+
+	// Third failure opens it
+	if !cb.Failure() {
+		t.Fatal("Failure() did not open the circuit")
+	}
+	if cb.Allow() {
+		t.Fatal("Allow() == true, expected false")
+	}
+	expectStatus(reporter.HealthcheckWarning)
+
+	// After cooldown, half-open and a failure opens it again
+	now = now.Add(time.Minute)
+	if !cb.Allow() {
+		t.Fatal("Allow() == false after cooldown, expected true")
+	}
+	if !cb.Failure() {
+		t.Fatal("Failure() did not open the circuit again")
+	}
+	if cb.Allow() {
+		t.Fatal("Allow() == true, expected false")
+	}
+
+	// After cooldown, a success closes it
+	now = now.Add(time.Minute)
+	cb.Allow()
+	if !cb.Success() {
+		t.Fatal("Success() did not close the circuit")
+	}
+	if !cb.Allow() {
+		t.Fatal("Allow() == false, expected true")
+	}
+	expectStatus(reporter.HealthcheckOK)
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	cb := newCircuitBreaker(CircuitBreakerConfiguration{})
+	for i := 0; i < 100; i++ {
+		cb.Failure()
+	}
+	if !cb.Allow() {
+		t.Fatal("Allow() == false, expected true")
+	}
+}
+
+func TestKafkaResend(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.MaxResends = 1
+	configuration.ResendBackoff = 10 * time.Millisecond
+	configuration.CircuitBreaker.Threshold = 0
+	c, mockProducer := NewMock(t, r, configuration)
+
+	// First message fails once, then succeeds
+	mockProducer.ExpectInputAndFail(errors.New("noooo"))
+	mockProducer.ExpectInputAndSucceed()
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	time.Sleep(50 * time.Millisecond)
+
+	// Second message fails twice
+	mockProducer.ExpectInputAndFail(errors.New("noooo"))
+	mockProducer.ExpectInputAndFail(errors.New("noooo"))
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+	time.Sleep(50 * time.Millisecond)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "retried_", "failed_", "dropped_")
+	expectedMetrics := map[string]string{
+		`retried_messages_total`: "2",
+		`failed_messages_total`:  "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaResendOrder(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.CircuitBreaker.Threshold = 0
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	mockProducer := mocks.NewAsyncProducer(t, c.kafkaConfig)
+	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
+		return mockProducer, nil
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+
+	// A message waiting for a long time should not delay a message
+	// with a shorter backoff.
+	sent := make(chan string, 2)
+	checker := func(val []byte) error {
+		sent <- string(val)
+		return nil
+	}
+	mockProducer.ExpectInputWithCheckerFunctionAndSucceed(checker)
+	mockProducer.ExpectInputWithCheckerFunctionAndSucceed(checker)
+	c.resendQueue <- resend{
+		msg:      &sarama.ProducerMessage{Topic: "flows", Value: sarama.StringEncoder("late")},
+		notAfter: time.Now().Add(time.Hour),
+	}
+	c.resendQueue <- resend{
+		msg:      &sarama.ProducerMessage{Topic: "flows", Value: sarama.StringEncoder("early")},
+		notAfter: time.Now().Add(10 * time.Millisecond),
+	}
+	select {
+	case got := <-sent:
+		if got != "early" {
+			t.Fatalf("first resent message is %q, expected %q", got, "early")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message with short backoff not sent")
+	}
+
+	// The remaining message is sent when stopping.
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+	select {
+	case got := <-sent:
+		if got != "late" {
+			t.Fatalf("second resent message is %q, expected %q", got, "late")
+		}
+	default:
+		t.Fatal("message with long backoff not sent when stopping")
+	}
+}
+
+func TestKafkaFlushOnStop(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.ResendBackoff = time.Hour
+	configuration.MaxResendBackoff = time.Hour
+	configuration.CircuitBreaker.Threshold = 0
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	mockProducer := mocks.NewAsyncProducer(t, c.kafkaConfig)
+	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
+		return mockProducer, nil
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+
+	// The message fails and is queued to be sent again in an hour.
+	// It should be sent when stopping.
+	mockProducer.ExpectInputAndFail(errors.New("noooo"))
+	mockProducer.ExpectInputAndSucceed()
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "retried_", "failed_")
+	expectedMetrics := map[string]string{
+		`retried_messages_total`: "1",
+		`failed_messages_total`:  "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaCircuitBreaker(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.MaxResends = 0
+	configuration.CircuitBreaker.Threshold = 1
+	configuration.CircuitBreaker.Cooldown = time.Hour
+	c, mockProducer := NewMock(t, r, configuration)
+
+	mockProducer.ExpectInputAndFail(errors.New("noooo"))
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	time.Sleep(20 * time.Millisecond)
+
+	// Circuit is open, next flows are dropped
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 3})
+	c.Send("127.0.0.2", &flow.Message{SequenceNum: 4})
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "failed_", "dropped_", "circuit_")
+	expectedMetrics := map[string]string{
+		`failed_messages_total`:                     "1",
+		`dropped_flows_total{exporter="127.0.0.1"}`: "2",
+		`dropped_flows_total{exporter="127.0.0.2"}`: "1",
+		`circuit_breaker_open`:                      "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+	got := r.RunHealthchecks(context.Background())
+	if got.Details["kafka"].Status != reporter.HealthcheckWarning {
+		t.Fatalf("RunHealthchecks() == %+v, expected warning for kafka", got)
+	}
+}
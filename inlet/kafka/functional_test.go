@@ -29,6 +29,7 @@ func TestRealKafka(t *testing.T) {
 	configuration.Brokers = brokers
 	configuration.Version = kafka.Version(sarama.V2_8_1_0)
 	configuration.FlushInterval = 100 * time.Millisecond
+	configuration.Encoding = EncodingJSON
 	expectedTopicName := fmt.Sprintf("%s-v%d", topicName, flow.CurrentSchemaVersion)
 	r := reporter.NewMock(t)
 	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
@@ -37,13 +38,20 @@ func TestRealKafka(t *testing.T) {
 	}
 	helpers.StartStop(t, c)
 
-	c.Send("127.0.0.1", []byte("hello world!"))
-	c.Send("127.0.0.1", []byte("goodbye world!"))
+	flows := []*flow.Message{{ExporterName: "hello"}, {ExporterName: "goodbye"}}
+	expected := []string{}
+	expectedBytes := 0
+	for _, fl := range flows {
+		payload, _ := jsonEncoder{}.Encode(topicName, fl)
+		expected = append(expected, string(payload))
+		expectedBytes += len(payload)
+		c.Send("127.0.0.1", fl)
+	}
 
 	time.Sleep(10 * time.Millisecond)
 	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "sent_")
 	expectedMetrics := map[string]string{
-		`sent_bytes_total{exporter="127.0.0.1"}`:    "26",
+		`sent_bytes_total{exporter="127.0.0.1"}`:    fmt.Sprint(expectedBytes),
 		`sent_messages_total{exporter="127.0.0.1"}`: "2",
 	}
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
@@ -74,10 +82,6 @@ func TestRealKafka(t *testing.T) {
 	}
 
 	got := []string{}
-	expected := []string{
-		"hello world!",
-		"goodbye world!",
-	}
 	timeout := time.After(15 * time.Second)
 	for i := 0; i < len(expected); i++ {
 		select {
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"strconv"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/inlet/flow"
+)
+
+// Headers attached to each message. They allow consumers to filter
+// and route messages without decoding them.
+const (
+	// HeaderSchemaVersion is the version of the protobuf schema.
+	HeaderSchemaVersion = "akvorado-schema-version"
+	// HeaderEncoding is the encoding of the message.
+	HeaderEncoding = "akvorado-encoding"
+	// HeaderExporter is the address of the exporter.
+	HeaderExporter = "akvorado-exporter"
+	// HeaderInstance is the hostname of the inlet instance.
+	HeaderInstance = "akvorado-instance"
+	// HeaderTimeReceived is the time the flow was received, as a
+	// UNIX timestamp. With batching, this is the time the first flow
+	// was received.
+	HeaderTimeReceived = "akvorado-time-received"
+	// HeaderFlows is the number of flows in the message. It is only
+	// present when batching is enabled.
+	HeaderFlows = "akvorado-flows"
+)
+
+var schemaVersionHeader = []byte(strconv.Itoa(flow.CurrentSchemaVersion))
+
+// headers builds the headers to attach to a message.
+func (c *Component) headers(exporter string, fl *flow.Message) []sarama.RecordHeader {
+	headers := make([]sarama.RecordHeader, 0, 5)
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderSchemaVersion), Value: schemaVersionHeader},
+		sarama.RecordHeader{Key: []byte(HeaderEncoding), Value: []byte(c.config.Encoding.String())},
+		sarama.RecordHeader{Key: []byte(HeaderExporter), Value: []byte(exporter)})
+	if c.instance != nil {
+		headers = append(headers,
+			sarama.RecordHeader{Key: []byte(HeaderInstance), Value: c.instance})
+	}
+	if fl != nil && fl.TimeReceived != 0 {
+		headers = append(headers,
+			sarama.RecordHeader{
+				Key:   []byte(HeaderTimeReceived),
+				Value: strconv.AppendUint(nil, fl.TimeReceived, 10),
+			})
+	}
+	return headers
+}
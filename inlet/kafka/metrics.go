@@ -19,6 +19,16 @@ type metrics struct {
 	bytesSent    *reporter.CounterVec
 	errors       *reporter.CounterVec
 
+	retriedMessages reporter.Counter
+	failedMessages  reporter.Counter
+	droppedFlows    *reporter.CounterVec
+	breakerOpen     reporter.Gauge
+	batchSize       reporter.Summary
+
+	mirrorSent    reporter.Counter
+	mirrorDropped reporter.Counter
+	mirrorErrors  *reporter.CounterVec
+
 	kafkaIncomingByteRate  *reporter.MetricDesc
 	kafkaOutgoingByteRate  *reporter.MetricDesc
 	kafkaRequestRate       *reporter.MetricDesc
@@ -31,6 +41,11 @@ type metrics struct {
 	kafkaRecordSendRate    *reporter.MetricDesc
 	kafkaRecordsPerRequest *reporter.MetricDesc
 	kafkaCompressionRatio  *reporter.MetricDesc
+
+	kafkaTopicBatchSize         *reporter.MetricDesc
+	kafkaTopicRecordSendRate    *reporter.MetricDesc
+	kafkaTopicRecordsPerRequest *reporter.MetricDesc
+	kafkaTopicCompressionRatio  *reporter.MetricDesc
 }
 
 func (c *Component) initMetrics() {
@@ -57,6 +72,57 @@ func (c *Component) initMetrics() {
 		},
 		[]string{"error"},
 	)
+	c.metrics.retriedMessages = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "retried_messages_total",
+			Help: "Number of messages sent again after a failure.",
+		},
+	)
+	c.metrics.failedMessages = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "failed_messages_total",
+			Help: "Number of messages permanently failed.",
+		},
+	)
+	c.metrics.droppedFlows = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "dropped_flows_total",
+			Help: "Number of flows from a given exporter dropped because the circuit breaker is open.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.breakerOpen = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "circuit_breaker_open",
+			Help: "Whether the circuit breaker is open.",
+		},
+	)
+	c.metrics.batchSize = c.r.Summary(
+		reporter.SummaryOpts{
+			Name:       "batch_size_flows",
+			Help:       "Number of flows per message when batching.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		},
+	)
+	c.metrics.mirrorSent = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "mirror_sent_messages_total",
+			Help: "Number of messages sent to the mirror cluster.",
+		},
+	)
+	c.metrics.mirrorDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "mirror_dropped_messages_total",
+			Help: "Number of messages dropped instead of being sent to the mirror cluster.",
+		},
+	)
+	c.metrics.mirrorErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "mirror_errors_total",
+			Help: "Number of errors when sending to the mirror cluster.",
+		},
+		[]string{"error"},
+	)
 
 	c.metrics.kafkaIncomingByteRate = c.r.MetricDesc(
 		"brokers_incoming_byte_rate",
@@ -106,6 +172,22 @@ func (c *Component) initMetrics() {
 		"producer_compression_ratio",
 		"Distribution of the compression ratio times 100 of record batches.",
 		nil)
+	c.metrics.kafkaTopicBatchSize = c.r.MetricDesc(
+		"producer_topic_batch_bytes",
+		"Distribution of the number of bytes sent per partition per request for a given topic.",
+		[]string{"topic"})
+	c.metrics.kafkaTopicRecordSendRate = c.r.MetricDesc(
+		"producer_topic_record_send_rate",
+		"Records/second sent to a given topic.",
+		[]string{"topic"})
+	c.metrics.kafkaTopicRecordsPerRequest = c.r.MetricDesc(
+		"producer_topic_records_per_request",
+		"Distribution of the number of records sent per request for a given topic.",
+		[]string{"topic"})
+	c.metrics.kafkaTopicCompressionRatio = c.r.MetricDesc(
+		"producer_topic_compression_ratio",
+		"Distribution of the compression ratio times 100 of record batches for a given topic.",
+		[]string{"topic"})
 
 	c.r.MetricCollector(c.metrics)
 }
@@ -124,6 +206,10 @@ func (m metrics) Describe(ch chan<- *prometheus.Desc) {
 	ch <- m.kafkaRecordSendRate
 	ch <- m.kafkaRecordsPerRequest
 	ch <- m.kafkaCompressionRatio
+	ch <- m.kafkaTopicBatchSize
+	ch <- m.kafkaTopicRecordSendRate
+	ch <- m.kafkaTopicRecordsPerRequest
+	ch <- m.kafkaTopicCompressionRatio
 }
 
 // Collect metrics
@@ -181,6 +267,23 @@ func (m metrics) Collect(ch chan<- prometheus.Metric) {
 			gomHistogram(ch, m.kafkaCompressionRatio, gom)
 			return
 		}
+		// Topic-related
+		if topic := metricTopic(name, "batch-size"); topic != "" {
+			gomHistogram(ch, m.kafkaTopicBatchSize, gom, topic)
+			return
+		}
+		if topic := metricTopic(name, "record-send-rate"); topic != "" {
+			gomMeter(ch, m.kafkaTopicRecordSendRate, gom, topic)
+			return
+		}
+		if topic := metricTopic(name, "records-per-request"); topic != "" {
+			gomHistogram(ch, m.kafkaTopicRecordsPerRequest, gom, topic)
+			return
+		}
+		if topic := metricTopic(name, "compression-ratio"); topic != "" {
+			gomHistogram(ch, m.kafkaTopicCompressionRatio, gom, topic)
+			return
+		}
 	})
 }
 
@@ -192,6 +295,14 @@ func metricBroker(name string, prefix string) string {
 	return ""
 }
 
+func metricTopic(name string, prefix string) string {
+	prefix = prefix + "-for-topic-"
+	if strings.HasPrefix(name, prefix) {
+		return strings.TrimPrefix(name, prefix)
+	}
+	return ""
+}
+
 func gomMeter(ch chan<- prometheus.Metric, desc *reporter.MetricDesc, m interface{}, labels ...string) {
 	snap := m.(gometrics.Meter).Snapshot()
 	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, snap.Rate1(), labels...)
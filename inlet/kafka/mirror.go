@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/common/kafka"
+	"akvorado/common/reporter"
+)
+
+// MirrorConfiguration describes a secondary Kafka cluster receiving a
+// copy of the flows. Mirroring is best-effort: when the secondary
+// cluster is unavailable or too slow, messages are dropped.
+type MirrorConfiguration struct {
+	// Brokers is the list of brokers of the secondary cluster.
+	// Mirroring is disabled when empty.
+	Brokers []string `validate:"dive,listen"`
+	// Version is the version of Kafka we assume to work
+	Version kafka.Version
+	// QueueSize defines the number of messages waiting to be
+	// sent to the secondary cluster before dropping them.
+	QueueSize int `validate:"min=1"`
+}
+
+// DefaultMirrorConfiguration represents the default configuration for
+// the secondary Kafka cluster.
+func DefaultMirrorConfiguration() MirrorConfiguration {
+	return MirrorConfiguration{
+		Version:   kafka.DefaultConfiguration().Version,
+		QueueSize: 1024,
+	}
+}
+
+// mirror queues a copy of the provided message to be sent to the
+// secondary cluster. It never blocks.
+func (c *Component) mirror(msg *sarama.ProducerMessage) {
+	select {
+	case c.mirrorQueue <- &sarama.ProducerMessage{
+		Topic:   msg.Topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: msg.Headers,
+	}:
+	default:
+		c.metrics.mirrorDropped.Inc()
+	}
+}
+
+// runMirror connects to the secondary cluster and forwards queued
+// messages to it. Failures are not fatal: the connection is retried
+// until the component is stopped.
+func (c *Component) runMirror() error {
+	errLogger := c.r.Sample(reporter.BurstSampler(10*time.Second, 3))
+	var producer sarama.AsyncProducer
+	for producer == nil {
+		var err error
+		producer, err = c.createMirrorProducer()
+		if err == nil {
+			break
+		}
+		c.metrics.mirrorErrors.WithLabelValues("connection error").Inc()
+		errLogger.Err(err).
+			Str("brokers", strings.Join(c.config.Mirror.Brokers, ",")).
+			Msg("unable to create async producer for mirror")
+		select {
+		case <-c.t.Dying():
+			return nil
+		case <-time.After(10 * time.Second):
+		}
+	}
+	defer producer.Close()
+	defer c.mirrorConfig.MetricRegistry.UnregisterAll()
+	c.r.Info().Msg("connected to mirror Kafka cluster")
+
+	for {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case msg := <-c.mirrorQueue:
+			select {
+			case producer.Input() <- msg:
+				c.metrics.mirrorSent.Inc()
+			case <-c.t.Dying():
+				return nil
+			}
+		case msg, ok := <-producer.Errors():
+			if !ok {
+				return nil
+			}
+			c.metrics.mirrorErrors.WithLabelValues(msg.Error()).Inc()
+			errLogger.Err(msg.Err).
+				Str("topic", msg.Msg.Topic).
+				Msg("Kafka mirror producer error")
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+func newMirrorMock(t *testing.T, r *reporter.Reporter, createMirror func(c *Component) (sarama.AsyncProducer, error)) (*Component, *mocks.AsyncProducer) {
+	t.Helper()
+	configuration := DefaultConfiguration()
+	configuration.Mirror.Brokers = []string{"127.0.0.1:9093"}
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	var mockProducer *mocks.AsyncProducer
+	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
+		mockProducer = mocks.NewAsyncProducer(t, c.kafkaConfig)
+		return mockProducer, nil
+	}
+	c.createMirrorProducer = func() (sarama.AsyncProducer, error) {
+		return createMirror(c)
+	}
+	helpers.StartStop(t, c)
+	return c, mockProducer
+}
+
+func TestKafkaMirror(t *testing.T) {
+	r := reporter.NewMock(t)
+	mockMirror := make(chan *mocks.AsyncProducer, 1)
+	c, mockProducer := newMirrorMock(t, r, func(c *Component) (sarama.AsyncProducer, error) {
+		producer := mocks.NewAsyncProducer(t, c.mirrorConfig)
+		mockMirror <- producer
+		return producer, nil
+	})
+	mirror := <-mockMirror
+
+	fl := &flow.Message{SequenceNum: 1}
+	payload, _ := protobufEncoder{}.Encode("", fl)
+	received := make(chan bool)
+	mirror.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+		defer close(received)
+		expected := sarama.ProducerMessage{
+			Topic:     fmt.Sprintf("flows-v%d", flow.CurrentSchemaVersion),
+			Key:       got.Key,
+			Value:     sarama.ByteEncoder(payload),
+			Headers:   got.Headers,
+			Partition: got.Partition,
+		}
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("mirror (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	mockProducer.ExpectInputAndSucceed()
+	c.Send("127.0.0.1", fl)
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("Kafka mirror message not received")
+	}
+
+	// Errors from the mirror are counted
+	mirror.ExpectInputAndFail(errors.New("noooo"))
+	mockProducer.ExpectInputAndSucceed()
+	c.Send("127.0.0.1", fl)
+
+	time.Sleep(20 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "mirror_")
+	expectedMetrics := map[string]string{
+		fmt.Sprintf(`mirror_errors_total{error="kafka: Failed to produce message to topic flows-v%d: noooo"}`, flow.CurrentSchemaVersion): "1",
+		`mirror_dropped_messages_total`: "0",
+		`mirror_sent_messages_total`:    "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaMirrorUnavailable(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, mockProducer := newMirrorMock(t, r, func(*Component) (sarama.AsyncProducer, error) {
+		return nil, errors.New("unavailable")
+	})
+
+	// Messages are queued while the mirror is unavailable and
+	// the primary cluster is not affected.
+	mockProducer.ExpectInputAndSucceed()
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	time.Sleep(20 * time.Millisecond)
+	if len(c.mirrorQueue) != 1 {
+		t.Fatalf("mirror queue length: %d, expected 1", len(c.mirrorQueue))
+	}
+
+	// Fill the queue to drop messages
+	msg := <-c.mirrorQueue
+	for i := 0; i < c.config.Mirror.QueueSize+1; i++ {
+		c.mirror(msg)
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "mirror_")
+	expectedMetrics := map[string]string{
+		`mirror_errors_total{error="connection error"}`: "1",
+		`mirror_dropped_messages_total`:                 "1",
+		`mirror_sent_messages_total`:                    "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaMirrorDisabled(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, _ := NewMock(t, r, DefaultConfiguration())
+	if c.mirrorQueue != nil {
+		t.Fatal("mirror should be disabled by default")
+	}
+}
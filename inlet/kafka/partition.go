@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/Shopify/sarama"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"akvorado/inlet/flow"
+)
+
+// fiveTupleFields is the list of fields used for PartitionKeyFiveTuple.
+var fiveTupleFields = []string{"SrcAddr", "DstAddr", "Proto", "SrcPort", "DstPort"}
+
+// partitionKeyer computes the partition key for a flow.
+type partitionKeyer struct {
+	strategy PartitionKey
+	fields   []protoreflect.FieldDescriptor
+}
+
+// newPartitionKeyer creates a new partition keyer from the
+// configuration. It checks the provided fields exist.
+func newPartitionKeyer(strategy PartitionKey, fieldNames []string) (*partitionKeyer, error) {
+	pk := &partitionKeyer{strategy: strategy}
+	switch strategy {
+	case PartitionKeyFiveTuple:
+		fieldNames = fiveTupleFields
+	case PartitionKeyFields:
+		if len(fieldNames) == 0 {
+			return nil, errors.New("no field provided for partition key")
+		}
+	default:
+		return pk, nil
+	}
+	descriptor := (&flow.Message{}).ProtoReflect().Descriptor().Fields()
+	for _, name := range fieldNames {
+		field := descriptor.ByName(protoreflect.Name(name))
+		if field == nil {
+			return nil, fmt.Errorf("unknown field %q for partition key", name)
+		}
+		if field.IsList() || field.IsMap() || field.Message() != nil {
+			return nil, fmt.Errorf("field %q cannot be used for partition key", name)
+		}
+		pk.fields = append(pk.fields, field)
+	}
+	return pk, nil
+}
+
+// Partitioner returns the partitioner constructor to use with the
+// current strategy.
+func (pk *partitionKeyer) Partitioner() sarama.PartitionerConstructor {
+	if pk.strategy == PartitionKeyRoundRobin {
+		return sarama.NewRoundRobinPartitioner
+	}
+	return sarama.NewHashPartitioner
+}
+
+// Keyed tells if the partition key is derived from the exporter or
+// from the flow. Flows with different keys should not be sent in the
+// same message.
+func (pk *partitionKeyer) Keyed() bool {
+	switch pk.strategy {
+	case PartitionKeyExporter, PartitionKeyFiveTuple, PartitionKeyFields:
+		return true
+	}
+	return false
+}
+
+// Key returns the partition key for the provided flow. The flow may
+// be nil. In this case, a random key is used.
+func (pk *partitionKeyer) Key(exporter string, fl *flow.Message) sarama.Encoder {
+	switch {
+	case pk.strategy == PartitionKeyRoundRobin:
+		return nil
+	case pk.strategy == PartitionKeyExporter:
+		return sarama.StringEncoder(exporter)
+	case len(pk.fields) > 0 && fl != nil:
+		key := []byte{}
+		msg := fl.ProtoReflect()
+		for _, field := range pk.fields {
+			key = appendValue(key, field.Kind(), msg.Get(field))
+		}
+		return sarama.ByteEncoder(key)
+	}
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, rand.Uint32())
+	return sarama.ByteEncoder(key)
+}
+
+// appendValue appends the binary representation of a scalar value.
+func appendValue(key []byte, kind protoreflect.Kind, value protoreflect.Value) []byte {
+	switch kind {
+	case protoreflect.BytesKind:
+		return append(key, value.Bytes()...)
+	case protoreflect.StringKind:
+		return append(key, value.String()...)
+	case protoreflect.BoolKind:
+		if value.Bool() {
+			return append(key, 1)
+		}
+		return append(key, 0)
+	case protoreflect.EnumKind:
+		return binary.BigEndian.AppendUint32(key, uint32(value.Enum()))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return binary.BigEndian.AppendUint64(key, math.Float64bits(value.Float()))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return binary.BigEndian.AppendUint64(key, uint64(value.Int()))
+	default:
+		return binary.BigEndian.AppendUint64(key, value.Uint())
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/Shopify/sarama"
+
+	"akvorado/inlet/flow"
+)
+
+func TestPartitionKeyUnmarshal(t *testing.T) {
+	cases := []struct {
+		Input         string
+		Expected      PartitionKey
+		ExpectedError bool
+	}{
+		{"random", PartitionKeyRandom, false},
+		{"round-robin", PartitionKeyRoundRobin, false},
+		{"exporter", PartitionKeyExporter, false},
+		{"five-tuple", PartitionKeyFiveTuple, false},
+		{"fields", PartitionKeyFields, false},
+		{"unknown", PartitionKeyRandom, true},
+	}
+	for _, tc := range cases {
+		var got PartitionKey
+		err := got.UnmarshalText([]byte(tc.Input))
+		if err != nil && !tc.ExpectedError {
+			t.Errorf("UnmarshalText(%q) error:\n%+v", tc.Input, err)
+			continue
+		}
+		if err == nil && tc.ExpectedError {
+			t.Errorf("UnmarshalText(%q) got %v but expected error", tc.Input, got)
+			continue
+		}
+		if got != tc.Expected {
+			t.Errorf("UnmarshalText(%q) got %v but expected %v", tc.Input, got, tc.Expected)
+		}
+	}
+}
+
+func TestPartitionKeyer(t *testing.T) {
+	flow1 := &flow.Message{
+		SrcAddr: net.ParseIP("192.0.2.1").To16(),
+		DstAddr: net.ParseIP("192.0.2.2").To16(),
+		Proto:   6,
+		SrcPort: 443,
+		DstPort: 33443,
+	}
+	flow2 := &flow.Message{
+		SrcAddr: net.ParseIP("192.0.2.1").To16(),
+		DstAddr: net.ParseIP("192.0.2.2").To16(),
+		Proto:   6,
+		SrcPort: 443,
+		DstPort: 33444,
+	}
+	encode := func(e sarama.Encoder) []byte {
+		if e == nil {
+			return nil
+		}
+		b, _ := e.Encode()
+		return b
+	}
+
+	t.Run("round-robin", func(t *testing.T) {
+		pk, err := newPartitionKeyer(PartitionKeyRoundRobin, nil)
+		if err != nil {
+			t.Fatalf("newPartitionKeyer() error:\n%+v", err)
+		}
+		if key := pk.Key("192.0.2.142", flow1); key != nil {
+			t.Errorf("Key() == %v, expected nil", key)
+		}
+	})
+	t.Run("exporter", func(t *testing.T) {
+		pk, err := newPartitionKeyer(PartitionKeyExporter, nil)
+		if err != nil {
+			t.Fatalf("newPartitionKeyer() error:\n%+v", err)
+		}
+		if key := encode(pk.Key("192.0.2.142", flow1)); string(key) != "192.0.2.142" {
+			t.Errorf("Key() == %q, expected %q", key, "192.0.2.142")
+		}
+	})
+	t.Run("five-tuple", func(t *testing.T) {
+		pk, err := newPartitionKeyer(PartitionKeyFiveTuple, nil)
+		if err != nil {
+			t.Fatalf("newPartitionKeyer() error:\n%+v", err)
+		}
+		key1 := encode(pk.Key("192.0.2.142", flow1))
+		key1bis := encode(pk.Key("192.0.2.143", flow1))
+		key2 := encode(pk.Key("192.0.2.142", flow2))
+		if !bytes.Equal(key1, key1bis) {
+			t.Error("Key() is not stable for the same flow")
+		}
+		if bytes.Equal(key1, key2) {
+			t.Error("Key() is the same for different flows")
+		}
+	})
+	t.Run("fields", func(t *testing.T) {
+		pk, err := newPartitionKeyer(PartitionKeyFields, []string{"SrcAddr", "Proto"})
+		if err != nil {
+			t.Fatalf("newPartitionKeyer() error:\n%+v", err)
+		}
+		key1 := encode(pk.Key("192.0.2.142", flow1))
+		key2 := encode(pk.Key("192.0.2.142", flow2))
+		if !bytes.Equal(key1, key2) {
+			t.Error("Key() is different for flows with the same fields")
+		}
+	})
+	t.Run("invalid fields", func(t *testing.T) {
+		for _, fields := range [][]string{nil, {"Unknown"}, {"DstASPath"}} {
+			if _, err := newPartitionKeyer(PartitionKeyFields, fields); err == nil {
+				t.Errorf("newPartitionKeyer(%v) did not error", fields)
+			}
+		}
+	})
+}
@@ -5,16 +5,22 @@
 package kafka
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/kafka"
 	"akvorado/common/reporter"
 	"akvorado/inlet/flow"
@@ -26,56 +32,162 @@ type Component struct {
 	d      *Dependencies
 	t      tomb.Tomb
 	config Configuration
+	tracer trace.Tracer
 
-	kafkaTopic          string
-	kafkaConfig         *sarama.Config
-	kafkaProducer       sarama.AsyncProducer
-	createKafkaProducer func() (sarama.AsyncProducer, error)
-	metrics             metrics
+	topics               *topicRouter
+	keyer                *partitionKeyer
+	encoder              encoder
+	kafkaConfig          *sarama.Config
+	kafkaProducer        sarama.AsyncProducer
+	kafkaClient          atomic.Value // sarama.Client
+	createKafkaProducer  func() (sarama.AsyncProducer, error)
+	mirrorConfig         *sarama.Config
+	mirrorQueue          chan *sarama.ProducerMessage
+	createMirrorProducer func() (sarama.AsyncProducer, error)
+	metrics              metrics
+	errLogger            reporter.Logger
+	instance             []byte
+	breaker              *circuitBreaker
+	resendQueue          chan resend
+	batches              batches
 }
 
 // Dependencies define the dependencies of the Kafka exporter.
 type Dependencies struct {
 	Daemon daemon.Component
+	Flow   *flow.Component // optional, for custom fields
 }
 
 // New creates a new HTTP component.
 func New(reporter *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	password, err := helpers.ResolveSecret(configuration.SchemaRegistry.Password)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve schema registry password: %w", err)
+	}
+	configuration.SchemaRegistry.Password = password
+
 	// Build Kafka configuration
-	kafkaConfig := sarama.NewConfig()
-	kafkaConfig.Version = sarama.KafkaVersion(configuration.Version)
-	kafkaConfig.Metadata.AllowAutoTopicCreation = true
-	kafkaConfig.Producer.MaxMessageBytes = configuration.MaxMessageBytes
-	kafkaConfig.Producer.Compression = sarama.CompressionCodec(configuration.CompressionCodec)
-	kafkaConfig.Producer.Return.Successes = false
-	kafkaConfig.Producer.Return.Errors = true
-	kafkaConfig.Producer.Flush.Bytes = configuration.FlushBytes
-	kafkaConfig.Producer.Flush.Frequency = configuration.FlushInterval
-	kafkaConfig.Producer.Partitioner = sarama.NewHashPartitioner
-	kafkaConfig.ChannelBufferSize = configuration.QueueSize / 2
+	keyer, err := newPartitionKeyer(configuration.PartitionKey, configuration.PartitionKeyFields)
+	if err != nil {
+		return nil, err
+	}
+	kafkaConfig := producerConfiguration(configuration, configuration.Version, keyer)
+	kafkaConfig.Producer.Return.Successes = true
 	if err := kafkaConfig.Validate(); err != nil {
 		return nil, fmt.Errorf("cannot validate Kafka configuration: %w", err)
 	}
+	var mirrorConfig *sarama.Config
+	if len(configuration.Mirror.Brokers) > 0 {
+		mirrorConfig = producerConfiguration(configuration, configuration.Mirror.Version, keyer)
+		if err := mirrorConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("cannot validate Kafka mirror configuration: %w", err)
+		}
+	}
+	topics, err := newTopicRouter(configuration.Topic, configuration.TopicTemplate, configuration.ExporterTopics)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := newEncoder(configuration)
+	if err != nil {
+		return nil, err
+	}
+	if configuration.BatchSize > 1 && configuration.Encoding == EncodingAvro {
+		return nil, errors.New("batching flows is not supported with Avro encoding")
+	}
 
 	c := Component{
 		r:      reporter,
 		d:      &dependencies,
 		config: configuration,
+		tracer: reporter.Tracer(),
 
-		kafkaConfig: kafkaConfig,
-		kafkaTopic:  fmt.Sprintf("%s-v%d", configuration.Topic, flow.CurrentSchemaVersion),
+		kafkaConfig:  kafkaConfig,
+		mirrorConfig: mirrorConfig,
+		topics:       topics,
+		keyer:        keyer,
+		encoder:      encoder,
+		breaker:      newCircuitBreaker(configuration.CircuitBreaker),
+		resendQueue:  make(chan resend, configuration.QueueSize),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		c.instance = []byte(hostname)
+	}
+	if configuration.BatchSize > 1 {
+		c.batches.pending = map[batchKey]*batch{}
 	}
 	c.initMetrics()
 	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
-		return sarama.NewAsyncProducer(c.config.Brokers, c.kafkaConfig)
+		client, err := sarama.NewClient(c.config.Brokers, c.kafkaConfig)
+		if err != nil {
+			return nil, err
+		}
+		producer, err := sarama.NewAsyncProducerFromClient(client)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		c.kafkaClient.Store(client)
+		return producer, nil
+	}
+	if mirrorConfig != nil {
+		c.mirrorQueue = make(chan *sarama.ProducerMessage, configuration.Mirror.QueueSize)
+		c.createMirrorProducer = func() (sarama.AsyncProducer, error) {
+			return sarama.NewAsyncProducer(c.config.Mirror.Brokers, c.mirrorConfig)
+		}
 	}
 	c.d.Daemon.Track(&c.t, "inlet/kafka")
+	c.r.RegisterReadinessCheck("kafka", c.readinessCheck)
 	return &c, nil
 }
 
+// producerConfiguration builds the configuration for a Kafka producer.
+func producerConfiguration(configuration Configuration, version kafka.Version, keyer *partitionKeyer) *sarama.Config {
+	kafkaConfig := sarama.NewConfig()
+	kafkaConfig.Version = sarama.KafkaVersion(version)
+	kafkaConfig.Metadata.AllowAutoTopicCreation = true
+	kafkaConfig.Producer.MaxMessageBytes = configuration.MaxMessageBytes
+	kafkaConfig.Producer.Compression = sarama.CompressionCodec(configuration.CompressionCodec)
+	kafkaConfig.Producer.Return.Successes = false
+	kafkaConfig.Producer.Return.Errors = true
+	kafkaConfig.Producer.Flush.Bytes = configuration.FlushBytes
+	kafkaConfig.Producer.Flush.Frequency = configuration.FlushInterval
+	kafkaConfig.Producer.Flush.Messages = configuration.FlushMessages
+	kafkaConfig.Producer.RequiredAcks = sarama.RequiredAcks(configuration.RequiredAcks)
+	kafkaConfig.Producer.Retry.Max = configuration.MaxRetries
+	kafkaConfig.Producer.Retry.Backoff = configuration.RetryBackoff
+	kafkaConfig.Producer.Timeout = configuration.Timeout
+	kafkaConfig.Producer.Partitioner = keyer.Partitioner()
+	if configuration.Idempotent {
+		kafkaConfig.Producer.Idempotent = true
+		kafkaConfig.Producer.RequiredAcks = sarama.WaitForAll
+		kafkaConfig.Net.MaxOpenRequests = 1
+		if kafkaConfig.Producer.Retry.Max == 0 {
+			kafkaConfig.Producer.Retry.Max = 1
+		}
+	}
+	kafkaConfig.ChannelBufferSize = configuration.QueueSize / 2
+	return kafkaConfig
+}
+
 // Start starts the Kafka component.
 func (c *Component) Start() error {
 	c.r.Info().Msg("starting Kafka component")
+
+	// Publish protobuf schema
+	if c.config.Encoding == EncodingProtobuf && c.config.SchemaRegistry.URL != "" {
+		if err := c.registerProtobufSchema(); err != nil {
+			c.r.Err(err).Msg("unable to publish protobuf schema")
+			return fmt.Errorf("unable to publish protobuf schema: %w", err)
+		}
+	}
+	// Register Avro schema
+	if encoder, ok := c.encoder.(*avroEncoder); ok {
+		if err := encoder.register(c.topics.KnownTopics()); err != nil {
+			c.r.Err(err).Msg("unable to register Avro schema")
+			return fmt.Errorf("unable to register Avro schema: %w", err)
+		}
+	}
+
 	kafka.GlobalKafkaLogger.Register(c.r)
 
 	// Create producer
@@ -87,12 +199,10 @@ func (c *Component) Start() error {
 		return fmt.Errorf("unable to create Kafka async producer: %w", err)
 	}
 	c.kafkaProducer = kafkaProducer
+	c.errLogger = c.r.Sample(reporter.BurstSampler(10*time.Second, 3))
 
 	// Main loop
 	c.t.Go(func() error {
-		defer kafkaProducer.Close()
-		defer c.kafkaConfig.MetricRegistry.UnregisterAll()
-		errLogger := c.r.Sample(reporter.BurstSampler(10*time.Second, 3))
 		for {
 			select {
 			case <-c.t.Dying():
@@ -100,14 +210,25 @@ func (c *Component) Start() error {
 				return nil
 			case msg := <-kafkaProducer.Errors():
 				c.metrics.errors.WithLabelValues(msg.Error()).Inc()
-				errLogger.Err(msg.Err).
+				c.errLogger.Err(msg.Err).
 					Str("topic", msg.Msg.Topic).
 					Int64("offset", msg.Msg.Offset).
 					Int32("partition", msg.Msg.Partition).
 					Msg("Kafka producer error")
+				c.handleFailure(msg.Msg)
+			case <-kafkaProducer.Successes():
+				c.handleSuccess()
 			}
 		}
 	})
+	c.t.Go(c.runResender)
+	if c.config.BatchSize > 1 {
+		c.t.Go(c.runBatchFlusher)
+	}
+	c.r.RegisterHealthcheck("kafka", c.breaker.Healthcheck)
+	if c.mirrorQueue != nil {
+		c.t.Go(c.runMirror)
+	}
 	return nil
 }
 
@@ -119,18 +240,155 @@ func (c *Component) Stop() error {
 	}()
 	c.r.Info().Msg("stopping Kafka component")
 	c.t.Kill(nil)
-	return c.t.Wait()
+	err := c.t.Wait()
+	if c.kafkaProducer != nil {
+		c.flushBatches()
+		c.flush()
+		if client, ok := c.kafkaClient.Load().(sarama.Client); ok {
+			client.Close()
+		}
+		c.kafkaConfig.MetricRegistry.UnregisterAll()
+	}
+	return err
+}
+
+// readinessCheck checks the Kafka cluster can be reached by
+// requesting the metadata for the default topic.
+func (c *Component) readinessCheck(ctx context.Context) reporter.HealthcheckResult {
+	client, ok := c.kafkaClient.Load().(sarama.Client)
+	if !ok {
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckError,
+			Reason: "not connected yet",
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- client.RefreshMetadata(c.topics.defaultTopic)
+	}()
+	select {
+	case <-ctx.Done():
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckError,
+			Reason: "timeout while reaching Kafka",
+		}
+	case err := <-done:
+		if err != nil {
+			return reporter.HealthcheckResult{
+				Status: reporter.HealthcheckError,
+				Reason: fmt.Sprintf("cannot reach Kafka: %s", err),
+			}
+		}
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "ok"}
+}
+
+// flush sends the messages waiting to be sent again and closes the
+// producer. It waits for the pending messages to be sent until the
+// flush timeout is reached.
+func (c *Component) flush() {
+	if c.config.FlushTimeout == 0 {
+		c.kafkaProducer.AsyncClose()
+		return
+	}
+	timer := time.NewTimer(c.config.FlushTimeout)
+	defer timer.Stop()
+resend:
+	for {
+		select {
+		case r := <-c.resendQueue:
+			select {
+			case c.kafkaProducer.Input() <- r.msg:
+			case <-timer.C:
+				c.kafkaProducer.AsyncClose()
+				c.r.Warn().Msg("flush timeout reached, some messages may be lost")
+				return
+			}
+		default:
+			break resend
+		}
+	}
+
+	c.kafkaProducer.AsyncClose()
+	errs := c.kafkaProducer.Errors()
+	successes := c.kafkaProducer.Successes()
+	for errs != nil || successes != nil {
+		select {
+		case <-timer.C:
+			c.r.Warn().Msg("flush timeout reached, some messages may be lost")
+			return
+		case msg, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			c.metrics.errors.WithLabelValues(msg.Error()).Inc()
+			c.metrics.failedMessages.Inc()
+		case _, ok := <-successes:
+			if !ok {
+				successes = nil
+			}
+		}
+	}
+}
+
+// Synchronous tells the flow is not referenced once sent: it is
+// encoded before being queued to the producer.
+func (c *Component) Synchronous() bool {
+	return true
+}
+
+// Send a flow to Kafka.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.SendContext(context.Background(), exporter, fl)
 }
 
-// Send a message to Kafka.
-func (c *Component) Send(exporter string, payload []byte) {
-	c.metrics.bytesSent.WithLabelValues(exporter).Add(float64(len(payload)))
-	c.metrics.messagesSent.WithLabelValues(exporter).Inc()
-	key := make([]byte, 4)
-	binary.BigEndian.PutUint32(key, rand.Uint32())
-	c.kafkaProducer.Input() <- &sarama.ProducerMessage{
-		Topic: c.kafkaTopic,
-		Key:   sarama.ByteEncoder(key),
+// SendContext sends a flow to Kafka. If the provided context contains
+// a sampled span, the production of the message is traced.
+func (c *Component) SendContext(ctx context.Context, exporter string, fl *flow.Message) {
+	span := reporter.StartChildSpan(ctx, c.tracer, "kafka produce",
+		trace.WithAttributes(attribute.String("exporter", exporter)))
+	defer span.End()
+	if !c.breaker.Allow() {
+		c.metrics.droppedFlows.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+		span.SetStatus(codes.Error, "circuit breaker open")
+		return
+	}
+	topic, err := c.topics.Topic(fl)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("topic template error").Inc()
+		c.errLogger.Err(err).Str("exporter", exporter).Msg("unable to compute topic")
+	}
+	payload, err := c.encoder.Encode(topic, fl)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("encoding error").Inc()
+		c.errLogger.Err(err).Str("exporter", exporter).Msg("unable to encode flow")
+		span.SetStatus(codes.Error, "cannot encode flow")
+		return
+	}
+	span.SetAttributes(attribute.String("topic", topic))
+	exporterLabel := c.r.ExporterLabel(exporter)
+	c.metrics.bytesSent.WithLabelValues(exporterLabel).Add(float64(len(payload)))
+	c.metrics.messagesSent.WithLabelValues(exporterLabel).Inc()
+	if c.config.BatchSize > 1 {
+		c.addToBatch(topic, exporter, fl, payload)
+		return
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   c.keyer.Key(exporter, fl),
 		Value: sarama.ByteEncoder(payload),
 	}
+	if c.config.Headers {
+		msg.Headers = c.headers(exporter, fl)
+	}
+	c.produce(msg)
+}
+
+// produce sends a message to Kafka and to the mirror cluster.
+func (c *Component) produce(msg *sarama.ProducerMessage) {
+	if c.mirrorQueue != nil {
+		c.mirror(msg)
+	}
+	c.kafkaProducer.Input() <- msg
 }
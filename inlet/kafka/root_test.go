@@ -4,8 +4,10 @@
 package kafka
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"testing"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 
 	"akvorado/common/daemon"
 	"akvorado/common/helpers"
+	"akvorado/common/kafka"
 	"akvorado/common/reporter"
 	"akvorado/inlet/flow"
 )
@@ -23,13 +26,18 @@ func TestKafka(t *testing.T) {
 	c, mockProducer := NewMock(t, r, DefaultConfiguration())
 
 	// Send one message
+	flow1 := &flow.Message{SequenceNum: 1, ExporterName: "hello"}
+	flow2 := &flow.Message{SequenceNum: 2, ExporterName: "goodbye"}
+	payload1, _ := protobufEncoder{}.Encode("", flow1)
+	payload2, _ := protobufEncoder{}.Encode("", flow2)
 	received := make(chan bool)
 	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
 		defer close(received)
 		expected := sarama.ProducerMessage{
 			Topic:     fmt.Sprintf("flows-v%d", flow.CurrentSchemaVersion),
 			Key:       got.Key,
-			Value:     sarama.ByteEncoder("hello world!"),
+			Value:     sarama.ByteEncoder(payload1),
+			Headers:   got.Headers,
 			Partition: got.Partition,
 		}
 		if diff := helpers.Diff(got, expected); diff != "" {
@@ -37,21 +45,22 @@ func TestKafka(t *testing.T) {
 		}
 		return nil
 	})
-	c.Send("127.0.0.1", []byte("hello world!"))
+	c.Send("127.0.0.1", flow1)
 	select {
 	case <-received:
 	case <-time.After(1 * time.Second):
 		t.Fatal("Kafka message not received")
 	}
 
-	// Another but with a fail
+	// Another but with a fail (it is sent again when stopping)
 	mockProducer.ExpectInputAndFail(errors.New("noooo"))
-	c.Send("127.0.0.1", []byte("goodbye world!"))
+	mockProducer.ExpectInputAndSucceed()
+	c.Send("127.0.0.1", flow2)
 
 	time.Sleep(10 * time.Millisecond)
-	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_")
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "sent_", "errors_")
 	expectedMetrics := map[string]string{
-		`sent_bytes_total{exporter="127.0.0.1"}`: "26",
+		`sent_bytes_total{exporter="127.0.0.1"}`: fmt.Sprint(len(payload1) + len(payload2)),
 		fmt.Sprintf(`errors_total{error="kafka: Failed to produce message to topic flows-v%d: noooo"}`, flow.CurrentSchemaVersion): "1",
 		`sent_messages_total{exporter="127.0.0.1"}`: "2",
 	}
@@ -83,23 +92,253 @@ func TestKafkaMetrics(t *testing.T) {
 		Inc(20)
 	gometrics.GetOrRegisterCounter("requests-in-flight-for-broker-1112", c.kafkaConfig.MetricRegistry).
 		Inc(20)
+	gometrics.GetOrRegisterHistogram("batch-size-for-topic-flows-v3", c.kafkaConfig.MetricRegistry,
+		gometrics.NewExpDecaySample(10, 1)).
+		Update(1000)
+	gometrics.GetOrRegisterMeter("record-send-rate-for-topic-flows-v3", c.kafkaConfig.MetricRegistry).
+		Mark(10)
 
-	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_")
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "brokers_", "producer_topic_")
 	expectedMetrics := map[string]string{
-		`brokers_incoming_byte_rate{broker="1111"}`:            "0",
-		`brokers_incoming_byte_rate{broker="1112"}`:            "0",
-		`brokers_outgoing_byte_rate{broker="1111"}`:            "0",
-		`brokers_outgoing_byte_rate{broker="1112"}`:            "0",
-		`brokers_request_size_bucket{broker="1111",le="+Inf"}`: "1",
-		`brokers_request_size_bucket{broker="1111",le="0.5"}`:  "100",
-		`brokers_request_size_bucket{broker="1111",le="0.9"}`:  "100",
-		`brokers_request_size_bucket{broker="1111",le="0.99"}`: "100",
-		`brokers_request_size_count{broker="1111"}`:            "1",
-		`brokers_request_size_sum{broker="1111"}`:              "100",
-		`brokers_inflight_requests{broker="1111"}`:             "20",
-		`brokers_inflight_requests{broker="1112"}`:             "20",
+		`brokers_incoming_byte_rate{broker="1111"}`:                     "0",
+		`brokers_incoming_byte_rate{broker="1112"}`:                     "0",
+		`brokers_outgoing_byte_rate{broker="1111"}`:                     "0",
+		`brokers_outgoing_byte_rate{broker="1112"}`:                     "0",
+		`brokers_request_size_bucket{broker="1111",le="+Inf"}`:          "1",
+		`brokers_request_size_bucket{broker="1111",le="0.5"}`:           "100",
+		`brokers_request_size_bucket{broker="1111",le="0.9"}`:           "100",
+		`brokers_request_size_bucket{broker="1111",le="0.99"}`:          "100",
+		`brokers_request_size_count{broker="1111"}`:                     "1",
+		`brokers_request_size_sum{broker="1111"}`:                       "100",
+		`brokers_inflight_requests{broker="1111"}`:                      "20",
+		`brokers_inflight_requests{broker="1112"}`:                      "20",
+		`producer_topic_batch_bytes_bucket{topic="flows-v3",le="+Inf"}`: "1",
+		`producer_topic_batch_bytes_bucket{topic="flows-v3",le="0.5"}`:  "1000",
+		`producer_topic_batch_bytes_bucket{topic="flows-v3",le="0.9"}`:  "1000",
+		`producer_topic_batch_bytes_bucket{topic="flows-v3",le="0.99"}`: "1000",
+		`producer_topic_batch_bytes_count{topic="flows-v3"}`:            "1",
+		`producer_topic_batch_bytes_sum{topic="flows-v3"}`:              "1000",
+		`producer_topic_record_send_rate{topic="flows-v3"}`:             "0",
 	}
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
 	}
 }
+
+func TestKafkaTopicTemplate(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.TopicTemplate = `{{ if .ExporterTenant }}flows-{{ .ExporterTenant }}{{ end }}`
+	c, mockProducer := NewMock(t, r, configuration)
+
+	cases := []struct {
+		Flow     *flow.Message
+		Expected string
+	}{
+		{&flow.Message{}, "flows"},
+		{&flow.Message{ExporterTenant: "alfred"}, "flows-alfred"},
+		{&flow.Message{ExporterTenant: "batman"}, "flows-batman"},
+	}
+	for _, tc := range cases {
+		received := make(chan bool)
+		mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+			defer close(received)
+			expected := fmt.Sprintf("%s-v%d", tc.Expected, flow.CurrentSchemaVersion)
+			if got.Topic != expected {
+				t.Errorf("Send() topic (-got, +want):\n-%s\n+%s", got.Topic, expected)
+			}
+			return nil
+		})
+		c.Send("127.0.0.1", tc.Flow)
+		select {
+		case <-received:
+		case <-time.After(1 * time.Second):
+			t.Fatal("Kafka message not received")
+		}
+	}
+}
+
+func TestKafkaExporterTopics(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.TopicTemplate = `{{ if .ExporterTenant }}flows-{{ .ExporterTenant }}{{ end }}`
+	configuration.ExporterTopics = helpers.MustNewSubnetMap(map[string]string{
+		"::ffff:192.0.2.0/120": "flows-customer-a",
+	})
+	c, mockProducer := NewMock(t, r, configuration)
+
+	cases := []struct {
+		Flow     *flow.Message
+		Expected string
+	}{
+		{&flow.Message{ExporterAddress: net.ParseIP("192.0.2.10")}, "flows-customer-a"},
+		{&flow.Message{ExporterAddress: net.ParseIP("192.0.2.10"), ExporterTenant: "alfred"}, "flows-customer-a"},
+		{&flow.Message{ExporterAddress: net.ParseIP("198.51.100.10"), ExporterTenant: "alfred"}, "flows-alfred"},
+		{&flow.Message{ExporterAddress: net.ParseIP("198.51.100.10")}, "flows"},
+	}
+	for _, tc := range cases {
+		received := make(chan bool)
+		mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+			defer close(received)
+			expected := fmt.Sprintf("%s-v%d", tc.Expected, flow.CurrentSchemaVersion)
+			if got.Topic != expected {
+				t.Errorf("Send() topic (-got, +want):\n-%s\n+%s", got.Topic, expected)
+			}
+			return nil
+		})
+		c.Send("127.0.0.1", tc.Flow)
+		select {
+		case <-received:
+		case <-time.After(1 * time.Second):
+			t.Fatal("Kafka message not received")
+		}
+	}
+
+	if diff := helpers.Diff(c.topics.KnownTopics(), []string{
+		fmt.Sprintf("flows-v%d", flow.CurrentSchemaVersion),
+		fmt.Sprintf("flows-customer-a-v%d", flow.CurrentSchemaVersion),
+	}); diff != "" {
+		t.Fatalf("KnownTopics() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaInvalidTopicTemplate(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.TopicTemplate = `{{ .ExporterTenant `
+	if _, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestKafkaProducerSettings(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.FlushMessages = 1000
+	configuration.RequiredAcks = RequiredAcks(sarama.WaitForAll)
+	configuration.MaxRetries = 10
+	configuration.RetryBackoff = time.Second
+	configuration.Timeout = 30 * time.Second
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	got := c.kafkaConfig.Producer
+	if got.Flush.Messages != 1000 ||
+		got.RequiredAcks != sarama.WaitForAll ||
+		got.Retry.Max != 10 ||
+		got.Retry.Backoff != time.Second ||
+		got.Timeout != 30*time.Second {
+		t.Fatalf("New() did not apply producer settings: %+v", got)
+	}
+}
+
+func TestKafkaIdempotentProducer(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Idempotent = true
+	configuration.MaxRetries = 0
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	got := c.kafkaConfig
+	if !got.Producer.Idempotent ||
+		got.Producer.RequiredAcks != sarama.WaitForAll ||
+		got.Net.MaxOpenRequests != 1 ||
+		got.Producer.Retry.Max != 1 {
+		t.Fatalf("New() did not configure an idempotent producer: %+v", got)
+	}
+
+	// Idempotent producer needs Kafka 0.11 or more recent.
+	configuration.Version = kafka.Version(sarama.V0_10_2_0)
+	if _, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestKafkaHeaders(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, mockProducer := NewMock(t, r, DefaultConfiguration())
+	c.instance = []byte("inlet1")
+
+	received := make(chan bool)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+		defer close(received)
+		expected := []sarama.RecordHeader{
+			{Key: []byte("akvorado-schema-version"), Value: []byte(fmt.Sprint(flow.CurrentSchemaVersion))},
+			{Key: []byte("akvorado-encoding"), Value: []byte("protobuf")},
+			{Key: []byte("akvorado-exporter"), Value: []byte("127.0.0.1")},
+			{Key: []byte("akvorado-instance"), Value: []byte("inlet1")},
+			{Key: []byte("akvorado-time-received"), Value: []byte("1665000000")},
+		}
+		if diff := helpers.Diff(got.Headers, expected); diff != "" {
+			t.Errorf("Send() headers (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	c.Send("127.0.0.1", &flow.Message{TimeReceived: 1665000000})
+	select {
+	case <-received:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Kafka message not received")
+	}
+}
+
+func TestKafkaWithoutHeaders(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Headers = false
+	c, mockProducer := NewMock(t, r, configuration)
+
+	received := make(chan bool)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+		defer close(received)
+		if len(got.Headers) != 0 {
+			t.Errorf("Send() headers: %v, expected none", got.Headers)
+		}
+		return nil
+	})
+	c.Send("127.0.0.1", &flow.Message{TimeReceived: 1665000000})
+	select {
+	case <-received:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Kafka message not received")
+	}
+}
+
+func TestKafkaReadiness(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	topic := fmt.Sprintf("flows-v%d", flow.CurrentSchemaVersion)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(topic, 0, broker.BrokerID()),
+	})
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Brokers = []string{broker.Addr()}
+	configuration.FlushTimeout = 0
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	got := r.RunReadinessChecks(context.Background())
+	if got.Details["kafka"].Status != reporter.HealthcheckError {
+		t.Fatalf("RunReadinessChecks() == %+v, expected error for kafka", got)
+	}
+
+	helpers.StartStop(t, c)
+	got = r.RunReadinessChecks(context.Background())
+	if got.Details["kafka"].Status != reporter.HealthcheckOK {
+		t.Fatalf("RunReadinessChecks() == %+v, expected ok for kafka", got)
+	}
+
+	broker.Close()
+	got = r.RunReadinessChecks(context.Background())
+	if got.Details["kafka"].Status != reporter.HealthcheckError {
+		t.Fatalf("RunReadinessChecks() == %+v, expected error for kafka", got)
+	}
+}
@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"akvorado/inlet/flow"
+)
+
+// SchemaRegistryConfiguration describes how to contact a
+// Confluent-compatible schema registry.
+type SchemaRegistryConfiguration struct {
+	// URL is the base URL of the schema registry.
+	URL string `validate:"omitempty,url"`
+	// Username is the username for basic authentication.
+	Username string
+	// Password is the password for basic authentication. It can be
+	// a reference to a secret.
+	Password string
+	// Timeout is the timeout for requests to the schema registry.
+	Timeout time.Duration `validate:"min=0"`
+}
+
+// schemaRegistry is a minimal client for a schema registry. It
+// caches the IDs of registered schemas.
+type schemaRegistry struct {
+	config SchemaRegistryConfiguration
+	client *http.Client
+	ids    map[string]uint32
+	lock   sync.Mutex
+}
+
+func newSchemaRegistry(config SchemaRegistryConfiguration) *schemaRegistry {
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	return &schemaRegistry{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+		ids:    map[string]uint32{},
+	}
+}
+
+// Register registers a schema for the provided subject and returns
+// its ID. Results are cached, including the ones for other schemas
+// registered under the same subject.
+func (sr *schemaRegistry) Register(subject, schemaType, schema string) (uint32, error) {
+	key := fmt.Sprintf("%s\x00%s", subject, schema)
+	sr.lock.Lock()
+	defer sr.lock.Unlock()
+	if id, ok := sr.ids[key]; ok {
+		return id, nil
+	}
+
+	request := struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType,omitempty"`
+	}{schema, schemaType}
+	var response struct {
+		ID uint32 `json:"id"`
+	}
+	url := fmt.Sprintf("%s/subjects/%s/versions",
+		strings.TrimRight(sr.config.URL, "/"), subject)
+	if err := sr.do(http.MethodPost, url, request, &response); err != nil {
+		return 0, fmt.Errorf("cannot register schema for %q: %w", subject, err)
+	}
+	sr.ids[key] = response.ID
+	return response.ID, nil
+}
+
+// do executes a request against the schema registry.
+func (sr *schemaRegistry) do(method, url string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if sr.config.Username != "" {
+		req.SetBasicAuth(sr.config.Username, sr.config.Password)
+	}
+	resp, err := sr.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		answer := schemaRegistryError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(&answer)
+		return answer
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// schemaRegistryError is an error returned by the schema registry.
+type schemaRegistryError struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (err schemaRegistryError) Error() string {
+	if err.Message != "" {
+		return fmt.Sprintf("schema registry error %d: %s", err.ErrorCode, err.Message)
+	}
+	return fmt.Sprintf("unexpected status code %d", err.StatusCode)
+}
+
+// CheckCompatibility tells if a schema is compatible with the latest
+// version registered for the provided subject. A subject without any
+// version is compatible with any schema.
+func (sr *schemaRegistry) CheckCompatibility(subject, schemaType, schema string) (bool, error) {
+	request := struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType,omitempty"`
+	}{schema, schemaType}
+	var response struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	url := fmt.Sprintf("%s/compatibility/subjects/%s/versions/latest",
+		strings.TrimRight(sr.config.URL, "/"), subject)
+	if err := sr.do(http.MethodPost, url, request, &response); err != nil {
+		var srErr schemaRegistryError
+		if errors.As(err, &srErr) && srErr.StatusCode == http.StatusNotFound {
+			return true, nil
+		}
+		return false, fmt.Errorf("cannot check schema compatibility for %q: %w", subject, err)
+	}
+	return response.IsCompatible, nil
+}
+
+// registerProtobufSchema registers the protobuf schema of the flows
+// with the schema registry, using the subject matching the default
+// topic. It fails if the schema is not compatible with the one
+// already registered.
+func (c *Component) registerProtobufSchema() error {
+	var customFields []flow.CustomField
+	if c.d.Flow != nil {
+		customFields = c.d.Flow.CustomFields()
+	}
+	schema := flow.SchemasWithCustomFields(customFields)[flow.CurrentSchemaVersion]
+	subject := fmt.Sprintf("%s-value", c.topics.defaultTopic)
+	registry := newSchemaRegistry(c.config.SchemaRegistry)
+	compatible, err := registry.CheckCompatibility(subject, "PROTOBUF", schema)
+	if err != nil {
+		return err
+	}
+	if !compatible {
+		return fmt.Errorf("protobuf schema is not compatible with the one registered for %q", subject)
+	}
+	id, err := registry.Register(subject, "PROTOBUF", schema)
+	if err != nil {
+		return err
+	}
+	c.r.Info().Str("subject", subject).Uint32("id", id).Msg("protobuf schema registered")
+	return nil
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/flow"
+)
+
+// topicRouter computes the topic to use for each flow.
+type topicRouter struct {
+	defaultTopic   string
+	template       *template.Template
+	exporterTopics *helpers.SubnetMap[string]
+	buffers        sync.Pool
+}
+
+// newTopicRouter creates a new topic router from the base topic, an
+// optional template and optional topics per exporter subnet.
+func newTopicRouter(topic string, tmpl string, exporterTopics *helpers.SubnetMap[string]) (*topicRouter, error) {
+	tr := &topicRouter{
+		defaultTopic:   versionedTopic(topic),
+		exporterTopics: exporterTopics,
+		buffers: sync.Pool{
+			New: func() any { return new(bytes.Buffer) },
+		},
+	}
+	if tmpl == "" {
+		return tr, nil
+	}
+	t, err := template.New("topic").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse topic template: %w", err)
+	}
+	tr.template = t
+	return tr, nil
+}
+
+// Topic returns the topic to use for the provided flow. The topic of
+// the exporter is used first. When the template renders to an empty
+// string, the default topic is used.
+func (tr *topicRouter) Topic(fl *flow.Message) (string, error) {
+	if fl != nil {
+		if exporterIP, ok := netip.AddrFromSlice(fl.ExporterAddress); ok {
+			if topic, ok := tr.exporterTopics.Lookup(exporterIP); ok && topic != "" {
+				return versionedTopic(topic), nil
+			}
+		}
+	}
+	if tr.template == nil || fl == nil {
+		return tr.defaultTopic, nil
+	}
+	buf := tr.buffers.Get().(*bytes.Buffer)
+	defer tr.buffers.Put(buf)
+	buf.Reset()
+	if err := tr.template.Execute(buf, fl); err != nil {
+		return tr.defaultTopic, err
+	}
+	topic := strings.TrimSpace(buf.String())
+	if topic == "" {
+		return tr.defaultTopic, nil
+	}
+	return versionedTopic(topic), nil
+}
+
+// KnownTopics returns the topics known without looking at the flows:
+// the default topic and the topics of the exporters. Topics from the
+// template are not included.
+func (tr *topicRouter) KnownTopics() []string {
+	topics := []string{tr.defaultTopic}
+	if tr.exporterTopics == nil {
+		return topics
+	}
+	others := []string{}
+	seen := map[string]bool{tr.defaultTopic: true}
+	for _, topic := range tr.exporterTopics.ToMap() {
+		if topic == "" {
+			continue
+		}
+		topic = versionedTopic(topic)
+		if !seen[topic] {
+			seen[topic] = true
+			others = append(others, topic)
+		}
+	}
+	sort.Strings(others)
+	return append(topics, others...)
+}
+
+// versionedTopic appends the schema version to the provided topic.
+func versionedTopic(topic string) string {
+	return fmt.Sprintf("%s-v%d", topic, flow.CurrentSchemaVersion)
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package nats
+
+import "time"
+
+// Configuration describes the configuration for the NATS output.
+type Configuration struct {
+	// URL is the URL of the NATS server, like nats://127.0.0.1:4222.
+	// Credentials can be provided in the URL.
+	URL string `validate:"required,url"`
+	// Username is the username to authenticate with.
+	Username string
+	// Password is the password to authenticate with. It can be a
+	// reference to a secret.
+	Password string
+	// Token is the token to authenticate with. It can be a reference
+	// to a secret.
+	Token string
+	// TLS defines the TLS configuration to connect to the server.
+	TLS TLSConfiguration
+	// Subject is the subject to publish flows to. The schema
+	// version is appended to it.
+	Subject string `validate:"required"`
+	// SubjectTemplate is a Go template over flow fields to compute
+	// the subject to publish a flow to. When empty, the configured
+	// subject is used.
+	SubjectTemplate string
+	// JetStream tells to wait for an acknowledgement from JetStream
+	// for each published flow.
+	JetStream bool
+	// MaxPending is the maximum number of flows waiting for an
+	// acknowledgement. When reached, the inlet stops processing
+	// flows.
+	MaxPending int `validate:"min=1"`
+	// AckTimeout is the time to wait for an acknowledgement before
+	// publishing a flow again.
+	AckTimeout time.Duration `validate:"min=100ms"`
+	// MaxRetries is the number of times a flow is published again
+	// when not acknowledged.
+	MaxRetries int `validate:"min=0"`
+	// QueueSize is the number of flows waiting to be published.
+	QueueSize int `validate:"min=0"`
+	// ConnectTimeout is the timeout to connect to the server.
+	ConnectTimeout time.Duration `validate:"min=100ms"`
+	// ReconnectDelay is the time to wait before reconnecting after
+	// an error.
+	ReconnectDelay time.Duration `validate:"min=0"`
+}
+
+// TLSConfiguration defines TLS configuration to connect to the
+// server. TLS is also enabled when the URL uses the tls:// scheme.
+type TLSConfiguration struct {
+	// Enable says if TLS should be used to connect to the server
+	Enable bool
+	// SkipVerify removes validation of the server certificate
+	SkipVerify bool
+	// CAFile tells the location of the CA certificate to check the
+	// server certificate. When empty, the system CAs are used.
+	CAFile string
+	// CertFile tells the location of the user certificate, if any.
+	CertFile string `validate:"required_with=KeyFile"`
+	// KeyFile tells the location of the user key, if any.
+	KeyFile string `validate:"required_with=CertFile"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// NATS output.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		URL:            "nats://127.0.0.1:4222",
+		Subject:        "akvorado.flows",
+		JetStream:      true,
+		MaxPending:     1000,
+		AckTimeout:     5 * time.Second,
+		MaxRetries:     3,
+		QueueSize:      10000,
+		ConnectTimeout: 5 * time.Second,
+		ReconnectDelay: time.Second,
+	}
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package nats
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestDefaultConfiguration(t *testing.T) {
+	if err := helpers.Validate.Struct(DefaultConfiguration()); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
+
+func TestCertFileRequiresKeyFile(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.TLS.Enable = true
+	configuration.TLS.CertFile = "/etc/akvorado/nats.pem"
+	if err := helpers.Validate.Struct(configuration); err == nil {
+		t.Fatal("validate.Struct() did not error")
+	}
+	configuration.TLS.KeyFile = "/etc/akvorado/nats.key"
+	if err := helpers.Validate.Struct(configuration); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
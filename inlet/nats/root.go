@@ -0,0 +1,424 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package nats provides an output publishing flows to NATS, optionally
+// waiting for acknowledgements from JetStream.
+package nats
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the NATS output.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	conn           *nats.Conn
+	js             jetstream.JetStream
+	queue          chan *flow.Message
+	acks           chan ack
+	subject        string
+	template       *template.Template
+	templateBuffer bytes.Buffer
+	buffer         []byte
+	nextID         uint64
+	pending        map[uint64]*pendingMessage
+	pendingCount   int64
+	errLogger      reporter.Logger
+	metrics        struct {
+		flowsReceived *reporter.CounterVec
+		published     reporter.Counter
+		acked         reporter.Counter
+		dropped       reporter.Counter
+		retries       reporter.Counter
+		pending       reporter.GaugeFunc
+		errors        *reporter.CounterVec
+	}
+}
+
+// Dependencies define the dependencies of the NATS output.
+type Dependencies struct {
+	Daemon daemon.Component
+}
+
+// pendingMessage is a message waiting for an acknowledgement. done
+// is closed when the message is not waited for anymore.
+type pendingMessage struct {
+	msg      *nats.Msg
+	attempts int
+	deadline time.Time
+	done     chan struct{}
+}
+
+// ack is the outcome of publishing a message to JetStream.
+type ack struct {
+	id   uint64
+	done chan struct{}
+	err  error
+}
+
+// New creates a new NATS output.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	var err error
+	if configuration.Password, err = helpers.ResolveSecret(configuration.Password); err != nil {
+		return nil, fmt.Errorf("cannot resolve password: %w", err)
+	}
+	if configuration.Token, err = helpers.ResolveSecret(configuration.Token); err != nil {
+		return nil, fmt.Errorf("cannot resolve token: %w", err)
+	}
+	c := Component{
+		r:         r,
+		d:         &dependencies,
+		config:    configuration,
+		queue:     make(chan *flow.Message, configuration.QueueSize),
+		acks:      make(chan ack),
+		subject:   versionedSubject(configuration.Subject),
+		pending:   map[uint64]*pendingMessage{},
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+	}
+	if !validSubject(c.subject) {
+		return nil, fmt.Errorf("invalid subject %q", configuration.Subject)
+	}
+	if configuration.SubjectTemplate != "" {
+		t, err := template.New("subject").Option("missingkey=error").Parse(configuration.SubjectTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse subject template: %w", err)
+		}
+		c.template = t
+	}
+	c.d.Daemon.Track(&c.t, "inlet/nats")
+	c.metrics.flowsReceived = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_received_total",
+			Help: "Number of flows received from a given exporter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.published = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "messages_published_total",
+			Help: "Number of messages published, including retries.",
+		},
+	)
+	c.metrics.acked = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "messages_acked_total",
+			Help: "Number of messages acknowledged by JetStream.",
+		},
+	)
+	c.metrics.dropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "messages_dropped_total",
+			Help: "Number of messages dropped after failing to publish them.",
+		},
+	)
+	c.metrics.retries = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "retries_total",
+			Help: "Number of times a message was published again.",
+		},
+	)
+	c.metrics.pending = c.r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "pending_acks",
+			Help: "Number of messages waiting for an acknowledgement.",
+		},
+		func() float64 {
+			return float64(atomic.LoadInt64(&c.pendingCount))
+		},
+	)
+	c.metrics.errors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of errors when publishing flows.",
+		},
+		[]string{"error"},
+	)
+	return &c, nil
+}
+
+// Start starts the NATS output.
+func (c *Component) Start() error {
+	c.r.Info().Str("url", c.config.URL).Msg("starting NATS output")
+	conn, err := nats.Connect(c.config.URL, c.options()...)
+	if err != nil {
+		return fmt.Errorf("cannot connect to NATS server: %w", err)
+	}
+	c.conn = conn
+	if c.config.JetStream {
+		c.js, err = jetstream.New(conn)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("cannot create JetStream context: %w", err)
+		}
+	}
+	c.t.Go(c.run)
+	return nil
+}
+
+// Stop stops the NATS output. Queued flows are published and
+// acknowledgements are waited for, up to the acknowledgement timeout.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("NATS output stopped")
+	c.r.Info().Msg("stopping NATS output")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// Send queues a flow to be published. It blocks when the queue is
+// full.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.metrics.flowsReceived.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+	select {
+	case c.queue <- fl:
+	case <-c.t.Dying():
+	}
+}
+
+// options returns the options to connect to the NATS server. The
+// client reconnects on its own, including when the server cannot be
+// reached on start.
+func (c *Component) options() []nats.Option {
+	options := []nats.Option{
+		nats.Name("akvorado-inlet"),
+		nats.Timeout(c.config.ConnectTimeout),
+		nats.ReconnectWait(c.config.ReconnectDelay),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				c.metrics.errors.WithLabelValues("connection lost").Inc()
+				c.errLogger.Err(err).Str("url", c.config.URL).Msg("connection to NATS server lost")
+			}
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			c.metrics.errors.WithLabelValues("async error").Inc()
+			c.errLogger.Err(err).Str("url", c.config.URL).Msg("error from NATS server")
+		}),
+	}
+	if c.config.Username != "" {
+		options = append(options, nats.UserInfo(c.config.Username, c.config.Password))
+	}
+	if c.config.Token != "" {
+		options = append(options, nats.Token(c.config.Token))
+	}
+	if c.config.TLS.Enable {
+		options = append(options, nats.Secure(&tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: c.config.TLS.SkipVerify,
+		}))
+		if c.config.TLS.CAFile != "" {
+			options = append(options, nats.RootCAs(c.config.TLS.CAFile))
+		}
+		if c.config.TLS.CertFile != "" {
+			options = append(options, nats.ClientCert(c.config.TLS.CertFile, c.config.TLS.KeyFile))
+		}
+	}
+	return options
+}
+
+// run publishes flows until the component is stopped.
+func (c *Component) run() error {
+	defer c.conn.Close()
+	ticker := time.NewTicker(c.config.AckTimeout / 10)
+	defer ticker.Stop()
+	dying := c.t.Dying()
+	var stopping <-chan time.Time
+	for {
+		atomic.StoreInt64(&c.pendingCount, int64(len(c.pending)))
+		queue := c.queue
+		if dying == nil || len(c.pending) >= c.config.MaxPending {
+			queue = nil
+		}
+		select {
+		case <-dying:
+			// Publish queued flows and wait for their
+			// acknowledgements.
+			for len(c.queue) > 0 {
+				c.publish(<-c.queue)
+			}
+			if !c.config.JetStream {
+				if err := c.conn.FlushTimeout(c.config.AckTimeout); err != nil {
+					c.errLogger.Err(err).Msg("unable to flush flows to NATS server")
+				}
+				return nil
+			}
+			if len(c.pending) == 0 {
+				return nil
+			}
+			dying = nil
+			stopping = time.After(c.config.AckTimeout)
+		case <-stopping:
+			c.metrics.dropped.Add(float64(len(c.pending)))
+			for id, pm := range c.pending {
+				close(pm.done)
+				delete(c.pending, id)
+			}
+			atomic.StoreInt64(&c.pendingCount, 0)
+			return nil
+		case fl := <-queue:
+			c.publish(fl)
+		case a := <-c.acks:
+			c.acknowledge(a)
+			if stopping != nil && len(c.pending) == 0 {
+				return nil
+			}
+		case now := <-ticker.C:
+			for id, pm := range c.pending {
+				if now.After(pm.deadline) {
+					c.metrics.errors.WithLabelValues("ack timeout").Inc()
+					c.retry(id, pm)
+				}
+			}
+		}
+	}
+}
+
+// publish encodes and publishes a flow.
+func (c *Component) publish(fl *flow.Message) {
+	c.buffer = fl.AppendDelimited(c.buffer[:0])
+	subject := c.subjectFor(fl)
+	if !c.config.JetStream {
+		// The payload is copied by the client.
+		c.metrics.published.Inc()
+		if err := c.conn.Publish(subject, c.buffer); err != nil {
+			c.metrics.errors.WithLabelValues("cannot publish").Inc()
+			c.metrics.dropped.Inc()
+			c.errLogger.Err(err).Str("subject", subject).Msg("unable to publish flow")
+		}
+		return
+	}
+	c.nextID++
+	pm := &pendingMessage{
+		// The payload is kept until acknowledged, copy it with its
+		// exact size.
+		msg: &nats.Msg{
+			Subject: subject,
+			Data:    append([]byte(nil), c.buffer...),
+		},
+	}
+	c.pending[c.nextID] = pm
+	c.send(c.nextID, pm)
+}
+
+// send publishes a pending message to JetStream. The outcome is sent
+// to the acks channel, unless the message is not waited for anymore.
+// When the message cannot be published, it is published again once
+// the acknowledgement timeout expires.
+func (c *Component) send(id uint64, pm *pendingMessage) {
+	pm.deadline = time.Now().Add(c.config.AckTimeout)
+	pm.done = make(chan struct{})
+	c.metrics.published.Inc()
+	future, err := c.js.PublishMsgAsync(pm.msg)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("cannot publish").Inc()
+		c.errLogger.Err(err).Str("subject", pm.msg.Subject).Msg("unable to publish flow")
+		return
+	}
+	done := pm.done
+	go func() {
+		var err error
+		select {
+		case <-future.Ok():
+		case err = <-future.Err():
+		case <-done:
+			return
+		}
+		select {
+		case c.acks <- ack{id: id, done: done, err: err}:
+		case <-done:
+		}
+	}()
+}
+
+// acknowledge handles the outcome of publishing a message to
+// JetStream.
+func (c *Component) acknowledge(a ack) {
+	pm, ok := c.pending[a.id]
+	if !ok || pm.done != a.done {
+		// Already acknowledged or published again
+		return
+	}
+	if a.err == nil {
+		close(pm.done)
+		delete(c.pending, a.id)
+		c.metrics.acked.Inc()
+		return
+	}
+	c.metrics.errors.WithLabelValues("ack error").Inc()
+	c.errLogger.Err(a.err).Str("subject", pm.msg.Subject).Msg("message not acknowledged")
+	c.retry(a.id, pm)
+}
+
+// retry publishes a message again or drops it if it was retried too
+// many times.
+func (c *Component) retry(id uint64, pm *pendingMessage) {
+	close(pm.done)
+	if pm.attempts >= c.config.MaxRetries {
+		delete(c.pending, id)
+		c.metrics.dropped.Inc()
+		return
+	}
+	pm.attempts++
+	c.metrics.retries.Inc()
+	c.send(id, pm)
+}
+
+// subjectFor returns the subject to publish the provided flow to. When
+// the template renders to an empty or invalid subject, the default
+// subject is used.
+func (c *Component) subjectFor(fl *flow.Message) string {
+	if c.template == nil {
+		return c.subject
+	}
+	c.templateBuffer.Reset()
+	if err := c.template.Execute(&c.templateBuffer, fl); err != nil {
+		c.metrics.errors.WithLabelValues("subject template error").Inc()
+		c.errLogger.Err(err).Msg("unable to compute subject")
+		return c.subject
+	}
+	subject := strings.TrimSpace(c.templateBuffer.String())
+	if subject == "" {
+		return c.subject
+	}
+	subject = versionedSubject(subject)
+	if !validSubject(subject) {
+		c.metrics.errors.WithLabelValues("invalid subject").Inc()
+		return c.subject
+	}
+	return subject
+}
+
+// versionedSubject appends the schema version to the provided subject.
+func versionedSubject(subject string) string {
+	return fmt.Sprintf("%s.v%d", subject, flow.CurrentSchemaVersion)
+}
+
+// validSubject tells if a subject can be published to.
+func validSubject(subject string) bool {
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" || token == "*" || token == ">" ||
+			strings.ContainsAny(token, " \t\r\n") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,324 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package nats
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+// testServer is a minimal NATS server acknowledging published
+// messages. It answers with the provided replies (an empty reply is an
+// acknowledgement) and closes the connection on "close".
+type testServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	lock     sync.Mutex
+	replies  []string
+	connects []string
+	received chan testMessage
+}
+
+type testMessage struct {
+	subject string
+	payload []byte
+}
+
+func newTestServer(t *testing.T, replies ...string) *testServer {
+	t.Helper()
+	return newTLSTestServer(t, nil, replies...)
+}
+
+// newTLSTestServer creates a test server requiring TLS when a TLS
+// configuration is provided.
+func newTLSTestServer(t *testing.T, config *tls.Config, replies ...string) *testServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error:\n%+v", err)
+	}
+	ts := &testServer{
+		listener: listener,
+		tls:      config,
+		replies:  replies,
+		received: make(chan testMessage, 100),
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go ts.serve(conn)
+		}
+	}()
+	return ts
+}
+
+func (ts *testServer) URL() string {
+	return fmt.Sprintf("nats://%s", ts.listener.Addr())
+}
+
+func (ts *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	if ts.tls == nil {
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+	} else {
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"proto\":1,\"headers\":true,\"max_payload\":1048576,\"tls_required\":true}\r\n")
+		conn = tls.Server(conn, ts.tls)
+		defer conn.Close()
+	}
+	reader := bufio.NewReader(conn)
+	subscriptions := map[string]string{}
+	seq := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		switch args[0] {
+		case "CONNECT":
+			ts.lock.Lock()
+			ts.connects = append(ts.connects, args[1])
+			ts.lock.Unlock()
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "SUB":
+			subscriptions[strings.TrimSuffix(args[1], "*")] = args[len(args)-1]
+		case "PUB":
+			size, _ := strconv.Atoi(args[len(args)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			ts.received <- testMessage{args[1], payload[:size]}
+			if len(args) != 4 {
+				continue
+			}
+			sid := subscriptions[args[2][:strings.LastIndex(args[2], ".")+1]]
+			ts.lock.Lock()
+			reply := ""
+			if len(ts.replies) > 0 {
+				reply, ts.replies = ts.replies[0], ts.replies[1:]
+			}
+			ts.lock.Unlock()
+			switch reply {
+			case "close":
+				return
+			case "timeout":
+			case "":
+				seq++
+				reply = fmt.Sprintf(`{"stream":"FLOWS","seq":%d}`, seq)
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", args[2], sid, len(reply), reply)
+			default:
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", args[2], sid, len(reply), reply)
+			}
+		}
+	}
+}
+
+func (ts *testServer) wait(t *testing.T, n int) []testMessage {
+	t.Helper()
+	messages := []testMessage{}
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-ts.received:
+			messages = append(messages, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("NATS message %d not received", i+1)
+		}
+	}
+	return messages
+}
+
+func newTestComponent(t *testing.T, configuration Configuration) (*reporter.Reporter, *Component) {
+	t.Helper()
+	r := reporter.NewMock(t)
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+	return r, c
+}
+
+func waitAcked(t *testing.T, r *reporter.Reporter, expected string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if r.GetMetrics("akvorado_inlet_nats_", "messages_acked")["messages_acked_total"] == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("messages_acked_total != %s", expected)
+}
+
+func TestPublish(t *testing.T) {
+	ts := newTestServer(t)
+	configuration := DefaultConfiguration()
+	configuration.URL = ts.URL()
+	configuration.Token = "secret"
+	configuration.SubjectTemplate = `{{ if .ExporterName }}akvorado.{{ .ExporterName }}{{ end }}`
+	r, c := newTestComponent(t, configuration)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1, ExporterName: "edge1"})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 3, ExporterName: "edge 2"})
+	messages := ts.wait(t, 3)
+	waitAcked(t, r, "3")
+
+	got := []string{}
+	for _, msg := range messages {
+		var fl flow.Message
+		if err := proto.NewBuffer(msg.payload).DecodeMessage(&fl); err != nil {
+			t.Fatalf("DecodeMessage() error:\n%+v", err)
+		}
+		got = append(got, fmt.Sprintf("%s %d", msg.subject, fl.SequenceNum))
+	}
+	expected := []string{
+		"akvorado.edge1.v3 1",
+		"akvorado.flows.v3 2",
+		"akvorado.flows.v3 3",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Publish() (-got, +want):\n%s", diff)
+	}
+	if !strings.Contains(ts.connects[0], `"auth_token":"secret"`) {
+		t.Fatalf("CONNECT %s does not contain token", ts.connects[0])
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_nats_", "messages_", "errors_")
+	expectedMetrics := map[string]string{
+		`messages_published_total`:              "3",
+		`messages_acked_total`:                  "3",
+		`messages_dropped_total`:                "0",
+		`errors_total{error="invalid subject"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestAckErrors(t *testing.T) {
+	ts := newTestServer(t,
+		`{"error":{"code":503,"description":"insufficient resources"}}`,
+		"timeout",
+		"",
+		"close",
+	)
+	configuration := DefaultConfiguration()
+	configuration.URL = ts.URL()
+	configuration.AckTimeout = 100 * time.Millisecond
+	configuration.ReconnectDelay = 10 * time.Millisecond
+	r, c := newTestComponent(t, configuration)
+
+	// Rejected, timed out, then acknowledged
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	ts.wait(t, 3)
+	waitAcked(t, r, "1")
+	// Connection closed, then published again after the
+	// acknowledgement timeout
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+	ts.wait(t, 2)
+	waitAcked(t, r, "2")
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_nats_", "messages_", "retries_", "errors_")
+	expectedMetrics := map[string]string{
+		`messages_published_total`:              "5",
+		`messages_acked_total`:                  "2",
+		`messages_dropped_total`:                "0",
+		`retries_total`:                         "3",
+		`errors_total{error="ack error"}`:       "1",
+		`errors_total{error="ack timeout"}`:     "2",
+		`errors_total{error="connection lost"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestCoreNATS(t *testing.T) {
+	ts := newTestServer(t)
+	configuration := DefaultConfiguration()
+	configuration.URL = ts.URL()
+	configuration.JetStream = false
+	r, c := newTestComponent(t, configuration)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	ts.wait(t, 1)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_nats_", "messages_published", "pending")
+	expectedMetrics := map[string]string{
+		`messages_published_total`: "1",
+		`pending_acks`:             "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	// Reuse the certificate of a TLS HTTP test server.
+	server := httptest.NewTLSServer(nil)
+	server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o644); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+
+	ts := newTLSTestServer(t, server.TLS)
+	configuration := DefaultConfiguration()
+	configuration.URL = ts.URL()
+	configuration.TLS.Enable = true
+	configuration.TLS.CAFile = caFile
+	r, c := newTestComponent(t, configuration)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	ts.wait(t, 1)
+	waitAcked(t, r, "1")
+}
+
+func TestInvalidCAFile(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.TLS.Enable = true
+	configuration.TLS.CAFile = filepath.Join(t.TempDir(), "ca.pem")
+	c, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err == nil {
+		c.Stop()
+		t.Fatal("Start() did not error")
+	}
+}
+
+func TestInvalidSubject(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.Subject = "akvorado.>"
+	if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//go:build !release
+
+package parquet
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/apache/arrow/go/v10/parquet"
+	"github.com/apache/arrow/go/v10/parquet/file"
+)
+
+// ReadColumn returns the values of a column from a Parquet file,
+// formatted as strings, for each row. Nested columns are designated
+// with a dotted path. It is only used for testing.
+func ReadColumn(t *testing.T, content []byte, path string) [][]string {
+	t.Helper()
+	reader, err := file.NewParquetReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("NewParquetReader() error:\n%+v", err)
+	}
+	defer reader.Close()
+	idx := reader.MetaData().Schema.ColumnIndexByName(path)
+	if idx < 0 {
+		t.Fatalf("column %q not found", path)
+	}
+	maxDef := reader.MetaData().Schema.Column(idx).MaxDefinitionLevel()
+	result := [][]string{}
+	for i := 0; i < reader.NumRowGroups(); i++ {
+		rg := reader.RowGroup(i)
+		chunk, err := rg.MetaData().ColumnChunk(idx)
+		if err != nil {
+			t.Fatalf("ColumnChunk() error:\n%+v", err)
+		}
+		n := chunk.NumValues()
+		cr, err := rg.Column(idx)
+		if err != nil {
+			t.Fatalf("Column() error:\n%+v", err)
+		}
+		defLevels := make([]int16, n)
+		repLevels := make([]int16, n)
+		values := []string{}
+		var total int64
+		var read int
+		switch r := cr.(type) {
+		case *file.BooleanColumnChunkReader:
+			v := make([]bool, n)
+			total, read, err = r.ReadBatch(n, v, defLevels, repLevels)
+			for _, x := range v[:read] {
+				values = append(values, fmt.Sprint(x))
+			}
+		case *file.Int32ColumnChunkReader:
+			v := make([]int32, n)
+			total, read, err = r.ReadBatch(n, v, defLevels, repLevels)
+			for _, x := range v[:read] {
+				values = append(values, fmt.Sprint(x))
+			}
+		case *file.Int64ColumnChunkReader:
+			v := make([]int64, n)
+			total, read, err = r.ReadBatch(n, v, defLevels, repLevels)
+			for _, x := range v[:read] {
+				values = append(values, fmt.Sprint(x))
+			}
+		case *file.ByteArrayColumnChunkReader:
+			v := make([]parquet.ByteArray, n)
+			total, read, err = r.ReadBatch(n, v, defLevels, repLevels)
+			for _, x := range v[:read] {
+				values = append(values, x.String())
+			}
+		default:
+			t.Fatalf("unsupported column reader %T", cr)
+		}
+		if err != nil {
+			t.Fatalf("ReadBatch() error:\n%+v", err)
+		}
+		if total != n {
+			t.Fatalf("ReadBatch() read %d levels instead of %d", total, n)
+		}
+		for j := range defLevels {
+			if repLevels[j] == 0 {
+				result = append(result, []string{})
+			}
+			if maxDef == 0 || defLevels[j] == maxDef {
+				result[len(result)-1] = append(result[len(result)-1], values[0])
+				values = values[1:]
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,307 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package parquet writes flows to Parquet files using the Apache
+// Arrow implementation of the format.
+package parquet
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow/go/v10/parquet"
+	"github.com/apache/arrow/go/v10/parquet/compress"
+	"github.com/apache/arrow/go/v10/parquet/file"
+	"github.com/apache/arrow/go/v10/parquet/schema"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"akvorado/inlet/flow"
+)
+
+// Writer writes flows to a Parquet file. The schema is derived
+// from the protobuf definition: scalar fields are required columns,
+// repeated fields are repeated columns and messages are optional
+// groups. Rows are buffered in memory and written as a row group
+// once rowGroupSize flows have been received.
+type Writer struct {
+	writer       *file.Writer
+	columns      []*column
+	rows         int
+	rowGroupSize int
+}
+
+// column buffers the values of a leaf column for the current row group.
+type column struct {
+	fields    []protoreflect.FieldDescriptor
+	maxRep    int16
+	defLevels []int16
+	repLevels []int16
+	values    []protoreflect.Value
+}
+
+// nopCloser prevents the Parquet writer from closing the underlying
+// writer.
+type nopCloser struct {
+	io.Writer
+}
+
+// NewWriter creates a new Parquet writer. The magic header is
+// written immediately.
+func NewWriter(w io.Writer, compress bool, rowGroupSize int) (*Writer, error) {
+	pw := &Writer{rowGroupSize: rowGroupSize}
+	fields := schema.FieldList{}
+	md := (&flow.Message{}).ProtoReflect().Descriptor().Fields()
+	for i := 0; i < md.Len(); i++ {
+		node, err := pw.addField(nil, md.Get(i), 0)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, node)
+	}
+	root, err := schema.NewGroupNode("akvorado", parquet.Repetitions.Required, fields, -1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build Parquet schema: %w", err)
+	}
+	props := parquet.NewWriterProperties(
+		parquet.WithCompression(codec(compress)),
+		parquet.WithCreatedBy("akvorado"))
+	pw.writer = file.NewParquetWriter(nopCloser{w}, root, file.WithWriterProps(props))
+	return pw, nil
+}
+
+// codec returns the compression codec to use for the columns.
+func codec(compressed bool) compress.Compression {
+	if compressed {
+		return compress.Codecs.Gzip
+	}
+	return compress.Codecs.Uncompressed
+}
+
+// addField converts a protobuf field to a Parquet node and registers
+// the matching leaf columns.
+func (pw *Writer) addField(fields []protoreflect.FieldDescriptor, fd protoreflect.FieldDescriptor, rep int16) (schema.Node, error) {
+	fields = append(fields[:len(fields):len(fields)], fd)
+	name := string(fd.Name())
+	if fd.Kind() == protoreflect.MessageKind {
+		if fd.IsList() || fd.IsMap() || len(fields) > 1 {
+			return nil, fmt.Errorf("unsupported nested field %s for Parquet", fd.FullName())
+		}
+		children := schema.FieldList{}
+		subfields := fd.Message().Fields()
+		for i := 0; i < subfields.Len(); i++ {
+			node, err := pw.addField(fields, subfields.Get(i), rep)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, node)
+		}
+		return schema.NewGroupNode(name, parquet.Repetitions.Optional, children, -1)
+	}
+	if fd.IsMap() {
+		return nil, fmt.Errorf("unsupported map field %s for Parquet", fd.FullName())
+	}
+	repetition := parquet.Repetitions.Required
+	if fd.IsList() {
+		repetition = parquet.Repetitions.Repeated
+		rep++
+	}
+	var logical schema.LogicalType = schema.NoLogicalType{}
+	var physical parquet.Type
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		physical = parquet.Types.Boolean
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind, protoreflect.EnumKind:
+		physical = parquet.Types.Int32
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		physical = parquet.Types.Int32
+		logical = schema.NewIntLogicalType(32, false)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		physical = parquet.Types.Int64
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		physical = parquet.Types.Int64
+		logical = schema.NewIntLogicalType(64, false)
+	case protoreflect.FloatKind:
+		physical = parquet.Types.Float
+	case protoreflect.DoubleKind:
+		physical = parquet.Types.Double
+	case protoreflect.StringKind:
+		physical = parquet.Types.ByteArray
+		logical = schema.StringLogicalType{}
+	case protoreflect.BytesKind:
+		physical = parquet.Types.ByteArray
+	default:
+		return nil, fmt.Errorf("unsupported field %s of kind %s for Parquet", fd.FullName(), fd.Kind())
+	}
+	node, err := schema.NewPrimitiveNodeLogical(name, repetition, logical, physical, -1, -1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build Parquet column for %s: %w", fd.FullName(), err)
+	}
+	pw.columns = append(pw.columns, &column{
+		fields: fields,
+		maxRep: rep,
+	})
+	return node, nil
+}
+
+// Write adds a flow to the current row group. The row group is
+// written once full.
+func (pw *Writer) Write(fl *flow.Message) error {
+	m := fl.ProtoReflect()
+	for _, col := range pw.columns {
+		if len(col.fields) == 1 {
+			col.appendField(m, col.fields[0], 0)
+			continue
+		}
+		if !m.Has(col.fields[0]) {
+			col.appendLevels(0, 0)
+			continue
+		}
+		col.appendField(m.Get(col.fields[0]).Message(), col.fields[1], 1)
+	}
+	pw.rows++
+	if pw.rows >= pw.rowGroupSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+// Close writes the last row group and the footer. It does not close
+// the underlying writer.
+func (pw *Writer) Close() error {
+	if pw.rows > 0 {
+		if err := pw.flush(); err != nil {
+			return err
+		}
+	}
+	return pw.writer.Close()
+}
+
+// flush writes the current row group.
+func (pw *Writer) flush() (err error) {
+	// The Parquet writer panics on I/O errors
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cannot write Parquet row group: %v", r)
+		}
+	}()
+	rg := pw.writer.AppendRowGroup()
+	for _, col := range pw.columns {
+		cw, err := rg.NextColumn()
+		if err != nil {
+			return err
+		}
+		if err := col.write(cw); err != nil {
+			return err
+		}
+		col.reset()
+	}
+	pw.rows = 0
+	return rg.Close()
+}
+
+// appendField appends the value(s) of a field from the provided
+// message. def is the definition level of the message.
+func (col *column) appendField(m protoreflect.Message, fd protoreflect.FieldDescriptor, def int16) {
+	if !fd.IsList() {
+		col.appendLevels(0, def)
+		col.values = append(col.values, m.Get(fd))
+		return
+	}
+	list := m.Get(fd).List()
+	if list.Len() == 0 {
+		col.appendLevels(0, def)
+		return
+	}
+	for i := 0; i < list.Len(); i++ {
+		var rep int16
+		if i > 0 {
+			rep = col.maxRep
+		}
+		col.appendLevels(rep, def+1)
+		col.values = append(col.values, list.Get(i))
+	}
+}
+
+func (col *column) appendLevels(rep, def int16) {
+	col.repLevels = append(col.repLevels, rep)
+	col.defLevels = append(col.defLevels, def)
+}
+
+// write writes the buffered values to the provided column writer.
+func (col *column) write(cw file.ColumnChunkWriter) error {
+	var err error
+	defLevels, repLevels := col.defLevels, col.repLevels
+	if cw.Descr().MaxDefinitionLevel() == 0 {
+		defLevels = nil
+	}
+	if cw.Descr().MaxRepetitionLevel() == 0 {
+		repLevels = nil
+	}
+	switch w := cw.(type) {
+	case *file.BooleanColumnChunkWriter:
+		values := make([]bool, len(col.values))
+		for i, v := range col.values {
+			values[i] = v.Bool()
+		}
+		_, err = w.WriteBatch(values, defLevels, repLevels)
+	case *file.Int32ColumnChunkWriter:
+		values := make([]int32, len(col.values))
+		for i, v := range col.values {
+			switch x := v.Interface().(type) {
+			case int32:
+				values[i] = x
+			case uint32:
+				values[i] = int32(x)
+			case protoreflect.EnumNumber:
+				values[i] = int32(x)
+			}
+		}
+		_, err = w.WriteBatch(values, defLevels, repLevels)
+	case *file.Int64ColumnChunkWriter:
+		values := make([]int64, len(col.values))
+		for i, v := range col.values {
+			switch x := v.Interface().(type) {
+			case int64:
+				values[i] = x
+			case uint64:
+				values[i] = int64(x)
+			}
+		}
+		_, err = w.WriteBatch(values, defLevels, repLevels)
+	case *file.Float32ColumnChunkWriter:
+		values := make([]float32, len(col.values))
+		for i, v := range col.values {
+			values[i] = float32(v.Float())
+		}
+		_, err = w.WriteBatch(values, defLevels, repLevels)
+	case *file.Float64ColumnChunkWriter:
+		values := make([]float64, len(col.values))
+		for i, v := range col.values {
+			values[i] = v.Float()
+		}
+		_, err = w.WriteBatch(values, defLevels, repLevels)
+	case *file.ByteArrayColumnChunkWriter:
+		values := make([]parquet.ByteArray, len(col.values))
+		for i, v := range col.values {
+			switch x := v.Interface().(type) {
+			case string:
+				values[i] = parquet.ByteArray(x)
+			case []byte:
+				values[i] = x
+			}
+		}
+		_, err = w.WriteBatch(values, defLevels, repLevels)
+	default:
+		return fmt.Errorf("unsupported Parquet column writer %T", cw)
+	}
+	if err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+func (col *column) reset() {
+	col.defLevels = col.defLevels[:0]
+	col.repLevels = col.repLevels[:0]
+	col.values = col.values[:0]
+}
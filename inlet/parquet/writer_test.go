@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package parquet
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/apache/arrow/go/v10/parquet/compress"
+	"github.com/apache/arrow/go/v10/parquet/file"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestParquetWriter(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compressed), func(t *testing.T) {
+			var buf bytes.Buffer
+			pw, err := NewWriter(&buf, compressed, 2)
+			if err != nil {
+				t.Fatalf("NewWriter() error:\n%+v", err)
+			}
+			flows := []*flow.Message{
+				{SequenceNum: 1, ExporterName: "exporter1", DstASPath: []uint32{65000, 65001}},
+				{SequenceNum: 2, ExporterName: "exporter2", ScanSuspect: true},
+				{
+					SequenceNum: 3, ExporterName: "exporter3", DstASPath: []uint32{65002},
+					DstLargeCommunities: &decoder.FlowMessage_LargeCommunities{
+						ASN:        []uint32{65400, 65401},
+						LocalData1: []uint32{100, 200},
+						LocalData2: []uint32{300, 400},
+					},
+				},
+			}
+			for _, fl := range flows {
+				if err := pw.Write(fl); err != nil {
+					t.Fatalf("Write() error:\n%+v", err)
+				}
+			}
+			if err := pw.Close(); err != nil {
+				t.Fatalf("Close() error:\n%+v", err)
+			}
+			content := buf.Bytes()
+
+			reader, err := file.NewParquetReader(bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("NewParquetReader() error:\n%+v", err)
+			}
+			defer reader.Close()
+			if reader.NumRows() != 3 {
+				t.Errorf("NumRows(): %d instead of 3", reader.NumRows())
+			}
+			if reader.NumRowGroups() != 2 {
+				t.Errorf("NumRowGroups(): %d instead of 2", reader.NumRowGroups())
+			}
+			if name := reader.MetaData().Schema.Root().Name(); name != "akvorado" {
+				t.Errorf("schema root: %q instead of akvorado", name)
+			}
+			expectedCodec := compress.Codecs.Uncompressed
+			if compressed {
+				expectedCodec = compress.Codecs.Gzip
+			}
+			chunk, err := reader.RowGroup(0).MetaData().ColumnChunk(0)
+			if err != nil {
+				t.Fatalf("ColumnChunk() error:\n%+v", err)
+			}
+			if chunk.Compression() != expectedCodec {
+				t.Errorf("Compression(): %s instead of %s", chunk.Compression(), expectedCodec)
+			}
+
+			cases := []struct {
+				Path     string
+				Expected [][]string
+			}{
+				{
+					Path:     "SequenceNum",
+					Expected: [][]string{{"1"}, {"2"}, {"3"}},
+				}, {
+					Path:     "ExporterName",
+					Expected: [][]string{{"exporter1"}, {"exporter2"}, {"exporter3"}},
+				}, {
+					Path:     "ScanSuspect",
+					Expected: [][]string{{"false"}, {"true"}, {"false"}},
+				}, {
+					Path:     "DstASPath",
+					Expected: [][]string{{"65000", "65001"}, {}, {"65002"}},
+				}, {
+					Path:     "DstLargeCommunities.ASN",
+					Expected: [][]string{{}, {}, {"65400", "65401"}},
+				}, {
+					Path:     "DstLargeCommunities.LocalData2",
+					Expected: [][]string{{}, {}, {"300", "400"}},
+				},
+			}
+			for _, tc := range cases {
+				got := ReadColumn(t, content, tc.Path)
+				if diff := helpers.Diff(got, tc.Expected); diff != "" {
+					t.Errorf("%s (-got, +want):\n%s", tc.Path, diff)
+				}
+			}
+		})
+	}
+}
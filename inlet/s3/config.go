@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package s3
+
+import "time"
+
+// Configuration describes the configuration for the S3 archiver.
+type Configuration struct {
+	// Endpoint is the URL of the S3-compatible service.
+	Endpoint string `validate:"required,url"`
+	// Region is the region used to sign requests.
+	Region string `validate:"required"`
+	// Bucket is the bucket to upload files to.
+	Bucket string `validate:"required"`
+	// PathStyle tells to put the bucket in the path instead of the
+	// host name. This is needed by most S3-compatible services.
+	PathStyle bool
+	// AccessKeyID is the access key used to sign requests. When
+	// empty, AWS_ACCESS_KEY_ID is used.
+	AccessKeyID string
+	// SecretAccessKey is the secret key used to sign requests. It can
+	// be a reference to a secret. When empty, AWS_SECRET_ACCESS_KEY
+	// is used.
+	SecretAccessKey string
+	// Prefix is the prefix for uploaded objects.
+	Prefix string
+	// Compress tells to compress Parquet pages with gzip.
+	Compress bool
+	// RowGroupSize defines the number of flows in each row group.
+	RowGroupSize int `validate:"min=1"`
+	// FlushInterval defines the maximum time to wait before
+	// uploading a file.
+	FlushInterval time.Duration `validate:"min=1s"`
+	// MaxFileSize defines the size after which a file is uploaded.
+	MaxFileSize uint64 `validate:"min=1"`
+	// QueueSize is the number of flows waiting to be written. When
+	// the queue is full, the inlet stops processing flows.
+	QueueSize int `validate:"min=0"`
+	// Timeout is the timeout for each upload.
+	Timeout time.Duration `validate:"min=1s"`
+	// MaxRetries is the number of times an upload is tried again
+	// after a failure.
+	MaxRetries int `validate:"min=0"`
+	// RetryBackoff is the time to wait before the first retry. It is
+	// doubled on each retry.
+	RetryBackoff time.Duration `validate:"min=0"`
+	// MaxRetryBackoff is the maximum time to wait between two retries.
+	MaxRetryBackoff time.Duration `validate:"gtefield=RetryBackoff"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// S3 archiver.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Endpoint:        "https://s3.amazonaws.com",
+		Region:          "us-east-1",
+		Bucket:          "akvorado",
+		Prefix:          "flows",
+		Compress:        true,
+		RowGroupSize:    10000,
+		FlushInterval:   10 * time.Minute,
+		MaxFileSize:     128 << 20,
+		QueueSize:       10000,
+		Timeout:         time.Minute,
+		MaxRetries:      5,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: 30 * time.Second,
+	}
+}
@@ -0,0 +1,384 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package s3 provides an output archiving flows as Parquet files to an
+// S3-compatible object storage. Files are partitioned by hour to be
+// queried with Athena or Trino.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/parquet"
+)
+
+// Component represents the S3 archiver.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	client      *http.Client
+	signer      *v4.Signer
+	credentials aws.Credentials
+	hostname    string
+	now         func() time.Time
+	queue       chan *flow.Message
+	uploads     chan *archive
+	current     *archive
+	errLogger   reporter.Logger
+	metrics     struct {
+		flowsReceived *reporter.CounterVec
+		flowsDropped  reporter.Counter
+		files         reporter.Counter
+		bytes         reporter.Counter
+		requests      *reporter.CounterVec
+		retries       reporter.Counter
+		errors        *reporter.CounterVec
+	}
+}
+
+// Dependencies define the dependencies of the S3 archiver.
+type Dependencies struct {
+	Daemon daemon.Component
+}
+
+// archive is a Parquet file being written or waiting to be uploaded.
+type archive struct {
+	hour   time.Time
+	opened time.Time
+	buffer bytes.Buffer
+	writer *parquet.Writer
+	flows  int
+}
+
+// errPermanent is returned when an upload should not be tried again.
+var errPermanent = errors.New("permanent error")
+
+// New creates a new S3 archiver.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if _, err := url.Parse(configuration.Endpoint); err != nil {
+		return nil, fmt.Errorf("cannot parse endpoint: %w", err)
+	}
+	secretAccessKey, err := helpers.ResolveSecret(configuration.SecretAccessKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve secret access key: %w", err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "akvorado"
+	}
+	c := Component{
+		r:      r,
+		d:      &dependencies,
+		config: configuration,
+		client: &http.Client{Timeout: configuration.Timeout},
+		signer: v4.NewSigner(func(o *v4.SignerOptions) {
+			// S3 expects the path to be escaped only once
+			o.DisableURIPathEscaping = true
+		}),
+		credentials: aws.Credentials{
+			AccessKeyID:     configuration.AccessKeyID,
+			SecretAccessKey: secretAccessKey,
+		},
+		hostname:  hostname,
+		now:       time.Now,
+		queue:     make(chan *flow.Message, configuration.QueueSize),
+		uploads:   make(chan *archive, 1),
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+	}
+	if c.credentials.AccessKeyID == "" {
+		c.credentials.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if c.credentials.SecretAccessKey == "" {
+		c.credentials.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	c.d.Daemon.Track(&c.t, "inlet/s3")
+	c.metrics.flowsReceived = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_received_total",
+			Help: "Number of flows received from a given exporter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.flowsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_dropped_total",
+			Help: "Number of flows dropped after failing to write or upload them.",
+		},
+	)
+	c.metrics.files = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "files_uploaded_total",
+			Help: "Number of files uploaded.",
+		},
+	)
+	c.metrics.bytes = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "uploaded_bytes_total",
+			Help: "Number of bytes uploaded.",
+		},
+	)
+	c.metrics.requests = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "requests_total",
+			Help: "Number of upload requests by status code.",
+		},
+		[]string{"code"},
+	)
+	c.metrics.retries = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "retries_total",
+			Help: "Number of times an upload was tried again.",
+		},
+	)
+	c.metrics.errors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of errors when archiving flows.",
+		},
+		[]string{"error"},
+	)
+	return &c, nil
+}
+
+// Start starts the S3 archiver.
+func (c *Component) Start() error {
+	c.r.Info().Str("endpoint", c.config.Endpoint).Str("bucket", c.config.Bucket).
+		Msg("starting S3 archiver")
+	c.t.Go(c.run)
+	c.t.Go(c.uploader)
+	return nil
+}
+
+// Stop stops the S3 archiver. The current file is uploaded once,
+// without retry.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("S3 archiver stopped")
+	c.r.Info().Msg("stopping S3 archiver")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// Send queues a flow to be archived. It blocks when the queue is full.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.metrics.flowsReceived.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+	select {
+	case c.queue <- fl:
+	case <-c.t.Dying():
+	}
+}
+
+// run writes queued flows to the current file.
+func (c *Component) run() error {
+	defer close(c.uploads)
+	ticker := time.NewTicker(c.config.FlushInterval / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.t.Dying():
+			for {
+				select {
+				case fl := <-c.queue:
+					c.write(fl)
+					continue
+				default:
+				}
+				break
+			}
+			c.closeCurrent()
+			return nil
+		case fl := <-c.queue:
+			c.write(fl)
+		case <-ticker.C:
+			if c.current != nil && c.now().Sub(c.current.opened) >= c.config.FlushInterval {
+				c.closeCurrent()
+			}
+		}
+	}
+}
+
+// write writes a flow to the file for its hour, starting a new file if
+// needed.
+func (c *Component) write(fl *flow.Message) {
+	var hour time.Time
+	if fl.TimeReceived != 0 {
+		hour = time.Unix(int64(fl.TimeReceived), 0).UTC().Truncate(time.Hour)
+	} else {
+		hour = c.now().UTC().Truncate(time.Hour)
+	}
+	if c.current != nil && !c.current.hour.Equal(hour) {
+		c.closeCurrent()
+	}
+	if c.current == nil {
+		a := &archive{hour: hour, opened: c.now()}
+		writer, err := parquet.NewWriter(&a.buffer, c.config.Compress, c.config.RowGroupSize)
+		if err != nil {
+			c.metrics.errors.WithLabelValues("cannot create file").Inc()
+			c.metrics.flowsDropped.Inc()
+			c.errLogger.Err(err).Msg("unable to create Parquet file")
+			return
+		}
+		a.writer = writer
+		c.current = a
+	}
+	if err := c.current.writer.Write(fl); err != nil {
+		c.metrics.errors.WithLabelValues("cannot write flow").Inc()
+		c.metrics.flowsDropped.Inc()
+		c.errLogger.Err(err).Msg("unable to write flow")
+		return
+	}
+	c.current.flows++
+	if uint64(c.current.buffer.Len()) >= c.config.MaxFileSize {
+		c.closeCurrent()
+	}
+}
+
+// closeCurrent completes the current file and queues it for upload.
+func (c *Component) closeCurrent() {
+	a := c.current
+	if a == nil {
+		return
+	}
+	c.current = nil
+	if err := a.writer.Close(); err != nil {
+		c.metrics.errors.WithLabelValues("cannot close file").Inc()
+		c.metrics.flowsDropped.Add(float64(a.flows))
+		c.errLogger.Err(err).Msg("unable to complete Parquet file")
+		return
+	}
+	c.uploads <- a
+}
+
+// key returns the object key for a file. Files are partitioned by hour
+// using Hive-style partitions.
+func (c *Component) key(a *archive) string {
+	return path.Join(c.config.Prefix,
+		a.hour.Format("year=2006/month=01/day=02/hour=15"),
+		fmt.Sprintf("%s-%s.parquet", c.hostname, a.opened.UTC().Format("20060102T150405.000000000Z")))
+}
+
+// uploader uploads completed files.
+func (c *Component) uploader() error {
+	for a := range c.uploads {
+		c.uploadWithRetries(a)
+	}
+	return nil
+}
+
+// uploadWithRetries uploads a file, retrying with an exponential
+// backoff on temporary errors.
+func (c *Component) uploadWithRetries(a *archive) {
+	key := c.key(a)
+	body := a.buffer.Bytes()
+	backoff := c.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.upload(key, body)
+		if err == nil {
+			c.metrics.files.Inc()
+			c.metrics.bytes.Add(float64(len(body)))
+			return
+		}
+		c.errLogger.Err(err).Str("key", key).Int("attempt", attempt).Msg("unable to upload file")
+		if errors.Is(err, errPermanent) || attempt >= c.config.MaxRetries {
+			c.metrics.flowsDropped.Add(float64(a.flows))
+			return
+		}
+		select {
+		case <-c.t.Dying():
+			c.metrics.flowsDropped.Add(float64(a.flows))
+			return
+		case <-time.After(backoff):
+		}
+		c.metrics.retries.Inc()
+		backoff *= 2
+		if backoff > c.config.MaxRetryBackoff {
+			backoff = c.config.MaxRetryBackoff
+		}
+	}
+}
+
+// upload uploads a file with the provided key. Errors wrapping
+// errPermanent should not be retried.
+func (c *Component) upload(key string, body []byte) error {
+	u, _ := url.Parse(c.config.Endpoint)
+	if c.config.PathStyle {
+		u.Path = path.Join("/", u.Path, c.config.Bucket, key)
+	} else {
+		u.Host = fmt.Sprintf("%s.%s", c.config.Bucket, u.Host)
+		u.Path = path.Join("/", u.Path, key)
+	}
+	u.RawPath = escapePath(u.Path)
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		c.metrics.errors.WithLabelValues("cannot build request").Inc()
+		return fmt.Errorf("%w: %s", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if err := c.sign(req, body, time.Now()); err != nil {
+		c.metrics.errors.WithLabelValues("cannot sign request").Inc()
+		return fmt.Errorf("%w: %s", errPermanent, err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("cannot send request").Inc()
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	c.metrics.requests.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return fmt.Errorf("%w: unexpected status code %d", errPermanent, resp.StatusCode)
+}
+
+// sign adds the AWS Signature Version 4 headers to a request.
+func (c *Component) sign(req *http.Request, body []byte, now time.Time) error {
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	return c.signer.SignHTTP(context.Background(), c.credentials, req,
+		payloadHash, "s3", c.config.Region, now)
+}
+
+// escapePath encodes a path as expected by S3: everything but
+// unreserved characters and slashes is percent-encoded.
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
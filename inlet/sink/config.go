@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package sink
+
+import (
+	"errors"
+
+	"akvorado/common/helpers"
+)
+
+// Configuration describes the configuration for the sink component.
+type Configuration struct {
+	// Type is the kind of sink to use.
+	Type Type
+	// Path is the file to write flows to when Type is "file".
+	Path string
+}
+
+// DefaultConfiguration represents the default configuration for the
+// sink component.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Type: TypeDiscard,
+	}
+}
+
+// Type is the kind of sink.
+type Type int
+
+const (
+	// TypeDiscard drops all flows.
+	TypeDiscard Type = iota
+	// TypeStdout writes flows as JSON lines to the standard output.
+	TypeStdout
+	// TypeFile writes flows as JSON lines to a file.
+	TypeFile
+)
+
+var typeMap = helpers.NewBimap(map[Type]string{
+	TypeDiscard: "discard",
+	TypeStdout:  "stdout",
+	TypeFile:    "file",
+})
+
+// MarshalText turns a sink type to text.
+func (t Type) MarshalText() ([]byte, error) {
+	got, ok := typeMap.LoadValue(t)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown sink type")
+}
+
+// String turns a sink type to string.
+func (t Type) String() string {
+	got, _ := typeMap.LoadValue(t)
+	return got
+}
+
+// UnmarshalText provides a sink type from a string.
+func (t *Type) UnmarshalText(input []byte) error {
+	got, ok := typeMap.LoadKey(string(input))
+	if ok {
+		*t = got
+		return nil
+	}
+	return errors.New("unknown sink type")
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package sink provides an output to be used in place of Kafka to
+// run the inlet without a broker. Flows are discarded or written as
+// JSON lines to the standard output or to a file.
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the sink component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	lock   sync.Mutex
+	file   io.WriteCloser
+	writer *bufio.Writer
+
+	errLogger reporter.Logger
+	metrics   struct {
+		flows  *reporter.CounterVec
+		errors *reporter.CounterVec
+	}
+}
+
+// Dependencies define the dependencies of the sink component.
+type Dependencies struct {
+	Daemon daemon.Component
+}
+
+// New creates a new sink component.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if configuration.Type == TypeFile && configuration.Path == "" {
+		return nil, fmt.Errorf("a path is required for the %q sink", configuration.Type)
+	}
+	c := Component{
+		r:         r,
+		d:         &dependencies,
+		config:    configuration,
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+	}
+	c.d.Daemon.Track(&c.t, "inlet/sink")
+	c.metrics.flows = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_total",
+			Help: "Number of flows received from a given exporter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.errors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of errors when writing flows.",
+		},
+		[]string{"error"},
+	)
+	return &c, nil
+}
+
+// Start starts the sink component.
+func (c *Component) Start() error {
+	c.r.Info().Str("type", c.config.Type.String()).Msg("starting sink component")
+	switch c.config.Type {
+	case TypeStdout:
+		c.writer = bufio.NewWriter(os.Stdout)
+	case TypeFile:
+		file, err := os.OpenFile(c.config.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("unable to open %q: %w", c.config.Path, err)
+		}
+		c.file = file
+		c.writer = bufio.NewWriter(file)
+	}
+
+	// Flush regularly
+	c.t.Go(func() error {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-ticker.C:
+				if c.writer == nil {
+					continue
+				}
+				c.lock.Lock()
+				if err := c.writer.Flush(); err != nil {
+					c.metrics.errors.WithLabelValues("flush error").Inc()
+					c.errLogger.Err(err).Msg("unable to flush flows")
+				}
+				c.lock.Unlock()
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops the sink component.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("sink component stopped")
+	c.r.Info().Msg("stopping sink component")
+	c.t.Kill(nil)
+	err := c.t.Wait()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.writer != nil {
+		if err := c.writer.Flush(); err != nil {
+			c.r.Err(err).Msg("unable to flush flows")
+		}
+	}
+	if c.file != nil {
+		if err := c.file.Close(); err != nil {
+			c.r.Err(err).Msg("unable to close file")
+		}
+	}
+	return err
+}
+
+// Synchronous tells the flow is not referenced once written.
+func (c *Component) Synchronous() bool {
+	return true
+}
+
+// Send writes a flow to the sink.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.metrics.flows.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+	if c.writer == nil {
+		return
+	}
+	buf, err := json.Marshal(fl)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("encoding error").Inc()
+		c.errLogger.Err(err).Str("exporter", exporter).Msg("unable to encode flow")
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writer.Write(buf)
+	if buf[len(buf)-1] != '\n' {
+		c.writer.WriteByte('\n')
+	}
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package sink
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+func TestDiscard(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, err := New(r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_sink_")
+	expectedMetrics := map[string]string{
+		`flows_total{exporter="127.0.0.1"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestFile(t *testing.T) {
+	r := reporter.NewMock(t)
+	path := filepath.Join(t.TempDir(), "flows.json")
+	configuration := DefaultConfiguration()
+	configuration.Type = TypeFile
+	configuration.Path = path
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1, ExporterName: "exporter1"})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2, ExporterName: "exporter1"})
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error:\n%+v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	got := []float64{}
+	for _, line := range lines {
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatalf("Unmarshal(%q) error:\n%+v", line, err)
+		}
+		got = append(got, decoded["SequenceNum"].(float64))
+	}
+	if diff := helpers.Diff(got, []float64{1, 2}); diff != "" {
+		t.Fatalf("Flows (-got, +want):\n%s", diff)
+	}
+}
+
+func TestFileWithoutPath(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Type = TypeFile
+	if _, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
@@ -5,6 +5,7 @@ package snmp
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -30,12 +31,22 @@ var (
 	cacheCurrentVersionNumber = 9
 )
 
-// snmpCache represents the SNMP cache.
+// cacheShardsBits is the number of bits to select a shard of the
+// SNMP cache. Exporters are spread among shards to reduce lock
+// contention.
+const (
+	cacheShardsBits = 5
+	cacheShards     = 1 << cacheShardsBits
+)
+
+// snmpCache represents the SNMP cache. It is sharded by exporter.
+// Lookups do not take any lock: each shard points to a map which is
+// never modified once published. Updates are done on a copy which
+// then replaces the original map (copy-on-write).
 type snmpCache struct {
-	r         *reporter.Reporter
-	cache     map[netip.Addr]*cachedExporter
-	cacheLock sync.RWMutex
-	clock     clock.Clock
+	r      *reporter.Reporter
+	shards [cacheShards]cacheShard
+	clock  clock.Clock
 
 	metrics struct {
 		cacheHit       reporter.Counter
@@ -46,13 +57,41 @@ type snmpCache struct {
 	}
 }
 
+// cacheShard is a shard of the SNMP cache. The lock is only needed to
+// update the map of exporters.
+type cacheShard struct {
+	lock      sync.Mutex
+	exporters atomic.Pointer[map[netip.Addr]*exporterEntry]
+}
+
+// exporterEntry is the in-memory version of cachedExporter. It
+// should not be modified once published, except for the interface
+// pointed by each entry.
+type exporterEntry struct {
+	name       string
+	interfaces map[uint]*interfaceEntry
+}
+
+// interfaceEntry points to the current version of a cached
+// interface.
+type interfaceEntry struct {
+	current atomic.Pointer[cachedInterface]
+}
+
 // cachedExporter represents information about a exporter. It includes
-// the mapping from ifIndex to interfaces.
+// the mapping from ifIndex to interfaces. This is the on-disk format.
 type cachedExporter struct {
 	Name       string
 	Interfaces map[uint]*cachedInterface
 }
 
+// Exporter contains the information about an exporter and its
+// interfaces.
+type Exporter struct {
+	Name       string
+	Interfaces map[uint]Interface
+}
+
 // Interface contains the information about an interface.
 type Interface struct {
 	Name        string
@@ -70,7 +109,6 @@ type cachedInterface struct {
 func newSNMPCache(r *reporter.Reporter, clock clock.Clock) *snmpCache {
 	sc := &snmpCache{
 		r:     r,
-		cache: make(map[netip.Addr]*cachedExporter),
 		clock: clock,
 	}
 	sc.metrics.cacheHit = r.Counter(
@@ -93,10 +131,10 @@ func newSNMPCache(r *reporter.Reporter, clock clock.Clock) *snmpCache {
 			Name: "cache_size",
 			Help: "Number of entries in cache.",
 		}, func() (result float64) {
-			sc.cacheLock.RLock()
-			defer sc.cacheLock.RUnlock()
-			for _, exporter := range sc.cache {
-				result += float64(len(exporter.Interfaces))
+			for i := range sc.shards {
+				for _, exporter := range sc.shards[i].load() {
+					result += float64(len(exporter.interfaces))
+				}
 			}
 			return
 		})
@@ -104,14 +142,55 @@ func newSNMPCache(r *reporter.Reporter, clock clock.Clock) *snmpCache {
 		reporter.GaugeOpts{
 			Name: "cache_exporters",
 			Help: "Number of exporters in cache.",
-		}, func() float64 {
-			sc.cacheLock.RLock()
-			defer sc.cacheLock.RUnlock()
-			return float64(len(sc.cache))
+		}, func() (result float64) {
+			for i := range sc.shards {
+				result += float64(len(sc.shards[i].load()))
+			}
+			return
 		})
 	return sc
 }
 
+// shardIndex returns the index of the shard for the provided
+// exporter.
+func shardIndex(ip netip.Addr) uint32 {
+	// Fibonacci hashing of the folded address
+	b := ip.As16()
+	hash := binary.LittleEndian.Uint64(b[:8]) ^ binary.LittleEndian.Uint64(b[8:])
+	return uint32((hash * 0x9e3779b97f4a7c15) >> (64 - cacheShardsBits))
+}
+
+// shard returns the shard for the provided exporter.
+func (sc *snmpCache) shard(ip netip.Addr) *cacheShard {
+	return &sc.shards[shardIndex(ip)]
+}
+
+// load returns the current map of exporters of the shard. It should
+// not be modified.
+func (cs *cacheShard) load() map[netip.Addr]*exporterEntry {
+	if exporters := cs.exporters.Load(); exporters != nil {
+		return *exporters
+	}
+	return nil
+}
+
+// replace replaces the entry for an exporter by publishing an updated
+// copy of the map of exporters. When the entry is nil, the exporter
+// is removed. The lock should be held.
+func (cs *cacheShard) replace(ip netip.Addr, exporter *exporterEntry) {
+	current := cs.load()
+	exporters := make(map[netip.Addr]*exporterEntry, len(current)+1)
+	for k, v := range current {
+		exporters[k] = v
+	}
+	if exporter == nil {
+		delete(exporters, ip)
+	} else {
+		exporters[ip] = exporter
+	}
+	cs.exporters.Store(&exporters)
+}
+
 // Lookup will perform a lookup of the cache. It returns the exporter
 // name as well as the requested interface.
 func (sc *snmpCache) Lookup(ip netip.Addr, ifIndex uint) (string, Interface, error) {
@@ -119,63 +198,152 @@ func (sc *snmpCache) Lookup(ip netip.Addr, ifIndex uint) (string, Interface, err
 }
 
 func (sc *snmpCache) lookup(ip netip.Addr, ifIndex uint, touchAccess bool) (string, Interface, error) {
-	sc.cacheLock.RLock()
-	defer sc.cacheLock.RUnlock()
-	exporter, ok := sc.cache[ip]
+	exporter, ok := sc.shard(ip).load()[ip]
 	if !ok {
 		sc.metrics.cacheMiss.Inc()
 		return "", Interface{}, ErrCacheMiss
 	}
-	iface, ok := exporter.Interfaces[ifIndex]
+	entry, ok := exporter.interfaces[ifIndex]
 	if !ok {
 		sc.metrics.cacheMiss.Inc()
 		return "", Interface{}, ErrCacheMiss
 	}
+	iface := entry.current.Load()
 	sc.metrics.cacheHit.Inc()
 	if touchAccess {
-		atomic.StoreInt64(&iface.LastAccessed, sc.clock.Now().Unix())
+		// Avoid writing to memory shared with other cores when
+		// not needed.
+		now := sc.clock.Now().Unix()
+		if atomic.LoadInt64(&iface.LastAccessed) != now {
+			atomic.StoreInt64(&iface.LastAccessed, now)
+		}
+	}
+	return exporter.name, iface.Interface, nil
+}
+
+// FindByName returns the ifIndex of the interface of an exporter with
+// the provided name, without updating access times.
+func (sc *snmpCache) FindByName(ip netip.Addr, name string) (uint, bool) {
+	exporter, ok := sc.shard(ip).load()[ip]
+	if !ok {
+		return 0, false
+	}
+	for ifIndex, entry := range exporter.interfaces {
+		if entry.current.Load().Name == name {
+			return ifIndex, true
+		}
+	}
+	return 0, false
+}
+
+// Exporter returns a copy of the cached information about an
+// exporter, without updating access times.
+func (sc *snmpCache) Exporter(ip netip.Addr) (Exporter, bool) {
+	exporter, ok := sc.shard(ip).load()[ip]
+	if !ok {
+		return Exporter{}, false
+	}
+	result := Exporter{
+		Name:       exporter.name,
+		Interfaces: make(map[uint]Interface, len(exporter.interfaces)),
+	}
+	for ifIndex, entry := range exporter.interfaces {
+		result.Interfaces[ifIndex] = entry.current.Load().Interface
 	}
-	return exporter.Name, iface.Interface, nil
+	return result, true
 }
 
 // Put a new entry in the cache.
 func (sc *snmpCache) Put(ip netip.Addr, exporterName string, ifIndex uint, iface Interface) {
-	sc.cacheLock.Lock()
-	defer sc.cacheLock.Unlock()
-
 	now := sc.clock.Now().Unix()
-	ciface := cachedInterface{
+	ciface := &cachedInterface{
 		LastUpdated:  now,
 		LastAccessed: now,
 		Interface:    iface,
 	}
-	exporter, ok := sc.cache[ip]
-	if !ok {
-		exporter = &cachedExporter{Interfaces: make(map[uint]*cachedInterface)}
-		sc.cache[ip] = exporter
+
+	shard := sc.shard(ip)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	exporter, ok := shard.load()[ip]
+	var interfaces map[uint]*interfaceEntry
+	if ok {
+		interfaces = exporter.interfaces
+	}
+	entry, found := interfaces[ifIndex]
+	if found {
+		entry.current.Store(ciface)
+		if exporter.name == exporterName {
+			// Nothing else to update
+			return
+		}
+	} else {
+		entry = &interfaceEntry{}
+		entry.current.Store(ciface)
+		updated := make(map[uint]*interfaceEntry, len(interfaces)+1)
+		for k, v := range interfaces {
+			updated[k] = v
+		}
+		updated[ifIndex] = entry
+		interfaces = updated
 	}
-	exporter.Name = exporterName
-	exporter.Interfaces[ifIndex] = &ciface
+	shard.replace(ip, &exporterEntry{
+		name:       exporterName,
+		interfaces: interfaces,
+	})
 }
 
 // Expire expire entries older than the provided duration (rely on last access).
 func (sc *snmpCache) Expire(older time.Duration) (count uint) {
 	threshold := sc.clock.Now().Add(-older).Unix()
 
-	sc.cacheLock.Lock()
-	defer sc.cacheLock.Unlock()
-
-	for ip, exporter := range sc.cache {
-		for ifindex, iface := range exporter.Interfaces {
-			if iface.LastAccessed < threshold {
-				delete(exporter.Interfaces, ifindex)
+	for i := range sc.shards {
+		shard := &sc.shards[i]
+		shard.lock.Lock()
+		for ip, exporter := range shard.load() {
+			var interfaces map[uint]*interfaceEntry
+			for ifIndex, entry := range exporter.interfaces {
+				if atomic.LoadInt64(&entry.current.Load().LastAccessed) >= threshold {
+					continue
+				}
+				if interfaces == nil {
+					interfaces = make(map[uint]*interfaceEntry, len(exporter.interfaces))
+					for k, v := range exporter.interfaces {
+						interfaces[k] = v
+					}
+				}
+				delete(interfaces, ifIndex)
 				sc.metrics.cacheExpired.Inc()
 				count++
 			}
+			if interfaces == nil {
+				continue
+			}
+			if len(interfaces) == 0 {
+				shard.replace(ip, nil)
+			} else {
+				shard.replace(ip, &exporterEntry{
+					name:       exporter.name,
+					interfaces: interfaces,
+				})
+			}
 		}
-		if len(exporter.Interfaces) == 0 {
-			delete(sc.cache, ip)
+		shard.lock.Unlock()
+	}
+	return
+}
+
+// Flush removes all entries from the cache. It returns the number of
+// removed entries.
+func (sc *snmpCache) Flush() (count uint) {
+	for i := range sc.shards {
+		shard := &sc.shards[i]
+		shard.lock.Lock()
+		for _, exporter := range shard.load() {
+			count += uint(len(exporter.interfaces))
 		}
+		shard.exporters.Store(nil)
+		shard.lock.Unlock()
 	}
 	return
 }
@@ -186,22 +354,22 @@ func (sc *snmpCache) entriesOlderThan(older time.Duration, lastAccessed bool) ma
 	threshold := sc.clock.Now().Add(-older).Unix()
 	result := make(map[netip.Addr]map[uint]Interface)
 
-	sc.cacheLock.RLock()
-	defer sc.cacheLock.RUnlock()
-
-	for ip, exporter := range sc.cache {
-		for ifindex, iface := range exporter.Interfaces {
-			what := &iface.LastAccessed
-			if !lastAccessed {
-				what = &iface.LastUpdated
-			}
-			if atomic.LoadInt64(what) < threshold {
-				_, ok := result[ip]
-				if !ok {
-					rifaces := make(map[uint]Interface)
-					result[ip] = rifaces
+	for i := range sc.shards {
+		for ip, exporter := range sc.shards[i].load() {
+			for ifindex, entry := range exporter.interfaces {
+				iface := entry.current.Load()
+				when := iface.LastUpdated
+				if lastAccessed {
+					when = atomic.LoadInt64(&iface.LastAccessed)
+				}
+				if when < threshold {
+					_, ok := result[ip]
+					if !ok {
+						rifaces := make(map[uint]Interface)
+						result[ip] = rifaces
+					}
+					result[ip][ifindex] = iface.Interface
 				}
-				result[ip][ifindex] = iface.Interface
 			}
 		}
 	}
@@ -266,9 +434,25 @@ func (sc *snmpCache) GobEncode() ([]byte, error) {
 	if err := encoder.Encode(&cacheCurrentVersionNumber); err != nil {
 		return nil, err
 	}
-	sc.cacheLock.Lock() // needed because we won't do atomic access
-	defer sc.cacheLock.Unlock()
-	if err := encoder.Encode(sc.cache); err != nil {
+	cache := map[netip.Addr]*cachedExporter{}
+	for i := range sc.shards {
+		for ip, exporter := range sc.shards[i].load() {
+			cexporter := &cachedExporter{
+				Name:       exporter.name,
+				Interfaces: make(map[uint]*cachedInterface, len(exporter.interfaces)),
+			}
+			for ifIndex, entry := range exporter.interfaces {
+				iface := entry.current.Load()
+				cexporter.Interfaces[ifIndex] = &cachedInterface{
+					LastUpdated:  iface.LastUpdated,
+					LastAccessed: atomic.LoadInt64(&iface.LastAccessed),
+					Interface:    iface.Interface,
+				}
+			}
+			cache[ip] = cexporter
+		}
+	}
+	if err := encoder.Encode(cache); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
@@ -289,8 +473,28 @@ func (sc *snmpCache) GobDecode(data []byte) error {
 	if err := decoder.Decode(&cache); err != nil {
 		return err
 	}
-	sc.cacheLock.Lock()
-	sc.cache = cache
-	sc.cacheLock.Unlock()
+	shards := [cacheShards]map[netip.Addr]*exporterEntry{}
+	for ip, cexporter := range cache {
+		exporter := &exporterEntry{
+			name:       cexporter.Name,
+			interfaces: make(map[uint]*interfaceEntry, len(cexporter.Interfaces)),
+		}
+		for ifIndex, iface := range cexporter.Interfaces {
+			entry := &interfaceEntry{}
+			entry.current.Store(iface)
+			exporter.interfaces[ifIndex] = entry
+		}
+		idx := shardIndex(ip)
+		if shards[idx] == nil {
+			shards[idx] = map[netip.Addr]*exporterEntry{}
+		}
+		shards[idx][ip] = exporter
+	}
+	for i := range sc.shards {
+		exporters := shards[i]
+		sc.shards[i].lock.Lock()
+		sc.shards[i].exporters.Store(&exporters)
+		sc.shards[i].lock.Unlock()
+	}
 	return nil
 }
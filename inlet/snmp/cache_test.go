@@ -86,6 +86,41 @@ func TestSimpleLookup(t *testing.T) {
 	}
 }
 
+func TestExporter(t *testing.T) {
+	r, _, sc := setupTestCache(t)
+	ip := netip.MustParseAddr("::ffff:127.0.0.1")
+	sc.Put(ip, "localhost", 676, Interface{Name: "Gi0/0/0/1", Description: "Transit", Speed: 1000})
+	sc.Put(ip, "localhost", 678, Interface{Name: "Gi0/0/0/2", Description: "Peering", Speed: 1000})
+
+	if _, ok := sc.Exporter(netip.MustParseAddr("::ffff:127.0.0.2")); ok {
+		t.Error("Exporter() found an unknown exporter")
+	}
+	got, ok := sc.Exporter(ip)
+	if !ok {
+		t.Fatal("Exporter() did not find exporter")
+	}
+	expected := Exporter{
+		Name: "localhost",
+		Interfaces: map[uint]Interface{
+			676: {Name: "Gi0/0/0/1", Description: "Transit", Speed: 1000},
+			678: {Name: "Gi0/0/0/2", Description: "Peering", Speed: 1000},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Errorf("Exporter() (-got, +want):\n%s", diff)
+	}
+
+	// Exporter() should not count as a lookup
+	gotMetrics := r.GetMetrics("akvorado_inlet_snmp_cache_", "hit", "miss")
+	expectedMetrics := map[string]string{
+		`hit`:  "0",
+		`miss`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
 func TestExpire(t *testing.T) {
 	r, clock, sc := setupTestCache(t)
 	sc.Put(netip.MustParseAddr("::ffff:127.0.0.1"), "localhost", 676, Interface{Name: "Gi0/0/0/1", Description: "Transit"})
@@ -142,6 +177,21 @@ func TestExpire(t *testing.T) {
 	}
 }
 
+func TestFlush(t *testing.T) {
+	_, _, sc := setupTestCache(t)
+	sc.Put(netip.MustParseAddr("::ffff:127.0.0.1"), "localhost", 676, Interface{Name: "Gi0/0/0/1"})
+	sc.Put(netip.MustParseAddr("::ffff:127.0.0.1"), "localhost", 678, Interface{Name: "Gi0/0/0/2"})
+	sc.Put(netip.MustParseAddr("::ffff:127.0.0.2"), "localhost2", 678, Interface{Name: "Gi0/0/0/2"})
+	if count := sc.Flush(); count != 3 {
+		t.Errorf("Flush() == %d, expected 3", count)
+	}
+	expectCacheLookup(t, sc, "127.0.0.1", 676, answer{Err: ErrCacheMiss})
+	expectCacheLookup(t, sc, "127.0.0.2", 678, answer{Err: ErrCacheMiss})
+	if count := sc.Flush(); count != 0 {
+		t.Errorf("Flush() == %d, expected 0", count)
+	}
+}
+
 func TestExpireRefresh(t *testing.T) {
 	_, clock, sc := setupTestCache(t)
 	sc.Put(netip.MustParseAddr("::ffff:127.0.0.1"), "localhost", 676, Interface{Name: "Gi0/0/0/1", Description: "Transit"})
@@ -383,12 +433,13 @@ func TestConcurrentOperations(t *testing.T) {
 	wg.Wait()
 
 	gotMetrics := r.GetMetrics("akvorado_inlet_snmp_cache_")
-	hits, _ := strconv.Atoi(gotMetrics["hit"])
-	misses, _ := strconv.Atoi(gotMetrics["miss"])
+	// Large counters are displayed with an exponent
+	hits, _ := strconv.ParseFloat(gotMetrics["hit"], 64)
+	misses, _ := strconv.ParseFloat(gotMetrics["miss"], 64)
 	size, _ := strconv.Atoi(gotMetrics["size"])
 	exporters, _ := strconv.Atoi(gotMetrics["exporters"])
 	if int64(hits+misses) != atomic.LoadInt64(&lookups) {
-		t.Errorf("hit + miss = %d, expected %d", hits+misses, atomic.LoadInt64(&lookups))
+		t.Errorf("hit + miss = %d, expected %d", int64(hits+misses), atomic.LoadInt64(&lookups))
 	}
 	if size < 50 {
 		t.Errorf("size is %d < 50", size)
@@ -397,3 +448,26 @@ func TestConcurrentOperations(t *testing.T) {
 		t.Errorf("exporters is %d < 8", exporters)
 	}
 }
+
+func BenchmarkLookupParallel(b *testing.B) {
+	r := reporter.NewMock(b)
+	sc := newSNMPCache(r, clock.New())
+	exporters := []netip.Addr{}
+	for i := 0; i < 100; i++ {
+		exporter := netip.MustParseAddr(fmt.Sprintf("::ffff:192.0.2.%d", i))
+		exporters = append(exporters, exporter)
+		for ifIndex := uint(0); ifIndex < 100; ifIndex++ {
+			sc.Put(exporter, fmt.Sprintf("exporter%d", i), ifIndex, Interface{Name: "Gi0/0/0/1"})
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			sc.Lookup(exporters[i%len(exporters)], uint(i%100))
+			i++
+		}
+	})
+}
@@ -35,7 +35,8 @@ type Configuration struct {
 	// Workers define the number of workers used to poll SNMP
 	Workers int `validate:"min=1"`
 
-	// Communities is a mapping from exporter IPs to SNMPv2 communities
+	// Communities is a mapping from exporter IPs to SNMPv2
+	// communities. Communities can be references to secrets.
 	Communities *helpers.SubnetMap[string]
 	// SecurityParameters is a mapping from exporter IPs to SNMPv3 security parameters
 	SecurityParameters *helpers.SubnetMap[SecurityParameters] `validate:"omitempty,dive"`
@@ -43,9 +44,18 @@ type Configuration struct {
 	Agents map[netip.Addr]netip.Addr
 	// Ports is a mapping from agent IPs to SNMP port
 	Ports *helpers.SubnetMap[uint16]
+	// IfIndexRemapping is a mapping from exporter IPs to rules
+	// translating the ifIndex found in flows to the SNMP ifIndex
+	IfIndexRemapping *helpers.SubnetMap[IfIndexRemapping]
+
+	// DiscoverySubnets are the management subnets to scan to discover exporters
+	DiscoverySubnets []netip.Prefix
+	// DiscoveryInterval defines how often the discovery subnets are scanned
+	DiscoveryInterval time.Duration `validate:"min=1m"`
 }
 
-// SecurityParameters describes SNMPv3 USM security parameters.
+// SecurityParameters describes SNMPv3 USM security parameters. The
+// passphrases can be references to secrets.
 type SecurityParameters struct {
 	UserName                 string       `validate:"required"`
 	AuthenticationProtocol   AuthProtocol `validate:"required_with=PrivProtocol"`
@@ -66,6 +76,7 @@ func DefaultConfiguration() Configuration {
 		PollerTimeout:      time.Second,
 		PollerCoalesce:     10,
 		Workers:            1,
+		DiscoveryInterval:  time.Hour,
 
 		Communities: helpers.MustNewSubnetMap(map[string]string{
 			"::/0": "public",
@@ -74,6 +85,7 @@ func DefaultConfiguration() Configuration {
 		Ports: helpers.MustNewSubnetMap(map[string]uint16{
 			"::/0": 161,
 		}),
+		IfIndexRemapping: helpers.MustNewSubnetMap(map[string]IfIndexRemapping{}),
 	}
 }
 
@@ -200,6 +212,7 @@ func init() {
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[string]())
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[SecurityParameters]())
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[uint16]())
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[IfIndexRemapping]())
 	helpers.RegisterSubnetMapValidation[SecurityParameters]()
 	helpers.RegisterSubnetMapValidation[uint16]()
 }
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// maxDiscoveryHostBits is the maximum number of host bits of a
+// discovery subnet (at most 65536 addresses).
+const maxDiscoveryHostBits = 16
+
+// normalizeDiscoverySubnets turns IPv4 subnets to IPv4-mapped IPv6
+// subnets and checks they are not too large.
+func normalizeDiscoverySubnets(subnets []netip.Prefix) error {
+	for i, subnet := range subnets {
+		if subnet.Addr().Is4() {
+			subnet = netip.PrefixFrom(netip.AddrFrom16(subnet.Addr().As16()), subnet.Bits()+96)
+		}
+		subnet = subnet.Masked()
+		if 128-subnet.Bits() > maxDiscoveryHostBits {
+			return fmt.Errorf("discovery subnet %s is too large", subnets[i])
+		}
+		subnets[i] = subnet
+	}
+	return nil
+}
+
+// runDiscovery scans the discovery subnets on start and then at
+// regular interval.
+func (c *Component) runDiscovery() error {
+	ticker := c.d.Clock.Ticker(c.config.DiscoveryInterval)
+	defer ticker.Stop()
+	for {
+		c.discover()
+		select {
+		case <-c.t.Dying():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// discover scans the discovery subnets once, using as many goroutines
+// as SNMP workers.
+func (c *Component) discover() {
+	c.r.Debug().Msg("start SNMP discovery")
+	c.metrics.discoveryRuns.Inc()
+	addresses := make(chan netip.Addr)
+	done := make(chan struct{})
+	for i := 0; i < c.config.Workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for ip := range addresses {
+				c.discoverExporter(ip)
+			}
+		}()
+	}
+outer:
+	for _, subnet := range c.config.DiscoverySubnets {
+		for ip := subnet.Addr(); subnet.Contains(ip); ip = ip.Next() {
+			select {
+			case <-c.t.Dying():
+				break outer
+			case addresses <- ip:
+			}
+		}
+	}
+	close(addresses)
+	for i := 0; i < c.config.Workers; i++ {
+		<-done
+	}
+	c.r.Debug().Msg("SNMP discovery done")
+}
+
+// discoverExporter checks if the provided address is an exporter
+// answering to SNMP. In this case, it is registered and its interfaces
+// missing from the cache are polled.
+func (c *Component) discoverExporter(exporterIP netip.Addr) {
+	if !c.pollAllInterfaces(exporterIP) {
+		// Most addresses do not answer
+		return
+	}
+	c.discoveredLock.Lock()
+	if _, ok := c.discovered[exporterIP]; !ok {
+		c.r.Info().Str("exporter", exporterIP.Unmap().String()).Msg("exporter discovered")
+	}
+	c.discovered[exporterIP] = struct{}{}
+	c.discoveredLock.Unlock()
+}
+
+// pollAllInterfaces walks the interface table of an exporter and
+// polls the interfaces missing from the cache. It returns false if
+// the exporter did not answer.
+func (c *Component) pollAllInterfaces(exporterIP netip.Addr) bool {
+	lister, ok := c.poller.(interfaceLister)
+	if !ok {
+		return false
+	}
+	agentIP, ok := c.config.Agents[exporterIP]
+	if !ok {
+		agentIP = exporterIP
+	}
+	agentPort := c.config.Ports.LookupOrDefault(agentIP, 161)
+	ifIndexes, err := lister.InterfaceIndexes(c.t.Context(nil), exporterIP, agentIP, agentPort)
+	if err != nil || len(ifIndexes) == 0 {
+		return false
+	}
+
+	if exporter, ok := c.sc.Exporter(exporterIP); ok {
+		missing := ifIndexes[:0]
+		for _, ifIndex := range ifIndexes {
+			if _, ok := exporter.Interfaces[ifIndex]; !ok {
+				missing = append(missing, ifIndex)
+			}
+		}
+		ifIndexes = missing
+	}
+	chunk := c.config.PollerCoalesce
+	if chunk < 1 {
+		chunk = 1
+	}
+	for len(ifIndexes) > 0 {
+		n := chunk
+		if n > len(ifIndexes) {
+			n = len(ifIndexes)
+		}
+		c.pollerIncomingRequest(lookupRequest{exporterIP, ifIndexes[:n]})
+		ifIndexes = ifIndexes[n:]
+	}
+	return true
+}
+
+// DiscoveredExporters returns the addresses of the exporters found by
+// scanning the discovery subnets, sorted.
+func (c *Component) DiscoveredExporters() []netip.Addr {
+	c.discoveredLock.Lock()
+	defer c.discoveredLock.Unlock()
+	result := make([]netip.Addr, 0, len(c.discovered))
+	for exporterIP := range c.discovered {
+		result = append(result, exporterIP)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Less(result[j])
+	})
+	return result
+}
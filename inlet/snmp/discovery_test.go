@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestNormalizeDiscoverySubnets(t *testing.T) {
+	subnets := []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.10/24"),
+		netip.MustParsePrefix("2001:db8::/112"),
+	}
+	if err := normalizeDiscoverySubnets(subnets); err != nil {
+		t.Fatalf("normalizeDiscoverySubnets() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(subnets, []netip.Prefix{
+		netip.MustParsePrefix("::ffff:192.0.2.0/120"),
+		netip.MustParsePrefix("2001:db8::/112"),
+	}); diff != "" {
+		t.Fatalf("normalizeDiscoverySubnets() (-got, +want):\n%s", diff)
+	}
+
+	if err := normalizeDiscoverySubnets([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}); err == nil {
+		t.Fatal("normalizeDiscoverySubnets() did not error")
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Communities, _ = helpers.NewSubnetMap(map[string]string{
+		"::/0":                 "private",
+		"::ffff:127.0.0.2/128": "public",
+	})
+	configuration.DiscoverySubnets = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/30")}
+	c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	time.Sleep(30 * time.Millisecond)
+
+	exporterIP := netip.MustParseAddr("::ffff:127.0.0.2")
+	if diff := helpers.Diff(c.DiscoveredExporters(), []netip.Addr{exporterIP}); diff != "" {
+		t.Fatalf("DiscoveredExporters() (-got, +want):\n%s", diff)
+	}
+	got, _ := c.Exporter(exporterIP)
+	if diff := helpers.Diff(got, Exporter{
+		Name: "127_0_0_2",
+		Interfaces: map[uint]Interface{
+			1: {Name: "Gi0/0/1", Description: "Interface 1", Speed: 1000},
+			2: {Name: "Gi0/0/2", Description: "Interface 2", Speed: 1000},
+			3: {Name: "Gi0/0/3", Description: "Interface 3", Speed: 1000},
+		},
+	}); diff != "" {
+		t.Fatalf("Exporter() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_snmp_", "discover")
+	expectedMetrics := map[string]string{
+		`discovered_exporters`: "1",
+		`discovery_runs`:       "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -22,11 +22,24 @@ type poller interface {
 	Poll(ctx context.Context, exporterIP, agentIP netip.Addr, port uint16, ifIndexes []uint) error
 }
 
+// interfaceLister is implemented by pollers able to list the
+// interfaces of an exporter. It is needed for discovery.
+type interfaceLister interface {
+	InterfaceIndexes(ctx context.Context, exporterIP, agentIP netip.Addr, port uint16) ([]uint, error)
+}
+
+// credentialsSetter is implemented by pollers whose credentials can be
+// updated while running.
+type credentialsSetter interface {
+	SetCredentials(communities *helpers.SubnetMap[string], securityParameters *helpers.SubnetMap[SecurityParameters])
+}
+
 // realPoller will poll exporters using real SNMP requests.
 type realPoller struct {
-	r      *reporter.Reporter
-	config pollerConfig
-	clock  clock.Clock
+	r          *reporter.Reporter
+	config     pollerConfig
+	configLock sync.RWMutex
+	clock      clock.Clock
 
 	pendingRequests     map[string]struct{}
 	pendingRequestsLock sync.Mutex
@@ -92,9 +105,19 @@ func newPoller(r *reporter.Reporter, config pollerConfig, clock clock.Clock, put
 	return p
 }
 
+// SetCredentials replaces the communities and the security parameters
+// used by the poller.
+func (p *realPoller) SetCredentials(communities *helpers.SubnetMap[string], securityParameters *helpers.SubnetMap[SecurityParameters]) {
+	p.configLock.Lock()
+	defer p.configLock.Unlock()
+	p.config.Communities = communities
+	p.config.SecurityParameters = securityParameters
+}
+
 func (p *realPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port uint16, ifIndexes []uint) error {
 	// Check if already have a request running
 	exporterStr := exporter.Unmap().String()
+	exporterLabel := p.r.ExporterLabel(exporterStr)
 	filteredIfIndexes := make([]uint, 0, len(ifIndexes))
 	keys := make([]string, 0, len(ifIndexes))
 	p.pendingRequestsLock.Lock()
@@ -120,52 +143,9 @@ func (p *realPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port
 		p.pendingRequestsLock.Unlock()
 	}()
 
-	// Instantiate an SNMP state
-	g := &gosnmp.GoSNMP{
-		Context:                 ctx,
-		Target:                  agent.Unmap().String(),
-		Port:                    port,
-		Retries:                 p.config.Retries,
-		Timeout:                 p.config.Timeout,
-		UseUnconnectedUDPSocket: true,
-		Logger:                  gosnmp.NewLogger(&goSNMPLogger{p.r}),
-		OnRetry: func(*gosnmp.GoSNMP) {
-			p.metrics.retries.WithLabelValues(exporterStr).Inc()
-		},
-	}
-	if securityParameters, ok := p.config.SecurityParameters.Lookup(exporter); ok {
-		g.Version = gosnmp.Version3
-		g.SecurityModel = gosnmp.UserSecurityModel
-		usmSecurityParameters := gosnmp.UsmSecurityParameters{
-			UserName:                 securityParameters.UserName,
-			AuthenticationProtocol:   gosnmp.SnmpV3AuthProtocol(securityParameters.AuthenticationProtocol),
-			AuthenticationPassphrase: securityParameters.AuthenticationPassphrase,
-			PrivacyProtocol:          gosnmp.SnmpV3PrivProtocol(securityParameters.PrivacyProtocol),
-			PrivacyPassphrase:        securityParameters.PrivacyPassphrase,
-		}
-		g.SecurityParameters = &usmSecurityParameters
-		if usmSecurityParameters.AuthenticationProtocol == gosnmp.NoAuth {
-			if usmSecurityParameters.PrivacyProtocol == gosnmp.NoPriv {
-				g.MsgFlags = gosnmp.NoAuthNoPriv
-			} else {
-				// Not possible
-				g.MsgFlags = gosnmp.NoAuthNoPriv
-			}
-		} else {
-			if usmSecurityParameters.PrivacyProtocol == gosnmp.NoPriv {
-				g.MsgFlags = gosnmp.AuthNoPriv
-			} else {
-				g.MsgFlags = gosnmp.AuthPriv
-			}
-		}
-		g.ContextName = securityParameters.ContextName
-	} else {
-		g.Version = gosnmp.Version2c
-		g.Community = p.config.Communities.LookupOrDefault(exporter, "public")
-	}
-
+	g := p.newSession(ctx, exporter, agent, port)
 	if err := g.Connect(); err != nil {
-		p.metrics.failures.WithLabelValues(exporterStr, "connect").Inc()
+		p.metrics.failures.WithLabelValues(exporterLabel, "connect").Inc()
 		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to connect")
 	}
 	start := p.clock.Now()
@@ -183,7 +163,7 @@ func (p *realPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port
 		return nil
 	}
 	if err != nil {
-		p.metrics.failures.WithLabelValues(exporterStr, "get").Inc()
+		p.metrics.failures.WithLabelValues(exporterLabel, "get").Inc()
 		p.errLogger.Err(err).
 			Str("exporter", exporterStr).
 			Msgf("unable to GET (%d OIDs)", len(requests))
@@ -191,7 +171,7 @@ func (p *realPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port
 	}
 	if result.Error != gosnmp.NoError && result.ErrorIndex == 0 {
 		// There is some error affecting the whole request
-		p.metrics.failures.WithLabelValues(exporterStr, "get").Inc()
+		p.metrics.failures.WithLabelValues(exporterLabel, "get").Inc()
 		p.errLogger.Error().
 			Str("exporter", exporterStr).
 			Stringer("code", result.Error).
@@ -205,11 +185,11 @@ func (p *realPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port
 			*target = string(result.Variables[idx].Value.([]byte))
 		case gosnmp.NoSuchInstance, gosnmp.NoSuchObject:
 			if mandatory {
-				p.metrics.failures.WithLabelValues(exporterStr, fmt.Sprintf("%s missing", what)).Inc()
+				p.metrics.failures.WithLabelValues(exporterLabel, fmt.Sprintf("%s missing", what)).Inc()
 				return false
 			}
 		default:
-			p.metrics.failures.WithLabelValues(exporterStr, fmt.Sprintf("%s unknown type", what)).Inc()
+			p.metrics.failures.WithLabelValues(exporterLabel, fmt.Sprintf("%s unknown type", what)).Inc()
 			return false
 		}
 		return true
@@ -220,11 +200,11 @@ func (p *realPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port
 			*target = result.Variables[idx].Value.(uint)
 		case gosnmp.NoSuchInstance, gosnmp.NoSuchObject:
 			if mandatory {
-				p.metrics.failures.WithLabelValues(exporterStr, fmt.Sprintf("%s missing", what)).Inc()
+				p.metrics.failures.WithLabelValues(exporterLabel, fmt.Sprintf("%s missing", what)).Inc()
 				return false
 			}
 		default:
-			p.metrics.failures.WithLabelValues(exporterStr, fmt.Sprintf("%s unknown type", what)).Inc()
+			p.metrics.failures.WithLabelValues(exporterLabel, fmt.Sprintf("%s unknown type", what)).Inc()
 			return false
 		}
 		return true
@@ -258,13 +238,89 @@ func (p *realPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port
 			Description: ifAliasVal,
 			Speed:       ifSpeedVal,
 		})
-		p.metrics.successes.WithLabelValues(exporterStr).Inc()
+		p.metrics.successes.WithLabelValues(exporterLabel).Inc()
 	}
 
-	p.metrics.times.WithLabelValues(exporterStr).Observe(p.clock.Now().Sub(start).Seconds())
+	p.metrics.times.WithLabelValues(exporterLabel).Observe(p.clock.Now().Sub(start).Seconds())
 	return nil
 }
 
+// InterfaceIndexes walks the interface table of an exporter and
+// returns the indexes of its interfaces.
+func (p *realPoller) InterfaceIndexes(ctx context.Context, exporter, agent netip.Addr, port uint16) ([]uint, error) {
+	exporterStr := exporter.Unmap().String()
+	exporterLabel := p.r.ExporterLabel(exporterStr)
+	g := p.newSession(ctx, exporter, agent, port)
+	if err := g.Connect(); err != nil {
+		p.metrics.failures.WithLabelValues(exporterLabel, "connect").Inc()
+		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to connect")
+	}
+	ifIndexes := []uint{}
+	err := g.BulkWalk("1.3.6.1.2.1.2.2.1.1", func(pdu gosnmp.SnmpPDU) error { // ifIndex
+		if pdu.Type != gosnmp.Integer {
+			return fmt.Errorf("unexpected type %s for ifIndex", pdu.Type)
+		}
+		ifIndexes = append(ifIndexes, uint(gosnmp.ToBigInt(pdu.Value).Uint64()))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ifIndexes, nil
+}
+
+// newSession instantiates an SNMP state to query the provided agent
+// on behalf of the provided exporter.
+func (p *realPoller) newSession(ctx context.Context, exporter, agent netip.Addr, port uint16) *gosnmp.GoSNMP {
+	exporterLabel := p.r.ExporterLabel(exporter.Unmap().String())
+	g := &gosnmp.GoSNMP{
+		Context:                 ctx,
+		Target:                  agent.Unmap().String(),
+		Port:                    port,
+		Retries:                 p.config.Retries,
+		Timeout:                 p.config.Timeout,
+		UseUnconnectedUDPSocket: true,
+		Logger:                  gosnmp.NewLogger(&goSNMPLogger{p.r}),
+		OnRetry: func(*gosnmp.GoSNMP) {
+			p.metrics.retries.WithLabelValues(exporterLabel).Inc()
+		},
+	}
+	p.configLock.RLock()
+	communities, allSecurityParameters := p.config.Communities, p.config.SecurityParameters
+	p.configLock.RUnlock()
+	if securityParameters, ok := allSecurityParameters.Lookup(exporter); ok {
+		g.Version = gosnmp.Version3
+		g.SecurityModel = gosnmp.UserSecurityModel
+		usmSecurityParameters := gosnmp.UsmSecurityParameters{
+			UserName:                 securityParameters.UserName,
+			AuthenticationProtocol:   gosnmp.SnmpV3AuthProtocol(securityParameters.AuthenticationProtocol),
+			AuthenticationPassphrase: securityParameters.AuthenticationPassphrase,
+			PrivacyProtocol:          gosnmp.SnmpV3PrivProtocol(securityParameters.PrivacyProtocol),
+			PrivacyPassphrase:        securityParameters.PrivacyPassphrase,
+		}
+		g.SecurityParameters = &usmSecurityParameters
+		if usmSecurityParameters.AuthenticationProtocol == gosnmp.NoAuth {
+			if usmSecurityParameters.PrivacyProtocol == gosnmp.NoPriv {
+				g.MsgFlags = gosnmp.NoAuthNoPriv
+			} else {
+				// Not possible
+				g.MsgFlags = gosnmp.NoAuthNoPriv
+			}
+		} else {
+			if usmSecurityParameters.PrivacyProtocol == gosnmp.NoPriv {
+				g.MsgFlags = gosnmp.AuthNoPriv
+			} else {
+				g.MsgFlags = gosnmp.AuthPriv
+			}
+		}
+		g.ContextName = securityParameters.ContextName
+	} else {
+		g.Version = gosnmp.Version2c
+		g.Community = communities.LookupOrDefault(exporter, "public")
+	}
+	return g
+}
+
 type goSNMPLogger struct {
 	r *reporter.Reporter
 }
@@ -119,6 +119,24 @@ func TestPoller(t *testing.T) {
 								OnGet: func() (interface{}, error) {
 									return "exporter62", nil
 								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.1.641",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 641, nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.1.642",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 642, nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.1.643",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 643, nil
+								},
 							}, {
 								OID:  "1.3.6.1.2.1.2.2.1.2.641",
 								Type: gosnmp.OctetString,
@@ -216,6 +234,14 @@ func TestPoller(t *testing.T) {
 			if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 				t.Fatalf("Metrics (-got, +want):\n%s", diff)
 			}
+
+			ifIndexes, err := p.InterfaceIndexes(context.Background(), lo, lo, uint16(port))
+			if err != nil {
+				t.Fatalf("InterfaceIndexes() error:\n%+v", err)
+			}
+			if diff := helpers.Diff(ifIndexes, []uint{641, 642, 643}); diff != "" {
+				t.Fatalf("InterfaceIndexes() (-got, +want):\n%s", diff)
+			}
 		})
 	}
 }
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"time"
+)
+
+// remapNegativeTTL is how long we wait before searching again for an
+// interface which was not found by name.
+const remapNegativeTTL = time.Minute
+
+// IfIndexRemapping describes how to translate the ifIndex found in
+// flows to the ifIndex used by SNMP, for platforms where they do not
+// match.
+type IfIndexRemapping struct {
+	// Offset is added to the ifIndex found in flows
+	Offset int
+	// NameRegex is matched against the name of the interface found
+	// after applying the offset
+	NameRegex InterfaceRegex
+	// NameReplacement is the template for the name of the interface
+	// to use instead when NameRegex matches (for example, "$1" or
+	// "${physical}")
+	NameReplacement string
+}
+
+// InterfaceRegex is a compiled regular expression matching an
+// interface name.
+type InterfaceRegex struct {
+	*regexp.Regexp
+}
+
+// UnmarshalText compiles a regular expression matching an interface
+// name.
+func (ir *InterfaceRegex) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return errors.New("empty regular expression")
+	}
+	compiled, err := regexp.Compile(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid regular expression %q: %w", string(text), err)
+	}
+	ir.Regexp = compiled
+	return nil
+}
+
+// String turns an interface regex into a string.
+func (ir InterfaceRegex) String() string {
+	if ir.Regexp == nil {
+		return ""
+	}
+	return ir.Regexp.String()
+}
+
+// MarshalText turns an interface regex into a string.
+func (ir InterfaceRegex) MarshalText() ([]byte, error) {
+	return []byte(ir.String()), nil
+}
+
+// remapKey identifies an interface whose name has been remapped.
+type remapKey struct {
+	exporterIP netip.Addr
+	ifIndex    uint
+}
+
+// remapEntry is the result of a remapping by name. The ifIndex is 0
+// when no interface was found.
+type remapEntry struct {
+	ifIndex uint
+	expires time.Time
+}
+
+// remappedName returns the name of the interface to use instead of
+// the provided one, or an empty string if the remapping rule does
+// not apply.
+func (rm IfIndexRemapping) remappedName(name string) string {
+	if rm.NameRegex.Regexp == nil || rm.NameReplacement == "" {
+		return ""
+	}
+	indexes := rm.NameRegex.FindStringSubmatchIndex(name)
+	if indexes == nil {
+		return ""
+	}
+	remapped := string(rm.NameRegex.ExpandString(nil, rm.NameReplacement, name, indexes))
+	if remapped == name {
+		return ""
+	}
+	return remapped
+}
+
+// remapOffset applies the offset of the remapping rule of the
+// exporter to the provided ifIndex.
+func (c *Component) remapOffset(exporterIP netip.Addr, ifIndex uint) (uint, IfIndexRemapping, bool) {
+	remapping, ok := c.config.IfIndexRemapping.Lookup(exporterIP)
+	if !ok {
+		return ifIndex, remapping, false
+	}
+	if remapping.Offset != 0 {
+		remapped := int64(ifIndex) + int64(remapping.Offset)
+		if remapped > 0 {
+			ifIndex = uint(remapped)
+		}
+	}
+	return ifIndex, remapping, true
+}
+
+// remapByName returns the interface to use instead of the provided
+// one, using the name of the interface. When the target interface is
+// not known, the interfaces of the exporter are walked and the
+// provided interface is returned.
+func (c *Component) remapByName(exporterIP netip.Addr, ifIndex uint, iface Interface, remapping IfIndexRemapping, poll bool) Interface {
+	name := remapping.remappedName(iface.Name)
+	if name == "" {
+		return iface
+	}
+	key := remapKey{exporterIP, ifIndex}
+	now := c.d.Clock.Now()
+	c.remapLock.Lock()
+	entry, ok := c.remapped[key]
+	if !ok || (entry.ifIndex == 0 && now.After(entry.expires)) {
+		entry = remapEntry{expires: now.Add(remapNegativeTTL)}
+		if target, found := c.sc.FindByName(exporterIP, name); found {
+			entry.ifIndex = target
+		} else if poll {
+			select {
+			case c.walkChannel <- exporterIP:
+			default:
+			}
+		}
+		c.remapped[key] = entry
+	}
+	c.remapLock.Unlock()
+	if entry.ifIndex == 0 {
+		c.metrics.remapMisses.WithLabelValues(c.r.ExporterLabel(exporterIP.Unmap().String())).Inc()
+		return iface
+	}
+	_, target, err := c.sc.Lookup(exporterIP, entry.ifIndex)
+	if err != nil {
+		// The target interface has expired from the cache.
+		c.remapLock.Lock()
+		delete(c.remapped, key)
+		c.remapLock.Unlock()
+		if poll {
+			select {
+			case c.dispatcherChannel <- lookupRequest{exporterIP, []uint{entry.ifIndex}}:
+			default:
+			}
+		}
+		return iface
+	}
+	return target
+}
+
+// runWalker walks the interfaces of the exporters requiring a
+// remapping by name, at most once per cache check interval.
+func (c *Component) runWalker() error {
+	walked := map[netip.Addr]time.Time{}
+	for {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case exporterIP := <-c.walkChannel:
+			now := c.d.Clock.Now()
+			if last, ok := walked[exporterIP]; ok && now.Sub(last) < c.config.CacheCheckInterval {
+				continue
+			}
+			walked[exporterIP] = now
+			c.pollAllInterfaces(exporterIP)
+			// Search again the interfaces not found previously
+			c.remapLock.Lock()
+			for key, entry := range c.remapped {
+				if key.exporterIP == exporterIP && entry.ifIndex == 0 {
+					delete(c.remapped, key)
+				}
+			}
+			c.remapLock.Unlock()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mitchellh/mapstructure"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestRemappedName(t *testing.T) {
+	var regex InterfaceRegex
+	if err := regex.UnmarshalText([]byte(`^(?P<physical>[^.]+)\.\d+$`)); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	remapping := IfIndexRemapping{NameRegex: regex, NameReplacement: "${physical}"}
+	cases := []struct {
+		Name     string
+		Expected string
+	}{
+		{"xe-0/0/1.100", "xe-0/0/1"},
+		{"xe-0/0/1", ""},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		if got := remapping.remappedName(tc.Name); got != tc.Expected {
+			t.Errorf("remappedName(%q) == %q, expected %q", tc.Name, got, tc.Expected)
+		}
+	}
+
+	if err := regex.UnmarshalText([]byte("")); err == nil {
+		t.Error("UnmarshalText(\"\") did not error")
+	}
+	if err := regex.UnmarshalText([]byte("^xe-(")); err == nil {
+		t.Error("UnmarshalText(\"^xe-(\") did not error")
+	}
+}
+
+func TestIfIndexRemappingDecode(t *testing.T) {
+	configuration := DefaultConfiguration()
+	decoder, err := mapstructure.NewDecoder(helpers.GetMapStructureDecoderConfig(&configuration))
+	if err != nil {
+		t.Fatalf("NewDecoder() error:\n%+v", err)
+	}
+	if err := decoder.Decode(gin.H{
+		"ifindex-remapping": gin.H{
+			"192.0.2.0/24": gin.H{
+				"offset":           -1000,
+				"name-regex":       `^(.*)\.\d+$`,
+				"name-replacement": "$1",
+			},
+		},
+	}); err != nil {
+		t.Fatalf("Decode() error:\n%+v", err)
+	}
+	got, ok := configuration.IfIndexRemapping.Lookup(netip.MustParseAddr("::ffff:192.0.2.10"))
+	if !ok {
+		t.Fatal("Lookup() did not find remapping")
+	}
+	if got.Offset != -1000 || got.NameRegex.String() != `^(.*)\.\d+$` || got.NameReplacement != "$1" {
+		t.Fatalf("Lookup() == %+v", got)
+	}
+}
+
+func TestIfIndexRemapping(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	var regex InterfaceRegex
+	if err := regex.UnmarshalText([]byte(`^Gi0/0/(\d)\d\d$`)); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	configuration.IfIndexRemapping = helpers.MustNewSubnetMap(map[string]IfIndexRemapping{
+		"::ffff:127.0.0.1/128": {Offset: -1000},
+		"::ffff:127.0.0.2/128": {NameRegex: regex, NameReplacement: "Gi0/0/$1"},
+	})
+	c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+
+	// Offset
+	expectSNMPLookup(t, c, "127.0.0.1", 1005, answer{Err: ErrCacheMiss})
+	time.Sleep(30 * time.Millisecond)
+	expectSNMPLookup(t, c, "127.0.0.1", 1005, answer{
+		ExporterName: "127_0_0_1",
+		Interface:    Interface{Name: "Gi0/0/5", Description: "Interface 5", Speed: 1000},
+	})
+
+	// Name: the target interface is not known yet, the interfaces
+	// of the exporter are walked.
+	expectSNMPLookup(t, c, "127.0.0.2", 205, answer{Err: ErrCacheMiss})
+	time.Sleep(30 * time.Millisecond)
+	expectSNMPLookup(t, c, "127.0.0.2", 205, answer{
+		ExporterName: "127_0_0_2",
+		Interface:    Interface{Name: "Gi0/0/205", Description: "Interface 205", Speed: 1000},
+	})
+	time.Sleep(30 * time.Millisecond)
+	expectSNMPLookup(t, c, "127.0.0.2", 205, answer{
+		ExporterName: "127_0_0_2",
+		Interface:    Interface{Name: "Gi0/0/2", Description: "Interface 2", Speed: 1000},
+	})
+	// Interfaces not matching the regex are untouched.
+	expectSNMPLookup(t, c, "127.0.0.2", 3, answer{
+		ExporterName: "127_0_0_2",
+		Interface:    Interface{Name: "Gi0/0/3", Description: "Interface 3", Speed: 1000},
+	})
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_snmp_", "remap")
+	expectedMetrics := map[string]string{
+		`remap_misses{exporter="127.0.0.2"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -7,11 +7,14 @@
 package snmp
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/netip"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/benbjohnson/clock"
@@ -19,6 +22,7 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/reporter"
 )
 
@@ -39,6 +43,14 @@ type Component struct {
 	pollerBreakerLoggers map[netip.Addr]reporter.Logger
 	pollerBreakers       map[netip.Addr]*breaker.Breaker
 	poller               poller
+	cacheState           atomic.Pointer[reporter.HealthcheckResult]
+	pollNotifiersLock    sync.Mutex
+	pollNotifiers        []chan<- netip.Addr
+	discoveredLock       sync.Mutex
+	discovered           map[netip.Addr]struct{}
+	remapLock            sync.Mutex
+	remapped             map[remapKey]remapEntry
+	walkChannel          chan netip.Addr
 
 	metrics struct {
 		cacheRefreshRuns       reporter.Counter
@@ -46,6 +58,9 @@ type Component struct {
 		pollerBusyCount        *reporter.CounterVec
 		pollerCoalescedCount   reporter.Counter
 		pollerBreakerOpenCount *reporter.CounterVec
+		discoveryRuns          reporter.Counter
+		discoveredExporters    reporter.GaugeFunc
+		remapMisses            *reporter.CounterVec
 	}
 }
 
@@ -63,13 +78,14 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 	if configuration.CacheDuration < configuration.CacheCheckInterval {
 		return nil, errors.New("cache duration must be greater than cache check interval")
 	}
-	for exporterIP, agentIP := range configuration.Agents {
-		if exporterIP.Is4() || agentIP.Is4() {
-			delete(configuration.Agents, exporterIP)
-			exporterIP = netip.AddrFrom16(exporterIP.As16())
-			agentIP = netip.AddrFrom16(agentIP.As16())
-			configuration.Agents[exporterIP] = agentIP
-		}
+	normalizeAgents(configuration.Agents)
+	if err := normalizeDiscoverySubnets(configuration.DiscoverySubnets); err != nil {
+		return nil, err
+	}
+	communities, securityParameters, err := resolveCredentials(
+		configuration.Communities, configuration.SecurityParameters)
+	if err != nil {
+		return nil, err
 	}
 
 	if dependencies.Clock == nil {
@@ -87,14 +103,18 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		dispatcherBChannel:   make(chan (<-chan bool)),
 		pollerBreakers:       make(map[netip.Addr]*breaker.Breaker),
 		pollerBreakerLoggers: make(map[netip.Addr]reporter.Logger),
+		discovered:           make(map[netip.Addr]struct{}),
+		remapped:             make(map[remapKey]remapEntry),
+		walkChannel:          make(chan netip.Addr, 10),
 		poller: newPoller(r, pollerConfig{
 			Retries:            configuration.PollerRetries,
 			Timeout:            configuration.PollerTimeout,
-			Communities:        configuration.Communities,
-			SecurityParameters: configuration.SecurityParameters,
+			Communities:        communities,
+			SecurityParameters: securityParameters,
 		}, dependencies.Clock, sc.Put),
 	}
 	c.d.Daemon.Track(&c.t, "inlet/snmp")
+	c.r.RegisterReadinessCheck("snmp", c.cacheCheck)
 
 	c.metrics.cacheRefreshRuns = r.Counter(
 		reporter.CounterOpts{
@@ -123,19 +143,69 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 			Help: "Poller breaker was opened due to too many errors.",
 		},
 		[]string{"exporter"})
+	c.metrics.discoveryRuns = r.Counter(
+		reporter.CounterOpts{
+			Name: "discovery_runs",
+			Help: "Number of scans of the discovery subnets.",
+		})
+	c.metrics.discoveredExporters = r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "discovered_exporters",
+			Help: "Number of exporters found by scanning the discovery subnets.",
+		}, func() float64 {
+			c.discoveredLock.Lock()
+			defer c.discoveredLock.Unlock()
+			return float64(len(c.discovered))
+		})
+	c.metrics.remapMisses = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "remap_misses",
+			Help: "Interfaces whose remapped name was not found.",
+		},
+		[]string{"exporter"})
 	return &c, nil
 }
 
+// normalizeAgents turns IPv4 addresses in the agent mapping to
+// IPv4-mapped IPv6 addresses.
+func normalizeAgents(agents map[netip.Addr]netip.Addr) {
+	for exporterIP, agentIP := range agents {
+		if exporterIP.Is4() || agentIP.Is4() {
+			delete(agents, exporterIP)
+			exporterIP = netip.AddrFrom16(exporterIP.As16())
+			agentIP = netip.AddrFrom16(agentIP.As16())
+			agents[exporterIP] = agentIP
+		}
+	}
+}
+
+// cacheCheck reports if the cache was loaded. A cache which cannot be
+// loaded is only a warning as it will be populated again.
+func (c *Component) cacheCheck(_ context.Context) reporter.HealthcheckResult {
+	if state := c.cacheState.Load(); state != nil {
+		return *state
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckError, Reason: "cache not loaded yet"}
+}
+
 // Start starts the SNMP component.
 func (c *Component) Start() error {
 	c.r.Info().Msg("starting SNMP component")
 
 	// Load cache
+	cacheState := reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "cache loaded"}
 	if c.config.CachePersistFile != "" {
 		if err := c.sc.Load(c.config.CachePersistFile); err != nil {
 			c.r.Err(err).Msg("cannot load cache, ignoring")
+			if !errors.Is(err, fs.ErrNotExist) {
+				cacheState = reporter.HealthcheckResult{
+					Status: reporter.HealthcheckWarning,
+					Reason: fmt.Sprintf("cannot load cache: %s", err),
+				}
+			}
 		}
 	}
+	c.cacheState.Store(&cacheState)
 
 	// Goroutine to refresh the cache
 	healthyTicker := make(chan reporter.ChannelHealthcheckFunc)
@@ -204,6 +274,14 @@ func (c *Component) Start() error {
 			}
 		})
 	}
+
+	// Goroutine to scan the discovery subnets
+	if len(c.config.DiscoverySubnets) > 0 {
+		c.t.Go(c.runDiscovery)
+	}
+
+	// Goroutine to walk exporters needing a remapping by name
+	c.t.Go(c.runWalker)
 	return nil
 }
 
@@ -225,6 +303,29 @@ func (c *Component) Stop() error {
 	return c.t.Wait()
 }
 
+// Reload applies the changes to SNMP credentials (communities and
+// security parameters) from the provided configuration. It returns the
+// other settings which were modified and need a restart.
+func (c *Component) Reload(configuration Configuration) ([]string, error) {
+	normalizeAgents(configuration.Agents)
+	if err := normalizeDiscoverySubnets(configuration.DiscoverySubnets); err != nil {
+		return nil, err
+	}
+	communities, securityParameters, err := resolveCredentials(
+		configuration.Communities, configuration.SecurityParameters)
+	if err != nil {
+		return nil, err
+	}
+	restart := helpers.ChangedFields(c.config, configuration,
+		"Communities", "SecurityParameters")
+	if p, ok := c.poller.(credentialsSetter); ok {
+		p.SetCredentials(communities, securityParameters)
+	}
+	c.config.Communities = configuration.Communities
+	c.config.SecurityParameters = configuration.SecurityParameters
+	return restart, nil
+}
+
 // lookupRequest is used internally to queue a polling request.
 type lookupRequest struct {
 	ExporterIP netip.Addr
@@ -235,8 +336,25 @@ type lookupRequest struct {
 // If the information is not in the cache, it will be polled, but
 // won't be returned immediately.
 func (c *Component) Lookup(exporterIP netip.Addr, ifIndex uint) (string, Interface, error) {
+	return c.lookup(exporterIP, ifIndex, true)
+}
+
+// LookupCached is like Lookup but it does not poll the interfaces
+// missing from the cache.
+func (c *Component) LookupCached(exporterIP netip.Addr, ifIndex uint) (string, Interface, error) {
+	return c.lookup(exporterIP, ifIndex, false)
+}
+
+// lookup looks up the cache for the provided exporter and ifIndex,
+// after remapping the ifIndex. When poll is true, missing interfaces
+// are polled.
+func (c *Component) lookup(exporterIP netip.Addr, ifIndex uint, poll bool) (string, Interface, error) {
+	ifIndex, remapping, remap := c.remapOffset(exporterIP, ifIndex)
 	exporterName, iface, err := c.sc.Lookup(exporterIP, ifIndex)
-	if errors.Is(err, ErrCacheMiss) {
+	if err == nil && remap {
+		iface = c.remapByName(exporterIP, ifIndex, iface, remapping, poll)
+	}
+	if poll && errors.Is(err, ErrCacheMiss) {
 		req := lookupRequest{
 			ExporterIP: exporterIP,
 			IfIndexes:  []uint{ifIndex},
@@ -244,12 +362,29 @@ func (c *Component) Lookup(exporterIP netip.Addr, ifIndex uint) (string, Interfa
 		select {
 		case c.dispatcherChannel <- req:
 		default:
-			c.metrics.pollerBusyCount.WithLabelValues(exporterIP.Unmap().String()).Inc()
+			c.metrics.pollerBusyCount.WithLabelValues(c.r.ExporterLabel(exporterIP.Unmap().String())).Inc()
 		}
 	}
 	return exporterName, iface, err
 }
 
+// Exporter returns the information known about an exporter and its
+// interfaces. It does not trigger any polling.
+func (c *Component) Exporter(exporterIP netip.Addr) (Exporter, bool) {
+	return c.sc.Exporter(exporterIP)
+}
+
+// FlushCache removes all entries from the cache. They will be polled
+// again when needed. It returns the number of removed entries.
+func (c *Component) FlushCache() uint {
+	count := c.sc.Flush()
+	c.remapLock.Lock()
+	c.remapped = make(map[remapKey]remapEntry)
+	c.remapLock.Unlock()
+	c.r.Info().Uint("count", count).Msg("SNMP cache flushed")
+	return count
+}
+
 // Dispatch an incoming request to workers. May handle more than the
 // provided request if it can.
 func (c *Component) dispatchIncomingRequest(request lookupRequest) {
@@ -327,6 +462,29 @@ func (c *Component) pollerIncomingRequest(request lookupRequest) {
 		l.Warn().Msg("poller breaker open")
 		c.pollerBreakersLock.Unlock()
 	}
+	c.notifyPolled(request.ExporterIP)
+}
+
+// NotifyPolled registers a channel receiving the address of an
+// exporter each time it has been polled, successfully or not. The
+// notification is dropped when the channel is full.
+func (c *Component) NotifyPolled(ch chan<- netip.Addr) {
+	c.pollNotifiersLock.Lock()
+	defer c.pollNotifiersLock.Unlock()
+	c.pollNotifiers = append(c.pollNotifiers, ch)
+}
+
+// notifyPolled notifies the registered channels an exporter has been
+// polled.
+func (c *Component) notifyPolled(exporterIP netip.Addr) {
+	c.pollNotifiersLock.Lock()
+	defer c.pollNotifiersLock.Unlock()
+	for _, ch := range c.pollNotifiers {
+		select {
+		case ch <- exporterIP:
+		default:
+		}
+	}
 }
 
 // expireCache handles cache expiration and refresh.
@@ -346,7 +504,7 @@ func (c *Component) expireCache() {
 				}:
 					count++
 				default:
-					c.metrics.pollerBusyCount.WithLabelValues(exporter.Unmap().String()).Inc()
+					c.metrics.pollerBusyCount.WithLabelValues(c.r.ExporterLabel(exporter.Unmap().String())).Inc()
 				}
 			}
 		}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"net/netip"
+	"os"
 	"path/filepath"
 	"sync"
 	"testing"
@@ -41,6 +42,27 @@ func TestLookup(t *testing.T) {
 	})
 }
 
+func TestNotifyPolled(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+	polled := make(chan netip.Addr, 1)
+	c.NotifyPolled(polled)
+
+	expectSNMPLookup(t, c, "127.0.0.1", 765, answer{Err: ErrCacheMiss})
+	select {
+	case got := <-polled:
+		if diff := helpers.Diff(got, netip.MustParseAddr("::ffff:127.0.0.1")); diff != "" {
+			t.Fatalf("NotifyPolled() (-got, +want):\n%s", diff)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("NotifyPolled() did not notify")
+	}
+	expectSNMPLookup(t, c, "127.0.0.1", 765, answer{
+		ExporterName: "127_0_0_1",
+		Interface:    Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	})
+}
+
 func TestSNMPCommunities(t *testing.T) {
 	r := reporter.NewMock(t)
 	configuration := DefaultConfiguration()
@@ -70,6 +92,40 @@ func TestSNMPCommunities(t *testing.T) {
 	expectSNMPLookup(t, c, "127.0.0.3", 765, answer{Err: ErrCacheMiss})
 }
 
+func TestReload(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Communities, _ = helpers.NewSubnetMap(map[string]string{
+		"::/0": "private",
+	})
+	c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+
+	// Use "private" as a community. Should not work.
+	expectSNMPLookup(t, c, "127.0.0.1", 765, answer{Err: ErrCacheMiss})
+	time.Sleep(30 * time.Millisecond)
+	expectSNMPLookup(t, c, "127.0.0.1", 765, answer{Err: ErrCacheMiss})
+
+	// Switch to "public" and change the number of workers
+	configuration = DefaultConfiguration()
+	configuration.Workers = 2
+	configuration.Agents = map[netip.Addr]netip.Addr{
+		netip.MustParseAddr("192.0.2.1"): netip.MustParseAddr("192.0.2.10"),
+	}
+	restart, err := c.Reload(configuration)
+	if err != nil {
+		t.Fatalf("Reload() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(restart, []string{"workers", "agents"}); diff != "" {
+		t.Errorf("Reload() (-got, +want):\n%s", diff)
+	}
+	expectSNMPLookup(t, c, "127.0.0.2", 765, answer{Err: ErrCacheMiss})
+	time.Sleep(30 * time.Millisecond)
+	expectSNMPLookup(t, c, "127.0.0.2", 765, answer{
+		ExporterName: "127_0_0_2",
+		Interface:    Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	})
+}
+
 func TestComponentSaveLoad(t *testing.T) {
 	configuration := DefaultConfiguration()
 	configuration.CachePersistFile = filepath.Join(t.TempDir(), "cache")
@@ -93,9 +149,38 @@ func TestComponentSaveLoad(t *testing.T) {
 			ExporterName: "127_0_0_1",
 			Interface:    Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
 		})
+		got := r.RunReadinessChecks(context.Background())
+		if diff := helpers.Diff(got.Details["snmp"], reporter.HealthcheckResult{
+			Status: reporter.HealthcheckOK,
+			Reason: "cache loaded",
+		}); diff != "" {
+			t.Fatalf("RunReadinessChecks() (-got, +want):\n%s", diff)
+		}
 	})
 }
 
+func TestCacheCheck(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.CachePersistFile = filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(configuration.CachePersistFile, []byte("garbage"), 0666); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	r := reporter.NewMock(t)
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	got := r.RunReadinessChecks(context.Background())
+	if got.Details["snmp"].Status != reporter.HealthcheckError {
+		t.Fatalf("RunReadinessChecks() == %+v, expected error for snmp", got)
+	}
+	helpers.StartStop(t, c)
+	got = r.RunReadinessChecks(context.Background())
+	if got.Details["snmp"].Status != reporter.HealthcheckWarning {
+		t.Fatalf("RunReadinessChecks() == %+v, expected warning for snmp", got)
+	}
+}
+
 func TestAutoRefresh(t *testing.T) {
 	r := reporter.NewMock(t)
 	configuration := DefaultConfiguration()
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"fmt"
+
+	"akvorado/common/helpers"
+)
+
+// resolveCredentials returns a copy of the communities and of the
+// security parameters with the references to secrets resolved.
+func resolveCredentials(communities *helpers.SubnetMap[string], securityParameters *helpers.SubnetMap[SecurityParameters]) (*helpers.SubnetMap[string], *helpers.SubnetMap[SecurityParameters], error) {
+	if communities != nil {
+		resolved := map[string]string{}
+		for subnet, community := range communities.ToIPv6Map() {
+			value, err := helpers.ResolveSecret(community)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to resolve community for %s: %w", subnet, err)
+			}
+			resolved[subnet] = value
+		}
+		var err error
+		communities, err = helpers.NewSubnetMap(resolved)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if securityParameters != nil {
+		resolved := map[string]SecurityParameters{}
+		for subnet, parameters := range securityParameters.ToIPv6Map() {
+			var err error
+			parameters.AuthenticationPassphrase, err = helpers.ResolveSecret(parameters.AuthenticationPassphrase)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to resolve authentication passphrase for %s: %w", subnet, err)
+			}
+			parameters.PrivacyPassphrase, err = helpers.ResolveSecret(parameters.PrivacyPassphrase)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to resolve privacy passphrase for %s: %w", subnet, err)
+			}
+			resolved[subnet] = parameters
+		}
+		var err error
+		securityParameters, err = helpers.NewSubnetMap(resolved)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return communities, securityParameters, nil
+}
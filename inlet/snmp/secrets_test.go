@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestResolveCredentials(t *testing.T) {
+	t.Setenv("AKVORADO_TEST_COMMUNITY", "private")
+	t.Setenv("AKVORADO_TEST_PASSPHRASE", "authpass")
+
+	communities, securityParameters, err := resolveCredentials(
+		helpers.MustNewSubnetMap(map[string]string{
+			"::/0":                 "public",
+			"::ffff:192.0.2.0/120": "${env:AKVORADO_TEST_COMMUNITY}",
+			"2001:db8::1/128":      "literal",
+		}),
+		helpers.MustNewSubnetMap(map[string]SecurityParameters{
+			"::ffff:198.51.100.0/120": {
+				UserName:                 "alfred",
+				AuthenticationProtocol:   AuthProtocol(1),
+				AuthenticationPassphrase: "${env:AKVORADO_TEST_PASSPHRASE}",
+			},
+		}))
+	if err != nil {
+		t.Fatalf("resolveCredentials() error:\n%+v", err)
+	}
+	expectedCommunities := map[string]string{
+		"::/0":            "public",
+		"192.0.2.0/24":    "private",
+		"2001:db8::1/128": "literal",
+	}
+	if diff := helpers.Diff(communities.ToMap(), expectedCommunities); diff != "" {
+		t.Errorf("resolveCredentials() communities (-got, +want):\n%s", diff)
+	}
+	expectedSecurityParameters := map[string]SecurityParameters{
+		"198.51.100.0/24": {
+			UserName:                 "alfred",
+			AuthenticationProtocol:   AuthProtocol(1),
+			AuthenticationPassphrase: "authpass",
+		},
+	}
+	if diff := helpers.Diff(securityParameters.ToMap(), expectedSecurityParameters); diff != "" {
+		t.Errorf("resolveCredentials() security parameters (-got, +want):\n%s", diff)
+	}
+
+	if _, _, err := resolveCredentials(
+		helpers.MustNewSubnetMap(map[string]string{
+			"::/0": "${env:AKVORADO_TEST_MISSING}",
+		}), nil); err == nil {
+		t.Error("resolveCredentials() did not error with missing secret")
+	}
+}
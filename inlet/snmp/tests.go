@@ -7,9 +7,11 @@ package snmp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/netip"
 	"strings"
+	"sync"
 	"testing"
 
 	"akvorado/common/helpers"
@@ -18,8 +20,9 @@ import (
 
 // mockPoller will use static data.
 type mockPoller struct {
-	config Configuration
-	put    func(netip.Addr, string, uint, Interface)
+	config     Configuration
+	configLock sync.Mutex
+	put        func(netip.Addr, string, uint, Interface)
 }
 
 // newMockPoller creates a fake SNMP poller.
@@ -32,8 +35,11 @@ func newMockPoller(configuration Configuration, put func(netip.Addr, string, uin
 
 // Poll just builds synthetic data.
 func (p *mockPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port uint16, ifIndexes []uint) error {
+	p.configLock.Lock()
+	community := p.config.Communities.LookupOrDefault(exporter, "public")
+	p.configLock.Unlock()
 	for _, ifIndex := range ifIndexes {
-		if p.config.Communities.LookupOrDefault(exporter, "public") == "public" {
+		if community == "public" {
 			p.put(exporter, strings.ReplaceAll(exporter.Unmap().String(), ".", "_"), ifIndex, Interface{
 				Name:        fmt.Sprintf("Gi0/0/%d", ifIndex),
 				Description: fmt.Sprintf("Interface %d", ifIndex),
@@ -44,6 +50,26 @@ func (p *mockPoller) Poll(ctx context.Context, exporter, agent netip.Addr, port
 	return nil
 }
 
+// InterfaceIndexes returns three interfaces for exporters using the
+// "public" community.
+func (p *mockPoller) InterfaceIndexes(ctx context.Context, exporter, agent netip.Addr, port uint16) ([]uint, error) {
+	p.configLock.Lock()
+	community := p.config.Communities.LookupOrDefault(exporter, "public")
+	p.configLock.Unlock()
+	if community != "public" {
+		return nil, errors.New("no answer")
+	}
+	return []uint{1, 2, 3}, nil
+}
+
+// SetCredentials replaces the communities used by the poller.
+func (p *mockPoller) SetCredentials(communities *helpers.SubnetMap[string], securityParameters *helpers.SubnetMap[SecurityParameters]) {
+	p.configLock.Lock()
+	defer p.configLock.Unlock()
+	p.config.Communities = communities
+	p.config.SecurityParameters = securityParameters
+}
+
 // NewMock creates a new SNMP component building synthetic values. It is already started.
 func NewMock(t *testing.T, reporter *reporter.Reporter, configuration Configuration, dependencies Dependencies) *Component {
 	t.Helper()
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package webhook
+
+import (
+	"errors"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+// Configuration describes the configuration for the webhook output.
+type Configuration struct {
+	// URL is the endpoint receiving flows.
+	URL string
+	// Headers are additional HTTP headers to send with each request.
+	Headers map[string]string
+	// Format is the format used to encode batches of flows.
+	Format Format
+	// BatchSize is the maximum number of flows to send at once.
+	BatchSize int `validate:"min=1"`
+	// FlushInterval is the maximum time to wait before sending
+	// pending flows.
+	FlushInterval time.Duration `validate:"min=100ms"`
+	// QueueSize is the number of flows waiting to be batched. When
+	// the queue is full, the inlet stops processing flows.
+	QueueSize int `validate:"min=0"`
+	// Timeout is the timeout for each request.
+	Timeout time.Duration `validate:"min=100ms"`
+	// MaxRetries is the number of times a batch is sent again after
+	// a failure.
+	MaxRetries int `validate:"min=0"`
+	// RetryBackoff is the time to wait before the first retry. It is
+	// doubled on each retry.
+	RetryBackoff time.Duration `validate:"min=0"`
+	// MaxRetryBackoff is the maximum time to wait between two retries.
+	MaxRetryBackoff time.Duration `validate:"gtefield=RetryBackoff"`
+}
+
+// DefaultConfiguration represents the default configuration for the
+// webhook output.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Format:          FormatJSON,
+		BatchSize:       1000,
+		FlushInterval:   5 * time.Second,
+		QueueSize:       10000,
+		Timeout:         10 * time.Second,
+		MaxRetries:      5,
+		RetryBackoff:    time.Second,
+		MaxRetryBackoff: 30 * time.Second,
+	}
+}
+
+// Format is the format used to encode batches of flows.
+type Format int
+
+const (
+	// FormatJSON encodes a batch of flows as a JSON array.
+	FormatJSON Format = iota
+	// FormatProtobuf encodes a batch of flows as a sequence of
+	// length-delimited protocol buffers.
+	FormatProtobuf
+)
+
+var formatMap = helpers.NewBimap(map[Format]string{
+	FormatJSON:     "json",
+	FormatProtobuf: "protobuf",
+})
+
+// MarshalText turns a format to text.
+func (f Format) MarshalText() ([]byte, error) {
+	got, ok := formatMap.LoadValue(f)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown format")
+}
+
+// String turns a format to string.
+func (f Format) String() string {
+	got, _ := formatMap.LoadValue(f)
+	return got
+}
+
+// UnmarshalText provides a format from a string.
+func (f *Format) UnmarshalText(input []byte) error {
+	got, ok := formatMap.LoadKey(string(input))
+	if ok {
+		*f = got
+		return nil
+	}
+	return errors.New("unknown format")
+}
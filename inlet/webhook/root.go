@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package webhook provides an output sending batches of flows to an
+// HTTP endpoint.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+// Component represents the webhook output.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	client    *http.Client
+	queue     chan *flow.Message
+	errLogger reporter.Logger
+	metrics   struct {
+		flowsReceived *reporter.CounterVec
+		flowsSent     reporter.Counter
+		flowsDropped  reporter.Counter
+		requests      *reporter.CounterVec
+		retries       reporter.Counter
+		errors        *reporter.CounterVec
+	}
+}
+
+// Dependencies define the dependencies of the webhook output.
+type Dependencies struct {
+	Daemon daemon.Component
+}
+
+// errPermanent is returned when a batch should not be sent again.
+var errPermanent = errors.New("permanent error")
+
+// New creates a new webhook output.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if configuration.URL == "" {
+		return nil, errors.New("an URL is required for the webhook output")
+	}
+	var err error
+	if configuration.Headers, err = helpers.ResolveSecrets(configuration.Headers); err != nil {
+		return nil, fmt.Errorf("unable to resolve webhook headers: %w", err)
+	}
+	c := Component{
+		r:         r,
+		d:         &dependencies,
+		config:    configuration,
+		client:    &http.Client{Timeout: configuration.Timeout},
+		queue:     make(chan *flow.Message, configuration.QueueSize),
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+	}
+	c.d.Daemon.Track(&c.t, "inlet/webhook")
+	c.metrics.flowsReceived = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flows_received_total",
+			Help: "Number of flows received from a given exporter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.flowsSent = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_sent_total",
+			Help: "Number of flows sent to the webhook.",
+		},
+	)
+	c.metrics.flowsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "flows_dropped_total",
+			Help: "Number of flows dropped after failing to send them.",
+		},
+	)
+	c.metrics.requests = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "requests_total",
+			Help: "Number of requests sent to the webhook by status code.",
+		},
+		[]string{"code"},
+	)
+	c.metrics.retries = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "retries_total",
+			Help: "Number of times a batch was sent again.",
+		},
+	)
+	c.metrics.errors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of errors when sending flows.",
+		},
+		[]string{"error"},
+	)
+	return &c, nil
+}
+
+// Start starts the webhook output.
+func (c *Component) Start() error {
+	c.r.Info().Str("url", c.config.URL).Msg("starting webhook output")
+	c.t.Go(c.run)
+	return nil
+}
+
+// Stop stops the webhook output. Pending flows are sent once,
+// without retry.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("webhook output stopped")
+	c.r.Info().Msg("stopping webhook output")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// Send queues a flow to be sent to the webhook. It blocks when the
+// queue is full.
+func (c *Component) Send(exporter string, fl *flow.Message) {
+	c.metrics.flowsReceived.WithLabelValues(c.r.ExporterLabel(exporter)).Inc()
+	select {
+	case c.queue <- fl:
+	case <-c.t.Dying():
+	}
+}
+
+// run batches flows and sends them. When stopping, the flows still
+// queued are sent.
+func (c *Component) run() error {
+	flow.Batch(c.t.Dying(), c.queue, c.config.BatchSize, c.config.FlushInterval, c.sendWithRetries)
+	return nil
+}
+
+// sendWithRetries sends a batch of flows, retrying with an
+// exponential backoff on temporary errors.
+func (c *Component) sendWithRetries(flows []*flow.Message) {
+	payload, err := c.encode(flows)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("cannot encode flows").Inc()
+		c.metrics.flowsDropped.Add(float64(len(flows)))
+		c.errLogger.Err(err).Msg("unable to encode flows")
+		return
+	}
+	backoff := c.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.send(payload)
+		if err == nil {
+			c.metrics.flowsSent.Add(float64(len(flows)))
+			return
+		}
+		c.errLogger.Err(err).Int("flows", len(flows)).Int("attempt", attempt).Msg("unable to send flows")
+		if errors.Is(err, errPermanent) || attempt >= c.config.MaxRetries {
+			c.metrics.flowsDropped.Add(float64(len(flows)))
+			return
+		}
+		select {
+		case <-c.t.Dying():
+			c.metrics.flowsDropped.Add(float64(len(flows)))
+			return
+		case <-time.After(backoff):
+		}
+		c.metrics.retries.Inc()
+		backoff *= 2
+		if backoff > c.config.MaxRetryBackoff {
+			backoff = c.config.MaxRetryBackoff
+		}
+	}
+}
+
+// encode encodes a batch of flows.
+func (c *Component) encode(flows []*flow.Message) ([]byte, error) {
+	if c.config.Format == FormatProtobuf {
+		buf := proto.NewBuffer([]byte{})
+		for _, fl := range flows {
+			if err := buf.EncodeMessage(fl); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	}
+	return json.Marshal(flows)
+}
+
+// send sends an encoded batch of flows. Errors wrapping errPermanent
+// should not be retried.
+func (c *Component) send(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		c.metrics.errors.WithLabelValues("cannot build request").Inc()
+		return fmt.Errorf("%w: %s", errPermanent, err)
+	}
+	switch c.config.Format {
+	case FormatProtobuf:
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	default:
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range c.config.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.metrics.errors.WithLabelValues("cannot send request").Inc()
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	c.metrics.requests.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return fmt.Errorf("%w: unexpected status code %d", errPermanent, resp.StatusCode)
+}
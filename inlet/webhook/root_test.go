@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
+)
+
+// testServer records the requests it receives and answers with the
+// provided status codes (200 once exhausted).
+type testServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	codes    []int
+	requests []*http.Request
+	bodies   [][]byte
+	received chan bool
+}
+
+func newTestServer(t *testing.T, codes ...int) *testServer {
+	ts := &testServer{codes: codes, received: make(chan bool, 10)}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts.lock.Lock()
+		ts.requests = append(ts.requests, r)
+		ts.bodies = append(ts.bodies, body)
+		code := http.StatusOK
+		if len(ts.codes) > 0 {
+			code, ts.codes = ts.codes[0], ts.codes[1:]
+		}
+		ts.lock.Unlock()
+		w.WriteHeader(code)
+		ts.received <- true
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func (ts *testServer) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-ts.received:
+		case <-time.After(time.Second):
+			t.Fatalf("webhook request %d not received", i+1)
+		}
+	}
+}
+
+func newTestComponent(t *testing.T, configuration Configuration) (*reporter.Reporter, *Component) {
+	t.Helper()
+	r := reporter.NewMock(t)
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+	return r, c
+}
+
+func TestMissingURL(t *testing.T) {
+	r := reporter.NewMock(t)
+	if _, err := New(r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestUnresolvedHeader(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.URL = "http://127.0.0.1:1"
+	configuration.Headers = map[string]string{"Authorization": "${env:AKVORADO_TEST_MISSING}"}
+	if _, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	ts := newTestServer(t)
+	configuration := DefaultConfiguration()
+	configuration.URL = ts.URL
+	configuration.BatchSize = 2
+	t.Setenv("AKVORADO_TEST_WEBHOOK_TOKEN", "Bearer secret")
+	configuration.Headers = map[string]string{"Authorization": "${env:AKVORADO_TEST_WEBHOOK_TOKEN}"}
+	r, c := newTestComponent(t, configuration)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+	ts.wait(t, 1)
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if got := ts.requests[0].Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type: %q instead of application/json", got)
+	}
+	if got := ts.requests[0].Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization: %q instead of Bearer secret", got)
+	}
+	var got []struct{ SequenceNum int }
+	if err := json.Unmarshal(ts.bodies[0], &got); err != nil {
+		t.Fatalf("json.Unmarshal() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, []struct{ SequenceNum int }{{1}, {2}}); diff != "" {
+		t.Fatalf("Body (-got, +want):\n%s", diff)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_webhook_")
+	expectedMetrics := map[string]string{
+		`flows_received_total{exporter="127.0.0.1"}`: "2",
+		`flows_sent_total`:                           "2",
+		`requests_total{code="200"}`:                 "1",
+		`flows_dropped_total`:                        "0",
+		`retries_total`:                              "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestProtobufOnFlushInterval(t *testing.T) {
+	ts := newTestServer(t)
+	configuration := DefaultConfiguration()
+	configuration.URL = ts.URL
+	configuration.Format = FormatProtobuf
+	configuration.FlushInterval = 20 * time.Millisecond
+	_, c := newTestComponent(t, configuration)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1, ExporterName: "exporter1"})
+	ts.wait(t, 1)
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if got := ts.requests[0].Header.Get("Content-Type"); got != "application/x-protobuf" {
+		t.Errorf("Content-Type: %q instead of application/x-protobuf", got)
+	}
+	var got flow.Message
+	if err := proto.NewBuffer(ts.bodies[0]).DecodeMessage(&got); err != nil {
+		t.Fatalf("DecodeMessage() error:\n%+v", err)
+	}
+	expected := flow.Message{SequenceNum: 1, ExporterName: "exporter1"}
+	if diff := helpers.Diff(&got, &expected); diff != "" {
+		t.Fatalf("DecodeMessage() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ts := newTestServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	configuration := DefaultConfiguration()
+	configuration.URL = ts.URL
+	configuration.BatchSize = 1
+	configuration.RetryBackoff = time.Millisecond
+	r, c := newTestComponent(t, configuration)
+
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	ts.wait(t, 3)
+
+	time.Sleep(10 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_webhook_", "flows_sent", "requests_", "retries_")
+	expectedMetrics := map[string]string{
+		`flows_sent_total`:           "1",
+		`requests_total{code="200"}`: "1",
+		`requests_total{code="429"}`: "1",
+		`requests_total{code="503"}`: "1",
+		`retries_total`:              "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDropped(t *testing.T) {
+	ts := newTestServer(t,
+		http.StatusBadRequest,
+		http.StatusInternalServerError, http.StatusInternalServerError)
+	configuration := DefaultConfiguration()
+	configuration.URL = ts.URL
+	configuration.BatchSize = 1
+	configuration.MaxRetries = 1
+	configuration.RetryBackoff = time.Millisecond
+	r, c := newTestComponent(t, configuration)
+
+	// Not retried
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 1})
+	ts.wait(t, 1)
+	// Retried once
+	c.Send("127.0.0.1", &flow.Message{SequenceNum: 2})
+	ts.wait(t, 2)
+
+	time.Sleep(10 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_webhook_", "flows_", "retries_")
+	expectedMetrics := map[string]string{
+		`flows_received_total{exporter="127.0.0.1"}`: "2",
+		`flows_dropped_total`:                        "2",
+		`flows_sent_total`:                           "0",
+		`retries_total`:                              "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
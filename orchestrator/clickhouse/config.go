@@ -10,6 +10,7 @@ import (
 	"akvorado/common/clickhousedb"
 	"akvorado/common/helpers"
 	"akvorado/common/kafka"
+	"akvorado/inlet/flow"
 
 	"github.com/mitchellh/mapstructure"
 )
@@ -34,6 +35,14 @@ type Configuration struct {
 	// OrchestratorURL allows one to override URL to reach
 	// orchestrator from Clickhouse
 	OrchestratorURL string `validate:"isdefault|url"`
+	// FormatSchemaPath is the directory where ClickHouse looks for
+	// format schemas. When not empty, the protobuf schemas used by
+	// the Kafka engine are written there.
+	FormatSchemaPath string
+	// CustomFields are site-specific fields appended to the flow
+	// messages and to the flows table. They are propagated to the
+	// inlet configuration.
+	CustomFields []flow.CustomField `validate:"dive"`
 }
 
 // ResolutionConfiguration describes a consolidation interval.
@@ -45,6 +54,10 @@ type ResolutionConfiguration struct {
 	// TTL is how long to keep data for this resolution. A
 	// value of 0 means to never expire.
 	TTL time.Duration
+	// Dimensions are additional columns to keep in the
+	// consolidated table. They are always present when
+	// interval is 0.
+	Dimensions []string `validate:"dive,oneof=SrcAddr DstAddr SrcPort DstPort"`
 }
 
 // KafkaConfiguration describes Kafka-specific configuration
@@ -62,10 +75,10 @@ func DefaultConfiguration() Configuration {
 			Consumers: 1,
 		},
 		Resolutions: []ResolutionConfiguration{
-			{0, 15 * 24 * time.Hour},                   // 15 days
-			{time.Minute, 7 * 24 * time.Hour},          // 7 days
-			{5 * time.Minute, 3 * 30 * 24 * time.Hour}, // 90 days
-			{time.Hour, 12 * 30 * 24 * time.Hour},      // 1 year
+			{Interval: 0, TTL: 15 * 24 * time.Hour},                   // 15 days
+			{Interval: time.Minute, TTL: 7 * 24 * time.Hour},          // 7 days
+			{Interval: 5 * time.Minute, TTL: 3 * 30 * 24 * time.Hour}, // 90 days
+			{Interval: time.Hour, TTL: 12 * 30 * 24 * time.Hour},      // 1 year
 		},
 		MaxPartitions: 50,
 	}
@@ -4,6 +4,7 @@
 package clickhouse
 
 import (
+	"bytes"
 	"embed"
 	"encoding/csv"
 	"fmt"
@@ -17,7 +18,6 @@ import (
 )
 
 var (
-	//go:embed data/protocols.csv
 	//go:embed data/asns.csv
 	data           embed.FS
 	initShTemplate = template.Must(template.New("initsh").Parse(`#!/bin/sh
@@ -49,7 +49,13 @@ func (c *Component) registerHTTPHandlers() error {
 	c.d.HTTP.AddHandler("/api/v0/orchestrator/clickhouse/init.sh",
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/x-shellscript")
-			initShTemplate.Execute(w, flow.VersionedSchemas)
+			initShTemplate.Execute(w, flow.SchemasWithCustomFields(c.config.CustomFields))
+		}))
+
+	// protocols.csv
+	c.d.HTTP.AddHandler("/api/v0/orchestrator/clickhouse/protocols.csv",
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "protocols.csv", time.Time{}, bytes.NewReader(flow.ProtocolsCSV))
 		}))
 
 	// networks.csv
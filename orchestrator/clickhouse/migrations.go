@@ -4,13 +4,17 @@
 package clickhouse
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 
 	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
 )
 
 type migrationStep struct {
@@ -30,9 +34,7 @@ type migrationStepWithDescription struct {
 }
 
 // migrateDatabase execute database migration
-func (c *Component) migrateDatabase() error {
-	ctx := c.t.Context(nil)
-
+func (c *Component) migrateDatabase(ctx context.Context) error {
 	// Set orchestrator URL
 	if c.config.OrchestratorURL == "" {
 		baseURL, err := c.getHTTPBaseURL("1.1.1.1:80")
@@ -58,6 +60,14 @@ func (c *Component) migrateDatabase() error {
 		c.config.Kafka.Consumers = int(threads)
 	}
 
+	// Install protobuf schemas for the Kafka engine
+	if c.config.FormatSchemaPath != "" {
+		if err := c.writeFormatSchemas(); err != nil {
+			c.r.Err(err).Msg("unable to write format schemas")
+			return fmt.Errorf("unable to write format schemas: %w", err)
+		}
+	}
+
 	steps := []migrationStepWithDescription{
 		{"create protocols dictionary", c.migrationStepCreateProtocolsDictionary},
 		{"create asns dictionary", c.migrationStepCreateASNsDictionary},
@@ -86,6 +96,15 @@ func (c *Component) migrateDatabase() error {
 			}, {
 				fmt.Sprintf("add DstASPath columns to flows table with resolution %s", resolution.Interval),
 				c.migrationStepAddDstASPathColumns(resolution),
+			}, {
+				fmt.Sprintf("add InIfPeerAS/OutIfPeerAS to flows table with resolution %s", resolution.Interval),
+				c.migrationStepAddInterfacePeerASColumns(resolution),
+			}, {
+				fmt.Sprintf("add InIfBillingGroup/OutIfBillingGroup to flows table with resolution %s", resolution.Interval),
+				c.migrationStepAddInterfaceBillingGroupColumns(resolution),
+			}, {
+				fmt.Sprintf("add ExporterCountry to flows table with resolution %s", resolution.Interval),
+				c.migrationStepAddExporterCountryColumn(resolution),
 			},
 		}...)
 		if resolution.Interval == 0 {
@@ -95,10 +114,22 @@ func (c *Component) migrateDatabase() error {
 			}, migrationStepWithDescription{
 				"add DstLargeCommunities column to flows table",
 				c.migrationStepAddDstLargeCommunitiesColumn,
+			}, migrationStepWithDescription{
+				"add DstCommunityNames column to flows table",
+				c.migrationStepAddDstCommunityNamesColumn,
+			}, migrationStepWithDescription{
+				"add ScanSuspect column to flows table",
+				c.migrationStepAddScanSuspectColumn,
+			}, migrationStepWithDescription{
+				"add custom columns to flows table",
+				c.migrationStepAddCustomColumns,
 			})
 		}
 		steps = append(steps, []migrationStepWithDescription{
 			{
+				fmt.Sprintf("add dimensions to flows table with resolution %s", resolution.Interval),
+				c.migrationStepAddDimensionsColumns(resolution),
+			}, {
 				fmt.Sprintf("create flows table consumer with resolution %s", resolution.Interval),
 				c.migrationsStepCreateFlowsConsumerTable(resolution),
 			}, {
@@ -112,6 +143,8 @@ func (c *Component) migrateDatabase() error {
 		{"create raw flows table", c.migrationStepCreateRawFlowsTable},
 		{"create raw flows consumer view", c.migrationStepCreateRawFlowsConsumerView},
 		{"create raw flows errors view", c.migrationStepCreateRawFlowsErrorsView},
+		{"create direct flows table", c.migrationStepCreateDirectFlowsTable},
+		{"create direct flows consumer view", c.migrationStepCreateDirectFlowsConsumerView},
 	}...)
 
 	count := 0
@@ -193,3 +226,40 @@ func (c *Component) getHTTPBaseURL(address string) (string, error) {
 	c.r.Debug().Msgf("detected base URL is %s", base)
 	return base, nil
 }
+
+// writeFormatSchemas writes the protobuf schemas into the format
+// schema directory of ClickHouse. Existing files are only replaced
+// when their content is different.
+func (c *Component) writeFormatSchemas() error {
+	for version, schema := range flow.SchemasWithCustomFields(c.config.CustomFields) {
+		path := filepath.Join(c.config.FormatSchemaPath, fmt.Sprintf("flow-%d.proto", version))
+		current, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(current, []byte(schema)) {
+			continue
+		}
+		tmp, err := os.CreateTemp(c.config.FormatSchemaPath, fmt.Sprintf(".flow-%d-*.proto", version))
+		if err != nil {
+			return fmt.Errorf("cannot create temporary file: %w", err)
+		}
+		if _, err := tmp.WriteString(schema); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return fmt.Errorf("cannot write %s: %w", tmp.Name(), err)
+		}
+		if err := tmp.Chmod(0644); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return fmt.Errorf("cannot change mode of %s: %w", tmp.Name(), err)
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("cannot close %s: %w", tmp.Name(), err)
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("cannot rename %s: %w", tmp.Name(), err)
+		}
+		c.r.Info().Str("path", path).Msg("format schema installed")
+	}
+	return nil
+}
@@ -16,12 +16,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/golang/mock/gomock"
+
 	"akvorado/common/clickhousedb"
+	"akvorado/common/clickhousedb/mocks"
 	"akvorado/common/daemon"
+	"akvorado/common/election"
 	"akvorado/common/helpers"
 	"akvorado/common/http"
 	"akvorado/common/kafka"
 	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
 )
 
 var ignoredTables = []string{
@@ -161,6 +167,51 @@ func TestGetHTTPBaseURL(t *testing.T) {
 	}
 }
 
+func TestWriteFormatSchemas(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.FormatSchemaPath = t.TempDir()
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   http.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	// Outdated schema should be replaced
+	outdated := path.Join(configuration.FormatSchemaPath,
+		fmt.Sprintf("flow-%d.proto", flow.CurrentSchemaVersion))
+	if err := os.WriteFile(outdated, []byte("outdated"), 0644); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.writeFormatSchemas(); err != nil {
+			t.Fatalf("writeFormatSchemas() error:\n%+v", err)
+		}
+	}
+
+	got := map[string]string{}
+	entries, err := os.ReadDir(configuration.FormatSchemaPath)
+	if err != nil {
+		t.Fatalf("ReadDir() error:\n%+v", err)
+	}
+	for _, entry := range entries {
+		content, err := os.ReadFile(path.Join(configuration.FormatSchemaPath, entry.Name()))
+		if err != nil {
+			t.Fatalf("ReadFile() error:\n%+v", err)
+		}
+		got[entry.Name()] = string(content)
+	}
+	expected := map[string]string{}
+	for version, schema := range flow.VersionedSchemas {
+		expected[fmt.Sprintf("flow-%d.proto", version)] = schema
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("writeFormatSchemas() (-got, +want):\n%s", diff)
+	}
+}
+
 func TestMigration(t *testing.T) {
 	r := reporter.NewMock(t)
 	chComponent := clickhousedb.SetupClickHouse(t, r)
@@ -181,6 +232,7 @@ func TestMigration(t *testing.T) {
 				Daemon:     daemon.NewMock(t),
 				HTTP:       http.NewMock(t, r),
 				ClickHouse: chComponent,
+				Election:   election.NewMock(t, r),
 			})
 			if err != nil {
 				t.Fatalf("New() error:\n%+v", err)
@@ -216,6 +268,8 @@ WHERE database=currentDatabase() AND table NOT LIKE '.%'`)
 				"flows_1h0m0s_consumer",
 				"flows_1m0s",
 				"flows_1m0s_consumer",
+				"flows_3_direct",
+				"flows_3_direct_consumer",
 				"flows_3_raw",
 				"flows_3_raw_consumer",
 				"flows_3_raw_errors",
@@ -252,6 +306,7 @@ WHERE database=currentDatabase() AND table NOT LIKE '.%'`)
 				Daemon:     daemon.NewMock(t),
 				HTTP:       http.NewMock(t, r),
 				ClickHouse: chComponent,
+				Election:   election.NewMock(t, r),
 			})
 			if err != nil {
 				t.Fatalf("New() error:\n%+v", err)
@@ -293,3 +348,99 @@ GROUP BY table`)
 		})
 	}
 }
+
+func TestMigrationsWaitForLeader(t *testing.T) {
+	r := reporter.NewMock(t)
+	electionConfiguration := election.DefaultConfiguration()
+	electionConfiguration.Enabled = true
+	electionComponent, err := election.New(r, electionConfiguration, election.Dependencies{
+		Daemon: daemon.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("election.New() error:\n%+v", err)
+	}
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon:   daemon.NewMock(t),
+		HTTP:     http.NewMock(t, r),
+		Election: electionComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	// As we are not the leader, migrations are not attempted.
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-c.migrationsDone:
+		t.Fatal("migrations done while not leader")
+	default:
+	}
+	gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_migrations_", "running", "applied_steps")
+	expectedMetrics := map[string]string{
+		`running`:       "1",
+		`applied_steps`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestMigrationsAbortOnLeadershipLoss(t *testing.T) {
+	r := reporter.NewMock(t)
+	electionConfiguration := election.DefaultConfiguration()
+	electionConfiguration.Enabled = true
+	electionComponent, err := election.New(r, electionConfiguration, election.Dependencies{
+		Daemon: daemon.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("election.New() error:\n%+v", err)
+	}
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	configuration := DefaultConfiguration()
+	configuration.OrchestratorURL = "http://127.0.0.1:8080"
+	c, err := New(r, configuration, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       http.NewMock(t, r),
+		ClickHouse: chComponent,
+		Election:   electionComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	// The first query blocks until the migration is aborted.
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	ctrl := gomock.NewController(t)
+	mockRow := mocks.NewMockRow(ctrl)
+	mockRow.EXPECT().Err().Return(context.Canceled)
+	mockConn.EXPECT().
+		QueryRow(gomock.Any(), `SELECT getSetting('max_threads')`).
+		DoAndReturn(func(ctx context.Context, _ string, _ ...interface{}) driver.Row {
+			close(started)
+			<-ctx.Done()
+			close(aborted)
+			return mockRow
+		})
+	helpers.StartStop(t, c)
+
+	electionComponent.SetLeader(true)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("migration not started once leader")
+	}
+	electionComponent.SetLeader(false)
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("migration not aborted after losing leadership")
+	}
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-c.migrationsDone:
+		t.Fatal("migrations done while not leader")
+	default:
+	}
+}
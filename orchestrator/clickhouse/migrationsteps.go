@@ -27,6 +27,7 @@ const (
  ExporterSite LowCardinality(String),
  ExporterRegion LowCardinality(String),
  ExporterTenant LowCardinality(String),
+ ExporterCountry FixedString(2),
  SrcAddr IPv6,
  DstAddr IPv6,
  SrcAS UInt32,
@@ -49,6 +50,7 @@ const (
  Dst3rdAS UInt32,
  DstCommunities Array(UInt32),
  DstLargeCommunities Array(UInt128),
+ DstCommunityNames Array(LowCardinality(String)),
  InIfName LowCardinality(String),
  OutIfName LowCardinality(String),
  InIfDescription String,
@@ -59,6 +61,10 @@ const (
  OutIfConnectivity LowCardinality(String),
  InIfProvider LowCardinality(String),
  OutIfProvider LowCardinality(String),
+ InIfPeerAS UInt32,
+ OutIfPeerAS UInt32,
+ InIfBillingGroup LowCardinality(String),
+ OutIfBillingGroup LowCardinality(String),
  InIfBoundary Enum8('undefined' = 0, 'external' = 1, 'internal' = 2),
  OutIfBoundary Enum8('undefined' = 0, 'external' = 1, 'internal' = 2),
  EType UInt32,
@@ -67,7 +73,8 @@ const (
  DstPort UInt32,
  Bytes UInt64,
  Packets UInt64,
- ForwardingStatus UInt32
+ ForwardingStatus UInt32,
+ ScanSuspect Bool
 `
 )
 
@@ -75,16 +82,28 @@ const (
 // specified schema. This is not foolproof as it needs help if
 // settings or populate query is changed.
 func queryTableHash(hash uint64, more string) string {
+	return queryTableHashWithCustomFields(hash, more, 0, nil)
+}
+
+// queryTableHashWithCustomFields is like queryTableHash but also
+// expects the provided custom fields as additional columns, starting
+// at the provided position.
+func queryTableHashWithCustomFields(hash uint64, more string, position int, fields []flow.CustomField) string {
+	expected := fmt.Sprint(hash)
+	for idx, field := range fields {
+		expected = fmt.Sprintf("bitXor(%s, cityHash64('%s', '%s', toUInt64(%d)))",
+			expected, field.Name, field.Type.ClickHouseType(), position+idx)
+	}
 	return fmt.Sprintf(`
 SELECT bitAnd(v1, v2) FROM (
  SELECT 1 AS v1
  FROM system.tables
  WHERE name = $1 AND database = currentDatabase() %s
 ) t1, (
- SELECT groupBitXor(cityHash64(name,type,position)) == %d AS v2
+ SELECT groupBitXor(cityHash64(name,type,position)) == %s AS v2
  FROM system.columns
  WHERE table = $1 AND database = currentDatabase()
-) t2`, more, hash)
+) t2`, more, expected)
 }
 
 // partialSchema returns the above schema minus some columns
@@ -102,6 +121,38 @@ outer:
 	return strings.Join(schema, "\n")
 }
 
+// schemaColumnsCount returns the number of columns of the provided
+// schema.
+func schemaColumnsCount(schema string) int {
+	count := 0
+	for _, l := range strings.Split(schema, "\n") {
+		if strings.TrimSpace(l) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// customColumnsSpecs returns the creation specs of the columns for the
+// provided custom fields.
+func customColumnsSpecs(fields []flow.CustomField) []string {
+	specs := make([]string, len(fields))
+	for idx, field := range fields {
+		specs[idx] = fmt.Sprintf("%s %s", field.Name, field.Type.ClickHouseType())
+	}
+	return specs
+}
+
+// customColumnsNames returns the names of the columns for the provided
+// custom fields.
+func customColumnsNames(fields []flow.CustomField) []string {
+	names := make([]string, len(fields))
+	for idx, field := range fields {
+		names[idx] = field.Name
+	}
+	return names
+}
+
 // columnSpecToName extracts column name from its creation spec
 func columnSpecToName(spec string) string {
 	spec = strings.TrimPrefix(spec, "IF NOT EXISTS ")
@@ -159,6 +210,56 @@ var nullMigrationStep = migrationStep{
 	Do:         func() error { return nil },
 }
 
+// consolidatedExcludedColumns are the columns of the flows table not
+// present in consolidated tables, unless requested as dimensions.
+var consolidatedExcludedColumns = []string{
+	"SrcAddr", "DstAddr", "SrcPort", "DstPort",
+	"DstASPath", "DstCommunities", "DstLargeCommunities", "DstCommunityNames",
+	"ScanSuspect",
+}
+
+// excludedColumns returns the columns of the flows table not present
+// in the consolidated table for the provided resolution.
+func (resolution ResolutionConfiguration) excludedColumns() []string {
+	excluded := []string{}
+outer:
+	for _, column := range consolidatedExcludedColumns {
+		for _, dimension := range resolution.Dimensions {
+			if column == dimension {
+				continue outer
+			}
+		}
+		excluded = append(excluded, column)
+	}
+	return excluded
+}
+
+// dimensions returns the additional dimensions for the provided
+// resolution, in the order of the flows schema.
+func (resolution ResolutionConfiguration) dimensions() []string {
+	dimensions := []string{}
+	for _, column := range consolidatedExcludedColumns {
+		for _, dimension := range resolution.Dimensions {
+			if column == dimension {
+				dimensions = append(dimensions, column)
+				break
+			}
+		}
+	}
+	return dimensions
+}
+
+// columnSpec returns the specification of a column from the flows schema.
+func columnSpec(name string) string {
+	for _, l := range strings.Split(flowsSchema, "\n") {
+		l = strings.TrimSuffix(strings.TrimSpace(l), ",")
+		if strings.HasPrefix(l, fmt.Sprintf("%s ", name)) {
+			return l
+		}
+	}
+	panic(fmt.Sprintf("unknown column %s", name))
+}
+
 func (c *Component) migrationsStepCreateFlowsTable(resolution ResolutionConfiguration) migrationStepFunc {
 	return func(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
 		if resolution.Interval == 0 {
@@ -231,12 +332,11 @@ ORDER BY (TimeReceived,
           SrcNetRegion, DstNetRegion,
           SrcNetTenant, DstNetTenant,
           SrcCountry, DstCountry,
-          Dst1stAS, Dst2ndAS, Dst3rdAS)`,
+          Dst1stAS, Dst2ndAS, Dst3rdAS%s)`,
 					tableName,
-					partialSchema(
-						"SrcAddr", "DstAddr", "SrcPort", "DstPort",
-						"DstASPath", "DstCommunities", "DstLargeCommunities"),
-					partitionInterval))
+					partialSchema(resolution.excludedColumns()...),
+					partitionInterval,
+					strings.Join(append([]string{""}, resolution.dimensions()...), ", ")))
 			},
 		}
 	}
@@ -366,6 +466,29 @@ WHERE table = $1 AND database = currentDatabase() AND name = $2`,
 	}
 }
 
+func (c *Component) migrationStepAddExporterCountryColumn(resolution ResolutionConfiguration) migrationStepFunc {
+	return func(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+		var tableName string
+		if resolution.Interval == 0 {
+			tableName = "flows"
+		} else {
+			tableName = fmt.Sprintf("flows_%s", resolution.Interval)
+		}
+		return migrationStep{
+			CheckQuery: `
+SELECT 1 FROM system.columns
+WHERE table = $1 AND database = currentDatabase() AND name = $2`,
+			Args: []interface{}{tableName, "ExporterCountry"},
+			Do: func() error {
+				return conn.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s %s`,
+					tableName, addColumnsAfter("ExporterTenant",
+						`ExporterCountry FixedString(2)`,
+					)))
+			},
+		}
+	}
+}
+
 func (c *Component) migrationStepFixOrderByCountry(resolution ResolutionConfiguration) migrationStepFunc {
 	return func(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
 		var tableName string
@@ -449,6 +572,54 @@ WHERE table = $1 AND database = currentDatabase() AND name = $2`,
 	}
 }
 
+func (c *Component) migrationStepAddInterfacePeerASColumns(resolution ResolutionConfiguration) migrationStepFunc {
+	return func(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+		var tableName string
+		if resolution.Interval == 0 {
+			tableName = "flows"
+		} else {
+			tableName = fmt.Sprintf("flows_%s", resolution.Interval)
+		}
+		return migrationStep{
+			CheckQuery: `
+SELECT 1 FROM system.columns
+WHERE table = $1 AND database = currentDatabase() AND name = $2`,
+			Args: []interface{}{tableName, "OutIfPeerAS"},
+			Do: func() error {
+				return conn.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s %s`,
+					tableName, addColumnsAfter("OutIfProvider",
+						`InIfPeerAS UInt32`,
+						`OutIfPeerAS UInt32`,
+					)))
+			},
+		}
+	}
+}
+
+func (c *Component) migrationStepAddInterfaceBillingGroupColumns(resolution ResolutionConfiguration) migrationStepFunc {
+	return func(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+		var tableName string
+		if resolution.Interval == 0 {
+			tableName = "flows"
+		} else {
+			tableName = fmt.Sprintf("flows_%s", resolution.Interval)
+		}
+		return migrationStep{
+			CheckQuery: `
+SELECT 1 FROM system.columns
+WHERE table = $1 AND database = currentDatabase() AND name = $2`,
+			Args: []interface{}{tableName, "OutIfBillingGroup"},
+			Do: func() error {
+				return conn.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s %s`,
+					tableName, addColumnsAfter("OutIfPeerAS",
+						`InIfBillingGroup LowCardinality(String)`,
+						`OutIfBillingGroup LowCardinality(String)`,
+					)))
+			},
+		}
+	}
+}
+
 func (c *Component) migrationStepAddDstCommunitiesColumn(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
 	return migrationStep{
 		CheckQuery: `
@@ -485,6 +656,112 @@ WHERE table = $1 AND database = currentDatabase() AND name = $2`,
 	}
 }
 
+func (c *Component) migrationStepAddDstCommunityNamesColumn(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+	return migrationStep{
+		CheckQuery: `
+SELECT 1 FROM system.columns
+WHERE table = $1 AND database = currentDatabase() AND name = $2`,
+		Args: []interface{}{"flows", "DstCommunityNames"},
+		Do: func() error {
+			modifications, err := addColumnsAndUpdateSortingKey(ctx, conn, "flows",
+				"DstLargeCommunities",
+				"DstCommunityNames Array(LowCardinality(String))")
+			if err != nil {
+				return err
+			}
+			return conn.Exec(ctx, fmt.Sprintf(`ALTER TABLE flows %s`, modifications))
+		},
+	}
+}
+
+func (c *Component) migrationStepAddCustomColumns(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+	if len(c.config.CustomFields) == 0 {
+		return nullMigrationStep
+	}
+	names := customColumnsNames(c.config.CustomFields)
+	return migrationStep{
+		CheckQuery: fmt.Sprintf(`
+SELECT count() = %d FROM system.columns
+WHERE table = $1 AND database = currentDatabase() AND name IN ('%s')`,
+			len(names), strings.Join(names, "', '")),
+		Args: []interface{}{"flows"},
+		Do: func() error {
+			modifications := []string{}
+			for _, spec := range customColumnsSpecs(c.config.CustomFields) {
+				modifications = append(modifications, fmt.Sprintf("ADD COLUMN IF NOT EXISTS %s", spec))
+			}
+			return conn.Exec(ctx, fmt.Sprintf(`ALTER TABLE flows %s`,
+				strings.Join(modifications, ", ")))
+		},
+	}
+}
+
+func (c *Component) migrationStepAddScanSuspectColumn(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+	return migrationStep{
+		CheckQuery: `
+SELECT 1 FROM system.columns
+WHERE table = $1 AND database = currentDatabase() AND name = $2`,
+		Args: []interface{}{"flows", "ScanSuspect"},
+		Do: func() error {
+			modifications, err := addColumnsAndUpdateSortingKey(ctx, conn, "flows",
+				"ForwardingStatus",
+				"ScanSuspect Bool")
+			if err != nil {
+				return err
+			}
+			return conn.Exec(ctx, fmt.Sprintf(`ALTER TABLE flows %s`, modifications))
+		},
+	}
+}
+
+func (c *Component) migrationStepAddDimensionsColumns(resolution ResolutionConfiguration) migrationStepFunc {
+	return func(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+		dimensions := resolution.dimensions()
+		if resolution.Interval == 0 || len(dimensions) == 0 {
+			return nullMigrationStep
+		}
+		tableName := fmt.Sprintf("flows_%s", resolution.Interval)
+		return migrationStep{
+			CheckQuery: fmt.Sprintf(`
+SELECT count() = %d FROM system.columns
+WHERE table = $1 AND database = currentDatabase() AND name IN ('%s')`,
+				len(dimensions), strings.Join(dimensions, "', '")),
+			Args: []interface{}{tableName},
+			Do: func() error {
+				rows, err := conn.Query(ctx, `
+SELECT name FROM system.columns
+WHERE table = $1 AND database = currentDatabase()`, tableName)
+				if err != nil {
+					return fmt.Errorf("cannot get columns of %s: %w", tableName, err)
+				}
+				existing := map[string]bool{}
+				for rows.Next() {
+					var name string
+					if err := rows.Scan(&name); err != nil {
+						rows.Close()
+						return fmt.Errorf("cannot parse column name: %w", err)
+					}
+					existing[name] = true
+				}
+				rows.Close()
+				columns := []string{}
+				for _, dimension := range dimensions {
+					if !existing[dimension] {
+						columns = append(columns, columnSpec(dimension))
+					}
+				}
+				modifications, err := addColumnsAndUpdateSortingKey(ctx, conn, tableName,
+					"ForwardingStatus", columns...)
+				if err != nil {
+					return err
+				}
+				return conn.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s %s`,
+					tableName, modifications))
+			},
+		}
+	}
+}
+
 func (c *Component) migrationsStepCreateFlowsConsumerTable(resolution ResolutionConfiguration) migrationStepFunc {
 	return func(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
 		if resolution.Interval == 0 {
@@ -493,16 +770,34 @@ func (c *Component) migrationsStepCreateFlowsConsumerTable(resolution Resolution
 		}
 		tableName := fmt.Sprintf("flows_%s", resolution.Interval)
 		viewName := fmt.Sprintf("%s_consumer", tableName)
+		// Custom fields are only present in the flows table.
+		excluded := append(resolution.excludedColumns(), customColumnsNames(c.config.CustomFields)...)
 		selectClause := fmt.Sprintf(`
 SELECT *
-EXCEPT (SrcAddr, DstAddr, SrcPort, DstPort, DstASPath, DstCommunities, DstLargeCommunities)
+EXCEPT (%s)
 REPLACE toStartOfInterval(TimeReceived, toIntervalSecond(%d)) AS TimeReceived`,
+			strings.Join(excluded, ", "),
 			uint64(resolution.Interval.Seconds()))
 		selectClause = strings.TrimSpace(strings.ReplaceAll(selectClause, "\n", " "))
+		checkQuery := queryTableHash(11811491314457536624,
+			fmt.Sprintf("AND as_select LIKE '%s FROM %%'", selectClause))
+		if len(resolution.Dimensions) > 0 {
+			// The hash is only known without additional
+			// dimensions. Compare the columns of the view with
+			// the ones of the target table instead.
+			checkQuery = fmt.Sprintf(`
+SELECT 1 FROM system.tables
+WHERE name = $1 AND database = currentDatabase()
+AND as_select LIKE '%s FROM %%'
+AND (SELECT count() FROM system.columns
+     WHERE table = $1 AND database = currentDatabase()) =
+    (SELECT count() FROM system.columns
+     WHERE table = $2 AND database = currentDatabase() AND default_kind != 'ALIAS')`,
+				selectClause)
+		}
 		return migrationStep{
-			CheckQuery: queryTableHash(10874532506016793032,
-				fmt.Sprintf("AND as_select LIKE '%s FROM %%'", selectClause)),
-			Args: []interface{}{viewName},
+			CheckQuery: checkQuery,
+			Args:       []interface{}{viewName, tableName},
 			// No GROUP BY, the SummingMergeTree will take care of that
 			Do: func() error {
 				l.Debug().Msg("drop consumer table")
@@ -522,18 +817,23 @@ FROM %s`, viewName, tableName, selectClause, "flows"))
 
 func (c *Component) migrationsStepSetTTLFlowsTable(resolution ResolutionConfiguration) migrationStepFunc {
 	return func(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
-		if resolution.TTL == 0 {
-			l.Info().Msgf("not changing TTL for flows table with interval %s", resolution.Interval)
-			return migrationStep{
-				CheckQuery: `SELECT 1`,
-				Args:       []interface{}{},
-				Do:         func() error { return nil },
-			}
-		}
 		tableName := "flows"
 		if resolution.Interval != 0 {
 			tableName = fmt.Sprintf("flows_%s", resolution.Interval)
 		}
+		if resolution.TTL == 0 {
+			return migrationStep{
+				CheckQuery: `
+SELECT 1 FROM system.tables
+WHERE name = $1 AND database = currentDatabase() AND engine_full NOT LIKE $2`,
+				Args: []interface{}{tableName, "% TTL %"},
+				Do: func() error {
+					l.Warn().Msgf("removing TTL of flows table with interval %s",
+						resolution.Interval)
+					return conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s REMOVE TTL", tableName))
+				},
+			}
+		}
 		seconds := uint64(resolution.TTL.Seconds())
 		ttl := fmt.Sprintf("TTL TimeReceived + toIntervalSecond(%d)", seconds)
 		return migrationStep{
@@ -691,8 +991,9 @@ func (c *Component) migrationStepCreateRawFlowsTable(ctx context.Context, l repo
 		`kafka_handle_error_mode = 'stream'`,
 	}, ", "))
 	return migrationStep{
-		CheckQuery: queryTableHash(12139043515526919262, "AND engine_full = $2"),
-		Args:       []interface{}{tableName, kafkaEngine},
+		CheckQuery: queryTableHashWithCustomFields(16702587783366596068, "AND engine_full = $2",
+			rawFlowsColumnsCount+1, c.config.CustomFields),
+		Args: []interface{}{tableName, kafkaEngine},
 		Do: func() error {
 			l.Debug().Msg("drop raw consumer table")
 			err := conn.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s_consumer SYNC`, tableName))
@@ -705,31 +1006,52 @@ func (c *Component) migrationStepCreateRawFlowsTable(ctx context.Context, l repo
 				return fmt.Errorf("cannot drop raw table: %w", err)
 			}
 			l.Debug().Msg("create raw table")
-			return conn.Exec(ctx, fmt.Sprintf(`
+			return conn.Exec(ctx, rawFlowsTableQuery(tableName, kafkaEngine, c.config.CustomFields))
+		},
+	}
+}
+
+// rawFlowsExcludedColumns are the columns of the flows table not
+// present in the raw flows table. They are computed by the consumer
+// view.
+var rawFlowsExcludedColumns = []string{
+	"SrcNetName", "DstNetName",
+	"SrcNetRole", "DstNetRole",
+	"SrcNetSite", "DstNetSite",
+	"SrcNetRegion", "DstNetRegion",
+	"SrcNetTenant", "DstNetTenant",
+	"Dst1stAS", "Dst2ndAS", "Dst3rdAS",
+	"DstLargeCommunities",
+}
+
+// rawFlowsColumnsCount is the number of columns of the raw flows table,
+// without the custom fields. The nested column counts as 3 columns.
+var rawFlowsColumnsCount = schemaColumnsCount(partialSchema(rawFlowsExcludedColumns...)) + 3
+
+// rawFlowsTableQuery returns the query to create a table with the
+// schema of flows as sent by the inlet. Custom fields come last.
+func rawFlowsTableQuery(tableName string, engine string, customFields []flow.CustomField) string {
+	custom := ""
+	for _, spec := range customColumnsSpecs(customFields) {
+		custom = fmt.Sprintf("%s,\n%s", custom, spec)
+	}
+	return fmt.Sprintf(`
 CREATE TABLE %s
 (
 %s,
-DstLargeCommunities Nested(ASN UInt32, LocalData1 UInt32, LocalData2 UInt32)
+DstLargeCommunities Nested(ASN UInt32, LocalData1 UInt32, LocalData2 UInt32)%s
 )
-ENGINE = %s`, tableName, partialSchema(
-				"SrcNetName", "DstNetName",
-				"SrcNetRole", "DstNetRole",
-				"SrcNetSite", "DstNetSite",
-				"SrcNetRegion", "DstNetRegion",
-				"SrcNetTenant", "DstNetTenant",
-				"Dst1stAS", "Dst2ndAS", "Dst3rdAS",
-				"DstLargeCommunities",
-			), kafkaEngine))
-		},
-	}
+ENGINE = %s`, tableName, partialSchema(rawFlowsExcludedColumns...), custom, engine)
 }
 
 func (c *Component) migrationStepCreateRawFlowsConsumerView(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
 	tableName := fmt.Sprintf("flows_%d_raw", flow.CurrentSchemaVersion)
 	viewName := fmt.Sprintf("%s_consumer", tableName)
 	return migrationStep{
-		CheckQuery: queryTableHash(11315614236043053967, "AND as_select LIKE '% WHERE length(_error) = 0'"),
-		Args:       []interface{}{viewName},
+		CheckQuery: queryTableHashWithCustomFields(1337494773615412690,
+			"AND as_select LIKE '% WHERE length(_error) = 0'",
+			schemaColumnsCount(flowsSchema)+1, c.config.CustomFields),
+		Args: []interface{}{viewName},
 		Do: func() error {
 			l.Debug().Msg("drop consumer table")
 			err := conn.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, viewName))
@@ -737,11 +1059,27 @@ func (c *Component) migrationStepCreateRawFlowsConsumerView(ctx context.Context,
 				return fmt.Errorf("cannot drop consumer table: %w", err)
 			}
 			l.Debug().Msg("create consumer table")
-			largeCommunitiesColumns := strings.Join([]string{
-				"`DstLargeCommunities.ASN`",
-				"`DstLargeCommunities.LocalData1`",
-				"`DstLargeCommunities.LocalData2`"}, ",")
-			return conn.Exec(ctx, fmt.Sprintf(`
+			return conn.Exec(ctx, rawFlowsConsumerViewQuery(viewName, tableName,
+				"WHERE length(_error) = 0", c.config.CustomFields))
+		},
+	}
+}
+
+// rawFlowsConsumerViewQuery returns the query to create a view
+// hydrating flows from a raw table and inserting them into the flows
+// table. Custom fields are selected last.
+func rawFlowsConsumerViewQuery(viewName string, tableName string, where string, customFields []flow.CustomField) string {
+	largeCommunitiesColumns := strings.Join([]string{
+		"`DstLargeCommunities.ASN`",
+		"`DstLargeCommunities.LocalData1`",
+		"`DstLargeCommunities.LocalData2`"}, ",")
+	exceptColumns := largeCommunitiesColumns
+	custom := ""
+	for _, name := range customColumnsNames(customFields) {
+		exceptColumns = fmt.Sprintf("%s,%s", exceptColumns, name)
+		custom = fmt.Sprintf("%s,\n %s", custom, name)
+	}
+	return strings.TrimSpace(fmt.Sprintf(`
 CREATE MATERIALIZED VIEW %s TO flows
 AS WITH arrayCompact(DstASPath) AS c_DstASPath SELECT
  * EXCEPT (%s),
@@ -758,12 +1096,47 @@ AS WITH arrayCompact(DstASPath) AS c_DstASPath SELECT
  c_DstASPath[1] AS Dst1stAS,
  c_DstASPath[2] AS Dst2ndAS,
  c_DstASPath[3] AS Dst3rdAS,
- arrayMap((asn, l1, l2) -> bitShiftLeft(asn::UInt128, 64) + bitShiftLeft(l1::UInt128, 32) + l2::UInt128, %s) AS DstLargeCommunities
+ arrayMap((asn, l1, l2) -> bitShiftLeft(asn::UInt128, 64) + bitShiftLeft(l1::UInt128, 32) + l2::UInt128, %s) AS DstLargeCommunities%s
 FROM %s
-WHERE length(_error) = 0`,
-				viewName,
-				largeCommunitiesColumns, largeCommunitiesColumns,
-				tableName))
+%s`,
+		viewName,
+		exceptColumns, largeCommunitiesColumns, custom,
+		tableName, where))
+}
+
+func (c *Component) migrationStepCreateDirectFlowsTable(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+	tableName := fmt.Sprintf("flows_%d_direct", flow.CurrentSchemaVersion)
+	return migrationStep{
+		// Same columns as the raw table, only the engine differs.
+		CheckQuery: queryTableHashWithCustomFields(16702587783366596068, "AND engine = 'Null'",
+			rawFlowsColumnsCount+1, c.config.CustomFields),
+		Args: []interface{}{tableName},
+		Do: func() error {
+			l.Debug().Msg("drop direct flows consumer view")
+			err := conn.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s_consumer SYNC`, tableName))
+			if err != nil {
+				return fmt.Errorf("cannot drop direct flows consumer view: %w", err)
+			}
+			l.Debug().Msg("drop direct flows table")
+			err = conn.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, tableName))
+			if err != nil {
+				return fmt.Errorf("cannot drop direct flows table: %w", err)
+			}
+			l.Debug().Msg("create direct flows table")
+			return conn.Exec(ctx, rawFlowsTableQuery(tableName, "Null", c.config.CustomFields))
+		},
+	}
+}
+
+func (c *Component) migrationStepCreateDirectFlowsConsumerView(ctx context.Context, l reporter.Logger, conn clickhouse.Conn) migrationStep {
+	tableName := fmt.Sprintf("flows_%d_direct", flow.CurrentSchemaVersion)
+	viewName := fmt.Sprintf("%s_consumer", tableName)
+	return migrationStep{
+		CheckQuery: `SELECT 1 FROM system.tables WHERE name = $1 AND database = currentDatabase()`,
+		Args:       []interface{}{viewName},
+		Do: func() error {
+			l.Debug().Msg("create direct flows consumer view")
+			return conn.Exec(ctx, rawFlowsConsumerViewQuery(viewName, tableName, "", c.config.CustomFields))
 		},
 	}
 }
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2022 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/flow"
+)
+
+func TestRawFlowsTableMatchesProtobuf(t *testing.T) {
+	// ClickHouse matches protobuf fields with columns case-insensitively.
+	fields := map[string]bool{}
+	descriptor := (&flow.Message{}).ProtoReflect().Descriptor()
+	for i := 0; i < descriptor.Fields().Len(); i++ {
+		fields[strings.ToLower(string(descriptor.Fields().Get(i).Name()))] = true
+	}
+
+	query := rawFlowsTableQuery("flows_raw", "Null", nil)
+	start := strings.Index(query, "(\n")
+	end := strings.LastIndex(query, "\n)")
+	for _, line := range strings.Split(query[start+2:end], "\n") {
+		line = strings.Trim(line, " ,")
+		if line == "" {
+			continue
+		}
+		column := columnSpecToName(line)
+		if !fields[strings.ToLower(column)] {
+			t.Errorf("column %s of raw flows table is not in protobuf schema", column)
+		}
+	}
+}
+
+func TestResolutionDimensions(t *testing.T) {
+	resolution := ResolutionConfiguration{
+		Interval:   time.Minute,
+		Dimensions: []string{"DstPort", "SrcAddr"},
+	}
+	if diff := helpers.Diff(resolution.dimensions(), []string{"SrcAddr", "DstPort"}); diff != "" {
+		t.Errorf("dimensions() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(resolution.excludedColumns(), []string{
+		"DstAddr", "SrcPort",
+		"DstASPath", "DstCommunities", "DstLargeCommunities", "DstCommunityNames",
+		"ScanSuspect",
+	}); diff != "" {
+		t.Errorf("excludedColumns() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(columnSpec("DstPort"), "DstPort UInt32"); diff != "" {
+		t.Errorf("columnSpec() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestCustomFieldsColumns(t *testing.T) {
+	customFields := []flow.CustomField{
+		{Name: "VRF", Number: 1000, Type: flow.CustomFieldUint, DecoderElement: 234},
+		{Name: "Site", Number: 1001, Expression: `"paris"`},
+	}
+
+	query := rawFlowsTableQuery("flows_raw", "Null", customFields)
+	if !strings.Contains(query, "LocalData2 UInt32),\nVRF UInt64,\nSite LowCardinality(String)\n)") {
+		t.Errorf("rawFlowsTableQuery() does not end with custom fields:\n%s", query)
+	}
+	if rawFlowsColumnsCount != 46 {
+		t.Errorf("rawFlowsColumnsCount == %d, expected 46", rawFlowsColumnsCount)
+	}
+
+	query = rawFlowsConsumerViewQuery("flows_raw_consumer", "flows_raw", "", customFields)
+	if !strings.Contains(query, "`DstLargeCommunities.LocalData2`,VRF,Site),") {
+		t.Errorf("rawFlowsConsumerViewQuery() does not exclude custom fields:\n%s", query)
+	}
+	if !strings.Contains(query, "AS DstLargeCommunities,\n VRF,\n Site\nFROM flows_raw") {
+		t.Errorf("rawFlowsConsumerViewQuery() does not select custom fields last:\n%s", query)
+	}
+
+	query = queryTableHashWithCustomFields(10, "", 40, customFields)
+	expected := "== bitXor(bitXor(10, cityHash64('VRF', 'UInt64', toUInt64(40))), " +
+		"cityHash64('Site', 'LowCardinality(String)', toUInt64(41))) AS v2"
+	if !strings.Contains(query, expected) {
+		t.Errorf("queryTableHashWithCustomFields() does not contain %q:\n%s", expected, query)
+	}
+	if queryTableHash(10, "") != queryTableHashWithCustomFields(10, "", 40, nil) {
+		t.Error("queryTableHash() and queryTableHashWithCustomFields() differ without custom fields")
+	}
+}
@@ -5,6 +5,7 @@
 package clickhouse
 
 import (
+	"context"
 	"sort"
 
 	"github.com/cenkalti/backoff/v4"
@@ -12,8 +13,10 @@ import (
 
 	"akvorado/common/clickhousedb"
 	"akvorado/common/daemon"
+	"akvorado/common/election"
 	"akvorado/common/http"
 	"akvorado/common/reporter"
+	"akvorado/inlet/flow"
 )
 
 // Component represents the ClickHouse configurator.
@@ -38,10 +41,15 @@ type Dependencies struct {
 	Daemon     daemon.Component
 	HTTP       *http.Component
 	ClickHouse *clickhousedb.Component
+	Election   *election.Component
 }
 
 // New creates a new ClickHouse component.
 func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if err := flow.ValidateCustomFields(configuration.CustomFields); err != nil {
+		return nil, err
+	}
+	configuration.CustomFields = flow.SortCustomFields(configuration.CustomFields)
 	c := Component{
 		r:              r,
 		d:              &dependencies,
@@ -97,11 +105,38 @@ func (c *Component) Start() error {
 		ticker := backoff.NewTicker(customBackoff)
 		defer ticker.Stop()
 		for {
+			// Only the leader applies migrations.
+			if !c.d.Election.IsLeader() {
+				c.r.Info().Msg("waiting to be the leader to migrate database")
+			}
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-c.d.Election.Leading():
+			}
+
+			// Abort the migration if the leadership is lost.
+			ctx, cancel := context.WithCancel(c.t.Context(nil))
+			lost := c.d.Election.Lost()
+			go func() {
+				select {
+				case <-lost:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
 			c.r.Info().Msg("attempting database migration")
-			if err := c.migrateDatabase(); err == nil {
+			err := c.migrateDatabase(ctx)
+			cancel()
+			if err == nil {
 				return nil
 			}
 			select {
+			case <-lost:
+				c.r.Warn().Msg("leadership lost during database migration")
+			default:
+			}
+			select {
 			case <-c.t.Dying():
 				return nil
 			case <-ticker.C: